@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// AccessLogConfig configures logging the requests handled by the API.
+type AccessLogConfig struct {
+	// Enabled logs every request under the `api` selector.
+	Enabled bool `config:"enabled"`
+
+	// SampleRate is the fraction of requests logged, between 0 and 1. All
+	// requests are logged if 0.
+	SampleRate float64 `config:"sample_rate"`
+}
+
+// Validate checks the sample rate is a fraction.
+func (c *AccessLogConfig) Validate() error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return errors.New("sample_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+type accessLogger struct {
+	log    *logp.Logger
+	sample func() bool
+}
+
+// newAccessLogger returns nil if access logs are disabled.
+func newAccessLogger(log *logp.Logger, cfg AccessLogConfig) (*accessLogger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	a := &accessLogger{log: log, sample: func() bool { return true }}
+	if rate := cfg.SampleRate; rate > 0 && rate < 1 {
+		a.sample = func() bool { return rand.Float64() < rate } //nolint:gosec // no need for a secure random number
+	}
+	return a, nil
+}
+
+func (a *accessLogger) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.sample() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rw, r)
+
+		a.log.Infow("HTTP request",
+			"http.request.method", r.Method,
+			"url.path", r.URL.Path,
+			"http.response.status_code", rw.status,
+			"http.response.body.bytes", rw.written,
+			"event.duration", time.Since(start),
+			"source.address", r.RemoteAddr,
+		)
+	})
+}
+
+// statusRecorder records the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(p)
+	r.written += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to access the underlying
+// ResponseWriter, e.g. to flush streamed responses.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
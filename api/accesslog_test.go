@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestAccessLog(t *testing.T) {
+	log, observed := logptest.NewTestingLoggerWithObserver(t, "")
+
+	cfg := DefaultConfig()
+	cfg.Host = localhostURL
+	cfg.AccessLog.Enabled = true
+	cfg.Auth.Token = "secret"
+	s, err := NewFromConfig(log, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	url := "http://" + s.Addr().String() + "/echo-hello"
+	assert.Equal(t, http.StatusOK, doRequest(t, http.DefaultClient, url, "Bearer secret"))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, http.DefaultClient, url, ""))
+
+	logs := observed.FilterMessage("HTTP request").AllUntimed()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "api", logs[0].LoggerName)
+
+	fields := logs[0].ContextMap()
+	assert.Equal(t, "GET", fields["http.request.method"])
+	assert.Equal(t, "/echo-hello", fields["url.path"])
+	assert.EqualValues(t, http.StatusOK, fields["http.response.status_code"])
+	assert.EqualValues(t, len("ehlo!"), fields["http.response.body.bytes"])
+	assert.IsType(t, time.Duration(0), fields["event.duration"])
+	assert.Contains(t, fields["source.address"], "127.0.0.1:")
+
+	assert.EqualValues(t, http.StatusUnauthorized, logs[1].ContextMap()["http.response.status_code"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	log := logptest.NewTestingLogger(t, "")
+
+	a, err := newAccessLogger(log, AccessLogConfig{Enabled: true, SampleRate: 0.5})
+	require.NoError(t, err)
+	sampled := 0
+	for range 1000 {
+		if a.sample() {
+			sampled++
+		}
+	}
+	assert.InDelta(t, 500, sampled, 150)
+
+	a, err = newAccessLogger(log, AccessLogConfig{SampleRate: 0.5})
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	_, err = newAccessLogger(log, AccessLogConfig{Enabled: true, SampleRate: 2})
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// AuthConfig configures the authorization of requests to the API.
+type AuthConfig struct {
+	// Token is the bearer token requests must present in the Authorization
+	// header. Disabled if empty.
+	Token string `config:"token"`
+
+	// PeerCredentials restricts access via unix sockets and named pipes to
+	// processes running as the same user as the server, as root or SYSTEM,
+	// or as one of AllowedUsers. The peer is identified by SO_PEERCRED on
+	// Linux, LOCAL_PEERCRED on macOS and the client process token on Windows.
+	PeerCredentials bool `config:"peer_credentials"`
+
+	// AllowedUsers lists additional users allowed to connect if
+	// PeerCredentials is enabled. Users are given by name, or by uid on unix
+	// and SID on Windows.
+	AllowedUsers []string `config:"allowed_users"`
+}
+
+// peerKey is the context key of the peer user of a connection.
+type peerKey struct{}
+
+// peer is the result of looking up the user of the process connected to the
+// server.
+type peer struct {
+	user string
+	err  error
+}
+
+type authenticator struct {
+	log   *logp.Logger
+	token []byte
+
+	// users are the users allowed to connect, nil if peer credentials are not
+	// checked.
+	users map[string]struct{}
+}
+
+// newAuthenticator returns nil if no authorization is configured.
+func newAuthenticator(log *logp.Logger, cfg AuthConfig, network string) (*authenticator, error) {
+	if cfg.Token == "" && !cfg.PeerCredentials {
+		if len(cfg.AllowedUsers) > 0 {
+			return nil, errors.New("allowed_users requires peer_credentials to be enabled")
+		}
+		return nil, nil
+	}
+
+	a := &authenticator{log: log}
+	if cfg.Token != "" {
+		a.token = []byte(cfg.Token)
+	}
+
+	if cfg.PeerCredentials {
+		if network == tcpNetwork {
+			return nil, errors.New("peer_credentials requires the host to be a unix socket or named pipe")
+		}
+
+		current, err := currentPeerUser()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup the current user: %w", err)
+		}
+		a.users = map[string]struct{}{
+			current:            {},
+			privilegedPeerUser: {},
+		}
+		for _, name := range cfg.AllowedUsers {
+			user, err := resolvePeerUser(name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed user %q: %w", name, err)
+			}
+			a.users[user] = struct{}{}
+		}
+	}
+	return a, nil
+}
+
+// connContext records the user of the process connected to the server if
+// peer credentials are checked.
+func (a *authenticator) connContext(ctx context.Context, conn net.Conn) context.Context {
+	if a.users == nil {
+		return ctx
+	}
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	user, err := peerUser(conn)
+	return context.WithValue(ctx, peerKey{}, peer{user: user, err: err})
+}
+
+func (a *authenticator) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.users != nil {
+			p, _ := r.Context().Value(peerKey{}).(peer)
+			if p.err != nil {
+				a.log.Warnf("Rejecting request to %v: failed to identify peer: %v", r.URL.Path, p.err)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			if _, ok := a.users[p.user]; !ok {
+				a.log.Warnf("Rejecting request to %v from user %v", r.URL.Path, p.user)
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		if a.token != nil && !a.validToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (a *authenticator) validToken(r *http.Request) bool {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), a.token) == 1
+}
@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func doRequest(t *testing.T, client *http.Client, url, token string) int {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	r, err := client.Do(req)
+	require.NoError(t, err)
+	r.Body.Close()
+	return r.StatusCode
+}
+
+func unixClient(sockFile string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
+				return net.Dial("unix", sockFile)
+			},
+		},
+	}
+}
+
+func TestAuthToken(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":       localhostURL,
+		"auth.token": "secret",
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	url := "http://" + s.Addr().String() + "/echo-hello"
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, http.DefaultClient, url, ""))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, http.DefaultClient, url, "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, doRequest(t, http.DefaultClient, url, "Basic secret"))
+	assert.Equal(t, http.StatusOK, doRequest(t, http.DefaultClient, url, "Bearer secret"))
+	assert.Equal(t, http.StatusOK, doRequest(t, http.DefaultClient, url, "bearer secret"))
+}
+
+func TestAuthPeerCredentials(t *testing.T) {
+	if isWindows() {
+		t.Skip("Unix Sockets don't work under windows")
+		return
+	}
+
+	start := func(allowed ...string) *http.Client {
+		sockFile := t.TempDir() + "/test.sock"
+		cfg := config.MustNewConfigFrom(map[string]interface{}{
+			"host":                  "unix://" + sockFile,
+			"auth.peer_credentials": true,
+		})
+
+		s, err := New(nil, simpleMux(), cfg)
+		require.NoError(t, err)
+		if allowed != nil {
+			s.auth.users = map[string]struct{}{}
+			for _, user := range allowed {
+				s.auth.users[user] = struct{}{}
+			}
+		}
+		go s.Start()
+		t.Cleanup(func() {
+			err := s.Stop()
+			require.NoError(t, err, "error stopping test server")
+		})
+		return unixClient(sockFile)
+	}
+
+	assert.Equal(t, http.StatusOK, doRequest(t, start(), "http://unix/echo-hello", ""))
+
+	// the current user is not allowed
+	assert.Equal(t, http.StatusForbidden, doRequest(t, start("4294967294"), "http://unix/echo-hello", ""))
+}
+
+func TestAuthConfig(t *testing.T) {
+	log := logptest.NewTestingLogger(t, "")
+
+	_, err := newAuthenticator(log, AuthConfig{PeerCredentials: true}, tcpNetwork)
+	assert.Error(t, err, "peer credentials are not available for TCP")
+
+	_, err = newAuthenticator(log, AuthConfig{AllowedUsers: []string{"root"}}, unixNetwork)
+	assert.Error(t, err, "allowed_users requires peer_credentials")
+
+	a, err := newAuthenticator(log, AuthConfig{}, tcpNetwork)
+	require.NoError(t, err)
+	assert.Nil(t, a)
+
+	if isWindows() {
+		return
+	}
+	a, err = newAuthenticator(log, AuthConfig{PeerCredentials: true, AllowedUsers: []string{"1234"}}, unixNetwork)
+	require.NoError(t, err)
+	assert.Contains(t, a.users, "0")
+	assert.Contains(t, a.users, "1234")
+
+	_, err = newAuthenticator(log, AuthConfig{PeerCredentials: true, AllowedUsers: []string{"no-such-user-exists"}}, unixNetwork)
+	assert.Error(t, err)
+}
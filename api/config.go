@@ -20,6 +20,8 @@ package api
 import (
 	"os"
 	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 )
 
 // Config is the configuration for the API endpoint.
@@ -30,6 +32,34 @@ type Config struct {
 	User               string        `config:"named_pipe.user"`
 	SecurityDescriptor string        `config:"named_pipe.security_descriptor"`
 	Timeout            time.Duration `config:"timeout"`
+
+	// ShutdownTimeout is the time active requests are given to finish when
+	// the server is shut down via the context passed to StartContext. No
+	// limit if 0.
+	ShutdownTimeout time.Duration `config:"shutdown_timeout"`
+
+	// SocketPermissions, SocketOwner and SocketGroup set the file mode and
+	// ownership of the unix socket. Owner and group are given by name or
+	// id, and default to the user running the process.
+	SocketPermissions uint32 `config:"unix_socket.permissions"`
+	SocketOwner       string `config:"unix_socket.owner"`
+	SocketGroup       string `config:"unix_socket.group"`
+
+	// TLS configures serving the API over TLS, including the verification
+	// of client certificates. Disabled if nil.
+	TLS *tlscommon.ServerConfig `config:"ssl"`
+
+	// Auth configures the authorization of requests.
+	Auth AuthConfig `config:"auth"`
+
+	// Pprof configures the pprof and expvar routes.
+	Pprof PprofConfig `config:"pprof"`
+
+	// Limits limits the request rate and concurrency.
+	Limits LimitsConfig `config:"limits"`
+
+	// AccessLog configures logging the handled requests.
+	AccessLog AccessLogConfig `config:"access_log"`
 }
 
 // DefaultConfig is the default configuration used by the API endpoint.
@@ -39,8 +69,23 @@ func DefaultConfig() Config {
 		Host:    "localhost",
 		Port:    5066,
 		Timeout: time.Second * 5,
+
+		ShutdownTimeout:   time.Second * 5,
+		SocketPermissions: uint32(socketFileMode),
 	}
 }
 
 // File mode for the socket file, owner of the process can do everything, member of the group can read.
 const socketFileMode = os.FileMode(0740)
+
+func (c *Config) socketMode() os.FileMode {
+	if c.SocketPermissions == 0 {
+		return socketFileMode
+	}
+	return os.FileMode(c.SocketPermissions).Perm()
+}
+
+func (c *Config) hasSocketOptions() bool {
+	return c.SocketOwner != "" || c.SocketGroup != "" ||
+		(c.SocketPermissions != 0 && os.FileMode(c.SocketPermissions) != socketFileMode)
+}
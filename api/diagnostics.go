@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"runtime/pprof"
+	"sort"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Diagnostics selects the content of the diagnostics bundle served by
+// DiagnosticsHandler. The bundle always contains a goroutine dump and the
+// build information of the binary.
+type Diagnostics struct {
+	// Registries are included as `registry/<name>.json` snapshots.
+	Registries map[string]*monitoring.Registry
+
+	// Config is included as `config.yaml`, with secrets redacted, see
+	// config.C.RedactedString.
+	Config *config.C
+
+	// RedactPatterns are additional patterns of config keys to redact.
+	RedactPatterns []string
+
+	// Logs are the recent log entries included as `logs.ndjson`.
+	Logs *logp.RingBuffer
+}
+
+// DiagnosticsHandler returns a handler streaming a zip archive with the
+// diagnostics.
+func DiagnosticsHandler(d Diagnostics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now().UTC()
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="diagnostics-%s.zip"`, now.Format("2006-01-02T15-04-05Z")))
+
+		// Headers are sent with the first write, errors can only be
+		// reported by aborting the archive.
+		if err := d.write(w, now); err != nil {
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// AttachDiagnostics attaches the diagnostics bundle route at /diagnostics.
+func (s *Server) AttachDiagnostics(d Diagnostics) error {
+	return s.AttachHandler("/diagnostics", DiagnosticsHandler(d))
+}
+
+func (d Diagnostics) write(w io.Writer, now time.Time) error {
+	zw := zip.NewWriter(w)
+
+	add := func(name string, write func(io.Writer) error) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			return fmt.Errorf("failed to write %v: %w", name, err)
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(d.Registries))
+	for name := range d.Registries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reg := d.Registries[name]
+		err := add("registry/"+name+".json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(monitoring.CollectStructSnapshot(reg, monitoring.Full, false))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Config != nil {
+		err := add("config.yaml", func(w io.Writer) error {
+			_, err := io.WriteString(w, d.Config.RedactedString(d.RedactPatterns...))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.Logs != nil {
+		err := add("logs.ndjson", func(w io.Writer) error {
+			_, err := d.Logs.WriteTo(w)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := add("goroutines.txt", func(w io.Writer) error {
+		return pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = add("build_info.txt", func(w io.Writer) error {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			_, err := io.WriteString(w, "build information not available\n")
+			return err
+		}
+		_, err := io.WriteString(w, info.String())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
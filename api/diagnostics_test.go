@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestDiagnostics(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.NewInt(reg, "events.published").Set(42)
+
+	ring := logp.NewRingBuffer(10, zapcore.InfoLevel)
+	logp.NewNopLogger().WithOptions(ring.Option()).Info("recent message")
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"output.elasticsearch": map[string]interface{}{
+			"hosts":    []string{"localhost:9200"},
+			"password": "secret",
+		},
+	})
+
+	s, err := New(nil, simpleMux(), config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	}))
+	require.NoError(t, err)
+	require.NoError(t, s.AttachDiagnostics(Diagnostics{
+		Registries: map[string]*monitoring.Registry{"stats": reg},
+		Config:     cfg,
+		Logs:       ring,
+	}))
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	req, err := http.NewRequestWithContext(context.Background(), "GET", "http://"+s.Addr().String()+"/diagnostics", nil)
+	require.NoError(t, err)
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer r.Body.Close()
+	assert.Equal(t, "application/zip", r.Header.Get("Content-Type"))
+	assert.Contains(t, r.Header.Get("Content-Disposition"), "diagnostics-")
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+
+	require.Contains(t, files, "registry/stats.json")
+	var snapshot map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(files["registry/stats.json"]), &snapshot))
+	assert.EqualValues(t, 42, snapshot["events"].(map[string]interface{})["published"])
+
+	assert.Contains(t, files["config.yaml"], "localhost:9200")
+	assert.NotContains(t, files["config.yaml"], "secret")
+	assert.Contains(t, files["logs.ndjson"], "recent message")
+	assert.Contains(t, files["goroutines.txt"], "goroutine")
+	assert.Contains(t, files, "build_info.txt")
+}
@@ -0,0 +1,298 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LimitsConfig limits the load clients can put on the API.
+type LimitsConfig struct {
+	// MaxInFlight is the maximum number of requests handled concurrently.
+	// Further requests are rejected with 503. Unlimited if 0.
+	MaxInFlight int `config:"max_in_flight"`
+
+	// RateLimit limits the rate of requests of every client to all routes.
+	RateLimit RateLimitConfig `config:"rate_limit"`
+
+	// Routes limits the rate of requests of every client to specific routes,
+	// in addition to RateLimit.
+	Routes []RouteRateLimitConfig `config:"routes"`
+}
+
+// RateLimitConfig configures a token bucket rate limit. Requests exceeding
+// the limit are rejected with 429.
+type RateLimitConfig struct {
+	// Rate is the number of requests per second allowed. Disabled if 0.
+	Rate float64 `config:"rate"`
+
+	// Burst is the number of requests allowed at once. Defaults to the rate,
+	// but at least 1.
+	Burst int `config:"burst"`
+}
+
+// RouteRateLimitConfig configures the rate limit of a route. Path matches
+// the request path exactly, or all paths below it if it ends with `/`. The
+// longest matching path applies.
+type RouteRateLimitConfig struct {
+	Path            string `config:"path"`
+	RateLimitConfig `config:",inline"`
+}
+
+// Validate checks the limits are not negative.
+func (c *LimitsConfig) Validate() error {
+	if c.MaxInFlight < 0 {
+		return errors.New("max_in_flight must not be negative")
+	}
+	if err := c.RateLimit.Validate(); err != nil {
+		return fmt.Errorf("invalid rate_limit: %w", err)
+	}
+	for _, route := range c.Routes {
+		if route.Path == "" {
+			return errors.New("route rate limits require a path")
+		}
+		if err := route.RateLimitConfig.Validate(); err != nil {
+			return fmt.Errorf("invalid rate limit for %v: %w", route.Path, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the rate and burst are not negative.
+func (c *RateLimitConfig) Validate() error {
+	if c.Rate < 0 || math.IsNaN(c.Rate) || math.IsInf(c.Rate, 0) {
+		return errors.New("rate must be a positive number")
+	}
+	if c.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
+}
+
+func (c *RateLimitConfig) enabled() bool {
+	return c.Rate > 0
+}
+
+func (c *RateLimitConfig) burst() float64 {
+	if c.Burst > 0 {
+		return float64(c.Burst)
+	}
+	return math.Max(1, c.Rate)
+}
+
+func (c *LimitsConfig) enabled() bool {
+	if c.MaxInFlight > 0 || c.RateLimit.enabled() {
+		return true
+	}
+	for _, route := range c.Routes {
+		if route.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// maxClients is the number of clients tracked by a rate limiter before the
+// least recently seen clients are evicted.
+const maxClients = 1024
+
+type limiter struct {
+	inFlight chan struct{}
+	global   *rateLimiter
+	routes   map[string]*rateLimiter
+}
+
+// newLimiter returns nil if no limits are configured.
+func newLimiter(cfg LimitsConfig) (*limiter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if !cfg.enabled() {
+		return nil, nil
+	}
+
+	l := &limiter{routes: map[string]*rateLimiter{}}
+	if cfg.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	if cfg.RateLimit.enabled() {
+		l.global = newRateLimiter(cfg.RateLimit)
+	}
+	for _, route := range cfg.Routes {
+		if route.enabled() {
+			l.routes[route.Path] = newRateLimiter(route.RateLimitConfig)
+		}
+	}
+	return l, nil
+}
+
+func (l *limiter) wrap(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var limiters []*rateLimiter
+		if l.global != nil {
+			limiters = append(limiters, l.global)
+		}
+		if route := l.route(r.URL.Path); route != nil {
+			limiters = append(limiters, route)
+		}
+		if len(limiters) > 0 && !allow(w, clientKey(r), limiters...) {
+			return
+		}
+
+		if l.inFlight != nil {
+			select {
+			case l.inFlight <- struct{}{}:
+				defer func() { <-l.inFlight }()
+			default:
+				http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func allow(w http.ResponseWriter, client string, limiters ...*rateLimiter) bool {
+	wait := reserve(client, limiters...)
+	if wait == 0 {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	return false
+}
+
+// route returns the rate limiter of the longest path matching.
+func (l *limiter) route(path string) *rateLimiter {
+	var match string
+	var rl *rateLimiter
+	for p, r := range l.routes {
+		if len(p) <= len(match) {
+			continue
+		}
+		if p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			match, rl = p, r
+		}
+	}
+	return rl
+}
+
+// clientKey identifies the client by its IP address. Clients connected via
+// unix sockets or named pipes share a single key.
+func clientKey(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// rateLimiter keeps a token bucket per client.
+type rateLimiter struct {
+	rate, burst float64
+	now         func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// lru orders the buckets from the most to the least recently used.
+	lru *list.List
+}
+
+type bucket struct {
+	client string
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		rate:    cfg.Rate,
+		burst:   cfg.burst(),
+		now:     time.Now,
+		buckets: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// reserve takes a token from the bucket of the client. If no token is
+// available, the time until the next token becomes available is returned.
+func (rl *rateLimiter) reserve(client string) time.Duration {
+	return reserve(client, rl)
+}
+
+// reserve takes a token from the bucket of the client in every rate limiter,
+// only if all of them have a token available. Otherwise the time until a token
+// becomes available in all of them is returned and no token is taken.
+func reserve(client string, limiters ...*rateLimiter) time.Duration {
+	buckets := make([]*bucket, len(limiters))
+	var wait time.Duration
+	for i, rl := range limiters {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+
+		buckets[i] = rl.bucket(client)
+		wait = max(wait, rl.wait(buckets[i]))
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return 0
+}
+
+// bucket returns the bucket of the client refilled up to now, evicting the
+// least recently used bucket if too many clients are tracked. The caller must
+// hold the lock.
+func (rl *rateLimiter) bucket(client string) *bucket {
+	now := rl.now()
+	if e, ok := rl.buckets[client]; ok {
+		rl.lru.MoveToFront(e)
+		b := e.Value.(*bucket) //nolint:errcheck // only buckets are stored
+		b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.rate)
+		b.last = now
+		return b
+	}
+
+	if rl.lru.Len() >= maxClients {
+		oldest := rl.lru.Back()
+		rl.lru.Remove(oldest)
+		delete(rl.buckets, oldest.Value.(*bucket).client) //nolint:errcheck // only buckets are stored
+	}
+	b := &bucket{client: client, tokens: rl.burst, last: now}
+	rl.buckets[client] = rl.lru.PushFront(b)
+	return b
+}
+
+// wait returns the time until a token is available in the bucket.
+func (rl *rateLimiter) wait(b *bucket) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+}
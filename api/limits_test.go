@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(RateLimitConfig{Rate: 2, Burst: 3})
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+
+	for range 3 {
+		assert.Zero(t, rl.reserve("a"))
+	}
+	assert.Equal(t, 500*time.Millisecond, rl.reserve("a"))
+
+	// other clients have their own bucket
+	assert.Zero(t, rl.reserve("b"))
+
+	now = now.Add(250 * time.Millisecond)
+	assert.Equal(t, 250*time.Millisecond, rl.reserve("a"))
+	now = now.Add(250 * time.Millisecond)
+	assert.Zero(t, rl.reserve("a"))
+
+	// the least recently used buckets are evicted
+	for i := range maxClients - 2 {
+		rl.reserve(fmt.Sprint(i))
+	}
+	assert.Len(t, rl.buckets, maxClients)
+	rl.reserve("a")
+	rl.reserve("c")
+	assert.Len(t, rl.buckets, maxClients)
+	assert.NotContains(t, rl.buckets, "b")
+	assert.Contains(t, rl.buckets, "a")
+}
+
+func TestReserveRejectedDoesNotTakeTokens(t *testing.T) {
+	global := newRateLimiter(RateLimitConfig{Rate: 1, Burst: 2})
+	route := newRateLimiter(RateLimitConfig{Rate: 1, Burst: 1})
+	now := time.Now()
+	global.now = func() time.Time { return now }
+	route.now = func() time.Time { return now }
+
+	assert.Zero(t, reserve("a", global, route))
+	// the route rejects the request, the global bucket keeps its token
+	assert.Equal(t, time.Second, reserve("a", global, route))
+	assert.Zero(t, global.reserve("a"))
+	assert.Equal(t, time.Second, global.reserve("a"))
+}
+
+func TestLimiterRoutes(t *testing.T) {
+	l, err := newLimiter(LimitsConfig{Routes: []RouteRateLimitConfig{
+		{Path: "/stats", RateLimitConfig: RateLimitConfig{Rate: 1}},
+		{Path: "/debug/", RateLimitConfig: RateLimitConfig{Rate: 2}},
+		{Path: "/debug/pprof/", RateLimitConfig: RateLimitConfig{Rate: 3}},
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, l.routes["/stats"], l.route("/stats"))
+	assert.Nil(t, l.route("/stats/more"))
+	assert.Equal(t, l.routes["/debug/"], l.route("/debug/vars"))
+	assert.Equal(t, l.routes["/debug/pprof/"], l.route("/debug/pprof/heap"))
+	assert.Nil(t, l.route("/"))
+
+	l, err = newLimiter(LimitsConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, l)
+
+	for _, cfg := range []LimitsConfig{
+		{MaxInFlight: -1},
+		{RateLimit: RateLimitConfig{Rate: -1}},
+		{RateLimit: RateLimitConfig{Rate: 1, Burst: -1}},
+		{Routes: []RouteRateLimitConfig{{RateLimitConfig: RateLimitConfig{Rate: 1}}}},
+	} {
+		_, err := newLimiter(cfg)
+		assert.Error(t, err, "config: %+v", cfg)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	mux := simpleMux()
+	block := make(chan struct{})
+	started := make(chan struct{})
+	mux.HandleFunc("/block", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-block
+	})
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":                 localhostURL,
+		"limits.max_in_flight": 1,
+		"limits.routes": []map[string]interface{}{
+			{"path": "/echo-hello", "rate": 0.001, "burst": 2},
+		},
+	})
+	s, err := New(nil, mux, cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	get := func(path string) *http.Response {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "http://"+s.Addr().String()+path, nil)
+		require.NoError(t, err)
+		r, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		r.Body.Close()
+		return r
+	}
+
+	assert.Equal(t, http.StatusOK, get("/echo-hello").StatusCode)
+	assert.Equal(t, http.StatusOK, get("/echo-hello").StatusCode)
+	r := get("/echo-hello")
+	assert.Equal(t, http.StatusTooManyRequests, r.StatusCode)
+	assert.Equal(t, "1000", r.Header.Get("Retry-After"))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		get("/block")
+	}()
+	<-started
+	assert.Equal(t, http.StatusServiceUnavailable, get("/block").StatusCode)
+	close(block)
+	wg.Wait()
+}
@@ -24,6 +24,9 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
 
 	"github.com/elastic/elastic-agent-libs/api/npipe"
 )
@@ -46,27 +49,117 @@ func makeListener(cfg Config) (net.Listener, error) {
 		return nil, err
 	}
 
-	if network == unixNetwork {
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("cannot remove existing unix socket file at location %s: %w", path, err)
+	if network != unixNetwork {
+		if cfg.hasSocketOptions() {
+			return nil, errors.New("unix_socket options require the host to be a unix socket")
 		}
+		return net.Listen(network, path)
 	}
 
-	l, err := net.Listen(network, path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot remove existing unix socket file at location %s: %w", path, err)
+	}
+	return listenUnix(path, cfg)
+}
+
+// maxUnixPathLen is the longest unix socket path supported on all platforms.
+// sun_path holds 104 bytes on BSD systems and 108 on Linux, including the
+// terminating NUL.
+const maxUnixPathLen = 103
+
+// listenUnix creates the unix socket in a private temporary directory, sets
+// its mode and ownership and moves it to path, such that the socket is never
+// accessible with other permissions. If the temporary path would exceed the
+// maximum socket path length, the socket is created and configured in place.
+func listenUnix(path string, cfg Config) (net.Listener, error) {
+	uid, gid, err := lookupOwner(cfg.SocketOwner, cfg.SocketGroup)
 	if err != nil {
 		return nil, err
 	}
 
-	// Ensure file mode
-	if network == unixNetwork {
-		if err := os.Chmod(path, socketFileMode); err != nil {
-			return nil, fmt.Errorf("could not set mode %d for unix socket file at location %s: %w",
-				socketFileMode,
-				path,
-				err,
-			)
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".s")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temporary directory for unix socket file at location %s: %w", path, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	tmpPath := filepath.Join(tmpDir, "s")
+	if len(tmpPath) > maxUnixPathLen {
+		tmpPath = path
+	}
+
+	l, err := net.Listen(unixNetwork, tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	ul, _ := l.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+	ln := &unixListener{UnixListener: ul, path: tmpPath}
+
+	mode := cfg.socketMode()
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("could not set mode %d for unix socket file at location %s: %w",
+			mode,
+			path,
+			err,
+		)
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(tmpPath, uid, gid); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("could not set owner of unix socket file at location %s: %w", path, err)
 		}
 	}
+	if tmpPath != path {
+		if err := os.Rename(tmpPath, path); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("could not move unix socket file to location %s: %w", path, err)
+		}
+		ln.path = path
+	}
+
+	return ln, nil
+}
 
-	return l, nil
+// unixListener removes the socket file when closed.
+type unixListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.UnixListener.Close()
+	if rmErr := os.Remove(l.path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// lookupOwner resolves the owner and group names or ids. Unset values are
+// returned as -1.
+func lookupOwner(owner, group string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	if owner != "" {
+		if uid, err = strconv.Atoi(owner); err != nil {
+			u, err := user.Lookup(owner)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown unix socket owner %q: %w", owner, err)
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return -1, -1, fmt.Errorf("unknown unix socket group %q: %w", group, err)
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return -1, -1, err
+			}
+		}
+	}
+	return uid, gid, nil
 }
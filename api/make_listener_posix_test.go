@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !windows
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestSocketPermissions(t *testing.T) {
+	dir := t.TempDir()
+	sockFile := dir + "/test.sock"
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":                    "unix://" + sockFile,
+		"unix_socket.permissions": 0o700,
+		"unix_socket.owner":       strconv.Itoa(os.Getuid()),
+		"unix_socket.group":       strconv.Itoa(os.Getgid()),
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+
+	body := getResponse(t, sockFile, "http://unix/echo-hello")
+	assert.Equal(t, "ehlo!", body)
+
+	fi, err := os.Stat(sockFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+	assert.Equal(t, os.ModeSocket, fi.Mode().Type())
+	stat := fi.Sys().(*syscall.Stat_t)
+	assert.EqualValues(t, os.Getgid(), stat.Gid)
+
+	// the temporary directory the socket was created in is removed
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "test.sock", entries[0].Name())
+
+	require.NoError(t, s.Stop())
+	_, err = os.Stat(sockFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSocketPermissionsLongPath(t *testing.T) {
+	// the socket path fits, the path in the temporary directory does not
+	dir := t.TempDir()
+	if pad := maxUnixPathLen - 4 - len(dir); pad > 0 {
+		dir = filepath.Join(dir, strings.Repeat("d", pad))
+		require.NoError(t, os.Mkdir(dir, 0o700))
+	}
+	sockFile := dir + "/s"
+	if len(sockFile) > maxUnixPathLen {
+		t.Skipf("temporary directory %s is too long", t.TempDir())
+	}
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":                    "unix://" + sockFile,
+		"unix_socket.permissions": 0o700,
+	})
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+
+	body := getResponse(t, sockFile, "http://unix/echo-hello")
+	assert.Equal(t, "ehlo!", body)
+
+	fi, err := os.Stat(sockFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	require.NoError(t, s.Stop())
+	_, err = os.Stat(sockFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSocketOptionsInvalid(t *testing.T) {
+	_, err := New(nil, simpleMux(), config.MustNewConfigFrom(map[string]interface{}{
+		"host":                    localhostURL,
+		"unix_socket.permissions": 0o700,
+	}))
+	assert.ErrorContains(t, err, "require the host to be a unix socket")
+
+	_, err = New(nil, simpleMux(), config.MustNewConfigFrom(map[string]interface{}{
+		"host":              "unix://" + t.TempDir() + "/test.sock",
+		"unix_socket.group": "no-such-group-exists",
+	}))
+	assert.ErrorContains(t, err, "unknown unix socket group")
+}
@@ -32,6 +32,10 @@ func makeListener(cfg Config) (net.Listener, error) {
 		return nil, errors.New("user and security_descriptor are mutually exclusive, define only one of them")
 	}
 
+	if cfg.hasSocketOptions() {
+		return nil, errors.New("unix_socket options are not supported on Windows, use named_pipe.security_descriptor instead")
+	}
+
 	if npipe.IsNPipe(cfg.Host) {
 		pipe := npipe.TransformString(cfg.Host)
 		var sd string
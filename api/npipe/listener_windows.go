@@ -23,7 +23,6 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"strings"
 	"syscall"
 
 	"github.com/Microsoft/go-winio"
@@ -46,17 +45,6 @@ func NewListener(name, sd string) (net.Listener, error) {
 	return l, nil
 }
 
-// TransformString takes an input type name defined as a URI like
-// `npipe:///hello` and transforms it into // `\\.\pipe\hello`
-func TransformString(name string) string {
-	if strings.HasPrefix(name, "npipe:///") {
-		path := strings.TrimPrefix(name, "npipe:///")
-		return `\\.\pipe\` + path
-	}
-
-	return name
-}
-
 // DialContext create a Dial to be use with an http.Client to connect to a pipe.
 func DialContext(npipe string) func(context.Context, string, string) (net.Conn, error) {
 	return func(ctx context.Context, _, _ string) (net.Conn, error) {
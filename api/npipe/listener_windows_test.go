@@ -21,13 +21,12 @@ package npipe
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-
-	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
 )
 
 func TestHTTPOverNamedPipe(t *testing.T) {
@@ -57,23 +56,9 @@ func TestHTTPOverNamedPipe(t *testing.T) {
 	//nolint:noctx // for testing purposes
 	r, err := c.Get("http://npipe/echo-hello")
 	require.NoError(t, err)
-	body, err := httpcommon.ReadAll(r)
+	body, err := io.ReadAll(r.Body)
 	require.NoError(t, err)
 	defer r.Body.Close()
 
 	assert.Equal(t, "ehlo!", string(body))
 }
-
-func TestTransformString(t *testing.T) {
-	t.Run("with npipe:// scheme", func(t *testing.T) {
-		assert.Equal(t, `\\.\pipe\hello`, TransformString("npipe:///hello"))
-	})
-
-	t.Run("with windows pipe syntax", func(t *testing.T) {
-		assert.Equal(t, `\\.\pipe\hello`, TransformString(`\\.\pipe\hello`))
-	})
-
-	t.Run("everything else", func(t *testing.T) {
-		assert.Equal(t, "hello", TransformString("hello"))
-	})
-}
@@ -33,3 +33,21 @@ func TestIsNPipe(t *testing.T) {
 		assert.False(t, IsNPipe("unix:///tmp/ok.sock"))
 	})
 }
+
+func TestTransformString(t *testing.T) {
+	t.Run("with npipe:// scheme", func(t *testing.T) {
+		assert.Equal(t, `\\.\pipe\hello`, TransformString("npipe:///hello"))
+	})
+
+	t.Run("with npipe:// scheme and pipe path", func(t *testing.T) {
+		assert.Equal(t, `\\.\pipe\hello`, TransformString("npipe:////./pipe/hello"))
+	})
+
+	t.Run("with windows pipe syntax", func(t *testing.T) {
+		assert.Equal(t, `\\.\pipe\hello`, TransformString(`\\.\pipe\hello`))
+	})
+
+	t.Run("everything else", func(t *testing.T) {
+		assert.Equal(t, "hello", TransformString("hello"))
+	})
+}
@@ -0,0 +1,72 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !windows
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// privilegedPeerUser is the uid of root.
+const privilegedPeerUser = "0"
+
+func currentPeerUser() (string, error) {
+	return strconv.Itoa(os.Getuid()), nil
+}
+
+// resolvePeerUser returns the uid of the given user name or uid.
+func resolvePeerUser(name string) (string, error) {
+	if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return name, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// peerUser returns the uid of the process connected via the unix socket.
+func peerUser(conn net.Conn) (string, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return "", fmt.Errorf("peer credentials are not available for %T connections", conn)
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return "", err
+	}
+
+	var uid uint32
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		uid, credErr = peerUID(int(fd))
+	})
+	if err != nil {
+		return "", err
+	}
+	if credErr != nil {
+		return "", credErr
+	}
+	return strconv.FormatUint(uint64(uid), 10), nil
+}
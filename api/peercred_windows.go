@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build windows
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// privilegedPeerUser is the SID of NT AUTHORITY\SYSTEM.
+const privilegedPeerUser = "S-1-5-18"
+
+func currentPeerUser() (string, error) {
+	u, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	return u.User.Sid.String(), nil
+}
+
+// resolvePeerUser returns the SID of the given account name or SID.
+func resolvePeerUser(name string) (string, error) {
+	if strings.HasPrefix(name, "S-") {
+		sid, err := windows.StringToSid(name)
+		if err != nil {
+			return "", err
+		}
+		return sid.String(), nil
+	}
+	sid, _, _, err := windows.LookupSID("", name)
+	if err != nil {
+		return "", err
+	}
+	return sid.String(), nil
+}
+
+// peerUser returns the SID of the user running the process connected via the
+// named pipe.
+func peerUser(conn net.Conn) (string, error) {
+	pipe, ok := conn.(interface{ Fd() uintptr })
+	if !ok {
+		return "", fmt.Errorf("peer credentials are not available for %T connections", conn)
+	}
+
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(windows.Handle(pipe.Fd()), &pid); err != nil {
+		return "", fmt.Errorf("failed to get the client process id: %w", err)
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("failed to open client process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(process) //nolint:errcheck // nothing to do on failure
+
+	var token windows.Token
+	if err := windows.OpenProcessToken(process, windows.TOKEN_QUERY, &token); err != nil {
+		return "", fmt.Errorf("failed to open the token of client process %d: %w", pid, err)
+	}
+	defer token.Close()
+
+	u, err := token.GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	return u.User.Sid.String(), nil
+}
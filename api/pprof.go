@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"slices"
+	"strings"
+)
+
+// PprofConfig configures the pprof and expvar routes of the API.
+type PprofConfig struct {
+	// Enabled mounts the pprof handlers under /debug/pprof/ and the expvar
+	// handler under /debug/vars.
+	Enabled bool `config:"enabled"`
+
+	// Profiles restricts the profiles available, e.g. `heap` or `profile`
+	// for CPU profiles. All profiles are available if empty.
+	Profiles []string `config:"profiles"`
+}
+
+// pprofProfiles are the profiles served by pprof, including the special
+// handlers not backed by a runtime/pprof profile.
+var pprofProfiles = []string{
+	"allocs", "block", "cmdline", "goroutine", "heap", "mutex",
+	"profile", "symbol", "threadcreate", "trace",
+}
+
+// Validate checks that only known profiles are allowed.
+func (c *PprofConfig) Validate() error {
+	for _, p := range c.Profiles {
+		if !slices.Contains(pprofProfiles, p) {
+			return fmt.Errorf("unknown pprof profile %q, must be one of %v", p, strings.Join(pprofProfiles, ", "))
+		}
+	}
+	return nil
+}
+
+// pprofHandler serves the allowed profiles under /debug/pprof/.
+func pprofHandler(profiles []string) http.Handler {
+	if len(profiles) == 0 {
+		profiles = pprofProfiles
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+		if name == "" {
+			pprof.Index(w, r)
+			return
+		}
+		if !slices.Contains(profiles, name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch name {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			pprof.Handler(name).ServeHTTP(w, r)
+		}
+	})
+}
+
+// attachPprof mounts the pprof and expvar routes as configured.
+func (s *Server) attachPprof(cfg PprofConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if len(cfg.Profiles) == 0 {
+		s.log.Info("Attaching pprof endpoints")
+	} else {
+		s.log.Infof("Attaching pprof endpoints, allowed profiles: %v", cfg.Profiles)
+	}
+	if err := s.AttachHandler("/debug/pprof/", pprofHandler(cfg.Profiles)); err != nil {
+		return err
+	}
+	return s.AttachHandler("/debug/vars", expvar.Handler())
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestPprof(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":           localhostURL,
+		"pprof.enabled":  true,
+		"pprof.profiles": []string{"heap", "cmdline"},
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	get := func(path string) int {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "http://"+s.Addr().String()+path, nil)
+		require.NoError(t, err)
+		r, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		r.Body.Close()
+		return r.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/"))
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/heap"))
+	assert.Equal(t, http.StatusOK, get("/debug/pprof/cmdline"))
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/goroutine"))
+	assert.Equal(t, http.StatusNotFound, get("/debug/pprof/profile"))
+	assert.Equal(t, http.StatusOK, get("/debug/vars"))
+	assert.Equal(t, http.StatusOK, get("/echo-hello"))
+}
+
+func TestPprofDisabled(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	defer s.Stop()
+
+	// the pprof routes can still be attached, pprof is not mounted yet
+	require.NoError(t, s.AttachHandler("/debug/pprof/", http.NotFoundHandler()))
+}
+
+func TestPprofInvalidProfile(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host":           localhostURL,
+		"pprof.enabled":  true,
+		"pprof.profiles": []string{"heap", "cpu"},
+	})
+
+	_, err := New(nil, simpleMux(), cfg)
+	assert.ErrorContains(t, err, `unknown pprof profile "cpu"`)
+}
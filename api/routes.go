@@ -70,9 +70,24 @@ func MakeRootAPIHandler(handler HandlerFunc) HandlerFunc {
 	}
 }
 
-// MakeAPIHandler creates an API handler for the given namespace
+// MakeAPIHandler creates an API handler for the given namespace. The response
+// schema can be selected by the client, see SchemaV1 and SchemaV2.
 func MakeAPIHandler(ns *monitoring.Namespace) HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// the schema can be selected via the Accept header, caches must
+		// not serve the response of one schema for the other
+		w.Header().Add("Vary", "Accept")
+
+		schema, err := requestedSchema(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if schema == SchemaV2 {
+			writeV2(w, r, ns.GetRegistry())
+			return
+		}
+
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 		data := monitoring.CollectStructSnapshot(
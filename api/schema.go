@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Schema versions of the responses of the API handlers created by
+// MakeAPIHandler. The version is selected by the `schema` query parameter,
+// e.g. `/stats?schema=v2`, or by requesting the media type of the version
+// via the Accept header. Version 1 is used if no version is requested.
+//
+// Changes to a version must be backwards compatible. Incompatible changes
+// require a new version.
+const (
+	// SchemaV1 is the nested JSON object of the registry, as returned by
+	// monitoring.CollectStructSnapshot. Its structure follows the layout
+	// of the registries.
+	SchemaV1 = "v1"
+
+	// SchemaV2 is a flat list of metrics, see SchemaV2Response.
+	SchemaV2 = "v2"
+)
+
+// SchemaV2MediaType is the media type of SchemaV2 responses.
+const SchemaV2MediaType = "application/vnd.elastic.monitoring.v2+json"
+
+// SchemaV2Response is the response of SchemaV2:
+//
+//	{
+//	  "schema": "v2",
+//	  "metrics": [
+//	    {"name": "output.events.acked", "value": 42, "type": "counter", "unit": "1", "description": "..."}
+//	  ]
+//	}
+//
+// Metrics are sorted by name. Names are the full path of the variable in
+// the registry joined by `.`. The value is a JSON number, boolean, string or
+// array of strings. Float values that are not finite, like NaN, are reported
+// as null. Type, unit and description are only present if the variable has
+// been registered with metadata, see monitoring.Metadata.
+type SchemaV2Response struct {
+	Schema  string     `json:"schema"`
+	Metrics []MetricV2 `json:"metrics"`
+}
+
+// MetricV2 is a single metric of a SchemaV2Response.
+type MetricV2 struct {
+	Name        string      `json:"name"`
+	Value       interface{} `json:"value"`
+	Type        string      `json:"type,omitempty"`
+	Unit        string      `json:"unit,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// requestedSchema returns the schema version requested.
+func requestedSchema(r *http.Request) (string, error) {
+	if schema := r.URL.Query().Get("schema"); schema != "" {
+		switch schema {
+		case SchemaV1, SchemaV2:
+			return schema, nil
+		default:
+			return "", fmt.Errorf("unsupported schema %q", schema)
+		}
+	}
+
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), SchemaV2MediaType) {
+				return SchemaV2, nil
+			}
+		}
+	}
+	return SchemaV1, nil
+}
+
+// collectV2 collects the metrics of the registry as SchemaV2Response.
+func collectV2(reg *monitoring.Registry) SchemaV2Response {
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	metadata := monitoring.CollectMetadata(reg)
+
+	metrics := make([]MetricV2, 0,
+		len(snapshot.Bools)+len(snapshot.Ints)+len(snapshot.Floats)+len(snapshot.Strings)+len(snapshot.StringSlices))
+	add := func(name string, value interface{}) {
+		m := MetricV2{Name: name, Value: value}
+		if meta, ok := metadata[name]; ok {
+			m.Type = meta.Type.String()
+			m.Unit = meta.Unit
+			m.Description = meta.Description
+		}
+		metrics = append(metrics, m)
+	}
+	for name, v := range snapshot.Bools {
+		add(name, v)
+	}
+	for name, v := range snapshot.Ints {
+		add(name, v)
+	}
+	for name, v := range snapshot.Floats {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			add(name, nil)
+			continue
+		}
+		add(name, v)
+	}
+	for name, v := range snapshot.Strings {
+		add(name, v)
+	}
+	for name, v := range snapshot.StringSlices {
+		add(name, v)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+
+	return SchemaV2Response{Schema: SchemaV2, Metrics: metrics}
+}
+
+func writeV2(w http.ResponseWriter, r *http.Request, reg *monitoring.Registry) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if _, ok := r.URL.Query()["pretty"]; ok {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(collectV2(reg)); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode metrics: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", SchemaV2MediaType+"; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the response schemas")
+
+func schemaTestNamespace() *monitoring.Namespace {
+	reg := monitoring.NewRegistry()
+	monitoring.NewInt(reg, "output.events.acked",
+		monitoring.Description("Number of events acknowledged by the output."),
+		monitoring.Unit("1"),
+		monitoring.Type(monitoring.TypeCounter),
+	).Set(42)
+	monitoring.NewFloat(reg, "system.load.1").Set(0.5)
+	monitoring.NewBool(reg, "output.healthy").Set(true)
+	monitoring.NewString(reg, "beat.name").Set("test")
+
+	ns := monitoring.NewNamespaces().Get("stats")
+	ns.SetRegistry(reg)
+	return ns
+}
+
+func serveSchema(t *testing.T, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	MakeAPIHandler(schemaTestNamespace())(w, req)
+	return w
+}
+
+// TestSchemaGolden guards the structure of the response schemas. If this
+// test fails, the change is incompatible with existing consumers and needs
+// a new schema version. Run with -update to update the golden files after
+// adding fields compatibly.
+func TestSchemaGolden(t *testing.T) {
+	for _, schema := range []string{SchemaV1, SchemaV2} {
+		t.Run(schema, func(t *testing.T) {
+			w := serveSchema(t, "/stats?pretty&schema="+schema, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			golden := filepath.Join("testdata", "schema_"+schema+".json")
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(golden, w.Body.Bytes(), 0o644))
+			}
+			expected, err := os.ReadFile(golden)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), w.Body.String())
+		})
+	}
+}
+
+func TestSchemaNegotiation(t *testing.T) {
+	w := serveSchema(t, "/stats", nil)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var v1 map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v1))
+	assert.Contains(t, v1, "output")
+
+	w = serveSchema(t, "/stats", http.Header{"Accept": {"application/json;q=0.5, " + SchemaV2MediaType + ";q=0.9"}})
+	assert.Equal(t, SchemaV2MediaType+"; charset=utf-8", w.Header().Get("Content-Type"))
+	var v2 SchemaV2Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v2))
+	assert.Equal(t, SchemaV2, v2.Schema)
+	assert.Len(t, v2.Metrics, 4)
+
+	// the query parameter takes precedence
+	w = serveSchema(t, "/stats?schema=v1", http.Header{"Accept": {SchemaV2MediaType}})
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	w = serveSchema(t, "/stats?schema=v3", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the response depends on the Accept header
+	for _, schema := range []string{SchemaV1, SchemaV2} {
+		w = serveSchema(t, "/stats?schema="+schema, nil)
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	}
+}
+
+func TestSchemaV2NonFiniteFloats(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.NewFloat(reg, "nan").Set(math.NaN())
+	monitoring.NewFloat(reg, "inf").Set(math.Inf(1))
+	monitoring.NewFloat(reg, "value").Set(1.5)
+	ns := monitoring.NewNamespaces().Get("stats")
+	ns.SetRegistry(reg)
+
+	w := httptest.NewRecorder()
+	MakeAPIHandler(ns)(w, httptest.NewRequest(http.MethodGet, "/stats?schema=v2", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var v2 SchemaV2Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v2))
+	assert.Equal(t, []MetricV2{
+		{Name: "inf", Value: nil},
+		{Name: "nan", Value: nil},
+		{Name: "value", Value: 1.5},
+	}, v2.Metrics)
+}
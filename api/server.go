@@ -19,15 +19,18 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
 )
 
 const (
@@ -43,6 +46,20 @@ type Server struct {
 	srv    *http.Server
 	l      net.Listener
 	config Config
+	auth   *authenticator
+	limit  *limiter
+	access *accessLogger
+
+	// attached holds the handlers attached via AttachHandler. Routes stay
+	// registered in mux after being detached, as http.ServeMux does not
+	// support removing routes, and respond with 404 until attached again.
+	attachedMu sync.RWMutex
+	attached   map[string]http.Handler
+
+	ready   chan struct{}
+	done    chan struct{}
+	err     error
+	onError func(error)
 }
 
 // New creates a new API Server.
@@ -71,8 +88,58 @@ func new(log *logp.Logger, mux *http.ServeMux, cfg Config) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	log = log.Named("api")
+
+	auth, err := newAuthenticator(log, cfg.Auth, l.Addr().Network())
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	if auth != nil {
+		srv.ConnContext = auth.connContext
+	}
+
+	limit, err := newLimiter(cfg.Limits)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	access, err := newAccessLogger(log, cfg.AccessLog)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	if cfg.TLS.IsEnabled() {
+		tlsConfig, err := loadTLSConfig(log, cfg.TLS)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
 
-	return &Server{mux: mux, srv: srv, l: l, config: cfg, log: log.Named("api")}, nil
+	s := &Server{
+		mux:      mux,
+		srv:      srv,
+		l:        l,
+		config:   cfg,
+		log:      log,
+		auth:     auth,
+		limit:    limit,
+		access:   access,
+		attached: map[string]http.Handler{},
+		ready:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if cfg.Pprof.Enabled {
+		if err := s.attachPprof(cfg.Pprof); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 // AddRoute adds a route to the server mux
@@ -82,15 +149,106 @@ func (s *Server) AddRoute(path string, handler HandlerFunc) {
 
 // Start starts the HTTP server and accepting new connection.
 func (s *Server) Start() {
+	s.StartContext(context.Background())
+}
+
+// StartContext starts the HTTP server in the background. Once ctx is
+// cancelled, the server is shut down gracefully, waiting up to
+// Config.ShutdownTimeout for active requests to finish. Use Ready to wait
+// for the server to accept connections and Done to wait for the server to
+// stop. StartContext must only be called once.
+func (s *Server) StartContext(ctx context.Context) {
 	s.log.Info("Starting stats endpoint")
+	s.srv.Handler = s.handler()
+
 	go func(l net.Listener) {
+		defer close(s.done)
+
 		s.log.Infof("Metrics endpoint listening on: %s (configured: %s)", l.Addr().String(), s.config.Host)
-		s.srv.Handler = s.mux
+		drained := make(chan struct{})
+		stop := context.AfterFunc(ctx, func() {
+			defer close(drained)
+			s.drain()
+		})
+
+		close(s.ready)
 		err := s.srv.Serve(l)
+		// Serve returns as soon as the shutdown started, wait for the
+		// active requests to finish.
+		if !stop() {
+			<-drained
+		}
 		s.log.Infof("Stats endpoint (%s) finished: %v", l.Addr().String(), err)
+
+		// Serve returns these errors after Shutdown or Stop.
+		if errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed) {
+			return
+		}
+		s.err = err
+		if s.onError != nil {
+			s.onError(err)
+		}
 	}(s.l)
 }
 
+// drain shuts the server down gracefully, closing all connections once the
+// shutdown timeout passed.
+func (s *Server) drain() {
+	ctx := context.Background()
+	if timeout := s.config.ShutdownTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.log.Warnf("Stats endpoint did not shut down gracefully: %v", err)
+		s.srv.Close()
+	}
+}
+
+// OnError sets a callback called with the error if serving fails, e.g. due
+// to the listener failing. It is not called if the server is stopped. Must
+// be set before starting the server.
+func (s *Server) OnError(f func(error)) {
+	s.onError = f
+}
+
+// Ready returns a channel closed once the server accepts connections.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done returns a channel closed once the server stopped serving.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that made the server stop serving, nil if the server
+// has been stopped or is still running. Only valid after Done is closed.
+func (s *Server) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// handler returns the mux wrapped by the configured middlewares.
+func (s *Server) handler() http.Handler {
+	var h http.Handler = s.mux
+	if s.auth != nil {
+		h = s.auth.wrap(h)
+	}
+	if s.limit != nil {
+		h = s.limit.wrap(h)
+	}
+	if s.access != nil {
+		h = s.access.wrap(h)
+	}
+	return h
+}
+
 // Stop stops the API server and free any resource associated with the process like unix sockets.
 func (s *Server) Stop() error {
 	return s.l.Close()
@@ -108,7 +266,59 @@ func (s *Server) Addr() net.Addr {
 }
 
 // AttachHandler will attach a handler at the specified route and return an error instead of panicing.
+// Handlers can be attached and detached at any time, including after the server has been started.
 func (s *Server) AttachHandler(route string, h http.Handler) (err error) {
+	s.attachedMu.Lock()
+	defer s.attachedMu.Unlock()
+
+	registered, found := s.attached[route]
+	if found && registered != nil {
+		return fmt.Errorf("a handler is already attached to %q", route)
+	}
+
+	s.log.Infof("Attempting to attach %q to server.", route)
+	if !found {
+		if err := s.handle(route, s.attachedHandler(route)); err != nil {
+			return err
+		}
+	}
+	s.attached[route] = h
+	return nil
+}
+
+// DetachHandler removes the handler attached at the specified route via
+// AttachHandler. Requests to the route are answered with 404 afterwards.
+func (s *Server) DetachHandler(route string) error {
+	s.attachedMu.Lock()
+	defer s.attachedMu.Unlock()
+
+	if s.attached[route] == nil {
+		return fmt.Errorf("no handler attached to %q", route)
+	}
+	s.log.Infof("Detaching %q from server.", route)
+	s.attached[route] = nil
+	return nil
+}
+
+// attachedHandler dispatches requests to the handler currently attached at
+// route.
+func (s *Server) attachedHandler(route string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.attachedMu.RLock()
+		h := s.attached[route]
+		s.attachedMu.RUnlock()
+
+		if h == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handle registers the handler in the mux, returning an error instead of
+// panicking if the route is invalid or conflicts with an existing route.
+func (s *Server) handle(route string, h http.Handler) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			switch r := r.(type) {
@@ -121,11 +331,21 @@ func (s *Server) AttachHandler(route string, h http.Handler) (err error) {
 			}
 		}
 	}()
-	s.log.Infof("Attempting to attach %q to server.", route)
 	s.mux.Handle(route, h)
 	return // returning from recover
 }
 
+func loadTLSConfig(log *logp.Logger, cfg *tlscommon.ServerConfig) (*tls.Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	tlsConfig, err := tlscommon.LoadTLSServerConfig(cfg, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS configuration: %w", err)
+	}
+	return tlsConfig.BuildServerConfig(""), nil
+}
+
 func parse(host string, port int) (string, string, error) {
 	url, err := url.Parse(host)
 	if err != nil {
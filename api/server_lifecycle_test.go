@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestStartContextGracefulShutdown(t *testing.T) {
+	mux := simpleMux()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	s, err := New(nil, mux, config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.StartContext(ctx)
+	<-s.Ready()
+	assert.NoError(t, s.Err())
+
+	status := make(chan int, 1)
+	go func() {
+		r, err := http.Get("http://" + s.Addr().String() + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		r.Body.Close()
+		status <- r.StatusCode
+	}()
+	<-started
+
+	cancel()
+	select {
+	case <-s.Done():
+		t.Fatal("server stopped before the active request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the listener is closed while draining
+	_, err = net.Dial("tcp", s.Addr().String())
+	assert.Error(t, err)
+
+	close(release)
+	assert.Equal(t, http.StatusAccepted, <-status)
+	<-s.Done()
+	assert.NoError(t, s.Err())
+}
+
+func TestStartContextShutdownTimeout(t *testing.T) {
+	mux := simpleMux()
+	started := make(chan struct{})
+	mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	s, err := New(nil, mux, config.MustNewConfigFrom(map[string]interface{}{
+		"host":             localhostURL,
+		"shutdown_timeout": "50ms",
+	}))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.StartContext(ctx)
+	go func() {
+		r, err := http.Get("http://" + s.Addr().String() + "/hang")
+		if err == nil {
+			r.Body.Close()
+		}
+	}()
+	<-started
+
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop after the shutdown timeout")
+	}
+	assert.NoError(t, s.Err())
+}
+
+type failingListener struct {
+	net.Listener
+}
+
+func (failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestStartContextOnError(t *testing.T) {
+	s, err := New(nil, simpleMux(), config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	}))
+	require.NoError(t, err)
+	defer s.Stop()
+	s.l = failingListener{s.l}
+
+	errs := make(chan error, 1)
+	s.OnError(func(err error) { errs <- err })
+	s.StartContext(context.Background())
+
+	assert.ErrorContains(t, <-errs, "accept failed")
+	<-s.Done()
+	assert.ErrorContains(t, s.Err(), "accept failed")
+}
+
+func TestStopIsNotAnError(t *testing.T) {
+	s, err := New(nil, simpleMux(), config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	}))
+	require.NoError(t, err)
+	s.OnError(func(err error) { t.Errorf("unexpected error: %v", err) })
+	s.Start()
+	<-s.Ready()
+
+	require.NoError(t, s.Stop())
+	<-s.Done()
+	assert.NoError(t, s.Err())
+}
@@ -235,3 +235,89 @@ type testHandler struct{}
 func (t *testHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "test!")
 }
+
+func TestDetachHandler(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	get := func() (int, string) {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "http://"+s.l.Addr().String()+"/test", nil)
+		require.NoError(t, err)
+		r, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer r.Body.Close()
+		body, err := httpcommon.ReadAll(r)
+		require.NoError(t, err)
+		return r.StatusCode, string(body)
+	}
+
+	require.NoError(t, s.AttachHandler("/test", &testHandler{}))
+	status, body := get()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "test!", body)
+
+	require.NoError(t, s.DetachHandler("/test"))
+	status, _ = get()
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Error(t, s.DetachHandler("/test"))
+	assert.Error(t, s.DetachHandler("/unknown"))
+
+	// routes can be attached again once detached
+	require.NoError(t, s.AttachHandler("/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "again!")
+	})))
+	status, body = get()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "again!", body)
+
+	// routes registered in the mux directly cannot be attached
+	assert.Error(t, s.AttachHandler("/echo-hello", &testHandler{}))
+}
+
+func TestAttachHandlerConcurrent(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			if err := s.AttachHandler("/test", &testHandler{}); err != nil {
+				t.Errorf("attach failed: %v", err)
+				return
+			}
+			if err := s.DetachHandler("/test"); err != nil {
+				t.Errorf("detach failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	for range 20 {
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "http://"+s.l.Addr().String()+"/test", nil)
+		require.NoError(t, err)
+		r, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		r.Body.Close()
+		assert.Contains(t, []int{http.StatusOK, http.StatusNotFound}, r.StatusCode)
+	}
+	<-done
+}
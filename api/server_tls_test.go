@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommontest"
+)
+
+func certPEM(cert tls.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Leaf.Raw}))
+}
+
+func keyPEM(cert tls.Certificate) string {
+	key := x509.MarshalPKCS1PrivateKey(cert.PrivateKey.(*rsa.PrivateKey))
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: key}))
+}
+
+func TestHTTPS(t *testing.T) {
+	ca, err := tlscommontest.GenCA()
+	require.NoError(t, err)
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	serverCert, err := tlscommontest.GenSignedCert(ca, keyUsage, false, "localhost", []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1)}, false)
+	require.NoError(t, err)
+	clientCert, err := tlscommontest.GenSignedCert(ca, keyUsage, false, "client", nil, nil, false)
+	require.NoError(t, err)
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"host": localhostURL,
+		"ssl": map[string]interface{}{
+			"certificate":             certPEM(serverCert),
+			"key":                     keyPEM(serverCert),
+			"certificate_authorities": []string{certPEM(ca)},
+		},
+	})
+
+	s, err := New(nil, simpleMux(), cfg)
+	require.NoError(t, err)
+	go s.Start()
+	defer func() {
+		err := s.Stop()
+		require.NoError(t, err, "error stopping test server")
+	}()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.Leaf)
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      rootCAs,
+			Certificates: certs,
+		}}}
+		req, err := http.NewRequestWithContext(context.Background(), "GET", "https://"+s.Addr().String()+"/echo-hello", nil)
+		require.NoError(t, err)
+		r, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer r.Body.Close()
+		body, err := httpcommon.ReadAll(r)
+		return string(body), err
+	}
+
+	body, err := get(clientCert)
+	require.NoError(t, err)
+	assert.Equal(t, "ehlo!", body)
+
+	// client certificates are required if certificate authorities are configured
+	_, err = get()
+	assert.Error(t, err)
+}
+
+func TestHTTPSInvalidConfig(t *testing.T) {
+	_, err := NewFromConfig(logptest.NewTestingLogger(t, ""), simpleMux(), Config{
+		Host: localhostURL,
+		TLS:  &tlscommon.ServerConfig{},
+	})
+	assert.ErrorIs(t, err, tlscommon.ErrCertificateUnspecified)
+}
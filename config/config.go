@@ -70,6 +70,14 @@ func getGlobalConfigOpts() []ucfg.Option {
 	return configOpts
 }
 
+// withGlobalConfigOpts returns the global options followed by opts.
+func withGlobalConfigOpts(opts []ucfg.Option) []ucfg.Option {
+	global := getGlobalConfigOpts()
+	o := make([]ucfg.Option, 0, len(global)+len(opts))
+	o = append(o, global...)
+	return append(o, opts...)
+}
+
 func setGlobalConfigOpts(opts []ucfg.Option) {
 	configOptsMu.Lock()
 	defer configOptsMu.Unlock()
@@ -88,11 +96,11 @@ func NewConfig() *C {
 // result.
 func NewConfigFrom(from interface{}) (*C, error) {
 	if str, ok := from.(string); ok {
-		c, err := yaml.NewConfig([]byte(str), getGlobalConfigOpts()...)
+		c, err := yaml.NewConfig([]byte(normalizeSecretRefs(str).(string)), getGlobalConfigOpts()...)
 		return fromConfig(c), err
 	}
 
-	c, err := ucfg.NewFrom(from, getGlobalConfigOpts()...)
+	c, err := ucfg.NewFrom(normalizeSecretRefs(from), getGlobalConfigOpts()...)
 	return fromConfig(c), err
 }
 
@@ -140,14 +148,14 @@ func MergeConfigsWithOptions(cfgs []*C, options ...ucfg.Option) (*C, error) {
 
 // NewConfigWithYAML reads a YAML configuration.
 func NewConfigWithYAML(in []byte, source string) (*C, error) {
-	opts := append(
-		[]ucfg.Option{
-			ucfg.MetaData(ucfg.Meta{Source: source}),
-		},
-		getGlobalConfigOpts()...,
-	)
-	c, err := yaml.NewConfig(in, opts...)
-	return fromConfig(c), err
+	c, err := yaml.NewConfig(normalizeSecretRefs(in).([]byte), sourceConfigOpts(source)...)
+	if err != nil {
+		return fromConfig(c), err
+	}
+	if source != "" {
+		storeOrigins(c, yamlOrigins(in, source))
+	}
+	return fromConfig(c), nil
 }
 
 // OverwriteConfigOpts allow to change the globally set config option
@@ -157,20 +165,51 @@ func OverwriteConfigOpts(options []ucfg.Option) {
 
 // Merge merges the parameter into the C object.
 func (c *C) Merge(from interface{}) error {
-	return c.access().Merge(from, getGlobalConfigOpts()...)
+	if err := c.access().Merge(normalizeSecretRefs(from), getGlobalConfigOpts()...); err != nil {
+		return err
+	}
+	c.mergeOrigins(from)
+	return nil
 }
 
-// Merge merges the parameter into the C object based on the provided options.
+// MergeWithOpts merges the parameter into the C object based on the provided
+// options. Options are applied in order, so options selecting a merge policy
+// for all keys, like ArrayAppend, can be combined with per-key policies:
+//
+//	cfg.MergeWithOpts(overlay, ArrayAppend, MergeReplace.Fields("hosts"))
 func (c *C) MergeWithOpts(from interface{}, opts ...ucfg.Option) error {
-	o := getGlobalConfigOpts()
-	if opts != nil {
-		o = append(o, opts...)
+	if err := c.access().Merge(normalizeSecretRefs(from), withGlobalConfigOpts(opts)...); err != nil {
+		return err
 	}
-	return c.access().Merge(from, o...)
+	c.mergeOrigins(from)
+	return nil
 }
 
+// Unpack unpacks the configuration into the given value. If unpacking fails
+// because of multiple invalid settings, an *UnpackError listing all of them
+// is returned.
 func (c *C) Unpack(to interface{}) error {
-	return c.access().Unpack(to, getGlobalConfigOpts()...)
+	return c.unpack(to, getGlobalConfigOpts())
+}
+
+// UnpackWithOpts unpacks the configuration into the given value using the
+// global options and the provided options.
+func (c *C) UnpackWithOpts(to interface{}, opts ...ucfg.Option) error {
+	return c.unpack(to, withGlobalConfigOpts(opts))
+}
+
+// content unpacks the configuration into a map[string]interface{} or, if the
+// configuration is an array, into a []interface{}.
+func (c *C) content() (interface{}, error) {
+	if c.IsArray() {
+		var arr []interface{}
+		err := c.Unpack(&arr)
+		return arr, err
+	}
+
+	var m map[string]interface{}
+	err := c.Unpack(&m)
+	return m, err
 }
 
 func (c *C) Path() string {
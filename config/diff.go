@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change describes a setting that differs between two configurations.
+// Values of settings that might contain secrets are redacted.
+type Change struct {
+	Path string
+	Old  interface{}
+	New  interface{}
+}
+
+// Changes lists the settings that differ between two configurations, sorted
+// by path. Arrays are compared element by element, so paths of array
+// elements end with the index, e.g. `output.hosts.1`.
+type Changes struct {
+	Added   []Change
+	Removed []Change
+	Changed []Change
+}
+
+// Diff compares two configurations. Nil configurations are treated as empty.
+func Diff(oldCfg, newCfg *C) (*Changes, error) {
+	oldSettings, err := flattenSettings(oldCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read old config: %w", err)
+	}
+	newSettings, err := flattenSettings(newCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read new config: %w", err)
+	}
+
+	changes := &Changes{}
+	for path, ov := range oldSettings {
+		nv, found := newSettings[path]
+		switch {
+		case !found:
+			changes.Removed = append(changes.Removed, Change{Path: path, Old: ov.value()})
+		case !reflect.DeepEqual(ov.v, nv.v):
+			changes.Changed = append(changes.Changed, Change{Path: path, Old: ov.value(), New: nv.value()})
+		}
+	}
+	for path, nv := range newSettings {
+		if _, found := oldSettings[path]; !found {
+			changes.Added = append(changes.Added, Change{Path: path, New: nv.value()})
+		}
+	}
+
+	for _, list := range [][]Change{changes.Added, changes.Removed, changes.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+	return changes, nil
+}
+
+// Empty returns true if the configurations are equal.
+func (c *Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// Paths returns the sorted paths of all added, removed and changed settings.
+func (c *Changes) Paths() []string {
+	paths := make([]string, 0, len(c.Added)+len(c.Removed)+len(c.Changed))
+	for _, list := range [][]Change{c.Added, c.Removed, c.Changed} {
+		for _, change := range list {
+			paths = append(paths, change.Path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Affects returns true if any setting at or below one of the given paths
+// has been added, removed or changed. It can be used to decide whether a
+// component needs to be restarted.
+func (c *Changes) Affects(paths ...string) bool {
+	for _, changed := range c.Paths() {
+		for _, p := range paths {
+			if changed == p || strings.HasPrefix(changed, p+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// String returns a human readable summary of the changes, for logging.
+func (c *Changes) String() string {
+	var parts []string
+	for _, change := range c.Added {
+		parts = append(parts, fmt.Sprintf("+%v: %v", change.Path, change.New))
+	}
+	for _, change := range c.Removed {
+		parts = append(parts, fmt.Sprintf("-%v: %v", change.Path, change.Old))
+	}
+	for _, change := range c.Changed {
+		parts = append(parts, fmt.Sprintf("~%v: %v -> %v", change.Path, change.Old, change.New))
+	}
+	return strings.Join(parts, ", ")
+}
+
+type setting struct {
+	v        interface{}
+	redacted bool
+}
+
+func (s setting) value() interface{} {
+	if s.redacted {
+		return redacted
+	}
+	return s.v
+}
+
+func flattenSettings(c *C) (map[string]setting, error) {
+	settings := map[string]setting{}
+	if c == nil {
+		return settings, nil
+	}
+
+	content, err := c.content()
+	if err != nil {
+		return nil, err
+	}
+
+	flattenInto(settings, "", content, false)
+	return settings, nil
+}
+
+func flattenInto(to map[string]setting, prefix string, v interface{}, redact bool) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			to[prefix] = setting{v: v, redacted: redact}
+		}
+		for k, elem := range v {
+			fullName := join(k)
+			flattenInto(to, fullName, elem, redact || redactKey(k, fullName, nil))
+		}
+	case []interface{}:
+		if len(v) == 0 && prefix != "" {
+			to[prefix] = setting{v: v, redacted: redact}
+		}
+		for i, elem := range v {
+			flattenInto(to, join(strconv.Itoa(i)), elem, redact)
+		}
+	default:
+		to[prefix] = setting{v: v, redacted: redact}
+	}
+}
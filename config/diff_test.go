@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	oldCfg := MustNewConfigFrom(`
+output.elasticsearch:
+  hosts: [a, b]
+  password: old
+  worker: 1
+inputs:
+  - type: filestream
+    paths: [/var/log/*.log]
+logging.level: info
+`)
+	newCfg := MustNewConfigFrom(`
+output.elasticsearch:
+  hosts: [a, c, d]
+  password: new
+inputs:
+  - type: filestream
+    paths: [/var/log/*.log]
+logging.level: debug
+logging.metrics: {}
+`)
+
+	changes, err := Diff(oldCfg, newCfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Change{
+		{Path: "logging.metrics", New: nil},
+		{Path: "output.elasticsearch.hosts.2", New: "d"},
+	}, changes.Added)
+	assert.Equal(t, []Change{
+		{Path: "output.elasticsearch.worker", Old: uint64(1)},
+	}, changes.Removed)
+	assert.Equal(t, []Change{
+		{Path: "logging.level", Old: "info", New: "debug"},
+		{Path: "output.elasticsearch.hosts.1", Old: "b", New: "c"},
+		{Path: "output.elasticsearch.password", Old: "<redacted>", New: "<redacted>"},
+	}, changes.Changed)
+
+	assert.False(t, changes.Empty())
+	assert.True(t, changes.Affects("output"))
+	assert.True(t, changes.Affects("logging.level"))
+	assert.False(t, changes.Affects("inputs"))
+	assert.False(t, changes.Affects("log"))
+	assert.NotContains(t, changes.String(), "old")
+	assert.Contains(t, changes.String(), "~logging.level: info -> debug")
+}
+
+func TestDiffEqual(t *testing.T) {
+	a := MustNewConfigFrom(`{a: 1, b: {c: [1, 2]}}`)
+	b := MustNewConfigFrom(`{b.c: [1, 2], a: 1}`)
+
+	changes, err := Diff(a, b)
+	require.NoError(t, err)
+	assert.True(t, changes.Empty())
+	assert.Empty(t, changes.Paths())
+
+	changes, err = Diff(nil, a)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b.c.0", "b.c.1"}, changes.Paths())
+}
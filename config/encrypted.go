@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/keystore/encryption"
+)
+
+const (
+	// EncryptedFileExt is the file extension of encrypted configuration files.
+	// ReadEncryptedFile ignores it when selecting the format of the decrypted
+	// contents, so `agent.yml.enc` is read as YAML.
+	EncryptedFileExt = ".enc"
+)
+
+// encryptedHeader is added at the beginning of encrypted configurations and
+// identifies the format version. The payload carries the key derivation and
+// cipher parameters so they can be hardened without a new format.
+var encryptedHeader = []byte("encv2:")
+
+// ErrNotEncrypted is returned when decrypting data that has not been created
+// by EncryptConfig.
+var ErrNotEncrypted = errors.New("configuration is not encrypted")
+
+// EncryptionKeyFunc returns the passphrase used to encrypt or decrypt a
+// configuration.
+type EncryptionKeyFunc func() ([]byte, error)
+
+// EnvEncryptionKey reads the passphrase from the environment variable name.
+func EnvEncryptionKey(name string) EncryptionKeyFunc {
+	return func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			return nil, fmt.Errorf("environment variable %v with the encryption key is not set", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+// SecretEncryptionKey reads the passphrase from a secret store, e.g. the
+// keystore using keystore.SecretResolver.
+func SecretEncryptionKey(r SecretResolver, ref string) EncryptionKeyFunc {
+	return func() ([]byte, error) {
+		v, err := r.ResolveSecret(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key %v: %w", ref, err)
+		}
+		return []byte(v), nil
+	}
+}
+
+// IsEncrypted reports whether data has been created by EncryptConfig.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+// EncryptConfig encrypts the configuration contents with a key derived from
+// the passphrase returned by key, using the default encryption parameters. The
+// result is text safe and can be read back using DecryptConfig or
+// ReadEncryptedFile.
+func EncryptConfig(contents []byte, key EncryptionKeyFunc) ([]byte, error) {
+	return EncryptConfigWithParams(contents, key, encryption.DefaultParams())
+}
+
+// EncryptConfigWithParams encrypts the configuration contents like
+// EncryptConfig using the given key derivation and cipher parameters.
+func EncryptConfigWithParams(contents []byte, key EncryptionKeyFunc, params encryption.Params) ([]byte, error) {
+	passphrase, err := readEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Output format: HEADER|BASE64(HEADER LENGTH|PARAMETERS|SALT|NONCE|CIPHERTEXT)
+	payload, err := encryption.Seal(params, passphrase, contents, encryptedHeader)
+	if err != nil {
+		return nil, fmt.Errorf("could not encrypt configuration: %w", err)
+	}
+	out := make([]byte, len(encryptedHeader)+base64.StdEncoding.EncodedLen(len(payload)))
+	copy(out, encryptedHeader)
+	base64.StdEncoding.Encode(out[len(encryptedHeader):], payload)
+	return out, nil
+}
+
+// DecryptConfig decrypts a configuration created by EncryptConfig. Returns
+// ErrNotEncrypted if data is not an encrypted configuration.
+func DecryptConfig(data []byte, key EncryptionKeyFunc) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, ErrNotEncrypted
+	}
+
+	encoded := bytes.TrimSpace(data[len(encryptedHeader):])
+	payload := make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.StdEncoding.Decode(payload, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt encrypted configuration: %w", err)
+	}
+	payload = payload[:n]
+
+	passphrase, err := readEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, _, err := encryption.Open(passphrase, payload, encryptedHeader)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt configuration, wrong key or corrupt data: %w", err)
+	}
+	return contents, nil
+}
+
+// ReadEncryptedFile reads and decrypts the configuration file at the given
+// path. The format of the decrypted contents is selected by the file
+// extension as in ReadFile, ignoring a trailing EncryptedFileExt.
+func ReadEncryptedFile(path string, key EncryptionKeyFunc) (*C, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := DecryptConfig(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %v: %w", path, err)
+	}
+
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, EncryptedFileExt) {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext))
+	}
+	return newConfigWithFormat(ext, path, contents)
+}
+
+func readEncryptionKey(key EncryptionKeyFunc) ([]byte, error) {
+	passphrase, err := key()
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty encryption key")
+	}
+	return passphrase, nil
+}
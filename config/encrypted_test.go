@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/keystore/encryption"
+)
+
+func staticKey(key string) EncryptionKeyFunc {
+	return func() ([]byte, error) { return []byte(key), nil }
+}
+
+func TestEncryptConfig(t *testing.T) {
+	contents := []byte("output.hosts: [localhost:9200]\noutput.password: secret\n")
+
+	encrypted, err := EncryptConfig(contents, staticKey("my passphrase"))
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, string(encrypted), "secret")
+
+	// every encryption uses a new salt and nonce
+	again, err := EncryptConfig(contents, staticKey("my passphrase"))
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	decrypted, err := DecryptConfig(encrypted, staticKey("my passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, contents, decrypted)
+
+	_, err = DecryptConfig(encrypted, staticKey("wrong passphrase"))
+	assert.Error(t, err)
+
+	_, err = DecryptConfig(contents, staticKey("my passphrase"))
+	assert.ErrorIs(t, err, ErrNotEncrypted)
+
+	_, err = DecryptConfig(append([]byte(nil), encrypted[:len(encrypted)-8]...), staticKey("my passphrase"))
+	assert.Error(t, err)
+
+	_, err = EncryptConfig(contents, staticKey(""))
+	assert.Error(t, err)
+}
+
+func TestEncryptConfigWithParams(t *testing.T) {
+	contents := []byte("a: 1\n")
+	params := encryption.Params{KDF: encryption.KDFParams{Algorithm: encryption.KDFPBKDF2, Iterations: 1000}}
+
+	encrypted, err := EncryptConfigWithParams(contents, staticKey("my passphrase"), params)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(encrypted, []byte("encv2:")))
+
+	// the parameters are read from the header
+	decrypted, err := DecryptConfig(encrypted, staticKey("my passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, contents, decrypted)
+
+	_, err = EncryptConfigWithParams(contents, staticKey("my passphrase"), encryption.Params{Cipher: "rot13"})
+	assert.ErrorContains(t, err, "unknown cipher")
+}
+
+func TestReadEncryptedFile(t *testing.T) {
+	t.Setenv("TEST_CONFIG_KEY", "my passphrase")
+	key := EnvEncryptionKey("TEST_CONFIG_KEY")
+
+	tests := map[string][]byte{
+		"agent.yml.enc":  []byte("output.hosts: [localhost:9200]\n"),
+		"agent.json.enc": []byte(`{"output": {"hosts": ["localhost:9200"]}}`),
+		"agent.toml":     []byte("[output]\nhosts = [\"localhost:9200\"]\n"),
+	}
+
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			encrypted, err := EncryptConfig(contents, key)
+			require.NoError(t, err)
+
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(path, encrypted, 0o600))
+
+			cfg, err := ReadEncryptedFile(path, key)
+			require.NoError(t, err)
+
+			host, err := cfg.String("output.hosts", 0)
+			require.NoError(t, err)
+			assert.Equal(t, "localhost:9200", host)
+		})
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.yml.enc")
+		encrypted, err := EncryptConfig([]byte("a: 1"), key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, encrypted, 0o600))
+
+		_, err = ReadEncryptedFile(path, EnvEncryptionKey("TEST_CONFIG_KEY_MISSING"))
+		assert.Error(t, err)
+	})
+}
+
+func TestSecretEncryptionKey(t *testing.T) {
+	r := SecretResolverFunc(func(ref string) (string, error) {
+		if ref == "config_key" {
+			return "my passphrase", nil
+		}
+		return "", ErrSecretNotFound
+	})
+
+	encrypted, err := EncryptConfig([]byte("a: 1"), SecretEncryptionKey(r, "config_key"))
+	require.NoError(t, err)
+
+	decrypted, err := DecryptConfig(encrypted, staticKey("my passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("a: 1"), decrypted)
+
+	_, err = DecryptConfig(encrypted, SecretEncryptionKey(r, "other"))
+	assert.True(t, errors.Is(err, ErrSecretNotFound))
+}
@@ -19,6 +19,7 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"strings"
 
 	ucfg "github.com/elastic/go-ucfg"
@@ -195,6 +196,21 @@ func NewSettingsFlag(def *C) *SettingsFlag {
 	return (*SettingsFlag)(tmp)
 }
 
+// ParseSettings builds a Config object from a list of `key=value` settings,
+// using the same parsing rules as SettingsFlag. Keys can address nested
+// settings using dots (e.g. `output.hosts=[a, b]`), values are parsed into
+// booleans, numbers, arrays or objects where possible and a key without value
+// is set to `true`. Later settings overwrite earlier ones.
+func ParseSettings(settings ...string) (*C, error) {
+	f := NewSettingsFlag(NewConfig())
+	for _, s := range settings {
+		if err := f.Set(s); err != nil {
+			return nil, fmt.Errorf("invalid setting '%v': %w", s, err)
+		}
+	}
+	return f.Config(), nil
+}
+
 func (f *SettingsFlag) access() *cfgflag.FlagValue {
 	return (*cfgflag.FlagValue)(f)
 }
@@ -204,6 +220,12 @@ func (f *SettingsFlag) Config() *C {
 	return fromConfig(f.access().Config())
 }
 
+// Apply overlays the settings collected by the flag onto cfg. Settings given
+// on the command line take precedence over the values already present in cfg.
+func (f *SettingsFlag) Apply(cfg *C) error {
+	return cfg.Merge(f.Config())
+}
+
 // Set sets a settings value in the Config object.  The input string must be a
 // key-value pair like `key=value`. If the value is missing, the value is set
 // to the boolean value `true`.
@@ -138,6 +138,49 @@ func TestSettingsFlag(t *testing.T) {
 	}
 }
 
+func TestParseSettings(t *testing.T) {
+	cfg, err := ParseSettings("a.b=1", "a.c=text", "d", "e=[x, y]", "a.b=2")
+	require.NoError(t, err)
+
+	var result map[string]interface{}
+	require.NoError(t, cfg.Unpack(&result))
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{"b": uint64(2), "c": "text"},
+		"d": true,
+		"e": []interface{}{"x", "y"},
+	}, result)
+
+	_, err = ParseSettings("a=[x")
+	assert.Error(t, err)
+}
+
+func TestSettingsFlagApply(t *testing.T) {
+	cfg := MustNewConfigFrom(map[string]interface{}{
+		"output": map[string]interface{}{
+			"hosts":   []string{"localhost:9200"},
+			"enabled": true,
+		},
+	})
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := NewSettingsFlag(NewConfig())
+	fs.Var(f, "E", "overwrite setting")
+	require.NoError(t, fs.Parse([]string{"-E", "output.enabled=false", "-E", "output.timeout=10s"}))
+	require.NoError(t, f.Apply(cfg))
+
+	enabled, err := cfg.Bool("output.enabled", -1)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	timeout, err := cfg.String("output.timeout", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "10s", timeout)
+
+	host, err := cfg.String("output.hosts", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9200", host)
+}
+
 func TestOverwriteFlag(t *testing.T) {
 	config, err := NewConfigFrom(map[string]interface{}{
 		"a": "test",
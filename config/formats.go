@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	ucfg "github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/json"
+)
+
+// NewConfigWithJSON reads a JSON configuration.
+func NewConfigWithJSON(in []byte, source string) (*C, error) {
+	c, err := json.NewConfig(normalizeSecretRefs(in).([]byte), sourceConfigOpts(source)...)
+	return fromConfig(c), err
+}
+
+// NewConfigWithTOML reads a TOML configuration. Date and time values are
+// converted to strings in their RFC 3339 representation.
+func NewConfigWithTOML(in []byte, source string) (*C, error) {
+	var m map[string]interface{}
+	if err := toml.Unmarshal(in, &m); err != nil {
+		return nil, err
+	}
+
+	c, err := ucfg.NewFrom(normalizeSecretRefs(normalizeTOML(m)), sourceConfigOpts(source)...)
+	return fromConfig(c), err
+}
+
+// ReadFile reads the configuration file at the given path. The format is
+// selected by the file extension: `.json` for JSON, `.toml` for TOML, and
+// YAML otherwise.
+func ReadFile(path string) (*C, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newConfigFromFile(path, contents)
+}
+
+// newConfigFromFile parses the contents of the file at path, selecting the
+// format by the file extension.
+func newConfigFromFile(path string, contents []byte) (*C, error) {
+	return newConfigWithFormat(filepath.Ext(path), path, contents)
+}
+
+// newConfigWithFormat parses the contents of the file at path in the format
+// selected by the file extension ext.
+func newConfigWithFormat(ext, path string, contents []byte) (*C, error) {
+	var cfg *C
+	var err error
+	switch strings.ToLower(ext) {
+	case ".json":
+		cfg, err = NewConfigWithJSON(contents, path)
+	case ".toml":
+		cfg, err = NewConfigWithTOML(contents, path)
+	default:
+		cfg, err = NewConfigWithYAML(contents, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func sourceConfigOpts(source string) []ucfg.Option {
+	return append(
+		[]ucfg.Option{
+			ucfg.MetaData(ucfg.Meta{Source: source}),
+		},
+		getGlobalConfigOpts()...,
+	)
+}
+
+// normalizeTOML converts TOML specific types to types supported by ucfg.
+func normalizeTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = normalizeTOML(elem)
+		}
+		return v
+	case []map[string]interface{}:
+		arr := make([]interface{}, len(v))
+		for i, elem := range v {
+			arr[i] = normalizeTOML(elem)
+		}
+		return arr
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalizeTOML(elem)
+		}
+		return v
+	case time.Time:
+		// Local date and times are decoded using marker locations.
+		switch v.Location().String() {
+		case "date-local":
+			return v.Format(time.DateOnly)
+		case "time-local":
+			return v.Format("15:04:05.999999999")
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999")
+		}
+		return v.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type formatsTestConfig struct {
+	Output struct {
+		Hosts   []string `config:"hosts"`
+		Workers int      `config:"workers"`
+	} `config:"output"`
+	Inputs []struct {
+		Type    string `config:"type"`
+		Enabled bool   `config:"enabled"`
+	} `config:"inputs"`
+	Since string `config:"since"`
+}
+
+func TestReadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yml": `
+output.hosts: ["localhost:9200"]
+output.workers: 2
+inputs:
+  - type: filestream
+    enabled: true
+since: "2024-05-01T10:00:00Z"
+`,
+		"config.json": `{
+  "output": {"hosts": ["localhost:9200"], "workers": 2},
+  "inputs": [{"type": "filestream", "enabled": true}],
+  "since": "2024-05-01T10:00:00Z"
+}`,
+		"config.TOML": `
+since = 2024-05-01T10:00:00Z
+
+[output]
+hosts = ["localhost:9200"]
+workers = 2
+
+[[inputs]]
+type = "filestream"
+enabled = true
+`,
+	}
+
+	dir := t.TempDir()
+	for name, contents := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+			cfg, err := ReadFile(path)
+			require.NoError(t, err)
+
+			var settings formatsTestConfig
+			require.NoError(t, cfg.Unpack(&settings))
+			assert.Equal(t, []string{"localhost:9200"}, settings.Output.Hosts)
+			assert.Equal(t, 2, settings.Output.Workers)
+			require.Len(t, settings.Inputs, 1)
+			assert.Equal(t, "filestream", settings.Inputs[0].Type)
+			assert.True(t, settings.Inputs[0].Enabled)
+			assert.Equal(t, "2024-05-01T10:00:00Z", settings.Since)
+		})
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := ReadFile(filepath.Join(dir, "missing.yml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"a": `), 0o600))
+	_, err = ReadFile(path)
+	assert.ErrorContains(t, err, path)
+}
+
+func TestNewConfigWithTOMLDates(t *testing.T) {
+	cfg, err := NewConfigWithTOML([]byte(`
+date = 2024-05-01
+time = 10:30:00
+datetime = 2024-05-01T10:30:00.5
+`), "test")
+	require.NoError(t, err)
+
+	var settings struct {
+		Date     string `config:"date"`
+		Time     string `config:"time"`
+		Datetime string `config:"datetime"`
+	}
+	require.NoError(t, cfg.Unpack(&settings))
+	assert.Equal(t, "2024-05-01", settings.Date)
+	assert.Equal(t, "10:30:00", settings.Time)
+	assert.Equal(t, "2024-05-01T10:30:00.5", settings.Datetime)
+}
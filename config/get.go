@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+// Get unpacks the setting at the given path into a value of type T. Nested
+// settings are accessed by joining names with `.`, like `output.hosts`.
+// Returns an error wrapping ucfg.ErrMissing if the setting does not exist,
+// or an error if the setting can not be converted to T.
+//
+//	timeout, err := config.Get[time.Duration](cfg, "output.timeout")
+func Get[T any](c *C, path string) (T, error) {
+	var zero T
+	if c == nil || !c.HasPath(path) {
+		return zero, fmt.Errorf("%w: %v", ucfg.ErrMissing, path)
+	}
+
+	parent := c
+	name := path
+	if idx := strings.LastIndexByte(path, '.'); idx >= 0 {
+		var err error
+		parent, err = c.Child(path[:idx], -1)
+		if err != nil {
+			return zero, fmt.Errorf("failed to read '%v': %w", path, err)
+		}
+		name = path[idx+1:]
+	}
+
+	// The tag of the field holding the value is only known at runtime.
+	typ := reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: reflect.TypeOf(&zero).Elem(),
+		Tag:  reflect.StructTag(fmt.Sprintf(`config:"%v"`, name)),
+	}})
+	to := reflect.New(typ)
+	if err := parent.Unpack(to.Interface()); err != nil {
+		return zero, fmt.Errorf("failed to read '%v': %w", path, err)
+	}
+	return to.Elem().Field(0).Interface().(T), nil
+}
+
+// GetOr is like Get, but returns def if the setting does not exist.
+// Conversion errors are still reported.
+func GetOr[T any](c *C, path string, def T) (T, error) {
+	if c == nil || !c.HasPath(path) {
+		return def, nil
+	}
+	return Get[T](c, path)
+}
+
+// HasPath returns true if a setting exists at the given path. Nested
+// settings are accessed by joining names with `.`.
+func (c *C) HasPath(path string) bool {
+	has, err := c.access().Has(path, -1, getGlobalConfigOpts()...)
+	return err == nil && has
+}
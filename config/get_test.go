@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+func TestGet(t *testing.T) {
+	cfg := MustNewConfigFrom(`
+output.elasticsearch:
+  hosts: [a, b]
+  timeout: 90s
+  worker: 2
+  enabled: true
+  ssl.verification_mode: none
+inputs:
+  - type: filestream
+`)
+
+	hosts, err := Get[[]string](cfg, "output.elasticsearch.hosts")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, hosts)
+
+	timeout, err := Get[time.Duration](cfg, "output.elasticsearch.timeout")
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, timeout)
+
+	worker, err := Get[int](cfg, "output.elasticsearch.worker")
+	require.NoError(t, err)
+	assert.Equal(t, 2, worker)
+
+	enabled, err := Get[bool](cfg, "output.elasticsearch.enabled")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	policy, err := GetOr(cfg, "merge", MergeAppend)
+	require.NoError(t, err)
+	assert.Equal(t, MergeAppend, policy)
+
+	ssl, err := Get[*C](cfg, "output.elasticsearch.ssl")
+	require.NoError(t, err)
+	mode, err := ssl.String("verification_mode", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "none", mode)
+
+	inputType, err := Get[string](cfg, "inputs.0.type")
+	require.NoError(t, err)
+	assert.Equal(t, "filestream", inputType)
+
+	inputs, err := Get[[]struct {
+		Type string `config:"type"`
+	}](cfg, "inputs")
+	require.NoError(t, err)
+	require.Len(t, inputs, 1)
+	assert.Equal(t, "filestream", inputs[0].Type)
+}
+
+func TestGetErrors(t *testing.T) {
+	cfg := MustNewConfigFrom(map[string]interface{}{"a.b": "text"})
+
+	_, err := Get[string](cfg, "a.missing")
+	assert.ErrorIs(t, err, ucfg.ErrMissing)
+
+	_, err = Get[string](nil, "a")
+	assert.ErrorIs(t, err, ucfg.ErrMissing)
+
+	_, err = Get[int](cfg, "a.b")
+	assert.ErrorContains(t, err, "failed to read 'a.b'")
+
+	_, err = GetOr(cfg, "a.b", 42)
+	assert.Error(t, err)
+
+	v, err := GetOr(cfg, "a.c", 42)
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	assert.True(t, cfg.HasPath("a.b"))
+	assert.False(t, cfg.HasPath("a.b.c"))
+}
@@ -0,0 +1,54 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Hash returns a digest of the configuration, which only changes if the
+// settings change. It does not depend on the order of the keys or the
+// formatting of the source the configuration has been read from, such that it
+// can be used to cheaply detect if a reloaded configuration is unchanged.
+//
+// Variables are resolved before hashing, so a configuration referencing an
+// environment variable changes its hash if the variable changes. An error is
+// returned if the configuration can not be unpacked.
+func (c *C) Hash() (string, error) {
+	if c == nil {
+		c = NewConfig()
+	}
+
+	content, err := c.content()
+	if err != nil {
+		return "", fmt.Errorf("failed to hash configuration: %w", err)
+	}
+
+	// encoding/json writes map keys in sorted order and numbers independent
+	// of their Go type, making the encoding canonical.
+	encoded, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash configuration: %w", err)
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
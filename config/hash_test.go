@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	hash := func(t *testing.T, cfg *C) string {
+		t.Helper()
+		h, err := cfg.Hash()
+		require.NoError(t, err)
+		return h
+	}
+
+	yamlCfg, err := NewConfigWithYAML([]byte(`
+output:
+  hosts: [a, b]
+  timeout: 10s
+name: test
+`), "test.yml")
+	require.NoError(t, err)
+
+	dotted, err := NewConfigWithYAML([]byte("name: test\noutput.timeout: 10s\noutput.hosts:\n  - a\n  - b\n"), "")
+	require.NoError(t, err)
+
+	jsonCfg, err := NewConfigWithJSON([]byte(`{"name": "test", "output": {"timeout": "10s", "hosts": ["a", "b"]}}`), "")
+	require.NoError(t, err)
+
+	expected := hash(t, yamlCfg)
+	assert.Len(t, expected, 64)
+	assert.Equal(t, expected, hash(t, yamlCfg))
+	assert.Equal(t, expected, hash(t, dotted))
+	assert.Equal(t, expected, hash(t, jsonCfg))
+
+	require.NoError(t, dotted.SetString("output.timeout", -1, "20s"))
+	assert.NotEqual(t, expected, hash(t, dotted))
+
+	reordered := MustNewConfigFrom(map[string]interface{}{
+		"name":   "test",
+		"output": map[string]interface{}{"hosts": []string{"b", "a"}, "timeout": "10s"},
+	})
+	assert.NotEqual(t, expected, hash(t, reordered), "array order is significant")
+
+	sub, err := yamlCfg.Child("output", -1)
+	require.NoError(t, err)
+	subJSON, err := jsonCfg.Child("output", -1)
+	require.NoError(t, err)
+	assert.Equal(t, hash(t, sub), hash(t, subJSON))
+
+	assert.Equal(t, hash(t, NewConfig()), hash(t, nil))
+}
+
+func TestHashVariables(t *testing.T) {
+	cfg := MustNewConfigFrom(map[string]interface{}{"host": "${TEST_HASH_HOST}"})
+
+	_, err := cfg.Hash()
+	assert.Error(t, err)
+
+	t.Setenv("TEST_HASH_HOST", "a")
+	first, err := cfg.Hash()
+	require.NoError(t, err)
+
+	t.Setenv("TEST_HASH_HOST", "b")
+	second, err := cfg.Hash()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+// MergePolicy controls how arrays are combined when merging configurations.
+type MergePolicy uint8
+
+const (
+	// MergeDefault merges arrays element by element, such that the element at
+	// index i in the source overwrites the element at index i in the target.
+	MergeDefault MergePolicy = iota
+
+	// MergeReplace replaces arrays and dictionaries in the target with the
+	// source value.
+	MergeReplace
+
+	// MergeAppend appends the source array to the target array.
+	MergeAppend
+
+	// MergePrepend prepends the source array to the target array.
+	MergePrepend
+)
+
+var mergePolicyNames = map[MergePolicy]string{
+	MergeDefault: "default",
+	MergeReplace: "replace",
+	MergeAppend:  "append",
+	MergePrepend: "prepend",
+}
+
+// Merge options selecting the array merge policy for all keys.
+var (
+	// ArrayReplace replaces arrays and dictionaries instead of merging them.
+	ArrayReplace = MergeReplace.Option()
+
+	// ArrayAppend appends arrays instead of merging them element by element.
+	ArrayAppend = MergeAppend.Option()
+
+	// ArrayPrepend prepends arrays instead of merging them element by element.
+	ArrayPrepend = MergePrepend.Option()
+)
+
+// String returns the name of the merge policy.
+func (p MergePolicy) String() string {
+	if s, ok := mergePolicyNames[p]; ok {
+		return s
+	}
+	return fmt.Sprintf("MergePolicy(%d)", p)
+}
+
+// Unpack unmarshals a merge policy string to a MergePolicy. This implements
+// ucfg.StringUnpacker.
+func (p *MergePolicy) Unpack(str string) error {
+	str = strings.ToLower(str)
+	for policy, name := range mergePolicyNames {
+		if name == str {
+			*p = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid merge policy '%v'", str)
+}
+
+// SchemaEnum returns the names of the merge policies. This implements
+// SchemaEnumer.
+func (p MergePolicy) SchemaEnum() []interface{} {
+	enum := make([]interface{}, 0, len(mergePolicyNames))
+	for policy := MergeDefault; policy <= MergePrepend; policy++ {
+		enum = append(enum, mergePolicyNames[policy])
+	}
+	return enum
+}
+
+// Option returns the merge option applying the policy to all keys. The option
+// returned for MergeDefault does not change the policy.
+func (p MergePolicy) Option() ucfg.Option {
+	switch p {
+	case MergeReplace:
+		return ucfg.ReplaceValues
+	case MergeAppend:
+		return ucfg.AppendValues
+	case MergePrepend:
+		return ucfg.PrependValues
+	default:
+		return ucfg.FieldMergeValues()
+	}
+}
+
+// Fields returns the merge option applying the policy to the given keys
+// only. Keys are full paths relative to the merge target, e.g.
+// `ssl.certificate_authorities`. Wildcards as supported by ucfg, like
+// `inputs.*.paths`, can be used to select keys nested in arrays.
+//
+// Per-key policies take precedence over the policy set for all keys.
+func (p MergePolicy) Fields(fields ...string) ucfg.Option {
+	switch p {
+	case MergeReplace:
+		return ucfg.FieldReplaceValues(fields...)
+	case MergeAppend:
+		return ucfg.FieldAppendValues(fields...)
+	case MergePrepend:
+		return ucfg.FieldPrependValues(fields...)
+	default:
+		return ucfg.FieldMergeValues(fields...)
+	}
+}
+
+// MergePolicies maps keys to the merge policy to apply when merging. It can
+// be unpacked from a configuration, such that layered configuration files can
+// declare how they are combined:
+//
+//	merge_policies:
+//	  ssl.certificate_authorities: append
+//	  output.elasticsearch.hosts: replace
+type MergePolicies map[string]MergePolicy
+
+// Unpack reads the per-key policies from a configuration. Nested keys are
+// joined with `.`.
+func (m *MergePolicies) Unpack(cfg *C) error {
+	// flattened keys are absolute, but policies apply relative to the
+	// configuration being merged into
+	prefix := cfg.Path()
+	if prefix != "" {
+		prefix += "."
+	}
+
+	policies := MergePolicies{}
+	for _, path := range cfg.FlattenedKeys() {
+		field := strings.TrimPrefix(path, prefix)
+		s, err := cfg.String(field, -1)
+		if err != nil {
+			return fmt.Errorf("failed to read merge policy of '%v': %w", field, err)
+		}
+
+		var policy MergePolicy
+		if err := policy.Unpack(s); err != nil {
+			return fmt.Errorf("failed to read merge policy of '%v': %w", field, err)
+		}
+		policies[field] = policy
+	}
+	*m = policies
+	return nil
+}
+
+// Options returns the merge options for the per-key policies.
+func (m MergePolicies) Options() []ucfg.Option {
+	byPolicy := map[MergePolicy][]string{}
+	for field, policy := range m {
+		byPolicy[policy] = append(byPolicy[policy], field)
+	}
+
+	opts := make([]ucfg.Option, 0, len(byPolicy))
+	for policy := MergeDefault; policy <= MergePrepend; policy++ {
+		if fields := byPolicy[policy]; len(fields) > 0 {
+			sort.Strings(fields)
+			opts = append(opts, policy.Fields(fields...))
+		}
+	}
+	return opts
+}
@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	ucfg "github.com/elastic/go-ucfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePolicies(t *testing.T) {
+	base := `
+ssl.certificate_authorities: [a.pem, b.pem]
+hosts: [h1, h2]
+`
+	overlay := `
+ssl.certificate_authorities: [c.pem]
+hosts: [h3]
+`
+
+	type settings struct {
+		SSL struct {
+			CAs []string `config:"certificate_authorities"`
+		} `config:"ssl"`
+		Hosts []string `config:"hosts"`
+	}
+
+	tests := map[string]struct {
+		opts  []ucfg.Option
+		cas   []string
+		hosts []string
+	}{
+		"default": {
+			cas:   []string{"c.pem", "b.pem"},
+			hosts: []string{"h3", "h2"},
+		},
+		"append": {
+			opts:  []ucfg.Option{ArrayAppend},
+			cas:   []string{"a.pem", "b.pem", "c.pem"},
+			hosts: []string{"h1", "h2", "h3"},
+		},
+		"prepend": {
+			opts:  []ucfg.Option{ArrayPrepend},
+			cas:   []string{"c.pem", "a.pem", "b.pem"},
+			hosts: []string{"h3", "h1", "h2"},
+		},
+		"replace": {
+			opts:  []ucfg.Option{ArrayReplace},
+			cas:   []string{"c.pem"},
+			hosts: []string{"h3"},
+		},
+		"per key": {
+			opts:  []ucfg.Option{MergeAppend.Fields("ssl.certificate_authorities")},
+			cas:   []string{"a.pem", "b.pem", "c.pem"},
+			hosts: []string{"h3", "h2"},
+		},
+		"per key overrides global": {
+			opts:  []ucfg.Option{ArrayAppend, MergeReplace.Fields("hosts")},
+			cas:   []string{"a.pem", "b.pem", "c.pem"},
+			hosts: []string{"h3"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := MustNewConfigFrom(base)
+			require.NoError(t, cfg.MergeWithOpts(MustNewConfigFrom(overlay), test.opts...))
+
+			var s settings
+			require.NoError(t, cfg.Unpack(&s))
+			assert.Equal(t, test.cas, s.SSL.CAs)
+			assert.Equal(t, test.hosts, s.Hosts)
+		})
+	}
+}
+
+func TestMergePoliciesFromConfig(t *testing.T) {
+	var settings struct {
+		Policies MergePolicies `config:"merge_policies"`
+	}
+	cfg := MustNewConfigFrom(`
+merge_policies:
+  ssl.certificate_authorities: append
+  hosts: replace
+`)
+	require.NoError(t, cfg.Unpack(&settings))
+	assert.Equal(t, MergePolicies{
+		"ssl.certificate_authorities": MergeAppend,
+		"hosts":                       MergeReplace,
+	}, settings.Policies)
+
+	merged, err := MergeConfigsWithOptions([]*C{
+		MustNewConfigFrom(`{ssl.certificate_authorities: [a.pem], hosts: [h1, h2]}`),
+		MustNewConfigFrom(`{ssl.certificate_authorities: [b.pem], hosts: [h3]}`),
+	}, settings.Policies.Options()...)
+	require.NoError(t, err)
+
+	cas, err := merged.Child("ssl", -1)
+	require.NoError(t, err)
+	n, err := cas.CountField("certificate_authorities")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = merged.CountField("hosts")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	var p MergePolicy
+	assert.Error(t, p.Unpack("merge-all"))
+}
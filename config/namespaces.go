@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Namespaces stores multiple configuration sections by name, like outputs
+// with several types configured at once. Unlike Namespace, which fails if
+// more than one section is enabled, any number of sections can be enabled.
+// Sections are enabled unless they set `enabled: false`.
+type Namespaces struct {
+	enabled  []Namespace
+	disabled []string
+}
+
+// Unpack unpacks all sections of the configuration. Settings which are not
+// configuration objects are ignored.
+func (ns *Namespaces) Unpack(cfg *C) error {
+	ns.enabled, ns.disabled = nil, nil
+	for _, name := range cfg.GetFields() {
+		sub, err := cfg.Child(name, -1)
+		if err != nil {
+			continue
+		}
+
+		if !sub.Enabled() {
+			ns.disabled = append(ns.disabled, name)
+			continue
+		}
+		ns.enabled = append(ns.enabled, Namespace{name: name, config: sub})
+	}
+
+	sort.Slice(ns.enabled, func(i, j int) bool { return ns.enabled[i].name < ns.enabled[j].name })
+	sort.Strings(ns.disabled)
+	return nil
+}
+
+// Enabled returns the enabled sections, sorted by name.
+func (ns *Namespaces) Enabled() []Namespace {
+	return ns.enabled
+}
+
+// Names returns the names of the enabled sections, sorted.
+func (ns *Namespaces) Names() []string {
+	names := make([]string, len(ns.enabled))
+	for i, n := range ns.enabled {
+		names[i] = n.name
+	}
+	return names
+}
+
+// Disabled returns the names of the disabled sections, sorted.
+func (ns *Namespaces) Disabled() []string {
+	return ns.disabled
+}
+
+// Config returns the configuration of the enabled section with the given
+// name.
+func (ns *Namespaces) Config(name string) (*C, bool) {
+	for _, n := range ns.enabled {
+		if n.name == name {
+			return n.config, true
+		}
+	}
+	return nil, false
+}
+
+// IsSet returns true if at least one section is enabled.
+func (ns *Namespaces) IsSet() bool {
+	return len(ns.enabled) > 0
+}
+
+// Single returns the enabled section, requiring exactly one section to be
+// enabled. This matches the semantics of Namespace.
+func (ns *Namespaces) Single() (Namespace, error) {
+	switch len(ns.enabled) {
+	case 0:
+		return Namespace{}, fmt.Errorf("no section enabled")
+	case 1:
+		return ns.enabled[0], nil
+	default:
+		return Namespace{}, fmt.Errorf("only one section can be enabled, found %v", strings.Join(ns.Names(), ", "))
+	}
+}
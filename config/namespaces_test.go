@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaces(t *testing.T) {
+	cfg := MustNewConfigFrom(`
+outputs:
+  logstash:
+    hosts: ["localhost:5044"]
+  elasticsearch:
+    hosts: ["localhost:9200"]
+  kafka:
+    enabled: false
+    hosts: ["localhost:9092"]
+  codec: json
+`)
+
+	var settings struct {
+		Outputs Namespaces `config:"outputs"`
+	}
+	require.NoError(t, cfg.Unpack(&settings))
+
+	outputs := settings.Outputs
+	assert.True(t, outputs.IsSet())
+	assert.Equal(t, []string{"elasticsearch", "logstash"}, outputs.Names())
+	assert.Equal(t, []string{"kafka"}, outputs.Disabled())
+
+	es, ok := outputs.Config("elasticsearch")
+	require.True(t, ok)
+	hosts, err := Get[[]string](es, "hosts")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"localhost:9200"}, hosts)
+
+	_, ok = outputs.Config("kafka")
+	assert.False(t, ok)
+
+	require.Len(t, outputs.Enabled(), 2)
+	assert.Equal(t, "logstash", outputs.Enabled()[1].Name())
+
+	_, err = outputs.Single()
+	assert.ErrorContains(t, err, "elasticsearch, logstash")
+}
+
+func TestNamespacesSingle(t *testing.T) {
+	var ns Namespaces
+	require.NoError(t, ns.Unpack(MustNewConfigFrom(`{console: {pretty: true}, file.enabled: false}`)))
+
+	single, err := ns.Single()
+	require.NoError(t, err)
+	assert.Equal(t, "console", single.Name())
+	assert.True(t, single.IsSet())
+
+	require.NoError(t, ns.Unpack(MustNewConfigFrom(`{file.enabled: false}`)))
+	assert.False(t, ns.IsSet())
+	_, err = ns.Single()
+	assert.Error(t, err)
+}
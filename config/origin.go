@@ -0,0 +1,213 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"weak"
+
+	ucfg "github.com/elastic/go-ucfg"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Origin is the location a setting has been read from.
+type Origin struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (o Origin) String() string {
+	return fmt.Sprintf("%v:%d:%d", o.File, o.Line, o.Column)
+}
+
+// origins holds the origins of the settings of configurations, by the
+// configuration root. Entries are removed once the root is garbage
+// collected.
+var origins = struct {
+	sync.Mutex
+	m map[weak.Pointer[ucfg.Config]]map[string]Origin
+}{m: map[weak.Pointer[ucfg.Config]]map[string]Origin{}}
+
+// Origin returns the location the setting at the given path has been read
+// from. Nested settings are accessed by joining names with `.`, and array
+// elements by their index, like `inputs.0.type`.
+//
+// Origins are recorded for configurations read from YAML files, and are kept
+// when merging configurations. Returns false if the origin is unknown.
+func (c *C) Origin(path string) (Origin, bool) {
+	root, prefix := c.root()
+	if p := strings.TrimPrefix(path, "."); prefix != "" {
+		path = prefix + "." + p
+	}
+
+	origins.Lock()
+	defer origins.Unlock()
+	o, ok := origins.m[weak.Make(root)][path]
+	return o, ok
+}
+
+// root returns the root of the configuration tree and the path of c in it.
+func (c *C) root() (*ucfg.Config, string) {
+	cfg := c.access()
+	for cfg.Parent() != nil {
+		cfg = cfg.Parent()
+	}
+	return cfg, c.Path()
+}
+
+func loadOrigins(root *ucfg.Config) map[string]Origin {
+	origins.Lock()
+	defer origins.Unlock()
+	return origins.m[weak.Make(root)]
+}
+
+func storeOrigins(root *ucfg.Config, o map[string]Origin) {
+	if len(o) == 0 {
+		return
+	}
+
+	key := weak.Make(root)
+	origins.Lock()
+	defer origins.Unlock()
+	if _, exists := origins.m[key]; !exists {
+		runtime.AddCleanup(root, func(key weak.Pointer[ucfg.Config]) {
+			origins.Lock()
+			defer origins.Unlock()
+			delete(origins.m, key)
+		}, key)
+	}
+	origins.m[key] = o
+}
+
+// mergeOrigins copies the origins of from into the configuration, after from
+// has been merged into c.
+func (c *C) mergeOrigins(from interface{}) {
+	src, ok := from.(*C)
+	if !ok || src == nil {
+		return
+	}
+	srcRoot, srcPrefix := src.root()
+	srcOrigins := loadOrigins(srcRoot)
+	if len(srcOrigins) == 0 {
+		return
+	}
+
+	root, prefix := c.root()
+	merged := map[string]Origin{}
+	for k, o := range loadOrigins(root) {
+		merged[k] = o
+	}
+	for k, o := range srcOrigins {
+		if srcPrefix != "" {
+			if !strings.HasPrefix(k, srcPrefix+".") {
+				continue
+			}
+			k = strings.TrimPrefix(k, srcPrefix+".")
+		}
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		merged[k] = o
+	}
+	storeOrigins(root, merged)
+}
+
+// withOrigin adds the origin of the setting an error has been reported for
+// to the error message.
+func (c *C) withOrigin(err error) error {
+	var ucfgErr ucfg.Error
+	if !errors.As(err, &ucfgErr) || ucfgErr.Path() == "" {
+		return err
+	}
+	root, _ := c.root()
+	o, ok := loadOrigins(root)[ucfgErr.Path()]
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%w (at %v)", err, o)
+}
+
+// yamlOrigins returns the origins of all settings in a YAML document.
+func yamlOrigins(in []byte, file string) map[string]Origin {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(in, &doc); err != nil {
+		return nil
+	}
+	return nodeOrigins(&doc, file)
+}
+
+// nodeOrigins returns the origins of all settings of a parsed YAML document.
+// Nodes without a position, like nodes added to a YAMLDocument, have no
+// origin.
+func nodeOrigins(doc *yamlv3.Node, file string) map[string]Origin {
+	o := map[string]Origin{}
+	var walk func(n *yamlv3.Node, path string)
+	walk = func(n *yamlv3.Node, path string) {
+		join := func(name string) string {
+			if path == "" {
+				return name
+			}
+			return path + "." + name
+		}
+
+		switch n.Kind {
+		case yamlv3.DocumentNode:
+			for _, c := range n.Content {
+				walk(c, path)
+			}
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if key.Tag == "!!merge" {
+					continue
+				}
+				p := join(key.Value)
+				if key.Line == 0 {
+					walk(value, p)
+					continue
+				}
+				origin := Origin{File: file, Line: key.Line, Column: key.Column}
+				o[p] = origin
+
+				// dotted keys define all intermediate settings
+				for idx := strings.LastIndexByte(p, '.'); idx > len(path); idx = strings.LastIndexByte(p[:idx], '.') {
+					if _, exists := o[p[:idx]]; !exists {
+						o[p[:idx]] = origin
+					}
+				}
+				walk(value, p)
+			}
+		case yamlv3.SequenceNode:
+			for i, c := range n.Content {
+				p := join(strconv.Itoa(i))
+				if c.Line > 0 {
+					o[p] = Origin{File: file, Line: c.Line, Column: c.Column}
+				}
+				walk(c, p)
+			}
+		}
+	}
+	walk(doc, "")
+	return o
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrigin(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yml")
+	overlay := filepath.Join(dir, "overlay.yml")
+	require.NoError(t, os.WriteFile(base, []byte(`output.elasticsearch:
+  hosts:
+    - localhost:9200
+  workers: 1
+inputs:
+  - type: filestream
+`), 0o600))
+	require.NoError(t, os.WriteFile(overlay, []byte(`
+output.elasticsearch.workers: many
+`), 0o600))
+
+	baseCfg, err := ReadFile(base)
+	require.NoError(t, err)
+
+	o, ok := baseCfg.Origin("output.elasticsearch.hosts.0")
+	require.True(t, ok)
+	assert.Equal(t, Origin{File: base, Line: 3, Column: 7}, o)
+
+	o, ok = baseCfg.Origin("output")
+	require.True(t, ok)
+	assert.Equal(t, Origin{File: base, Line: 1, Column: 1}, o)
+
+	o, ok = baseCfg.Origin("inputs.0.type")
+	require.True(t, ok)
+	assert.Equal(t, base+":6:5", o.String())
+
+	inputs, err := baseCfg.Child("inputs", -1)
+	require.NoError(t, err)
+	input, err := inputs.Child("", 0)
+	require.NoError(t, err)
+	o, ok = input.Origin("type")
+	require.True(t, ok)
+	assert.Equal(t, 6, o.Line)
+
+	_, ok = baseCfg.Origin("missing")
+	assert.False(t, ok)
+
+	overlayCfg, err := ReadFile(overlay)
+	require.NoError(t, err)
+	merged, err := MergeConfigs(baseCfg, overlayCfg)
+	require.NoError(t, err)
+
+	o, ok = merged.Origin("output.elasticsearch.workers")
+	require.True(t, ok)
+	assert.Equal(t, Origin{File: overlay, Line: 2, Column: 1}, o)
+	o, ok = merged.Origin("output.elasticsearch.hosts")
+	require.True(t, ok)
+	assert.Equal(t, base, o.File)
+
+	var settings struct {
+		Output struct {
+			Elasticsearch struct {
+				Workers int `config:"workers"`
+			} `config:"elasticsearch"`
+		} `config:"output"`
+	}
+	err = merged.Unpack(&settings)
+	assert.ErrorContains(t, err, "(at "+overlay+":2:1)")
+}
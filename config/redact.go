@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const redacted = "<redacted>"
+
+// redactedKeys are the substrings of key names always redacted by
+// RedactedString.
+var redactedKeys = []string{"password", "token", "key"}
+
+// RedactedString returns the configuration as YAML, with the values of keys
+// that might contain secrets replaced by `<redacted>`, such that it can be
+// included in diagnostics.
+//
+// Keys with names containing `password`, `token` or `key` are always
+// redacted. Additional keys are selected by patterns as supported by
+// path.Match, which are matched against the key name and its full path,
+// e.g. `headers` or `output.*.api_*`. Matching is case-insensitive.
+func (c *C) RedactedString(patterns ...string) string {
+	content, err := c.content()
+	if err != nil {
+		return fmt.Sprintf("<config error> %v", err)
+	}
+
+	lower := make([]string, len(patterns))
+	for i, p := range patterns {
+		lower[i] = strings.ToLower(p)
+	}
+	redactValues(content, "", lower)
+
+	out, err := yaml.Marshal(content)
+	if err != nil {
+		return fmt.Sprintf("<config error> %v", err)
+	}
+	return string(out)
+}
+
+func redactValues(v interface{}, prefix string, patterns []string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			fullName := k
+			if prefix != "" {
+				fullName = prefix + "." + k
+			}
+			if redactKey(k, fullName, patterns) {
+				v[k] = redacted
+				continue
+			}
+			redactValues(elem, fullName, patterns)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			redactValues(elem, fmt.Sprintf("%v.%d", prefix, i), patterns)
+		}
+	}
+}
+
+func redactKey(name, fullName string, patterns []string) bool {
+	name, fullName = strings.ToLower(name), strings.ToLower(fullName)
+	for _, s := range redactedKeys {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, fullName); ok {
+			return true
+		}
+	}
+	return false
+}
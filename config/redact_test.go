@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactedString(t *testing.T) {
+	cfg := MustNewConfigFrom(`
+output.elasticsearch:
+  hosts: ["localhost:9200"]
+  username: elastic
+  password: changeme
+  api_key: id:secret
+  headers:
+    X-Custom: value
+ssl.key: /etc/certs/agent.key
+fleet.access_api_token: abc
+inputs:
+  - type: http
+    auth.Token: secret
+    url: http://example.com
+`)
+
+	expected := `fleet:
+  access_api_token: <redacted>
+inputs:
+- auth:
+    Token: <redacted>
+  type: http
+  url: http://example.com
+output:
+  elasticsearch:
+    api_key: <redacted>
+    headers:
+      X-Custom: value
+    hosts:
+    - localhost:9200
+    password: <redacted>
+    username: elastic
+ssl:
+  key: <redacted>
+`
+	assert.Equal(t, expected, cfg.RedactedString())
+
+	patterns := []string{"Headers", "inputs.*.url"}
+	out := cfg.RedactedString(patterns...)
+	assert.Contains(t, out, "headers: <redacted>")
+	assert.Contains(t, out, "url: <redacted>")
+	assert.Contains(t, out, "username: elastic")
+	assert.Equal(t, []string{"Headers", "inputs.*.url"}, patterns)
+}
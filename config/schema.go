@@ -0,0 +1,324 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+// SchemaVersion is the JSON Schema dialect of the generated schemas.
+const SchemaVersion = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema describing a configuration.
+type Schema struct {
+	Version              string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	Format               string             `json:"format,omitempty"`
+}
+
+// SchemaEnumer is implemented by types only accepting a fixed set of values,
+// usually checked by their Unpack or Validate methods. The values are
+// reported as enum in the generated schema.
+type SchemaEnumer interface {
+	SchemaEnum() []interface{}
+}
+
+var (
+	tDuration       = reflect.TypeOf(time.Duration(0))
+	tConfig         = reflect.TypeOf(C{})
+	tUcfgConfig     = reflect.TypeOf(ucfg.Config{})
+	tSchemaEnumer   = reflect.TypeOf((*SchemaEnumer)(nil)).Elem()
+	tStringUnpacker = reflect.TypeOf((*ucfg.StringUnpacker)(nil)).Elem()
+)
+
+// GenerateSchema generates a JSON Schema for the given unpack target, such
+// that user configurations can be validated before they are deployed.
+//
+// Property names are read from the `config` struct tags, and the `required`,
+// `nonzero`, `positive`, `min`, `max`, `range`, `port` and `oneof` validators
+// from the `validate` tags are reported as constraints. Non-zero field values
+// in v are reported as defaults, so passing the default configuration
+// documents the defaults:
+//
+//	schema, err := config.GenerateSchema(defaultConfig())
+//
+// Durations are expected as strings, like `10s`. Types implementing
+// ucfg.StringUnpacker are reported as strings, and types implementing
+// SchemaEnumer report their accepted values.
+func GenerateSchema(v interface{}) (*Schema, error) {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() {
+		return nil, fmt.Errorf("can not generate schema for %v", v)
+	}
+
+	g := schemaGenerator{visiting: map[reflect.Type]bool{}}
+	s, err := g.schemaOf(val.Type(), val)
+	if err != nil {
+		return nil, err
+	}
+	s.Version = SchemaVersion
+	return s, nil
+}
+
+type schemaGenerator struct {
+	// visiting holds the struct types currently being generated, to stop on
+	// recursive types.
+	visiting map[reflect.Type]bool
+}
+
+// schemaOf returns the schema of type t. The value v is used to report
+// defaults, and is invalid if no defaults are known.
+func (g *schemaGenerator) schemaOf(t reflect.Type, v reflect.Value) (*Schema, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if v.IsValid() {
+			v = v.Elem()
+		}
+	}
+
+	s := &Schema{}
+	if enum, ok := schemaEnum(t); ok {
+		s.Enum = enum
+	}
+
+	switch {
+	case t == tDuration:
+		s.Type = "string"
+		s.Format = "duration"
+		if v.IsValid() && !v.IsZero() {
+			s.Default = time.Duration(v.Int()).String()
+		}
+		return s, nil
+	case t == tConfig || t == tUcfgConfig:
+		s.Type = "object"
+		return s, nil
+	case reflect.PointerTo(t).Implements(tStringUnpacker):
+		s.Type = "string"
+		if v.IsValid() && !v.IsZero() {
+			if str, ok := v.Interface().(fmt.Stringer); ok {
+				s.Default = str.String()
+			}
+		}
+		return s, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.Type = "integer"
+	case reflect.Float32, reflect.Float64:
+		s.Type = "number"
+	case reflect.String:
+		s.Type = "string"
+	case reflect.Slice, reflect.Array:
+		items, err := g.schemaOf(t.Elem(), reflect.Value{})
+		if err != nil {
+			return nil, err
+		}
+		s.Type = "array"
+		s.Items = items
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %v", t.Key())
+		}
+		values, err := g.schemaOf(t.Elem(), reflect.Value{})
+		if err != nil {
+			return nil, err
+		}
+		s.Type = "object"
+		s.AdditionalProperties = values
+	case reflect.Struct:
+		if g.visiting[t] {
+			// recursive type, accept any object
+			return &Schema{Type: "object"}, nil
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		s.Type = "object"
+		s.Properties = map[string]*Schema{}
+		if err := g.addFields(s, t, v); err != nil {
+			return nil, err
+		}
+		sort.Strings(s.Required)
+		return s, nil
+	case reflect.Interface:
+		// any value is accepted
+	default:
+		return nil, fmt.Errorf("unsupported type %v", t)
+	}
+
+	if v.IsValid() && !v.IsZero() && t.Kind() != reflect.Interface {
+		s.Default = v.Interface()
+	}
+	return s, nil
+}
+
+func (g *schemaGenerator) addFields(s *Schema, t reflect.Type, v reflect.Value) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// like go-ucfg, skip unexported fields, even if embedded.
+		if !field.IsExported() {
+			continue
+		}
+
+		var fv reflect.Value
+		if v.IsValid() {
+			fv = v.Field(i)
+		}
+
+		name, opts := parseSchemaTag(field)
+		if opts.ignore {
+			continue
+		}
+		if opts.inline {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				if fv.IsValid() {
+					fv = fv.Elem()
+				}
+			}
+			if ft.Kind() != reflect.Struct {
+				return fmt.Errorf("inline field %v must be a struct", field.Name)
+			}
+			if err := g.addFields(s, ft, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		prop, err := g.schemaOf(field.Type, fv)
+		if err != nil {
+			return fmt.Errorf("field %v: %w", field.Name, err)
+		}
+		if applyValidators(prop, field.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+	return nil
+}
+
+type schemaTagOptions struct {
+	inline bool
+	ignore bool
+}
+
+func parseSchemaTag(field reflect.StructField) (string, schemaTagOptions) {
+	var opts schemaTagOptions
+
+	parts := strings.Split(field.Tag.Get("config"), ",")
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "squash", "inline":
+			opts.inline = true
+		case "ignore":
+			opts.ignore = true
+		}
+	}
+
+	name := parts[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, opts
+}
+
+// applyValidators adds the constraints of the validators in the validate tag
+// to the schema. Returns true if the field is required.
+func applyValidators(s *Schema, tag string) bool {
+	required := false
+	for _, validator := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(validator), "=")
+		switch name {
+		case "required", "nonzero":
+			// nonzero accepts missing values, but rejects empty ones
+			required = required || name == "required"
+			if s.Type == "string" {
+				one := 1
+				s.MinLength = &one
+			}
+		case "positive":
+			if s.Type == "integer" || s.Type == "number" {
+				zero := float64(0)
+				s.Minimum = &zero
+			}
+		case "min":
+			s.Minimum = schemaBound(s, param)
+		case "max":
+			s.Maximum = schemaBound(s, param)
+		case "range":
+			lo, hi, _ := strings.Cut(param, ":")
+			s.Minimum = schemaBound(s, lo)
+			s.Maximum = schemaBound(s, hi)
+		case "port":
+			s.Minimum = schemaBound(s, "1")
+			s.Maximum = schemaBound(s, "65535")
+		case "oneof":
+			if s.Type == "string" {
+				s.Enum = nil
+				for _, v := range strings.Split(param, "|") {
+					s.Enum = append(s.Enum, v)
+				}
+			}
+		}
+	}
+	return required
+}
+
+// schemaBound parses a numeric bound. Returns nil for non-numeric types or
+// invalid bounds.
+func schemaBound(s *Schema, param string) *float64 {
+	if s.Type != "integer" && s.Type != "number" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+func schemaEnum(t reflect.Type) ([]interface{}, bool) {
+	switch {
+	case t.Implements(tSchemaEnumer):
+		return reflect.Zero(t).Interface().(SchemaEnumer).SchemaEnum(), true
+	case reflect.PointerTo(t).Implements(tSchemaEnumer):
+		return reflect.New(t).Interface().(SchemaEnumer).SchemaEnum(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,133 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type schemaTestOutput struct {
+	Hosts    []string      `config:"hosts" validate:"required"`
+	Workers  int           `config:"workers" validate:"min=1,max=16"`
+	Timeout  time.Duration `config:"timeout" validate:"positive"`
+	Username string        `config:"username" validate:"nonzero"`
+	Headers  map[string]string
+}
+
+type SchemaTestCommon struct {
+	Enabled bool `config:"enabled"`
+}
+
+type schemaTestConfig struct {
+	SchemaTestCommon `config:",inline"`
+	Output           schemaTestOutput `config:"output"`
+	Policy           MergePolicy      `config:"policy"`
+	Raw              *C               `config:"raw"`
+	Any              interface{}      `config:"any"`
+	Internal         string           `config:"internal,ignore"`
+	Next             *schemaTestConfig
+	hidden           string //nolint:unused // unexported fields are not part of the schema
+}
+
+func TestGenerateSchema(t *testing.T) {
+	defaults := schemaTestConfig{
+		SchemaTestCommon: SchemaTestCommon{Enabled: true},
+		Output: schemaTestOutput{
+			Workers: 1,
+			Timeout: 90 * time.Second,
+		},
+		Policy: MergeAppend,
+	}
+
+	schema, err := GenerateSchema(&defaults)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+
+	expected := `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {
+    "enabled": {"type": "boolean", "default": true},
+    "output": {
+      "type": "object",
+      "properties": {
+        "hosts": {"type": "array", "items": {"type": "string"}},
+        "workers": {"type": "integer", "default": 1, "minimum": 1, "maximum": 16},
+        "timeout": {"type": "string", "format": "duration", "default": "1m30s"},
+        "username": {"type": "string", "minLength": 1},
+        "headers": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "required": ["hosts"]
+    },
+    "policy": {
+      "type": "string",
+      "default": "append",
+      "enum": ["default", "replace", "append", "prepend"]
+    },
+    "raw": {"type": "object"},
+    "any": {},
+    "next": {"type": "object"}
+  }
+}`
+	assert.JSONEq(t, expected, string(b))
+}
+
+func TestGenerateSchemaUnexported(t *testing.T) {
+	type inner struct {
+		Name string `config:"name"`
+	}
+	type common struct {
+		Enabled bool `config:"enabled"`
+	}
+
+	// go-ucfg does not unpack into unexported fields, even if embedded.
+	schema, err := GenerateSchema(struct {
+		inner
+		common `config:",inline"`
+		Port   int `config:"port"`
+	}{})
+	require.NoError(t, err)
+
+	b, err := json.Marshal(schema)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "type": "object",
+  "properties": {"port": {"type": "integer"}}
+}`, string(b))
+}
+
+func TestGenerateSchemaErrors(t *testing.T) {
+	_, err := GenerateSchema(nil)
+	assert.Error(t, err)
+
+	_, err = GenerateSchema(struct {
+		Ch chan int `config:"ch"`
+	}{})
+	assert.ErrorContains(t, err, "field Ch")
+
+	_, err = GenerateSchema(map[int]string{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+
+	ucfg "github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/parse"
+)
+
+// ErrSecretNotFound is returned by a SecretResolver if the referenced secret
+// does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretResolver looks up secrets referenced from a configuration.
+type SecretResolver interface {
+	// ResolveSecret returns the secret for the reference. Returns an error
+	// wrapping ErrSecretNotFound if the secret does not exist.
+	ResolveSecret(ref string) (string, error)
+}
+
+// SecretResolverFunc adapts a function to the SecretResolver interface.
+type SecretResolverFunc func(ref string) (string, error)
+
+// ResolveSecret calls f(ref).
+func (f SecretResolverFunc) ResolveSecret(ref string) (string, error) {
+	return f(ref)
+}
+
+// ResolveSecrets returns an option resolving variables with the given scheme
+// as prefix via the resolver. For example with the scheme `vault`, the value
+// `${vault.secret/data/fleet#token}` is resolved by passing
+// `secret/data/fleet#token` to the resolver.
+//
+// The option only supports a `.` as separator of the scheme, as `:`
+// separates the default value in variable expansions. Register the resolver
+// with RegisterSecretResolver to reference secrets as
+// `${vault:secret/data/fleet#token}`. Default values can be used to handle
+// missing secrets, e.g. `${secret.fleet.token:}`.
+//
+// Secrets failing to resolve leave the variable unresolved, such that
+// unpacking fails unless a default value is given.
+//
+// Secrets are resolved when unpacking the configuration, so they are never
+// stored in the configuration itself:
+//
+//	cfg.UnpackWithOpts(&settings, ResolveSecrets("secret", resolver))
+func ResolveSecrets(scheme string, r SecretResolver) ucfg.Option {
+	prefix := scheme + "."
+	return ucfg.Resolve(func(name string) (string, parse.Config, error) {
+		ref, ok := strings.CutPrefix(name, prefix)
+		if !ok || ref == "" {
+			return "", parse.NoopConfig, ucfg.ErrMissing
+		}
+
+		secret, err := r.ResolveSecret(ref)
+		if err != nil {
+			// Missing secrets are passed to the remaining resolvers.
+			if errors.Is(err, ErrSecretNotFound) {
+				return "", parse.NoopConfig, ucfg.ErrMissing
+			}
+			return "", parse.NoopConfig, err
+		}
+
+		// Secrets are never parsed, so they can contain any character.
+		return secret, parse.NoopConfig, nil
+	})
+}
+
+var (
+	secretResolversMu sync.RWMutex
+	secretResolvers   = map[string]SecretResolver{}
+	secretRefPattern  *regexp.Regexp
+)
+
+// RegisterSecretResolver registers the resolver for the scheme globally.
+// Secrets referenced as `${scheme:ref}` or `${scheme.ref}` are resolved via
+// the resolver on every Unpack, e.g. `${secret:fleet.token}` passes
+// `fleet.token` to the resolver of the `secret` scheme. A default value
+// follows the reference, e.g. `${secret:fleet.token:}`.
+//
+// The `${scheme:ref}` form is only recognized in configurations created
+// after the scheme has been registered. Registering a scheme again replaces
+// its resolver.
+func RegisterSecretResolver(scheme string, r SecretResolver) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	secretResolvers[scheme] = r
+	secretRefPattern = compileSecretRefPattern()
+}
+
+func unregisterSecretResolver(scheme string) {
+	secretResolversMu.Lock()
+	defer secretResolversMu.Unlock()
+	delete(secretResolvers, scheme)
+	secretRefPattern = compileSecretRefPattern()
+}
+
+func compileSecretRefPattern() *regexp.Regexp {
+	if len(secretResolvers) == 0 {
+		return nil
+	}
+	schemes := make([]string, 0, len(secretResolvers))
+	for scheme := range secretResolvers {
+		schemes = append(schemes, regexp.QuoteMeta(scheme))
+	}
+	return regexp.MustCompile(`\$\{(` + strings.Join(schemes, "|") + `):`)
+}
+
+// withSecretResolvers returns opts followed by the options resolving the
+// registered secret schemes.
+func withSecretResolvers(opts []ucfg.Option) []ucfg.Option {
+	secretResolversMu.RLock()
+	defer secretResolversMu.RUnlock()
+	if len(secretResolvers) == 0 {
+		return opts
+	}
+	o := make([]ucfg.Option, 0, len(opts)+len(secretResolvers))
+	o = append(o, opts...)
+	for scheme, r := range secretResolvers {
+		o = append(o, ResolveSecrets(scheme, r))
+	}
+	return o
+}
+
+// normalizeSecretRefs rewrites the secret references of the registered
+// schemes in v from `${scheme:ref}` to `${scheme.ref}`, before the variables
+// are parsed. Otherwise the reference would be parsed as default value of a
+// variable named scheme. Strings in maps and slices are rewritten too, the
+// input is not modified.
+func normalizeSecretRefs(v interface{}) interface{} {
+	secretResolversMu.RLock()
+	re := secretRefPattern
+	secretResolversMu.RUnlock()
+	if re == nil {
+		return v
+	}
+	return rewriteSecretRefs(re, v)
+}
+
+func rewriteSecretRefs(re *regexp.Regexp, v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return re.ReplaceAllString(v, "$${$1.")
+	case []byte:
+		return re.ReplaceAll(v, []byte("$${$1."))
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = rewriteSecretRefs(re, e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = rewriteSecretRefs(re, e)
+		}
+		return a
+	case []string:
+		a := make([]string, len(v))
+		for i, e := range v {
+			a[i] = re.ReplaceAllString(e, "$${$1.")
+		}
+		return a
+	default:
+		return v
+	}
+}
@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveSecrets(t *testing.T) {
+	secrets := map[string]string{
+		"fleet.token":         "s3cr3t:${not.expanded}",
+		"secret/data/app#key": "api-key",
+	}
+	lookup := func(ref string) (string, error) {
+		if v, ok := secrets[ref]; ok {
+			return v, nil
+		}
+		return "", ErrSecretNotFound
+	}
+	failing := func(ref string) (string, error) {
+		return "", errors.New("connection refused")
+	}
+
+	cfg := MustNewConfigFrom(map[string]interface{}{
+		"token":   "${secret.fleet.token}",
+		"api_key": "Bearer ${vault.secret/data/app#key}",
+		"missing": "${secret.unknown:default}",
+	})
+
+	var settings struct {
+		Token   string `config:"token"`
+		APIKey  string `config:"api_key"`
+		Missing string `config:"missing"`
+	}
+	err := cfg.UnpackWithOpts(&settings,
+		ResolveSecrets("secret", SecretResolverFunc(lookup)),
+		ResolveSecrets("vault", SecretResolverFunc(lookup)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t:${not.expanded}", settings.Token)
+	assert.Equal(t, "Bearer api-key", settings.APIKey)
+	assert.Equal(t, "default", settings.Missing)
+
+	// secrets are not resolved without the option
+	var unresolved struct {
+		Token string `config:"token"`
+	}
+	assert.Error(t, cfg.Unpack(&unresolved))
+
+	var failed struct {
+		Token string `config:"token"`
+	}
+	err = cfg.UnpackWithOpts(&failed, ResolveSecrets("secret", SecretResolverFunc(failing)))
+	assert.Error(t, err)
+}
+
+func TestRegisterSecretResolver(t *testing.T) {
+	secrets := map[string]string{
+		"fleet.token":         "s3cr3t",
+		"secret/data/app#key": "api-key",
+	}
+	lookup := SecretResolverFunc(func(ref string) (string, error) {
+		if v, ok := secrets[ref]; ok {
+			return v, nil
+		}
+		return "", ErrSecretNotFound
+	})
+	RegisterSecretResolver("secret", lookup)
+	RegisterSecretResolver("vault", lookup)
+	t.Cleanup(func() {
+		unregisterSecretResolver("secret")
+		unregisterSecretResolver("vault")
+	})
+
+	type settings struct {
+		Token   string `config:"token"`
+		APIKey  string `config:"api_key"`
+		Missing string `config:"missing"`
+		Home    string `config:"home"`
+	}
+	expected := settings{
+		Token:   "s3cr3t",
+		APIKey:  "Bearer api-key",
+		Missing: "default",
+		Home:    "/home/default",
+	}
+
+	yamlCfg, err := NewConfigWithYAML([]byte(`
+token: ${secret:fleet.token}
+api_key: Bearer ${vault:secret/data/app#key}
+missing: ${secret:unknown:default}
+home: ${HOME_NOT_SET_IN_TEST:/home/default}
+`), "config.yml")
+	require.NoError(t, err)
+
+	mapCfg := MustNewConfigFrom(map[string]interface{}{
+		"token":   "${secret:fleet.token}",
+		"api_key": "Bearer ${vault.secret/data/app#key}",
+		"missing": "${secret:unknown:default}",
+		"home":    "${HOME_NOT_SET_IN_TEST:/home/default}",
+	})
+
+	for name, cfg := range map[string]*C{"yaml": yamlCfg, "map": mapCfg} {
+		t.Run(name, func(t *testing.T) {
+			var s settings
+			require.NoError(t, cfg.Unpack(&s))
+			assert.Equal(t, expected, s)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+// UnpackError lists all invalid settings found while unpacking a
+// configuration. Errors include the full path of the setting and, if known,
+// the source and location the setting has been read from.
+type UnpackError struct {
+	Errors []error
+}
+
+func (e *UnpackError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %v", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the invalid settings.
+func (e *UnpackError) Unwrap() []error {
+	return e.Errors
+}
+
+func (c *C) unpack(to interface{}, opts []ucfg.Option) error {
+	opts = withSecretResolvers(opts)
+
+	// ucfg stops at the first error. Keep a copy of the defaults, to check
+	// the remaining settings if unpacking fails.
+	var defaults reflect.Value
+	if v := reflect.ValueOf(to); v.Kind() == reflect.Ptr && !v.IsNil() && v.Elem().Kind() == reflect.Struct {
+		defaults = reflect.New(v.Elem().Type()).Elem()
+		defaults.Set(v.Elem())
+	}
+
+	err := c.access().Unpack(to, opts...)
+	if err == nil {
+		return nil
+	}
+	if !defaults.IsValid() {
+		return c.withOrigin(err)
+	}
+
+	errs := collectUnpackErrors(c.access(), defaults, opts)
+	if len(errs) <= 1 {
+		return c.withOrigin(err)
+	}
+	for i, err := range errs {
+		errs[i] = c.withOrigin(err)
+	}
+	return &UnpackError{Errors: errs}
+}
+
+// collectUnpackErrors unpacks each field of the struct v separately,
+// returning the errors of all fields.
+//
+// Variables not found in the configuration are not looked up again: the
+// fields are checked with placeholder values first, and only the fields
+// failing that check are unpacked with the resolvers in opts, so secret
+// stores are queried only for the settings being reported.
+func collectUnpackErrors(cfg *ucfg.Config, v reflect.Value, opts []ucfg.Option) []error {
+	noResolve := append(opts[:len(opts):len(opts)], ucfg.ResolveNOOP)
+	return collectFieldErrors(cfg, v, opts, noResolve)
+}
+
+func collectFieldErrors(cfg *ucfg.Config, v reflect.Value, opts, noResolve []ucfg.Option) []error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, tagOpts := parseSchemaTag(field)
+		if tagOpts.ignore {
+			continue
+		}
+		if tagOpts.inline {
+			if field.Type.Kind() == reflect.Struct {
+				errs = append(errs, collectFieldErrors(cfg, v.Field(i), opts, noResolve)...)
+			}
+			continue
+		}
+
+		if isNestedStruct(field.Type) {
+			if child, err := cfg.Child(name, -1, noResolve...); err == nil {
+				if nested := collectFieldErrors(child, v.Field(i), opts, noResolve); len(nested) > 0 {
+					errs = append(errs, nested...)
+					continue
+				}
+			}
+		}
+
+		// unpack into a struct holding only the field, with the field tags
+		// applied for validation
+		singleType := reflect.StructOf([]reflect.StructField{{
+			Name: "Value",
+			Type: field.Type,
+			Tag:  singleFieldTag(field.Tag, name),
+		}})
+		newSingle := func() interface{} {
+			single := reflect.New(singleType)
+			if fv := v.Field(i); fv.CanInterface() {
+				single.Elem().Field(0).Set(fv)
+			}
+			return single.Interface()
+		}
+		if err := cfg.Unpack(newSingle(), noResolve...); err == nil {
+			continue
+		}
+		// the placeholders might be the cause, check the resolved values
+		if err := cfg.Unpack(newSingle(), opts...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// singleFieldTag returns the tags of a field with the config tag naming the
+// setting explicitly, as the field is unpacked under another name.
+func singleFieldTag(tag reflect.StructTag, name string) reflect.StructTag {
+	var rest []string
+	value := name
+	for tag != "" {
+		key, quoted, ok := nextTag(&tag)
+		if !ok {
+			break
+		}
+		if key == "config" {
+			if unquoted, err := strconv.Unquote(quoted); err == nil {
+				if _, opts, found := strings.Cut(unquoted, ","); found {
+					value += "," + opts
+				}
+			}
+			continue
+		}
+		rest = append(rest, key+":"+quoted)
+	}
+	return reflect.StructTag(strings.Join(append([]string{"config:" + strconv.Quote(value)}, rest...), " "))
+}
+
+// nextTag removes the first key:"value" pair from tag, returning the key and
+// the quoted value.
+func nextTag(tag *reflect.StructTag) (key, quoted string, ok bool) {
+	s := strings.TrimLeft(string(*tag), " ")
+	i := strings.Index(s, ":\"")
+	if i <= 0 {
+		*tag = ""
+		return "", "", false
+	}
+	key = s[:i]
+	j := i + 2
+	for j < len(s) && s[j] != '"' {
+		if s[j] == '\\' {
+			j++
+		}
+		j++
+	}
+	if j >= len(s) {
+		*tag = ""
+		return "", "", false
+	}
+	*tag = reflect.StructTag(s[j+1:])
+	return key, s[i+1 : j+1], true
+}
+
+// isNestedStruct returns true for struct types unpacked field by field.
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == tConfig || t == tUcfgConfig {
+		return false
+	}
+	if _, custom := reflect.PointerTo(t).MethodByName("Unpack"); custom {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ucfg "github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/parse"
+)
+
+type unpackTestOutput struct {
+	Hosts   []string      `config:"hosts" validate:"required"`
+	Workers int           `config:"workers" validate:"min=1"`
+	Timeout time.Duration `config:"timeout"`
+}
+
+type unpackTestQueue struct {
+	Size int `config:"size"`
+}
+
+func (q *unpackTestQueue) Validate() error {
+	if q.Size%2 != 0 {
+		return errors.New("size must be even")
+	}
+	return nil
+}
+
+type unpackTestConfig struct {
+	Name   string           `config:"name" validate:"required"`
+	Output unpackTestOutput `config:"output"`
+	Queue  unpackTestQueue  `config:"queue"`
+	Level  string           `config:"logging.level"`
+}
+
+func TestUnpackCollectsAllErrors(t *testing.T) {
+	cfg, err := NewConfigWithYAML([]byte(`
+output:
+  workers: 0
+  timeout: soon
+queue.size: 3
+`), "agent.yml")
+	require.NoError(t, err)
+
+	settings := unpackTestConfig{
+		Output: unpackTestOutput{Hosts: []string{"localhost:9200"}},
+	}
+	err = cfg.Unpack(&settings)
+	require.Error(t, err)
+
+	var unpackErr *UnpackError
+	require.ErrorAs(t, err, &unpackErr)
+	require.Len(t, unpackErr.Errors, 4)
+
+	assert.Contains(t, unpackErr.Errors[0].Error(), "'name'")
+	assert.Contains(t, unpackErr.Errors[1].Error(), "'output.workers'")
+	assert.Contains(t, unpackErr.Errors[2].Error(), "'output.timeout'")
+	assert.Contains(t, unpackErr.Errors[3].Error(), "size must be even")
+	assert.Contains(t, unpackErr.Errors[3].Error(), "'queue'")
+	for _, err := range unpackErr.Errors[1:] {
+		assert.Contains(t, err.Error(), "source:'agent.yml'")
+	}
+
+	// defaults are not reported as missing
+	assert.NotContains(t, err.Error(), "output.hosts")
+
+	var ucfgErr ucfg.Error
+	assert.ErrorAs(t, err, &ucfgErr)
+}
+
+func TestUnpackSingleError(t *testing.T) {
+	cfg := MustNewConfigFrom(`{name: agent, output.workers: 1}`)
+
+	var settings unpackTestConfig
+	err := cfg.Unpack(&settings)
+	require.Error(t, err)
+
+	// a single error is returned as is
+	var unpackErr *UnpackError
+	assert.False(t, errors.As(err, &unpackErr))
+	assert.Contains(t, err.Error(), "output.hosts")
+}
+
+func TestUnpackErrorsDoNotResolveAgain(t *testing.T) {
+	cfg := MustNewConfigFrom(`{name: "${agent.name}", output.workers: "${agent.workers}", output.timeout: soon, queue.size: 3}`)
+
+	lookups := map[string]int{}
+	resolver := ucfg.Resolve(func(name string) (string, parse.Config, error) {
+		lookups[name]++
+		switch name {
+		case "agent.name":
+			return "agent", parse.DefaultConfig, nil
+		case "agent.workers":
+			return "0", parse.DefaultConfig, nil
+		}
+		return "", parse.DefaultConfig, ucfg.ErrMissing
+	})
+
+	settings := unpackTestConfig{
+		Output: unpackTestOutput{Hosts: []string{"localhost:9200"}},
+	}
+	err := cfg.UnpackWithOpts(&settings, resolver)
+
+	var unpackErr *UnpackError
+	require.ErrorAs(t, err, &unpackErr)
+	require.Len(t, unpackErr.Errors, 3)
+	assert.Contains(t, unpackErr.Errors[0].Error(), "'output.workers'")
+	assert.Contains(t, unpackErr.Errors[1].Error(), "'output.timeout'")
+	assert.Contains(t, unpackErr.Errors[2].Error(), "size must be even")
+
+	// valid settings are not resolved again, invalid ones once more at most
+	assert.Equal(t, 1, lookups["agent.name"])
+	assert.LessOrEqual(t, lookups["agent.workers"], 2)
+}
+
+type unpackTestUntagged struct {
+	Name    string `validate:"required"`
+	Workers int    `validate:"min=1"`
+	Level   string `config:",ignore"`
+	Enabled bool
+}
+
+func TestUnpackErrorsOfUntaggedFields(t *testing.T) {
+	cfg := MustNewConfigFrom(`{workers: 0, enabled: maybe}`)
+
+	var settings unpackTestUntagged
+	err := cfg.Unpack(&settings)
+
+	var unpackErr *UnpackError
+	require.ErrorAs(t, err, &unpackErr)
+	require.Len(t, unpackErr.Errors, 3)
+	assert.Contains(t, unpackErr.Errors[0].Error(), "'name'")
+	assert.Contains(t, unpackErr.Errors[1].Error(), "'workers'")
+	assert.Contains(t, unpackErr.Errors[2].Error(), "'enabled'")
+}
+
+func TestSingleFieldTag(t *testing.T) {
+	assert.Equal(t, reflect.StructTag(`config:"name"`), singleFieldTag(``, "name"))
+	assert.Equal(t, reflect.StructTag(`config:"name" validate:"required"`), singleFieldTag(`validate:"required"`, "name"))
+	assert.Equal(t, reflect.StructTag(`config:"other,replace" validate:"min=1"`), singleFieldTag(`config:"other,replace" validate:"min=1"`, "other"))
+	assert.Equal(t, reflect.StructTag(`config:"name,replace" json:"a,omitempty"`), singleFieldTag(`json:"a,omitempty" config:",replace"`, "name"))
+}
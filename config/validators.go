@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+// In addition to the validators provided by ucfg (`required`, `nonzero`,
+// `positive`, `min` and `max`, the latter accepting durations like
+// `min=1s`), the config package registers the following validators for the
+// `validate` struct tag:
+//
+//   - `range=MIN:MAX` requires a number or duration between MIN and MAX,
+//     inclusive, like `range=1:100` or `range=100ms:1m`. Either bound can be
+//     omitted.
+//   - `port` requires a valid network port number, between 1 and 65535.
+//   - `oneof=A|B|C` requires a string to be one of the given values.
+func init() {
+	registerValidator("range", validateRange)
+	registerValidator("port", validatePort)
+	registerValidator("oneof", validateOneOf)
+}
+
+func registerValidator(name string, cb ucfg.ValidatorCallback) {
+	// Validators are global, ignore validators registered by other packages.
+	if err := ucfg.RegisterValidator(name, cb); err != nil && !errors.Is(err, ucfg.ErrDuplicateValidator) {
+		panic(err)
+	}
+}
+
+func validateRange(v interface{}, param string) error {
+	if v == nil {
+		return nil
+	}
+	lo, hi, ok := strings.Cut(param, ":")
+	if !ok {
+		return fmt.Errorf("invalid range '%v', expected MIN:MAX", param)
+	}
+
+	if d, ok := v.(time.Duration); ok {
+		if lo != "" {
+			min, err := time.ParseDuration(lo)
+			if err != nil {
+				return err
+			}
+			if d < min {
+				return fmt.Errorf("requires duration in range %v", param)
+			}
+		}
+		if hi != "" {
+			max, err := time.ParseDuration(hi)
+			if err != nil {
+				return err
+			}
+			if d > max {
+				return fmt.Errorf("requires duration in range %v", param)
+			}
+		}
+		return nil
+	}
+
+	f, ok := toFloat(v)
+	if !ok {
+		return nil
+	}
+	if lo != "" {
+		min, err := strconv.ParseFloat(lo, 64)
+		if err != nil {
+			return err
+		}
+		if f < min {
+			return fmt.Errorf("requires value in range %v", param)
+		}
+	}
+	if hi != "" {
+		max, err := strconv.ParseFloat(hi, 64)
+		if err != nil {
+			return err
+		}
+		if f > max {
+			return fmt.Errorf("requires value in range %v", param)
+		}
+	}
+	return nil
+}
+
+func validatePort(v interface{}, _ string) error {
+	if v == nil {
+		return nil
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return nil
+	}
+	if f < 1 || f > 65535 {
+		return fmt.Errorf("requires port number between 1 and 65535, got %v", v)
+	}
+	return nil
+}
+
+func validateOneOf(v interface{}, param string) error {
+	if v == nil {
+		return nil
+	}
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.String {
+		return nil
+	}
+
+	allowed := strings.Split(param, "|")
+	for _, a := range allowed {
+		if val.String() == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("requires one of %v, got '%v'", strings.Join(allowed, ", "), val.String())
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validatorsTestConfig struct {
+	Port     int           `config:"port" validate:"port"`
+	Workers  int           `config:"workers" validate:"positive,nonzero"`
+	Ratio    float64       `config:"ratio" validate:"range=0:1"`
+	Backoff  time.Duration `config:"backoff" validate:"range=100ms:1m"`
+	Timeout  time.Duration `config:"timeout" validate:"min=1s,max=1h"`
+	Mode     string        `config:"mode" validate:"oneof=full|strict|none"`
+	Priority int           `config:"priority" validate:"range=:10"`
+}
+
+func TestValidators(t *testing.T) {
+	valid := map[string]interface{}{
+		"port":     9200,
+		"workers":  2,
+		"ratio":    0.5,
+		"backoff":  "1s",
+		"timeout":  "30s",
+		"mode":     "strict",
+		"priority": -5,
+	}
+
+	var settings validatorsTestConfig
+	require.NoError(t, MustNewConfigFrom(valid).Unpack(&settings))
+	assert.Equal(t, validatorsTestConfig{
+		Port:     9200,
+		Workers:  2,
+		Ratio:    0.5,
+		Backoff:  time.Second,
+		Timeout:  30 * time.Second,
+		Mode:     "strict",
+		Priority: -5,
+	}, settings)
+
+	invalid := map[string]struct {
+		value interface{}
+		err   string
+	}{
+		"port":     {0, "requires port number between 1 and 65535"},
+		"workers":  {0, "zero value"},
+		"ratio":    {1.5, "requires value in range 0:1"},
+		"backoff":  {"10ms", "requires duration in range 100ms:1m"},
+		"timeout":  {"2h", "requires duration <= 1h"},
+		"mode":     {"partial", "requires one of full, strict, none, got 'partial'"},
+		"priority": {11, "requires value in range :10"},
+	}
+	for field, test := range invalid {
+		t.Run(field, func(t *testing.T) {
+			var settings validatorsTestConfig
+			err := MustNewConfigFrom(map[string]interface{}{field: test.value}).Unpack(&settings)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+			assert.Contains(t, err.Error(), "'"+field+"'")
+		})
+	}
+}
+
+func TestValidatorsSchema(t *testing.T) {
+	schema, err := GenerateSchema(validatorsTestConfig{})
+	require.NoError(t, err)
+
+	port := schema.Properties["port"]
+	require.NotNil(t, port.Minimum)
+	require.NotNil(t, port.Maximum)
+	assert.Equal(t, 1.0, *port.Minimum)
+	assert.Equal(t, 65535.0, *port.Maximum)
+
+	ratio := schema.Properties["ratio"]
+	assert.Equal(t, 0.0, *ratio.Minimum)
+	assert.Equal(t, 1.0, *ratio.Maximum)
+
+	assert.Nil(t, schema.Properties["priority"].Minimum)
+	assert.Equal(t, []interface{}{"full", "strict", "none"}, schema.Properties["mode"].Enum)
+}
@@ -0,0 +1,163 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	ucfg "github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/parse"
+)
+
+// VariableError reports a setting whose variables can not be expanded.
+type VariableError struct {
+	// Path is the full path of the setting.
+	Path string
+
+	// Variables lists the variables that could not be resolved.
+	Variables []string
+
+	// Err is the expansion error. For variables using the `${VAR:?message}`
+	// syntax, it holds the message.
+	Err error
+}
+
+func (e *VariableError) Error() string {
+	if len(e.Variables) > 0 && errors.Is(e.Err, ucfg.ErrMissing) {
+		return fmt.Sprintf("%v: missing variable %v", e.Path, strings.Join(e.Variables, ", "))
+	}
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+func (e *VariableError) Unwrap() error {
+	return e.Err
+}
+
+// VariablesError lists all settings whose variables can not be expanded.
+type VariablesError []*VariableError
+
+func (e VariablesError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("failed to expand variables of %d setting(s): %v", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the settings.
+func (e VariablesError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// CheckVariables expands all variables in the configuration and returns a
+// VariablesError listing every setting that can not be expanded, sorted by
+// path. It is meant to be called right after loading a configuration, so
+// users get all missing variables reported at once instead of one at a time
+// when the configuration is unpacked.
+//
+// Variables support the `${VAR:default}` syntax to use a default value if
+// VAR is not set, and `${VAR:?message}` to fail with the given message.
+// Additional options, like resolvers for secrets, are used when expanding
+// variables.
+func (c *C) CheckVariables(opts ...ucfg.Option) error {
+	// Resolvers are tried in reverse order, so the recorder added first only
+	// sees the variables no other resolver can resolve.
+	rec := &missingVariables{}
+	o := append([]ucfg.Option{ucfg.Resolve(rec.resolve)}, withGlobalConfigOpts(opts)...)
+
+	rec.root = c.access()
+
+	var errs VariablesError
+	checkVariables(c.access(), "", o, rec, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+// missingVariables records the names of unresolved variables.
+type missingVariables struct {
+	root  *ucfg.Config
+	names []string
+}
+
+func (m *missingVariables) resolve(name string) (string, parse.Config, error) {
+	// References to other settings failing to expand are reported for
+	// the referenced setting.
+	if has, _ := m.root.Has(name, -1, ucfg.PathSep(".")); !has && !slices.Contains(m.names, name) {
+		m.names = append(m.names, name)
+	}
+	return "", parse.DefaultConfig, ucfg.ErrMissing
+}
+
+func checkVariables(cfg *ucfg.Config, prefix string, opts []ucfg.Option, rec *missingVariables, errs *VariablesError) {
+	check := func(name string, idx int, path string) {
+		if child, err := cfg.Child(name, idx, opts...); err == nil {
+			checkVariables(child, path, opts, rec, errs)
+			return
+		}
+
+		rec.names = nil
+		if _, err := cfg.String(name, idx, opts...); err != nil {
+			*errs = append(*errs, &VariableError{
+				Path:      path,
+				Variables: rec.names,
+				Err:       variableErrReason(err),
+			})
+		}
+	}
+
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+
+	if cfg.IsArray() {
+		n, _ := cfg.CountField("")
+		for i := 0; i < n; i++ {
+			check("", i, join(strconv.Itoa(i)))
+		}
+		return
+	}
+	for _, name := range cfg.GetFields() {
+		check(name, -1, join(name))
+	}
+}
+
+// variableErrReason strips the ucfg context from expansion errors, as the
+// path is reported by VariableError.
+func variableErrReason(err error) error {
+	var ucfgErr ucfg.Error
+	if errors.As(err, &ucfgErr) && ucfgErr.Reason() != nil {
+		return ucfgErr.Reason()
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	ucfg "github.com/elastic/go-ucfg"
+)
+
+func TestCheckVariables(t *testing.T) {
+	t.Setenv("CHECK_VARIABLES_SET", "value")
+
+	cfg := MustNewConfigFrom(`
+set: ${CHECK_VARIABLES_SET}
+default: ${CHECK_VARIABLES_UNSET:fallback}
+required: ${CHECK_VARIABLES_TOKEN:?the enrollment token must be set}
+hosts:
+  - ${CHECK_VARIABLES_HOST}
+  - localhost
+nested.ref: ${missing}
+`)
+
+	err := cfg.CheckVariables()
+	require.Error(t, err)
+
+	var errs VariablesError
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 3)
+
+	assert.Equal(t, "hosts.0", errs[0].Path)
+	assert.Equal(t, []string{"CHECK_VARIABLES_HOST"}, errs[0].Variables)
+	assert.ErrorIs(t, errs[0], ucfg.ErrMissing)
+
+	assert.Equal(t, "nested.ref", errs[1].Path)
+	assert.Equal(t, []string{"missing"}, errs[1].Variables)
+
+	assert.Equal(t, "required", errs[2].Path)
+	assert.EqualError(t, errs[2], "required: the enrollment token must be set")
+
+	assert.EqualError(t, err, "failed to expand variables of 3 setting(s): "+
+		"hosts.0: missing variable CHECK_VARIABLES_HOST; "+
+		"nested.ref: missing variable missing; "+
+		"required: the enrollment token must be set")
+}
+
+func TestCheckVariablesResolved(t *testing.T) {
+	cfg := MustNewConfigFrom(`
+a: ${b}
+b: value
+c: ${secret.token}
+`)
+	assert.Error(t, cfg.CheckVariables())
+
+	resolver := SecretResolverFunc(func(string) (string, error) { return "s3cr3t", nil })
+	assert.NoError(t, cfg.CheckVariables(ResolveSecrets("secret", resolver)))
+}
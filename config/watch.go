@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/filewatcher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// watchPeriod is the interval the watched file is checked for changes.
+var watchPeriod = time.Second
+
+// Watch loads the configuration file at path into a value of type T and
+// delivers it on the returned channel, followed by a new value every time the
+// file changes. The format is selected by the file extension, as in ReadFile.
+//
+// Changes are debounced: the file is only reloaded once its contents have
+// been stable for one check interval, so partially written files are not
+// read. Configurations failing to unpack or failing validate are logged and
+// skipped, so only valid configurations are delivered. validate may be nil.
+//
+// Returns an error if the initial configuration is invalid. The channel is
+// closed once ctx is done.
+func Watch[T any](ctx context.Context, path string, validate func(T) error) (<-chan T, error) {
+	w := configWatcher[T]{
+		path:     path,
+		validate: validate,
+		files:    filewatcher.New(path),
+		logger:   logp.NewLogger("config"),
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	initial, err := w.load(contents)
+	if err != nil {
+		return nil, err
+	}
+	w.lastHash = sha256.Sum256(contents)
+	_, _, _ = w.files.Scan()
+
+	ch := make(chan T, 1)
+	ch <- initial
+	go w.run(ctx, ch)
+	return ch, nil
+}
+
+type configWatcher[T any] struct {
+	path     string
+	validate func(T) error
+	files    *filewatcher.FileWatcher
+	logger   *logp.Logger
+
+	// lastHash is the hash of the contents last loaded, valid or not.
+	lastHash [sha256.Size]byte
+}
+
+func (w *configWatcher[T]) run(ctx context.Context, ch chan<- T) {
+	defer close(ch)
+
+	ticker := time.NewTicker(watchPeriod)
+	defer ticker.Stop()
+
+	// pending holds the contents of a change seen in the last check, to be
+	// loaded if the contents did not change in the meantime.
+	var pending []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, changed, _ := w.files.Scan(); !changed && pending == nil {
+			continue
+		}
+
+		contents, err := os.ReadFile(w.path)
+		if err != nil {
+			w.logger.Errorf("Failed to read config file %v: %v", w.path, err)
+			pending = nil
+			continue
+		}
+		hash := sha256.Sum256(contents)
+		if hash == w.lastHash {
+			pending = nil
+			continue
+		}
+		if pending == nil || !bytes.Equal(pending, contents) {
+			pending = contents
+			continue
+		}
+		pending = nil
+		w.lastHash = hash
+
+		cfg, err := w.load(contents)
+		if err != nil {
+			w.logger.Errorf("Ignoring invalid configuration: %v", err)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case ch <- cfg:
+		}
+	}
+}
+
+func (w *configWatcher[T]) load(contents []byte) (T, error) {
+	var settings T
+	cfg, err := newConfigFromFile(w.path, contents)
+	if err != nil {
+		return settings, err
+	}
+	if err := cfg.Unpack(&settings); err != nil {
+		return settings, fmt.Errorf("failed to unpack config file %v: %w", w.path, err)
+	}
+	if w.validate != nil {
+		if err := w.validate(settings); err != nil {
+			return settings, fmt.Errorf("invalid config file %v: %w", w.path, err)
+		}
+	}
+	return settings, nil
+}
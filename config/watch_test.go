@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type watchTestConfig struct {
+	Level   string `config:"level"`
+	Workers int    `config:"workers"`
+}
+
+func TestWatch(t *testing.T) {
+	defer func(d time.Duration) { watchPeriod = d }(watchPeriod)
+	watchPeriod = 10 * time.Millisecond
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(contents string) {
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	}
+	receive := func(ch <-chan watchTestConfig) watchTestConfig {
+		select {
+		case cfg := <-ch:
+			return cfg
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for config")
+			return watchTestConfig{}
+		}
+	}
+
+	validate := func(c watchTestConfig) error {
+		if c.Workers < 1 {
+			return errors.New("at least one worker required")
+		}
+		return nil
+	}
+
+	write("level: info\nworkers: 1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := Watch(ctx, path, validate)
+	require.NoError(t, err)
+	assert.Equal(t, watchTestConfig{Level: "info", Workers: 1}, receive(ch))
+
+	// invalid configurations are skipped
+	write("level: debug\nworkers: 0")
+	write("level: [")
+	write("level: warning\nworkers: 2")
+	assert.Equal(t, watchTestConfig{Level: "warning", Workers: 2}, receive(ch))
+
+	// the channel is closed once the context is done
+	cancel()
+	for ok := true; ok; {
+		_, ok = <-ch
+	}
+}
+
+func TestWatchInvalidInitialConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := Watch[watchTestConfig](context.Background(), filepath.Join(dir, "missing.yml"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte("workers: many"), 0o600))
+	_, err = Watch[watchTestConfig](context.Background(), path, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-ucfg/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// YAMLDocument is a YAML configuration file that keeps comments and key
+// order when being modified and written back, so tools can edit user
+// configuration files without destroying their annotations. Blank lines and
+// indentation are not preserved: documents are always written indented by
+// two spaces.
+//
+// Settings are addressed by paths joining names with `.`, and array elements
+// by their index, like `inputs.0.type`. Dotted keys, like
+// `output.elasticsearch.hosts: [...]`, are supported.
+type YAMLDocument struct {
+	doc yamlv3.Node
+}
+
+// ParseYAMLDocument parses a YAML document. An empty or null document, or a
+// document consisting of comments only, results in an empty mapping keeping
+// the comments.
+func ParseYAMLDocument(in []byte) (*YAMLDocument, error) {
+	d := &YAMLDocument{}
+	if err := yamlv3.Unmarshal(in, &d.doc); err != nil {
+		return nil, err
+	}
+
+	if d.doc.Kind == 0 {
+		// The parser drops the comments of documents without content, the
+		// input consists of comments and blank lines only.
+		lines := strings.Split(strings.TrimSpace(string(in)), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimSpace(line)
+		}
+		d.doc = yamlv3.Node{
+			Kind: yamlv3.DocumentNode,
+			Content: []*yamlv3.Node{{
+				Kind:        yamlv3.MappingNode,
+				Tag:         "!!map",
+				HeadComment: strings.Join(lines, "\n"),
+			}},
+		}
+	}
+	if root := d.root(); root.Kind == yamlv3.ScalarNode && root.Tag == "!!null" {
+		d.doc.Content[0] = &yamlv3.Node{
+			Kind:        yamlv3.MappingNode,
+			Tag:         "!!map",
+			HeadComment: joinComments(root.HeadComment, root.LineComment),
+			FootComment: root.FootComment,
+		}
+	}
+	return d, nil
+}
+
+// joinComments joins the non-empty comments by newlines.
+func joinComments(comments ...string) string {
+	var parts []string
+	for _, c := range comments {
+		if c != "" {
+			parts = append(parts, c)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Bytes returns the YAML document, indented by two spaces.
+func (d *YAMLDocument) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&d.doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Config returns the document as configuration. If source is set, the
+// origins of the settings are their positions in the parsed document,
+// settings added afterwards have no origin.
+func (d *YAMLDocument) Config(source string) (*C, error) {
+	b, err := d.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	c, err := yaml.NewConfig(normalizeSecretRefs(b).([]byte), sourceConfigOpts(source)...)
+	if err != nil {
+		return fromConfig(c), err
+	}
+	if source != "" {
+		storeOrigins(c, nodeOrigins(&d.doc, source))
+	}
+	return fromConfig(c), nil
+}
+
+// Get decodes the setting at path into to. Returns false if the setting
+// does not exist.
+func (d *YAMLDocument) Get(path string, to interface{}) (bool, error) {
+	n, rest := d.find(path)
+	if n == nil || len(rest) > 0 {
+		return false, nil
+	}
+	return true, n.Decode(to)
+}
+
+// Set sets the setting at path to value, creating missing parents. When
+// replacing a value, the comments attached to it are kept.
+func (d *YAMLDocument) Set(path string, value interface{}) error {
+	var node yamlv3.Node
+	if err := node.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode value of %v: %w", path, err)
+	}
+
+	parent, rest := d.find(path)
+	if len(rest) == 0 {
+		node.HeadComment = parent.HeadComment
+		node.LineComment = parent.LineComment
+		node.FootComment = parent.FootComment
+		*parent = node
+		return nil
+	}
+
+	if parent.Kind != yamlv3.MappingNode {
+		return fmt.Errorf("can not set %v: '%v' is not a mapping", path, strings.Join(rest, "."))
+	}
+	for i := len(rest) - 1; i > 0; i-- {
+		node = yamlv3.Node{
+			Kind:    yamlv3.MappingNode,
+			Tag:     "!!map",
+			Content: []*yamlv3.Node{scalarKey(rest[i]), cloneNode(node)},
+		}
+	}
+	parent.Content = append(parent.Content, scalarKey(rest[0]), cloneNode(node))
+	return nil
+}
+
+// Remove removes the setting at path. Returns false if the setting does not
+// exist.
+func (d *YAMLDocument) Remove(path string) bool {
+	segments := strings.Split(path, ".")
+	cur := d.root()
+	for len(segments) > 0 {
+		switch cur.Kind {
+		case yamlv3.MappingNode:
+			i, n := mappingEntry(cur, segments)
+			if i < 0 {
+				return false
+			}
+			if n == len(segments) {
+				cur.Content = append(cur.Content[:i], cur.Content[i+2:]...)
+				return true
+			}
+			cur, segments = cur.Content[i+1], segments[n:]
+		case yamlv3.SequenceNode:
+			idx, err := strconv.Atoi(segments[0])
+			if err != nil || idx < 0 || idx >= len(cur.Content) {
+				return false
+			}
+			if len(segments) == 1 {
+				cur.Content = append(cur.Content[:idx], cur.Content[idx+1:]...)
+				return true
+			}
+			cur, segments = cur.Content[idx], segments[1:]
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func (d *YAMLDocument) root() *yamlv3.Node {
+	return d.doc.Content[0]
+}
+
+// find returns the node at path, or the deepest existing parent and the
+// remaining path segments.
+func (d *YAMLDocument) find(path string) (*yamlv3.Node, []string) {
+	segments := strings.Split(path, ".")
+	cur := d.root()
+	for len(segments) > 0 {
+		switch cur.Kind {
+		case yamlv3.MappingNode:
+			i, n := mappingEntry(cur, segments)
+			if i < 0 {
+				return cur, segments
+			}
+			cur, segments = cur.Content[i+1], segments[n:]
+		case yamlv3.SequenceNode:
+			idx, err := strconv.Atoi(segments[0])
+			if err != nil || idx < 0 || idx >= len(cur.Content) {
+				return cur, segments
+			}
+			cur, segments = cur.Content[idx], segments[1:]
+		default:
+			return cur, segments
+		}
+	}
+	return cur, nil
+}
+
+// mappingEntry returns the index of the key in the mapping matching the
+// longest prefix of the segments, and the number of segments matched.
+// Returns -1 if no key matches.
+func mappingEntry(m *yamlv3.Node, segments []string) (int, int) {
+	found, matched := -1, 0
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		keySegments := strings.Split(m.Content[i].Value, ".")
+		if len(keySegments) <= matched || len(keySegments) > len(segments) {
+			continue
+		}
+		if slices.Equal(keySegments, segments[:len(keySegments)]) {
+			found, matched = i, len(keySegments)
+		}
+	}
+	return found, matched
+}
+
+func scalarKey(name string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: name}
+}
+
+func cloneNode(n yamlv3.Node) *yamlv3.Node {
+	return &n
+}
@@ -0,0 +1,161 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlDocumentTestInput = `# Agent configuration
+agent:
+  # log level used by all components
+  logging.level: info # change to debug for troubleshooting
+output.elasticsearch:
+  hosts:
+    - localhost:9200 # local cluster
+  username: elastic
+inputs:
+  - type: filestream
+    id: logs
+  - type: system/metrics
+    id: metrics
+`
+
+func TestYAMLDocumentRoundTrip(t *testing.T) {
+	doc, err := ParseYAMLDocument([]byte(yamlDocumentTestInput))
+	require.NoError(t, err)
+
+	out, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, yamlDocumentTestInput, string(out))
+}
+
+func TestYAMLDocumentModify(t *testing.T) {
+	doc, err := ParseYAMLDocument([]byte(yamlDocumentTestInput))
+	require.NoError(t, err)
+
+	require.NoError(t, doc.Set("agent.logging.level", "debug"))
+	require.NoError(t, doc.Set("output.elasticsearch.hosts.0", "es:9200"))
+	require.NoError(t, doc.Set("output.elasticsearch.ssl.verification_mode", "none"))
+	require.NoError(t, doc.Set("fleet.enabled", false))
+	assert.True(t, doc.Remove("inputs.1"))
+	assert.True(t, doc.Remove("output.elasticsearch.username"))
+	assert.False(t, doc.Remove("output.elasticsearch.password"))
+	assert.Error(t, doc.Set("inputs.0.type.name", "x"))
+
+	out, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, `# Agent configuration
+agent:
+  # log level used by all components
+  logging.level: debug # change to debug for troubleshooting
+output.elasticsearch:
+  hosts:
+    - es:9200 # local cluster
+  ssl:
+    verification_mode: none
+inputs:
+  - type: filestream
+    id: logs
+fleet:
+  enabled: false
+`, string(out))
+
+	var level string
+	found, err := doc.Get("agent.logging.level", &level)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "debug", level)
+
+	found, err = doc.Get("agent.logging.to_files", &level)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	cfg, err := doc.Config("agent.yml")
+	require.NoError(t, err)
+	hosts, err := Get[[]string](cfg, "output.elasticsearch.hosts")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"es:9200"}, hosts)
+}
+
+func TestYAMLDocumentConfigOrigins(t *testing.T) {
+	doc, err := ParseYAMLDocument([]byte(yamlDocumentTestInput))
+	require.NoError(t, err)
+	require.NoError(t, doc.Set("fleet.enabled", false))
+	assert.True(t, doc.Remove("agent"))
+
+	cfg, err := doc.Config("agent.yml")
+	require.NoError(t, err)
+
+	// the origins are the positions in the parsed document
+	o, ok := cfg.Origin("output.elasticsearch.username")
+	require.True(t, ok)
+	assert.Equal(t, Origin{File: "agent.yml", Line: 8, Column: 3}, o)
+	o, ok = cfg.Origin("inputs.1.id")
+	require.True(t, ok)
+	assert.Equal(t, Origin{File: "agent.yml", Line: 13, Column: 5}, o)
+
+	_, ok = cfg.Origin("fleet.enabled")
+	assert.False(t, ok, "added settings have no origin")
+	enabled, err := cfg.Bool("fleet.enabled", -1)
+	require.NoError(t, err)
+	assert.False(t, enabled)
+}
+
+func TestYAMLDocumentEmpty(t *testing.T) {
+	tests := map[string]struct {
+		input, expected string
+	}{
+		"empty":           {"", "a:\n  b: 1\n"},
+		"blank":           {"\n  \n", "a:\n  b: 1\n"},
+		"document marker": {"---\n", "a:\n  b: 1\n"},
+		"null":            {"null\n", "a:\n  b: 1\n"},
+		"comment only":    {"# only a comment\n", "# only a comment\na:\n  b: 1\n"},
+		"commented template": {
+			"# Agent configuration\n\n#agent:\n#  logging.level: info\n",
+			"# Agent configuration\n\n#agent:\n#  logging.level: info\na:\n  b: 1\n",
+		},
+		"commented null": {
+			"# head\n---\nnull # line\n# foot\n",
+			"# head\n# line\na:\n  b: 1\n\n# foot\n",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc, err := ParseYAMLDocument([]byte(test.input))
+			require.NoError(t, err)
+			require.NoError(t, doc.Set("a.b", 1))
+
+			out, err := doc.Bytes()
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(out))
+
+			// the written document is valid
+			again, err := ParseYAMLDocument(out)
+			require.NoError(t, err)
+			var b int
+			ok, err := again.Get("a.b", &b)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, 1, b)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic writes the content of data to path so readers see either the previous content or
+// the new one, never a partially written file. The data is written to a temporary file in the
+// same directory, to make sure the rename does not cross filesystems, the temporary file is
+// synced to disk and renamed over path and the parent directory is synced so the rename
+// survives a crash. The file is created with perm, umask is not applied.
+//
+// The temporary file replaces path with a single rename, on Windows as well,
+// so an existing path is never missing. The rename is retried as configured
+// by opts, by default only on Windows, see WithRenameRetries.
+func WriteAtomic(path string, data io.Reader, perm os.FileMode, opts ...RotateOpt) (err error) {
+	options := defaultRotateOpts
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	tempfile := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tempfile)
+		}
+	}()
+
+	if err = os.Chmod(tempfile, perm); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", tempfile, err)
+	}
+	if _, err = io.Copy(f, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tempfile, err)
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", tempfile, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tempfile, err)
+	}
+
+	if err = rename(tempfile, path, options); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	if err = SyncParent(path); err != nil {
+		return fmt.Errorf("failed to sync the directory of %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	tempdir := t.TempDir()
+	path := filepath.Join(tempdir, "registry")
+
+	err := WriteAtomic(path, strings.NewReader("new filebeat"), 0600)
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new filebeat"), contents)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// replace the existing file
+	err = WriteAtomic(path, strings.NewReader("newer filebeat"), 0640)
+	require.NoError(t, err)
+
+	contents, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("newer filebeat"), contents)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(tempdir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file must be left behind")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failure")
+}
+
+func TestWriteAtomicReadError(t *testing.T) {
+	tempdir := t.TempDir()
+	path := filepath.Join(tempdir, "registry")
+	require.NoError(t, os.WriteFile(path, []byte("existing filebeat"), 0600))
+
+	err := WriteAtomic(path, failingReader{}, 0600)
+	assert.ErrorContains(t, err, "read failure")
+
+	// the existing file is left untouched
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("existing filebeat"), contents)
+
+	entries, err := os.ReadDir(tempdir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file must be left behind")
+}
+
+func TestWriteAtomicMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "registry")
+	err := WriteAtomic(path, strings.NewReader("new filebeat"), 0600)
+	assert.Error(t, err)
+}
+
+func TestWriteAtomicRetries(t *testing.T) {
+	tempdir := t.TempDir()
+	// a non-empty directory cannot be replaced by a file
+	path := filepath.Join(tempdir, "registry")
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "data"), 0o755))
+
+	err := WriteAtomic(path, strings.NewReader("new filebeat"), 0600, WithRenameRetries(50*time.Millisecond, time.Millisecond))
+	var retryErr *RetryError
+	require.ErrorAs(t, err, &retryErr)
+	assert.Greater(t, retryErr.Attempts, 1)
+
+	entries, err := os.ReadDir(tempdir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file must be left behind")
+}
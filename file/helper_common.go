@@ -18,7 +18,9 @@
 package file
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"time"
 )
@@ -37,26 +39,63 @@ func WithRenameRetries(duration, interval time.Duration) RotateOpt {
 	}
 }
 
+// maxRetryBackoff caps the exponential backoff between two attempts.
+const maxRetryBackoff = time.Second
+
+// RetryError is returned when a file operation still fails once the retries
+// configured with WithRenameRetries or FileRetries are exhausted, typically
+// because another process, like an antivirus or a log shipper, holds the file
+// open on Windows.
+type RetryError struct {
+	Op       string
+	Path     string
+	Attempts int
+	Elapsed  time.Duration
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("failed to %s %s after %d attempts in %v: %v", e.Op, e.Path, e.Attempts, e.Elapsed, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
 func rename(src, dst string, options rotateOpts) error {
-	// Perform a regular (non-retrying) rename unless all retry options are specified.
-	if options.renameRetryDuration == 0 || options.renameRetryInterval == 0 {
+	return retry("rename "+src+" to", dst, options, func() error {
 		return os.Rename(src, dst)
+	})
+}
+
+func remove(path string, options rotateOpts) error {
+	return retry("remove", path, options, func() error {
+		return os.Remove(path)
+	})
+}
+
+// retry calls fn until it succeeds, with an exponential backoff starting at
+// options.renameRetryInterval, until options.renameRetryDuration has elapsed.
+// The operation is performed once unless all retry options are specified.
+// Errors about missing files are not retried.
+func retry(op, path string, options rotateOpts, fn func() error) error {
+	if options.renameRetryDuration == 0 || options.renameRetryInterval == 0 {
+		return fn()
 	}
 
-	// Attempt rename with retries every options.RenameRetryInterval until options.RenameRetryDuration
-	// has elapsed. This is useful in cases where the destination file may be locked or in use.
-	var err error
-	for start := time.Now(); time.Since(start) < options.renameRetryDuration; time.Sleep(options.renameRetryInterval) {
-		err = os.Rename(src, dst)
-		if err == nil {
-			// Rename succeeded; no more retries needed
-			return nil
+	start := time.Now()
+	wait := options.renameRetryInterval
+	for attempts := 1; ; attempts++ {
+		err := fn()
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			return err
 		}
-	}
 
-	if err != nil {
-		return fmt.Errorf("failed to rename %s to %s after %v: %w", src, dst, options.renameRetryDuration, err)
+		remaining := options.renameRetryDuration - time.Since(start)
+		if remaining <= 0 {
+			return &RetryError{Op: op, Path: path, Attempts: attempts, Elapsed: time.Since(start), Err: err}
+		}
+		time.Sleep(min(wait, remaining))
+		wait = min(2*wait, maxRetryBackoff)
 	}
-
-	return nil
 }
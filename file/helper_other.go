@@ -24,9 +24,13 @@ import (
 	"path/filepath"
 )
 
+// defaultRotateOpts are the retry options used when none are specified, file
+// operations are not retried by default.
+var defaultRotateOpts = rotateOpts{}
+
 // SafeFileRotate safely rotates an existing file under path and replaces it with the tempfile
 func SafeFileRotate(path, tempfile string, opts ...RotateOpt) error {
-	options := rotateOpts{}
+	options := defaultRotateOpts
 	for _, opt := range opts {
 		opt(&options)
 	}
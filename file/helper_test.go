@@ -18,12 +18,16 @@
 package file
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSafeFileRotateExistingFile(t *testing.T) {
@@ -64,3 +68,58 @@ func TestSafeFileRotateExistingFile(t *testing.T) {
 		assert.Equal(t, expectedContents, contents)
 	}
 }
+
+func TestRetry(t *testing.T) {
+	errInUse := errors.New("the process cannot access the file because it is being used by another process")
+	options := rotateOpts{renameRetryDuration: 200 * time.Millisecond, renameRetryInterval: 10 * time.Millisecond}
+
+	t.Run("succeeds after failures", func(t *testing.T) {
+		attempts := 0
+		err := retry("remove", "registry", options, func() error {
+			attempts++
+			if attempts < 3 {
+				return errInUse
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		attempts := 0
+		err := retry("remove", "registry", options, func() error {
+			attempts++
+			return errInUse
+		})
+
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.ErrorIs(t, err, errInUse)
+		assert.Equal(t, "remove", retryErr.Op)
+		assert.Equal(t, "registry", retryErr.Path)
+		assert.Equal(t, attempts, retryErr.Attempts)
+		assert.Greater(t, attempts, 1)
+		assert.GreaterOrEqual(t, retryErr.Elapsed, options.renameRetryDuration)
+	})
+
+	t.Run("missing files are not retried", func(t *testing.T) {
+		attempts := 0
+		err := retry("remove", "registry", options, func() error {
+			attempts++
+			return fs.ErrNotExist
+		})
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("no retries", func(t *testing.T) {
+		attempts := 0
+		err := retry("remove", "registry", rotateOpts{}, func() error {
+			attempts++
+			return errInUse
+		})
+		assert.Equal(t, errInUse, err)
+		assert.Equal(t, 1, attempts)
+	})
+}
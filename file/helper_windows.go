@@ -26,14 +26,19 @@ import (
 const windowsRenameRetryInterval = 50 * time.Millisecond
 const windowsRenameRetryDuration = 2 * time.Second
 
+// defaultRotateOpts are the retry options used when none are specified. On
+// Windows, retry the operations by default. This is useful in cases where
+// the file is locked or in use by another process.
+var defaultRotateOpts = rotateOpts{
+	renameRetryDuration: windowsRenameRetryDuration,
+	renameRetryInterval: windowsRenameRetryInterval,
+}
+
 // SafeFileRotate safely rotates an existing file under path and replaces it with the tempfile
 func SafeFileRotate(path, tempfile string, opts ...RotateOpt) error {
 	// On Windows, retry the rename operation by default. This is useful in cases where
 	// path, the destination file, may be locked or in use.
-	options := rotateOpts{
-		renameRetryDuration: windowsRenameRetryDuration,
-		renameRetryInterval: windowsRenameRetryInterval,
-	}
+	options := defaultRotateOpts
 	for _, opt := range opts {
 		opt(&options)
 	}
@@ -18,6 +18,7 @@
 package file
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -60,3 +61,28 @@ func TestSafeFileRotate(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "new content", string(data))
 }
+
+// TestRemoveLockedFile keeps a handle open on a file while removing it, the
+// removal is retried until the handle is released or the retries exhausted.
+func TestRemoveLockedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locked.txt")
+	err := os.WriteFile(path, []byte("content"), 0644)
+	require.NoError(t, err)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// The handle is held longer than the retries.
+	err = remove(path, rotateOpts{renameRetryDuration: 200 * time.Millisecond, renameRetryInterval: 50 * time.Millisecond})
+	var retryErr *RetryError
+	require.True(t, errors.As(err, &retryErr), "expected a RetryError, got %v", err)
+	require.FileExists(t, path)
+
+	time.AfterFunc(500*time.Millisecond, func() {
+		f.Close()
+	})
+	err = remove(path, rotateOpts{renameRetryDuration: 2 * time.Second, renameRetryInterval: 50 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoFileExists(t, path)
+}
@@ -18,15 +18,20 @@
 package file
 
 import (
+	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
@@ -36,6 +41,25 @@ const (
 	DateFormat      = "20060102"
 )
 
+// CompressionType is the algorithm used to compress the rotated files.
+type CompressionType string
+
+const (
+	// CompressionNone keeps the rotated files uncompressed.
+	CompressionNone CompressionType = ""
+	// CompressionGzip compresses the rotated files with gzip, adding the .gz extension.
+	CompressionGzip CompressionType = "gzip"
+	// CompressionZstd compresses the rotated files with zstd, adding the .zst extension.
+	CompressionZstd CompressionType = "zstd"
+)
+
+// compressionExtensions maps the compression types to the extension added to the
+// compressed files.
+var compressionExtensions = map[CompressionType]string{
+	CompressionGzip: ".gz",
+	CompressionZstd: ".zst",
+}
+
 // rotater is the interface responsible for rotating and finding files.
 type rotater interface {
 	// ActiveFile returns the path to the file that is actively written.
@@ -49,7 +73,8 @@ type rotater interface {
 // Rotator is a io.WriteCloser that automatically rotates the file it is
 // writing to when it reaches a maximum size and optionally on a time interval
 // basis. It also purges the oldest rotated files when the maximum number of
-// backups is reached.
+// backups is reached or when they are older than the maximum age, and
+// optionally compresses the rotated files.
 type Rotator struct {
 	rot      rotater
 	triggers []trigger
@@ -58,7 +83,12 @@ type Rotator struct {
 	extension       string
 	maxSizeBytes    uint
 	maxBackups      uint
+	maxAge          time.Duration
+	compression     CompressionType
 	interval        time.Duration
+	location        *time.Location
+	retryOpts       rotateOpts
+	onRetryError    func(*RetryError)
 	permissions     os.FileMode
 	log             Logger // Optional Logger (may be nil).
 	rotateOnStartup bool
@@ -67,13 +97,26 @@ type Rotator struct {
 
 	file  *os.File
 	mutex sync.Mutex
+
+	// The rotated files are compressed by a single goroutine, compressPending
+	// tells it to look for files rotated while it was running. Both are
+	// protected by mutex.
+	compressing     bool
+	compressPending bool
+	compressWG      sync.WaitGroup
 }
 
-// Logger allows the rotator to write debug information.
+// Logger allows the rotator to write debug information. If the Logger also
+// implements Warnw, it is used to report the failures to compress or remove
+// rotated files.
 type Logger interface {
 	Debugw(msg string, keysAndValues ...interface{}) // Debug
 }
 
+type warnLogger interface {
+	Warnw(msg string, keysAndValues ...interface{})
+}
+
 // RotatorOption is a configuration option for Rotator.
 type RotatorOption func(r *Rotator)
 
@@ -102,6 +145,44 @@ func MaxBackups(n uint) RotatorOption {
 	}
 }
 
+// MaxAge configures the maximum age of the backup files, backups whose last
+// modification is older are removed on rotation in addition to the ones
+// exceeding MaxBackups. The default is 0 for disabled.
+func MaxAge(d time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.maxAge = d
+	}
+}
+
+// Compression configures the compression of the rotated files. The active
+// file is never compressed. The default is CompressionNone.
+func Compression(c CompressionType) RotatorOption {
+	return func(r *Rotator) {
+		r.compression = c
+	}
+}
+
+// FileRetries configures the retries of the removal of the rotated files when
+// they are in use by another process, like an antivirus or a log shipper on
+// Windows. The operation is retried with an exponential backoff starting at
+// interval until duration has elapsed. The default is 2 seconds starting at
+// 50 milliseconds on Windows and no retries on the other platforms.
+func FileRetries(duration, interval time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.retryOpts = rotateOpts{renameRetryDuration: duration, renameRetryInterval: interval}
+	}
+}
+
+// OnRetryError registers a function called when a rotated file cannot be
+// removed once the retries configured by FileRetries are exhausted. The file is
+// kept and removing it is attempted again on the next rotation. The function
+// is called while the rotator is locked, it must not write to the rotator.
+func OnRetryError(fn func(*RetryError)) RotatorOption {
+	return func(r *Rotator) {
+		r.onRetryError = fn
+	}
+}
+
 // Permissions configures the file permissions to use for the file that
 // the Rotator creates. The default is 0600.
 func Permissions(m os.FileMode) RotatorOption {
@@ -119,13 +200,24 @@ func WithLogger(l Logger) RotatorOption {
 }
 
 // Interval sets the time interval for log rotation in addition to log
-// rotation by size. The default is 0 for disabled.
+// rotation by size. The intervals of a second, minute, hour, day, week, month
+// and year, and the intervals dividing a day, are aligned on the clock, for
+// example a 6h interval rotates at midnight, 6am, noon and 6pm. The rotation
+// happens on the first write after the boundary. The default is 0 for disabled.
 func Interval(d time.Duration) RotatorOption {
 	return func(r *Rotator) {
 		r.interval = d
 	}
 }
 
+// Timezone configures the timezone used to align the interval rotation on the
+// clock and to date the files. The default is the local timezone.
+func Timezone(loc *time.Location) RotatorOption {
+	return func(r *Rotator) {
+		r.location = loc
+	}
+}
+
 // RotateOnStartup immediately rotates files on startup rather than appending to
 // the existing file. The default is true.
 func RotateOnStartup(b bool) RotatorOption {
@@ -159,6 +251,7 @@ func NewFileRotator(filename string, options ...RotatorOption) (*Rotator, error)
 		interval:        0,
 		rotateOnStartup: true,
 		clock:           &realClock{},
+		retryOpts:       defaultRotateOpts,
 	}
 
 	for _, opt := range options {
@@ -171,6 +264,12 @@ func NewFileRotator(filename string, options ...RotatorOption) (*Rotator, error)
 	if r.maxBackups > MaxBackupsLimit {
 		return nil, fmt.Errorf("file rotator max backups %d is greater than the limit of %v", r.maxBackups, MaxBackupsLimit)
 	}
+	if r.maxAge < 0 {
+		return nil, fmt.Errorf("file rotator max age %v must not be negative", r.maxAge)
+	}
+	if _, ok := compressionExtensions[r.compression]; !ok && r.compression != CompressionNone {
+		return nil, fmt.Errorf("file rotator compression %q is not supported", r.compression)
+	}
 	if r.permissions > os.ModePerm {
 		return nil, fmt.Errorf("file rotator permissions mask of %o is invalid", r.permissions)
 	}
@@ -178,23 +277,44 @@ func NewFileRotator(filename string, options ...RotatorOption) (*Rotator, error)
 	if r.interval != 0 && r.interval < time.Second {
 		return nil, errors.New("the minimum time interval for log rotation is 1 second")
 	}
+	if r.location != nil {
+		r.clock = locationClock{clock: r.clock, location: r.location}
+	}
 
 	r.rot = newDateRotater(r.log, filename, r.extension, r.clock)
 
 	shouldRotateOnStart := r.rotateOnStartup
-	if _, err := os.Stat(r.rot.ActiveFile()); os.IsNotExist(err) {
+	active, err := os.Stat(r.rot.ActiveFile())
+	if os.IsNotExist(err) {
 		shouldRotateOnStart = false
 	}
 
 	r.triggers = newTriggers(shouldRotateOnStart, r.interval, r.maxSizeBytes, r.clock)
 
+	// The interval of a file appended to starts with its last write, so a file
+	// left from a previous interval is rotated on the first write.
+	if err == nil {
+		now := r.clock.Now()
+		if modTime := active.ModTime(); modTime.Before(now) {
+			for _, t := range r.triggers {
+				if t, ok := t.(*intervalTrigger); ok {
+					t.lastRotate = modTime.In(now.Location())
+				}
+			}
+		}
+	}
+
 	if r.log != nil {
 		r.log.Debugw("Initialized file rotator",
 			"filename", r.filename,
 			"extension", r.extension,
 			"max_size_bytes", r.maxSizeBytes,
 			"max_backups", r.maxBackups,
+			"max_age", r.maxAge,
+			"compression", r.compression,
 			"permissions", r.permissions,
+			"interval", r.interval,
+			"timezone", r.clock.Now().Location(),
 		)
 	}
 
@@ -273,6 +393,7 @@ func (r *Rotator) openNew() error {
 		if err = r.purge(); err != nil {
 			return fmt.Errorf("failed to purge unnecessary rotated files: %w", err)
 		}
+		r.compressRotated()
 	}
 
 	return r.openFile()
@@ -314,7 +435,8 @@ func (r *Rotator) rotate(reason rotateReason) error {
 }
 
 // rotateWithTime closes the actively written file, and rotates it along with existing
-// rotated files if needed. When it is done, unnecessary files are removed.
+// rotated files if needed. When it is done, unnecessary files are removed and
+// the remaining ones are compressed.
 func (r *Rotator) rotateWithTime(reason rotateReason, rotationTime time.Time) error {
 	if err := r.closeFile(); err != nil {
 		return fmt.Errorf("error file closing current file: %w", err)
@@ -324,10 +446,23 @@ func (r *Rotator) rotateWithTime(reason rotateReason, rotationTime time.Time) er
 		return fmt.Errorf("failed to rotate backups: %w", err)
 	}
 
-	return r.purge()
+	if err := r.purge(); err != nil {
+		return err
+	}
+	r.compressRotated()
+	return nil
 }
 
 func (r *Rotator) purge() error {
+	if err := r.purgeBackups(); err != nil {
+		return err
+	}
+	return r.purgeOld()
+}
+
+// purgeBackups removes the oldest rotated files exceeding the maximum number of
+// backups.
+func (r *Rotator) purgeBackups() error {
 	rotatedFiles := r.rot.RotatedFiles()
 	count := uint(len(rotatedFiles))
 	if count <= r.maxBackups {
@@ -340,7 +475,7 @@ func (r *Rotator) purge() error {
 		_, err := os.Stat(name)
 		switch {
 		case err == nil:
-			if err = os.Remove(name); err != nil {
+			if err = r.remove(name); err != nil {
 				return fmt.Errorf("failed to delete %v during rotation: %w", name, err)
 			}
 		case os.IsNotExist(err):
@@ -353,6 +488,188 @@ func (r *Rotator) purge() error {
 	return nil
 }
 
+// purgeOld removes the rotated files older than the maximum age.
+func (r *Rotator) purgeOld() error {
+	if r.maxAge == 0 {
+		return nil
+	}
+
+	cutoff := r.clock.Now().Add(-r.maxAge)
+	for _, name := range r.rot.RotatedFiles() {
+		info, err := os.Stat(name)
+		switch {
+		case err == nil:
+			if !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err = r.remove(name); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete %v older than %v during rotation: %w", name, r.maxAge, err)
+			}
+		case os.IsNotExist(err):
+		default:
+			return fmt.Errorf("failed on %v during rotation: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// remove deletes a rotated file. A file still in use once the retries are
+// exhausted is left in place and reported to the logger and the OnRetryError
+// function, removing it is attempted again on the next rotation, so the
+// rotation does not fail while another process holds it open.
+func (r *Rotator) remove(name string) error {
+	err := remove(name, r.retryOpts)
+	var retryErr *RetryError
+	if errors.As(err, &retryErr) {
+		r.warnw("Failed to delete rotated file, it will be deleted on the next rotation", "filename", name, "error", err)
+		if r.onRetryError != nil {
+			r.onRetryError(retryErr)
+		}
+		return nil
+	}
+	return err
+}
+
+// compressRotated starts compressing the rotated files which are not
+// compressed yet in the background, the caller must hold the lock. Failing to
+// compress a file does not fail the rotation, the file is kept uncompressed and
+// compressing it is attempted again on the next rotation.
+func (r *Rotator) compressRotated() {
+	if _, ok := compressionExtensions[r.compression]; !ok {
+		return
+	}
+	if r.compressing {
+		r.compressPending = true
+		return
+	}
+	r.compressing = true
+	r.compressWG.Add(1)
+	go r.compressLoop()
+}
+
+// compressLoop compresses the rotated files one at a time, until no rotation
+// happened while compressing.
+func (r *Rotator) compressLoop() {
+	defer r.compressWG.Done()
+	ext := compressionExtensions[r.compression]
+
+	for {
+		r.mutex.Lock()
+		var files []string
+		for _, name := range r.rot.RotatedFiles() {
+			if !isCompressed(name) {
+				files = append(files, name)
+			}
+		}
+		r.compressPending = false
+		r.mutex.Unlock()
+
+		for _, name := range files {
+			if err := r.compressFile(name, name+ext); err != nil {
+				r.warnw("Failed to compress rotated file", "filename", name, "error", err)
+			}
+		}
+
+		r.mutex.Lock()
+		if !r.compressPending {
+			r.compressing = false
+			r.mutex.Unlock()
+			return
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// warnw logs at warning level if the logger supports it, at debug level
+// otherwise.
+func (r *Rotator) warnw(msg string, keysAndValues ...interface{}) {
+	switch l := r.log.(type) {
+	case nil:
+	case warnLogger:
+		l.Warnw(msg, keysAndValues...)
+	default:
+		l.Debugw(msg, keysAndValues...)
+	}
+}
+
+// compressFile compresses src into dst and removes src. The modification time
+// of src is kept so the age of the backup is preserved. The compression runs
+// without holding the lock, if src is purged meanwhile, dst is removed again.
+func (r *Rotator) compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	info, err := in.Stat()
+	if err != nil {
+		in.Close()
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer in.Close()
+		pw.CloseWithError(r.compress(pw, in))
+	}()
+
+	err = WriteAtomic(dst, pr, r.permissions)
+	// Unblocks the compression if the write stopped early.
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return os.Remove(dst)
+	}
+	if err := os.Chtimes(dst, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err := remove(src, r.retryOpts); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *Rotator) compress(dst io.Writer, src io.Reader) error {
+	var w io.WriteCloser
+	switch r.compression {
+	case CompressionGzip:
+		w = gzip.NewWriter(dst)
+	case CompressionZstd:
+		var err error
+		if w, err = zstd.NewWriter(dst); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported compression %q", r.compression)
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func isCompressed(filename string) bool {
+	_, ok := trimCompression(filename)
+	return ok
+}
+
+// trimCompression removes the compression extension from filename, if any.
+func trimCompression(filename string) (string, bool) {
+	for _, ext := range compressionExtensions {
+		if trimmed, ok := strings.CutSuffix(filename, ext); ok {
+			return trimmed, true
+		}
+	}
+	return filename, false
+}
+
 func (r *Rotator) isRotationTriggered(dataLen uint) (rotateReason, time.Time) {
 	for _, t := range r.triggers {
 		reason := t.TriggerRotation(dataLen)
@@ -382,11 +699,15 @@ func (r *Rotator) Rotate() error {
 	return r.rotate(rotateReasonManualTrigger)
 }
 
-// Close closes the currently open file.
+// Close closes the currently open file and waits for the rotated files to be
+// compressed.
 func (r *Rotator) Close() error {
 	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	return r.closeFile()
+	err := r.closeFile()
+	r.mutex.Unlock()
+
+	r.compressWG.Wait()
+	return err
 }
 
 func (r *Rotator) dir() string {
@@ -478,7 +799,7 @@ func (d *dateRotator) Rotate(reason rotateReason, rotateTime time.Time) error {
 	d.logOrderCache = make(map[string]logOrder, 0)
 
 	newFileNamePrefix := d.filenamePrefix + rotateTime.Format(d.format)
-	files, err := filepath.Glob(newFileNamePrefix + "*" + d.extension)
+	files, err := d.glob(newFileNamePrefix)
 	if err != nil {
 		return fmt.Errorf("failed to get possible files: %w", err)
 	}
@@ -497,7 +818,7 @@ func (d *dateRotator) Rotate(reason rotateReason, rotateTime time.Time) error {
 }
 
 func (d *dateRotator) RotatedFiles() []string {
-	files, err := filepath.Glob(d.filenamePrefix + "*" + d.extension)
+	files, err := d.glob(d.filenamePrefix)
 	if err != nil {
 		if d.log != nil {
 			d.log.Debugw("failed to list existing logs: %+v", err)
@@ -515,6 +836,23 @@ func (d *dateRotator) RotatedFiles() []string {
 	return files
 }
 
+// glob returns the files starting with prefix and ending with the extension,
+// compressed or not.
+func (d *dateRotator) glob(prefix string) ([]string, error) {
+	files, err := filepath.Glob(prefix + "*" + d.extension)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range compressionExtensions {
+		compressed, err := filepath.Glob(prefix + "*" + d.extension + ext)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, compressed...)
+	}
+	return files, nil
+}
+
 // SortModTimeLogs puts newest file to the last
 func (d *dateRotator) SortModTimeLogs(strings []string) {
 	sort.Slice(
@@ -526,7 +864,8 @@ func (d *dateRotator) SortModTimeLogs(strings []string) {
 }
 
 // logOrder stores information required to sort log files
-// parsed out from the following format {filename}-{datetime}-{index}.ndjson
+// parsed out from the following format {filename}-{datetime}-{index}.ndjson,
+// optionally followed by the compression extension
 type logOrder struct {
 	index    int
 	datetime time.Time
@@ -547,13 +886,14 @@ func (d *dateRotator) OrderLog(filename string) logOrder {
 	var o logOrder
 	var err error
 
-	o.datetime, err = time.Parse(d.format, filename[d.prefixLen:d.filenameLen])
+	name, _ := trimCompression(filename)
+	o.datetime, err = time.Parse(d.format, name[d.prefixLen:d.filenameLen])
 	if err != nil {
 		return o
 	}
 
-	if d.isFilenameWithIndex(filename) {
-		o.index, err = d.filenameIndex(filename)
+	if d.isFilenameWithIndex(name) {
+		o.index, err = d.filenameIndex(name)
 		if err != nil {
 			return o
 		}
@@ -0,0 +1,59 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !windows
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressFilePurgedWhileCompressing(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "beatname-20211111.ndjson")
+	dst := src + ".gz"
+	require.NoError(t, os.WriteFile(src, []byte("Test file rotator.\n"), 0o600))
+
+	r, err := NewFileRotator(filepath.Join(dir, "beatname"), Compression(CompressionGzip))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// Hold the lock like a rotation purging src while it is compressed.
+	r.mutex.Lock()
+	done := make(chan error)
+	go func() {
+		done <- r.compressFile(src, dst)
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(dst)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.Remove(src))
+	r.mutex.Unlock()
+
+	// The compressed copy of the purged file is removed without an error.
+	require.NoError(t, <-done)
+	assert.NoFileExists(t, dst)
+	assert.NoFileExists(t, src)
+}
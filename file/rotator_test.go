@@ -20,13 +20,16 @@
 package file_test
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -336,6 +339,240 @@ func TestRotateExtension(t *testing.T) {
 	AssertDirContents(t, dir, secondFile, thirdFile)
 }
 
+func TestRotateCompression(t *testing.T) {
+	for _, tc := range []struct {
+		compression file.CompressionType
+		extension   string
+	}{
+		{file.CompressionGzip, ".gz"},
+		{file.CompressionZstd, ".zst"},
+	} {
+		t.Run(string(tc.compression), func(t *testing.T) {
+			dir := t.TempDir()
+
+			logname := "beatname"
+			filename := filepath.Join(dir, logname)
+
+			c := &testClock{time.Date(2021, 11, 11, 0, 0, 0, 0, time.Local)}
+			r, err := file.NewFileRotator(filename, file.Compression(tc.compression), file.MaxBackups(2), file.WithClock(c))
+			require.NoError(t, err)
+			defer r.Close()
+
+			WriteMsg(t, r)
+
+			firstFile := fmt.Sprintf("%s-%s.ndjson", logname, c.Now().Format(file.DateFormat))
+			AssertDirContents(t, dir, firstFile)
+			info, err := os.Stat(filepath.Join(dir, firstFile))
+			require.NoError(t, err)
+
+			Rotate(t, r)
+			WriteMsg(t, r)
+
+			// The rotated file is compressed, the active file is not.
+			secondFile := fmt.Sprintf("%s-%s-1.ndjson", logname, c.Now().Format(file.DateFormat))
+			AssertEventuallyDirContents(t, dir, firstFile+tc.extension, secondFile)
+			assert.Equal(t, logMessage, readCompressed(t, tc.compression, filepath.Join(dir, firstFile+tc.extension)))
+
+			compressed, err := os.Stat(filepath.Join(dir, firstFile+tc.extension))
+			require.NoError(t, err)
+			assert.Equal(t, info.ModTime().Unix(), compressed.ModTime().Unix(), "the modification time must be kept")
+
+			// Compressed files are accounted for when choosing the next index and
+			// when purging the backups.
+			Rotate(t, r)
+			WriteMsg(t, r)
+			thirdFile := fmt.Sprintf("%s-%s-2.ndjson", logname, c.Now().Format(file.DateFormat))
+			AssertEventuallyDirContents(t, dir, firstFile+tc.extension, secondFile+tc.extension, thirdFile)
+
+			Rotate(t, r)
+			WriteMsg(t, r)
+			fourthFile := fmt.Sprintf("%s-%s-3.ndjson", logname, c.Now().Format(file.DateFormat))
+			AssertEventuallyDirContents(t, dir, secondFile+tc.extension, thirdFile+tc.extension, fourthFile)
+		})
+	}
+}
+
+func TestCloseWaitsForCompression(t *testing.T) {
+	dir := t.TempDir()
+
+	logname := "beatname"
+	c := &testClock{time.Date(2021, 11, 11, 0, 0, 0, 0, time.Local)}
+	r, err := file.NewFileRotator(filepath.Join(dir, logname), file.Compression(file.CompressionGzip), file.WithClock(c))
+	require.NoError(t, err)
+
+	WriteMsg(t, r)
+	Rotate(t, r)
+	require.NoError(t, r.Close())
+
+	AssertDirContents(t, dir, fmt.Sprintf("%s-%s.ndjson.gz", logname, c.Now().Format(file.DateFormat)))
+}
+
+func TestRotateMaxAge(t *testing.T) {
+	dir := t.TempDir()
+
+	logname := "beatname"
+	now := time.Now()
+	c := &testClock{now}
+
+	// seed directory with backups of different ages
+	files := map[string]time.Duration{
+		logname + "-" + now.AddDate(0, 0, -5).Format(file.DateFormat) + ".ndjson":    5 * 24 * time.Hour,
+		logname + "-" + now.AddDate(0, 0, -4).Format(file.DateFormat) + ".ndjson.gz": 4 * 24 * time.Hour,
+		logname + "-" + now.AddDate(0, 0, -1).Format(file.DateFormat) + ".ndjson":    24 * time.Hour,
+	}
+	for name, age := range files {
+		CreateFile(t, filepath.Join(dir, name))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, name), now.Add(-age), now.Add(-age)))
+	}
+
+	filename := filepath.Join(dir, logname)
+	r, err := file.NewFileRotator(filename, file.MaxAge(72*time.Hour), file.MaxBackups(10), file.WithClock(c))
+	require.NoError(t, err)
+	defer r.Close()
+
+	Rotate(t, r)
+	WriteMsg(t, r)
+
+	today := fmt.Sprintf("%s-%s.ndjson", logname, now.Format(file.DateFormat))
+	AssertDirContents(t, dir, logname+"-"+now.AddDate(0, 0, -1).Format(file.DateFormat)+".ndjson", today)
+}
+
+func TestRotateTimezone(t *testing.T) {
+	dir := t.TempDir()
+
+	logname := "beatname"
+	filename := filepath.Join(dir, logname)
+	loc := time.FixedZone("UTC+2", 2*60*60)
+
+	c := &testClock{time.Date(2021, 11, 11, 3, 30, 0, 0, time.UTC)}
+	r, err := file.NewFileRotator(filename, file.Interval(6*time.Hour), file.Timezone(loc), file.WithClock(c))
+	require.NoError(t, err)
+	defer r.Close()
+
+	WriteMsg(t, r)
+	firstFile := fmt.Sprintf("%s-%s.ndjson", logname, "20211111")
+	AssertDirContents(t, dir, firstFile)
+
+	// 05:59 in UTC+2, still in the first interval.
+	c.time = time.Date(2021, 11, 11, 3, 59, 0, 0, time.UTC)
+	WriteMsg(t, r)
+	AssertDirContents(t, dir, firstFile)
+
+	// 06:00 in UTC+2, the interval is aligned on the timezone and not on UTC.
+	c.time = time.Date(2021, 11, 11, 4, 0, 0, 0, time.UTC)
+	WriteMsg(t, r)
+	secondFile := fmt.Sprintf("%s-%s-1.ndjson", logname, "20211111")
+	AssertDirContents(t, dir, firstFile, secondFile)
+
+	// Past midnight in UTC+2 the files are dated with the next day.
+	c.time = time.Date(2021, 11, 11, 22, 30, 0, 0, time.UTC)
+	WriteMsg(t, r)
+	thirdFile := fmt.Sprintf("%s-%s.ndjson", logname, "20211112")
+	AssertDirContents(t, dir, firstFile, secondFile, thirdFile)
+}
+
+func TestRotateIntervalOnRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	logname := "beatname"
+	filename := filepath.Join(dir, logname)
+
+	// A file left by a previous run, last written yesterday.
+	c := &testClock{time.Date(2021, 11, 12, 10, 0, 0, 0, time.Local)}
+	firstFile := fmt.Sprintf("%s-%s.ndjson", logname, "20211111")
+	CreateFile(t, filepath.Join(dir, firstFile))
+	lastWrite := time.Date(2021, 11, 11, 23, 0, 0, 0, time.Local)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, firstFile), lastWrite, lastWrite))
+
+	r, err := file.NewFileRotator(filename, file.Interval(24*time.Hour), file.RotateOnStartup(false), file.WithClock(c))
+	require.NoError(t, err)
+	defer r.Close()
+
+	// The day changed since the last write, the file is rotated instead of appended to.
+	WriteMsg(t, r)
+	secondFile := fmt.Sprintf("%s-%s.ndjson", logname, "20211112")
+	AssertDirContents(t, dir, firstFile, secondFile)
+}
+
+func TestRotatePurgeFailureDoesNotFailRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	logname := "beatname"
+	filename := filepath.Join(dir, logname)
+
+	// A backup which cannot be removed, like a file held open by another
+	// process on Windows.
+	locked := fmt.Sprintf("%s-%s.ndjson", logname, "20211101")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, locked), 0700))
+	CreateFile(t, filepath.Join(dir, locked, "content"))
+
+	var retryErrors []*file.RetryError
+	c := &testClock{time.Date(2021, 11, 11, 0, 0, 0, 0, time.Local)}
+	r, err := file.NewFileRotator(filename,
+		file.MaxBackups(1),
+		file.FileRetries(50*time.Millisecond, 10*time.Millisecond),
+		file.OnRetryError(func(err *file.RetryError) { retryErrors = append(retryErrors, err) }),
+		file.WithClock(c),
+	)
+	require.NoError(t, err)
+	defer r.Close()
+
+	WriteMsg(t, r)
+	firstFile := fmt.Sprintf("%s-%s.ndjson", logname, c.Now().Format(file.DateFormat))
+
+	c.time = time.Date(2021, 11, 12, 0, 0, 0, 0, time.Local)
+	Rotate(t, r)
+	WriteMsg(t, r)
+
+	secondFile := fmt.Sprintf("%s-%s.ndjson", logname, c.Now().Format(file.DateFormat))
+	AssertDirContents(t, dir, locked, firstFile, secondFile)
+	require.Len(t, retryErrors, 1, "the failure must be reported")
+	assert.Equal(t, filepath.Join(dir, locked), retryErrors[0].Path)
+
+	// Once the backup is released, it is removed on the next rotation.
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, locked, "content")))
+	c.time = time.Date(2021, 11, 13, 0, 0, 0, 0, time.Local)
+	Rotate(t, r)
+	WriteMsg(t, r)
+
+	thirdFile := fmt.Sprintf("%s-%s.ndjson", logname, c.Now().Format(file.DateFormat))
+	AssertDirContents(t, dir, secondFile, thirdFile)
+}
+
+func TestRotatorInvalidOptions(t *testing.T) {
+	_, err := file.NewFileRotator(filepath.Join(t.TempDir(), "beatname"), file.Compression("lz4"))
+	assert.ErrorContains(t, err, `compression "lz4" is not supported`)
+
+	_, err = file.NewFileRotator(filepath.Join(t.TempDir(), "beatname"), file.MaxAge(-time.Hour))
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func readCompressed(t *testing.T, compression file.CompressionType, filename string) string {
+	t.Helper()
+
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r io.Reader
+	switch compression {
+	case file.CompressionGzip:
+		gr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		defer gr.Close()
+		r = gr
+	case file.CompressionZstd:
+		zr, err := zstd.NewReader(f)
+		require.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	}
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
 func CreateFile(t *testing.T, filename string) {
 	t.Helper()
 	f, err := os.Create(filename)
@@ -365,6 +602,21 @@ func AssertDirContents(t *testing.T, dir string, files ...string) {
 	assert.ElementsMatch(t, files, names)
 }
 
+// AssertEventuallyDirContents waits for the files compressed in the background.
+func AssertEventuallyDirContents(t *testing.T, dir string, files ...string) {
+	t.Helper()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		names, err := os.ReadDir(dir)
+		require.NoError(c, err)
+		var got []string
+		for _, name := range names {
+			got = append(got, name.Name())
+		}
+		assert.ElementsMatch(c, files, got)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
 func WriteMsg(t *testing.T, r *file.Rotator) {
 	t.Helper()
 
@@ -113,6 +113,16 @@ func (realClock) Now() time.Time {
 	return time.Now()
 }
 
+// locationClock returns the time of clock in location.
+type locationClock struct {
+	clock    clock
+	location *time.Location
+}
+
+func (c locationClock) Now() time.Time {
+	return c.clock.Now().In(c.location)
+}
+
 func newIntervalTrigger(interval time.Duration, clock clock) trigger {
 	t := intervalTrigger{interval: interval, clock: clock}
 
@@ -132,6 +142,15 @@ func newIntervalTrigger(interval time.Duration, clock clock) trigger {
 	case 365 * 24 * time.Hour: // calendar year
 		t.newInterval = newYear
 	default:
+		if interval < 24*time.Hour && (24*time.Hour)%interval == 0 {
+			// Intervals dividing a day are aligned on the wall clock, a 6h interval
+			// rotates at 00:00, 06:00, 12:00 and 18:00.
+			t.newInterval = func(lastTime time.Time, currentTime time.Time) bool {
+				return sinceMidnight(lastTime)/t.interval != sinceMidnight(currentTime)/t.interval ||
+					newDay(lastTime, currentTime)
+			}
+			break
+		}
 		t.newInterval = func(lastTime time.Time, currentTime time.Time) bool {
 			lastInterval := lastTime.Unix() / (int64(t.interval) / int64(time.Second))
 			currentInterval := currentTime.Unix() / (int64(t.interval) / int64(time.Second))
@@ -152,6 +171,15 @@ func (t *intervalTrigger) TriggerRotation(_ uint) rotateReason {
 	return rotateReasonNoRotate
 }
 
+// sinceMidnight returns the wall clock time elapsed since midnight, ignoring
+// daylight saving time transitions.
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
 func newSecond(lastTime time.Time, currentTime time.Time) bool {
 	return lastTime.Second() != currentTime.Second() || newMinute(lastTime, currentTime)
 }
@@ -134,3 +134,42 @@ func TestIntervalTrigger(t *testing.T) {
 		assert.Equal(t, trigger.TriggerRotation(ignored), rotateReasonNoRotate)
 	}
 }
+
+func TestIntervalTriggerAligned(t *testing.T) {
+	var ignored uint = 1
+
+	testCases := []struct {
+		interval   time.Duration
+		lastRotate time.Time
+		now        time.Time
+		rotate     bool
+	}{
+		{6 * time.Hour, time.Date(2024, 6, 15, 5, 59, 59, 0, time.UTC), time.Date(2024, 6, 15, 6, 0, 0, 0, time.UTC), true},
+		{6 * time.Hour, time.Date(2024, 6, 15, 6, 0, 0, 0, time.UTC), time.Date(2024, 6, 15, 11, 59, 59, 0, time.UTC), false},
+		{6 * time.Hour, time.Date(2024, 6, 14, 18, 0, 0, 0, time.UTC), time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), true},
+		{6 * time.Hour, time.Date(2024, 6, 14, 12, 0, 0, 0, time.UTC), time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC), true},
+		{15 * time.Minute, time.Date(2024, 6, 15, 12, 14, 0, 0, time.UTC), time.Date(2024, 6, 15, 12, 15, 0, 0, time.UTC), true},
+		{15 * time.Minute, time.Date(2024, 6, 15, 12, 15, 0, 0, time.UTC), time.Date(2024, 6, 15, 12, 29, 0, 0, time.UTC), false},
+		// The boundaries follow the wall clock of the location of the times.
+		{12 * time.Hour, time.Date(2024, 6, 15, 11, 0, 0, 0, time.FixedZone("", 5*3600)), time.Date(2024, 6, 15, 12, 0, 0, 0, time.FixedZone("", 5*3600)), true},
+		{12 * time.Hour, time.Date(2024, 6, 15, 6, 0, 0, 0, time.FixedZone("", 5*3600)), time.Date(2024, 6, 15, 11, 0, 0, 0, time.FixedZone("", 5*3600)), false},
+	}
+
+	for _, tc := range testCases {
+		clock := &fixedClock{tc.now}
+		trigger, ok := newIntervalTrigger(tc.interval, clock).(*intervalTrigger)
+		assert.True(t, ok)
+
+		trigger.lastRotate = tc.lastRotate
+		assert.Equal(t, tc.rotate, trigger.TriggerRotation(ignored) == rotateReasonTimeInterval,
+			"interval %v from %v to %v", tc.interval, tc.lastRotate, tc.now)
+	}
+}
+
+type fixedClock struct {
+	time time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.time
+}
@@ -0,0 +1,294 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cli implements the keystore subcommands shared by the binaries embedding a keystore,
+// so they all offer the same create, add, remove and list commands.
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/elastic/elastic-agent-libs/keystore"
+)
+
+// KeystoreGetter returns the keystore the commands operate on, it's called when a command runs
+// so the keystore can depend on the flags of the parent commands.
+type KeystoreGetter func() (keystore.Keystore, error)
+
+// terminal abstracts the interactive input so it can be replaced in tests.
+type terminal interface {
+	isTerminal(r io.Reader) bool
+	readPassword(r io.Reader) ([]byte, error)
+}
+
+type stdTerminal struct{}
+
+func (stdTerminal) isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+func (stdTerminal) readPassword(r io.Reader) ([]byte, error) {
+	f, ok := r.(*os.File)
+	if !ok {
+		return nil, errors.New("input is not a terminal")
+	}
+	return term.ReadPassword(int(f.Fd()))
+}
+
+var tty terminal = stdTerminal{}
+
+// NewCommand returns the keystore command with the create, add, remove and list subcommands.
+func NewCommand(get KeystoreGetter) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keystore",
+		Short: "Manage secrets keystore",
+	}
+	cmd.AddCommand(
+		NewCreateCommand(get),
+		NewAddCommand(get),
+		NewRemoveCommand(get),
+		NewListCommand(get),
+	)
+	return cmd
+}
+
+// NewCreateCommand returns the command creating an empty keystore.
+func NewCreateCommand(get KeystoreGetter) *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create keystore",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := get()
+			if err != nil {
+				return fmt.Errorf("could not load the keystore: %w", err)
+			}
+			writable, err := keystore.AsWritableKeystore(store)
+			if err != nil {
+				return err
+			}
+
+			if store.IsPersisted() && !force {
+				ok, err := confirm(cmd, "A keystore already exists, Overwrite? [y/N]: ")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					fmt.Fprintln(cmd.OutOrStdout(), "Exiting without creating keystore.")
+					return nil
+				}
+			}
+
+			if err := writable.Create(true); err != nil {
+				return fmt.Errorf("could not create the keystore: %w", err)
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "Created keystore")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "override the existing keystore")
+	return cmd
+}
+
+// NewAddCommand returns the command adding a secret to the keystore, the secret is read from
+// standard input with --stdin or prompted without echo on a terminal.
+func NewAddCommand(get KeystoreGetter) *cobra.Command {
+	var force, stdin bool
+	cmd := &cobra.Command{
+		Use:   "add KEY",
+		Short: "Add secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key := strings.TrimSpace(args[0])
+			if key == "" {
+				return errors.New("the key cannot be empty")
+			}
+
+			store, writable, err := loadWritable(get)
+			if err != nil {
+				return err
+			}
+
+			if _, err := store.Retrieve(key); err == nil && !force {
+				ok, err := confirm(cmd, fmt.Sprintf("Setting %s already exists, Overwrite? [y/N]: ", key))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					fmt.Fprintln(cmd.OutOrStdout(), "Exiting without modifying keystore.")
+					return nil
+				}
+			}
+
+			value, err := readSecret(cmd, key, stdin)
+			if err != nil {
+				return err
+			}
+			if len(value) == 0 {
+				return errors.New("the secret cannot be empty")
+			}
+
+			if err := writable.Store(key, value); err != nil {
+				return fmt.Errorf("could not add key %q: %w", key, err)
+			}
+			if err := writable.Save(); err != nil {
+				return fmt.Errorf("could not save the keystore: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Successfully updated the keystore with %s\n", key)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&stdin, "stdin", false, "read the secret from standard input")
+	cmd.Flags().BoolVar(&force, "force", false, "override the existing key")
+	return cmd
+}
+
+// NewRemoveCommand returns the command removing secrets from the keystore.
+func NewRemoveCommand(get KeystoreGetter) *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove KEY [KEY...]",
+		Short: "Remove secrets",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, writable, err := loadWritable(get)
+			if err != nil {
+				return err
+			}
+
+			// Check every key first so nothing is removed when one of them is missing.
+			for _, key := range args {
+				if _, err := store.Retrieve(key); err != nil {
+					if errors.Is(err, keystore.ErrKeyDoesntExists) {
+						return fmt.Errorf("could not find key %q in the keystore", key)
+					}
+					return err
+				}
+			}
+			for _, key := range args {
+				if err := writable.Delete(key); err != nil {
+					return fmt.Errorf("could not remove key %q: %w", key, err)
+				}
+			}
+			if err := writable.Save(); err != nil {
+				return fmt.Errorf("could not save the keystore: %w", err)
+			}
+			for _, key := range args {
+				fmt.Fprintf(cmd.OutOrStdout(), "Successfully removed %s from the keystore\n", key)
+			}
+			return nil
+		},
+	}
+}
+
+// NewListCommand returns the command listing the keys of the keystore, one per line.
+func NewListCommand(get KeystoreGetter) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List keystore",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := get()
+			if err != nil {
+				return fmt.Errorf("could not load the keystore: %w", err)
+			}
+			listing, err := keystore.AsListingKeystore(store)
+			if err != nil {
+				return err
+			}
+			keys, err := listing.List()
+			if err != nil {
+				return fmt.Errorf("could not list the keystore: %w", err)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Fprintln(cmd.OutOrStdout(), key)
+			}
+			return nil
+		},
+	}
+}
+
+func loadWritable(get KeystoreGetter) (keystore.Keystore, keystore.WritableKeystore, error) {
+	store, err := get()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not load the keystore: %w", err)
+	}
+	writable, err := keystore.AsWritableKeystore(store)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !store.IsPersisted() {
+		return nil, nil, errors.New("the keystore doesn't exist, use the 'create' command to create one")
+	}
+	return store, writable, nil
+}
+
+// readSecret reads the secret from standard input or prompts for it on a terminal.
+func readSecret(cmd *cobra.Command, key string, stdin bool) ([]byte, error) {
+	in := cmd.InOrStdin()
+	if stdin {
+		value, err := io.ReadAll(in)
+		if err != nil {
+			return nil, fmt.Errorf("could not read the secret from standard input: %w", err)
+		}
+		// Drop the newline added by echo or a heredoc.
+		value = bytes.TrimSuffix(value, []byte("\n"))
+		return bytes.TrimSuffix(value, []byte("\r")), nil
+	}
+
+	if !tty.isTerminal(in) {
+		return nil, errors.New("the secret must be provided with --stdin when not running in a terminal")
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Enter value for %s: ", key)
+	value, err := tty.readPassword(in)
+	fmt.Fprintln(cmd.OutOrStdout())
+	if err != nil {
+		return nil, fmt.Errorf("could not read the secret: %w", err)
+	}
+	return value, nil
+}
+
+// confirm asks a yes/no question on a terminal, without a terminal the answer is no and an
+// error asks to use --force.
+func confirm(cmd *cobra.Command, prompt string) (bool, error) {
+	in := cmd.InOrStdin()
+	if !tty.isTerminal(in) {
+		return false, errors.New("confirmation required, use --force to proceed without a terminal")
+	}
+	fmt.Fprint(cmd.OutOrStdout(), prompt)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/keystore"
+)
+
+// fakeTerminal treats every input as a terminal and reads the password as a line.
+type fakeTerminal struct{}
+
+func (fakeTerminal) isTerminal(io.Reader) bool { return true }
+
+func (fakeTerminal) readPassword(r io.Reader) ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := r.Read(buf)
+		if n == 1 && buf[0] != '\n' {
+			line = append(line, buf[0])
+			continue
+		}
+		return line, err
+	}
+}
+
+func withTerminal(t *testing.T) {
+	orig := tty
+	tty = fakeTerminal{}
+	t.Cleanup(func() { tty = orig })
+}
+
+func fileKeystore(t *testing.T) KeystoreGetter {
+	path := filepath.Join(t.TempDir(), "keystore")
+	return func() (keystore.Keystore, error) {
+		return keystore.NewFileKeystore(path)
+	}
+}
+
+func run(t *testing.T, get KeystoreGetter, stdin string, args ...string) (string, error) {
+	t.Helper()
+	cmd := NewCommand(get)
+	var out bytes.Buffer
+	cmd.SetIn(strings.NewReader(stdin))
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func retrieve(t *testing.T, get KeystoreGetter, key string) string {
+	t.Helper()
+	store, err := get()
+	require.NoError(t, err)
+	secret, err := store.Retrieve(key)
+	require.NoError(t, err)
+	v, err := secret.Get()
+	require.NoError(t, err)
+	return string(v)
+}
+
+func TestCreate(t *testing.T) {
+	get := fileKeystore(t)
+
+	out, err := run(t, get, "", "create")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Created keystore")
+
+	// Without a terminal the existing keystore is only overwritten with --force.
+	_, err = run(t, get, "", "create")
+	assert.ErrorContains(t, err, "use --force")
+	_, err = run(t, get, "", "create", "--force")
+	require.NoError(t, err)
+
+	withTerminal(t)
+	out, err = run(t, get, "n\n", "create")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Exiting without creating keystore.")
+	out, err = run(t, get, "y\n", "create")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Created keystore")
+}
+
+func TestAdd(t *testing.T) {
+	get := fileKeystore(t)
+
+	_, err := run(t, get, "secret", "add", "a", "--stdin")
+	assert.ErrorContains(t, err, "use the 'create' command")
+
+	_, err = run(t, get, "", "create")
+	require.NoError(t, err)
+
+	out, err := run(t, get, "secret\n", "add", "output.elasticsearch.password", "--stdin")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Successfully updated the keystore with output.elasticsearch.password")
+	assert.Equal(t, "secret", retrieve(t, get, "output.elasticsearch.password"))
+
+	_, err = run(t, get, "other", "add", "output.elasticsearch.password", "--stdin")
+	assert.ErrorContains(t, err, "use --force")
+	_, err = run(t, get, "other\r\n", "add", "output.elasticsearch.password", "--stdin", "--force")
+	require.NoError(t, err)
+	assert.Equal(t, "other", retrieve(t, get, "output.elasticsearch.password"))
+
+	_, err = run(t, get, "", "add", "empty", "--stdin")
+	assert.ErrorContains(t, err, "cannot be empty")
+
+	_, err = run(t, get, "secret", "add", "prompted")
+	assert.ErrorContains(t, err, "--stdin")
+
+	withTerminal(t)
+	out, err = run(t, get, "typed\n", "add", "prompted")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Enter value for prompted: ")
+	assert.NotContains(t, out, "typed")
+	assert.Equal(t, "typed", retrieve(t, get, "prompted"))
+}
+
+func TestRemoveAndList(t *testing.T) {
+	get := fileKeystore(t)
+	_, err := run(t, get, "", "create")
+	require.NoError(t, err)
+	for _, key := range []string{"c", "a", "b"} {
+		_, err = run(t, get, "v", "add", key, "--stdin")
+		require.NoError(t, err)
+	}
+
+	out, err := run(t, get, "", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\nc\n", out)
+
+	_, err = run(t, get, "", "remove", "a", "missing")
+	assert.ErrorContains(t, err, `could not find key "missing"`)
+	out, err = run(t, get, "", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\nc\n", out, "nothing must be removed when a key is missing")
+
+	out, err = run(t, get, "", "remove", "a", "c")
+	require.NoError(t, err)
+	assert.Contains(t, out, "Successfully removed a from the keystore")
+	out, err = run(t, get, "", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "b\n", out)
+}
+
+func TestReadOnlyKeystore(t *testing.T) {
+	get := func() (keystore.Keystore, error) {
+		return struct{ keystore.Keystore }{keystore.NewMemoryKeystore()}, nil
+	}
+	_, err := run(t, get, "", "create")
+	assert.ErrorIs(t, err, keystore.ErrNotWritable)
+	_, err = run(t, get, "", "list")
+	assert.ErrorIs(t, err, keystore.ErrNotListing)
+}
@@ -0,0 +1,245 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// DefaultCloudTimeout is the default timeout to retrieve a secret from a cloud provider.
+const DefaultCloudTimeout = 30 * time.Second
+
+// CloudConfig configures a read-only keystore that retrieves the secrets from cloud secret
+// managers using the ambient credentials of the machine, nothing is persisted locally.
+type CloudConfig struct {
+	Providers []CloudProviderConfig `config:"providers"`
+	Timeout   time.Duration         `config:"timeout"`
+}
+
+// CloudProviderConfig maps the keys starting with Prefix to a secret manager, the rest of the key
+// is the name of the secret. Exactly one provider must be configured.
+type CloudProviderConfig struct {
+	Prefix string                   `config:"prefix"`
+	AWS    *AWSSecretsManagerConfig `config:"aws"`
+	GCP    *GCPSecretManagerConfig  `config:"gcp"`
+	Azure  *AzureKeyVaultConfig     `config:"azure"`
+}
+
+func defaultCloudConfig() CloudConfig {
+	return CloudConfig{Timeout: DefaultCloudTimeout}
+}
+
+func (c *CloudConfig) validate() error {
+	if len(c.Providers) == 0 {
+		return errors.New("at least one cloud provider is required")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultCloudTimeout
+	}
+	prefixes := make(map[string]struct{}, len(c.Providers))
+	for i, p := range c.Providers {
+		configured := 0
+		for _, set := range []bool{p.AWS != nil, p.GCP != nil, p.Azure != nil} {
+			if set {
+				configured++
+			}
+		}
+		if configured != 1 {
+			return fmt.Errorf("cloud provider %d must configure exactly one of aws, gcp or azure", i)
+		}
+		if _, ok := prefixes[p.Prefix]; ok {
+			return fmt.Errorf("cloud provider prefix %q is configured more than once", p.Prefix)
+		}
+		prefixes[p.Prefix] = struct{}{}
+		if p.Azure != nil && p.Azure.VaultURL == "" {
+			return fmt.Errorf("cloud provider %d: azure vault_url is required", i)
+		}
+	}
+	return nil
+}
+
+// secretProvider retrieves a single secret from a secret manager.
+type secretProvider interface {
+	// getSecret returns the secret or ErrKeyDoesntExists.
+	getSecret(ctx context.Context, name string) ([]byte, error)
+}
+
+type prefixedProvider struct {
+	prefix   string
+	provider secretProvider
+}
+
+// CloudKeystore retrieves secrets from cloud secret managers on every access, routing each key
+// to the provider with the longest matching prefix. The secrets cannot be listed, so GetConfig
+// returns an empty configuration and the keystore is meant to be used through ResolverWrap or
+// SecretResolver.
+type CloudKeystore struct {
+	providers []prefixedProvider
+	timeout   time.Duration
+}
+
+// NewCloudKeystore returns a keystore reading the secrets from the configured cloud providers.
+func NewCloudKeystore(cfg CloudConfig) (*CloudKeystore, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{}
+	k := &CloudKeystore{timeout: cfg.Timeout}
+	for _, p := range cfg.Providers {
+		var provider secretProvider
+		switch {
+		case p.AWS != nil:
+			provider = newAWSSecretsManager(*p.AWS, client)
+		case p.GCP != nil:
+			provider = newGCPSecretManager(*p.GCP, client)
+		case p.Azure != nil:
+			provider = newAzureKeyVault(*p.Azure, client)
+		}
+		k.providers = append(k.providers, prefixedProvider{prefix: p.Prefix, provider: provider})
+	}
+	// Longest prefixes first so the most specific provider wins.
+	sort.SliceStable(k.providers, func(i, j int) bool {
+		return len(k.providers[i].prefix) > len(k.providers[j].prefix)
+	})
+	return k, nil
+}
+
+// Retrieve returns the secret from the provider matching the key.
+func (k *CloudKeystore) Retrieve(key string) (*SecureString, error) {
+	for _, p := range k.providers {
+		name, ok := strings.CutPrefix(key, p.prefix)
+		if !ok || name == "" {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+		defer cancel()
+		value, err := p.provider.getSecret(ctx, name)
+		if err != nil {
+			if errors.Is(err, ErrKeyDoesntExists) {
+				return nil, ErrKeyDoesntExists
+			}
+			return nil, fmt.Errorf("could not retrieve secret %q: %w", key, err)
+		}
+		return NewSecureString(value), nil
+	}
+	return nil, ErrKeyDoesntExists
+}
+
+// GetConfig returns an empty configuration since cloud secrets are retrieved on demand.
+func (k *CloudKeystore) GetConfig() (*config.C, error) {
+	return config.NewConfig(), nil
+}
+
+// IsPersisted always returns true, the secrets are persisted by the cloud provider.
+func (k *CloudKeystore) IsPersisted() bool {
+	return true
+}
+
+// cachedValue caches a credential until shortly before it expires.
+type cachedValue[T any] struct {
+	fetch func(ctx context.Context) (T, time.Time, error)
+	now   func() time.Time
+
+	mu     sync.Mutex
+	value  T
+	valid  bool
+	expiry time.Time
+}
+
+// credentialRefreshWindow is how long before their expiration credentials are refreshed.
+const credentialRefreshWindow = 5 * time.Minute
+
+func newCachedValue[T any](fetch func(ctx context.Context) (T, time.Time, error)) *cachedValue[T] {
+	return &cachedValue[T]{fetch: fetch, now: time.Now}
+}
+
+// get returns the cached value, fetching a new one when it's missing or about to expire. A zero
+// expiration means the value never expires.
+func (c *cachedValue[T]) get(ctx context.Context) (T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.valid && (c.expiry.IsZero() || c.now().Before(c.expiry.Add(-credentialRefreshWindow))) {
+		return c.value, nil
+	}
+
+	value, expiry, err := c.fetch(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.value, c.expiry, c.valid = value, expiry, true
+	return value, nil
+}
+
+// cloudHTTPError is returned when a cloud API answers with an unexpected status.
+type cloudHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *cloudHTTPError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// doCloudRequest sends the request and decodes the JSON response into out.
+func doCloudRequest(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &cloudHTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if out == nil {
+		return nil
+	}
+	if s, ok := out.(*string); ok {
+		*s = string(body)
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	return nil
+}
+
+// isStatus reports if err is a cloudHTTPError with the given status code.
+func isStatus(err error, code int) bool {
+	var httpErr *cloudHTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == code
+}
@@ -0,0 +1,369 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	awsIMDSURL          = "http://169.254.169.254"
+	awsECSURL           = "http://169.254.170.2"
+	awsIMDSTokenTTL     = "21600"
+	awsSigningService   = "secretsmanager"
+	awsSigningAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// AWSSecretsManagerConfig configures AWS Secrets Manager. Credentials are taken, in order, from
+// the AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY environment variables, the web identity token of
+// EKS (IRSA), the ECS container credentials and the EC2 instance metadata service.
+type AWSSecretsManagerConfig struct {
+	// Region defaults to AWS_REGION, AWS_DEFAULT_REGION or the region of the EC2 instance.
+	Region string `config:"region"`
+	// Endpoint overrides the Secrets Manager endpoint, for example for VPC endpoints.
+	Endpoint string `config:"endpoint"`
+}
+
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+type awsSecretsManager struct {
+	cfg    AWSSecretsManagerConfig
+	client *http.Client
+	now    func() time.Time
+
+	imdsURL string
+	ecsURL  string
+
+	region      *cachedValue[string]
+	credentials *cachedValue[awsCredentials]
+}
+
+func newAWSSecretsManager(cfg AWSSecretsManagerConfig, client *http.Client) *awsSecretsManager {
+	p := &awsSecretsManager{
+		cfg:     cfg,
+		client:  client,
+		now:     time.Now,
+		imdsURL: awsIMDSURL,
+		ecsURL:  awsECSURL,
+	}
+	p.region = newCachedValue(p.fetchRegion)
+	p.credentials = newCachedValue(p.fetchCredentials)
+	return p
+}
+
+func (p *awsSecretsManager) getSecret(ctx context.Context, name string) ([]byte, error) {
+	region, err := p.region.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine the AWS region: %w", err)
+	}
+	creds, err := p.credentials.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve AWS credentials: %w", err)
+	}
+
+	endpoint := p.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signAWSRequest(req, body, creds, region, awsSigningService, p.now())
+
+	var resp struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary []byte  `json:"SecretBinary"`
+	}
+	if err := doCloudRequest(p.client, req, &resp); err != nil {
+		var httpErr *cloudHTTPError
+		if errors.As(err, &httpErr) && strings.Contains(httpErr.Body, "ResourceNotFoundException") {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, err
+	}
+	if resp.SecretString != nil {
+		return []byte(*resp.SecretString), nil
+	}
+	return resp.SecretBinary, nil
+}
+
+func (p *awsSecretsManager) fetchRegion(ctx context.Context) (string, time.Time, error) {
+	for _, region := range []string{p.cfg.Region, os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")} {
+		if region != "" {
+			return region, time.Time{}, nil
+		}
+	}
+	region, err := p.imdsGet(ctx, "/latest/meta-data/placement/region")
+	return region, time.Time{}, err
+}
+
+// fetchCredentials walks the credential chain and returns the first available credentials.
+func (p *awsSecretsManager) fetchCredentials(ctx context.Context) (awsCredentials, time.Time, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, time.Time{}, nil
+	}
+	if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+		return p.webIdentityCredentials(ctx, tokenFile, role)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return p.containerCredentials(ctx, p.ecsURL+uri, "")
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return p.containerCredentials(ctx, uri, os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"))
+	}
+	return p.instanceCredentials(ctx)
+}
+
+// awsMetadataCredentials is the format of the credentials served by IMDS and ECS.
+type awsMetadataCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c awsMetadataCredentials) credentials() (awsCredentials, time.Time, error) {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return awsCredentials{}, time.Time{}, errors.New("empty credentials")
+	}
+	return awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.Token}, c.Expiration, nil
+}
+
+func (p *awsSecretsManager) containerCredentials(ctx context.Context, uri, token string) (awsCredentials, time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	var creds awsMetadataCredentials
+	if err := doCloudRequest(p.client, req, &creds); err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("container credentials: %w", err)
+	}
+	return creds.credentials()
+}
+
+func (p *awsSecretsManager) instanceCredentials(ctx context.Context) (awsCredentials, time.Time, error) {
+	role, err := p.imdsGet(ctx, "/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("instance role: %w", err)
+	}
+	role, _, _ = strings.Cut(strings.TrimSpace(role), "\n")
+
+	raw, err := p.imdsGet(ctx, "/latest/meta-data/iam/security-credentials/"+role)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("instance credentials: %w", err)
+	}
+	var creds awsMetadataCredentials
+	if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("could not decode instance credentials: %w", err)
+	}
+	return creds.credentials()
+}
+
+// imdsGet reads a path of the EC2 instance metadata service using an IMDSv2 session token.
+func (p *awsSecretsManager) imdsGet(ctx context.Context, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.imdsURL+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", awsIMDSTokenTTL)
+	var token string
+	if err := doCloudRequest(p.client, req, &token); err != nil {
+		return "", fmt.Errorf("IMDS token: %w", err)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.imdsURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token", token)
+	var value string
+	if err := doCloudRequest(p.client, req, &value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (p *awsSecretsManager) webIdentityCredentials(ctx context.Context, tokenFile, role string) (awsCredentials, time.Time, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("could not read web identity token: %w", err)
+	}
+	region, err := p.region.get(ctx)
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = "elastic-keystore"
+	}
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	if endpoint == "" {
+		endpoint = "https://sts." + region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(query.Encode()))
+	if err != nil {
+		return awsCredentials{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var raw string
+	if err := doCloudRequest(p.client, req, &raw); err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("AssumeRoleWithWebIdentity: %w", err)
+	}
+	var resp struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal([]byte(raw), &resp); err != nil {
+		return awsCredentials{}, time.Time{}, fmt.Errorf("could not decode AssumeRoleWithWebIdentity response: %w", err)
+	}
+	return awsMetadataCredentials{
+		AccessKeyID:     resp.Credentials.AccessKeyID,
+		SecretAccessKey: resp.Credentials.SecretAccessKey,
+		Token:           resp.Credentials.SessionToken,
+		Expiration:      resp.Credentials.Expiration,
+	}.credentials()
+}
+
+// signAWSRequest signs the request with AWS Signature Version 4.
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		// values are trimmed and sequential spaces collapsed
+		headers[strings.ToLower(name)] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hexSHA256(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{awsSigningAlgorithm, amzDate, scope, hexSHA256([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsSigningAlgorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string{}, values[key]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but the unreserved characters as required by SigV4.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
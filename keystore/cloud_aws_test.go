@@ -0,0 +1,284 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clearAWSEnv(t *testing.T) {
+	for _, name := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME", "AWS_ENDPOINT_URL_STS",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	} {
+		t.Setenv(name, "")
+	}
+}
+
+// TestSignAWSRequest uses the example request of the AWS Signature Version 4 documentation.
+func TestSignAWSRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
+
+// TestSignAWSRequestTestSuite uses requests of the AWS Signature Version 4 test suite
+// (aws-sig-v4-test-suite), all signed for the service "service" in us-east-1.
+func TestSignAWSRequestTestSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		headers   [][2]string
+		body      string
+		signed    string
+		signature string
+	}{
+		{
+			name:      "get-vanilla",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "get-vanilla-empty-query-key",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		{
+			name:      "get-vanilla-query-order-key-case",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:      "get-vanilla-utf8-query",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/?%E1%88%B4=bar",
+			signed:    "host;x-amz-date",
+			signature: "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04",
+		},
+		{
+			name:      "get-header-key-duplicate",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			headers:   [][2]string{{"My-Header1", "value2"}, {"My-Header1", "value2"}, {"My-Header1", "value1"}},
+			signed:    "host;my-header1;x-amz-date",
+			signature: "c9d5ea9f3f72853aea855b47ea873832890dbdd183b4468f858259531a5138ea",
+		},
+		{
+			name:      "get-header-value-trim",
+			method:    http.MethodGet,
+			url:       "https://example.amazonaws.com/",
+			headers:   [][2]string{{"My-Header1", " value1"}, {"My-Header2", ` "a   b   c"`}},
+			signed:    "host;my-header1;my-header2;x-amz-date",
+			signature: "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736",
+		},
+		{
+			name:      "post-vanilla",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:      "post-x-www-form-urlencoded",
+			method:    http.MethodPost,
+			url:       "https://example.amazonaws.com/",
+			headers:   [][2]string{{"Content-Type", "application/x-www-form-urlencoded"}},
+			body:      "Param1=value1",
+			signed:    "content-type;host;x-amz-date",
+			signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			for _, h := range tc.headers {
+				req.Header.Add(h[0], h[1])
+			}
+
+			signAWSRequest(req, []byte(tc.body), creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+			assert.Equal(t,
+				"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+					"SignedHeaders="+tc.signed+", Signature="+tc.signature,
+				req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func awsSecretsManagerServer(t *testing.T, expectedToken string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"), r.Header.Get("Authorization"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/secretsmanager/aws4_request")
+		assert.Equal(t, expectedToken, r.Header.Get("X-Amz-Security-Token"))
+
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body["SecretId"] {
+		case "es/password":
+			_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": "changeme"})
+		case "es/cert":
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"SecretBinary": []byte{0, 1, 2}})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAWSSecretsManagerEnvCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_REGION", "us-west-2")
+	srv := awsSecretsManagerServer(t, "")
+
+	p := newAWSSecretsManager(AWSSecretsManagerConfig{Endpoint: srv.URL}, srv.Client())
+	v, err := p.getSecret(t.Context(), "es/password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+
+	v, err = p.getSecret(t.Context(), "es/cert")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, v)
+
+	_, err = p.getSecret(t.Context(), "missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+}
+
+func TestAWSSecretsManagerInstanceCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	srv := awsSecretsManagerServer(t, "SESSION")
+
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			assert.Equal(t, http.MethodPut, r.Method)
+			_, _ = w.Write([]byte("imds-token"))
+			return
+		}
+		if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/placement/region":
+			_, _ = w.Write([]byte("us-west-2"))
+		case "/latest/meta-data/iam/security-credentials/":
+			_, _ = w.Write([]byte("agent-role"))
+		case "/latest/meta-data/iam/security-credentials/agent-role":
+			_ = json.NewEncoder(w).Encode(awsMetadataCredentials{
+				AccessKeyID: "AKID", SecretAccessKey: "SECRET", Token: "SESSION", Expiration: time.Now().Add(time.Hour),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer imds.Close()
+
+	p := newAWSSecretsManager(AWSSecretsManagerConfig{Endpoint: srv.URL}, srv.Client())
+	p.imdsURL = imds.URL
+	v, err := p.getSecret(t.Context(), "es/password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+}
+
+func TestAWSSecretsManagerContainerCredentials(t *testing.T) {
+	clearAWSEnv(t)
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/v2/credentials/abc")
+	srv := awsSecretsManagerServer(t, "SESSION")
+
+	ecs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/credentials/abc", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(awsMetadataCredentials{AccessKeyID: "AKID", SecretAccessKey: "SECRET", Token: "SESSION"})
+	}))
+	defer ecs.Close()
+
+	p := newAWSSecretsManager(AWSSecretsManagerConfig{Endpoint: srv.URL}, srv.Client())
+	p.ecsURL = ecs.URL
+	v, err := p.getSecret(t.Context(), "es/password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+}
+
+func TestAWSSecretsManagerWebIdentity(t *testing.T) {
+	clearAWSEnv(t)
+	srv := awsSecretsManagerServer(t, "SESSION")
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/agent", r.Form.Get("RoleArn"))
+		assert.Equal(t, "eks-token", r.Form.Get("WebIdentityToken"))
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>AKID</AccessKeyId>
+      <SecretAccessKey>SECRET</SecretAccessKey>
+      <SessionToken>SESSION</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	}))
+	defer sts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("eks-token\n"), 0o600))
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/agent")
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+
+	p := newAWSSecretsManager(AWSSecretsManagerConfig{Endpoint: srv.URL}, srv.Client())
+	v, err := p.getSecret(t.Context(), "es/password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+}
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azureIMDSURL          = "http://169.254.169.254"
+	azureAuthorityHost    = "https://login.microsoftonline.com/"
+	azureKeyVaultResource = "https://vault.azure.net"
+	azureKeyVaultAPI      = "7.4"
+)
+
+// AzureKeyVaultConfig configures Azure Key Vault. The access token is obtained with the AKS
+// Workload Identity when AZURE_FEDERATED_TOKEN_FILE is set, otherwise from the managed identity
+// of the instance. Characters other than letters, digits and dashes in the key are replaced with
+// dashes to form a valid secret name.
+type AzureKeyVaultConfig struct {
+	// VaultURL is the URL of the vault, for example https://myvault.vault.azure.net.
+	VaultURL string `config:"vault_url"`
+	// ClientID selects a user-assigned managed identity, defaults to AZURE_CLIENT_ID.
+	ClientID string `config:"client_id"`
+}
+
+type azureKeyVault struct {
+	cfg    AzureKeyVaultConfig
+	client *http.Client
+	now    func() time.Time
+
+	imdsURL string
+	token   *cachedValue[string]
+}
+
+func newAzureKeyVault(cfg AzureKeyVaultConfig, client *http.Client) *azureKeyVault {
+	if cfg.ClientID == "" {
+		cfg.ClientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	p := &azureKeyVault{
+		cfg:     cfg,
+		client:  client,
+		now:     time.Now,
+		imdsURL: azureIMDSURL,
+	}
+	p.token = newCachedValue(p.fetchToken)
+	return p
+}
+
+func (p *azureKeyVault) getSecret(ctx context.Context, name string) ([]byte, error) {
+	token, err := p.token.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve Azure access token: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/secrets/%s?api-version=%s",
+		strings.TrimSuffix(p.cfg.VaultURL, "/"), url.PathEscape(azureSecretName(name)), azureKeyVaultAPI)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := doCloudRequest(p.client, req, &resp); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, err
+	}
+	return []byte(resp.Value), nil
+}
+
+// azureSecretName maps a key to the characters allowed in Key Vault secret names.
+func azureSecretName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// azureToken is the token response of both IMDS and Microsoft Entra ID, IMDS encodes
+// expires_in as a string.
+type azureToken struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+func (p *azureKeyVault) fetchToken(ctx context.Context) (string, time.Time, error) {
+	var req *http.Request
+	var err error
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		req, err = p.workloadIdentityRequest(ctx, tokenFile)
+	} else {
+		req, err = p.managedIdentityRequest(ctx)
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	var token azureToken
+	if err := doCloudRequest(p.client, req, &token); err != nil {
+		return "", time.Time{}, err
+	}
+	expiresIn, err := strconv.Atoi(token.ExpiresIn.String())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid token expiration %q: %w", token.ExpiresIn, err)
+	}
+	return token.AccessToken, p.now().Add(time.Duration(expiresIn) * time.Second), nil
+}
+
+func (p *azureKeyVault) managedIdentityRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {azureKeyVaultResource},
+	}
+	if p.cfg.ClientID != "" {
+		query.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.imdsURL+"/metadata/identity/oauth2/token?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+func (p *azureKeyVault) workloadIdentityRequest(ctx context.Context, tokenFile string) (*http.Request, error) {
+	assertion, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read federated token: %w", err)
+	}
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	if tenant == "" || p.cfg.ClientID == "" {
+		return nil, fmt.Errorf("AZURE_TENANT_ID and a client ID are required for workload identity")
+	}
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = azureAuthorityHost
+	}
+
+	form := url.Values{
+		"client_id":             {p.cfg.ClientID},
+		"scope":                 {azureKeyVaultResource + "/.default"},
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	u := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func azureKeyVaultServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, "true", r.Header.Get("Metadata"))
+			assert.Equal(t, "https://vault.azure.net", r.URL.Query().Get("resource"))
+			assert.Equal(t, "user-assigned", r.URL.Query().Get("client_id"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "azure-token", "expires_in": "3599"})
+		case "/tenant/oauth2/v2.0/token":
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "aks-token", r.Form.Get("client_assertion"))
+			assert.Equal(t, "user-assigned", r.Form.Get("client_id"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "azure-token", "expires_in": 3599})
+		case "/secrets/es-password":
+			assert.Equal(t, "Bearer azure-token", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"value": "changeme"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":"SecretNotFound"}}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAzureKeyVaultManagedIdentity(t *testing.T) {
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	srv := azureKeyVaultServer(t)
+
+	p := newAzureKeyVault(AzureKeyVaultConfig{VaultURL: srv.URL, ClientID: "user-assigned"}, srv.Client())
+	p.imdsURL = srv.URL
+
+	v, err := p.getSecret(t.Context(), "es.password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+
+	_, err = p.getSecret(t.Context(), "missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+}
+
+func TestAzureKeyVaultWorkloadIdentity(t *testing.T) {
+	srv := azureKeyVaultServer(t)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("aks-token"), 0o600))
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "user-assigned")
+	t.Setenv("AZURE_AUTHORITY_HOST", srv.URL)
+
+	p := newAzureKeyVault(AzureKeyVaultConfig{VaultURL: srv.URL}, srv.Client())
+	v, err := p.getSecret(t.Context(), "es.password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+}
+
+func TestAzureSecretName(t *testing.T) {
+	assert.Equal(t, "output-elasticsearch-api-key", azureSecretName("output.elasticsearch.api_key"))
+}
@@ -0,0 +1,153 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	gcpMetadataHost       = "metadata.google.internal"
+	gcpSecretManagerURL   = "https://secretmanager.googleapis.com"
+	gcpDefaultVersion     = "latest"
+	gcpMetadataFlavorName = "Metadata-Flavor"
+)
+
+// GCPSecretManagerConfig configures GCP Secret Manager. The access token is obtained from the
+// metadata server, which serves the attached service account on GCE and the Workload Identity
+// on GKE. Dots in the key are replaced with underscores to form a valid secret name.
+type GCPSecretManagerConfig struct {
+	// Project defaults to the project of the instance.
+	Project string `config:"project"`
+	// Version of the secrets to access, defaults to "latest".
+	Version string `config:"version"`
+	// Endpoint overrides the Secret Manager endpoint, for example for regional endpoints.
+	Endpoint string `config:"endpoint"`
+}
+
+type gcpSecretManager struct {
+	cfg    GCPSecretManagerConfig
+	client *http.Client
+	now    func() time.Time
+
+	metadataURL string
+
+	project *cachedValue[string]
+	token   *cachedValue[string]
+}
+
+func newGCPSecretManager(cfg GCPSecretManagerConfig, client *http.Client) *gcpSecretManager {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = gcpMetadataHost
+	}
+	p := &gcpSecretManager{
+		cfg:         cfg,
+		client:      client,
+		now:         time.Now,
+		metadataURL: "http://" + host,
+	}
+	p.project = newCachedValue(p.fetchProject)
+	p.token = newCachedValue(p.fetchToken)
+	return p
+}
+
+func (p *gcpSecretManager) getSecret(ctx context.Context, name string) ([]byte, error) {
+	project, err := p.project.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine the GCP project: %w", err)
+	}
+	token, err := p.token.get(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve GCP access token: %w", err)
+	}
+
+	endpoint := p.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = gcpSecretManagerURL
+	}
+	version := p.cfg.Version
+	if version == "" {
+		version = gcpDefaultVersion
+	}
+	secret := strings.ReplaceAll(name, ".", "_")
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access",
+		endpoint, url.PathEscape(project), url.PathEscape(secret), url.PathEscape(version))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := doCloudRequest(p.client, req, &resp); err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, err
+	}
+	value, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode secret payload: %w", err)
+	}
+	return value, nil
+}
+
+func (p *gcpSecretManager) fetchProject(ctx context.Context) (string, time.Time, error) {
+	if p.cfg.Project != "" {
+		return p.cfg.Project, time.Time{}, nil
+	}
+	var project string
+	err := p.metadataGet(ctx, "/computeMetadata/v1/project/project-id", &project)
+	return strings.TrimSpace(project), time.Time{}, err
+}
+
+func (p *gcpSecretManager) fetchToken(ctx context.Context) (string, time.Time, error) {
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := p.metadataGet(ctx, "/computeMetadata/v1/instance/service-accounts/default/token", &resp); err != nil {
+		return "", time.Time{}, err
+	}
+	return resp.AccessToken, p.now().Add(time.Duration(resp.ExpiresIn) * time.Second), nil
+}
+
+func (p *gcpSecretManager) metadataGet(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadataURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(gcpMetadataFlavorName, "Google")
+	if err := doCloudRequest(p.client, req, out); err != nil {
+		return fmt.Errorf("metadata server: %w", err)
+	}
+	return nil
+}
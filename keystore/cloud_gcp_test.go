@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCPSecretManager(t *testing.T) {
+	tokens := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/project/project-id":
+			assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			_, _ = w.Write([]byte("my-project"))
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			tokens++
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "gcp-token", "expires_in": 3599, "token_type": "Bearer"})
+		case "/v1/projects/my-project/secrets/es_password/versions/latest:access":
+			assert.Equal(t, "Bearer gcp-token", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("changeme"))}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := newGCPSecretManager(GCPSecretManagerConfig{Endpoint: srv.URL}, srv.Client())
+	p.metadataURL = srv.URL
+
+	v, err := p.getSecret(t.Context(), "es.password")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("changeme"), v)
+
+	_, err = p.getSecret(t.Context(), "missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+	assert.Equal(t, 1, tokens, "the access token must be cached")
+}
@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+type fakeProvider map[string]string
+
+func (f fakeProvider) getSecret(_ context.Context, name string) ([]byte, error) {
+	if name == "broken" {
+		return nil, errors.New("boom")
+	}
+	v, ok := f[name]
+	if !ok {
+		return nil, ErrKeyDoesntExists
+	}
+	return []byte(v), nil
+}
+
+func TestCloudKeystoreRouting(t *testing.T) {
+	k := &CloudKeystore{timeout: time.Second}
+	k.providers = []prefixedProvider{
+		{prefix: "aws.prod.", provider: fakeProvider{"password": "prod"}},
+		{prefix: "aws.", provider: fakeProvider{"password": "default", "prod.other": "other"}},
+	}
+
+	v, err := k.Retrieve("aws.prod.password")
+	require.NoError(t, err)
+	assertSecret(t, "prod", v)
+
+	v, err = k.Retrieve("aws.password")
+	require.NoError(t, err)
+	assertSecret(t, "default", v)
+
+	_, err = k.Retrieve("aws.prod.other")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists, "the most specific prefix must win")
+
+	_, err = k.Retrieve("gcp.password")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	_, err = k.Retrieve("aws.")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	_, err = k.Retrieve("aws.broken")
+	assert.ErrorContains(t, err, "boom")
+
+	_, err = AsWritableKeystore(k)
+	assert.ErrorIs(t, err, ErrNotWritable)
+}
+
+func TestCloudConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg map[string]interface{}
+		err string
+	}{
+		"no providers": {
+			cfg: map[string]interface{}{},
+			err: "at least one cloud provider",
+		},
+		"no provider type": {
+			cfg: map[string]interface{}{"providers": []interface{}{map[string]interface{}{"prefix": "a."}}},
+			err: "exactly one of aws, gcp or azure",
+		},
+		"two provider types": {
+			cfg: map[string]interface{}{"providers": []interface{}{map[string]interface{}{"prefix": "a.", "aws.region": "x", "gcp.project": "y"}}},
+			err: "exactly one of aws, gcp or azure",
+		},
+		"duplicate prefix": {
+			cfg: map[string]interface{}{"providers": []interface{}{
+				map[string]interface{}{"prefix": "a.", "aws.region": "x"},
+				map[string]interface{}{"prefix": "a.", "gcp.project": "y"},
+			}},
+			err: "configured more than once",
+		},
+		"azure without vault": {
+			cfg: map[string]interface{}{"providers": []interface{}{map[string]interface{}{"prefix": "a.", "azure.client_id": "x"}}},
+			err: "vault_url is required",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := config.MustNewConfigFrom(map[string]interface{}{"backend": "cloud", "cloud": tc.cfg})
+			_, err := Factory(c, "", false)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	c := config.MustNewConfigFrom(map[string]interface{}{"backend": "cloud", "cloud.providers": []interface{}{
+		map[string]interface{}{"prefix": "aws.", "aws.region": "us-east-1"},
+		map[string]interface{}{"prefix": "gcp.", "gcp.project": "p"},
+		map[string]interface{}{"prefix": "azure.", "azure.vault_url": "https://v.vault.azure.net"},
+	}})
+	k, err := Factory(c, "", false)
+	require.NoError(t, err)
+	require.IsType(t, &CloudKeystore{}, k)
+	assert.Len(t, k.(*CloudKeystore).providers, 3)
+}
+
+func TestCachedValue(t *testing.T) {
+	now := time.Now()
+	calls := 0
+	c := newCachedValue(func(context.Context) (int, time.Time, error) {
+		calls++
+		return calls, now.Add(time.Hour), nil
+	})
+	c.now = func() time.Time { return now }
+
+	v, err := c.get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	now = now.Add(50 * time.Minute)
+	v, _ = c.get(context.Background())
+	assert.Equal(t, 1, v)
+
+	// Refreshed within the refresh window before expiration.
+	now = now.Add(6 * time.Minute)
+	v, _ = c.get(context.Background())
+	assert.Equal(t, 2, v)
+}
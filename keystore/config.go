@@ -17,13 +17,75 @@
 
 package keystore
 
+import "fmt"
+
+const (
+	// BackendFile stores the secrets in an encrypted file on disk.
+	BackendFile = "file"
+
+	// BackendNative stores the secrets in the credential store of the operating system:
+	// the Keychain on macOS, the Credential Manager on Windows and the Secret Service
+	// (libsecret) on Linux.
+	BackendNative = "native"
+
+	// BackendVault stores the secrets in a HashiCorp Vault KV v2 secret.
+	BackendVault = "vault"
+
+	// BackendCloud retrieves the secrets from AWS Secrets Manager, GCP Secret Manager or
+	// Azure Key Vault.
+	BackendCloud = "cloud"
+
+	// DefaultService is the service name used to namespace the secrets in the native backend.
+	DefaultService = "elastic-keystore"
+)
+
 // Config Define keystore configurable options
 type Config struct {
-	Path string `config:"path"`
+	Path    string `config:"path"`
+	Backend string `config:"backend"`
+	Service string `config:"service"`
+
+	// Encryption configures the encryption of the file backend, the legacy format is used
+	// when unset.
+	Encryption *EncryptionParams `config:"encryption"`
+
+	// Vault configures the vault backend.
+	Vault VaultConfig `config:"vault"`
+
+	// Cloud configures the cloud backend.
+	Cloud CloudConfig `config:"cloud"`
 }
 
 func defaultConfig() Config {
 	return Config{
-		Path: "",
+		Path:    "",
+		Backend: BackendFile,
+		Service: DefaultService,
+		Vault:   defaultVaultConfig(),
+		Cloud:   defaultCloudConfig(),
+	}
+}
+
+// Validate checks that the configured backend is supported.
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case BackendFile, BackendNative, BackendVault, BackendCloud:
+	default:
+		return fmt.Errorf("unknown keystore backend %q, must be one of %q, %q, %q or %q", c.Backend, BackendFile, BackendNative, BackendVault, BackendCloud)
+	}
+	if c.Backend == BackendNative && c.Service == "" {
+		return fmt.Errorf("keystore service cannot be empty when using the %q backend", BackendNative)
+	}
+	if c.Encryption != nil {
+		if err := c.Encryption.WithDefaults().Validate(); err != nil {
+			return fmt.Errorf("invalid keystore encryption: %w", err)
+		}
+	}
+	switch c.Backend {
+	case BackendVault:
+		return c.Vault.validate()
+	case BackendCloud:
+		return c.Cloud.validate()
 	}
+	return nil
 }
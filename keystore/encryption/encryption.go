@@ -0,0 +1,303 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package encryption implements the configurable key derivation and authenticated encryption
+// shared by the file keystore and the encrypted configurations. The parameters are written in
+// the header of the encrypted payload so they can be hardened over time while the data encrypted
+// with older parameters stays readable.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KDFPBKDF2   = "pbkdf2-sha512"
+	KDFScrypt   = "scrypt"
+	KDFArgon2id = "argon2id"
+
+	CipherAES256GCM         = "aes-256-gcm"
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+
+	saltLength = 64
+	keyLength  = 32
+
+	// Upper bounds of the parameters read from a header, so crafted data cannot make the key
+	// derivation exhaust the resources of the host.
+	maxKDFIterations  = 10_000_000
+	maxKDFMemoryKiB   = 4 * 1024 * 1024
+	maxKDFParallelism = 64
+	maxScryptN        = 1 << 22
+)
+
+// errMissingData is returned when the payload is too short to be decrypted.
+var errMissingData = errors.New("missing information in the payload for decrypting the data")
+
+// Params configures how the key is derived from the password and which AEAD encrypts the data.
+type Params struct {
+	KDF    KDFParams `config:"kdf" json:"kdf"`
+	Cipher string    `config:"cipher" json:"cipher"`
+}
+
+// KDFParams configures the key derivation function, unset parameters use the defaults of the
+// algorithm.
+type KDFParams struct {
+	Algorithm string `config:"algorithm" json:"algorithm"`
+
+	// Iterations of pbkdf2 or passes of argon2id.
+	Iterations uint32 `config:"iterations" json:"iterations,omitempty"`
+	// Memory used by argon2id in KiB.
+	Memory uint32 `config:"memory" json:"memory,omitempty"`
+	// Parallelism is the number of argon2id threads or the scrypt p parameter.
+	Parallelism uint8 `config:"parallelism" json:"parallelism,omitempty"`
+	// N and R are the scrypt CPU/memory cost and block size.
+	N uint32 `config:"n" json:"n,omitempty"`
+	R uint32 `config:"r" json:"r,omitempty"`
+}
+
+// DefaultParams returns the parameters recommended for new data, argon2id or pbkdf2 in FIPS
+// builds.
+func DefaultParams() Params {
+	if requireFIPS {
+		return Params{KDF: KDFParams{Algorithm: KDFPBKDF2}, Cipher: CipherAES256GCM}
+	}
+	return Params{KDF: KDFParams{Algorithm: KDFArgon2id}, Cipher: CipherAES256GCM}
+}
+
+// WithDefaults fills the unset parameters with the defaults of the algorithms.
+func (p Params) WithDefaults() Params {
+	if p.KDF.Algorithm == "" {
+		p.KDF.Algorithm = DefaultParams().KDF.Algorithm
+	}
+	if p.Cipher == "" {
+		p.Cipher = CipherAES256GCM
+	}
+	switch p.KDF.Algorithm {
+	case KDFPBKDF2:
+		if p.KDF.Iterations == 0 {
+			p.KDF.Iterations = 210_000
+		}
+	case KDFScrypt:
+		if p.KDF.N == 0 {
+			p.KDF.N = 1 << 15
+		}
+		if p.KDF.R == 0 {
+			p.KDF.R = 8
+		}
+		if p.KDF.Parallelism == 0 {
+			p.KDF.Parallelism = 1
+		}
+	case KDFArgon2id:
+		if p.KDF.Iterations == 0 {
+			p.KDF.Iterations = 3
+		}
+		if p.KDF.Memory == 0 {
+			p.KDF.Memory = 64 * 1024
+		}
+		if p.KDF.Parallelism == 0 {
+			p.KDF.Parallelism = 4
+		}
+	}
+	return p
+}
+
+// Validate checks the algorithms are supported by the build and the parameters are in range.
+// The parameters must be set, see WithDefaults.
+func (p Params) Validate() error {
+	switch p.KDF.Algorithm {
+	case KDFPBKDF2:
+		if p.KDF.Iterations < 1 || p.KDF.Iterations > maxKDFIterations {
+			return fmt.Errorf("pbkdf2 iterations must be between 1 and %d", maxKDFIterations)
+		}
+	case KDFScrypt:
+		if requireFIPS {
+			return fmt.Errorf("key derivation function %q is not allowed in FIPS mode", p.KDF.Algorithm)
+		}
+		if p.KDF.N > maxScryptN || p.KDF.N < 2 || p.KDF.N&(p.KDF.N-1) != 0 {
+			return fmt.Errorf("scrypt N must be a power of two between 2 and %d", maxScryptN)
+		}
+		if p.KDF.R < 1 || p.KDF.Parallelism < 1 {
+			return errors.New("scrypt r and p must be at least 1")
+		}
+		if uint64(p.KDF.N)*uint64(p.KDF.R)*128 > maxKDFMemoryKiB*1024 {
+			return errors.New("scrypt parameters exceed the allowed maximum memory")
+		}
+		if p.KDF.Parallelism > maxKDFParallelism {
+			return fmt.Errorf("parallelism %d exceeds the maximum of %d", p.KDF.Parallelism, maxKDFParallelism)
+		}
+	case KDFArgon2id:
+		if requireFIPS {
+			return fmt.Errorf("key derivation function %q is not allowed in FIPS mode", p.KDF.Algorithm)
+		}
+		if p.KDF.Iterations < 1 || p.KDF.Parallelism < 1 {
+			return errors.New("argon2id passes and parallelism must be at least 1")
+		}
+		if p.KDF.Iterations > maxKDFIterations || p.KDF.Memory > maxKDFMemoryKiB {
+			return errors.New("argon2id parameters exceed the allowed maximums")
+		}
+		if p.KDF.Parallelism > maxKDFParallelism {
+			return fmt.Errorf("parallelism %d exceeds the maximum of %d", p.KDF.Parallelism, maxKDFParallelism)
+		}
+	case "":
+	default:
+		return fmt.Errorf("unknown key derivation function %q", p.KDF.Algorithm)
+	}
+
+	switch p.Cipher {
+	case CipherAES256GCM, "":
+	case CipherXChaCha20Poly1305:
+		if requireFIPS {
+			return fmt.Errorf("cipher %q is not allowed in FIPS mode", p.Cipher)
+		}
+	default:
+		return fmt.Errorf("unknown cipher %q", p.Cipher)
+	}
+	return nil
+}
+
+// deriveKey stretches the password into a 256 bits key.
+func (p Params) deriveKey(password, salt []byte) ([]byte, error) {
+	switch p.KDF.Algorithm {
+	case KDFPBKDF2:
+		return pbkdf2.Key(sha512.New, string(password), salt, int(p.KDF.Iterations), keyLength)
+	case KDFScrypt:
+		return scrypt.Key(password, salt, int(p.KDF.N), int(p.KDF.R), int(p.KDF.Parallelism), keyLength)
+	case KDFArgon2id:
+		return argon2.IDKey(password, salt, p.KDF.Iterations, p.KDF.Memory, p.KDF.Parallelism, keyLength), nil
+	}
+	return nil, fmt.Errorf("unknown key derivation function %q", p.KDF.Algorithm)
+}
+
+// newAEAD returns the cipher, both ciphers use random nonces long enough to never repeat.
+func (p Params) newAEAD(key []byte) (cipher.AEAD, error) {
+	switch p.Cipher {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCMWithRandomNonce(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("unknown cipher %q", p.Cipher)
+}
+
+// Seal encrypts data with a key derived from password. The payload is
+// HEADER LENGTH|HEADER|SALT|NONCE+CIPHERTEXT where the header describes the parameters, the
+// header is authenticated together with the additional data ad, which is not part of the payload.
+func Seal(params Params, password, data, ad []byte) ([]byte, error) {
+	params = params.WithDefaults()
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := params.deriveKey(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not derive the key: %w", err)
+	}
+	aead, err := params.newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the cipher: %w", err)
+	}
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(len(header))) //nolint:gosec // the header is a few hundred bytes
+	payload = append(payload, header...)
+	payload = append(payload, salt...)
+	if nonceSize := aead.NonceSize(); nonceSize > 0 {
+		nonce := make([]byte, nonceSize)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		payload = append(payload, nonce...)
+		return aead.Seal(payload, nonce, data, additionalData(ad, header)), nil
+	}
+	return aead.Seal(payload, nil, data, additionalData(ad, header)), nil
+}
+
+// Open decrypts a payload created by Seal with the same password and additional data, it returns
+// the parameters found in the header.
+func Open(password, payload, ad []byte) ([]byte, Params, error) {
+	var params Params
+	if len(payload) < 2 {
+		return nil, params, errMissingData
+	}
+	headerLength := int(binary.BigEndian.Uint16(payload))
+	if len(payload) < 2+headerLength+saltLength+1 {
+		return nil, params, errMissingData
+	}
+	header := payload[2 : 2+headerLength]
+	salt := payload[2+headerLength : 2+headerLength+saltLength]
+	encrypted := payload[2+headerLength+saltLength:]
+
+	if err := json.Unmarshal(header, &params); err != nil {
+		return nil, params, fmt.Errorf("invalid encryption header: %w", err)
+	}
+	if params.KDF.Algorithm == "" || params.Cipher == "" {
+		return nil, params, errors.New("invalid encryption header: missing algorithm")
+	}
+	if err := params.Validate(); err != nil {
+		return nil, params, fmt.Errorf("invalid encryption header: %w", err)
+	}
+
+	key, err := params.deriveKey(password, salt)
+	if err != nil {
+		return nil, params, fmt.Errorf("could not derive the key: %w", err)
+	}
+	aead, err := params.newAEAD(key)
+	if err != nil {
+		return nil, params, fmt.Errorf("could not create the cipher: %w", err)
+	}
+
+	var nonce []byte
+	if nonceSize := aead.NonceSize(); nonceSize > 0 {
+		if len(encrypted) < nonceSize {
+			return nil, params, errMissingData
+		}
+		nonce, encrypted = encrypted[:nonceSize], encrypted[nonceSize:]
+	}
+	data, err := aead.Open(nil, nonce, encrypted, additionalData(ad, header))
+	if err != nil {
+		return nil, params, fmt.Errorf("could not decrypt data: %w", err)
+	}
+	return data, params, nil
+}
+
+// additionalData authenticates the additional data of the caller and the header with the payload.
+func additionalData(ad, header []byte) []byte {
+	return append(append([]byte{}, ad...), header...)
+}
@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	params := Params{KDF: KDFParams{Algorithm: KDFPBKDF2, Iterations: 1000}}
+	payload, err := Seal(params, []byte("password"), []byte("data"), []byte("v3"))
+	require.NoError(t, err)
+
+	data, found, err := Open([]byte("password"), payload, []byte("v3"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+	assert.Equal(t, params.WithDefaults(), found)
+
+	_, _, err = Open([]byte("wrong"), payload, []byte("v3"))
+	assert.ErrorContains(t, err, "message authentication failed")
+
+	// The additional data is authenticated.
+	_, _, err = Open([]byte("password"), payload, []byte("v4"))
+	assert.ErrorContains(t, err, "message authentication failed")
+
+	// Changing a parameter in the header breaks the authentication.
+	tampered := bytes.Replace(payload, []byte(`"iterations":1000`), []byte(`"iterations":1001`), 1)
+	require.NotEqual(t, payload, tampered)
+	_, _, err = Open([]byte("password"), tampered, []byte("v3"))
+	assert.ErrorContains(t, err, "message authentication failed")
+
+	_, _, err = Open([]byte("password"), payload[:10], []byte("v3"))
+	assert.Error(t, err)
+}
+
+func TestSealInvalidParams(t *testing.T) {
+	_, err := Seal(Params{Cipher: "rot13"}, []byte("password"), []byte("data"), nil)
+	assert.ErrorContains(t, err, "unknown cipher")
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := map[string]struct {
+		params Params
+		err    string
+	}{
+		"unknown kdf":    {Params{KDF: KDFParams{Algorithm: "md5"}}, "unknown key derivation function"},
+		"unknown cipher": {Params{Cipher: "rot13"}, "unknown cipher"},
+		"pbkdf2 iterations": {
+			Params{KDF: KDFParams{Algorithm: KDFPBKDF2, Iterations: maxKDFIterations + 1}}, "between 1 and",
+		},
+		"pbkdf2 no iterations": {Params{KDF: KDFParams{Algorithm: KDFPBKDF2}}, "between 1 and"},
+	}
+	if !requireFIPS {
+		tests["scrypt N"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFScrypt, N: 1000}}, "power of two"}
+		tests["argon2id memory"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFArgon2id, Iterations: 1, Parallelism: 1, Memory: maxKDFMemoryKiB + 1}}, "maximums"}
+		tests["argon2id no passes"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFArgon2id, Parallelism: 1}}, "at least 1"}
+		tests["argon2id no parallelism"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFArgon2id, Iterations: 1}}, "at least 1"}
+		tests["scrypt no r"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFScrypt, N: 1024, Parallelism: 1}}, "at least 1"}
+		tests["scrypt memory"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFScrypt, N: maxScryptN, R: 1 << 20, Parallelism: 1}}, "maximum memory"}
+	} else {
+		tests["fips kdf"] = struct {
+			params Params
+			err    string
+		}{Params{KDF: KDFParams{Algorithm: KDFArgon2id}}, "not allowed in FIPS mode"}
+		tests["fips cipher"] = struct {
+			params Params
+			err    string
+		}{Params{Cipher: CipherXChaCha20Poly1305}, "not allowed in FIPS mode"}
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorContains(t, tc.params.Validate(), tc.err)
+		})
+	}
+
+	assert.NoError(t, DefaultParams().WithDefaults().Validate())
+}
+
+func TestOpenCraftedHeader(t *testing.T) {
+	craft := func(header string) []byte {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(len(header)))
+		payload = append(payload, header...)
+		return append(payload, make([]byte, saltLength+64)...)
+	}
+
+	headers := map[string]string{
+		"pbkdf2 iterations":    `{"kdf":{"algorithm":"pbkdf2-sha512","iterations":0},"cipher":"aes-256-gcm"}`,
+		"argon2id iterations":  `{"kdf":{"algorithm":"argon2id","iterations":0,"memory":64,"parallelism":1},"cipher":"aes-256-gcm"}`,
+		"argon2id parallelism": `{"kdf":{"algorithm":"argon2id","iterations":1,"memory":64,"parallelism":0},"cipher":"aes-256-gcm"}`,
+		"scrypt r":             `{"kdf":{"algorithm":"scrypt","n":16,"r":0,"parallelism":1},"cipher":"aes-256-gcm"}`,
+		"scrypt p":             `{"kdf":{"algorithm":"scrypt","n":16,"r":1,"parallelism":0},"cipher":"aes-256-gcm"}`,
+	}
+	for name, header := range headers {
+		t.Run(name, func(t *testing.T) {
+			assert.NotPanics(t, func() {
+				_, _, err := Open([]byte("password"), craft(header), nil)
+				assert.ErrorContains(t, err, "invalid encryption header")
+			})
+		})
+	}
+}
@@ -30,9 +30,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
 )
 
 const (
@@ -59,12 +61,24 @@ type FileKeystore struct {
 	dirty         bool
 	password      *SecureString
 	isStrictPerms bool
+	// params are the encryption parameters of the keystore, nil for the legacy format.
+	params *EncryptionParams
+
+	// changed holds the keys modified since the last save, watchers are notified on save.
+	changed  map[string]struct{}
+	watchers keyWatchers
+	watch    fileWatch
 }
 
 // Allow the original SecureString type to be correctly serialized to json.
 type serializableSecureString struct {
 	*SecureString
 	Value []byte `json:"value"`
+
+	// Version is incremented every time the secret is stored, Updated is the time of the last
+	// change. Keystores written before entries were versioned have a zero version.
+	Version int       `json:"version,omitempty"`
+	Updated time.Time `json:"updated,omitzero"`
 }
 
 // Factory Create the right keystore with the configured options.
@@ -80,10 +94,31 @@ func Factory(c *config.C, defaultPath string, strictPerms bool) (Keystore, error
 		return nil, fmt.Errorf("could not read keystore configuration, err: %w", err)
 	}
 
+	switch cfg.Backend {
+	case BackendNative:
+		keystore, err := NewNativeKeystore(cfg.Service)
+		if err != nil {
+			return nil, err
+		}
+		return keystore, nil
+	case BackendVault:
+		return NewVaultKeystore(cfg.Vault, logp.NewLogger("keystore"))
+	case BackendCloud:
+		keystore, err := NewCloudKeystore(cfg.Cloud)
+		if err != nil {
+			return nil, err
+		}
+		return keystore, nil
+	}
+
 	if cfg.Path == "" {
 		cfg.Path = defaultPath
 	}
 
+	if cfg.Encryption != nil {
+		return NewFileKeystoreWithParams(cfg.Path, NewSecureString([]byte("")), strictPerms, *cfg.Encryption)
+	}
+
 	keystore, err := NewFileKeystoreWithStrictPerms(cfg.Path, strictPerms)
 	return keystore, err
 }
@@ -121,6 +156,28 @@ func NewFileKeystoreWithPasswordAndStrictPerms(keystoreFile string, password *Se
 	return &keystore, nil
 }
 
+// NewFileKeystoreWithParams returns a new File based keystore saved with the given encryption
+// parameters, existing keystores are read whatever parameters they were written with and
+// converted on the next save.
+func NewFileKeystoreWithParams(keystoreFile string, password *SecureString, strictPerms bool, params EncryptionParams) (Keystore, error) {
+	params = params.WithDefaults()
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	keystore := FileKeystore{
+		Path:          keystoreFile,
+		password:      password,
+		secrets:       make(map[string]serializableSecureString),
+		isStrictPerms: strictPerms,
+		params:        &params,
+	}
+	if err := keystore.load(); err != nil {
+		return nil, err
+	}
+	return &keystore, nil
+}
+
 // NewFileKeystoreWithPassword return a new File based keystore or an error, allow to define what
 // password to use to create the keystore.
 func NewFileKeystoreWithPassword(keystoreFile string, password *SecureString) (Keystore, error) {
@@ -148,7 +205,12 @@ func (k *FileKeystore) Store(key string, value []byte) error {
 	k.Lock()
 	defer k.Unlock()
 
-	k.secrets[key] = serializableSecureString{Value: value}
+	k.secrets[key] = serializableSecureString{
+		Value:   value,
+		Version: k.secrets[key].Version + 1,
+		Updated: time.Now().UTC(),
+	}
+	k.markChanged(key)
 	k.dirty = true
 	return nil
 }
@@ -159,6 +221,7 @@ func (k *FileKeystore) Delete(key string) error {
 	defer k.Unlock()
 
 	delete(k.secrets, key)
+	k.markChanged(key)
 	k.dirty = true
 	return nil
 }
@@ -201,6 +264,9 @@ func (k *FileKeystore) GetConfig() (*config.C, error) {
 // Create create an empty keystore, if the store already exist we will return an error.
 func (k *FileKeystore) Create(override bool) error {
 	k.Lock()
+	for key := range k.secrets {
+		k.markChanged(key)
+	}
 	k.secrets = make(map[string]serializableSecureString)
 	k.dirty = true
 	err := k.doSave(override)
@@ -234,14 +300,28 @@ func (k *FileKeystore) doSave(override bool) error {
 	temporaryPath := fmt.Sprintf("%s.tmp", k.Path)
 
 	w := new(bytes.Buffer)
+	// Records in the encrypted content that the file is sealed, so removing the integrity tag
+	// is detected.
+	w.Write(sealedMarker)
 	jsonEncoder := json.NewEncoder(w)
 	if err := jsonEncoder.Encode(k.secrets); err != nil {
 		return fmt.Errorf("cannot serialize the keystore before saving it to disk: %w", err)
 	}
 
-	encrypted, err := k.encrypt(w)
-	if err != nil {
-		return fmt.Errorf("cannot encrypt the keystore: %w", err)
+	fileVersion := version
+	var encrypted io.Reader
+	if k.params != nil {
+		fileVersion = versionParams
+		payload, err := k.encryptWithParams(w.Bytes())
+		if err != nil {
+			return fmt.Errorf("cannot encrypt the keystore: %w", err)
+		}
+		encrypted = bytes.NewReader(payload)
+	} else {
+		var err error
+		if encrypted, err = k.encrypt(w); err != nil {
+			return fmt.Errorf("cannot encrypt the keystore: %w", err)
+		}
 	}
 
 	flags := os.O_RDWR | os.O_CREATE
@@ -256,10 +336,19 @@ func (k *FileKeystore) doSave(override bool) error {
 		return fmt.Errorf("cannot open file to save the keystore to '%s', error: %w", k.Path, err)
 	}
 
-	_, _ = f.Write(version)
-	base64Encoder := base64.NewEncoder(base64.StdEncoding, f)
+	content := bytes.NewBuffer(sealedVersion(fileVersion))
+	base64Encoder := base64.NewEncoder(base64.StdEncoding, content)
 	_, _ = io.Copy(base64Encoder, encrypted)
 	base64Encoder.Close()
+
+	sealed, err := k.seal(content.Bytes())
+	if err != nil {
+		f.Close()
+		os.Remove(temporaryPath)
+		return fmt.Errorf("cannot protect the keystore integrity: %w", err)
+	}
+
+	_, _ = f.Write(sealed)
 	_ = f.Sync()
 	f.Close()
 
@@ -271,6 +360,7 @@ func (k *FileKeystore) doSave(override bool) error {
 	os.Remove(temporaryPath)
 
 	k.dirty = false
+	k.notifyChanged()
 	return nil
 }
 
@@ -289,9 +379,12 @@ func (k *FileKeystore) loadRaw() ([]byte, error) {
 		}
 	}
 
-	v := raw[0:len(version)]
-	if !bytes.Equal(v, version) {
-		return nil, fmt.Errorf("keystore format doesn't match expected version: '%s' got '%s'", version, v)
+	if len(raw) < len(version) {
+		return nil, fmt.Errorf("corrupt or empty keystore")
+	}
+	v := unsealedVersion(raw[0:len(version)])
+	if !bytes.Equal(v, version) && !bytes.Equal(v, versionParams) {
+		return nil, fmt.Errorf("keystore format doesn't match expected version: '%s' got '%s'", version, raw[0:len(version)])
 	}
 
 	if len(raw) <= len(version) {
@@ -314,13 +407,48 @@ func (k *FileKeystore) load() error {
 		return nil
 	}
 
+	params, err := k.open(raw, &k.secrets)
+	if err != nil {
+		return err
+	}
+	// Keep the parameters of the file when saving unless others were configured.
+	if k.params == nil {
+		k.params = params
+	}
+	return nil
+}
+
+// decode decrypts the raw content of the keystore file into secrets, returning the encryption
+// parameters found in the header or nil for the legacy format. It reports whether the content
+// was written by a keystore sealing its files.
+func (k *FileKeystore) decode(raw []byte, secrets *map[string]serializableSecureString) (*EncryptionParams, bool, error) {
 	base64Decoder := base64.NewDecoder(base64.StdEncoding, bytes.NewReader(raw[len(version):]))
-	plaintext, err := k.decrypt(base64Decoder)
+
+	var params *EncryptionParams
+	var plaintext io.Reader
+	if bytes.HasPrefix(raw, versionParams) {
+		payload, err := io.ReadAll(base64Decoder)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not decrypt the keystore: %w", err)
+		}
+		data, fileParams, err := k.decryptWithParams(payload)
+		if err != nil {
+			return nil, false, fmt.Errorf("could not decrypt the keystore: %w", err)
+		}
+		params, plaintext = &fileParams, bytes.NewReader(data)
+	} else {
+		var err error
+		if plaintext, err = k.decrypt(base64Decoder); err != nil {
+			return nil, false, fmt.Errorf("could not decrypt the keystore: %w", err)
+		}
+	}
+
+	data, err := io.ReadAll(plaintext)
 	if err != nil {
-		return fmt.Errorf("could not decrypt the keystore: %w", err)
+		return nil, false, fmt.Errorf("could not decrypt the keystore: %w", err)
 	}
-	jsonDecoder := json.NewDecoder(plaintext)
-	return jsonDecoder.Decode(&k.secrets)
+	data, sealed := bytes.CutPrefix(data, sealedMarker)
+	return params, sealed, json.Unmarshal(data, secrets)
 }
 
 // checkPermission enforces permission on the keystore file itself, the file should have strict
@@ -0,0 +1,207 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTampered is returned when the keystore file was modified outside of the keystore.
+	ErrTampered = errors.New("the keystore integrity check failed, the file was modified out of band")
+
+	// ErrIntegrityMissing is returned by Verify when the keystore was written before integrity
+	// protection existed, the tag is added on the next save.
+	ErrIntegrityMissing = errors.New("the keystore has no integrity tag")
+)
+
+const (
+	// integrityMarker separates the encrypted content of the file from its integrity tag.
+	integrityMarker     = "\nintegrity:"
+	integritySaltLength = 16
+
+	// integrityCheckLabel is authenticated to tell a wrong password from a tampered file.
+	integrityCheckLabel = "elastic-keystore-password-check"
+)
+
+// sealedMarker prefixes the encrypted content of the files written with an integrity tag, a
+// sealed file without tag was tampered with.
+var sealedMarker = []byte("sealed\n")
+
+// sealedVersionPrefix replaces the `v` of the version of the files written with an integrity tag,
+// e.g. `s1` for `v1`, so keystores older than integrity protection reject them as an unsupported
+// version.
+const sealedVersionPrefix = 's'
+
+// sealedVersion returns the version written at the beginning of sealed files.
+func sealedVersion(v []byte) []byte {
+	sealed := append([]byte{}, v...)
+	sealed[0] = sealedVersionPrefix
+	return sealed
+}
+
+// isSealedVersion reports whether the file starts with the version of a sealed file.
+func isSealedVersion(raw []byte) bool {
+	return len(raw) > 0 && raw[0] == sealedVersionPrefix
+}
+
+// unsealedVersion returns the content of a sealed file starting with the version of the
+// encryption format.
+func unsealedVersion(content []byte) []byte {
+	if !isSealedVersion(content) {
+		return content
+	}
+	unsealed := append([]byte{}, content...)
+	unsealed[0] = 'v'
+	return unsealed
+}
+
+// The integrity tag is base64(SALT|CHECK|MAC): the HMAC key is derived from the keystore password
+// and SALT, CHECK authenticates a fixed label and MAC authenticates the version and the encrypted
+// content of the file.
+
+// seal appends the integrity tag to the content of the keystore file.
+func (k *FileKeystore) seal(content []byte) ([]byte, error) {
+	salt, err := randomBytes(integritySaltLength)
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.integrityKey(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := append(salt, integrityMAC(key, []byte(integrityCheckLabel))...)
+	tag = append(tag, integrityMAC(key, content)...)
+
+	sealed := append([]byte{}, content...)
+	sealed = append(sealed, integrityMarker...)
+	return append(sealed, base64.StdEncoding.EncodeToString(tag)...), nil
+}
+
+// open verifies the integrity of the raw keystore file and decrypts the secrets. Files written
+// before integrity protection have no tag and are only authenticated by the encryption, files
+// written since then are sealed and must have a tag.
+func (k *FileKeystore) open(raw []byte, secrets *map[string]serializableSecureString) (*EncryptionParams, error) {
+	content, tag, protected := splitIntegrity(raw)
+	if isSealedVersion(raw) && !protected {
+		// The tag of a sealed file was removed.
+		return nil, fmt.Errorf("%w: %w", ErrTampered, ErrIntegrityMissing)
+	}
+	passwordMatches := true
+	if protected {
+		var err error
+		if passwordMatches, err = k.verifyIntegrity(content, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	params, sealed, err := k.decode(unsealedVersion(content), secrets)
+	if err != nil {
+		if protected && passwordMatches {
+			// The content is authenticated with the right password, it cannot be undecryptable.
+			return nil, fmt.Errorf("%w: %w", ErrTampered, err)
+		}
+		return nil, err
+	}
+	if !passwordMatches {
+		// The content decrypts with the password so the tag itself was modified.
+		return nil, ErrTampered
+	}
+	if sealed && !protected {
+		// The tag of a sealed file was removed and its version rewritten.
+		return nil, fmt.Errorf("%w: %w", ErrTampered, ErrIntegrityMissing)
+	}
+	return params, nil
+}
+
+// Verify reads the keystore file again and checks it wasn't modified out of band, returning
+// ErrTampered when the integrity check fails and ErrIntegrityMissing when the file has no
+// integrity tag yet.
+func (k *FileKeystore) Verify() error {
+	k.RLock()
+	defer k.RUnlock()
+
+	raw, err := k.loadRaw()
+	if err != nil {
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	if _, _, protected := splitIntegrity(raw); !protected {
+		return ErrIntegrityMissing
+	}
+
+	secrets := make(map[string]serializableSecureString)
+	_, err = k.open(raw, &secrets)
+	return err
+}
+
+// verifyIntegrity returns false when the tag was computed with another password, and ErrTampered
+// when the password matches but the content doesn't.
+func (k *FileKeystore) verifyIntegrity(content, encodedTag []byte) (bool, error) {
+	tag, err := base64.StdEncoding.DecodeString(string(encodedTag))
+	if err != nil || len(tag) != integritySaltLength+2*sha256.Size {
+		return false, ErrTampered
+	}
+	salt := tag[:integritySaltLength]
+	check := tag[integritySaltLength : integritySaltLength+sha256.Size]
+	mac := tag[integritySaltLength+sha256.Size:]
+
+	key, err := k.integrityKey(salt)
+	if err != nil {
+		return false, err
+	}
+	if !hmac.Equal(check, integrityMAC(key, []byte(integrityCheckLabel))) {
+		return false, nil
+	}
+	if !hmac.Equal(mac, integrityMAC(key, content)) {
+		return true, ErrTampered
+	}
+	return true, nil
+}
+
+func (k *FileKeystore) integrityKey(salt []byte) ([]byte, error) {
+	password, _ := k.password.Get()
+	key, err := k.hashPassword(string(password), salt)
+	if err != nil {
+		return nil, fmt.Errorf("could not hash password, error: %w", err)
+	}
+	return key, nil
+}
+
+func integrityMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// splitIntegrity separates the content of the keystore file from its integrity tag.
+func splitIntegrity(raw []byte) (content, tag []byte, ok bool) {
+	i := bytes.LastIndex(raw, []byte(integrityMarker))
+	if i < 0 {
+		return raw, nil, false
+	}
+	return raw[:i], raw[i+len(integrityMarker):], true
+}
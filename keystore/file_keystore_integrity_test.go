@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createProtectedKeystore(t *testing.T, password string) string {
+	t.Helper()
+	path := GetTemporaryKeystoreFile(t)
+	keystore, err := NewFileKeystoreWithPassword(path, NewSecureString([]byte(password)))
+	require.NoError(t, err)
+	w, err := AsWritableKeystore(keystore)
+	require.NoError(t, err)
+	require.NoError(t, w.Store("output.elasticsearch.password", []byte("secret")))
+	require.NoError(t, w.Save())
+	require.NoError(t, keystore.(*FileKeystore).Verify())
+	return path
+}
+
+func rewrite(t *testing.T, path string, fn func(raw []byte) []byte) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, fn(raw), filePermission))
+}
+
+func TestFileKeystoreIntegrityTamperedContent(t *testing.T) {
+	path := createProtectedKeystore(t, "password")
+	keystore, err := NewFileKeystoreWithPassword(path, NewSecureString([]byte("password")))
+	require.NoError(t, err)
+
+	rewrite(t, path, func(raw []byte) []byte {
+		// Flip a bit in the base64 payload while keeping it valid base64.
+		i := len(version) + 20
+		if raw[i] == 'A' {
+			raw[i] = 'B'
+		} else {
+			raw[i] = 'A'
+		}
+		return raw
+	})
+
+	assert.ErrorIs(t, keystore.(*FileKeystore).Verify(), ErrTampered)
+	_, err = NewFileKeystoreWithPassword(path, NewSecureString([]byte("password")))
+	assert.ErrorIs(t, err, ErrTampered)
+}
+
+func TestFileKeystoreIntegrityTamperedTag(t *testing.T) {
+	path := createProtectedKeystore(t, "password")
+
+	rewrite(t, path, func(raw []byte) []byte {
+		content, _, ok := splitIntegrity(raw)
+		require.True(t, ok)
+		forged := make([]byte, integritySaltLength+64)
+		return append(append(content, integrityMarker...), base64.StdEncoding.EncodeToString(forged)...)
+	})
+	_, err := NewFileKeystoreWithPassword(path, NewSecureString([]byte("password")))
+	assert.ErrorIs(t, err, ErrTampered)
+
+	rewrite(t, path, func(raw []byte) []byte {
+		return append(raw, "!!"...)
+	})
+	_, err = NewFileKeystoreWithPassword(path, NewSecureString([]byte("password")))
+	assert.ErrorIs(t, err, ErrTampered)
+}
+
+func TestFileKeystoreIntegrityWrongPassword(t *testing.T) {
+	path := createProtectedKeystore(t, "password")
+
+	_, err := NewFileKeystoreWithPassword(path, NewSecureString([]byte("wrongpassword")))
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTampered, "a wrong password must not be reported as tampering")
+}
+
+func TestFileKeystoreIntegrityLegacyFile(t *testing.T) {
+	// A file written before integrity protection.
+	path := GetTemporaryKeystoreFile(t)
+	legacy, err := os.ReadFile(filepath.Join("testdata", "keystore."+string(version)))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, legacy, filePermission))
+
+	keystore, err := NewFileKeystore(path)
+	require.NoError(t, err)
+	k := keystore.(*FileKeystore)
+	assert.ErrorIs(t, k.Verify(), ErrIntegrityMissing)
+
+	// The next save protects the file.
+	require.NoError(t, k.Store("other", []byte("x")))
+	require.NoError(t, k.Save())
+	assert.NoError(t, k.Verify())
+}
+
+func TestFileKeystoreIntegrityStrippedTag(t *testing.T) {
+	path := createProtectedKeystore(t, "")
+
+	// Remove the tag to pass the file for one written before integrity protection.
+	rewrite(t, path, func(raw []byte) []byte {
+		content, _, ok := splitIntegrity(raw)
+		require.True(t, ok)
+		return bytes.Clone(content)
+	})
+
+	_, err := NewFileKeystore(path)
+	assert.ErrorIs(t, err, ErrTampered)
+	assert.ErrorIs(t, err, ErrIntegrityMissing)
+
+	// Rewriting the version as well is detected from the encrypted content.
+	rewrite(t, path, func(raw []byte) []byte {
+		return unsealedVersion(raw)
+	})
+	_, err = NewFileKeystore(path)
+	assert.ErrorIs(t, err, ErrTampered)
+	assert.ErrorIs(t, err, ErrIntegrityMissing)
+}
+
+func TestFileKeystoreIntegritySealedVersion(t *testing.T) {
+	path := createProtectedKeystore(t, "")
+
+	// Sealed files have their own version, so older keystores reject them as unsupported.
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, sealedVersion(version), raw[:len(version)])
+	assert.NotEqual(t, version, raw[:len(version)])
+
+	rewrite(t, path, func(raw []byte) []byte {
+		return append([]byte("s9"), raw[len(version):]...)
+	})
+	_, err = NewFileKeystore(path)
+	assert.ErrorContains(t, err, "keystore format doesn't match expected version")
+}
@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-libs/keystore/encryption"
+)
+
+// versionParams is the version of the keystore format carrying its encryption parameters in the
+// header: VERSION|base64(HEADER LENGTH|HEADER|SALT|NONCE+PAYLOAD), the version and the header are
+// authenticated as additional data.
+var versionParams = []byte("v3")
+
+const (
+	KDFPBKDF2   = encryption.KDFPBKDF2
+	KDFScrypt   = encryption.KDFScrypt
+	KDFArgon2id = encryption.KDFArgon2id
+
+	CipherAES256GCM         = encryption.CipherAES256GCM
+	CipherXChaCha20Poly1305 = encryption.CipherXChaCha20Poly1305
+)
+
+// EncryptionParams configures how the file keystore derives its key from the password and which
+// AEAD encrypts it. The parameters are stored in the keystore header so they can be hardened over
+// time while older keystores stay readable.
+type EncryptionParams = encryption.Params
+
+// KDFParams configures the key derivation function, unset parameters use the defaults of the
+// algorithm.
+type KDFParams = encryption.KDFParams
+
+// DefaultEncryptionParams returns the parameters recommended for new keystores.
+func DefaultEncryptionParams() EncryptionParams {
+	return encryption.DefaultParams()
+}
+
+// encryptWithParams encrypts the data, the returned payload starts with the header describing the
+// parameters.
+func (k *FileKeystore) encryptWithParams(data []byte) ([]byte, error) {
+	password, _ := k.password.Get()
+	return encryption.Seal(*k.params, password, data, versionParams)
+}
+
+// decryptWithParams decrypts a payload written by encryptWithParams and returns the parameters
+// found in its header.
+func (k *FileKeystore) decryptWithParams(payload []byte) ([]byte, EncryptionParams, error) {
+	password, _ := k.password.Get()
+	data, params, err := encryption.Open(password, payload, versionParams)
+	if err != nil {
+		return nil, params, fmt.Errorf("could not decrypt keystore data: %w", err)
+	}
+	return data, params, nil
+}
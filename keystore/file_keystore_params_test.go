@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Cheap parameters to keep the tests fast.
+var testParams = map[string]EncryptionParams{
+	"pbkdf2":   {KDF: KDFParams{Algorithm: KDFPBKDF2, Iterations: 1000}, Cipher: CipherAES256GCM},
+	"scrypt":   {KDF: KDFParams{Algorithm: KDFScrypt, N: 1024}, Cipher: CipherAES256GCM},
+	"argon2id": {KDF: KDFParams{Algorithm: KDFArgon2id, Iterations: 1, Memory: 1024, Parallelism: 1}, Cipher: CipherAES256GCM},
+	"xchacha":  {KDF: KDFParams{Algorithm: KDFPBKDF2, Iterations: 1000}, Cipher: CipherXChaCha20Poly1305},
+}
+
+func TestFileKeystoreWithParams(t *testing.T) {
+	for name, params := range testParams {
+		t.Run(name, func(t *testing.T) {
+			if params.Validate() != nil {
+				t.Skip("not available in this build")
+			}
+			path := GetTemporaryKeystoreFile(t)
+			password := NewSecureString([]byte("password"))
+
+			keystore, err := NewFileKeystoreWithParams(path, password, false, params)
+			require.NoError(t, err)
+			w, err := AsWritableKeystore(keystore)
+			require.NoError(t, err)
+			require.NoError(t, w.Store("hello", []byte("world")))
+			require.NoError(t, w.Save())
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.True(t, bytes.HasPrefix(raw, sealedVersion(versionParams)))
+
+			// The parameters are read from the header, no configuration is needed.
+			reopened, err := NewFileKeystoreWithPassword(path, password)
+			require.NoError(t, err)
+			v, err := reopened.Retrieve("hello")
+			require.NoError(t, err)
+			assertSecret(t, "world", v)
+
+			expected := params.WithDefaults()
+			assert.Equal(t, &expected, reopened.(*FileKeystore).params)
+
+			_, err = NewFileKeystoreWithPassword(path, NewSecureString([]byte("wrong")))
+			assert.ErrorContains(t, err, "could not decrypt keystore data")
+		})
+	}
+}
+
+func TestFileKeystoreOpensV3(t *testing.T) {
+	ks, err := NewFileKeystoreWithPassword(filepath.Join("testdata", "keystore.v3"), NewSecureString([]byte("")))
+	require.NoError(t, err)
+	v, err := ks.Retrieve("key")
+	require.NoError(t, err)
+	assertSecret(t, "value", v)
+}
+
+func TestFileKeystoreUpgradeParams(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	password := NewSecureString([]byte(""))
+
+	// Start from a keystore in the legacy format of the build.
+	legacy, err := os.ReadFile(filepath.Join("testdata", "keystore."+string(version)))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, legacy, filePermission))
+
+	keystore, err := NewFileKeystoreWithParams(path, password, false, testParams["pbkdf2"])
+	require.NoError(t, err)
+	_, err = keystore.Retrieve("key")
+	require.NoError(t, err, "legacy keystores must stay readable")
+
+	// The next save converts the keystore to the configured parameters.
+	keystore.(*FileKeystore).dirty = true
+	require.NoError(t, keystore.(*FileKeystore).Save())
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(raw, sealedVersion(versionParams)))
+
+	reopened, err := NewFileKeystoreWithPassword(path, password)
+	require.NoError(t, err)
+	_, err = reopened.Retrieve("key")
+	require.NoError(t, err)
+}
+
+func TestFileKeystoreParamsHeaderIsAuthenticated(t *testing.T) {
+	k := &FileKeystore{password: NewSecureString([]byte("")), params: &EncryptionParams{
+		KDF:    KDFParams{Algorithm: KDFPBKDF2, Iterations: 1000},
+		Cipher: CipherAES256GCM,
+	}}
+	payload, err := k.encryptWithParams([]byte("data"))
+	require.NoError(t, err)
+
+	data, _, err := k.decryptWithParams(payload)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data"), data)
+
+	// Changing a parameter in the header, here the iterations, breaks the authentication.
+	tampered := bytes.Replace(payload, []byte(`"iterations":1000`), []byte(`"iterations":1001`), 1)
+	require.NotEqual(t, payload, tampered)
+	_, _, err = k.decryptWithParams(tampered)
+	assert.ErrorContains(t, err, "message authentication failed")
+
+	// Header parameters are bounded so a crafted file cannot exhaust resources.
+	crafted := bytes.Replace(payload, []byte(`"iterations":1000`), []byte(`"iterations":9999999999`), 1)
+	_, _, err = k.decryptWithParams(crafted)
+	assert.ErrorContains(t, err, "invalid encryption header")
+}
+
+func TestFactoryEncryption(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	c := config.MustNewConfigFrom(map[string]interface{}{
+		"path":       path,
+		"encryption": map[string]interface{}{"kdf.algorithm": "pbkdf2-sha512", "kdf.iterations": 1000},
+	})
+	keystore, err := Factory(c, "", false)
+	require.NoError(t, err)
+	params := keystore.(*FileKeystore).params
+	require.NotNil(t, params)
+	assert.Equal(t, KDFPBKDF2, params.KDF.Algorithm)
+	assert.Equal(t, uint32(1000), params.KDF.Iterations)
+	assert.Equal(t, CipherAES256GCM, params.Cipher)
+
+	c = config.MustNewConfigFrom(map[string]interface{}{"path": path, "encryption.cipher": "rot13"})
+	_, err = Factory(c, "", false)
+	assert.ErrorContains(t, err, "unknown cipher")
+}
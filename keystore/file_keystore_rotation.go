@@ -0,0 +1,139 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// rotationLogSuffix is appended to the keystore path to name the audit log of key rotations.
+const rotationLogSuffix = ".rotations"
+
+// EntryMetadata describes a secret stored in the file keystore.
+type EntryMetadata struct {
+	// Version is incremented every time the secret is stored, secrets written before entries
+	// were versioned have version 0.
+	Version int
+	// Updated is the time the secret was last stored.
+	Updated time.Time
+}
+
+// RotationRecord is the audit record of a change of the keystore sealing key.
+type RotationRecord struct {
+	Time    time.Time `json:"time"`
+	Entries int       `json:"entries"`
+}
+
+// Metadata returns the version and the last update time of a secret.
+func (k *FileKeystore) Metadata(key string) (EntryMetadata, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	secret, ok := k.secrets[key]
+	if !ok {
+		return EntryMetadata{}, ErrKeyDoesntExists
+	}
+	return EntryMetadata{Version: secret.Version, Updated: secret.Updated}, nil
+}
+
+// ReEncrypt seals the keystore with a new key and persists it, the secrets and their versions
+// are kept. The keystore file is replaced atomically so a failure leaves the previous file
+// readable with the previous key, once the file is written a record is appended to the rotation
+// audit log.
+func (k *FileKeystore) ReEncrypt(newKey *SecureString) error {
+	if newKey == nil {
+		return errors.New("the new keystore key cannot be nil")
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	previous, previousDirty := k.password, k.dirty
+	k.password = newKey
+	k.dirty = true
+	if err := k.doSave(true); err != nil {
+		k.password, k.dirty = previous, previousDirty
+		return fmt.Errorf("could not re-encrypt the keystore: %w", err)
+	}
+
+	record := RotationRecord{Time: time.Now().UTC(), Entries: len(k.secrets)}
+	if err := k.appendRotation(record); err != nil {
+		return fmt.Errorf("keystore re-encrypted but the rotation could not be recorded: %w", err)
+	}
+	return nil
+}
+
+// Rotations returns the audit records of the key rotations, oldest first.
+func (k *FileKeystore) Rotations() ([]RotationRecord, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	f, err := os.Open(k.rotationLogPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []RotationRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record RotationRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("corrupt rotation record in '%s': %w", k.rotationLogPath(), err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func (k *FileKeystore) rotationLogPath() string {
+	return k.Path + rotationLogSuffix
+}
+
+// appendRotation lock/unlocking of the resource need to be done by the caller.
+func (k *FileKeystore) appendRotation(record RotationRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(k.rotationLogPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePermission)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
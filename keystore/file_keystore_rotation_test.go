@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKeystoreReEncrypt(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+	defer os.Remove(path + rotationLogSuffix)
+
+	oldKey := NewSecureString([]byte("old-key"))
+	newKey := NewSecureString([]byte("new-key"))
+
+	keystore, err := NewFileKeystoreWithPassword(path, oldKey)
+	require.NoError(t, err)
+	w, err := AsWritableKeystore(keystore)
+	require.NoError(t, err)
+	require.NoError(t, w.Store("a", []byte("1")))
+	require.NoError(t, w.Store("b", []byte("2")))
+	require.NoError(t, w.Save())
+
+	before, err := keystore.(*FileKeystore).Metadata("a")
+	require.NoError(t, err)
+
+	start := time.Now().UTC()
+	require.NoError(t, keystore.(*FileKeystore).ReEncrypt(newKey))
+
+	// The keystore can only be opened with the new key.
+	_, err = NewFileKeystoreWithPassword(path, oldKey)
+	assert.Error(t, err)
+	reopened, err := NewFileKeystoreWithPassword(path, newKey)
+	require.NoError(t, err)
+
+	v, err := reopened.Retrieve("b")
+	require.NoError(t, err)
+	assertSecret(t, "2", v)
+
+	after, err := reopened.(*FileKeystore).Metadata("a")
+	require.NoError(t, err)
+	assert.Equal(t, before.Version, after.Version, "re-encryption must not change the entries")
+	assert.True(t, before.Updated.Equal(after.Updated))
+
+	rotations, err := reopened.(*FileKeystore).Rotations()
+	require.NoError(t, err)
+	require.Len(t, rotations, 1)
+	assert.Equal(t, 2, rotations[0].Entries)
+	assert.False(t, rotations[0].Time.Before(start.Truncate(time.Second)))
+
+	require.NoError(t, reopened.(*FileKeystore).ReEncrypt(oldKey))
+	rotations, err = reopened.(*FileKeystore).Rotations()
+	require.NoError(t, err)
+	assert.Len(t, rotations, 2)
+
+	info, err := os.Stat(path + rotationLogSuffix)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(filePermission), info.Mode().Perm())
+	}
+}
+
+func TestFileKeystoreEntryVersions(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	keystore, err := NewFileKeystore(path)
+	require.NoError(t, err)
+	k := keystore.(*FileKeystore)
+
+	_, err = k.Metadata("a")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	require.NoError(t, k.Store("a", []byte("1")))
+	m, err := k.Metadata("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Version)
+	assert.False(t, m.Updated.IsZero())
+
+	require.NoError(t, k.Store("a", []byte("2")))
+	require.NoError(t, k.Save())
+
+	reopened, err := NewFileKeystore(path)
+	require.NoError(t, err)
+	m, err = reopened.(*FileKeystore).Metadata("a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.Version)
+
+	// Deleting and storing again starts a new history.
+	require.NoError(t, k.Delete("a"))
+	require.NoError(t, k.Store("a", []byte("3")))
+	m, err = k.Metadata("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Version)
+}
+
+func TestFileKeystoreUnversionedEntries(t *testing.T) {
+	// Entries written before versioning only contain the value.
+	var secrets map[string]serializableSecureString
+	require.NoError(t, json.Unmarshal([]byte(`{"a":{"value":"MQ=="}}`), &secrets))
+	assert.Equal(t, []byte("1"), secrets["a"].Value)
+	assert.Equal(t, 0, secrets["a"].Version)
+	assert.True(t, secrets["a"].Updated.IsZero())
+}
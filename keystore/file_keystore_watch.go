@@ -0,0 +1,231 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often the keystore file is checked for changes made by other
+// processes while keys are watched.
+const DefaultWatchInterval = time.Second
+
+// keyWatchers keeps the channels notified when the secret of a key changes.
+type keyWatchers struct {
+	mu    sync.Mutex
+	byKey map[string][]chan struct{}
+}
+
+func (w *keyWatchers) add(key string) chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.byKey == nil {
+		w.byKey = make(map[string][]chan struct{})
+	}
+	// Buffered so notifications are coalesced and never block the keystore.
+	ch := make(chan struct{}, 1)
+	w.byKey[key] = append(w.byKey[key], ch)
+	return ch
+}
+
+// remove unregisters the channel and returns the number of remaining watchers.
+func (w *keyWatchers) remove(ch <-chan struct{}) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	remaining := 0
+	for key, chans := range w.byKey {
+		for i, c := range chans {
+			if c == ch {
+				chans = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(chans) == 0 {
+			delete(w.byKey, key)
+		} else {
+			w.byKey[key] = chans
+		}
+		remaining += len(chans)
+	}
+	return remaining
+}
+
+func (w *keyWatchers) notify(keys ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, key := range keys {
+		for _, ch := range w.byKey[key] {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// fileWatch polls the keystore file for changes made by other processes.
+type fileWatch struct {
+	mu       sync.Mutex
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Watch returns a channel notified when the secret of key is stored, deleted or changed on disk
+// by another process, for example when an operator updates it with the keystore command. The
+// changes saved by this keystore are notified on Save. Unwatch must be called once the channel
+// is not used anymore.
+func (k *FileKeystore) Watch(key string) (<-chan struct{}, error) {
+	// The watchers are added and removed under the watch lock so the poller can't be stopped
+	// by a concurrent Unwatch while a new watcher is registered.
+	k.watch.mu.Lock()
+	defer k.watch.mu.Unlock()
+
+	ch := k.watchers.add(key)
+	if k.watch.stop == nil {
+		interval := k.watch.interval
+		if interval <= 0 {
+			interval = DefaultWatchInterval
+		}
+		k.watch.stop = make(chan struct{})
+		k.watch.done = make(chan struct{})
+		// The file is stat'ed before returning so changes made right after Watch are not
+		// missed while the goroutine starts.
+		go k.pollFile(interval, statFile(k.Path), k.watch.stop, k.watch.done)
+	}
+	return ch, nil
+}
+
+// Unwatch stops notifying the channel returned by Watch, the file stops being polled once no
+// key is watched anymore.
+func (k *FileKeystore) Unwatch(ch <-chan struct{}) {
+	k.watch.mu.Lock()
+	defer k.watch.mu.Unlock()
+
+	if k.watchers.remove(ch) > 0 {
+		return
+	}
+	if k.watch.stop != nil {
+		close(k.watch.stop)
+		<-k.watch.done
+		k.watch.stop, k.watch.done = nil, nil
+	}
+}
+
+// markChanged lock/unlocking of the resource need to be done by the caller.
+func (k *FileKeystore) markChanged(key string) {
+	if k.changed == nil {
+		k.changed = make(map[string]struct{})
+	}
+	k.changed[key] = struct{}{}
+}
+
+// notifyChanged lock/unlocking of the resource need to be done by the caller.
+func (k *FileKeystore) notifyChanged() {
+	keys := make([]string, 0, len(k.changed))
+	for key := range k.changed {
+		keys = append(keys, key)
+	}
+	k.changed = nil
+	k.watchers.notify(keys...)
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+func (k *FileKeystore) pollFile(interval time.Duration, last fileState, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := statFile(k.Path)
+		if current == last {
+			continue
+		}
+		// The state is only recorded once the file could be read so a partially written
+		// file is read again on the next tick.
+		if err := k.reload(); err == nil {
+			last = current
+		}
+	}
+}
+
+// reload reads the keystore file and notifies the keys changed on disk, keys with unsaved
+// changes in memory are left untouched.
+func (k *FileKeystore) reload() error {
+	k.Lock()
+	defer k.Unlock()
+
+	raw, err := k.loadRaw()
+	if err != nil {
+		return err
+	}
+	fresh := make(map[string]serializableSecureString)
+	if len(raw) > 0 {
+		if _, err := k.open(raw, &fresh); err != nil {
+			return err
+		}
+	}
+
+	var changed []string
+	for key, secret := range fresh {
+		if _, unsaved := k.changed[key]; unsaved {
+			continue
+		}
+		current, ok := k.secrets[key]
+		if !ok || current.Version != secret.Version || !bytes.Equal(current.Value, secret.Value) {
+			k.secrets[key] = secret
+			changed = append(changed, key)
+		}
+	}
+	for key := range k.secrets {
+		if _, unsaved := k.changed[key]; unsaved {
+			continue
+		}
+		if _, ok := fresh[key]; !ok {
+			delete(k.secrets, key)
+			changed = append(changed, key)
+		}
+	}
+	k.watchers.notify(changed...)
+	return nil
+}
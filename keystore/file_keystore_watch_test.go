@@ -0,0 +1,173 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newWatchedKeystore(t *testing.T, path string) *FileKeystore {
+	t.Helper()
+	keystore, err := NewFileKeystore(path)
+	require.NoError(t, err)
+	k := keystore.(*FileKeystore)
+	k.watch.interval = 10 * time.Millisecond
+	return k
+}
+
+func requireNotified(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change notification")
+	}
+}
+
+func requireNotNotified(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatal("unexpected change notification")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFileKeystoreWatchLocalChanges(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	k := newWatchedKeystore(t, path)
+	ch, err := k.Watch("a")
+	require.NoError(t, err)
+	defer k.Unwatch(ch)
+	other, err := k.Watch("b")
+	require.NoError(t, err)
+	defer k.Unwatch(other)
+
+	require.NoError(t, k.Store("a", []byte("1")))
+	requireNotNotified(t, ch) // not saved yet
+
+	require.NoError(t, k.Save())
+	requireNotified(t, ch)
+	requireNotNotified(t, other)
+
+	require.NoError(t, k.Delete("a"))
+	require.NoError(t, k.Save())
+	requireNotified(t, ch)
+
+	_, err = AsWatchingKeystore(k)
+	assert.NoError(t, err)
+}
+
+func TestFileKeystoreWatchExternalChanges(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	writer := newWatchedKeystore(t, path)
+	require.NoError(t, writer.Store("output.elasticsearch.password", []byte("old")))
+	require.NoError(t, writer.Save())
+
+	k := newWatchedKeystore(t, path)
+	ch, err := k.Watch("output.elasticsearch.password")
+	require.NoError(t, err)
+	defer k.Unwatch(ch)
+
+	// Another process updates the secret.
+	require.NoError(t, writer.Store("output.elasticsearch.password", []byte("new")))
+	require.NoError(t, writer.Save())
+	requireNotified(t, ch)
+
+	v, err := k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "new", v)
+
+	// Storing another key doesn't notify.
+	require.NoError(t, writer.Store("other", []byte("x")))
+	require.NoError(t, writer.Save())
+	requireNotNotified(t, ch)
+
+	require.NoError(t, writer.Delete("output.elasticsearch.password"))
+	require.NoError(t, writer.Save())
+	requireNotified(t, ch)
+	_, err = k.Retrieve("output.elasticsearch.password")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+}
+
+func TestFileKeystoreUnwatch(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	k := newWatchedKeystore(t, path)
+	first, err := k.Watch("a")
+	require.NoError(t, err)
+	second, err := k.Watch("a")
+	require.NoError(t, err)
+
+	k.Unwatch(first)
+	k.watch.mu.Lock()
+	assert.NotNil(t, k.watch.stop, "polling must continue while keys are watched")
+	k.watch.mu.Unlock()
+
+	require.NoError(t, k.Store("a", []byte("1")))
+	require.NoError(t, k.Save())
+	requireNotified(t, second)
+	requireNotNotified(t, first)
+
+	k.Unwatch(second)
+	k.watch.mu.Lock()
+	assert.Nil(t, k.watch.stop, "polling must stop once no key is watched")
+	k.watch.mu.Unlock()
+}
+
+func TestFileKeystoreWatchConcurrentUnwatch(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	k := newWatchedKeystore(t, path)
+	for i := 0; i < 100; i++ {
+		previous, err := k.Watch("a")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		var current <-chan struct{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			k.Unwatch(previous)
+		}()
+		go func() {
+			defer wg.Done()
+			current, err = k.Watch("a")
+		}()
+		wg.Wait()
+		require.NoError(t, err)
+
+		k.watch.mu.Lock()
+		running := k.watch.stop != nil
+		k.watch.mu.Unlock()
+		require.True(t, running, "polling must continue while keys are watched")
+		k.Unwatch(current)
+	}
+}
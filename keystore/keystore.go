@@ -19,6 +19,7 @@ package keystore
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/go-ucfg"
@@ -37,6 +38,9 @@ var (
 
 	// ErrNotWritable is returned when the keystore is not writable
 	ErrNotListing = errors.New("the configured keystore is not listing")
+
+	// ErrNotWatching is returned when the keystore cannot notify secret changes
+	ErrNotWatching = errors.New("the configured keystore does not support watching keys")
 )
 
 // Keystore implement a way to securely saves and retrieves secrets to be used in the configuration
@@ -73,6 +77,12 @@ type ListingKeystore interface {
 	List() ([]string, error)
 }
 
+type WatchingKeystore interface {
+	// Watch returns a channel receiving a value every time the secret of the key changes, the
+	// notifications are coalesced so a slow receiver only sees the latest change.
+	Watch(key string) (<-chan struct{}, error)
+}
+
 // Use parse.NoopConfig to disable interpreting all parser characters when loading secrets.
 var parseConfig = parse.NoopConfig
 
@@ -99,6 +109,27 @@ func ResolverWrap(keystore Keystore) func(string) (string, parse.Config, error)
 	}
 }
 
+// SecretResolver returns a config.SecretResolver looking up secrets in the
+// keystore, such that keystore entries can be referenced from configurations
+// via config.ResolveSecrets or config.RegisterSecretResolver.
+func SecretResolver(keystore Keystore) config.SecretResolver {
+	return config.SecretResolverFunc(func(ref string) (string, error) {
+		key, err := keystore.Retrieve(ref)
+		if err != nil {
+			if errors.Is(err, ErrKeyDoesntExists) {
+				return "", fmt.Errorf("%w: %v", config.ErrSecretNotFound, err)
+			}
+			return "", err
+		}
+
+		v, err := key.Get()
+		if err != nil {
+			return "", err
+		}
+		return string(v), nil
+	})
+}
+
 // AsWritableKeystore casts a keystore to WritableKeystore, returning an ErrNotWritable error if the given keystore does not implement
 // WritableKeystore interface
 func AsWritableKeystore(store Keystore) (WritableKeystore, error) {
@@ -118,3 +149,13 @@ func AsListingKeystore(store Keystore) (ListingKeystore, error) {
 	}
 	return w, nil
 }
+
+// AsWatchingKeystore casts a keystore to WatchingKeystore, returning an ErrNotWatching error if the given keystore does not implement
+// WatchingKeystore interface
+func AsWatchingKeystore(store Keystore) (WatchingKeystore, error) {
+	w, ok := store.(WatchingKeystore)
+	if !ok {
+		return nil, ErrNotWatching
+	}
+	return w, nil
+}
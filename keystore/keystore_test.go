@@ -24,6 +24,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/elastic-agent-libs/config"
 	ucfg "github.com/elastic/go-ucfg"
 	"github.com/elastic/go-ucfg/parse"
 )
@@ -63,3 +64,27 @@ func TestResolverWhenTheKeyExist(t *testing.T) {
 	require.True(t, ok, "parsed secret is not a string")
 	require.Equal(t, string(secretValue), secret)
 }
+
+func TestSecretResolver(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	keystore := CreateAnExistingKeystore(path)
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"password": "${secret.output.elasticsearch.password}",
+		"missing":  "${secret.donotexist:fallback}",
+	})
+
+	var settings struct {
+		Password string `config:"password"`
+		Missing  string `config:"missing"`
+	}
+	err := cfg.UnpackWithOpts(&settings, config.ResolveSecrets("secret", SecretResolver(keystore)))
+	require.NoError(t, err)
+	assert.Equal(t, string(secretValue), settings.Password)
+	assert.Equal(t, "fallback", settings.Missing)
+
+	_, err = SecretResolver(keystore).ResolveSecret("donotexist")
+	assert.ErrorIs(t, err, config.ErrSecretNotFound)
+}
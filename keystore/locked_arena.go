@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"math/bits"
+	"os"
+	"sync"
+)
+
+const (
+	// minLockedSlot is the smallest slot handed out by the arena.
+	minLockedSlot = 32
+	// lockedChunkSize is the size of the chunks of locked memory slots are
+	// carved from, at least a page.
+	lockedChunkSize = 16 << 10
+)
+
+// secretsArena holds the secrets of all the memory keystores.
+var secretsArena = &lockedArena{chunkSize: max(lockedChunkSize, os.Getpagesize())}
+
+// lockedArena hands out slots of locked memory carved from shared chunks, so
+// small secrets don't lock a page each. Slots have power of two sizes, chunks
+// are split into slots of a single size and released once all their slots are
+// free. Secrets larger than a chunk get a chunk of their own.
+type lockedArena struct {
+	chunkSize int
+
+	mu     sync.Mutex
+	chunks map[int][]*lockedChunk // by slot size
+}
+
+type lockedChunk struct {
+	mem      []byte
+	slotSize int
+	free     []int // offsets of the free slots
+	used     int
+}
+
+// lockedBuffer holds a secret in memory that is locked in RAM and lives outside of the Go heap,
+// so the secret is never swapped to disk nor copied by the garbage collector.
+type lockedBuffer struct {
+	arena *lockedArena
+	chunk *lockedChunk
+	off   int
+	mem   []byte
+	len   int
+}
+
+func newLockedBuffer(value []byte) (*lockedBuffer, error) {
+	return secretsArena.alloc(value)
+}
+
+// bytes returns a copy of the secret.
+func (b *lockedBuffer) bytes() []byte {
+	return append([]byte{}, b.mem[:b.len]...)
+}
+
+// destroy zeroizes the secret and returns its slot to the arena.
+func (b *lockedBuffer) destroy() error {
+	if b.mem == nil {
+		return nil
+	}
+	clear(b.mem)
+	err := b.arena.free(b.chunk, b.off)
+	b.chunk, b.mem, b.len = nil, nil, 0
+	return err
+}
+
+// alloc copies value into a free slot, allocating a new chunk if none is
+// left.
+func (a *lockedArena) alloc(value []byte) (*lockedBuffer, error) {
+	slotSize := max(minLockedSlot, 1<<bits.Len(uint(max(len(value), 1)-1)))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var chunk *lockedChunk
+	for _, c := range a.chunks[slotSize] {
+		if len(c.free) > 0 {
+			chunk = c
+			break
+		}
+	}
+	if chunk == nil {
+		var err error
+		if chunk, err = a.newChunk(slotSize); err != nil {
+			return nil, err
+		}
+	}
+
+	off := chunk.free[len(chunk.free)-1]
+	chunk.free = chunk.free[:len(chunk.free)-1]
+	chunk.used++
+	mem := chunk.mem[off : off+slotSize : off+slotSize]
+	copy(mem, value)
+	return &lockedBuffer{arena: a, chunk: chunk, off: off, mem: mem, len: len(value)}, nil
+}
+
+// newChunk locks a chunk split into slots of slotSize. Lock/unlocking of the
+// arena needs to be done by the caller.
+func (a *lockedArena) newChunk(slotSize int) (*lockedChunk, error) {
+	mem, err := allocLocked(max(a.chunkSize, slotSize))
+	if err != nil {
+		return nil, err
+	}
+	chunk := &lockedChunk{mem: mem, slotSize: slotSize}
+	for off := len(mem)/slotSize*slotSize - slotSize; off >= 0; off -= slotSize {
+		chunk.free = append(chunk.free, off)
+	}
+	if a.chunks == nil {
+		a.chunks = make(map[int][]*lockedChunk)
+	}
+	a.chunks[slotSize] = append(a.chunks[slotSize], chunk)
+	return chunk, nil
+}
+
+// free returns the zeroized slot to its chunk, releasing the chunk if it has
+// no slots in use anymore.
+func (a *lockedArena) free(chunk *lockedChunk, off int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	chunk.free = append(chunk.free, off)
+	chunk.used--
+	if chunk.used > 0 {
+		return nil
+	}
+
+	chunks := a.chunks[chunk.slotSize]
+	for i, c := range chunks {
+		if c == chunk {
+			chunks = append(chunks[:i], chunks[i+1:]...)
+			break
+		}
+	}
+	if len(chunks) == 0 {
+		delete(a.chunks, chunk.slotSize)
+	} else {
+		a.chunks[chunk.slotSize] = chunks
+	}
+	return freeLocked(chunk.mem)
+}
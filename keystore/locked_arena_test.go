@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockedArena(t *testing.T) {
+	a := &lockedArena{chunkSize: 4096}
+
+	var bufs []*lockedBuffer
+	for i := 0; i < 4096/minLockedSlot; i++ {
+		buf, err := a.alloc([]byte("changeme"))
+		require.NoError(t, err)
+		bufs = append(bufs, buf)
+	}
+	require.Len(t, a.chunks[minLockedSlot], 1, "small secrets must share a chunk")
+	assert.Equal(t, []byte("changeme"), bufs[0].bytes())
+
+	// the chunk is full, the next secret needs a new chunk
+	extra, err := a.alloc([]byte("changeme"))
+	require.NoError(t, err)
+	assert.Len(t, a.chunks[minLockedSlot], 2)
+	require.NoError(t, extra.destroy())
+	assert.Len(t, a.chunks[minLockedSlot], 1, "empty chunks must be released")
+
+	// released slots are zeroized and reused
+	chunk := bufs[1].chunk
+	require.NoError(t, bufs[1].destroy())
+	slot := chunk.free[len(chunk.free)-1]
+	assert.Equal(t, make([]byte, minLockedSlot), chunk.mem[slot:slot+minLockedSlot])
+	reused, err := a.alloc([]byte("rotated"))
+	require.NoError(t, err)
+	assert.Same(t, chunk, reused.chunk)
+	assert.Equal(t, []byte("rotated"), reused.bytes())
+	bufs[1] = reused
+
+	for _, buf := range bufs {
+		require.NoError(t, buf.destroy())
+	}
+	assert.Empty(t, a.chunks)
+}
+
+func TestLockedArenaSlotSizes(t *testing.T) {
+	a := &lockedArena{chunkSize: 4096}
+
+	for _, size := range []int{0, 1, minLockedSlot, minLockedSlot + 1, 1000, 4096, 10000} {
+		value := bytes.Repeat([]byte("x"), size)
+		buf, err := a.alloc(value)
+		require.NoError(t, err)
+		assert.Equal(t, value, buf.bytes())
+		assert.GreaterOrEqual(t, len(buf.mem), size)
+		assert.GreaterOrEqual(t, len(buf.mem), minLockedSlot)
+		require.NoError(t, buf.destroy())
+		require.NoError(t, buf.destroy(), "destroy must be idempotent")
+	}
+	assert.Empty(t, a.chunks)
+}
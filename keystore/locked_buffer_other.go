@@ -0,0 +1,30 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || windows)
+
+package keystore
+
+// allocLocked falls back to the Go heap on platforms without memory locking, the buffers are
+// still zeroized when released.
+func allocLocked(size int) ([]byte, error) {
+	return make([]byte, size), nil
+}
+
+func freeLocked([]byte) error {
+	return nil
+}
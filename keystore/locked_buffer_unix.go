@@ -0,0 +1,46 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package keystore
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocLocked maps anonymous memory outside of the Go heap and locks it so it's never swapped.
+func allocLocked(size int) ([]byte, error) {
+	mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, fmt.Errorf("could not map memory: %w", err)
+	}
+	if err := unix.Mlock(mem); err != nil {
+		_ = unix.Munmap(mem)
+		return nil, fmt.Errorf("could not lock memory: %w", err)
+	}
+	return mem, nil
+}
+
+func freeLocked(mem []byte) error {
+	if err := unix.Munlock(mem); err != nil {
+		return err
+	}
+	return unix.Munmap(mem)
+}
@@ -0,0 +1,51 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build windows
+
+package keystore
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// allocLocked allocates memory outside of the Go heap and locks it so it's never paged out.
+func allocLocked(size int) ([]byte, error) {
+	addr, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, fmt.Errorf("could not allocate memory: %w", err)
+	}
+	if err := windows.VirtualLock(addr, uintptr(size)); err != nil {
+		_ = windows.VirtualFree(addr, 0, windows.MEM_RELEASE)
+		return nil, fmt.Errorf("could not lock memory: %w", err)
+	}
+	// The memory is not managed by the Go runtime, reinterpret the address without a
+	// uintptr to unsafe.Pointer conversion.
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return unsafe.Slice((*byte)(ptr), size), nil
+}
+
+func freeLocked(mem []byte) error {
+	addr := uintptr(unsafe.Pointer(&mem[0]))
+	if err := windows.VirtualUnlock(addr, uintptr(len(mem))); err != nil {
+		return err
+	}
+	return windows.VirtualFree(addr, 0, windows.MEM_RELEASE)
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// ErrKeystoreClosed is returned when using a MemoryKeystore after Close.
+var ErrKeystoreClosed = errors.New("the keystore is closed")
+
+// MemoryKeystore keeps the secrets only in locked memory and never writes them to disk, it's
+// meant for ephemeral credentials provisioned at runtime. The secrets are zeroized when deleted
+// or replaced and when the keystore is closed.
+//
+// The secrets of all the memory keystores share chunks of locked memory. Locked
+// memory is limited by RLIMIT_MEMLOCK on Unix, see `ulimit -l`, and by the minimum working set
+// size of the process on Windows; Store fails once the limit is reached. Only the stored
+// secrets are locked: Retrieve and GetConfig return copies on the Go heap, which can be swapped
+// and are not zeroized by the keystore.
+type MemoryKeystore struct {
+	mu      sync.RWMutex
+	secrets map[string]*lockedBuffer
+	closed  bool
+}
+
+// NewMemoryKeystore returns an empty in-memory keystore, Close must be called to release the
+// locked memory.
+func NewMemoryKeystore() *MemoryKeystore {
+	return &MemoryKeystore{secrets: make(map[string]*lockedBuffer)}
+}
+
+// Retrieve returns a copy of the secret.
+func (k *MemoryKeystore) Retrieve(key string) (*SecureString, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return nil, ErrKeystoreClosed
+	}
+	secret, ok := k.secrets[key]
+	if !ok {
+		return nil, ErrKeyDoesntExists
+	}
+	return NewSecureString(secret.bytes()), nil
+}
+
+// Store copies the secret into locked memory, the caller can zeroize its own copy afterwards.
+func (k *MemoryKeystore) Store(key string, value []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return ErrKeystoreClosed
+	}
+	buf, err := newLockedBuffer(value)
+	if err != nil {
+		return fmt.Errorf("could not store key %q: %w", key, err)
+	}
+	if previous, ok := k.secrets[key]; ok {
+		_ = previous.destroy()
+	}
+	k.secrets[key] = buf
+	return nil
+}
+
+// Delete zeroizes and removes the secret.
+func (k *MemoryKeystore) Delete(key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return ErrKeystoreClosed
+	}
+	if secret, ok := k.secrets[key]; ok {
+		delete(k.secrets, key)
+		return secret.destroy()
+	}
+	return nil
+}
+
+// Create zeroizes every secret, if the keystore holds secrets and override is false
+// ErrAlreadyExists is returned.
+func (k *MemoryKeystore) Create(override bool) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return ErrKeystoreClosed
+	}
+	if len(k.secrets) > 0 && !override {
+		return ErrAlreadyExists
+	}
+	return k.destroyAll()
+}
+
+// Save does nothing, the secrets are never persisted.
+func (k *MemoryKeystore) Save() error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return ErrKeystoreClosed
+	}
+	return nil
+}
+
+// List returns the available keys.
+func (k *MemoryKeystore) List() ([]string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return nil, ErrKeystoreClosed
+	}
+	keys := make([]string, 0, len(k.secrets))
+	for key := range k.secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// GetConfig returns config.C representation of the key / secret pair to be merged with other
+// loaded configuration.
+func (k *MemoryKeystore) GetConfig() (*config.C, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.closed {
+		return nil, ErrKeystoreClosed
+	}
+	configHash := make(map[string]interface{}, len(k.secrets))
+	for key, secret := range k.secrets {
+		configHash[key] = string(secret.bytes())
+	}
+	return config.NewConfigFrom(configHash)
+}
+
+// IsPersisted always returns false, the secrets only live in memory.
+func (k *MemoryKeystore) IsPersisted() bool {
+	return false
+}
+
+// Close zeroizes and releases every secret, the keystore cannot be used afterwards.
+func (k *MemoryKeystore) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return nil
+	}
+	k.closed = true
+	return k.destroyAll()
+}
+
+// destroyAll lock/unlocking of the resource need to be done by the caller.
+func (k *MemoryKeystore) destroyAll() error {
+	var errs []error
+	for key, secret := range k.secrets {
+		if err := secret.destroy(); err != nil {
+			errs = append(errs, fmt.Errorf("could not release key %q: %w", key, err))
+		}
+		delete(k.secrets, key)
+	}
+	return errors.Join(errs...)
+}
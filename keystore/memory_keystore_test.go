@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryKeystore(t *testing.T) {
+	k := NewMemoryKeystore()
+	defer k.Close()
+	assert.False(t, k.IsPersisted())
+
+	secret := []byte("changeme")
+	require.NoError(t, k.Store("output.elasticsearch.password", secret))
+	require.NoError(t, k.Store("empty", nil))
+	clear(secret) // the keystore keeps its own copy
+
+	v, err := k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "changeme", v)
+
+	v, err = k.Retrieve("empty")
+	require.NoError(t, err)
+	assertSecret(t, "", v)
+
+	require.NoError(t, k.Store("output.elasticsearch.password", []byte("rotated")))
+	v, err = k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "rotated", v)
+
+	keys, err := k.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"empty", "output.elasticsearch.password"}, keys)
+
+	cfg, err := k.GetConfig()
+	require.NoError(t, err)
+	password, err := cfg.String("output.elasticsearch.password", -1)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", password)
+
+	require.NoError(t, k.Delete("empty"))
+	_, err = k.Retrieve("empty")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	assert.ErrorIs(t, k.Create(false), ErrAlreadyExists)
+	require.NoError(t, k.Create(true))
+	keys, err = k.List()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestMemoryKeystoreClose(t *testing.T) {
+	k := NewMemoryKeystore()
+	require.NoError(t, k.Store("a", []byte("secret")))
+
+	buf := k.secrets["a"]
+	require.NoError(t, k.Close())
+	assert.Nil(t, buf.mem, "the buffer must be released")
+
+	_, err := k.Retrieve("a")
+	assert.ErrorIs(t, err, ErrKeystoreClosed)
+	assert.ErrorIs(t, k.Store("a", nil), ErrKeystoreClosed)
+	assert.NoError(t, k.Close(), "Close must be idempotent")
+}
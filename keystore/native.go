@@ -0,0 +1,252 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// ErrNativeUnsupported is returned when the native backend is not available on the current platform.
+var ErrNativeUnsupported = errors.New("native keystore backend is not supported on this platform")
+
+// nativeStore is the platform specific access to the credential store of the operating system,
+// every secret is identified by a service name and a key.
+type nativeStore interface {
+	// get returns the secret or ErrKeyDoesntExists.
+	get(service, key string) ([]byte, error)
+	set(service, key string, value []byte) error
+	// delete removes the secret, deleting a missing key is not an error.
+	delete(service, key string) error
+	list(service string) ([]string, error)
+}
+
+// NativeKeystore stores the secrets in the credential store of the operating system instead of a
+// file, so the secrets are protected by the OS rather than by a key living next to them.
+// Changes are buffered in memory and only written to the credential store on Save.
+type NativeKeystore struct {
+	sync.RWMutex
+	service string
+	store   nativeStore
+	// pending holds the unsaved changes, a nil value marks a deleted key.
+	pending map[string][]byte
+}
+
+// NewNativeKeystore returns a keystore backed by the credential store of the operating system,
+// secrets are namespaced by the service name.
+func NewNativeKeystore(service string) (*NativeKeystore, error) {
+	store, err := newNativeStore()
+	if err != nil {
+		return nil, err
+	}
+	return newNativeKeystore(service, store), nil
+}
+
+func newNativeKeystore(service string, store nativeStore) *NativeKeystore {
+	return &NativeKeystore{
+		service: service,
+		store:   store,
+		pending: make(map[string][]byte),
+	}
+}
+
+// Retrieve returns the secret for the key, unsaved changes take precedence over the stored value.
+func (k *NativeKeystore) Retrieve(key string) (*SecureString, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	if value, ok := k.pending[key]; ok {
+		if value == nil {
+			return nil, ErrKeyDoesntExists
+		}
+		return NewSecureString(value), nil
+	}
+
+	value, err := k.store.get(k.service, key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecureString(value), nil
+}
+
+// Store adds the key pair to the keystore, the change is persisted on Save.
+func (k *NativeKeystore) Store(key string, value []byte) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.pending[key] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes the key from the keystore, the change is persisted on Save.
+func (k *NativeKeystore) Delete(key string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.pending[key] = nil
+	return nil
+}
+
+// Save writes the pending changes to the credential store.
+func (k *NativeKeystore) Save() error {
+	k.Lock()
+	defer k.Unlock()
+
+	return k.doSave()
+}
+
+// Create removes every secret of the service from the credential store, if secrets already exist
+// and override is false ErrAlreadyExists is returned.
+func (k *NativeKeystore) Create(override bool) error {
+	k.Lock()
+	defer k.Unlock()
+
+	keys, err := k.store.list(k.service)
+	if err != nil {
+		return fmt.Errorf("could not list the keys of service %q: %w", k.service, err)
+	}
+	if len(keys) > 0 && !override {
+		return ErrAlreadyExists
+	}
+
+	k.pending = make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		k.pending[key] = nil
+	}
+	return k.doSave()
+}
+
+// doSave lock/unlocking of the resource need to be done by the caller.
+func (k *NativeKeystore) doSave() error {
+	keys := make([]string, 0, len(k.pending))
+	for key := range k.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var err error
+		if value := k.pending[key]; value == nil {
+			err = k.store.delete(k.service, key)
+		} else {
+			err = k.store.set(k.service, key, value)
+		}
+		if err != nil {
+			return fmt.Errorf("could not save key %q: %w", key, err)
+		}
+		delete(k.pending, key)
+	}
+	return nil
+}
+
+// List returns the available keys, including the unsaved ones.
+func (k *NativeKeystore) List() ([]string, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	return k.list()
+}
+
+func (k *NativeKeystore) list() ([]string, error) {
+	stored, err := k.store.list(k.service)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(stored)+len(k.pending))
+	for _, key := range stored {
+		if _, ok := k.pending[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range k.pending {
+		if value != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// GetConfig returns config.C representation of the key / secret pair to be merged with other
+// loaded configuration.
+func (k *NativeKeystore) GetConfig() (*config.C, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	keys, err := k.list()
+	if err != nil {
+		return nil, err
+	}
+
+	configHash := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		value, ok := k.pending[key]
+		if !ok {
+			if value, err = k.store.get(k.service, key); err != nil {
+				return nil, fmt.Errorf("could not retrieve key %q: %w", key, err)
+			}
+		}
+		configHash[key] = string(value)
+	}
+
+	return config.NewConfigFrom(configHash)
+}
+
+// IsPersisted returns true when the credential store holds at least one secret for the service.
+func (k *NativeKeystore) IsPersisted() bool {
+	k.RLock()
+	defer k.RUnlock()
+
+	keys, err := k.store.list(k.service)
+	return err == nil && len(keys) > 0
+}
+
+// runCommand executes a command feeding it stdin, it's a variable so tests can replace the
+// platform tools.
+var runCommand = func(stdin []byte, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return out, fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return out, fmt.Errorf("%s: %w", name, err)
+	}
+	return out, nil
+}
+
+// exitCode returns the exit code of a failed command or -1 if the command didn't run.
+func exitCode(err error) int {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin
+
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	// securityTool is the command line interface to the macOS Keychain.
+	securityTool = "/usr/bin/security"
+
+	// errSecItemNotFound is the exit code of the security tool when no item matches.
+	errSecItemNotFound = 44
+)
+
+// keychainStore stores the secrets as generic passwords in the default Keychain, the service
+// is the Keychain service and the key is the account.
+type keychainStore struct{}
+
+func newNativeStore() (nativeStore, error) {
+	return keychainStore{}, nil
+}
+
+func (keychainStore) get(service, key string) ([]byte, error) {
+	out, err := runCommand(nil, securityTool, "find-generic-password", "-s", service, "-a", key, "-w")
+	if err != nil {
+		if exitCode(err) == errSecItemNotFound {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, err
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func (keychainStore) set(service, key string, value []byte) error {
+	if err := checkKeychainArg(service); err != nil {
+		return err
+	}
+	if err := checkKeychainArg(key); err != nil {
+		return err
+	}
+	// The command is fed to the interactive mode and the secret is hex encoded so it never
+	// shows up in the process list.
+	cmd := fmt.Sprintf("add-generic-password -U -s \"%s\" -a \"%s\" -X %s\n", service, key, hex.EncodeToString(value))
+	_, err := runCommand([]byte(cmd), securityTool, "-i")
+	return err
+}
+
+func (keychainStore) delete(service, key string) error {
+	_, err := runCommand(nil, securityTool, "delete-generic-password", "-s", service, "-a", key)
+	if exitCode(err) == errSecItemNotFound {
+		return nil
+	}
+	return err
+}
+
+func (keychainStore) list(service string) ([]string, error) {
+	out, err := runCommand(nil, securityTool, "dump-keychain")
+	if err != nil {
+		return nil, err
+	}
+	return parseDumpKeychain(out, service), nil
+}
+
+// checkKeychainArg rejects the values that cannot be safely quoted in the interactive mode.
+func checkKeychainArg(s string) error {
+	if strings.ContainsFunc(s, func(r rune) bool { return r == '"' || r == '\\' || unicode.IsControl(r) }) {
+		return fmt.Errorf("invalid keychain value %q: quotes, backslashes and control characters are not allowed", s)
+	}
+	return nil
+}
+
+// parseDumpKeychain returns the accounts of the generic passwords of the service listed
+// by "security dump-keychain".
+func parseDumpKeychain(out []byte, service string) []string {
+	var keys []string
+	var class, account, svc string
+	flush := func() {
+		if class == "genp" && svc == service && account != "" {
+			keys = append(keys, account)
+		}
+		class, account, svc = "", "", ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "keychain: "):
+			flush()
+		case strings.HasPrefix(line, "class: "):
+			class = strings.Trim(strings.TrimPrefix(line, "class: "), `"`)
+		case strings.HasPrefix(line, `"acct"<blob>="`):
+			account = strings.TrimSuffix(strings.TrimPrefix(line, `"acct"<blob>="`), `"`)
+		case strings.HasPrefix(line, `"svce"<blob>="`):
+			svc = strings.TrimSuffix(strings.TrimPrefix(line, `"svce"<blob>="`), `"`)
+		}
+	}
+	flush()
+	return keys
+}
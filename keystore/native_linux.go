@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package keystore
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// secretTool is the libsecret command line client, it talks to the Secret Service
+// (GNOME Keyring, KWallet) over D-Bus.
+const secretTool = "secret-tool"
+
+// libsecretStore stores the secrets in the Secret Service, every secret carries a "service" and a
+// "key" attribute.
+type libsecretStore struct{}
+
+func newNativeStore() (nativeStore, error) {
+	return libsecretStore{}, nil
+}
+
+func (libsecretStore) get(service, key string) ([]byte, error) {
+	out, err := runCommand(nil, secretTool, "lookup", "service", service, "key", key)
+	if err != nil {
+		// secret-tool exits with 1 and no output when nothing matches.
+		if exitCode(err) == 1 && len(out) == 0 {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+func (libsecretStore) set(service, key string, value []byte) error {
+	// The secret is passed on stdin so it never shows up in the process list.
+	_, err := runCommand(value, secretTool, "store", "--label", service+" "+key, "service", service, "key", key)
+	return err
+}
+
+func (libsecretStore) delete(service, key string) error {
+	_, err := runCommand(nil, secretTool, "clear", "service", service, "key", key)
+	if exitCode(err) == 1 {
+		// Nothing to delete.
+		return nil
+	}
+	return err
+}
+
+func (libsecretStore) list(service string) ([]string, error) {
+	out, err := runCommand(nil, secretTool, "search", "--all", "service", service)
+	if err != nil {
+		if exitCode(err) == 1 && len(out) == 0 {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseSecretToolSearch(out), nil
+}
+
+// parseSecretToolSearch extracts the key attribute of every item printed by "secret-tool search".
+func parseSecretToolSearch(out []byte) []string {
+	var keys []string
+	seen := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " = ")
+		if !ok || name != "attribute.key" {
+			continue
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		keys = append(keys, value)
+	}
+	return keys
+}
@@ -0,0 +1,113 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package keystore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeExitError int
+
+func (e fakeExitError) Error() string { return "exit status" }
+func (e fakeExitError) ExitCode() int { return int(e) }
+
+func fakeCommand(t *testing.T, fn func(stdin []byte, args []string) ([]byte, error)) {
+	t.Helper()
+	orig := runCommand
+	t.Cleanup(func() { runCommand = orig })
+	runCommand = func(stdin []byte, name string, args ...string) ([]byte, error) {
+		require.Equal(t, secretTool, name)
+		return fn(stdin, args)
+	}
+}
+
+func TestLibsecretStore(t *testing.T) {
+	secrets := map[string][]byte{}
+	fakeCommand(t, func(stdin []byte, args []string) ([]byte, error) {
+		switch args[0] {
+		case "store":
+			require.Equal(t, []string{"--label", "test a", "service", "test", "key", "a"}, args[1:])
+			secrets[args[len(args)-1]] = stdin
+			return nil, nil
+		case "lookup":
+			v, ok := secrets[args[len(args)-1]]
+			if !ok {
+				return nil, fakeExitError(1)
+			}
+			return v, nil
+		case "clear":
+			delete(secrets, args[len(args)-1])
+			return nil, nil
+		}
+		return nil, errors.New("unexpected command")
+	})
+
+	s := libsecretStore{}
+	_, err := s.get("test", "a")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	require.NoError(t, s.set("test", "a", []byte("secret")))
+	assert.Equal(t, []byte("secret"), secrets["a"], "the secret must be passed on stdin")
+
+	v, err := s.get("test", "a")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), v)
+
+	require.NoError(t, s.delete("test", "a"))
+	assert.Empty(t, secrets)
+}
+
+func TestLibsecretStoreList(t *testing.T) {
+	out := strings.Join([]string{
+		"[/org/freedesktop/secrets/collection/login/1]",
+		"label = test a",
+		"secret = 1",
+		"attribute.key = a",
+		"attribute.service = test",
+		"[/org/freedesktop/secrets/collection/login/2]",
+		"label = test b",
+		"secret = attribute.key = c",
+		"attribute.service = test",
+		"attribute.key = b",
+	}, "\n")
+	fakeCommand(t, func(_ []byte, args []string) ([]byte, error) {
+		require.Equal(t, []string{"search", "--all", "service", "test"}, args)
+		return []byte(out), nil
+	})
+
+	keys, err := libsecretStore{}.list("test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+}
+
+func TestLibsecretStoreListEmpty(t *testing.T) {
+	fakeCommand(t, func(_ []byte, _ []string) ([]byte, error) {
+		return nil, fakeExitError(1)
+	})
+
+	keys, err := libsecretStore{}.list("test")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// memoryStore is an in memory nativeStore used to test the NativeKeystore logic.
+type memoryStore map[string]map[string][]byte
+
+func (m memoryStore) get(service, key string) ([]byte, error) {
+	value, ok := m[service][key]
+	if !ok {
+		return nil, ErrKeyDoesntExists
+	}
+	return value, nil
+}
+
+func (m memoryStore) set(service, key string, value []byte) error {
+	if m[service] == nil {
+		m[service] = map[string][]byte{}
+	}
+	m[service][key] = value
+	return nil
+}
+
+func (m memoryStore) delete(service, key string) error {
+	delete(m[service], key)
+	return nil
+}
+
+func (m memoryStore) list(service string) ([]string, error) {
+	keys := make([]string, 0, len(m[service]))
+	for key := range m[service] {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func TestNativeKeystoreStoreAndSave(t *testing.T) {
+	store := memoryStore{}
+	k := newNativeKeystore("test", store)
+	assert.False(t, k.IsPersisted())
+
+	require.NoError(t, k.Store("output.elasticsearch.password", []byte("secret")))
+
+	// Pending changes are visible but not written until Save.
+	v, err := k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "secret", v)
+	assert.Empty(t, store["test"])
+
+	require.NoError(t, k.Save())
+	assert.Equal(t, []byte("secret"), store["test"]["output.elasticsearch.password"])
+	assert.True(t, k.IsPersisted())
+
+	// Another keystore on the same service sees the saved secret, not other services.
+	v, err = newNativeKeystore("test", store).Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "secret", v)
+	_, err = newNativeKeystore("other", store).Retrieve("output.elasticsearch.password")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+}
+
+func TestNativeKeystoreDelete(t *testing.T) {
+	store := memoryStore{"test": {"a": []byte("1"), "b": []byte("2")}}
+	k := newNativeKeystore("test", store)
+
+	require.NoError(t, k.Delete("a"))
+	_, err := k.Retrieve("a")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	keys, err := k.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, keys)
+
+	require.NoError(t, k.Save())
+	assert.NotContains(t, store["test"], "a")
+}
+
+func TestNativeKeystoreListAndGetConfig(t *testing.T) {
+	store := memoryStore{"test": {"a": []byte("1")}}
+	k := newNativeKeystore("test", store)
+	require.NoError(t, k.Store("b", []byte("2")))
+
+	keys, err := k.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	cfg, err := k.GetConfig()
+	require.NoError(t, err)
+	var values map[string]string
+	require.NoError(t, cfg.Unpack(&values))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, values)
+}
+
+func TestNativeKeystoreCreate(t *testing.T) {
+	store := memoryStore{"test": {"a": []byte("1")}}
+	k := newNativeKeystore("test", store)
+
+	assert.ErrorIs(t, k.Create(false), ErrAlreadyExists)
+	assert.Contains(t, store["test"], "a")
+
+	require.NoError(t, k.Create(true))
+	assert.Empty(t, store["test"])
+	assert.False(t, k.IsPersisted())
+}
+
+func TestFactoryBackend(t *testing.T) {
+	_, err := Factory(config.MustNewConfigFrom(map[string]interface{}{"backend": "unknown"}), "", false)
+	assert.ErrorContains(t, err, "unknown keystore backend")
+
+	_, err = Factory(config.MustNewConfigFrom(map[string]interface{}{"backend": "native", "service": ""}), "", false)
+	assert.ErrorContains(t, err, "service cannot be empty")
+
+	path := GetTemporaryKeystoreFile(t)
+	k, err := Factory(config.MustNewConfigFrom(map[string]interface{}{"backend": "file", "path": path}), "", false)
+	require.NoError(t, err)
+	assert.IsType(t, &FileKeystore{}, k)
+}
+
+func assertSecret(t *testing.T, expected string, s *SecureString) {
+	t.Helper()
+	v, err := s.Get()
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(v))
+}
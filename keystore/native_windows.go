@@ -0,0 +1,174 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build windows
+
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	credMaxGenericBlobSize  = 5 * 512
+	credTargetNameSeparator = "/"
+	credEnumerateWildcard   = "*"
+)
+
+var (
+	modadvapi32        = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW      = modadvapi32.NewProc("CredReadW")
+	procCredWriteW     = modadvapi32.NewProc("CredWriteW")
+	procCredDeleteW    = modadvapi32.NewProc("CredDeleteW")
+	procCredEnumerateW = modadvapi32.NewProc("CredEnumerateW")
+	procCredFree       = modadvapi32.NewProc("CredFree")
+)
+
+// credential mirrors the CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// wincredStore stores the secrets as generic credentials in the Windows Credential Manager,
+// the blobs are protected by DPAPI for the account running the process. The target name of a
+// credential is "<service>/<key>".
+type wincredStore struct{}
+
+func newNativeStore() (nativeStore, error) {
+	if err := procCredReadW.Find(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNativeUnsupported, err)
+	}
+	return wincredStore{}, nil
+}
+
+func targetName(service, key string) string {
+	return service + credTargetNameSeparator + key
+}
+
+func (wincredStore) get(service, key string) ([]byte, error) {
+	target, err := windows.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *credential
+	r0, _, e1 := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r0 == 0 {
+		if errors.Is(e1, windows.ERROR_NOT_FOUND) {
+			return nil, ErrKeyDoesntExists
+		}
+		return nil, fmt.Errorf("CredReadW: %w", e1)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred))) //nolint:errcheck // CredFree returns nothing
+
+	value := make([]byte, cred.CredentialBlobSize)
+	if cred.CredentialBlobSize > 0 {
+		copy(value, unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize))
+	}
+	return value, nil
+}
+
+func (wincredStore) set(service, key string, value []byte) error {
+	if len(value) > credMaxGenericBlobSize {
+		return fmt.Errorf("secret of %d bytes exceeds the credential manager limit of %d bytes", len(value), credMaxGenericBlobSize)
+	}
+	target, err := windows.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return err
+	}
+	user, err := windows.UTF16PtrFromString(key)
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         target,
+		CredentialBlobSize: uint32(len(value)),
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+	if len(value) > 0 {
+		cred.CredentialBlob = &value[0]
+	}
+	r0, _, e1 := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r0 == 0 {
+		return fmt.Errorf("CredWriteW: %w", e1)
+	}
+	return nil
+}
+
+func (wincredStore) delete(service, key string) error {
+	target, err := windows.UTF16PtrFromString(targetName(service, key))
+	if err != nil {
+		return err
+	}
+	r0, _, e1 := procCredDeleteW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0)
+	if r0 == 0 && !errors.Is(e1, windows.ERROR_NOT_FOUND) {
+		return fmt.Errorf("CredDeleteW: %w", e1)
+	}
+	return nil
+}
+
+func (wincredStore) list(service string) ([]string, error) {
+	prefix := service + credTargetNameSeparator
+	filter, err := windows.UTF16PtrFromString(prefix + credEnumerateWildcard)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	var creds **credential
+	r0, _, e1 := procCredEnumerateW.Call(uintptr(unsafe.Pointer(filter)), 0, uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&creds)))
+	if r0 == 0 {
+		if errors.Is(e1, windows.ERROR_NOT_FOUND) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("CredEnumerateW: %w", e1)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(creds))) //nolint:errcheck // CredFree returns nothing
+
+	keys := make([]string, 0, count)
+	for _, cred := range unsafe.Slice(creds, count) {
+		if cred.Type != credTypeGeneric {
+			continue
+		}
+		name := windows.UTF16PtrToString(cred.TargetName)
+		if key, ok := strings.CutPrefix(name, prefix); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Scoped returns a view of the keystore that only sees the keys under scope, the keys of the view
+// are prefixed with the scope when accessing the keystore. Several components can share a
+// keystore through different scopes without name collisions or reading each other secrets.
+//
+// Scopes are nested using dots: the view of scope "a" sees the keys of scope "a.b" as "b.<key>",
+// and Scoped(Scoped(ks, "a"), "b") is the same as Scoped(ks, "a.b"). Components must use scopes
+// that are not nested in each other to keep their secrets apart. An empty scope, including a
+// scope of dots only, returns ks unchanged.
+//
+// The view implements WritableKeystore, ListingKeystore and WatchingKeystore only when the
+// keystore does. Saving a view saves every pending change of the underlying keystore.
+func Scoped(ks Keystore, scope string) Keystore {
+	scope = strings.Trim(scope, ".")
+	if scope == "" {
+		return ks
+	}
+	s := &scopedKeystore{base: ks, prefix: scope + "."}
+
+	writer, writable := ks.(WritableKeystore)
+	lister, listing := ks.(ListingKeystore)
+	watcher, watching := ks.(WatchingKeystore)
+	w := scopedWriter{s: s, base: writer, lister: lister}
+	l := scopedLister{s: s, base: lister}
+	wa := scopedWatcher{s: s, base: watcher}
+
+	switch {
+	case writable && listing && watching:
+		return struct {
+			*scopedKeystore
+			scopedWriter
+			scopedLister
+			scopedWatcher
+		}{s, w, l, wa}
+	case writable && listing:
+		return struct {
+			*scopedKeystore
+			scopedWriter
+			scopedLister
+		}{s, w, l}
+	case writable && watching:
+		return struct {
+			*scopedKeystore
+			scopedWriter
+			scopedWatcher
+		}{s, w, wa}
+	case listing && watching:
+		return struct {
+			*scopedKeystore
+			scopedLister
+			scopedWatcher
+		}{s, l, wa}
+	case writable:
+		return struct {
+			*scopedKeystore
+			scopedWriter
+		}{s, w}
+	case listing:
+		return struct {
+			*scopedKeystore
+			scopedLister
+		}{s, l}
+	case watching:
+		return struct {
+			*scopedKeystore
+			scopedWatcher
+		}{s, wa}
+	}
+	return s
+}
+
+type scopedKeystore struct {
+	base   Keystore
+	prefix string
+}
+
+func (s *scopedKeystore) key(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key cannot be empty")
+	}
+	return s.prefix + key, nil
+}
+
+// Retrieve returns the secret of the key inside the scope.
+func (s *scopedKeystore) Retrieve(key string) (*SecureString, error) {
+	full, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.base.Retrieve(full)
+}
+
+// GetConfig returns the secrets of the scope with the scope removed from the keys.
+func (s *scopedKeystore) GetConfig() (*config.C, error) {
+	if lister, ok := s.base.(ListingKeystore); ok {
+		keys, err := scopedKeys(lister, s.prefix)
+		if err != nil {
+			return nil, err
+		}
+		configHash := make(map[string]interface{}, len(keys))
+		for _, key := range keys {
+			secret, err := s.base.Retrieve(s.prefix + key)
+			if err != nil {
+				return nil, fmt.Errorf("could not retrieve key %q: %w", key, err)
+			}
+			value, err := secret.Get()
+			if err != nil {
+				return nil, err
+			}
+			configHash[key] = string(value)
+		}
+		return config.NewConfigFrom(configHash)
+	}
+
+	cfg, err := s.base.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	scope := strings.TrimSuffix(s.prefix, ".")
+	if ok, err := cfg.Has(scope, -1); err != nil || !ok {
+		return config.NewConfig(), nil //nolint:nilerr // a missing or non object scope has no secrets
+	}
+	return cfg.Child(scope, -1)
+}
+
+// IsPersisted returns if the underlying keystore is persisted.
+func (s *scopedKeystore) IsPersisted() bool {
+	return s.base.IsPersisted()
+}
+
+type scopedWriter struct {
+	s      *scopedKeystore
+	base   WritableKeystore
+	lister ListingKeystore
+}
+
+// Store adds the key pair inside the scope.
+func (w scopedWriter) Store(key string, secret []byte) error {
+	full, err := w.s.key(key)
+	if err != nil {
+		return err
+	}
+	return w.base.Store(full, secret)
+}
+
+// Delete removes the key from the scope.
+func (w scopedWriter) Delete(key string) error {
+	full, err := w.s.key(key)
+	if err != nil {
+		return err
+	}
+	return w.base.Delete(full)
+}
+
+// Create empties the scope, creating the underlying keystore if needed. If the scope already
+// holds keys and override is false ErrAlreadyExists is returned.
+func (w scopedWriter) Create(override bool) error {
+	if !w.s.base.IsPersisted() {
+		return w.base.Create(false)
+	}
+	if w.lister == nil {
+		return fmt.Errorf("cannot empty scope %q: %w", strings.TrimSuffix(w.s.prefix, "."), ErrNotListing)
+	}
+
+	keys, err := scopedKeys(w.lister, w.s.prefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) > 0 && !override {
+		return ErrAlreadyExists
+	}
+	for _, key := range keys {
+		if err := w.base.Delete(w.s.prefix + key); err != nil {
+			return err
+		}
+	}
+	return w.base.Save()
+}
+
+// Save persists the changes of the underlying keystore.
+func (w scopedWriter) Save() error {
+	return w.base.Save()
+}
+
+type scopedLister struct {
+	s    *scopedKeystore
+	base ListingKeystore
+}
+
+// List returns the keys of the scope without the scope prefix.
+func (l scopedLister) List() ([]string, error) {
+	return scopedKeys(l.base, l.s.prefix)
+}
+
+type scopedWatcher struct {
+	s    *scopedKeystore
+	base WatchingKeystore
+}
+
+// Watch notifies the changes of the key inside the scope.
+func (w scopedWatcher) Watch(key string) (<-chan struct{}, error) {
+	full, err := w.s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	return w.base.Watch(full)
+}
+
+func scopedKeys(lister ListingKeystore, prefix string) ([]string, error) {
+	all, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(all))
+	for _, key := range all {
+		if scoped, ok := strings.CutPrefix(key, prefix); ok && scoped != "" {
+			keys = append(keys, scoped)
+		}
+	}
+	return keys, nil
+}
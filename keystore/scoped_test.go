@@ -0,0 +1,164 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopedKeystore(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+
+	keystore, err := NewFileKeystore(path)
+	require.NoError(t, err)
+
+	es := Scoped(keystore, "outputs.elasticsearch")
+	fleet := Scoped(keystore, "fleet.")
+
+	esW, err := AsWritableKeystore(es)
+	require.NoError(t, err)
+	fleetW, err := AsWritableKeystore(fleet)
+	require.NoError(t, err)
+
+	require.NoError(t, esW.Create(false))
+	require.NoError(t, esW.Store("password", []byte("es-secret")))
+	require.NoError(t, fleetW.Store("password", []byte("fleet-secret")))
+	require.NoError(t, esW.Save())
+
+	v, err := es.Retrieve("password")
+	require.NoError(t, err)
+	assertSecret(t, "es-secret", v)
+	v, err = fleet.Retrieve("password")
+	require.NoError(t, err)
+	assertSecret(t, "fleet-secret", v)
+
+	// The keys are prefixed in the underlying keystore.
+	v, err = keystore.Retrieve("outputs.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "es-secret", v)
+
+	_, err = es.Retrieve("")
+	assert.Error(t, err)
+
+	esL, err := AsListingKeystore(es)
+	require.NoError(t, err)
+	keys, err := esL.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"password"}, keys)
+
+	cfg, err := es.GetConfig()
+	require.NoError(t, err)
+	var values map[string]string
+	require.NoError(t, cfg.Unpack(&values))
+	assert.Equal(t, map[string]string{"password": "es-secret"}, values)
+
+	// Creating a scope only empties that scope.
+	assert.ErrorIs(t, esW.Create(false), ErrAlreadyExists)
+	require.NoError(t, esW.Create(true))
+	keys, err = keystore.(*FileKeystore).List()
+	require.NoError(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"fleet.password"}, keys)
+}
+
+func TestScopedKeystoreInterfaces(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+	file, err := NewFileKeystore(path)
+	require.NoError(t, err)
+
+	scoped := Scoped(file, "a")
+	_, err = AsWritableKeystore(scoped)
+	assert.NoError(t, err)
+	_, err = AsListingKeystore(scoped)
+	assert.NoError(t, err)
+	_, err = AsWatchingKeystore(scoped)
+	assert.NoError(t, err)
+
+	// A read-only keystore stays read-only through the view.
+	scoped = Scoped(&CloudKeystore{}, "a")
+	_, err = AsWritableKeystore(scoped)
+	assert.ErrorIs(t, err, ErrNotWritable)
+	_, err = AsListingKeystore(scoped)
+	assert.ErrorIs(t, err, ErrNotListing)
+	_, err = AsWatchingKeystore(scoped)
+	assert.ErrorIs(t, err, ErrNotWatching)
+
+	// Scopes can be nested.
+	nested := Scoped(Scoped(file, "outputs"), "elasticsearch")
+	w, err := AsWritableKeystore(nested)
+	require.NoError(t, err)
+	require.NoError(t, w.Store("password", []byte("x")))
+	_, err = file.Retrieve("outputs.elasticsearch.password")
+	assert.NoError(t, err)
+}
+
+func TestScopedKeystoreEmptyScope(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+	file, err := NewFileKeystore(path)
+	require.NoError(t, err)
+
+	assert.Same(t, file, Scoped(file, ""))
+	assert.Same(t, file, Scoped(file, ".."))
+}
+
+func TestScopedKeystoreNestedScopes(t *testing.T) {
+	path := GetTemporaryKeystoreFile(t)
+	defer os.Remove(path)
+	file, err := NewFileKeystore(path)
+	require.NoError(t, err)
+
+	inner, err := AsWritableKeystore(Scoped(file, "outputs.elasticsearch"))
+	require.NoError(t, err)
+	require.NoError(t, inner.Store("password", []byte("x")))
+
+	// The keys of a nested scope are visible to the enclosing scope.
+	v, err := Scoped(file, "outputs").Retrieve("elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "x", v)
+
+	// Scopes sharing a prefix of their names are not nested.
+	_, err = Scoped(file, "output").Retrieve("s.elasticsearch.password")
+	assert.Error(t, err)
+}
+
+func TestScopedKeystoreGetConfigWithoutListing(t *testing.T) {
+	store := memoryStore{}
+	native := newNativeKeystore("test", store)
+	require.NoError(t, native.Store("outputs.elasticsearch.password", []byte("x")))
+	require.NoError(t, native.Store("fleet.password", []byte("y")))
+
+	// Hide the listing capability to exercise the GetConfig fallback.
+	base := struct{ Keystore }{native}
+	cfg, err := Scoped(base, "outputs.elasticsearch").GetConfig()
+	require.NoError(t, err)
+	var values map[string]string
+	require.NoError(t, cfg.Unpack(&values))
+	assert.Equal(t, map[string]string{"password": "x"}, values)
+
+	cfg, err = Scoped(base, "missing").GetConfig()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.GetFields())
+}
@@ -0,0 +1,558 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const (
+	// DefaultVaultMount is the default mount point of the KV v2 secrets engine.
+	DefaultVaultMount = "secret"
+
+	// DefaultVaultAppRoleMount is the default mount point of the AppRole auth method.
+	DefaultVaultAppRoleMount = "approle"
+
+	// DefaultVaultTimeout is the default timeout of a single request to Vault.
+	DefaultVaultTimeout = 30 * time.Second
+)
+
+var errVaultNotFound = errors.New("not found")
+
+// VaultConfig configures a keystore backed by a HashiCorp Vault KV v2 secret, every key of the
+// keystore is a field of the secret stored at Path.
+type VaultConfig struct {
+	// Address of the Vault server, defaults to the VAULT_ADDR environment variable.
+	Address   string `config:"address"`
+	Namespace string `config:"namespace"`
+	Mount     string `config:"mount"`
+	Path      string `config:"path"`
+
+	// Token used to authenticate, defaults to the VAULT_TOKEN environment variable when
+	// AppRole is not configured.
+	Token   string              `config:"token"`
+	AppRole *VaultAppRoleConfig `config:"approle"`
+
+	// Writable allows the keystore to be modified, by default the secret is only read.
+	Writable bool              `config:"writable"`
+	Timeout  time.Duration     `config:"timeout"`
+	TLS      *tlscommon.Config `config:"ssl"`
+}
+
+// VaultAppRoleConfig configures the AppRole authentication, the token is obtained by logging in
+// and a new login happens when the token cannot be renewed anymore.
+type VaultAppRoleConfig struct {
+	Mount    string `config:"mount"`
+	RoleID   string `config:"role_id"`
+	SecretID string `config:"secret_id"`
+}
+
+func defaultVaultConfig() VaultConfig {
+	return VaultConfig{
+		Mount:   DefaultVaultMount,
+		Timeout: DefaultVaultTimeout,
+	}
+}
+
+func (c *VaultConfig) validate() error {
+	if c.Address == "" {
+		c.Address = os.Getenv("VAULT_ADDR")
+	}
+	if c.Address == "" {
+		return errors.New("vault address is required")
+	}
+	if c.Path == "" {
+		return errors.New("vault path is required")
+	}
+	if c.Mount == "" {
+		c.Mount = DefaultVaultMount
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultVaultTimeout
+	}
+	if c.AppRole != nil {
+		if c.AppRole.RoleID == "" {
+			return errors.New("vault approle role_id is required")
+		}
+		if c.AppRole.Mount == "" {
+			c.AppRole.Mount = DefaultVaultAppRoleMount
+		}
+		return nil
+	}
+	if c.Token == "" {
+		c.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if c.Token == "" {
+		return errors.New("vault token or approle is required")
+	}
+	return nil
+}
+
+// VaultKeystore reads and writes the secrets of a Vault KV v2 secret. Secrets are read from
+// Vault on every access so rotated credentials are picked up, changes are buffered in memory and
+// written on Save using check-and-set so concurrent writers don't overwrite each other.
+type VaultKeystore struct {
+	client *vaultClient
+	path   string
+
+	mu sync.RWMutex
+	// pending holds the unsaved changes, a nil value marks a deleted key.
+	pending map[string][]byte
+}
+
+// readOnlyVaultKeystore hides the write methods of a VaultKeystore that isn't writable.
+type readOnlyVaultKeystore struct {
+	k *VaultKeystore
+}
+
+func (r readOnlyVaultKeystore) Retrieve(key string) (*SecureString, error) { return r.k.Retrieve(key) }
+func (r readOnlyVaultKeystore) GetConfig() (*config.C, error)              { return r.k.GetConfig() }
+func (r readOnlyVaultKeystore) IsPersisted() bool                          { return r.k.IsPersisted() }
+func (r readOnlyVaultKeystore) List() ([]string, error)                    { return r.k.List() }
+
+// NewVaultKeystore returns a keystore backed by Vault. The returned keystore only implements
+// WritableKeystore when cfg.Writable is set.
+func NewVaultKeystore(cfg VaultConfig, logger *logp.Logger) (Keystore, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	client, err := newVaultClient(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &VaultKeystore{
+		client:  client,
+		path:    cfg.Path,
+		pending: make(map[string][]byte),
+	}
+	if !cfg.Writable {
+		return readOnlyVaultKeystore{k}, nil
+	}
+	return k, nil
+}
+
+// Retrieve returns the secret for the key, unsaved changes take precedence over Vault.
+func (k *VaultKeystore) Retrieve(key string) (*SecureString, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if value, ok := k.pending[key]; ok {
+		if value == nil {
+			return nil, ErrKeyDoesntExists
+		}
+		return NewSecureString(value), nil
+	}
+
+	secrets, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := secrets[key]
+	if !ok {
+		return nil, ErrKeyDoesntExists
+	}
+	return NewSecureString([]byte(value)), nil
+}
+
+// GetConfig returns config.C representation of the key / secret pair to be merged with other
+// loaded configuration.
+func (k *VaultKeystore) GetConfig() (*config.C, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	secrets, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	k.applyPending(secrets)
+
+	configHash := make(map[string]interface{}, len(secrets))
+	for key, value := range secrets {
+		configHash[key] = value
+	}
+	return config.NewConfigFrom(configHash)
+}
+
+// IsPersisted returns true when the secret exists in Vault.
+func (k *VaultKeystore) IsPersisted() bool {
+	_, version, err := k.read()
+	return err == nil && version > 0
+}
+
+// List returns the available keys, including the unsaved ones.
+func (k *VaultKeystore) List() ([]string, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	secrets, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	k.applyPending(secrets)
+
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Store adds the key pair to the keystore, the change is written to Vault on Save.
+func (k *VaultKeystore) Store(key string, value []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pending[key] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete removes the key from the keystore, the change is written to Vault on Save.
+func (k *VaultKeystore) Delete(key string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.pending[key] = nil
+	return nil
+}
+
+// Save writes a new version of the secret containing the pending changes.
+func (k *VaultKeystore) Save() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if len(k.pending) == 0 {
+		return nil
+	}
+
+	secrets, version, err := k.read()
+	if err != nil {
+		return err
+	}
+	k.applyPending(secrets)
+	if err := k.write(secrets, version); err != nil {
+		return err
+	}
+	k.pending = make(map[string][]byte)
+	return nil
+}
+
+// Create writes an empty secret, if the secret already holds keys and override is false
+// ErrAlreadyExists is returned.
+func (k *VaultKeystore) Create(override bool) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets, version, err := k.read()
+	if err != nil {
+		return err
+	}
+	if len(secrets) > 0 && !override {
+		return ErrAlreadyExists
+	}
+	if err := k.write(map[string]string{}, version); err != nil {
+		return err
+	}
+	k.pending = make(map[string][]byte)
+	return nil
+}
+
+// applyPending merges the unsaved changes into secrets, the caller must hold the lock.
+func (k *VaultKeystore) applyPending(secrets map[string]string) {
+	for key, value := range k.pending {
+		if value == nil {
+			delete(secrets, key)
+		} else {
+			secrets[key] = string(value)
+		}
+	}
+}
+
+type vaultKVResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// read returns the fields of the secret and its version, a missing secret has version 0.
+func (k *VaultKeystore) read() (map[string]string, int, error) {
+	ctx, cancel := k.client.context()
+	defer cancel()
+
+	var resp vaultKVResponse
+	err := k.client.do(ctx, http.MethodGet, k.client.kvPath("data", k.path), nil, &resp)
+	if errors.Is(err, errVaultNotFound) {
+		return map[string]string{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read vault secret %q: %w", k.path, err)
+	}
+
+	secrets := make(map[string]string, len(resp.Data.Data))
+	for key, value := range resp.Data.Data {
+		switch v := value.(type) {
+		case string:
+			secrets[key] = v
+		default:
+			// Vault allows any JSON value, keep non string values in their JSON form.
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, 0, fmt.Errorf("could not encode vault field %q: %w", key, err)
+			}
+			secrets[key] = string(raw)
+		}
+	}
+	return secrets, resp.Data.Metadata.Version, nil
+}
+
+// write stores a new version of the secret, failing if the current version isn't version.
+func (k *VaultKeystore) write(secrets map[string]string, version int) error {
+	ctx, cancel := k.client.context()
+	defer cancel()
+
+	body := map[string]interface{}{
+		"options": map[string]interface{}{"cas": version},
+		"data":    secrets,
+	}
+	if err := k.client.do(ctx, http.MethodPost, k.client.kvPath("data", k.path), body, nil); err != nil {
+		return fmt.Errorf("could not write vault secret %q: %w", k.path, err)
+	}
+	return nil
+}
+
+// vaultClient is a minimal client of the Vault HTTP API that keeps its token valid.
+type vaultClient struct {
+	cfg    VaultConfig
+	base   *url.URL
+	http   *http.Client
+	logger *logp.Logger
+	now    func() time.Time
+
+	mu    sync.Mutex
+	token string
+	// renewAt is when the token must be renewed, zero when the token doesn't expire.
+	renewAt   time.Time
+	renewable bool
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+func newVaultClient(cfg VaultConfig, logger *logp.Logger) (*vaultClient, error) {
+	base, err := url.Parse(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault address %q: %w", cfg.Address, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:errcheck // DefaultTransport is always a *http.Transport
+	if cfg.TLS != nil {
+		tlsCfg, err := tlscommon.LoadTLSConfig(cfg.TLS, logger)
+		if err != nil {
+			return nil, fmt.Errorf("could not load vault TLS configuration: %w", err)
+		}
+		if tlsCfg != nil {
+			transport.TLSClientConfig = tlsCfg.BuildModuleClientConfig(base.Hostname())
+		}
+	}
+
+	return &vaultClient{
+		cfg:    cfg,
+		base:   base,
+		http:   &http.Client{Transport: transport},
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+func (c *vaultClient) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.cfg.Timeout)
+}
+
+func (c *vaultClient) kvPath(kind, path string) string {
+	return strings.Trim(c.cfg.Mount, "/") + "/" + kind + "/" + strings.Trim(path, "/")
+}
+
+// do sends an authenticated request, making sure the token is valid first.
+func (c *vaultClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := c.validToken(ctx)
+	if err != nil {
+		return fmt.Errorf("could not authenticate to vault: %w", err)
+	}
+	return c.send(ctx, method, path, token, body, out)
+}
+
+// validToken returns the current token, logging in or renewing it when needed.
+func (c *vaultClient) validToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	switch {
+	case c.token == "" && c.cfg.AppRole != nil:
+		err = c.login(ctx)
+	case c.token == "":
+		err = c.lookup(ctx)
+	case c.renewAt.IsZero() || c.now().Before(c.renewAt):
+	case c.renewable:
+		if err = c.renew(ctx); err != nil && c.cfg.AppRole != nil {
+			c.logger.Warnf("Failed to renew vault token, logging in again: %v", err)
+			err = c.login(ctx)
+		}
+	case c.cfg.AppRole != nil:
+		err = c.login(ctx)
+	default:
+		// A static token that cannot be renewed is used until Vault rejects it.
+		c.renewAt = time.Time{}
+	}
+	if err != nil {
+		return "", err
+	}
+	return c.token, nil
+}
+
+// login obtains a token using AppRole, the caller must hold the lock.
+func (c *vaultClient) login(ctx context.Context) error {
+	body := map[string]string{"role_id": c.cfg.AppRole.RoleID}
+	if c.cfg.AppRole.SecretID != "" {
+		body["secret_id"] = c.cfg.AppRole.SecretID
+	}
+	var resp struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	path := "auth/" + strings.Trim(c.cfg.AppRole.Mount, "/") + "/login"
+	if err := c.send(ctx, http.MethodPost, path, "", body, &resp); err != nil {
+		return fmt.Errorf("approle login failed: %w", err)
+	}
+	c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// lookup discovers the TTL of the configured static token, the caller must hold the lock.
+func (c *vaultClient) lookup(ctx context.Context) error {
+	var resp struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.send(ctx, http.MethodGet, "auth/token/lookup-self", c.cfg.Token, nil, &resp); err != nil {
+		return fmt.Errorf("token lookup failed: %w", err)
+	}
+	c.setToken(c.cfg.Token, resp.Data.TTL, resp.Data.Renewable)
+	return nil
+}
+
+// renew extends the lease of the current token, the caller must hold the lock.
+func (c *vaultClient) renew(ctx context.Context) error {
+	var resp struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	if err := c.send(ctx, http.MethodPost, "auth/token/renew-self", c.token, map[string]string{}, &resp); err != nil {
+		return fmt.Errorf("token renewal failed: %w", err)
+	}
+	c.setToken(c.token, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// setToken records the token and schedules its renewal after two thirds of its TTL.
+func (c *vaultClient) setToken(token string, ttl int, renewable bool) {
+	c.token = token
+	c.renewable = renewable
+	c.renewAt = time.Time{}
+	if ttl > 0 {
+		c.renewAt = c.now().Add(time.Duration(ttl) * time.Second * 2 / 3)
+	}
+}
+
+func (c *vaultClient) send(ctx context.Context, method, path, token string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base.JoinPath("v1", path).String(), reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errVaultNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(raw, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(vaultErr.Errors, ", "))
+		}
+		return fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,296 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package keystore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+// fakeVault implements the subset of the Vault API used by the keystore.
+type fakeVault struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	data     map[string]interface{}
+	version  int
+	tokens   map[string]bool
+	logins   int
+	renewals int
+	ttl      int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	v := &fakeVault{t: t, tokens: map[string]bool{"root": true}, ttl: 3600}
+	srv := httptest.NewServer(v)
+	t.Cleanup(srv.Close)
+	return v, srv
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	reply := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		if body != nil {
+			require.NoError(v.t, json.NewEncoder(w).Encode(body))
+		}
+	}
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		require.NoError(v.t, json.NewDecoder(r.Body).Decode(&body))
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			reply(http.StatusBadRequest, map[string][]string{"errors": {"invalid role or secret ID"}})
+			return
+		}
+		v.logins++
+		token := "approle-" + string(rune('0'+v.logins))
+		v.tokens[token] = true
+		reply(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": token, "lease_duration": v.ttl, "renewable": true}})
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		reply(http.StatusForbidden, map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/auth/token/lookup-self":
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"ttl": 0, "renewable": false}})
+	case r.URL.Path == "/v1/auth/token/renew-self":
+		v.renewals++
+		reply(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{"client_token": r.Header.Get("X-Vault-Token"), "lease_duration": v.ttl, "renewable": true}})
+	case r.URL.Path == "/v1/secret/data/agent/keystore" && r.Method == http.MethodGet:
+		if v.version == 0 {
+			reply(http.StatusNotFound, map[string][]string{"errors": {}})
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"data": v.data, "metadata": map[string]interface{}{"version": v.version}}})
+	case r.URL.Path == "/v1/secret/data/agent/keystore" && r.Method == http.MethodPost:
+		var body struct {
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+			Data map[string]interface{} `json:"data"`
+		}
+		require.NoError(v.t, json.NewDecoder(r.Body).Decode(&body))
+		if body.Options.CAS != v.version {
+			reply(http.StatusBadRequest, map[string][]string{"errors": {"check-and-set parameter did not match the current version"}})
+			return
+		}
+		v.data = body.Data
+		v.version++
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": v.version}})
+	default:
+		reply(http.StatusNotFound, map[string][]string{"errors": {}})
+	}
+}
+
+func (v *fakeVault) set(data map[string]interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.data = data
+	v.version++
+}
+
+func vaultConfig(addr string) VaultConfig {
+	cfg := defaultVaultConfig()
+	cfg.Address = addr
+	cfg.Path = "agent/keystore"
+	cfg.Token = "root"
+	return cfg
+}
+
+func TestVaultKeystoreRead(t *testing.T) {
+	vault, srv := newFakeVault(t)
+	vault.set(map[string]interface{}{"output.elasticsearch.password": "changeme", "port": 9200})
+
+	k, err := NewVaultKeystore(vaultConfig(srv.URL), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.True(t, k.IsPersisted())
+
+	_, err = AsWritableKeystore(k)
+	assert.ErrorIs(t, err, ErrNotWritable, "keystore must be read-only by default")
+
+	v, err := k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "changeme", v)
+
+	v, err = k.Retrieve("port")
+	require.NoError(t, err)
+	assertSecret(t, "9200", v)
+
+	_, err = k.Retrieve("missing")
+	assert.ErrorIs(t, err, ErrKeyDoesntExists)
+
+	// Rotated secrets are picked up without recreating the keystore.
+	vault.set(map[string]interface{}{"output.elasticsearch.password": "rotated"})
+	v, err = k.Retrieve("output.elasticsearch.password")
+	require.NoError(t, err)
+	assertSecret(t, "rotated", v)
+
+	listing, err := AsListingKeystore(k)
+	require.NoError(t, err)
+	keys, err := listing.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"output.elasticsearch.password"}, keys)
+}
+
+func TestVaultKeystoreWrite(t *testing.T) {
+	vault, srv := newFakeVault(t)
+
+	cfg := vaultConfig(srv.URL)
+	cfg.Writable = true
+	k, err := NewVaultKeystore(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.False(t, k.IsPersisted())
+
+	w, err := AsWritableKeystore(k)
+	require.NoError(t, err)
+	require.NoError(t, w.Create(false))
+	require.NoError(t, w.Store("a", []byte("1")))
+	require.NoError(t, w.Store("b", []byte("2")))
+	require.NoError(t, w.Save())
+	assert.Equal(t, map[string]interface{}{"a": "1", "b": "2"}, vault.data)
+
+	require.NoError(t, w.Delete("a"))
+	cfgC, err := k.GetConfig()
+	require.NoError(t, err)
+	var values map[string]string
+	require.NoError(t, cfgC.Unpack(&values))
+	assert.Equal(t, map[string]string{"b": "2"}, values)
+	require.NoError(t, w.Save())
+	assert.Equal(t, map[string]interface{}{"b": "2"}, vault.data)
+
+	assert.ErrorIs(t, w.Create(false), ErrAlreadyExists)
+	require.NoError(t, w.Create(true))
+	assert.Empty(t, vault.data)
+}
+
+func TestVaultKeystoreAppRoleRenewal(t *testing.T) {
+	vault, srv := newFakeVault(t)
+	vault.set(map[string]interface{}{"a": "1"})
+
+	cfg := vaultConfig(srv.URL)
+	cfg.Token = ""
+	cfg.AppRole = &VaultAppRoleConfig{RoleID: "role", SecretID: "secret"}
+	k, err := NewVaultKeystore(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	client := k.(readOnlyVaultKeystore).k.client
+	now := time.Now()
+	client.now = func() time.Time { return now }
+
+	_, err = k.Retrieve("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, vault.logins)
+
+	// The token is renewed once two thirds of its TTL have elapsed.
+	now = now.Add(41 * time.Minute)
+	_, err = k.Retrieve("a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, vault.renewals)
+	assert.Equal(t, 1, vault.logins)
+
+	// When the renewal fails a new login happens.
+	vault.mu.Lock()
+	vault.tokens = map[string]bool{}
+	vault.mu.Unlock()
+	now = now.Add(time.Hour)
+	_, err = k.Retrieve("a")
+	require.NoError(t, err)
+	assert.Equal(t, 2, vault.logins)
+}
+
+func TestVaultKeystoreErrors(t *testing.T) {
+	_, srv := newFakeVault(t)
+
+	cfg := vaultConfig(srv.URL)
+	cfg.Token = "invalid"
+	k, err := NewVaultKeystore(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	_, err = k.Retrieve("a")
+	assert.ErrorContains(t, err, "permission denied")
+
+	cfg = vaultConfig(srv.URL)
+	cfg.Token = ""
+	cfg.AppRole = &VaultAppRoleConfig{RoleID: "role", SecretID: "wrong"}
+	k, err = NewVaultKeystore(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	_, err = k.Retrieve("a")
+	assert.ErrorContains(t, err, "invalid role or secret ID")
+}
+
+func TestVaultConfigValidate(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+
+	tests := map[string]struct {
+		cfg map[string]interface{}
+		err string
+	}{
+		"missing address": {
+			cfg: map[string]interface{}{"path": "a", "token": "t"},
+			err: "vault address is required",
+		},
+		"missing path": {
+			cfg: map[string]interface{}{"address": "http://localhost:8200", "token": "t"},
+			err: "vault path is required",
+		},
+		"missing auth": {
+			cfg: map[string]interface{}{"address": "http://localhost:8200", "path": "a"},
+			err: "vault token or approle is required",
+		},
+		"missing role id": {
+			cfg: map[string]interface{}{"address": "http://localhost:8200", "path": "a", "approle.secret_id": "s"},
+			err: "role_id is required",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := config.MustNewConfigFrom(map[string]interface{}{"backend": "vault", "vault": tc.cfg})
+			cfg := defaultConfig()
+			err := c.Unpack(&cfg)
+			require.Error(t, err)
+			assert.True(t, strings.Contains(err.Error(), tc.err), err.Error())
+		})
+	}
+
+	t.Setenv("VAULT_ADDR", "http://localhost:8200")
+	t.Setenv("VAULT_TOKEN", "root")
+	c := config.MustNewConfigFrom(map[string]interface{}{"backend": "vault", "vault.path": "a"})
+	cfg := defaultConfig()
+	require.NoError(t, c.Unpack(&cfg))
+	assert.Equal(t, "http://localhost:8200", cfg.Vault.Address)
+	assert.Equal(t, "root", cfg.Vault.Token)
+	assert.Equal(t, DefaultVaultMount, cfg.Vault.Mount)
+}
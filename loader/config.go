@@ -20,7 +20,6 @@ package loader
 import (
 	"fmt"
 	"io"
-	"os"
 
 	"gopkg.in/yaml.v2"
 
@@ -200,12 +199,10 @@ func (c *Config) Enabled() bool {
 }
 
 // LoadFile take a path and load the file and return a new configuration.
+// Files listed in the top-level `include` setting are loaded and merged
+// into the configuration, see IncludeKey.
 func LoadFile(path string) (*Config, error) {
-	fp, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	return NewConfigFrom(fp)
+	return loadFileWithIncludes(path, nil)
 }
 
 // LoadFiles takes multiples files, load and merge all of them in a single one.
@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-ucfg"
+	"github.com/elastic/go-ucfg/cfgutil"
+)
+
+// IncludeKey is the top-level setting listing the files to include into a
+// configuration file.
+const IncludeKey = "include"
+
+// ErrIncludeCycle is returned if a configuration file includes itself,
+// directly or through other included files.
+var ErrIncludeCycle = errors.New("include cycle detected")
+
+// loadFileWithIncludes loads the configuration file at path and merges the
+// files listed in its `include` setting.
+//
+// Entries are glob patterns, relative to the directory of the including file.
+// Included files are merged in the order of the patterns, and files matching
+// the same pattern in lexical order. The settings of the including file are
+// merged last, so they take precedence over the included files. Patterns
+// without wildcards must match an existing file.
+//
+// The stack holds the absolute paths of the files currently being loaded.
+func loadFileWithIncludes(path string, stack []string) (*Config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range stack {
+		if p == abs {
+			chain := strings.Join(stack[i:], " -> ")
+			return nil, fmt.Errorf("%w: %v -> %v", ErrIncludeCycle, chain, abs)
+		}
+	}
+
+	fp, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := NewConfigFrom(fp)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.access().HasField(IncludeKey) {
+		return cfg, nil
+	}
+
+	var includes struct {
+		Include []string `config:"include"`
+	}
+	if err := cfg.Unpack(&includes); err != nil {
+		return nil, fmt.Errorf("failed to read %v setting of '%v': %w", IncludeKey, path, err)
+	}
+	if _, err := cfg.access().Remove(IncludeKey, -1, ucfg.PathSep(".")); err != nil {
+		return nil, err
+	}
+
+	files, err := expandIncludes(filepath.Dir(path), includes.Include)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve includes of '%v': %w", path, err)
+	}
+
+	stack = append(stack[:len(stack):len(stack)], abs)
+	merger := cfgutil.NewCollector(nil)
+	for _, f := range files {
+		sub, err := loadFileWithIncludes(f, stack)
+		if err != nil {
+			if errors.Is(err, ErrIncludeCycle) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("failed to include '%v' from '%v': %w", f, path, err)
+		}
+		if err := merger.Add(sub.access(), nil); err != nil {
+			return nil, fmt.Errorf("failed to merge '%v' included from '%v': %w", f, path, err)
+		}
+	}
+	if err := merger.Add(cfg.access(), nil); err != nil {
+		return nil, fmt.Errorf("failed to merge '%v' with its includes: %w", path, err)
+	}
+	return newConfigFrom(merger.Config()), nil
+}
+
+func expandIncludes(dir string, patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		if !strings.ContainsAny(pattern, "*?[") {
+			if _, err := os.Stat(pattern); err != nil {
+				return nil, err
+			}
+			files = append(files, pattern)
+			continue
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern '%v': %w", pattern, err)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	}
+}
+
+func TestLoadFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"agent.yml": `
+include: [outputs.yml, "conf.d/*.yml"]
+agent.logging.level: info
+outputs.default.hosts: ["127.0.0.1:9200"]
+`,
+		"outputs.yml": `
+outputs.default:
+  type: elasticsearch
+  hosts: ["localhost:9200"]
+`,
+		"conf.d/10-logging.yml": `
+include: ../logging/base.yml
+agent.logging.level: debug
+agent.logging.to_files: false
+`,
+		"conf.d/20-logging.yml": `
+agent.logging.to_files: true
+`,
+		"conf.d/ignored.yaml": `
+agent.ignored: true
+`,
+		"logging/base.yml": `
+agent.logging.metrics.enabled: false
+`,
+	})
+
+	cfg, err := LoadFile(filepath.Join(dir, "agent.yml"))
+	require.NoError(t, err)
+
+	raw, err := cfg.ToMapStr()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"agent": map[string]interface{}{
+			"logging": map[string]interface{}{
+				"level":    "info",
+				"to_files": true,
+				"metrics": map[string]interface{}{
+					"enabled": false,
+				},
+			},
+		},
+		"outputs": map[string]interface{}{
+			"default": map[string]interface{}{
+				"type":  "elasticsearch",
+				"hosts": []interface{}{"127.0.0.1:9200"},
+			},
+		},
+	}, raw)
+}
+
+func TestLoadFileIncludeErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"self.yml":    "include: self.yml",
+		"a.yml":       "include: b.yml",
+		"b.yml":       "include: [c/*.yml]",
+		"c/c.yml":     "include: ../a.yml",
+		"missing.yml": "include: does-not-exist.yml",
+		"empty.yml":   "include: [none/*.yml]\na: 1",
+	})
+
+	_, err := LoadFile(filepath.Join(dir, "self.yml"))
+	assert.ErrorIs(t, err, ErrIncludeCycle)
+
+	_, err = LoadFile(filepath.Join(dir, "a.yml"))
+	require.ErrorIs(t, err, ErrIncludeCycle)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "c", "c.yml"))
+
+	_, err = LoadFile(filepath.Join(dir, "missing.yml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	cfg, err := LoadFile(filepath.Join(dir, "empty.yml"))
+	require.NoError(t, err)
+	raw, err := cfg.ToMapStr()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": uint64(1)}, raw)
+}
@@ -18,7 +18,11 @@
 package logp
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"github.com/elastic/elastic-agent-libs/file"
 )
 
 // Config contains the configuration options for the logger. To create a Config
@@ -51,12 +55,27 @@ type FileConfig struct {
 	Name            string        `config:"name" yaml:"name"`
 	MaxSize         uint          `config:"rotateeverybytes" yaml:"rotateeverybytes" validate:"min=1"`
 	MaxBackups      uint          `config:"keepfiles" yaml:"keepfiles" validate:"max=1024"`
+	MaxAge          time.Duration `config:"max_age" yaml:"max_age"`
+	Compression     string        `config:"compression" yaml:"compression"`
 	Permissions     uint32        `config:"permissions"`
 	Interval        time.Duration `config:"interval"`
 	RotateOnStartup bool          `config:"rotateonstartup"`
 	RedirectStderr  bool          `config:"redirect_stderr" yaml:"redirect_stderr"`
 }
 
+// Validate checks the compression is supported and the max age is not negative.
+func (c *FileConfig) Validate() error {
+	switch file.CompressionType(c.Compression) {
+	case file.CompressionNone, file.CompressionGzip, file.CompressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %q, must be one of gzip or zstd", c.Compression)
+	}
+	if c.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	return nil
+}
+
 // MetricsConfig contains configuration used by the monitor to output metrics into the logstream.
 //
 // Currently these options are not used through this object in beats (as monitoring is setup elsewhere).
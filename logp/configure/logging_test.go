@@ -19,6 +19,7 @@ package configure
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -111,3 +112,18 @@ func TestLoggerOutputEnvironment(t *testing.T) {
 		})
 	}
 }
+
+func TestFilesCompressionValidation(t *testing.T) {
+	cfg := logp.DefaultConfig(logp.DefaultEnvironment)
+	err := config.MustNewConfigFrom(map[string]interface{}{
+		"files": map[string]interface{}{"compression": "zstd", "max_age": "72h"},
+	}).Unpack(&cfg)
+	require.NoError(t, err)
+	require.Equal(t, "zstd", cfg.Files.Compression)
+	require.Equal(t, 72*time.Hour, cfg.Files.MaxAge)
+
+	err = config.MustNewConfigFrom(map[string]interface{}{
+		"files": map[string]interface{}{"compression": "lz4"},
+	}).Unpack(&cfg)
+	require.ErrorContains(t, err, `unsupported compression "lz4"`)
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logp
+
+import (
+	"io"
+	"sync"
+
+	"go.elastic.co/ecszap"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RingBuffer keeps the most recent log entries in memory, e.g. to include
+// them in diagnostics. Entries are encoded as JSON lines.
+type RingBuffer struct {
+	core zapcore.Core
+
+	mu      sync.Mutex
+	entries [][]byte
+	next    int
+	full    bool
+}
+
+// NewRingBuffer creates a RingBuffer keeping the last size entries logged at
+// the given level or above.
+func NewRingBuffer(size int, level zapcore.LevelEnabler) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	r := &RingBuffer{entries: make([][]byte, size)}
+	encoder := zapcore.NewJSONEncoder(ecszap.ECSCompatibleEncoderConfig(JSONEncoderConfig()))
+	r.core = zapcore.NewCore(encoder, zapcore.AddSync(r), level)
+	return r
+}
+
+// Core returns the core writing to the ring buffer.
+func (r *RingBuffer) Core() zapcore.Core {
+	return r.core
+}
+
+// Option returns a LogOption making a logger write to the ring buffer in
+// addition to its existing outputs.
+func (r *RingBuffer) Option() LogOption {
+	return zap.WrapCore(func(in zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(in, r.core)
+	})
+}
+
+// Write stores a single encoded entry, evicting the oldest entry if the
+// buffer is full.
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	entry := make([]byte, len(p))
+	copy(entry, p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[r.next] = entry
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+	return len(p), nil
+}
+
+// Entries returns the buffered entries, oldest first.
+func (r *RingBuffer) Entries() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([][]byte(nil), r.entries[:r.next]...)
+	}
+	entries := make([][]byte, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// WriteTo writes the buffered entries to w, oldest first.
+func (r *RingBuffer) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, entry := range r.Entries() {
+		n, err := w.Write(entry)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRingBuffer(t *testing.T) {
+	ring := NewRingBuffer(3, zapcore.InfoLevel)
+	logger := NewNopLogger().WithOptions(ring.Option()).Named("test")
+
+	assert.Empty(t, ring.Entries())
+
+	logger.Debug("not recorded")
+	for i := range 5 {
+		logger.Infow("message", "i", i)
+	}
+
+	entries := ring.Entries()
+	require.Len(t, entries, 3)
+	for i, entry := range entries {
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal(entry, &fields))
+		assert.Equal(t, "message", fields["message"])
+		assert.Equal(t, "test", fields["log.logger"])
+		assert.EqualValues(t, i+2, fields["i"])
+	}
+
+	var buf bytes.Buffer
+	n, err := ring.WriteTo(&buf)
+	require.NoError(t, err)
+	assert.EqualValues(t, buf.Len(), n)
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+}
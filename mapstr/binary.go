@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+
+	structform "github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MarshalCBOR encodes the map as CBOR (RFC 8949). Unlike encoding via JSON,
+// integers are encoded without loss of precision.
+func (m M) MarshalCBOR() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gotype.Fold(map[string]interface{}(m), cborl.NewVisitor(&buf)); err != nil {
+		return nil, fmt.Errorf("failed to encode CBOR: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalCBOR decodes a CBOR encoded map into m. Nested maps are decoded
+// as map[string]interface{}, integers as int64, or as uint64 if the value does
+// not fit into an int64, and floating point numbers as float64.
+func (m *M) UnmarshalCBOR(data []byte) error {
+	var tmp map[string]interface{}
+	u, err := gotype.NewUnfolder(&tmp)
+	if err != nil {
+		return err
+	}
+	dec := &cborDecoder{Unfolder: u}
+	if err := cborl.Parse(data, dec); err != nil {
+		return fmt.Errorf("failed to decode CBOR: %w", err)
+	}
+	if !dec.done {
+		return errors.New("failed to decode CBOR: unexpected end of input")
+	}
+	if tmp == nil {
+		tmp = map[string]interface{}{}
+	}
+
+	*m = M(normalizeNumbers(tmp).(map[string]interface{}))
+	return nil
+}
+
+// cborDecoder tracks the nesting of the decoded values, as the parser does
+// not report truncated input.
+type cborDecoder struct {
+	*gotype.Unfolder
+	depth int
+	done  bool
+}
+
+func (d *cborDecoder) OnObjectStart(l int, bt structform.BaseType) error {
+	d.depth++
+	return d.Unfolder.OnObjectStart(l, bt)
+}
+
+func (d *cborDecoder) OnObjectFinished() error {
+	d.depth--
+	d.done = d.depth == 0
+	return d.Unfolder.OnObjectFinished()
+}
+
+func (d *cborDecoder) OnArrayStart(l int, bt structform.BaseType) error {
+	d.depth++
+	return d.Unfolder.OnArrayStart(l, bt)
+}
+
+func (d *cborDecoder) OnArrayFinished() error {
+	d.depth--
+	return d.Unfolder.OnArrayFinished()
+}
+
+// MarshalMsgpack encodes the map as MessagePack. Unlike encoding via JSON,
+// integers are encoded without loss of precision.
+func (m M) MarshalMsgpack() ([]byte, error) {
+	// Encode the underlying map type, msgpack would call MarshalMsgpack again
+	// otherwise.
+	b, err := msgpack.Marshal(map[string]interface{}(m))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode MessagePack: %w", err)
+	}
+	return b, nil
+}
+
+// UnmarshalMsgpack decodes a MessagePack encoded map into m. Values are
+// decoded like by UnmarshalCBOR.
+func (m *M) UnmarshalMsgpack(data []byte) error {
+	var tmp map[string]interface{}
+	if err := msgpack.Unmarshal(data, &tmp); err != nil {
+		return fmt.Errorf("failed to decode MessagePack: %w", err)
+	}
+
+	*m = M(normalizeNumbers(tmp).(map[string]interface{}))
+	return nil
+}
+
+// normalizeNumbers converts the numbers in a decoded value to int64, uint64
+// and float64, independent of the size used in the encoding.
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, elem := range v {
+			v[k] = normalizeNumbers(elem)
+		}
+		if v == nil {
+			return map[string]interface{}{}
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = normalizeNumbers(elem)
+		}
+		return v
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint:
+		return normalizeUint(uint64(v))
+	case uint64:
+		return normalizeUint(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+func normalizeUint(v uint64) interface{} {
+	if v > math.MaxInt64 {
+		return v
+	}
+	return int64(v)
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryEncoding(t *testing.T) {
+	in := M{
+		"int":     int64(math.MaxInt64),
+		"neg":     int64(math.MinInt64),
+		"small":   5,
+		"uint":    uint64(math.MaxUint64),
+		"float":   1.5,
+		"float32": float32(2.5),
+		"string":  "text",
+		"bool":    true,
+		"nil":     nil,
+		"bytes":   []byte("hi"),
+		"array":   []interface{}{1, "x", false},
+		"nested":  M{"a": M{"b": int32(-1)}},
+		"empty":   M{},
+	}
+
+	expected := M{
+		"int":     int64(math.MaxInt64),
+		"neg":     int64(math.MinInt64),
+		"small":   int64(5),
+		"uint":    uint64(math.MaxUint64),
+		"float":   1.5,
+		"float32": 2.5,
+		"string":  "text",
+		"bool":    true,
+		"nil":     nil,
+		"bytes":   []byte("hi"),
+		"array":   []interface{}{int64(1), "x", false},
+		"nested": map[string]interface{}{
+			"a": map[string]interface{}{"b": int64(-1)},
+		},
+		"empty": map[string]interface{}{},
+	}
+
+	codecs := map[string]struct {
+		marshal   func(M) ([]byte, error)
+		unmarshal func(*M, []byte) error
+	}{
+		"cbor":    {M.MarshalCBOR, (*M).UnmarshalCBOR},
+		"msgpack": {M.MarshalMsgpack, (*M).UnmarshalMsgpack},
+	}
+
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.marshal(in)
+			require.NoError(t, err)
+
+			var out M
+			require.NoError(t, codec.unmarshal(&out, data))
+			assert.Equal(t, expected, out)
+
+			assert.Error(t, codec.unmarshal(&out, data[:len(data)/2]))
+
+			data, err = codec.marshal(M{})
+			require.NoError(t, err)
+			require.NoError(t, codec.unmarshal(&out, data))
+			assert.Equal(t, M{}, out)
+		})
+	}
+
+	// JSON loses precision for large integers
+	data, err := json.Marshal(in)
+	require.NoError(t, err)
+	var viaJSON M
+	require.NoError(t, json.Unmarshal(data, &viaJSON))
+	assert.Equal(t, float64(math.MaxInt64), viaJSON["int"])
+}
@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import "reflect"
+
+// DeepUpdateOption configures the merge behavior of DeepUpdateWithOpts.
+type DeepUpdateOption func(deepUpdateOptions) deepUpdateOptions
+
+type arrayMergeMode uint8
+
+const (
+	arrayReplace arrayMergeMode = iota
+	arrayConcat
+	arrayUnion
+)
+
+type deepUpdateOptions struct {
+	noOverwrite bool
+	nilDeletes  bool
+	arrays      arrayMergeMode
+}
+
+// NoOverwrite keeps existing values instead of overwriting them. Nested maps
+// are still merged.
+func NoOverwrite(o deepUpdateOptions) deepUpdateOptions {
+	o.noOverwrite = true
+	return o
+}
+
+// NilDeletes removes keys which are set to nil in the update from the target
+// map, instead of setting them to nil.
+func NilDeletes(o deepUpdateOptions) deepUpdateOptions {
+	o.nilDeletes = true
+	return o
+}
+
+// ArrayReplace replaces existing arrays with the array from the update. This
+// is the default.
+func ArrayReplace(o deepUpdateOptions) deepUpdateOptions {
+	o.arrays = arrayReplace
+	return o
+}
+
+// ArrayConcat appends the elements of arrays in the update to the existing
+// arrays.
+func ArrayConcat(o deepUpdateOptions) deepUpdateOptions {
+	o.arrays = arrayConcat
+	return o
+}
+
+// ArrayUnion appends the elements of arrays in the update to the existing
+// arrays, skipping elements which are already present. Elements are compared
+// using reflect.DeepEqual.
+func ArrayUnion(o deepUpdateOptions) deepUpdateOptions {
+	o.arrays = arrayUnion
+	return o
+}
+
+// DeepUpdateWithOpts recursively copies the key-value pairs from d to this
+// map, like DeepUpdate. The options select how conflicting values are merged:
+//
+//   - NoOverwrite keeps existing values, like DeepUpdateNoOverwrite.
+//   - NilDeletes removes keys set to nil in d.
+//   - ArrayReplace, ArrayConcat and ArrayUnion select how arrays present in
+//     both maps are merged. Arrays are merged even if NoOverwrite is set.
+//
+// Merged arrays keep their type if both arrays have the same type, otherwise
+// a []interface{} is stored.
+func (m M) DeepUpdateWithOpts(d M, opts ...DeepUpdateOption) {
+	var o deepUpdateOptions
+	for _, opt := range opts {
+		o = opt(o)
+	}
+	m.deepUpdateMapWithOpts(d, o)
+}
+
+func (m M) deepUpdateMapWithOpts(d M, o deepUpdateOptions) {
+	for k, v := range d {
+		if v == nil && o.nilDeletes {
+			delete(m, k)
+			continue
+		}
+
+		if val, ok := tryToMapStr(v); ok {
+			m[k] = deepUpdateValueWithOpts(m[k], val, o)
+			continue
+		}
+
+		old, exists := m[k]
+		if exists && o.arrays != arrayReplace {
+			if merged, ok := mergeArrays(old, v, o.arrays); ok {
+				m[k] = merged
+				continue
+			}
+		}
+		if !exists || !o.noOverwrite {
+			m[k] = v
+		}
+	}
+}
+
+func deepUpdateValueWithOpts(old interface{}, val M, o deepUpdateOptions) interface{} {
+	if sub, ok := tryToMapStr(old); ok && sub != nil {
+		sub.deepUpdateMapWithOpts(val, o)
+		return sub
+	}
+
+	// old is no map or nil, it is replaced by val. Nil values must not be
+	// copied into the map if they are meant to delete keys.
+	if o.nilDeletes {
+		tmp := M{}
+		tmp.deepUpdateMapWithOpts(val, o)
+		return tmp
+	}
+	return val
+}
+
+// mergeArrays merges the arrays a and b. Returns false if a or b is no array.
+func mergeArrays(a, b interface{}, mode arrayMergeMode) (interface{}, bool) {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() != reflect.Slice || vb.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	var out reflect.Value
+	if va.Type() == vb.Type() {
+		out = reflect.MakeSlice(va.Type(), 0, va.Len()+vb.Len())
+	} else {
+		out = reflect.ValueOf(make([]interface{}, 0, va.Len()+vb.Len()))
+	}
+
+	appendElem := func(elem reflect.Value) {
+		if mode == arrayUnion {
+			for i := 0; i < out.Len(); i++ {
+				if reflect.DeepEqual(out.Index(i).Interface(), elem.Interface()) {
+					return
+				}
+			}
+		}
+		out = reflect.Append(out, elem)
+	}
+	for i := 0; i < va.Len(); i++ {
+		appendElem(va.Index(i))
+	}
+	for i := 0; i < vb.Len(); i++ {
+		appendElem(vb.Index(i))
+	}
+	return out.Interface(), true
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeepUpdateWithOpts(t *testing.T) {
+	tests := map[string]struct {
+		opts     []DeepUpdateOption
+		a, b     M
+		expected M
+	}{
+		"default behaves like DeepUpdate": {
+			a:        M{"a": 1, "b": M{"c": []string{"x"}, "d": 1}},
+			b:        M{"a": 2, "b": M{"c": []string{"y"}, "e": 2}},
+			expected: M{"a": 2, "b": M{"c": []string{"y"}, "d": 1, "e": 2}},
+		},
+		"no overwrite": {
+			opts:     []DeepUpdateOption{NoOverwrite},
+			a:        M{"a": 1, "b": M{"c": []string{"x"}}},
+			b:        M{"a": 2, "b": M{"c": []string{"y"}, "d": 2}},
+			expected: M{"a": 1, "b": M{"c": []string{"x"}, "d": 2}},
+		},
+		"nil sets value by default": {
+			a:        M{"a": 1},
+			b:        M{"a": nil},
+			expected: M{"a": nil},
+		},
+		"nil deletes": {
+			opts:     []DeepUpdateOption{NilDeletes},
+			a:        M{"a": 1, "b": M{"c": 1, "d": 2}, "keep": 3},
+			b:        M{"a": nil, "b": M{"c": nil}, "missing": nil, "new": M{"x": nil, "y": 1}},
+			expected: M{"b": M{"d": 2}, "keep": 3, "new": M{"y": 1}},
+		},
+		"array replace": {
+			opts:     []DeepUpdateOption{ArrayConcat, ArrayReplace},
+			a:        M{"tags": []string{"a"}},
+			b:        M{"tags": []string{"b"}},
+			expected: M{"tags": []string{"b"}},
+		},
+		"array concat": {
+			opts:     []DeepUpdateOption{ArrayConcat},
+			a:        M{"tags": []string{"a", "b"}, "sub": M{"ports": []int{80}}},
+			b:        M{"tags": []string{"b", "c"}, "sub": M{"ports": []int{443}}},
+			expected: M{"tags": []string{"a", "b", "b", "c"}, "sub": M{"ports": []int{80, 443}}},
+		},
+		"array concat mixed types": {
+			opts:     []DeepUpdateOption{ArrayConcat},
+			a:        M{"tags": []string{"a"}},
+			b:        M{"tags": []interface{}{"b", 1}},
+			expected: M{"tags": []interface{}{"a", "b", 1}},
+		},
+		"array concat with no overwrite": {
+			opts:     []DeepUpdateOption{ArrayConcat, NoOverwrite},
+			a:        M{"tags": []string{"a"}, "x": 1},
+			b:        M{"tags": []string{"b"}, "x": 2},
+			expected: M{"tags": []string{"a", "b"}, "x": 1},
+		},
+		"array union": {
+			opts:     []DeepUpdateOption{ArrayUnion},
+			a:        M{"tags": []string{"a", "b"}, "hosts": []interface{}{M{"name": "x"}}},
+			b:        M{"tags": []string{"b", "c", "c"}, "hosts": []interface{}{M{"name": "x"}, M{"name": "y"}}},
+			expected: M{"tags": []string{"a", "b", "c"}, "hosts": []interface{}{M{"name": "x"}, M{"name": "y"}}},
+		},
+		"array replaces scalar": {
+			opts:     []DeepUpdateOption{ArrayConcat},
+			a:        M{"tags": "a"},
+			b:        M{"tags": []string{"b"}},
+			expected: M{"tags": []string{"b"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.a.DeepUpdateWithOpts(test.b, test.opts...)
+			assert.Equal(t, test.expected, test.a)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var keyEscaper = strings.NewReplacer(`\`, `\\`, `.`, `\.`)
+
+// EscapeKey escapes dots and backslashes in a single key, such that it can
+// be used as a segment of a key returned by FlattenEscaped.
+func EscapeKey(key string) string {
+	if !strings.ContainsAny(key, `.\`) {
+		return key
+	}
+	return keyEscaper.Replace(key)
+}
+
+// FlattenEscaped flattens the given M like Flatten, but escapes dots and
+// backslashes in keys with a backslash, such that the result can be converted
+// back using Unflatten without loss.
+//
+// Example:
+//
+//	"host.name": "test", "host": M{"ip": "127.0.0.1"}
+//
+// This is converted to:
+//
+//	"host\.name": "test", "host.ip": "127.0.0.1"
+//
+// Empty nested maps are kept as values.
+func (m M) FlattenEscaped() M {
+	return flattenEscaped("", m, M{})
+}
+
+func flattenEscaped(prefix string, in, out M) M {
+	for k, v := range in {
+		fullKey := EscapeKey(k)
+		if prefix != "" {
+			fullKey = prefix + "." + fullKey
+		}
+
+		if m, ok := tryToMapStr(v); ok && len(m) > 0 {
+			flattenEscaped(fullKey, m, out)
+		} else {
+			out[fullKey] = v
+		}
+	}
+	return out
+}
+
+// Unflatten converts a map with keys in dot-notation into nested maps. It is
+// the inverse of FlattenEscaped: dots escaped with a backslash are part of
+// the key instead of separating nested keys.
+//
+// Returns an error wrapping ErrKeyCollision if keys conflict, e.g. `a: 1` and
+// `a.b: 2`, or an error if a key contains an invalid escape sequence. The
+// input map is not modified.
+func Unflatten(flat M) (M, error) {
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := M{}
+	for _, k := range keys {
+		segments, err := splitEscapedKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		level := out
+		for _, s := range segments[:len(segments)-1] {
+			next, exists := level[s]
+			if !exists {
+				sub := M{}
+				level[s] = sub
+				level = sub
+				continue
+			}
+			sub, ok := tryToMapStr(next)
+			if !ok {
+				return nil, fmt.Errorf("key %q conflicts with a value: %w", k, ErrKeyCollision)
+			}
+			level = sub
+		}
+
+		last := segments[len(segments)-1]
+		if _, exists := level[last]; exists {
+			return nil, fmt.Errorf("key %q is defined multiple times: %w", k, ErrKeyCollision)
+		}
+		v := flat[k]
+		if m, ok := tryToMapStr(v); ok {
+			// copy maps, so keys nested into them don't modify the input
+			v = m.Clone()
+		}
+		level[last] = v
+	}
+	return out, nil
+}
+
+// splitEscapedKey splits a key on unescaped dots and removes the escaping.
+func splitEscapedKey(key string) ([]string, error) {
+	if !strings.Contains(key, `\`) {
+		return strings.Split(key, "."), nil
+	}
+
+	var segments []string
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '\\':
+			i++
+			if i == len(key) || (key[i] != '.' && key[i] != '\\') {
+				return nil, errors.New("invalid escape sequence in key " + key)
+			}
+			b.WriteByte(key[i])
+		case '.':
+			segments = append(segments, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(segments, b.String()), nil
+}
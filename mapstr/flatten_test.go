@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlattenEscaped(t *testing.T) {
+	m := M{
+		"host.name": "literal",
+		"host": M{
+			"name": "nested",
+			"ip":   "127.0.0.1",
+		},
+		`back\slash`: M{"a.b": 1},
+		"empty":      M{},
+		"tags":       []string{"a"},
+	}
+
+	flat := m.FlattenEscaped()
+	assert.Equal(t, M{
+		`host\.name`:       "literal",
+		"host.name":        "nested",
+		"host.ip":          "127.0.0.1",
+		`back\\slash.a\.b`: 1,
+		"empty":            M{},
+		"tags":             []string{"a"},
+	}, flat)
+
+	unflat, err := Unflatten(flat)
+	require.NoError(t, err)
+	assert.Equal(t, m, unflat)
+}
+
+func TestUnflatten(t *testing.T) {
+	tests := map[string]struct {
+		flat     M
+		expected M
+		err      bool
+	}{
+		"nested": {
+			flat:     M{"a.b.c": 1, "a.d": 2, "e": 3},
+			expected: M{"a": M{"b": M{"c": 1}, "d": 2}, "e": 3},
+		},
+		"merges map values": {
+			flat:     M{"a": M{"x": 1}, "a.y": 2},
+			expected: M{"a": M{"x": 1, "y": 2}},
+		},
+		"escaped": {
+			flat:     M{`a\.b.c`: 1},
+			expected: M{"a.b": M{"c": 1}},
+		},
+		"value conflict": {
+			flat: M{"a": 1, "a.b": 2},
+			err:  true,
+		},
+		"duplicate key": {
+			flat: M{"a": M{"b": 1}, "a.b": 2},
+			err:  true,
+		},
+		"invalid escape": {
+			flat: M{`a\b`: 1},
+			err:  true,
+		},
+		"trailing backslash": {
+			flat: M{`a\`: 1},
+			err:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			in := test.flat.Clone()
+			out, err := Unflatten(test.flat)
+			assert.Equal(t, in, test.flat, "input must not be modified")
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	_, err := Unflatten(M{"a": 1, "a.b": 2})
+	assert.ErrorIs(t, err, ErrKeyCollision)
+}
+
+func TestEscapeKey(t *testing.T) {
+	assert.Equal(t, "host", EscapeKey("host"))
+	assert.Equal(t, `host\.name`, EscapeKey("host.name"))
+	assert.Equal(t, `a\\b\.c`, EscapeKey(`a\b.c`))
+}
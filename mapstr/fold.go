@@ -0,0 +1,142 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GetValueFold gets a value from the map, matching every segment of the
+// dotted key case-insensitively. Returns ErrKeyNotFound if the key does not
+// exist, or ErrKeyCollision if multiple keys match. See FindFold.
+func (m M) GetValueFold(key string) (interface{}, error) {
+	_, v, err := m.FindFold(key)
+	return v, err
+}
+
+// HasKeyFold returns true if the key exists, matching every segment of the
+// dotted key case-insensitively. Returns ErrKeyCollision if multiple keys
+// match.
+func (m M) HasKeyFold(key string) (bool, error) {
+	_, _, err := m.FindFold(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// PutFold associates the value with the key like Put, but matches existing
+// keys case-insensitively, such that the case of existing keys is kept.
+// Missing keys are created with the case used in key. The old value is
+// returned. Returns ErrKeyCollision if multiple keys match a segment.
+func (m M) PutFold(key string, value interface{}) (interface{}, error) {
+	level := m
+	segments := strings.Split(key, ".")
+	for i, segment := range segments {
+		k, found, err := findKeyFold(level, segment)
+		if err != nil {
+			return nil, fmt.Errorf("could not put value for key: %s: %w", key, err)
+		}
+
+		if i == len(segments)-1 {
+			old := level[k]
+			level[k] = value
+			return old, nil
+		}
+
+		if !found {
+			sub := M{}
+			level[k] = sub
+			level = sub
+			continue
+		}
+		sub, err := toMapStr(level[k])
+		if err != nil {
+			return nil, fmt.Errorf("could not put value for key: %s: %w", key, ErrNotMapType)
+		}
+		level = sub
+	}
+	return nil, nil
+}
+
+// DeleteFold deletes the key, matching every segment of the dotted key
+// case-insensitively. Returns ErrKeyNotFound if the key does not exist, or
+// ErrKeyCollision if multiple keys match.
+func (m M) DeleteFold(key string) error {
+	segmentCount := strings.Count(key, ".") + 1
+	return m.Traverse(key, CaseInsensitiveMode, func(level M, k string) error {
+		segmentCount--
+		if segmentCount == 0 {
+			delete(level, k)
+		}
+		return nil
+	})
+}
+
+// FlattenLower flattens the map like Flatten, converting all keys to lower
+// case. Returns ErrKeyCollision if keys only differing in case would be
+// merged, e.g. `Host.Name` and `host.name`.
+func (m M) FlattenLower() (M, error) {
+	out := M{}
+	if err := flattenLower("", m, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func flattenLower(prefix string, in, out M) error {
+	for k, v := range in {
+		fullKey := strings.ToLower(k)
+		if prefix != "" {
+			fullKey = prefix + "." + fullKey
+		}
+
+		if m, ok := tryToMapStr(v); ok {
+			if err := flattenLower(fullKey, m, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, exists := out[fullKey]; exists {
+			return fmt.Errorf("key %q is defined multiple times with different case: %w", fullKey, ErrKeyCollision)
+		}
+		out[fullKey] = v
+	}
+	return nil
+}
+
+// findKeyFold returns the key in m matching the given key case-insensitively.
+// If no key matches, the given key is returned.
+func findKeyFold(m M, key string) (string, bool, error) {
+	// All keys are compared even if key is present as is, keys differing
+	// from it in case only are collisions.
+	_, found := m[key]
+	matched := key
+	for k := range m {
+		if k == key || !strings.EqualFold(k, key) {
+			continue
+		}
+		if found {
+			return "", false, ErrKeyCollision
+		}
+		matched, found = k, true
+	}
+	return matched, found, nil
+}
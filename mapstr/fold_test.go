@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldHelpers(t *testing.T) {
+	newM := func() M {
+		return M{
+			"Event": M{
+				"EventData": M{"TargetUserName": "admin"},
+				"System":    map[string]interface{}{"EventID": 4624},
+			},
+			"dup": M{"a": 1, "A": 2},
+		}
+	}
+
+	t.Run("GetValueFold", func(t *testing.T) {
+		m := newM()
+		v, err := m.GetValueFold("event.eventdata.targetusername")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", v)
+
+		v, err = m.GetValueFold("EVENT.system.eventid")
+		require.NoError(t, err)
+		assert.Equal(t, 4624, v)
+
+		_, err = m.GetValueFold("event.missing")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+
+		_, err = m.GetValueFold("dup.a")
+		assert.ErrorIs(t, err, ErrKeyCollision)
+	})
+
+	t.Run("HasKeyFold", func(t *testing.T) {
+		m := newM()
+		found, err := m.HasKeyFold("event.system")
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		found, err = m.HasKeyFold("event.other")
+		require.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("PutFold", func(t *testing.T) {
+		m := newM()
+		old, err := m.PutFold("event.eventdata.targetusername", "guest")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", old)
+
+		old, err = m.PutFold("event.system.New.Key", 1)
+		require.NoError(t, err)
+		assert.Nil(t, old)
+
+		assert.Equal(t, M{
+			"EventData": M{"TargetUserName": "guest"},
+			"System":    map[string]interface{}{"EventID": 4624, "New": M{"Key": 1}},
+		}, m["Event"])
+
+		_, err = m.PutFold("dup.a", 3)
+		assert.ErrorIs(t, err, ErrKeyCollision)
+
+		_, err = m.PutFold("event.eventdata.targetusername.x", 3)
+		assert.ErrorIs(t, err, ErrNotMapType)
+	})
+
+	t.Run("DeleteFold", func(t *testing.T) {
+		m := newM()
+		require.NoError(t, m.DeleteFold("event.EVENTDATA"))
+		assert.Equal(t, M{"System": map[string]interface{}{"EventID": 4624}}, m["Event"])
+		assert.ErrorIs(t, m.DeleteFold("event.eventdata"), ErrKeyNotFound)
+	})
+
+	t.Run("FlattenLower", func(t *testing.T) {
+		m := newM()
+		delete(m, "dup")
+		flat, err := m.FlattenLower()
+		require.NoError(t, err)
+		assert.Equal(t, M{
+			"event.eventdata.targetusername": "admin",
+			"event.system.eventid":           4624,
+		}, flat)
+
+		_, err = newM().FlattenLower()
+		assert.ErrorIs(t, err, ErrKeyCollision)
+	})
+}
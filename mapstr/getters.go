@@ -0,0 +1,245 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTypeMismatch indicates that a value can not be converted to the
+// requested type. Errors returned by the typed getters wrap it in a
+// *TypeError.
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// TypeError is returned by the typed getters like GetString if the value
+// stored under a key can not be converted to the requested type.
+type TypeError struct {
+	Key      string
+	Value    interface{}
+	Expected string
+
+	// Err is the error returned by the conversion, if any.
+	Err error
+}
+
+func (e *TypeError) Error() string {
+	msg := fmt.Sprintf("value of key '%v' of type %T can not be converted to %v", e.Key, e.Value, e.Expected)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns ErrTypeMismatch and the error returned by the conversion.
+func (e *TypeError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrTypeMismatch}
+	}
+	return []error{ErrTypeMismatch, e.Err}
+}
+
+// GetString returns the value of the given key as string. Byte slices,
+// booleans and numbers are converted to their string representation.
+// Returns ErrKeyNotFound if the key does not exist, or a *TypeError if the
+// value can not be converted.
+func (m M) GetString(key string) (string, error) {
+	v, err := m.GetValue(key)
+	if err != nil {
+		return "", err
+	}
+	if _, isMap := tryToMapStr(v); isMap {
+		return "", &TypeError{Key: key, Value: v, Expected: "string"}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	if i, ok := toInt64(v); ok {
+		return strconv.FormatInt(i, 10), nil
+	}
+	switch v := v.(type) {
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return "", &TypeError{Key: key, Value: v, Expected: "string"}
+}
+
+// GetInt64 returns the value of the given key as int64. Strings are parsed as
+// base 10 integers, floating point numbers are converted if they have no
+// fractional part. Returns ErrKeyNotFound if the key does not exist, or a
+// *TypeError if the value can not be converted without loss.
+func (m M) GetInt64(key string) (int64, error) {
+	v, err := m.GetValue(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if i, ok := toInt64(v); ok {
+		return i, nil
+	}
+
+	var convErr error
+	switch val := v.(type) {
+	case uint64:
+		if val <= math.MaxInt64 {
+			return int64(val), nil
+		}
+		convErr = errors.New("value out of range")
+	case float32:
+		if i, ok := floatToInt64(float64(val)); ok {
+			return i, nil
+		}
+	case float64:
+		if i, ok := floatToInt64(val); ok {
+			return i, nil
+		}
+	case json.Number:
+		var i int64
+		if i, convErr = val.Int64(); convErr == nil {
+			return i, nil
+		}
+	case string:
+		var i int64
+		if i, convErr = strconv.ParseInt(strings.TrimSpace(val), 10, 64); convErr == nil {
+			return i, nil
+		}
+	}
+	return 0, &TypeError{Key: key, Value: v, Expected: "int64", Err: convErr}
+}
+
+// GetBool returns the value of the given key as bool. Strings are parsed
+// using strconv.ParseBool. Returns ErrKeyNotFound if the key does not exist,
+// or a *TypeError if the value can not be converted.
+func (m M) GetBool(key string) (bool, error) {
+	v, err := m.GetValue(key)
+	if err != nil {
+		return false, err
+	}
+
+	var convErr error
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case string:
+		var b bool
+		if b, convErr = strconv.ParseBool(strings.TrimSpace(val)); convErr == nil {
+			return b, nil
+		}
+	}
+	return false, &TypeError{Key: key, Value: v, Expected: "bool", Err: convErr}
+}
+
+// GetTime returns the value of the given key as time.Time. Strings are parsed
+// as RFC 3339 timestamps and numbers, including strings containing a number,
+// are interpreted as seconds since the Unix epoch. Returns ErrKeyNotFound if
+// the key does not exist, or a *TypeError if the value can not be converted.
+func (m M) GetTime(key string) (time.Time, error) {
+	v, err := m.GetValue(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var convErr error
+	switch val := v.(type) {
+	case time.Time:
+		return val, nil
+	case *time.Time:
+		if val != nil {
+			return *val, nil
+		}
+	case string:
+		val = strings.TrimSpace(val)
+		var t time.Time
+		if t, convErr = time.Parse(time.RFC3339Nano, val); convErr == nil {
+			return t, nil
+		}
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return epochToTime(f), nil
+		}
+	case json.Number:
+		var f float64
+		if f, convErr = val.Float64(); convErr == nil {
+			return epochToTime(f), nil
+		}
+	case float32:
+		return epochToTime(float64(val)), nil
+	case float64:
+		return epochToTime(val), nil
+	case uint64:
+		return time.Unix(int64(val), 0).UTC(), nil
+	default:
+		if i, ok := toInt64(v); ok {
+			return time.Unix(i, 0).UTC(), nil
+		}
+	}
+	return time.Time{}, &TypeError{Key: key, Value: v, Expected: "time.Time", Err: convErr}
+}
+
+// toInt64 converts all integer types, which always fit into an int64.
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func floatToInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func epochToTime(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedGetters(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 500000000, time.UTC)
+	m := M{
+		"str":     "text",
+		"num_str": " 42 ",
+		"bytes":   []byte("raw"),
+		"int":     42,
+		"int8":    int8(-3),
+		"uint64":  uint64(math.MaxUint64),
+		"float":   42.0,
+		"frac":    1.5,
+		"number":  json.Number("7"),
+		"bool":    true,
+		"bool_s":  "false",
+		"time":    ts,
+		"time_s":  "2024-05-01T12:30:00.5Z",
+		"epoch":   int64(1714566600),
+		"epoch_f": 1714566600.5,
+		"epoch_s": "1714566600",
+		"map":     M{"nested": "value"},
+	}
+
+	t.Run("string", func(t *testing.T) {
+		for key, expected := range map[string]string{
+			"str":        "text",
+			"bytes":      "raw",
+			"int":        "42",
+			"uint64":     strconv.FormatUint(math.MaxUint64, 10),
+			"frac":       "1.5",
+			"number":     "7",
+			"bool":       "true",
+			"map.nested": "value",
+		} {
+			s, err := m.GetString(key)
+			require.NoError(t, err, key)
+			assert.Equal(t, expected, s, key)
+		}
+	})
+
+	t.Run("int64", func(t *testing.T) {
+		for key, expected := range map[string]int64{
+			"int":     42,
+			"int8":    -3,
+			"float":   42,
+			"number":  7,
+			"num_str": 42,
+		} {
+			i, err := m.GetInt64(key)
+			require.NoError(t, err, key)
+			assert.Equal(t, expected, i, key)
+		}
+		for _, key := range []string{"str", "frac", "uint64", "bool", "map"} {
+			_, err := m.GetInt64(key)
+			assert.ErrorIs(t, err, ErrTypeMismatch, key)
+		}
+
+		_, err := m.GetInt64("str")
+		assert.ErrorIs(t, err, strconv.ErrSyntax)
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		b, err := m.GetBool("bool")
+		require.NoError(t, err)
+		assert.True(t, b)
+
+		b, err = m.GetBool("bool_s")
+		require.NoError(t, err)
+		assert.False(t, b)
+
+		_, err = m.GetBool("int")
+		assert.ErrorIs(t, err, ErrTypeMismatch)
+	})
+
+	t.Run("time", func(t *testing.T) {
+		for key, expected := range map[string]time.Time{
+			"time":    ts,
+			"time_s":  ts,
+			"epoch":   ts.Truncate(time.Second),
+			"epoch_f": ts,
+			"epoch_s": ts.Truncate(time.Second),
+		} {
+			v, err := m.GetTime(key)
+			require.NoError(t, err, key)
+			assert.True(t, expected.Equal(v), "%v: expected %v, got %v", key, expected, v)
+		}
+
+		_, err := m.GetTime("str")
+		assert.ErrorIs(t, err, ErrTypeMismatch)
+	})
+
+	t.Run("map is no string", func(t *testing.T) {
+		_, err := m.GetString("map")
+		assert.ErrorIs(t, err, ErrTypeMismatch)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := m.GetString("missing")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		_, err = m.GetInt64("map.missing")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		_, err = m.GetBool("missing")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		_, err = m.GetTime("missing")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("type error", func(t *testing.T) {
+		_, err := m.GetBool("map")
+		var typeErr *TypeError
+		require.True(t, errors.As(err, &typeErr))
+		assert.Equal(t, "map", typeErr.Key)
+		assert.Equal(t, "bool", typeErr.Expected)
+		assert.Equal(t, "value of key 'map' of type mapstr.M can not be converted to bool", err.Error())
+	})
+}
@@ -0,0 +1,546 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxJSONDepth limits the nesting of parsed documents, like encoding/json.
+const maxJSONDepth = 10000
+
+const (
+	// internMaxKeyLen and internMaxKeys bound the memory used to intern keys.
+	internMaxKeyLen = 64
+	internMaxKeys   = 4096
+)
+
+// NumberMode selects the type JSON numbers are decoded into.
+type NumberMode uint8
+
+const (
+	// NumberFloat64 decodes all numbers into float64, like encoding/json.
+	NumberFloat64 NumberMode = iota
+	// NumberJSON decodes all numbers into json.Number, keeping their
+	// original representation.
+	NumberJSON
+	// NumberInt64 decodes integers into int64, or uint64 if they exceed the
+	// int64 range, and all other numbers into float64.
+	NumberInt64
+)
+
+// DecodeOption configures ParseJSON and Decoder.
+type DecodeOption func(decodeOptions) decodeOptions
+
+type decodeOptions struct {
+	numbers    NumberMode
+	internKeys bool
+}
+
+// WithNumberMode selects the type numbers are decoded into. The default is
+// NumberFloat64.
+func WithNumberMode(mode NumberMode) DecodeOption {
+	return func(o decodeOptions) decodeOptions {
+		o.numbers = mode
+		return o
+	}
+}
+
+// InternKeys makes the decoder reuse the strings of keys it has decoded
+// before, such that documents with the same structure share the memory of
+// their keys.
+func InternKeys(o decodeOptions) decodeOptions {
+	o.internKeys = true
+	return o
+}
+
+// ParseJSON parses a JSON object directly into an M. Nested objects are
+// decoded into M as well, arrays into []interface{}.
+func ParseJSON(data []byte, opts ...DecodeOption) (M, error) {
+	p := newJSONParser(opts)
+	return p.parseDocument(data)
+}
+
+// Decoder reads a stream of JSON objects, e.g. newline delimited JSON, and
+// decodes them into M. See ParseJSON.
+type Decoder struct {
+	parser *jsonParser
+}
+
+// NewDecoder creates a Decoder reading from r. The objects are parsed while
+// reading, the Decoder may read data beyond the last object decoded.
+func NewDecoder(r io.Reader, opts ...DecodeOption) *Decoder {
+	p := newJSONParser(opts)
+	p.r = r
+	return &Decoder{parser: p}
+}
+
+// Decode reads the next JSON object from the stream. Returns io.EOF if the
+// end of the stream has been reached.
+func (d *Decoder) Decode() (M, error) {
+	return d.parser.parseNext()
+}
+
+// jsonReadSize is the minimum size of the reads of a Decoder.
+const jsonReadSize = 4096
+
+type jsonParser struct {
+	opts  decodeOptions
+	keys  map[string]string
+	data  []byte
+	pos   int
+	depth int
+	buf   []byte
+
+	// r is the stream read by a Decoder, data buffers the unparsed part of
+	// it. offset is the position of data in the stream, and readErr the
+	// error returned by the last read.
+	r       io.Reader
+	offset  int64
+	readErr error
+}
+
+func newJSONParser(opts []DecodeOption) *jsonParser {
+	p := &jsonParser{}
+	for _, opt := range opts {
+		p.opts = opt(p.opts)
+	}
+	if p.opts.internKeys {
+		p.keys = map[string]string{}
+	}
+	return p
+}
+
+func (p *jsonParser) parseDocument(data []byte) (M, error) {
+	p.data, p.pos, p.depth = data, 0, 0
+	defer func() { p.data = nil }()
+
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != '{' {
+		return nil, p.errorf("expected JSON object")
+	}
+	m, err := p.parseObject()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected data after JSON object")
+	}
+	return m, nil
+}
+
+// parseNext parses the next object of the stream, discarding the data of the
+// objects parsed before.
+func (p *jsonParser) parseNext() (M, error) {
+	p.offset += int64(p.pos)
+	p.data = p.data[:copy(p.data, p.data[p.pos:])]
+	p.pos, p.depth = 0, 0
+
+	p.skipSpace()
+	if !p.avail(1) {
+		if p.readErr == nil {
+			return nil, io.EOF
+		}
+		return nil, p.readErr
+	}
+	if p.data[p.pos] != '{' {
+		return nil, p.errorf("expected JSON object")
+	}
+	return p.parseObject()
+}
+
+// avail reports whether n bytes are available at the current position,
+// reading from the stream if required.
+func (p *jsonParser) avail(n int) bool {
+	return p.pos+n <= len(p.data) || p.fill(n)
+}
+
+// fill reads from the stream until n bytes are available at the current
+// position.
+func (p *jsonParser) fill(n int) bool {
+	for p.pos+n > len(p.data) {
+		if !p.read() {
+			return false
+		}
+	}
+	return true
+}
+
+// read appends the next chunk of the stream to data. Returns false if the
+// stream has no data left.
+func (p *jsonParser) read() bool {
+	if p.r == nil || p.readErr != nil {
+		return false
+	}
+	if cap(p.data)-len(p.data) < jsonReadSize {
+		p.data = append(p.data, make([]byte, jsonReadSize)...)[:len(p.data)]
+	}
+	for {
+		n, err := p.r.Read(p.data[len(p.data):cap(p.data)])
+		p.data = p.data[:len(p.data)+n]
+		if err != nil {
+			p.readErr = err
+			return n > 0
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// errorf returns a syntax error at the current position. Errors caused by
+// failed reads of the stream are returned as is, or as io.ErrUnexpectedEOF
+// if the stream ended within an object.
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	if p.readErr != nil && p.readErr != io.EOF {
+		return p.readErr
+	}
+	if p.readErr == io.EOF && p.pos >= len(p.data) {
+		return io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("invalid JSON at offset %d: %s", p.offset+int64(p.pos), fmt.Sprintf(format, args...))
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.avail(1) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	if !p.avail(1) {
+		return nil, p.errorf("unexpected end of input")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject()
+	case c == '[':
+		return p.parseArray()
+	case c == '"':
+		return p.parseString(false)
+	case c == 't':
+		return true, p.parseLiteral("true")
+	case c == 'f':
+		return false, p.parseLiteral("false")
+	case c == 'n':
+		return nil, p.parseLiteral("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	default:
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func (p *jsonParser) parseLiteral(lit string) error {
+	if !p.avail(len(lit)) {
+		if strings.HasPrefix(lit, string(p.data[p.pos:])) {
+			// truncated literal
+			p.pos = len(p.data)
+		}
+		return p.errorf("invalid literal, expected %v", lit)
+	}
+	if !bytes.HasPrefix(p.data[p.pos:], []byte(lit)) {
+		return p.errorf("invalid literal, expected %v", lit)
+	}
+	p.pos += len(lit)
+	return nil
+}
+
+func (p *jsonParser) enter() error {
+	p.depth++
+	if p.depth > maxJSONDepth {
+		return p.errorf("exceeded max depth")
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonParser) parseObject() (M, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	m := M{}
+	p.skipSpace()
+	if p.avail(1) && p.data[p.pos] == '}' {
+		p.pos++
+		return m, nil
+	}
+
+	for {
+		p.skipSpace()
+		if !p.avail(1) || p.data[p.pos] != '"' {
+			return nil, p.errorf("expected object key")
+		}
+		key, err := p.parseString(true)
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if !p.avail(1) || p.data[p.pos] != ':' {
+			return nil, p.errorf("expected ':' after object key")
+		}
+		p.pos++
+
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+
+		p.skipSpace()
+		if !p.avail(1) {
+			return nil, p.errorf("unexpected end of input")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return m, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' after object value")
+		}
+	}
+}
+
+func (p *jsonParser) parseArray() ([]interface{}, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	arr := []interface{}{}
+	p.skipSpace()
+	if p.avail(1) && p.data[p.pos] == ']' {
+		p.pos++
+		return arr, nil
+	}
+
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+
+		p.skipSpace()
+		if !p.avail(1) {
+			return nil, p.errorf("unexpected end of input")
+		}
+		switch p.data[p.pos] {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return arr, nil
+		default:
+			return nil, p.errorf("expected ',' or ']' after array element")
+		}
+	}
+}
+
+// parseString parses a string starting at the opening quote. Invalid UTF-8
+// is replaced with the Unicode replacement character, like encoding/json.
+func (p *jsonParser) parseString(isKey bool) (string, error) {
+	p.pos++
+	start := p.pos
+
+	// fast path for strings without escapes
+	for p.avail(1) {
+		c := p.data[p.pos]
+		if c == '"' {
+			raw := p.data[start:p.pos]
+			p.pos++
+			if isKey && p.keys != nil {
+				return p.intern(raw), nil
+			}
+			if !utf8.Valid(raw) {
+				return strings.ToValidUTF8(string(raw), "�"), nil
+			}
+			return string(raw), nil
+		}
+		if c == '\\' || c < 0x20 {
+			break
+		}
+		p.pos++
+	}
+
+	p.buf = append(p.buf[:0], p.data[start:p.pos]...)
+	for p.avail(1) {
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			if isKey && p.keys != nil {
+				return p.intern(p.buf), nil
+			}
+			return strings.ToValidUTF8(string(p.buf), "�"), nil
+		case c < 0x20:
+			return "", p.errorf("invalid control character in string")
+		case c != '\\':
+			p.buf = append(p.buf, c)
+			p.pos++
+			continue
+		}
+
+		if !p.avail(2) {
+			break
+		}
+		p.pos++
+		switch esc := p.data[p.pos]; esc {
+		case '"', '\\', '/':
+			p.buf = append(p.buf, esc)
+		case 'b':
+			p.buf = append(p.buf, '\b')
+		case 'f':
+			p.buf = append(p.buf, '\f')
+		case 'n':
+			p.buf = append(p.buf, '\n')
+		case 'r':
+			p.buf = append(p.buf, '\r')
+		case 't':
+			p.buf = append(p.buf, '\t')
+		case 'u':
+			r, ok := p.parseHex4(p.pos + 1)
+			if !ok {
+				return "", p.errorf("invalid unicode escape")
+			}
+			p.pos += 4
+			if utf16.IsSurrogate(r) {
+				r2, ok := rune(0), false
+				if p.avail(3) && p.data[p.pos+1] == '\\' && p.data[p.pos+2] == 'u' {
+					r2, ok = p.parseHex4(p.pos + 3)
+				}
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					r = dec
+					p.pos += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			p.buf = utf8.AppendRune(p.buf, r)
+		default:
+			return "", p.errorf("invalid escape character %q", esc)
+		}
+		p.pos++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *jsonParser) parseHex4(at int) (rune, bool) {
+	if !p.avail(at + 4 - p.pos) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(p.data[at:at+4]), 16, 32)
+	return rune(v), err == nil
+}
+
+// intern returns the interned key, adding it if the cache is not full.
+func (p *jsonParser) intern(raw []byte) string {
+	if k, ok := p.keys[string(raw)]; ok {
+		return k
+	}
+	k := strings.ToValidUTF8(string(raw), "�")
+	if len(raw) <= internMaxKeyLen && len(p.keys) < internMaxKeys {
+		p.keys[k] = k
+	}
+	return k
+}
+
+func (p *jsonParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	isInt := true
+
+	if p.data[p.pos] == '-' {
+		p.pos++
+	}
+	switch {
+	case p.avail(1) && p.data[p.pos] == '0':
+		p.pos++
+	case p.avail(1) && p.data[p.pos] >= '1' && p.data[p.pos] <= '9':
+		p.skipDigits()
+	default:
+		return nil, p.errorf("invalid number")
+	}
+	if p.avail(1) && p.data[p.pos] == '.' {
+		isInt = false
+		p.pos++
+		if !p.skipDigits() {
+			return nil, p.errorf("invalid number")
+		}
+	}
+	if p.avail(1) && (p.data[p.pos] == 'e' || p.data[p.pos] == 'E') {
+		isInt = false
+		p.pos++
+		if p.avail(1) && (p.data[p.pos] == '+' || p.data[p.pos] == '-') {
+			p.pos++
+		}
+		if !p.skipDigits() {
+			return nil, p.errorf("invalid number")
+		}
+	}
+
+	s := string(p.data[start:p.pos])
+	switch p.opts.numbers {
+	case NumberJSON:
+		return json.Number(s), nil
+	case NumberInt64:
+		if isInt {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return u, nil
+			}
+		}
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, p.errorf("number %v out of range", s)
+	}
+	return f, nil
+}
+
+// skipDigits advances past a sequence of digits. Returns false if there are
+// none.
+func (p *jsonParser) skipDigits() bool {
+	start := p.pos
+	for p.avail(1) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		p.pos++
+	}
+	return p.pos > start
+}
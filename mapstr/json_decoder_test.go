@@ -0,0 +1,338 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSON(t *testing.T) {
+	input := `{
+		"message": "hello\n\"world\" \u00e9\ud83d\ude00",
+		"count": 42,
+		"ratio": 0.5,
+		"ok": true,
+		"missing": null,
+		"host": {"name": "test", "ip": ["10.0.0.1", "::1"], "empty": {}},
+		"list": [1, [], {"a": false}]
+	}`
+
+	m, err := ParseJSON([]byte(input))
+	require.NoError(t, err)
+	assert.Equal(t, M{
+		"message": "hello\n\"world\" é😀",
+		"count":   float64(42),
+		"ratio":   0.5,
+		"ok":      true,
+		"missing": nil,
+		"host": M{
+			"name":  "test",
+			"ip":    []interface{}{"10.0.0.1", "::1"},
+			"empty": M{},
+		},
+		"list": []interface{}{float64(1), []interface{}{}, M{"a": false}},
+	}, m)
+
+	// must decode the same values as encoding/json
+	var expected map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(input), &expected))
+	actual, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.JSONEq(t, input, string(actual))
+	assert.Equal(t, expected["message"], m["message"])
+}
+
+func TestParseJSONNumberModes(t *testing.T) {
+	input := []byte(`{"int": 42, "neg": -7, "big": 18446744073709551615, "huge": 1e400, "float": 1.5, "exp": 1e3, "overflow": 99999999999999999999}`)
+
+	t.Run("float64", func(t *testing.T) {
+		_, err := ParseJSON(input)
+		assert.ErrorContains(t, err, "out of range")
+
+		m, err := ParseJSON([]byte(`{"int": 42, "float": 1.5, "exp": 1e3}`))
+		require.NoError(t, err)
+		assert.Equal(t, M{"int": float64(42), "float": 1.5, "exp": float64(1000)}, m)
+	})
+
+	t.Run("json.Number", func(t *testing.T) {
+		m, err := ParseJSON(input, WithNumberMode(NumberJSON))
+		require.NoError(t, err)
+		assert.Equal(t, M{
+			"int":      json.Number("42"),
+			"neg":      json.Number("-7"),
+			"big":      json.Number("18446744073709551615"),
+			"huge":     json.Number("1e400"),
+			"float":    json.Number("1.5"),
+			"exp":      json.Number("1e3"),
+			"overflow": json.Number("99999999999999999999"),
+		}, m)
+	})
+
+	t.Run("int64", func(t *testing.T) {
+		input := []byte(`{"int": 42, "neg": -7, "max": 9223372036854775807, "big": 18446744073709551615, "float": 1.5, "exp": 1e3, "overflow": 99999999999999999999}`)
+		m, err := ParseJSON(input, WithNumberMode(NumberInt64))
+		require.NoError(t, err)
+		assert.Equal(t, M{
+			"int":      int64(42),
+			"neg":      int64(-7),
+			"max":      int64(math.MaxInt64),
+			"big":      uint64(math.MaxUint64),
+			"float":    1.5,
+			"exp":      float64(1000),
+			"overflow": 1e20,
+		}, m)
+	})
+}
+
+func TestParseJSONInvalid(t *testing.T) {
+	cases := map[string]string{
+		"empty":               ``,
+		"not an object":       `[1, 2]`,
+		"trailing data":       `{} {}`,
+		"trailing comma":      `{"a": 1,}`,
+		"missing colon":       `{"a" 1}`,
+		"unquoted key":        `{a: 1}`,
+		"unterminated":        `{"a": "b`,
+		"unterminated object": `{"a": 1`,
+		"unterminated array":  `{"a": [1`,
+		"bad literal":         `{"a": tru}`,
+		"bad number":          `{"a": 01}`,
+		"bad fraction":        `{"a": 1.}`,
+		"bad exponent":        `{"a": 1e}`,
+		"bad escape":          `{"a": "\x"}`,
+		"bad unicode":         `{"a": "\u12"}`,
+		"control character":   "{\"a\": \"\x01\"}",
+		"too deep":            `{"a":` + strings.Repeat("[", maxJSONDepth) + strings.Repeat("]", maxJSONDepth) + `}`,
+	}
+
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseJSON([]byte(input))
+			assert.Error(t, err)
+
+			var v map[string]interface{}
+			assert.Error(t, json.Unmarshal([]byte(input), &v), "encoding/json accepts the input")
+		})
+	}
+}
+
+func TestParseJSONInvalidUTF8(t *testing.T) {
+	input := []byte("{\"a\xff\": \"b\xffc\", \"d\": \"\\ud800\"}")
+
+	var expected map[string]interface{}
+	require.NoError(t, json.Unmarshal(input, &expected))
+
+	m, err := ParseJSON(input)
+	require.NoError(t, err)
+	assert.Equal(t, M(expected), m)
+
+	m, err = ParseJSON(input, InternKeys)
+	require.NoError(t, err)
+	assert.Equal(t, M(expected), m)
+}
+
+func TestParseJSONInternKeys(t *testing.T) {
+	p := newJSONParser([]DecodeOption{InternKeys})
+
+	m1, err := p.parseDocument([]byte(`{"message": "a", "host": {"name": "x"}}`))
+	require.NoError(t, err)
+	m2, err := p.parseDocument([]byte(`{"host": {"name": "y"}, "message": "b"}`))
+	require.NoError(t, err)
+
+	keyOf := func(m M, name string) string {
+		for k := range m {
+			if k == name {
+				return k
+			}
+		}
+		t.Fatalf("missing key %v", name)
+		return ""
+	}
+	assert.Equal(t, unsafe.StringData(keyOf(m1, "message")), unsafe.StringData(keyOf(m2, "message")))
+	assert.Equal(t, unsafe.StringData(keyOf(m1["host"].(M), "name")), unsafe.StringData(keyOf(m2["host"].(M), "name")))
+}
+
+func TestDecoder(t *testing.T) {
+	input := `{"a": 1}
+{"b": {"c": [true]}}
+
+  {"d": "e"}`
+
+	dec := NewDecoder(strings.NewReader(input), WithNumberMode(NumberInt64), InternKeys)
+
+	var docs []M
+	for {
+		m, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		docs = append(docs, m)
+	}
+
+	assert.Equal(t, []M{
+		{"a": int64(1)},
+		{"b": M{"c": []interface{}{true}}},
+		{"d": "e"},
+	}, docs)
+
+	_, err := NewDecoder(strings.NewReader(`[1]`)).Decode()
+	assert.Error(t, err)
+}
+
+func TestDecoderSmallReads(t *testing.T) {
+	input := `{"a": "b\u00e9\ud83d\ude00", "c": [1.5e3, -0, null, false], "d": {}}` + "\n" + `{"e": 12345678901234567890}`
+
+	var expected []M
+	for _, line := range strings.Split(input, "\n") {
+		m, err := ParseJSON([]byte(line), WithNumberMode(NumberInt64))
+		require.NoError(t, err)
+		expected = append(expected, m)
+	}
+
+	dec := NewDecoder(iotest.OneByteReader(strings.NewReader(input)), WithNumberMode(NumberInt64))
+	for _, m := range expected {
+		actual, err := dec.Decode()
+		require.NoError(t, err)
+		assert.Equal(t, m, actual)
+	}
+	_, err := dec.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	cases := map[string]string{
+		"not an object":     `[1, 2]`,
+		"trailing comma":    `{"a": 1,}`,
+		"bad number":        `{"a": 01}`,
+		"bad unicode":       `{"a": "\u12"}`,
+		"control character": "{\"a\": \"\x01\"}",
+	}
+	for name, input := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewDecoder(iotest.OneByteReader(strings.NewReader(input))).Decode()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid JSON at offset")
+		})
+	}
+
+	t.Run("offset in stream", func(t *testing.T) {
+		dec := NewDecoder(strings.NewReader(`{"a": 1} {"b": x}`))
+		_, err := dec.Decode()
+		require.NoError(t, err)
+		_, err = dec.Decode()
+		assert.ErrorContains(t, err, "invalid JSON at offset 15")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		for _, input := range []string{`{`, `{"a": "b`, `{"a": [1`, `{"a": tr`, `{"a": 1.`} {
+			_, err := NewDecoder(strings.NewReader(input)).Decode()
+			assert.Equal(t, io.ErrUnexpectedEOF, err, input)
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		errRead := errors.New("read failed")
+		r := io.MultiReader(strings.NewReader(`{"a": 1} {"b":`), iotest.ErrReader(errRead))
+		dec := NewDecoder(r)
+		_, err := dec.Decode()
+		require.NoError(t, err)
+		_, err = dec.Decode()
+		assert.Equal(t, errRead, err)
+	})
+}
+
+func BenchmarkParseJSON(b *testing.B) {
+	event := []byte(`{"@timestamp":"2024-01-01T00:00:00.000Z","message":"GET /index.html HTTP/1.1","log":{"level":"info","offset":12345},"host":{"name":"test-host","ip":["10.0.0.1","fe80::1"],"os":{"family":"linux"}},"http":{"request":{"method":"GET","bytes":512},"response":{"status_code":200,"bytes":1024}},"tags":["a","b","c"]}`)
+
+	b.Run("ParseJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ParseJSON(event, WithNumberMode(NumberInt64)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("ParseJSON interned", func(b *testing.B) {
+		p := newJSONParser([]DecodeOption{WithNumberMode(NumberInt64), InternKeys})
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := p.parseDocument(event); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("json.Unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v map[string]interface{}
+			if err := json.Unmarshal(event, &v); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := toMapStr(v); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	event := `{"@timestamp":"2024-01-01T00:00:00.000Z","message":"GET /index.html HTTP/1.1","log":{"level":"info","offset":12345},"host":{"name":"test-host","ip":["10.0.0.1","fe80::1"],"os":{"family":"linux"}},"http":{"request":{"method":"GET","bytes":512},"response":{"status_code":200,"bytes":1024}},"tags":["a","b","c"]}` + "\n"
+	stream := strings.Repeat(event, 100)
+
+	b.Run("Decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dec := NewDecoder(strings.NewReader(stream), WithNumberMode(NumberInt64))
+			for {
+				if _, err := dec.Decode(); err == io.EOF {
+					break
+				} else if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("json.Decoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			dec := json.NewDecoder(strings.NewReader(stream))
+			for {
+				var v interface{}
+				if err := dec.Decode(&v); err == io.EOF {
+					break
+				} else if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
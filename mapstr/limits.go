@@ -0,0 +1,211 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits configures the limits enforced by Truncate. Zero values disable a
+// limit.
+type Limits struct {
+	// MaxDepth is the maximum nesting of maps. Top-level keys have depth 1.
+	// Maps nested deeper are removed.
+	MaxDepth int
+
+	// MaxKeys is the maximum number of keys per map. Keys exceeding the
+	// limit are removed, keeping the first keys in lexical order.
+	MaxKeys int
+
+	// MaxStringLength is the maximum length of strings in bytes. Longer
+	// strings are cut at a rune boundary.
+	MaxStringLength int
+
+	// MaxArrayLength is the maximum number of elements of arrays. Elements
+	// exceeding the limit are removed.
+	MaxArrayLength int
+}
+
+// EstimateSize returns an estimation of the size of the map encoded as JSON
+// in bytes. Its cost is linear to the number of values, without encoding
+// them.
+func (m M) EstimateSize() int {
+	return estimateSize(map[string]interface{}(m))
+}
+
+func estimateSize(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(v) + 2
+	case []byte:
+		// base64 encoded
+		return (len(v)+2)/3*4 + 2
+	case bool:
+		return 5
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return 10
+	case float32, float64:
+		return 16
+	case time.Time:
+		return 32
+	case M:
+		return estimateSize(map[string]interface{}(v))
+	case map[string]interface{}:
+		// braces, separators, quotes and colons
+		size := 2 + len(v)*4
+		for k, elem := range v {
+			size += len(k) + estimateSize(elem)
+		}
+		return size
+	case []interface{}:
+		size := 2 + len(v)
+		for _, elem := range v {
+			size += estimateSize(elem)
+		}
+		return size
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		size := 2 + rv.Len()
+		for i := 0; i < rv.Len(); i++ {
+			size += estimateSize(rv.Index(i).Interface())
+		}
+		return size
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return 4
+		}
+		return estimateSize(rv.Elem().Interface())
+	}
+	return 16
+}
+
+// Truncate enforces the limits on the map, modifying it in place. It returns
+// the sorted paths of all values which have been removed or truncated, such
+// that they can be reported, e.g. as part of the event.
+func (m M) Truncate(limits Limits) []string {
+	var truncated []string
+	truncateMap(m, "", 1, limits, &truncated)
+	sort.Strings(truncated)
+	return truncated
+}
+
+func truncateMap(m M, prefix string, depth int, limits Limits, truncated *[]string) {
+	if limits.MaxKeys > 0 && len(m) > limits.MaxKeys {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys[limits.MaxKeys:] {
+			delete(m, k)
+			*truncated = append(*truncated, truncatePath(prefix, k))
+		}
+	}
+
+	for k, v := range m {
+		path := truncatePath(prefix, k)
+		if _, isMap := tryToMapStr(v); isMap && limits.MaxDepth > 0 && depth >= limits.MaxDepth {
+			delete(m, k)
+			*truncated = append(*truncated, path)
+			continue
+		}
+		if nv, changed := truncateValue(v, path, depth, limits, truncated); changed {
+			m[k] = nv
+		}
+	}
+}
+
+// truncateValue enforces the limits on a single value. It returns the new
+// value and true if the value has to be replaced.
+func truncateValue(v interface{}, path string, depth int, limits Limits, truncated *[]string) (interface{}, bool) {
+	switch val := v.(type) {
+	case string:
+		if limits.MaxStringLength > 0 && len(val) > limits.MaxStringLength {
+			*truncated = append(*truncated, path)
+			return truncateString(val, limits.MaxStringLength), true
+		}
+		return v, false
+	case M:
+		truncateMap(val, path, depth+1, limits, truncated)
+		return v, false
+	case map[string]interface{}:
+		truncateMap(val, path, depth+1, limits, truncated)
+		return v, false
+	case []byte:
+		return v, false
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return v, false
+	}
+
+	changed := false
+	if limits.MaxArrayLength > 0 && rv.Len() > limits.MaxArrayLength {
+		rv = rv.Slice(0, limits.MaxArrayLength)
+		*truncated = append(*truncated, path)
+		changed = true
+	}
+	// elements are compacted in place if maps are removed, paths refer to
+	// the original indices
+	w := 0
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		elemPath := path + "[" + strconv.Itoa(i) + "]"
+		if _, isMap := tryToMapStr(elem.Interface()); isMap && limits.MaxDepth > 0 && depth >= limits.MaxDepth {
+			// maps in arrays are nested one level deeper than the array
+			*truncated = append(*truncated, elemPath)
+			changed = true
+			continue
+		}
+		if nv, elemChanged := truncateValue(elem.Interface(), elemPath, depth, limits, truncated); elemChanged {
+			elem.Set(reflect.ValueOf(nv))
+		}
+		if w != i {
+			rv.Index(w).Set(elem)
+		}
+		w++
+	}
+	if w < rv.Len() {
+		rv = rv.Slice(0, w)
+	}
+	return rv.Interface(), changed
+}
+
+func truncatePath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func truncateString(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateSize(t *testing.T) {
+	m := M{
+		"message": strings.Repeat("x", 1000),
+		"host":    M{"name": "test", "ip": []string{"10.0.0.1", "::1"}},
+		"count":   123,
+		"ok":      true,
+		"nested":  map[string]interface{}{"list": []interface{}{M{"a": 1.5}, nil}},
+	}
+
+	encoded, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	estimate := m.EstimateSize()
+	assert.InDelta(t, len(encoded), estimate, float64(len(encoded))*0.2)
+	assert.Equal(t, 2, M{}.EstimateSize())
+}
+
+func TestTruncate(t *testing.T) {
+	m := M{
+		"a": strings.Repeat("x", 10),
+		"b": "héllo",
+		"c": M{
+			"d": M{"e": 1},
+			"f": []interface{}{M{"g": 1}, "long string", 3, 4},
+		},
+		"tags": []string{"one", "two", "three"},
+		"z":    1,
+	}
+
+	truncated := m.Truncate(Limits{
+		MaxDepth:        2,
+		MaxKeys:         4,
+		MaxStringLength: 2,
+		MaxArrayLength:  3,
+	})
+
+	assert.Equal(t, M{
+		"a": "xx",
+		"b": "h",
+		"c": M{
+			"f": []interface{}{"lo", 3},
+		},
+		"tags": []string{"on", "tw", "th"},
+	}, m)
+	assert.Equal(t, []string{
+		"a", "b", "c.d", "c.f", "c.f[0]", "c.f[1]",
+		"tags[0]", "tags[1]", "tags[2]", "z",
+	}, truncated)
+}
+
+func TestTruncateNoLimits(t *testing.T) {
+	m := M{"a": strings.Repeat("x", 10), "b": M{"c": M{"d": []int{1, 2, 3}}}}
+	expected := m.Clone()
+	assert.Empty(t, m.Truncate(Limits{}))
+	assert.Equal(t, expected, m)
+}
@@ -194,6 +194,63 @@ func cloneMap(dst, src M) {
 	}
 }
 
+// CopyOnWrite returns a shallow copy of the M, in which only the nested maps
+// containing the given keys are copied. Values can then be put to or deleted
+// from the returned map under these keys without modifying the original M,
+// while all other nested maps are shared. As only the top level map and the
+// maps on the paths of the keys are copied, this is cheaper than Clone for
+// events with many nested maps of which only a few keys are going to be
+// modified. Keys can be expressed in dot-notation like for Put.
+//
+// Maps shared with the original M must not be modified.
+func (m M) CopyOnWrite(keys ...string) M {
+	out := make(M, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+
+	// copied tracks the paths of the nested maps already copied, such that
+	// maps on the path of multiple keys are copied only once
+	copied := map[string]struct{}{}
+	for _, key := range keys {
+		level, path := out, ""
+		for {
+			// the remaining key exists as is, like in mapFind
+			if _, exists := level[key]; exists {
+				break
+			}
+			idx := strings.IndexRune(key, '.')
+			if idx < 0 {
+				break
+			}
+
+			k := key[:idx]
+			key = key[idx+1:]
+			path += "." + k
+			sub, ok := tryToMapStr(level[k])
+			if !ok {
+				break
+			}
+			if _, done := copied[path]; !done {
+				cp := make(M, len(sub))
+				for sk, sv := range sub {
+					cp[sk] = sv
+				}
+				// keep the type of the nested map
+				if _, isM := level[k].(M); isM {
+					level[k] = cp
+				} else {
+					level[k] = map[string]interface{}(cp)
+				}
+				copied[path] = struct{}{}
+				sub = cp
+			}
+			level = sub
+		}
+	}
+	return out
+}
+
 // HasKey returns true if the key exist. If an error occurs then false is
 // returned with a non-nil error.
 func (m M) HasKey(key string) (bool, error) {
@@ -454,7 +511,9 @@ func (m M) Format(f fmt.State, c rune) {
 //
 //	"hello.world": "test"
 //
-// This can be useful for testing or logging.
+// This can be useful for testing or logging. Keys containing dots can not be
+// told apart from nested keys in the result, use FlattenEscaped if the result
+// needs to be converted back using Unflatten.
 func (m M) Flatten() M {
 	return flatten("", m, M{})
 }
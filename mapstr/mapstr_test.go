@@ -424,6 +424,99 @@ func BenchmarkClone(b *testing.B) {
 	}
 }
 
+func TestCopyOnWrite(t *testing.T) {
+	original := M{
+		"a": 1,
+		"host": M{
+			"name": "test",
+			"os":   map[string]interface{}{"family": "linux"},
+		},
+		"agent":     M{"id": "x"},
+		"dotted.id": M{"v": 1},
+	}
+
+	cp := original.CopyOnWrite("host.os.family", "host.name", "dotted.id", "missing.key", "a.b")
+	_, err := cp.Put("host.os.family", "windows")
+	require.NoError(t, err)
+	_, err = cp.Put("host.name", "other")
+	require.NoError(t, err)
+	_, err = cp.Put("dotted.id", 2)
+	require.NoError(t, err)
+	_, err = cp.Put("missing.key", 1)
+	require.NoError(t, err)
+	require.NoError(t, cp.Delete("agent"))
+
+	assert.Equal(t, M{
+		"a": 1,
+		"host": M{
+			"name": "test",
+			"os":   map[string]interface{}{"family": "linux"},
+		},
+		"agent":     M{"id": "x"},
+		"dotted.id": M{"v": 1},
+	}, original)
+	assert.Equal(t, M{
+		"a": 1,
+		"host": M{
+			"name": "other",
+			"os":   map[string]interface{}{"family": "windows"},
+		},
+		"dotted.id": 2,
+		"missing":   M{"key": 1},
+	}, cp)
+}
+
+func TestCopyOnWriteSharedMaps(t *testing.T) {
+	shared := M{"id": "x"}
+	original := M{"a": shared, "b": shared}
+
+	cp := original.CopyOnWrite("a.id", "b.id", "a.name")
+	_, err := cp.Put("a.id", "y")
+	require.NoError(t, err)
+	_, err = cp.Put("a.name", "n")
+	require.NoError(t, err)
+	_, err = cp.Put("b.id", "z")
+	require.NoError(t, err)
+
+	assert.Equal(t, M{"id": "x"}, shared)
+	assert.Equal(t, M{"a": M{"id": "y", "name": "n"}, "b": M{"id": "z"}}, cp)
+}
+
+func BenchmarkCloneEvent(b *testing.B) {
+	m := M{
+		"@timestamp": "2024-01-01T00:00:00Z",
+		"message":    "some log line",
+		"host": M{
+			"name": "test",
+			"os":   M{"family": "debian", "kernel": "6.1", "name": "Debian", "version": "12"},
+			"ip":   []string{"10.0.0.1"},
+		},
+		"agent": M{"id": "x", "name": "test", "type": "filebeat", "version": "8.15.0"},
+		"log":   M{"offset": 1234, "file": M{"path": "/var/log/syslog"}},
+		"event": M{"dataset": "system.syslog", "module": "system"},
+	}
+
+	large := m.Clone()
+	for i := 0; i < 20; i++ {
+		large[fmt.Sprintf("field%d", i)] = M{"a": i, "b": M{"c": i, "d": M{"e": i}}}
+	}
+
+	for name, event := range map[string]M{"small": m, "large": large} {
+		b.Run(name+"/Clone", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = event.Clone()
+			}
+		})
+		b.Run(name+"/CopyOnWrite", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = event.CopyOnWrite("host.os.family", "event.dataset")
+			}
+		})
+	}
+}
+
 func TestString(t *testing.T) {
 	type io struct {
 		Input  M
@@ -0,0 +1,438 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operations supported by PatchOp, see RFC 6902.
+const (
+	PatchAdd     = "add"
+	PatchRemove  = "remove"
+	PatchReplace = "replace"
+	PatchMove    = "move"
+	PatchCopy    = "copy"
+	PatchTest    = "test"
+)
+
+// ErrPatchTestFailed is returned by ApplyPatch if a test operation fails.
+var ErrPatchTestFailed = errors.New("patch test failed")
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// PatchOp is a single operation of a JSON Patch (RFC 6902). Path and From
+// are JSON Pointers (RFC 6901), e.g. `/host/ip/0`.
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes the operation, including a null value for operations
+// requiring a value.
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	type plain PatchOp
+	switch op.Op {
+	case PatchAdd, PatchReplace, PatchTest:
+		return json.Marshal(struct {
+			plain
+			Value interface{} `json:"value"`
+		}{plain(op), op.Value})
+	}
+	return json.Marshal(plain(op))
+}
+
+// Diff returns the operations transforming a into b. Nested maps are
+// compared key by key, all other values, including arrays, are replaced as a
+// whole if they are not equal. The operations are ordered by path.
+func Diff(a, b M) []PatchOp {
+	var ops []PatchOp
+	diffMaps("", a, b, &ops)
+	return ops
+}
+
+func diffMaps(prefix string, a, b M, ops *[]PatchOp) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, exists := a[k]; !exists {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := prefix + "/" + pointerEscaper.Replace(k)
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inB:
+			*ops = append(*ops, PatchOp{Op: PatchRemove, Path: path})
+		case !inA:
+			*ops = append(*ops, PatchOp{Op: PatchAdd, Path: path, Value: vb})
+		default:
+			ma, aIsMap := tryToMapStr(va)
+			mb, bIsMap := tryToMapStr(vb)
+			if aIsMap && bIsMap {
+				diffMaps(path, ma, mb, ops)
+			} else if !reflect.DeepEqual(va, vb) {
+				*ops = append(*ops, PatchOp{Op: PatchReplace, Path: path, Value: vb})
+			}
+		}
+	}
+}
+
+// ApplyPatch applies the operations to the map. Either all operations are
+// applied, or, if an operation fails, the map is not modified and an error
+// is returned.
+//
+// Adding or replacing the root, the empty path, replaces the whole document,
+// the patched document must be a map.
+//
+// Maps and arrays modified by the patch are copied, such that values shared
+// with other maps are not modified. Arrays of other types than
+// []interface{} are converted to []interface{} if modified.
+func (m M) ApplyPatch(ops []PatchOp) error {
+	var doc interface{} = m
+	for i, op := range ops {
+		var err error
+		doc, err = applyPatchOp(doc, op)
+		if err != nil {
+			return fmt.Errorf("failed to apply patch operation %d (%v %v): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	result, ok := tryToMapStr(doc)
+	if !ok {
+		return fmt.Errorf("patch result of type %T is no map: %w", doc, ErrNotMapType)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	for k := range m {
+		delete(m, k)
+	}
+	for k, v := range result {
+		m[k] = v
+	}
+	return nil
+}
+
+func applyPatchOp(doc interface{}, op PatchOp) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case PatchAdd:
+		return patchAdd(doc, path, op.Value)
+	case PatchRemove:
+		doc, _, err := patchRemove(doc, path)
+		return doc, err
+	case PatchReplace:
+		if len(path) == 0 {
+			// replacing the root replaces the whole document
+			return patchAdd(doc, path, op.Value)
+		}
+		doc, _, err := patchRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return patchAdd(doc, path, op.Value)
+	case PatchMove, PatchCopy:
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		if op.Op == PatchMove {
+			if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+				return nil, errors.New("can not move a value into itself")
+			}
+			doc, v, err = patchRemove(doc, from)
+		} else {
+			v, err = patchGet(doc, from)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return patchAdd(doc, path, v)
+	case PatchTest:
+		v, err := patchGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !patchValuesEqual(v, op.Value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation '%v'", op.Op)
+	}
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer '%v'", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = pointerUnescaper.Replace(t)
+	}
+	return tokens, nil
+}
+
+func patchGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		if m, ok := tryToMapStr(doc); ok {
+			v, exists := m[token]
+			if !exists {
+				return nil, ErrKeyNotFound
+			}
+			doc = v
+			continue
+		}
+
+		arr, ok := toInterfaceSlice(doc, false)
+		if !ok {
+			return nil, ErrNotMapType
+		}
+		i, err := arrayIndex(token, len(arr), false)
+		if err != nil {
+			return nil, err
+		}
+		doc = arr[i]
+	}
+	return doc, nil
+}
+
+func patchAdd(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		// The value replaces the whole document. Maps are copied, so the
+		// following operations and ApplyPatch don't modify the value.
+		if m, ok := tryToMapStr(v); ok {
+			cp := make(M, len(m))
+			for k, v := range m {
+				cp[k] = v
+			}
+			return cp, nil
+		}
+		return v, nil
+	}
+	return patchUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		if m, ok := parent.(M); ok {
+			m[token] = v
+			return m, nil
+		}
+		arr := parent.([]interface{})
+		i, err := arrayIndex(token, len(arr), true)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, nil)
+		copy(arr[i+1:], arr[i:])
+		arr[i] = v
+		return arr, nil
+	})
+}
+
+func patchRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("can not remove the document root")
+	}
+
+	var removed interface{}
+	doc, err := patchUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		if m, ok := parent.(M); ok {
+			v, exists := m[token]
+			if !exists {
+				return nil, ErrKeyNotFound
+			}
+			removed = v
+			delete(m, token)
+			return m, nil
+		}
+		arr := parent.([]interface{})
+		i, err := arrayIndex(token, len(arr), false)
+		if err != nil {
+			return nil, err
+		}
+		removed = arr[i]
+		return append(arr[:i], arr[i+1:]...), nil
+	})
+	return doc, removed, err
+}
+
+// patchUpdate copies the containers along the path and calls fn with the
+// copy of the parent of the last token. The parent is passed as M or
+// []interface{}. The value returned by fn replaces the parent.
+func patchUpdate(doc interface{}, path []string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	var parent interface{}
+	var get func(string) (interface{}, error)
+	var set func(string, interface{})
+
+	if m, ok := tryToMapStr(doc); ok {
+		cp := make(M, len(m)+1)
+		for k, v := range m {
+			cp[k] = v
+		}
+		parent = cp
+		get = func(token string) (interface{}, error) {
+			v, exists := cp[token]
+			if !exists {
+				return nil, ErrKeyNotFound
+			}
+			return v, nil
+		}
+		set = func(token string, v interface{}) {
+			cp[token] = v
+		}
+	} else if arr, ok := toInterfaceSlice(doc, true); ok {
+		parent = arr
+		get = func(token string) (interface{}, error) {
+			i, err := arrayIndex(token, len(arr), false)
+			if err != nil {
+				return nil, err
+			}
+			return arr[i], nil
+		}
+		set = func(token string, v interface{}) {
+			// the index has been validated by get
+			i, _ := strconv.Atoi(token)
+			arr[i] = v
+		}
+	} else {
+		return nil, ErrNotMapType
+	}
+
+	if len(path) == 1 {
+		updated, err := fn(parent, path[0])
+		if err != nil {
+			return nil, err
+		}
+		return restoreMapType(doc, updated), nil
+	}
+
+	child, err := get(path[0])
+	if err != nil {
+		return nil, err
+	}
+	child, err = patchUpdate(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	set(path[0], child)
+	return restoreMapType(doc, parent), nil
+}
+
+// restoreMapType converts the copy of a map back to the type of the
+// original map.
+func restoreMapType(orig, updated interface{}) interface{} {
+	if _, ok := orig.(map[string]interface{}); ok {
+		if m, ok := updated.(M); ok {
+			return map[string]interface{}(m)
+		}
+	}
+	return updated
+}
+
+// toInterfaceSlice returns the elements of an array or slice. If copyAlways
+// is set, a []interface{} is copied as well.
+func toInterfaceSlice(v interface{}, copyAlways bool) ([]interface{}, bool) {
+	if arr, ok := v.([]interface{}); ok {
+		if !copyAlways {
+			return arr, true
+		}
+		return append(make([]interface{}, 0, len(arr)+1), arr...), true
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	arr := make([]interface{}, rv.Len(), rv.Len()+1)
+	for i := range arr {
+		arr[i] = rv.Index(i).Interface()
+	}
+	return arr, true
+}
+
+// arrayIndex parses an array index of a JSON Pointer. If insert is set, the
+// index can point to the end of the array, which can also be selected
+// using `-`.
+func arrayIndex(token string, length int, insert bool) (int, error) {
+	if insert && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%v'", token)
+	}
+	if i > length || (i == length && !insert) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// patchValuesEqual compares values for the test operation. Numbers are
+// compared by value, maps and arrays element by element.
+func patchValuesEqual(a, b interface{}) bool {
+	if ma, ok := tryToMapStr(a); ok {
+		mb, ok := tryToMapStr(b)
+		if !ok || len(ma) != len(mb) {
+			return false
+		}
+		for k, va := range ma {
+			vb, exists := mb[k]
+			if !exists || !patchValuesEqual(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if arrA, ok := toInterfaceSlice(a, false); ok {
+		arrB, ok := toInterfaceSlice(b, false)
+		if !ok || len(arrA) != len(arrB) {
+			return false
+		}
+		for i := range arrA {
+			if !patchValuesEqual(arrA[i], arrB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return valuesEqual(a, b)
+}
@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	a := M{
+		"host":    M{"name": "a", "ip": []string{"127.0.0.1"}},
+		"removed": 1,
+		"same":    M{"x": 1},
+		"a/b":     "old",
+	}
+	b := M{
+		"host":  M{"name": "b", "ip": []string{"127.0.0.1", "::1"}, "os": "linux"},
+		"same":  M{"x": 1},
+		"a/b":   "new",
+		"added": M{"y": 2},
+	}
+
+	ops := Diff(a, b)
+	assert.Equal(t, []PatchOp{
+		{Op: PatchReplace, Path: "/a~1b", Value: "new"},
+		{Op: PatchAdd, Path: "/added", Value: M{"y": 2}},
+		{Op: PatchReplace, Path: "/host/ip", Value: []string{"127.0.0.1", "::1"}},
+		{Op: PatchReplace, Path: "/host/name", Value: "b"},
+		{Op: PatchAdd, Path: "/host/os", Value: "linux"},
+		{Op: PatchRemove, Path: "/removed"},
+	}, ops)
+
+	orig := a.Clone()
+	require.NoError(t, a.ApplyPatch(ops))
+	assert.Equal(t, b, a)
+	assert.Empty(t, Diff(a, b))
+
+	// patching copies modified containers
+	assert.Equal(t, "a", orig["host"].(M)["name"])
+}
+
+func TestApplyPatch(t *testing.T) {
+	var ops []PatchOp
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/count", "value": 1},
+		{"op": "add", "path": "/tags/1", "value": "b"},
+		{"op": "add", "path": "/tags/-", "value": "d"},
+		{"op": "remove", "path": "/tags/0"},
+		{"op": "replace", "path": "/host/name", "value": null},
+		{"op": "copy", "from": "/host", "path": "/observer"},
+		{"op": "move", "from": "/host/ip", "path": "/ip"},
+		{"op": "add", "path": "/list/0/x~0y", "value": true},
+		{"op": "test", "path": "/list", "value": [{"x~y": true}]}
+	]`), &ops))
+
+	m := M{
+		"count": 1,
+		"tags":  []string{"a", "c"},
+		"host":  map[string]interface{}{"name": "test", "ip": "127.0.0.1"},
+		"list":  []interface{}{M{}},
+	}
+	require.NoError(t, m.ApplyPatch(ops))
+	assert.Equal(t, M{
+		"count":    1,
+		"tags":     []interface{}{"b", "c", "d"},
+		"host":     map[string]interface{}{"name": nil},
+		"observer": map[string]interface{}{"name": nil, "ip": "127.0.0.1"},
+		"ip":       "127.0.0.1",
+		"list":     []interface{}{M{"x~y": true}},
+	}, m)
+}
+
+func TestApplyPatchRoot(t *testing.T) {
+	for _, op := range []string{PatchAdd, PatchReplace} {
+		t.Run(op, func(t *testing.T) {
+			doc := M{"host": M{"name": "b"}}
+			m := M{"host": M{"name": "a"}, "removed": 1}
+			require.NoError(t, m.ApplyPatch([]PatchOp{
+				{Op: op, Path: "", Value: doc},
+				{Op: PatchAdd, Path: "/added", Value: 1},
+				{Op: PatchReplace, Path: "/host/name", Value: "c"},
+			}))
+			assert.Equal(t, M{"host": M{"name": "c"}, "added": 1}, m)
+			assert.Equal(t, M{"host": M{"name": "b"}}, doc, "the value must not be modified")
+		})
+	}
+
+	t.Run("self", func(t *testing.T) {
+		m := M{"a": 1}
+		require.NoError(t, m.ApplyPatch([]PatchOp{{Op: PatchReplace, Path: "", Value: m}}))
+		assert.Equal(t, M{"a": 1}, m)
+	})
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	tests := map[string]PatchOp{
+		"test failed":         {Op: PatchTest, Path: "/a", Value: 2},
+		"missing key":         {Op: PatchRemove, Path: "/missing"},
+		"replace missing":     {Op: PatchReplace, Path: "/missing", Value: 1},
+		"missing parent":      {Op: PatchAdd, Path: "/missing/x", Value: 1},
+		"no container":        {Op: PatchAdd, Path: "/a/x", Value: 1},
+		"index out of range":  {Op: PatchAdd, Path: "/arr/3", Value: 1},
+		"invalid index":       {Op: PatchRemove, Path: "/arr/01"},
+		"invalid pointer":     {Op: PatchAdd, Path: "a", Value: 1},
+		"move into child":     {Op: PatchMove, From: "/b", Path: "/b/c"},
+		"remove root":         {Op: PatchRemove, Path: ""},
+		"root no map":         {Op: PatchAdd, Path: "", Value: 1},
+		"replace root no map": {Op: PatchReplace, Path: "", Value: []interface{}{1}},
+		"unknown op":          {Op: "merge", Path: "/a"},
+	}
+
+	for name, op := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := M{"a": 1, "b": M{}, "arr": []interface{}{1, 2}}
+			err := m.ApplyPatch([]PatchOp{
+				{Op: PatchAdd, Path: "/new", Value: 1},
+				op,
+			})
+			assert.Error(t, err)
+			assert.Equal(t, M{"a": 1, "b": M{}, "arr": []interface{}{1, 2}}, m, "map must not be modified")
+		})
+	}
+}
+
+func TestPatchOpJSON(t *testing.T) {
+	for _, test := range []struct {
+		op       PatchOp
+		expected string
+	}{
+		{PatchOp{Op: PatchReplace, Path: "/a"}, `{"op":"replace","path":"/a","value":null}`},
+		{PatchOp{Op: PatchRemove, Path: "/a"}, `{"op":"remove","path":"/a"}`},
+		{PatchOp{Op: PatchMove, From: "/a", Path: "/b"}, `{"op":"move","path":"/b","from":"/a"}`},
+	} {
+		b, err := json.Marshal(test.op)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, string(b))
+	}
+}
@@ -0,0 +1,223 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidQuery indicates that a query expression can not be parsed.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// QueryMatch is a value matched by Query together with its full path.
+type QueryMatch struct {
+	// Path is the path of the value in the map, without wildcards. Array
+	// elements are written as `[i]`, and keys containing special characters
+	// in bracket notation (e.g. `['host.name']`).
+	Path  string
+	Value interface{}
+}
+
+// queryStep is a single step of a parsed query.
+type queryStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// Query returns all values matching the query expression, in a stable order.
+// Unlike GetValue, the expression can contain wildcards and array indices:
+//
+//   - `a.b` selects the key `b` in the map stored under `a`.
+//   - `a.*` selects all values of the map or array stored under `a`.
+//   - `a[2]` selects the third element of the array stored under `a`.
+//     Negative indices count from the end of the array.
+//   - `a[*]` selects all elements of the array stored under `a`.
+//   - `a['b.c']` selects the key `b.c`, which contains a dot.
+//
+// Steps can be combined, e.g. `a.b[2].*.host`. An optional leading `$` is
+// ignored for compatibility with JSONPath. Paths not present in the map
+// don't match, so an empty result is returned if nothing matches. An error
+// wrapping ErrInvalidQuery is returned if the expression can not be parsed.
+func (m M) Query(expr string) ([]QueryMatch, error) {
+	steps, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []QueryMatch
+	queryValue(map[string]interface{}(m), "", steps, &matches)
+	return matches, nil
+}
+
+func queryValue(v interface{}, path string, steps []queryStep, matches *[]QueryMatch) {
+	if len(steps) == 0 {
+		*matches = append(*matches, QueryMatch{Path: path, Value: v})
+		return
+	}
+
+	step := steps[0]
+	if m, ok := tryToMapStr(v); ok {
+		switch {
+		case step.wildcard:
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				queryValue(m[k], queryKeyPath(path, k), steps[1:], matches)
+			}
+		case !step.isIndex:
+			if sub, found := m[step.key]; found {
+				queryValue(sub, queryKeyPath(path, step.key), steps[1:], matches)
+			}
+		}
+		return
+	}
+
+	if !step.isIndex && !step.wildcard {
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return
+	}
+
+	if step.wildcard {
+		for i := 0; i < rv.Len(); i++ {
+			queryValue(rv.Index(i).Interface(), queryIndexPath(path, i), steps[1:], matches)
+		}
+		return
+	}
+
+	i := step.index
+	if i < 0 {
+		i += rv.Len()
+	}
+	if i >= 0 && i < rv.Len() {
+		queryValue(rv.Index(i).Interface(), queryIndexPath(path, i), steps[1:], matches)
+	}
+}
+
+func queryKeyPath(prefix, key string) string {
+	if key == "" || strings.ContainsAny(key, ".[]*'") {
+		return prefix + "['" + key + "']"
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func queryIndexPath(prefix string, i int) string {
+	return prefix + "[" + strconv.Itoa(i) + "]"
+}
+
+// parseQuery splits a query expression into its steps.
+func parseQuery(expr string) ([]queryStep, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidQuery, expr, reason)
+	}
+
+	s := expr
+	if strings.HasPrefix(s, "$") {
+		s = strings.TrimPrefix(s[1:], ".")
+	}
+	if s == "" {
+		return nil, invalid("empty query")
+	}
+
+	var steps []queryStep
+	for len(s) > 0 {
+		// key or wildcard up to the next separator
+		end := strings.IndexAny(s, ".[")
+		if end < 0 {
+			end = len(s)
+		}
+		switch name := s[:end]; name {
+		case "":
+			// only a bracket can start the query without a key
+			if end == len(s) || s[end] != '[' {
+				return nil, invalid("empty key")
+			}
+		case "*":
+			steps = append(steps, queryStep{wildcard: true})
+		default:
+			if strings.ContainsAny(name, "]'*") {
+				return nil, invalid(fmt.Sprintf("unexpected character in key %q", name))
+			}
+			steps = append(steps, queryStep{key: name})
+		}
+		s = s[end:]
+
+		for strings.HasPrefix(s, "[") {
+			step, n, err := parseQueryBracket(s)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			steps = append(steps, step)
+			s = s[n:]
+		}
+
+		if s == "" {
+			break
+		}
+		if s[0] != '.' || len(s) == 1 {
+			return nil, invalid("expected key after '.'")
+		}
+		s = s[1:]
+		if s[0] == '[' || s[0] == '.' {
+			return nil, invalid("expected key after '.'")
+		}
+	}
+	return steps, nil
+}
+
+// parseQueryBracket parses a `[...]` step at the beginning of s. It returns
+// the step and the number of bytes consumed.
+func parseQueryBracket(s string) (queryStep, int, error) {
+	if len(s) > 1 && (s[1] == '\'' || s[1] == '"') {
+		quote := s[1]
+		end := strings.IndexByte(s[2:], quote)
+		if end < 0 || len(s) < end+4 || s[end+3] != ']' {
+			return queryStep{}, 0, errors.New("unterminated quoted key")
+		}
+		return queryStep{key: s[2 : end+2]}, end + 4, nil
+	}
+
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return queryStep{}, 0, errors.New("missing ']'")
+	}
+	content := s[1:end]
+	if content == "*" {
+		return queryStep{wildcard: true, isIndex: true}, end + 1, nil
+	}
+	i, err := strconv.Atoi(content)
+	if err != nil {
+		return queryStep{}, 0, fmt.Errorf("invalid array index %q", content)
+	}
+	return queryStep{index: i, isIndex: true}, end + 1, nil
+}
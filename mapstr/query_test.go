@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery(t *testing.T) {
+	m := M{
+		"a": M{
+			"b": []interface{}{
+				M{"x": M{"host": "h0"}},
+				M{"x": M{"host": "h1"}},
+				map[string]interface{}{
+					"x": M{"host": "h2", "port": 80},
+					"y": map[string]interface{}{"host": "h3"},
+				},
+			},
+		},
+		"tags":      []string{"t1", "t2", "t3"},
+		"host.name": "literal",
+		"host":      M{"name": "nested"},
+		"empty":     M{},
+	}
+
+	tests := map[string][]QueryMatch{
+		"a.b[2].*.host": {
+			{Path: "a.b[2].x.host", Value: "h2"},
+			{Path: "a.b[2].y.host", Value: "h3"},
+		},
+		"a.b[*].x.host": {
+			{Path: "a.b[0].x.host", Value: "h0"},
+			{Path: "a.b[1].x.host", Value: "h1"},
+			{Path: "a.b[2].x.host", Value: "h2"},
+		},
+		"a.b.*.x.port": {
+			{Path: "a.b[2].x.port", Value: 80},
+		},
+		"$.a.b[-1].y": {
+			{Path: "a.b[2].y", Value: map[string]interface{}{"host": "h3"}},
+		},
+		"tags[1]": {
+			{Path: "tags[1]", Value: "t2"},
+		},
+		"tags[*]": {
+			{Path: "tags[0]", Value: "t1"},
+			{Path: "tags[1]", Value: "t2"},
+			{Path: "tags[2]", Value: "t3"},
+		},
+		"host.name": {
+			{Path: "host.name", Value: "nested"},
+		},
+		"['host.name']": {
+			{Path: "['host.name']", Value: "literal"},
+		},
+		`*["name"]`: {
+			{Path: "host.name", Value: "nested"},
+		},
+		"empty.*": nil,
+		"missing": nil,
+		"tags[3]": nil,
+		"tags.x":  nil,
+		"a.b.x":   nil,
+		"a[0]":    nil,
+	}
+
+	for expr, expected := range tests {
+		t.Run(expr, func(t *testing.T) {
+			matches, err := m.Query(expr)
+			require.NoError(t, err)
+			assert.Equal(t, expected, matches)
+		})
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	m := M{"a": M{"b": 1}}
+	for _, expr := range []string{"", "$", "a.", ".a", "a..b", "a.[0]", "a[", "a[x]", "a['b]", "a]b", "a['b'", "host*"} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := m.Query(expr)
+			assert.ErrorIs(t, err, ErrInvalidQuery)
+		})
+	}
+}
@@ -0,0 +1,268 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Renamer renames keys of events according to a mapping table, e.g. to
+// migrate custom events to ECS field names.
+type Renamer struct {
+	rules []renameRule
+}
+
+type renameRule struct {
+	from, to  []string
+	wildcards int
+}
+
+// NewRenamer creates a Renamer from a mapping table of keys in dot-notation
+// to their new names. Segments of a key can be the wildcard `*`, which
+// matches any single key. Every wildcard in the new name is replaced by the
+// key matched by the wildcard at the same position in the old name, e.g.
+// `fields.*` to `labels.*` moves all keys from `fields` to `labels`.
+//
+// If a key is matched by multiple rules, rules without wildcards take
+// precedence over rules with wildcards.
+func NewRenamer(mapping map[string]string) (*Renamer, error) {
+	r := &Renamer{}
+	for from, to := range mapping {
+		rule := renameRule{
+			from:      strings.Split(from, "."),
+			to:        strings.Split(to, "."),
+			wildcards: strings.Count(from, "*"),
+		}
+		if !validRenameKey(rule.from) || !validRenameKey(rule.to) {
+			return nil, fmt.Errorf("invalid rename from '%v' to '%v': keys must not be empty and wildcards must match a complete key", from, to)
+		}
+		if n := strings.Count(to, "*"); n != rule.wildcards {
+			return nil, fmt.Errorf("invalid rename from '%v' to '%v': the number of wildcards must match", from, to)
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	sort.Slice(r.rules, func(i, j int) bool {
+		a, b := r.rules[i], r.rules[j]
+		if a.wildcards != b.wildcards {
+			return a.wildcards < b.wildcards
+		}
+		return strings.Join(a.from, ".") < strings.Join(b.from, ".")
+	})
+	return r, nil
+}
+
+func validRenameKey(segments []string) bool {
+	for _, s := range segments {
+		if s == "" || (s != "*" && strings.Contains(s, "*")) {
+			return false
+		}
+	}
+	return true
+}
+
+// renameMove is a single key matched by a rule.
+type renameMove struct {
+	from, to []string
+	value    interface{}
+}
+
+// Rename renames all keys of m matching a rule. Keys are matched segment by
+// segment through nested maps, so keys containing dots are only matched by
+// wildcards. Maps left empty by moving their keys are removed.
+//
+// Either all keys are renamed, or, if a new name is already in use and not
+// renamed itself, or multiple keys would be renamed to the same name, an
+// error wrapping ErrKeyCollision is returned and m is not modified.
+func (r *Renamer) Rename(m M) error {
+	var moves []renameMove
+	for _, rule := range r.rules {
+		matchRename(m, rule, nil, nil, func(from []string, matched []string) {
+			for _, mv := range moves {
+				if hasSegmentPrefix(from, mv.from) || hasSegmentPrefix(mv.from, from) {
+					// already renamed by a more specific rule
+					return
+				}
+			}
+			moves = append(moves, renameMove{from: from, to: expandRename(rule.to, matched)})
+		})
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+
+	// work on a copy of the maps on the affected paths, such that m is not
+	// modified in case of errors
+	tmp := m.CopyOnWrite()
+	copied := map[string]struct{}{}
+	for _, mv := range moves {
+		copySegments(tmp, mv.from, copied)
+		copySegments(tmp, mv.to, copied)
+	}
+
+	for i := range moves {
+		moves[i].value = deleteSegments(tmp, moves[i].from)
+	}
+	for _, mv := range moves {
+		if err := putSegments(tmp, mv.to, mv.value); err != nil {
+			return fmt.Errorf("failed to rename '%v' to '%v': %w", strings.Join(mv.from, "."), strings.Join(mv.to, "."), err)
+		}
+	}
+
+	for k := range m {
+		delete(m, k)
+	}
+	for k, v := range tmp {
+		m[k] = v
+	}
+	return nil
+}
+
+// matchRename calls fn with the path of every key in m matching the rule and
+// the keys matched by the wildcards.
+func matchRename(m M, rule renameRule, path, matched []string, fn func(path, matched []string)) {
+	depth := len(path)
+	segment := rule.from[depth]
+	last := depth == len(rule.from)-1
+
+	visit := func(k string, v interface{}, matched []string) {
+		p := append(path[:depth:depth], k)
+		if last {
+			fn(p, matched)
+			return
+		}
+		if sub, ok := tryToMapStr(v); ok {
+			matchRename(sub, rule, p, matched, fn)
+		}
+	}
+
+	if segment != "*" {
+		if v, exists := m[segment]; exists {
+			visit(segment, v, matched)
+		}
+		return
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		visit(k, m[k], append(matched[:len(matched):len(matched)], k))
+	}
+}
+
+func expandRename(to, matched []string) []string {
+	out := make([]string, len(to))
+	i := 0
+	for j, s := range to {
+		if s == "*" {
+			s = matched[i]
+			i++
+		}
+		out[j] = s
+	}
+	return out
+}
+
+func hasSegmentPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// copySegments copies the nested maps on the path in m, like CopyOnWrite.
+// The paths of the maps already copied are tracked in copied.
+func copySegments(m M, path []string, copied map[string]struct{}) {
+	for i, k := range path[:len(path)-1] {
+		sub, ok := tryToMapStr(m[k])
+		if !ok {
+			return
+		}
+		// segments can contain dots, quote them to get an unambiguous path
+		p := fmt.Sprintf("%q", path[:i+1])
+		if _, done := copied[p]; !done {
+			cp := make(M, len(sub))
+			for sk, sv := range sub {
+				cp[sk] = sv
+			}
+			if _, isM := m[k].(M); isM {
+				m[k] = cp
+			} else {
+				m[k] = map[string]interface{}(cp)
+			}
+			copied[p] = struct{}{}
+			sub = cp
+		}
+		m = sub
+	}
+}
+
+// deleteSegments removes the key at path from m and returns its value. Maps
+// left empty are removed as well.
+func deleteSegments(m M, path []string) interface{} {
+	if len(path) == 1 {
+		v := m[path[0]]
+		delete(m, path[0])
+		return v
+	}
+
+	sub, ok := tryToMapStr(m[path[0]])
+	if !ok {
+		return nil
+	}
+	v := deleteSegments(sub, path[1:])
+	if len(sub) == 0 {
+		delete(m, path[0])
+	}
+	return v
+}
+
+// putSegments stores v at path in m, creating intermediate maps.
+func putSegments(m M, path []string, v interface{}) error {
+	for _, k := range path[:len(path)-1] {
+		next, exists := m[k]
+		if !exists {
+			sub := M{}
+			m[k] = sub
+			m = sub
+			continue
+		}
+		sub, ok := tryToMapStr(next)
+		if !ok {
+			return fmt.Errorf("key '%v' is no map: %w", k, ErrKeyCollision)
+		}
+		m = sub
+	}
+
+	k := path[len(path)-1]
+	if _, exists := m[k]; exists {
+		return fmt.Errorf("key '%v' already exists: %w", strings.Join(path, "."), ErrKeyCollision)
+	}
+	m[k] = v
+	return nil
+}
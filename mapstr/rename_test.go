@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenamer(t *testing.T) {
+	r, err := NewRenamer(map[string]string{
+		"src_ip":          "source.ip",
+		"fields.*":        "labels.*",
+		"fields.env":      "service.environment",
+		"headers.*.value": "http.request.headers.*",
+		"client":          "source.address",
+		"a":               "b",
+		"b":               "a",
+		"missing.key":     "other",
+		"req.*.*":         "request.*.*",
+	})
+	require.NoError(t, err)
+
+	orig := M{
+		"src_ip": "10.0.0.1",
+		"fields": M{
+			"env":        "prod",
+			"team":       "obs",
+			"dotted.key": 1,
+		},
+		"headers": M{
+			"accept": M{"value": "*/*"},
+			"host":   M{"value": "example.com", "raw": true},
+		},
+		"client": "localhost",
+		"a":      1,
+		"b":      2,
+		"req":    M{"x": M{"y": 1}},
+	}
+	m := orig.Clone()
+	require.NoError(t, r.Rename(m))
+
+	assert.Equal(t, M{
+		"source":  M{"ip": "10.0.0.1", "address": "localhost"},
+		"service": M{"environment": "prod"},
+		"labels":  M{"team": "obs", "dotted.key": 1},
+		"http": M{"request": M{"headers": M{
+			"accept": "*/*",
+			"host":   "example.com",
+		}}},
+		"headers": M{"host": M{"raw": true}},
+		"a":       2,
+		"b":       1,
+		"request": M{"x": M{"y": 1}},
+	}, m)
+}
+
+func TestRenamerCollision(t *testing.T) {
+	r, err := NewRenamer(map[string]string{
+		"old.name": "host.name",
+		"x":        "y",
+	})
+	require.NoError(t, err)
+
+	m := M{
+		"old":  M{"name": "a"},
+		"host": M{"name": "b"},
+		"x":    1,
+	}
+	err = r.Rename(m)
+	assert.ErrorIs(t, err, ErrKeyCollision)
+	assert.Equal(t, M{
+		"old":  M{"name": "a"},
+		"host": M{"name": "b"},
+		"x":    1,
+	}, m, "map must not be modified")
+
+	r, err = NewRenamer(map[string]string{"a": "c", "b": "c"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, r.Rename(M{"a": 1, "b": 2}), ErrKeyCollision)
+}
+
+func TestNewRenamerInvalid(t *testing.T) {
+	for _, mapping := range []map[string]string{
+		{"a.*": "b"},
+		{"a": "b.*"},
+		{"a..b": "c"},
+		{"a*": "b*"},
+		{"": "a"},
+	} {
+		_, err := NewRenamer(mapping)
+		assert.Error(t, err, mapping)
+	}
+}
@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrValueNotAllowed indicates that a value is not one of the values allowed
+// by a FieldSchema.
+var ErrValueNotAllowed = errors.New("value not allowed")
+
+// ValueType is the type of value a FieldSchema requires.
+type ValueType uint8
+
+const (
+	// TypeAny allows values of any type, including nil.
+	TypeAny ValueType = iota
+	// TypeString requires a string.
+	TypeString
+	// TypeNumber requires an integer or floating point number.
+	TypeNumber
+	// TypeInteger requires an integer, or a floating point number without
+	// fractional part.
+	TypeInteger
+	// TypeBool requires a boolean.
+	TypeBool
+	// TypeObject requires a map.
+	TypeObject
+	// TypeArray requires a slice or array.
+	TypeArray
+)
+
+var valueTypeNames = map[ValueType]string{
+	TypeAny:     "any",
+	TypeString:  "string",
+	TypeNumber:  "number",
+	TypeInteger: "integer",
+	TypeBool:    "bool",
+	TypeObject:  "object",
+	TypeArray:   "array",
+}
+
+// String returns the name of the type.
+func (t ValueType) String() string {
+	if s, ok := valueTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("ValueType(%d)", t)
+}
+
+// FieldSchema describes the constraints of a single value.
+type FieldSchema struct {
+	// Required makes the validation fail if the key is missing.
+	Required bool
+
+	// Type of the value. Defaults to TypeAny.
+	Type ValueType
+
+	// Enum lists the allowed values, if not empty. Numbers are compared by
+	// value, independent of their Go type.
+	Enum []interface{}
+}
+
+// Schema maps keys in dot-notation, like accepted by GetValue, to the
+// constraints of their values. Keys not present in the schema are not
+// validated.
+type Schema map[string]FieldSchema
+
+// FieldError describes why a key failed the validation.
+type FieldError struct {
+	Key string
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid key '%v': %v", e.Key, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError lists all keys which failed the validation.
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e ValidationError) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Validate checks the map against the schema. All keys are validated and a
+// ValidationError listing every invalid key, ordered by key, is returned. The
+// errors of the keys wrap ErrKeyNotFound for missing required keys,
+// ErrTypeMismatch for values of the wrong type and ErrValueNotAllowed for
+// values not listed in the enum.
+func (m M) Validate(schema Schema) error {
+	keys := make([]string, 0, len(schema))
+	for k := range schema {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs ValidationError
+	for _, key := range keys {
+		if err := schema[key].validate(m, key); err != nil {
+			errs = append(errs, &FieldError{Key: key, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s FieldSchema) validate(m M, key string) error {
+	v, err := m.GetValue(key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) && !s.Required {
+			return nil
+		}
+		return err
+	}
+
+	if !hasValueType(v, s.Type) {
+		return fmt.Errorf("expected %v, got %T: %w", s.Type, v, ErrTypeMismatch)
+	}
+
+	if len(s.Enum) > 0 {
+		for _, allowed := range s.Enum {
+			if valuesEqual(v, allowed) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v is not one of %v: %w", v, s.Enum, ErrValueNotAllowed)
+	}
+	return nil
+}
+
+func hasValueType(v interface{}, t ValueType) bool {
+	switch t {
+	case TypeAny:
+		return true
+	case TypeString:
+		_, ok := v.(string)
+		return ok
+	case TypeNumber:
+		_, ok := toFloat64(v)
+		return ok
+	case TypeInteger:
+		if _, ok := toInt64(v); ok {
+			return true
+		}
+		if n, ok := v.(json.Number); ok {
+			_, err := n.Int64()
+			return err == nil
+		}
+		f, ok := toFloat64(v)
+		return ok && f == math.Trunc(f) && !math.IsInf(f, 0)
+	case TypeBool:
+		_, ok := v.(bool)
+		return ok
+	case TypeObject:
+		_, ok := tryToMapStr(v)
+		return ok
+	case TypeArray:
+		if v == nil {
+			return false
+		}
+		k := reflect.TypeOf(v).Kind()
+		return k == reflect.Slice || k == reflect.Array
+	}
+	return false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if fa, ok := toFloat64(a); ok {
+		fb, ok := toFloat64(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	switch v := v.(type) {
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	schema := Schema{
+		"event.kind":     {Required: true, Type: TypeString, Enum: []interface{}{"event", "alert"}},
+		"event.severity": {Type: TypeInteger, Enum: []interface{}{1, 2, 3}},
+		"host":           {Required: true, Type: TypeObject},
+		"host.ip":        {Type: TypeArray},
+		"score":          {Type: TypeNumber},
+		"enabled":        {Type: TypeBool},
+		"message":        {},
+	}
+
+	valid := M{
+		"event":   M{"kind": "alert", "severity": 2.0},
+		"host":    M{"ip": []string{"127.0.0.1"}},
+		"score":   json.Number("0.5"),
+		"enabled": true,
+		"message": nil,
+	}
+	assert.NoError(t, valid.Validate(schema))
+
+	var fromJSON M
+	require.NoError(t, json.Unmarshal([]byte(`{"event": {"kind": "event", "severity": 3}, "host": {}}`), &fromJSON))
+	assert.NoError(t, fromJSON.Validate(schema))
+
+	invalid := M{
+		"event":   M{"kind": "other", "severity": 1.5},
+		"host":    "localhost",
+		"score":   "high",
+		"enabled": "true",
+	}
+	err := invalid.Validate(schema)
+	require.Error(t, err)
+
+	var validationErr ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	keys := make([]string, len(validationErr))
+	for i, e := range validationErr {
+		keys[i] = e.Key
+	}
+	assert.Equal(t, []string{"enabled", "event.kind", "event.severity", "host", "host.ip", "score"}, keys)
+
+	assert.ErrorIs(t, validationErr[0], ErrTypeMismatch)
+	assert.ErrorIs(t, validationErr[1], ErrValueNotAllowed)
+	assert.ErrorIs(t, validationErr[2], ErrTypeMismatch)
+	assert.Error(t, validationErr[4])
+	assert.ErrorIs(t, err, ErrValueNotAllowed)
+
+	err = M{}.Validate(schema)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	assert.Equal(t, "invalid key 'event.kind': key not found; invalid key 'host': key not found", err.Error())
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// walkBuffers holds the buffers paths are built in by Walk.
+var walkBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 256)
+		return &buf
+	},
+}
+
+// WalkFunc is called by Walk for every value. Returning false stops the walk.
+//
+// The path is only valid until the function returns, as its memory is reused
+// for the next value. Use strings.Clone to retain it.
+type WalkFunc func(path string, v interface{}) bool
+
+// Walk calls fn for every value in the map which is not a nested map, passing
+// the full dotted path of the value, like the keys returned by Flatten. The
+// order of the values is unspecified. Walk returns false if fn stopped the
+// walk.
+//
+// Unlike Flatten, Walk does not build an intermediate map and does not
+// allocate for building the paths.
+func (m M) Walk(fn WalkFunc) bool {
+	buf := walkBuffers.Get().(*[]byte)
+	defer walkBuffers.Put(buf)
+	return walk(map[string]interface{}(m), buf, 0, fn)
+}
+
+// walk visits all values in m. The path of m is stored in (*buf)[:n]. The
+// buffer is grown as needed, such that it can be reused by later walks.
+func walk(m map[string]interface{}, buf *[]byte, n int, fn WalkFunc) bool {
+	for k, v := range m {
+		var sub map[string]interface{}
+		switch v := v.(type) {
+		case M:
+			sub = v
+		case map[string]interface{}:
+			sub = v
+		}
+
+		if sub == nil && n == 0 {
+			// top-level keys don't need a buffer
+			if !fn(k, v) {
+				return false
+			}
+			continue
+		}
+
+		path := (*buf)[:n]
+		if n > 0 {
+			path = append(path, '.')
+		}
+		path = append(path, k...)
+		*buf = path
+
+		if sub != nil {
+			if !walk(sub, buf, len(path), fn) {
+				return false
+			}
+			continue
+		}
+		if !fn(unsafe.String(unsafe.SliceData(path), len(path)), v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mapstr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk(t *testing.T) {
+	m := M{
+		"test": 15,
+		"hello": M{
+			"world": map[string]interface{}{
+				"ok": "test",
+			},
+		},
+		"elastic": M{
+			"for": "search",
+		},
+		"empty": M{},
+		"tags":  []string{"a"},
+	}
+
+	visited := M{}
+	assert.True(t, m.Walk(func(path string, v interface{}) bool {
+		visited[strings.Clone(path)] = v
+		return true
+	}))
+	assert.Equal(t, m.Flatten(), visited)
+
+	count := 0
+	assert.False(t, m.Walk(func(string, interface{}) bool {
+		count++
+		return count < 2
+	}))
+	assert.Equal(t, 2, count)
+}
+
+func TestWalkAllocations(t *testing.T) {
+	m := M{
+		"test": 15,
+		"hello": M{
+			"world": M{
+				"ok": "test",
+			},
+		},
+		"elastic": M{
+			"for": "search",
+		},
+	}
+
+	n := 0
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Walk(func(path string, v interface{}) bool {
+			n += len(path)
+			return true
+		})
+	})
+	assert.Zero(t, allocs)
+}
+
+func BenchmarkMapStrWalk(b *testing.B) {
+	m := M{
+		"test": 15,
+		"hello": M{
+			"world": M{
+				"ok": "test",
+			},
+		},
+		"elastic": M{
+			"for": "search",
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Walk(func(string, interface{}) bool { return true })
+	}
+}
@@ -184,7 +184,7 @@ func (r *GoMetricsRegistry) Unregister(name string) {
 	defer r.mutex.Unlock()
 
 	st := r.rmState(name)
-	r.reg.Remove(st.name)
+	_ = r.reg.Remove(st.name)
 	r.shadow.Unregister(name)
 }
 
@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package adapter
+
+import (
+	metrics "github.com/rcrowley/go-metrics"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// HistogramVec is a family of go-metrics histograms partitioned by labels.
+// Each histogram is reported like a histogram registered via
+// GoMetricsRegistry.
+type HistogramVec struct {
+	vec *monitoring.Vec[goMetricsHistogram]
+}
+
+// NewHistogramVec creates and registers a new HistogramVec with the given
+// label names. The newSample function creates the sample backing the
+// histogram for every new combination of label values.
+func NewHistogramVec(r *monitoring.Registry, name string, labels []string, newSample func() metrics.Sample, opts ...monitoring.Option) *HistogramVec {
+	vec := monitoring.NewVec(r, name, labels, func() goMetricsHistogram {
+		return goMetricsHistogram{metrics.NewHistogram(newSample())}
+	}, opts...)
+	return &HistogramVec{vec: vec}
+}
+
+// WithLabelValues returns the histogram for the given label values, creating
+// it if needed. The values must be valid, see monitoring.Vec.WithLabelValues.
+func (v *HistogramVec) WithLabelValues(values ...string) metrics.Histogram {
+	return v.vec.WithLabelValues(values...).h
+}
+
+// Delete removes the histogram for the given label values. Returns true if
+// the histogram did exist.
+func (v *HistogramVec) Delete(values ...string) bool {
+	return v.vec.Delete(values...)
+}
+
+// Reset removes all histograms from the family.
+func (v *HistogramVec) Reset() {
+	v.vec.Reset()
+}
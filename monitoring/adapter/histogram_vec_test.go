@@ -0,0 +1,47 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package adapter
+
+import (
+	"testing"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestHistogramVec(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	vec := NewHistogramVec(reg, "latency", []string{"output"}, func() metrics.Sample {
+		return metrics.NewUniformSample(100)
+	})
+
+	vec.WithLabelValues("es").Update(10)
+	vec.WithLabelValues("es").Update(20)
+	vec.WithLabelValues("logstash").Update(5)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(2), snapshot.Ints["latency.es.count"])
+	assert.Equal(t, int64(20), snapshot.Ints["latency.es.max"])
+	assert.Equal(t, int64(1), snapshot.Ints["latency.logstash.count"])
+
+	assert.True(t, vec.Delete("logstash"))
+	snapshot = monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.NotContains(t, snapshot.Ints, "latency.logstash.count")
+}
@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package adapter
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// PrometheusGatherer exposes the metric families of a prometheus.Gatherer,
+// e.g. a prometheus.Registry used by a library instrumented with
+// client_golang, as monitoring variables.
+//
+// Metric families are gathered every time the registry is visited. Labeled
+// metrics are reported as nested namespaces per label value, ordered by label
+// name and escaped with monitoring.EscapeName, like monitoring.Vec. Counters
+// are reported as integers if their value is integral, gauges and untyped
+// metrics as floats. Summaries report count, sum and their quantiles (e.g. p99
+// for the 0.99 quantile), histograms report count, sum and the cumulative
+// count per bucket upper bound, escaped like the label values, e.g.
+// `buckets.0%2E5` for 0.5.
+type PrometheusGatherer struct {
+	g prometheus.Gatherer
+}
+
+// NewPrometheusGatherer creates and registers a variable exposing all metric
+// families of the gatherer under name.
+func NewPrometheusGatherer(r *monitoring.Registry, name string, g prometheus.Gatherer, opts ...monitoring.Option) *PrometheusGatherer {
+	v := &PrometheusGatherer{g: g}
+	monitoring.NewFunc(r, name, v.Visit, opts...)
+	return v
+}
+
+// Visit gathers the metric families and reports them to the visitor. Gather
+// errors are ignored, all families gathered successfully are reported.
+func (p *PrometheusGatherer) Visit(_ monitoring.Mode, vs monitoring.Visitor) {
+	families, _ := p.g.Gather()
+
+	root := &promNode{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			node := root.child(monitoring.EscapeName(family.GetName()))
+			labels := m.GetLabel()
+			sort.Slice(labels, func(i, j int) bool {
+				return labels[i].GetName() < labels[j].GetName()
+			})
+			for _, label := range labels {
+				node = node.child(monitoring.EscapeName(label.GetValue()))
+			}
+			node.metricType = family.GetType()
+			node.metric = m
+		}
+	}
+	root.visit(vs)
+}
+
+// promNode is a namespace in the tree of gathered metrics. Nodes with
+// children are reported as namespace, even if a metric without labels
+// collides with the labeled metrics.
+type promNode struct {
+	children   map[string]*promNode
+	metricType dto.MetricType
+	metric     *dto.Metric
+}
+
+func (n *promNode) child(name string) *promNode {
+	if n.children == nil {
+		n.children = map[string]*promNode{}
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &promNode{}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *promNode) visit(vs monitoring.Visitor) {
+	if len(n.children) == 0 {
+		visitPromMetric(vs, n.metricType, n.metric)
+		return
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vs.OnRegistryStart()
+	defer vs.OnRegistryFinished()
+	for _, name := range names {
+		vs.OnKey(name)
+		n.children[name].visit(vs)
+	}
+}
+
+func visitPromMetric(vs monitoring.Visitor, typ dto.MetricType, m *dto.Metric) {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		visitPromCounter(vs, m.GetCounter().GetValue())
+	case dto.MetricType_GAUGE:
+		vs.OnFloat(m.GetGauge().GetValue())
+	case dto.MetricType_SUMMARY:
+		summary := m.GetSummary()
+		vs.OnRegistryStart()
+		defer vs.OnRegistryFinished()
+		monitoring.ReportInt(vs, "count", int64(summary.GetSampleCount()))
+		monitoring.ReportFloat(vs, "sum", summary.GetSampleSum())
+		for _, q := range summary.GetQuantile() {
+			monitoring.ReportFloat(vs, quantileName(q.GetQuantile()), q.GetValue())
+		}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		histogram := m.GetHistogram()
+		vs.OnRegistryStart()
+		defer vs.OnRegistryFinished()
+		monitoring.ReportInt(vs, "count", int64(histogram.GetSampleCount()))
+		monitoring.ReportFloat(vs, "sum", histogram.GetSampleSum())
+		monitoring.ReportNamespace(vs, "buckets", func() {
+			for _, b := range histogram.GetBucket() {
+				bound := strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)
+				monitoring.ReportInt(vs, monitoring.EscapeName(bound), int64(b.GetCumulativeCount()))
+			}
+		})
+	default:
+		vs.OnFloat(m.GetUntyped().GetValue())
+	}
+}
+
+func visitPromCounter(vs monitoring.Visitor, v float64) {
+	if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+		vs.OnInt(int64(v))
+		return
+	}
+	vs.OnFloat(v)
+}
+
+// quantileName returns the name a summary quantile is reported with, e.g. p99
+// for 0.99 and p99_9 for 0.999.
+func quantileName(q float64) string {
+	s := strconv.FormatFloat(q*100, 'f', -1, 64)
+	return "p" + strings.ReplaceAll(s, ".", "_")
+}
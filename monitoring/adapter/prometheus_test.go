@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package adapter
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestPrometheusGatherer(t *testing.T) {
+	promReg := prometheus.NewRegistry()
+
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "http_requests_total"}, []string{"method", "code"})
+	hosts := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "host_requests_total"}, []string{"host"})
+	inflight := prometheus.NewGauge(prometheus.GaugeOpts{Name: "inflight"})
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "latency_seconds", Buckets: []float64{0.1, 0.5, 1}})
+	size := prometheus.NewSummary(prometheus.SummaryOpts{Name: "size_bytes", Objectives: map[float64]float64{0.5: 0.05, 0.999: 0.0001}})
+	promReg.MustRegister(requests, hosts, inflight, latency, size)
+
+	requests.WithLabelValues("GET", "200").Add(3)
+	requests.WithLabelValues("POST", "500").Inc()
+	hosts.WithLabelValues("es.example.com").Add(2)
+	inflight.Set(2.5)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	size.Observe(10)
+
+	reg := monitoring.NewRegistry()
+	NewPrometheusGatherer(reg, "prometheus", promReg)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, map[string]int64{
+		"prometheus.http_requests_total.200.GET":            3,
+		"prometheus.http_requests_total.500.POST":           1,
+		"prometheus.host_requests_total.es%2Eexample%2Ecom": 2,
+		"prometheus.latency_seconds.count":                  2,
+		"prometheus.latency_seconds.buckets.0%2E1":          1,
+		"prometheus.latency_seconds.buckets.0%2E5":          2,
+		"prometheus.latency_seconds.buckets.1":              2,
+		"prometheus.size_bytes.count":                       1,
+	}, snapshot.Ints)
+	assert.Equal(t, map[string]float64{
+		"prometheus.inflight":            2.5,
+		"prometheus.latency_seconds.sum": 0.55,
+		"prometheus.size_bytes.sum":      10,
+		"prometheus.size_bytes.p50":      10,
+		"prometheus.size_bytes.p99_9":    10,
+	}, snapshot.Floats)
+
+	structured := monitoring.CollectStructSnapshot(reg, monitoring.Full, false)
+	prom, ok := structured["prometheus"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Contains(t, prom, "http_requests_total")
+	assert.Contains(t, prom["host_requests_total"], "es%2Eexample%2Ecom")
+	buckets := prom["latency_seconds"].(map[string]interface{})["buckets"].(map[string]interface{})
+	assert.Equal(t, int64(2), buckets["0%2E5"])
+}
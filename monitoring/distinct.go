@@ -0,0 +1,175 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// distinctPrecision is the number of hash bits used to select a
+	// HyperLogLog register. 2^12 registers give a standard error of ~1.6%.
+	distinctPrecision = 12
+	distinctRegisters = 1 << distinctPrecision
+
+	// distinctBuckets is the number of sketches a window is split into.
+	distinctBuckets = 4
+)
+
+// Distinct estimates the number of distinct string values observed, e.g.
+// unique hosts or unique error codes, using a HyperLogLog sketch. Memory usage
+// is constant, independent of the number of values observed. The estimate is
+// reported as integer gauge.
+//
+// If a window is configured, only values observed within approximately the
+// last window are counted: the window is split into 4 buckets, and the oldest
+// bucket is dropped once a new one is started, such that the estimate covers
+// between 3/4 of the window and the full window.
+type Distinct struct {
+	mu      sync.Mutex
+	seed    maphash.Seed
+	now     func() time.Time
+	window  time.Duration
+	start   time.Time // start of the current bucket
+	current int
+	buckets [][distinctRegisters]uint8
+}
+
+// NewDistinct creates and registers a new distinct count estimate. If window
+// is <= 0, all values observed since creation are counted.
+func NewDistinct(r *Registry, name string, window time.Duration, opts ...Option) *Distinct {
+	rr := r
+	if rr == nil {
+		rr = Default
+	}
+	rr.txMu.Lock()
+	defer rr.txMu.Unlock()
+
+	existingVar, r := setupMetric(r, name, opts)
+	if existingVar != nil {
+		cast, ok := existingVar.(*Distinct)
+		if ok {
+			return cast
+		} else {
+			panicErr(fmt.Errorf("variable name %s was first registered as a %T, tried to register as Distinct", name, existingVar))
+		}
+	}
+
+	v := newDistinct(window, time.Now)
+	addVar(r, name, opts, v, makeExpvar(func() string {
+		return fmt.Sprint(v.Count())
+	}))
+	return v
+}
+
+func newDistinct(window time.Duration, now func() time.Time) *Distinct {
+	n := 1
+	if window > 0 {
+		n = distinctBuckets
+	}
+	return &Distinct{
+		seed:    maphash.MakeSeed(),
+		now:     now,
+		window:  window,
+		start:   now(),
+		buckets: make([][distinctRegisters]uint8, n),
+	}
+}
+
+// Observe records a value.
+func (v *Distinct) Observe(s string) {
+	h := maphash.String(v.seed, s)
+	idx := h >> (64 - distinctPrecision)
+	rank := uint8(bits.LeadingZeros64(h<<distinctPrecision|1<<(distinctPrecision-1)) + 1)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.advance()
+	if regs := &v.buckets[v.current]; rank > regs[idx] {
+		regs[idx] = rank
+	}
+}
+
+// Count returns the estimated number of distinct values observed within the
+// window.
+func (v *Distinct) Count() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.advance()
+
+	var sum float64
+	zeros := 0
+	for i := 0; i < distinctRegisters; i++ {
+		var rank uint8
+		for b := range v.buckets {
+			rank = max(rank, v.buckets[b][i])
+		}
+		if rank == 0 {
+			zeros++
+		}
+		sum += 1 / float64(uint64(1)<<rank)
+	}
+
+	m := float64(distinctRegisters)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// Reset drops all observed values.
+func (v *Distinct) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	clear(v.buckets)
+	v.start = v.now()
+}
+
+func (v *Distinct) Visit(_ Mode, vs Visitor) {
+	vs.OnInt(v.Count())
+}
+
+// advance drops buckets that went out of the window.
+// v.mu must be held by the caller.
+func (v *Distinct) advance() {
+	if v.window <= 0 {
+		return
+	}
+
+	span := v.window / distinctBuckets
+	elapsed := int(v.now().Sub(v.start) / span)
+	if elapsed <= 0 {
+		return
+	}
+
+	for i := 0; i < min(elapsed, distinctBuckets); i++ {
+		v.current = (v.current + 1) % distinctBuckets
+		v.buckets[v.current] = [distinctRegisters]uint8{}
+	}
+	v.start = v.start.Add(time.Duration(elapsed) * span)
+}
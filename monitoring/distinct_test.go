@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistinct(t *testing.T) {
+	reg := NewRegistry()
+	v := NewDistinct(reg, "hosts", 0)
+	assert.Same(t, v, NewDistinct(reg, "hosts", 0))
+
+	assert.Equal(t, int64(0), v.Count())
+	for i := 0; i < 3; i++ {
+		v.Observe("a")
+		v.Observe("b")
+		v.Observe("c")
+	}
+	assert.Equal(t, int64(3), v.Count())
+	assert.Equal(t, map[string]int64{"hosts": 3}, CollectFlatSnapshot(reg, Full, false).Ints)
+
+	v.Reset()
+	assert.Equal(t, int64(0), v.Count())
+}
+
+func TestDistinctAccuracy(t *testing.T) {
+	for _, n := range []int{1000, 100000} {
+		v := newDistinct(0, time.Now)
+		for i := 0; i < n; i++ {
+			v.Observe("host-" + strconv.Itoa(i))
+			v.Observe("host-" + strconv.Itoa(i%10))
+		}
+		assert.InEpsilon(t, n, v.Count(), 0.05, "n=%d", n)
+	}
+}
+
+func TestDistinctWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	v := newDistinct(time.Minute, func() time.Time { return now })
+
+	v.Observe("a")
+	now = now.Add(30 * time.Second)
+	v.Observe("b")
+	assert.Equal(t, int64(2), v.Count())
+
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, int64(1), v.Count(), "a must have expired")
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, int64(0), v.Count())
+}
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// registryExpvar publishes a complete registry as a single expvar.
+type registryExpvar struct {
+	r *Registry
+}
+
+// PublishRegistryExpvar publishes the registry under the given name via
+// expvar. Unlike the PublishExpvar option, which publishes every variable
+// individually, the registry is published as one JSON document that is
+// computed on access. Variables added to or removed from the registry after
+// publishing are reflected in the published document.
+//
+// Note: expvar does not allow removal of any published variable. Panics if
+// the name is already in use.
+func PublishRegistryExpvar(name string, r *Registry) {
+	expvar.Publish(name, registryExpvar{r})
+}
+
+func (v registryExpvar) String() string {
+	b, err := json.Marshal(CollectStructSnapshot(v.r, Full, false))
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// ExpvarVar adapts an expvar.Var to the Var interface.
+type ExpvarVar struct {
+	v expvar.Var
+}
+
+// NewExpvarVar wraps an expvar.Var, such that it can be added to a registry.
+// Integers, floats and maps are reported with their native types. Other
+// variables are reported by decoding their JSON representation.
+func NewExpvarVar(v expvar.Var) *ExpvarVar {
+	return &ExpvarVar{v: v}
+}
+
+// Visit reports the current value of the expvar.
+func (v *ExpvarVar) Visit(_ Mode, vs Visitor) {
+	visitExpvar(v.v, vs)
+}
+
+// ImportExpvar adds the given expvar.Var to the registry.
+func ImportExpvar(r *Registry, name string, v expvar.Var, opts ...Option) {
+	if r == nil {
+		r = Default
+	}
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+	addVar(r, name, opts, NewExpvarVar(v), nil)
+}
+
+// ImportExpvars adds all variables currently published via expvar and
+// accepted by the filter to the registry. If filter is nil, all variables
+// are imported. Variables published by the monitoring package itself, as well
+// as `memstats` and `cmdline`, are never imported. Variables with a name
+// already in use in the registry are skipped.
+//
+// Returns the names of the imported variables.
+func ImportExpvars(r *Registry, filter func(name string) bool) []string {
+	if r == nil {
+		r = Default
+	}
+
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	var imported []string
+	expvar.Do(func(kv expvar.KeyValue) {
+		if ignoreExpvar(0, kv) {
+			return
+		}
+		if filter != nil && !filter(kv.Key) {
+			return
+		}
+		if err := r.addNames(strings.Split(kv.Key, "."), NewExpvarVar(kv.Value), r.opts); err != nil {
+			return
+		}
+		imported = append(imported, kv.Key)
+	})
+	return imported
+}
+
+func visitExpvar(v expvar.Var, vs Visitor) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		vs.OnInt(v.Value())
+	case *expvar.Float:
+		vs.OnFloat(v.Value())
+	case *expvar.String:
+		vs.OnString(v.Value())
+	case *expvar.Map:
+		vs.OnRegistryStart()
+		v.Do(func(kv expvar.KeyValue) {
+			vs.OnKey(kv.Key)
+			visitExpvar(kv.Value, vs)
+		})
+		vs.OnRegistryFinished()
+	default:
+		dec := json.NewDecoder(bytes.NewReader([]byte(v.String())))
+		dec.UseNumber()
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			vs.OnString(v.String())
+			return
+		}
+		visitJSONValue(value, vs)
+	}
+}
+
+func visitJSONValue(value interface{}, vs Visitor) {
+	switch v := value.(type) {
+	case nil:
+		vs.OnString("")
+	case bool:
+		vs.OnBool(v)
+	case string:
+		vs.OnString(v)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			vs.OnInt(i)
+			return
+		}
+		f, _ := v.Float64()
+		vs.OnFloat(f)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		vs.OnRegistryStart()
+		for _, k := range keys {
+			vs.OnKey(k)
+			visitJSONValue(v[k], vs)
+		}
+		vs.OnRegistryFinished()
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, elem := range v {
+			if s, ok := elem.(string); ok {
+				strs = append(strs, s)
+				continue
+			}
+			b, _ := json.Marshal(elem)
+			strs = append(strs, string(b))
+		}
+		vs.OnStringSlice(strs)
+	default:
+		vs.OnString(fmt.Sprint(v))
+	}
+}
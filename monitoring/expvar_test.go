@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishRegistryExpvar(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "events.total").Set(3)
+	NewString(reg, "state").Set("running")
+
+	PublishRegistryExpvar("test_published_registry", reg)
+	v := expvar.Get("test_published_registry")
+	require.NotNil(t, v)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(v.String()), &doc))
+	assert.Equal(t, map[string]interface{}{
+		"events": map[string]interface{}{"total": 3.0},
+		"state":  "running",
+	}, doc)
+
+	// the published registry must not be visited again as expvar
+	DoExpvars(func(name string, _ interface{}) {
+		assert.False(t, strings.HasPrefix(name, "test_published_registry"))
+	})
+}
+
+func TestImportExpvar(t *testing.T) {
+	m := new(expvar.Map).Init()
+	m.Add("hits", 2)
+	m.AddFloat("ratio", 0.5)
+
+	reg := NewRegistry()
+	ImportExpvar(reg, "cache", m)
+	ImportExpvar(reg, "build", expvar.Func(func() any {
+		return map[string]interface{}{"version": "1.0", "tags": []string{"a", "b"}, "debug": false}
+	}))
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{"cache.hits": 2}, snapshot.Ints)
+	assert.Equal(t, map[string]float64{"cache.ratio": 0.5}, snapshot.Floats)
+	assert.Equal(t, map[string]string{"build.version": "1.0"}, snapshot.Strings)
+	assert.Equal(t, map[string]bool{"build.debug": false}, snapshot.Bools)
+	assert.Equal(t, map[string][]string{"build.tags": {"a", "b"}}, snapshot.StringSlices)
+}
+
+func TestImportExpvars(t *testing.T) {
+	getOrCreateInt("test_import.counter").Set(7)
+
+	reg := NewRegistry()
+	imported := ImportExpvars(reg, func(name string) bool {
+		return strings.HasPrefix(name, "test_import.")
+	})
+	assert.Equal(t, []string{"test_import.counter"}, imported)
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{"test_import.counter": 7}, snapshot.Ints)
+
+	// importing again skips names already in use
+	assert.Empty(t, ImportExpvars(reg, func(name string) bool {
+		return strings.HasPrefix(name, "test_import.")
+	}))
+}
@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// FuncValue is the set of value types supported by NewFuncOf.
+type FuncValue interface {
+	int64 | uint64 | float64 | bool | string | time.Duration | time.Time
+}
+
+// NewFuncOf creates and registers a variable reporting the value returned by
+// f. The function is called every time the registry is visited, such that
+// computed values like queue depths can be exposed without maintaining an
+// additional variable.
+//
+// Durations are reported in milliseconds. Timestamps are reported in UTC
+// using TSLayout, the zero time is reported as empty string.
+//
+// Note: If the registry is configured to publish variables to expvar, the
+// variable will be available via expvars package as well, but can not be removed
+// anymore.
+func NewFuncOf[T FuncValue](r *Registry, name string, f func() T, opts ...Option) *Func {
+	visit := func(_ Mode, vs Visitor) {
+		switch v := funcValue(f()).(type) {
+		case int64:
+			vs.OnInt(v)
+		case float64:
+			vs.OnFloat(v)
+		case bool:
+			vs.OnBool(v)
+		case string:
+			vs.OnString(v)
+		}
+	}
+	return newFunc(r, name, visit, makeExpvar(func() string {
+		b, err := json.Marshal(funcValue(f()))
+		if err != nil {
+			return "null"
+		}
+		return string(b)
+	}), opts)
+}
+
+// NewUintFunc creates and registers a variable reporting the uint64 returned
+// by f.
+func NewUintFunc(r *Registry, name string, f func() uint64, opts ...Option) *Func {
+	return NewFuncOf(r, name, f, opts...)
+}
+
+// NewBoolFunc creates and registers a variable reporting the bool returned by
+// f.
+func NewBoolFunc(r *Registry, name string, f func() bool, opts ...Option) *Func {
+	return NewFuncOf(r, name, f, opts...)
+}
+
+// NewStringFunc creates and registers a variable reporting the string
+// returned by f.
+func NewStringFunc(r *Registry, name string, f func() string, opts ...Option) *Func {
+	return NewFuncOf(r, name, f, opts...)
+}
+
+// NewDurationFunc creates and registers a variable reporting the duration
+// returned by f in milliseconds.
+func NewDurationFunc(r *Registry, name string, f func() time.Duration, opts ...Option) *Func {
+	return NewFuncOf(r, name, f, opts...)
+}
+
+// NewTimestampFunc creates and registers a variable reporting the time
+// returned by f, e.g. the time of the last successful operation.
+func NewTimestampFunc(r *Registry, name string, f func() time.Time, opts ...Option) *Func {
+	return NewFuncOf(r, name, f, opts...)
+}
+
+// funcValue converts the value to the type reported to visitors.
+func funcValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case uint64:
+		// same as Uint, visitors only support signed integers
+		return int64(v & (^uint64(1 << 63)))
+	case time.Duration:
+		return v.Milliseconds()
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(TSLayout)
+	default:
+		return v
+	}
+}
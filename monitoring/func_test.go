@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"expvar"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncOf(t *testing.T) {
+	reg := NewRegistry()
+	depth := uint64(3)
+	lastSuccess := time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	NewUintFunc(reg, "queue.depth", func() uint64 { return depth })
+	NewUintFunc(reg, "queue.max", func() uint64 { return math.MaxUint64 })
+	NewBoolFunc(reg, "healthy", func() bool { return true })
+	NewStringFunc(reg, "state", func() string { return "running" })
+	NewDurationFunc(reg, "uptime", func() time.Duration { return 1500 * time.Millisecond })
+	NewTimestampFunc(reg, "last_success", func() time.Time { return lastSuccess })
+	NewTimestampFunc(reg, "last_failure", func() time.Time { return time.Time{} })
+	NewFuncOf(reg, "load", func() float64 { return 0.5 })
+	NewFuncOf(reg, "events", func() int64 { return -1 })
+
+	depth = 5
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{
+		"queue.depth": 5,
+		"queue.max":   math.MaxInt64,
+		"uptime":      1500,
+		"events":      -1,
+	}, snapshot.Ints)
+	assert.Equal(t, map[string]bool{"healthy": true}, snapshot.Bools)
+	assert.Equal(t, map[string]float64{"load": 0.5}, snapshot.Floats)
+	assert.Equal(t, map[string]string{
+		"state":        "running",
+		"last_success": "2024-05-01T10:30:00.000Z",
+		"last_failure": "",
+	}, snapshot.Strings)
+}
+
+func TestFuncOfReRegister(t *testing.T) {
+	reg := NewRegistry()
+	v := NewBoolFunc(reg, "healthy", func() bool { return true })
+	assert.Same(t, v, NewBoolFunc(reg, "healthy", func() bool { return false }))
+	assert.Panics(t, func() { NewInt(reg, "healthy") })
+}
+
+func TestFuncOfExpvar(t *testing.T) {
+	reg := NewRegistry(PublishExpvar)
+	NewDurationFunc(reg, "test_func_of_expvar", func() time.Duration { return time.Second })
+
+	v := expvar.Get("test_func_of_expvar")
+	require.NotNil(t, v)
+	assert.Equal(t, "1000", v.String())
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"path"
+	"strings"
+)
+
+// Match returns all variables and registries with a name matching the
+// pattern, keyed by their full name relative to the registry. The pattern is
+// split on `.` and every segment is matched against one level of the
+// registry using path.Match, so `*` matches any single name. The special
+// segment `**` matches any number of levels, including none.
+//
+// For example `pipeline.*.events` matches `pipeline.queue.events` and
+// `pipeline.output.events`, while `**.events` matches any `events` entry in
+// the tree. Invalid patterns do not match anything.
+func (r *Registry) Match(pattern string) map[string]Var {
+	matches := map[string]Var{}
+	r.match("", strings.Split(pattern, "."), matches)
+	return matches
+}
+
+func (r *Registry) match(prefix string, segments []string, matches map[string]Var) {
+	if len(segments) == 0 {
+		return
+	}
+
+	segment, rest := segments[0], segments[1:]
+	if segment == "**" {
+		// `**` matching no level at all
+		r.match(prefix, rest, matches)
+	}
+
+	for name, e := range r.load() {
+		fullName := name
+		if prefix != "" {
+			fullName = prefix + "." + name
+		}
+
+		if segment == "**" {
+			if len(rest) == 0 {
+				matches[fullName] = e.Var
+			}
+			// `**` matching this level and possibly more
+			if sub, ok := e.Var.(*Registry); ok {
+				sub.match(fullName, segments, matches)
+			}
+			continue
+		}
+
+		if ok, err := path.Match(segment, name); err != nil || !ok {
+			continue
+		}
+		if len(rest) == 0 {
+			matches[fullName] = e.Var
+			continue
+		}
+		if sub, ok := e.Var.(*Registry); ok {
+			sub.match(fullName, rest, matches)
+		}
+	}
+}
+
+// DoPrefix calls f for all variables in the subtree with the given name, like
+// Do. Reported names include the prefix. If the prefix names a single
+// variable, f is called for the variable only. Nothing is reported if the
+// prefix does not exist.
+func (r *Registry) DoPrefix(mode Mode, prefix string, f func(string, interface{})) {
+	names := strings.Split(prefix, ".")
+	e, err := r.findNames(names)
+	if err != nil || e.Var == nil {
+		return
+	}
+
+	vs := NewKeyValueVisitor(f)
+	vs.level = append(vs.level, names...)
+	if sub, ok := e.Var.(*Registry); ok {
+		sub.doVisit(mode, vs)
+		return
+	}
+	if e.Mode > mode {
+		return
+	}
+	e.Visit(mode, vs)
+}
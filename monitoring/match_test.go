@@ -0,0 +1,88 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryMatch(t *testing.T) {
+	reg := NewRegistry()
+	queue := NewInt(reg, "pipeline.queue.events")
+	output := NewInt(reg, "pipeline.output.events")
+	NewInt(reg, "pipeline.output.bytes")
+	nested := NewInt(reg, "inputs.tcp.conn.events")
+
+	tests := map[string]map[string]Var{
+		"pipeline.*.events": {
+			"pipeline.queue.events":  queue,
+			"pipeline.output.events": output,
+		},
+		"pipeline.out*.events": {
+			"pipeline.output.events": output,
+		},
+		"**.events": {
+			"pipeline.queue.events":  queue,
+			"pipeline.output.events": output,
+			"inputs.tcp.conn.events": nested,
+		},
+		"inputs.**.events": {
+			"inputs.tcp.conn.events": nested,
+		},
+		"pipeline.queue": {
+			"pipeline.queue": reg.GetRegistry("pipeline.queue"),
+		},
+		"pipeline.missing": {},
+		"pipeline.[":       {},
+	}
+
+	for pattern, expected := range tests {
+		t.Run(pattern, func(t *testing.T) {
+			assert.Equal(t, expected, reg.Match(pattern))
+		})
+	}
+}
+
+func TestRegistryDoPrefix(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "pipeline.queue.events", Report).Set(1)
+	NewInt(reg, "pipeline.output.events", Report).Set(2)
+	NewInt(reg, "pipeline.output.debug").Set(3)
+	NewInt(reg, "other", Report).Set(4)
+
+	collect := func(prefix string) map[string]interface{} {
+		values := map[string]interface{}{}
+		reg.DoPrefix(Reported, prefix, func(name string, v interface{}) {
+			values[name] = v
+		})
+		return values
+	}
+
+	assert.Equal(t, map[string]interface{}{
+		"pipeline.queue.events":  int64(1),
+		"pipeline.output.events": int64(2),
+	}, collect("pipeline"))
+	assert.Equal(t, map[string]interface{}{
+		"pipeline.output.events": int64(2),
+	}, collect("pipeline.output.events"))
+	assert.Empty(t, collect("pipeline.output.debug"))
+	assert.Empty(t, collect("missing"))
+	assert.Empty(t, collect("other.sub"))
+}
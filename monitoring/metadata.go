@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MetricType describes the semantics of a variable's value for exporters.
+type MetricType uint8
+
+const (
+	// TypeUnspecified is used for variables without an explicit type.
+	// Exporters apply their own defaults.
+	TypeUnspecified MetricType = iota
+
+	// TypeCounter marks a monotonically increasing value.
+	TypeCounter
+
+	// TypeGauge marks a value that can go up and down.
+	TypeGauge
+
+	// TypeInfo marks a value providing static information about the process,
+	// like a version string.
+	TypeInfo
+)
+
+var metricTypeNames = map[MetricType]string{
+	TypeUnspecified: "",
+	TypeCounter:     "counter",
+	TypeGauge:       "gauge",
+	TypeInfo:        "info",
+}
+
+// String returns the name of the metric type.
+func (t MetricType) String() string {
+	if s, ok := metricTypeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("MetricType(%d)", t)
+}
+
+// Unpack unmarshals a metric type string to a MetricType. This implements
+// ucfg.StringUnpacker.
+func (t *MetricType) Unpack(str string) error {
+	str = strings.ToLower(str)
+	for typ, name := range metricTypeNames {
+		if name == str {
+			*t = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid metric type '%v'", str)
+}
+
+// Metadata describes a variable. It is set when registering a variable via
+// the Description, Unit and Type options, and can be used by exporters to
+// annotate the exported metrics.
+type Metadata struct {
+	Description string
+	Unit        string
+	Type        MetricType
+}
+
+// Metadata returns the metadata of the variable with the given name. Returns
+// false if the variable does not exist or has been registered without
+// metadata.
+func (r *Registry) Metadata(name string) (Metadata, bool) {
+	e, err := r.find(name)
+	if err != nil || e.meta == nil {
+		return Metadata{}, false
+	}
+	return *e.meta, true
+}
+
+// CollectMetadata collects the metadata of all variables in the metrics tree
+// starting with the given registry. Names in the tree are joined with `.`.
+// Variables without metadata are not included.
+func CollectMetadata(r *Registry) map[string]Metadata {
+	if r == nil {
+		r = Default
+	}
+
+	all := map[string]Metadata{}
+	r.collectMetadata("", all)
+	return all
+}
+
+func (r *Registry) collectMetadata(prefix string, to map[string]Metadata) {
+	for name, e := range r.load() {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		if sub, ok := e.Var.(*Registry); ok {
+			sub.collectMetadata(name, to)
+			continue
+		}
+		if e.meta != nil {
+			to[name] = *e.meta
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "output.bytes", Description("Bytes written to the output"), Unit("bytes"), Type(TypeCounter))
+	NewInt(reg, "queue.filled", Type(TypeGauge))
+	NewString(reg, "version")
+	reg.AddWithMetadata("uptime", &Int{}, Full, Metadata{Unit: "ms"})
+
+	meta, ok := reg.Metadata("output.bytes")
+	require.True(t, ok)
+	assert.Equal(t, Metadata{Description: "Bytes written to the output", Unit: "bytes", Type: TypeCounter}, meta)
+
+	_, ok = reg.Metadata("version")
+	assert.False(t, ok)
+	_, ok = reg.Metadata("missing")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]Metadata{
+		"output.bytes": {Description: "Bytes written to the output", Unit: "bytes", Type: TypeCounter},
+		"queue.filled": {Type: TypeGauge},
+		"uptime":       {Unit: "ms"},
+	}, CollectMetadata(reg))
+}
+
+func TestMetadataNotInherited(t *testing.T) {
+	reg := NewRegistry()
+	sub := reg.NewRegistry("sub", Description("registry"))
+	NewInt(sub, "value")
+
+	_, ok := reg.Metadata("sub.value")
+	assert.False(t, ok)
+	assert.Empty(t, CollectMetadata(reg))
+}
+
+func TestMetricTypeUnpack(t *testing.T) {
+	var typ MetricType
+	require.NoError(t, typ.Unpack("Counter"))
+	assert.Equal(t, TypeCounter, typ)
+	assert.Equal(t, "counter", typ.String())
+	assert.Error(t, typ.Unpack("histogram"))
+}
@@ -35,7 +35,16 @@ const TSLayout = "2006-01-02T15:04:05.000Z"
 type makeExpvar func() string
 
 // Int is a 64 bit integer variable satisfying the Var interface.
-type Int struct{ i atomic.Int64 }
+//
+// If registered with the TrackStats option, the variable additionally records
+// the maximum and minimum value and the time of the last update. It is then
+// reported as namespace with the keys `value`, `max`, `min` and
+// `last_updated`.
+type Int struct {
+	i          atomic.Int64
+	stats      *intStats
+	thresholds atomic.Pointer[[]threshold[int64]]
+}
 
 // NewInt creates and registers a new integer variable.
 //
@@ -61,22 +70,59 @@ func NewInt(r *Registry, name string, opts ...Option) *Int {
 	}
 
 	v := &Int{}
+	if varOpts(r.opts, opts).trackStats {
+		v.stats = &intStats{}
+	}
 	addVar(r, name, opts, v, makeExpvar(func() string {
 		return strconv.FormatInt(v.Get(), 10)
 	}))
 	return v
 }
 
-func (v *Int) Get() int64               { return v.i.Load() }
-func (v *Int) Set(value int64)          { v.i.Store(value) }
-func (v *Int) Add(delta int64)          { v.i.Add(delta) }
-func (v *Int) Sub(delta int64)          { v.i.Add(-delta) }
-func (v *Int) Inc()                     { v.i.Add(1) }
-func (v *Int) Dec()                     { v.i.Add(-1) }
-func (v *Int) Visit(_ Mode, vs Visitor) { vs.OnInt(v.Get()) }
+func (v *Int) Get() int64      { return v.i.Load() }
+func (v *Int) Sub(delta int64) { v.Add(-delta) }
+func (v *Int) Inc()            { v.Add(1) }
+func (v *Int) Dec()            { v.Add(-1) }
+
+func (v *Int) Add(delta int64) {
+	value := v.i.Add(delta)
+	v.stats.observe(value)
+	checkThresholds(&v.thresholds, value-delta, value)
+}
+
+func (v *Int) Set(value int64) {
+	old := v.i.Swap(value)
+	v.stats.observe(value)
+	checkThresholds(&v.thresholds, old, value)
+}
+
+// OnThreshold registers a callback that is called with the new value every
+// time the variable crosses the threshold, that is, its value changes from
+// below the threshold to greater or equal to the threshold. See
+// Uint.OnThreshold.
+func (v *Int) OnThreshold(threshold int64, f func(value int64)) {
+	addThreshold(&v.thresholds, threshold, f)
+}
+
+func (v *Int) Visit(_ Mode, vs Visitor) {
+	if v.stats == nil {
+		vs.OnInt(v.Get())
+		return
+	}
+
+	vs.OnRegistryStart()
+	defer vs.OnRegistryFinished()
+	ReportInt(vs, "value", v.Get())
+	ReportInt(vs, "max", v.stats.max.Load())
+	ReportInt(vs, "min", v.stats.min.Load())
+	ReportString(vs, "last_updated", formatUpdated(v.stats.updated.Load()))
+}
 
 // Uint is a 64bit unsigned integer variable satisfying the Var interface.
-type Uint struct{ u atomic.Uint64 }
+type Uint struct {
+	u          atomic.Uint64
+	thresholds atomic.Pointer[[]threshold[uint64]]
+}
 
 // NewUint creates and registers a new unsigned integer variable.
 //
@@ -108,19 +154,51 @@ func NewUint(r *Registry, name string, opts ...Option) *Uint {
 	return v
 }
 
-func (v *Uint) Get() uint64      { return v.u.Load() }
-func (v *Uint) Set(value uint64) { v.u.Store(value) }
-func (v *Uint) Add(delta uint64) { v.u.Add(delta) }
-func (v *Uint) Sub(delta uint64) { v.u.Add(-delta) }
-func (v *Uint) Inc()             { v.u.Add(1) }
-func (v *Uint) Dec()             { v.u.Add(^uint64(0)) }
+func (v *Uint) Get() uint64 { return v.u.Load() }
+func (v *Uint) Inc()        { v.Add(1) }
+func (v *Uint) Dec()        { v.Sub(1) }
+
+func (v *Uint) Set(value uint64) {
+	old := v.u.Swap(value)
+	checkThresholds(&v.thresholds, old, value)
+}
+
+func (v *Uint) Add(delta uint64) {
+	value := v.u.Add(delta)
+	checkThresholds(&v.thresholds, value-delta, value)
+}
+
+func (v *Uint) Sub(delta uint64) {
+	value := v.u.Add(-delta)
+	checkThresholds(&v.thresholds, value+delta, value)
+}
+
+// OnThreshold registers a callback that is called with the new value every
+// time the variable crosses the threshold, that is, its value changes from
+// below the threshold to greater or equal to the threshold. Callbacks are
+// called synchronously by the goroutine updating the variable and must not
+// block. They can be used for lightweight alerting on critical failure
+// counters:
+//
+//	dropped.OnThreshold(1, func(n uint64) {
+//		logger.Errorf("events are being dropped (dropped=%d)", n)
+//	})
+func (v *Uint) OnThreshold(threshold uint64, f func(value uint64)) {
+	addThreshold(&v.thresholds, threshold, f)
+}
 func (v *Uint) Visit(_ Mode, vs Visitor) {
 	value := v.Get() & (^uint64(1 << 63))
 	vs.OnInt(int64(value))
 }
 
 // Float is a 64 bit float variable satisfying the Var interface.
-type Float struct{ f atomic.Uint64 }
+//
+// Like Int, a Float registered with the TrackStats option additionally
+// reports its maximum and minimum value and the time of the last update.
+type Float struct {
+	f     atomic.Uint64
+	stats *floatStats
+}
 
 // NewFloat creates and registers a new float variable.
 //
@@ -146,27 +224,48 @@ func NewFloat(r *Registry, name string, opts ...Option) *Float {
 	}
 
 	v := &Float{}
+	if varOpts(r.opts, opts).trackStats {
+		v.stats = &floatStats{}
+	}
 	addVar(r, name, opts, v, makeExpvar(func() string {
 		return strconv.FormatFloat(v.Get(), 'g', -1, 64)
 	}))
 	return v
 }
 
-func (v *Float) Get() float64             { return math.Float64frombits(v.f.Load()) }
-func (v *Float) Set(value float64)        { v.f.Store(math.Float64bits(value)) }
-func (v *Float) Sub(delta float64)        { v.Add(-delta) }
-func (v *Float) Visit(_ Mode, vs Visitor) { vs.OnFloat(v.Get()) }
+func (v *Float) Get() float64      { return math.Float64frombits(v.f.Load()) }
+func (v *Float) Sub(delta float64) { v.Add(-delta) }
+
+func (v *Float) Set(value float64) {
+	v.f.Store(math.Float64bits(value))
+	v.stats.observe(value)
+}
 
 func (v *Float) Add(delta float64) {
 	for {
 		cur := v.f.Load()
-		next := math.Float64bits(math.Float64frombits(cur) + delta)
-		if v.f.CompareAndSwap(cur, next) {
+		next := math.Float64frombits(cur) + delta
+		if v.f.CompareAndSwap(cur, math.Float64bits(next)) {
+			v.stats.observe(next)
 			return
 		}
 	}
 }
 
+func (v *Float) Visit(_ Mode, vs Visitor) {
+	if v.stats == nil {
+		vs.OnFloat(v.Get())
+		return
+	}
+
+	vs.OnRegistryStart()
+	defer vs.OnRegistryFinished()
+	ReportFloat(vs, "value", v.Get())
+	ReportFloat(vs, "max", v.stats.max.Get())
+	ReportFloat(vs, "min", v.stats.min.Get())
+	ReportString(vs, "last_updated", formatUpdated(v.stats.updated.Load()))
+}
+
 // Bool is a Bool variable satisfying the Var interface.
 type Bool struct{ f atomic.Bool }
 
@@ -274,6 +373,10 @@ type Func struct {
 }
 
 func NewFunc(r *Registry, name string, f func(Mode, Visitor), opts ...Option) *Func {
+	return newFunc(r, name, f, nil, opts)
+}
+
+func newFunc(r *Registry, name string, f FuncVar, ev expvar.Var, opts []Option) *Func {
 	rr := r
 	if rr == nil {
 		rr = Default
@@ -292,7 +395,7 @@ func NewFunc(r *Registry, name string, f func(Mode, Visitor), opts ...Option) *F
 	}
 
 	v := &Func{f}
-	addVar(r, name, opts, v, nil)
+	addVar(r, name, opts, v, ev)
 	return v
 }
 
@@ -386,10 +489,15 @@ func setupMetric(reg *Registry, name string, opts []Option) (Var, *Registry) {
 	if reg == nil {
 		return nil, Default
 	}
-	vis := reg.Get(name)
-	if vis == nil {
+	e, err := reg.find(name)
+	if err != nil || e.Var == nil {
 		return nil, reg
 	}
+	vis := e.Var
+
+	if varOpts(reg.opts, opts).strict {
+		panicErr(errDuplicate(fullName(reg, name), e))
+	}
 
 	// Just being overly cautious.
 	// If someone tries to re-register a variable with options, should we try to "reset"
@@ -19,6 +19,7 @@ package monitoring
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/elastic/elastic-agent-libs/config"
 )
@@ -46,7 +47,9 @@ func init() {
 	GetNamespace("stats").SetRegistry(Default)
 }
 
-var errNotFound = errors.New("name unknown")
+// ErrNotFound is returned when removing a variable that does not exist.
+var ErrNotFound = errors.New("name unknown")
+
 var errInvalidName = errors.New("name does not point to a valid variable")
 
 func VisitMode(mode Mode, vs Visitor) {
@@ -69,8 +72,8 @@ func GetRegistry(name string) *Registry {
 	return Default.GetRegistry(name)
 }
 
-func Remove(name string) {
-	Default.Remove(name)
+func Remove(name string) error {
+	return Default.Remove(name)
 }
 
 func Clear() error {
@@ -123,3 +126,36 @@ func IsBufferEnabled(monitoringCfg *config.C) bool {
 	}
 	return false
 }
+
+// EscapeName percent-encodes the '.' and '%' characters of s, such that s
+// can be used as a single segment of a variable name, e.g. a host name or an
+// IP address. Names without these characters are returned unchanged.
+func EscapeName(s string) string {
+	if !strings.ContainsAny(s, ".%") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '.':
+			b.WriteString("%2E")
+		case '%':
+			b.WriteString("%25")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+var nameUnescaper = strings.NewReplacer("%2E", ".", "%25", "%")
+
+// UnescapeName reverses EscapeName. Percent signs not followed by an encoded
+// character are kept as they are.
+func UnescapeName(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	return nameUnescaper.Replace(s)
+}
@@ -62,3 +62,19 @@ func TestIsBufferEnabled(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeName(t *testing.T) {
+	for in, escaped := range map[string]string{
+		"":              "",
+		"host":          "host",
+		"example.com":   "example%2Ecom",
+		"50%":           "50%25",
+		"%2E":           "%252E",
+		"a.b%c.d":       "a%2Eb%25c%2Ed",
+		"10.0.0.1:9200": "10%2E0%2E0%2E1:9200",
+	} {
+		assert.Equal(t, escaped, EscapeName(in))
+		assert.Equal(t, in, UnescapeName(escaped))
+	}
+	assert.Equal(t, "50%", UnescapeName("50%"))
+}
@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// NamespaceRegistry is a registry owned by a single component. All metrics of
+// the component are registered within the namespace registry, such that the
+// complete subtree can be unregistered when the component is stopped.
+type NamespaceRegistry struct {
+	*Registry
+
+	parent *Registry
+	names  []string
+	once   sync.Once
+}
+
+// NewNamespaceRegistry creates a new registry with the given name or path in
+// the Default registry. See Registry.NewNamespaceRegistry.
+func NewNamespaceRegistry(name string, opts ...Option) (*NamespaceRegistry, error) {
+	return Default.NewNamespaceRegistry(name, opts...)
+}
+
+// NewNamespaceRegistry creates a new registry with the given name or path
+// under the registry. Unlike GetOrCreateRegistry, an error is returned if the
+// name is already in use, so two components never share their metrics.
+//
+// Close must be called once the owning component is stopped.
+func (r *Registry) NewNamespaceRegistry(name string, opts ...Option) (*NamespaceRegistry, error) {
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	names := strings.Split(name, ".")
+	reg := newRegistry(fullName(r, name), applyOpts(r.opts, opts))
+	if err := r.addNames(names, reg, reg.opts); err != nil {
+		return nil, fmt.Errorf("failed to create namespace registry %v: %w", name, err)
+	}
+
+	return &NamespaceRegistry{
+		Registry: reg,
+		parent:   r,
+		names:    names,
+	}, nil
+}
+
+// Close atomically unregisters the namespace registry and all metrics within
+// it. Registries left empty are removed as well. Metrics still held by the
+// component are not reported anymore. Close only removes the namespace
+// registry if it has not been replaced in the meantime. Calling Close
+// multiple times is safe.
+func (n *NamespaceRegistry) Close() error {
+	n.once.Do(func() {
+		_ = n.parent.removeNames(n.names, n.Registry)
+	})
+	return nil
+}
@@ -0,0 +1,78 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceRegistry(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "inputs.total").Set(1)
+
+	ns, err := reg.NewNamespaceRegistry("inputs.abc")
+	require.NoError(t, err)
+	NewInt(ns.Registry, "events").Set(3)
+	NewInt(ns.Registry, "bytes").Set(5)
+
+	_, err = reg.NewNamespaceRegistry("inputs.abc")
+	assert.Error(t, err, "namespace must not be shared")
+
+	assert.Equal(t, map[string]int64{
+		"inputs.total":      1,
+		"inputs.abc.events": 3,
+		"inputs.abc.bytes":  5,
+	}, CollectFlatSnapshot(reg, Full, false).Ints)
+
+	require.NoError(t, ns.Close())
+	require.NoError(t, ns.Close())
+	assert.Equal(t, map[string]int64{"inputs.total": 1}, CollectFlatSnapshot(reg, Full, false).Ints)
+
+	// the name can be reused after close
+	ns, err = reg.NewNamespaceRegistry("inputs.abc")
+	require.NoError(t, err)
+	defer ns.Close()
+}
+
+func TestNamespaceRegistryCloseReplaced(t *testing.T) {
+	reg := NewRegistry()
+
+	old, err := reg.NewNamespaceRegistry("component")
+	require.NoError(t, err)
+	require.NoError(t, reg.Remove("component"))
+
+	replacement, err := reg.NewNamespaceRegistry("component")
+	require.NoError(t, err)
+	NewInt(replacement.Registry, "value")
+
+	require.NoError(t, old.Close())
+	assert.Same(t, replacement.Registry, reg.GetRegistry("component"))
+}
+
+func TestNamespaceRegistryRemovesEmptyParents(t *testing.T) {
+	reg := NewRegistry()
+	ns, err := reg.NewNamespaceRegistry("a.b.c")
+	require.NoError(t, err)
+	NewInt(ns.Registry, "value")
+
+	require.NoError(t, ns.Close())
+	assert.Nil(t, reg.Get("a"))
+}
@@ -23,6 +23,10 @@ type Option func(options) options
 type options struct {
 	publishExpvar bool
 	mode          Mode
+	vecLimit      int
+	trackStats    bool
+	strict        bool
+	meta          Metadata
 }
 
 var defaultOptions = options{
@@ -53,8 +57,58 @@ func DoNotReport(o options) options {
 	return o
 }
 
+// VecLimit sets the maximum number of distinct label sets tracked by a
+// metrics family. See Vec for details.
+func VecLimit(n int) Option {
+	return func(o options) options {
+		o.vecLimit = n
+		return o
+	}
+}
+
+// Strict makes registering a variable with a name already in use always fail,
+// including the New* functions, which otherwise return the existing variable
+// if it has the same type. The error reports the location the name was first
+// registered from and the location of the duplicate registration.
+func Strict(o options) options {
+	o.strict = true
+	return o
+}
+
+// TrackStats enables recording the maximum and minimum value and the time of
+// the last update for Int and Float variables.
+func TrackStats(o options) options {
+	o.trackStats = true
+	return o
+}
+
+// Description sets the human readable description of a variable.
+func Description(s string) Option {
+	return func(o options) options {
+		o.meta.Description = s
+		return o
+	}
+}
+
+// Unit sets the unit of a variable, e.g. `bytes`, `ms` or `1`.
+func Unit(s string) Option {
+	return func(o options) options {
+		o.meta.Unit = s
+		return o
+	}
+}
+
+// Type sets the metric type of a variable.
+func Type(t MetricType) Option {
+	return func(o options) options {
+		o.meta.Type = t
+		return o
+	}
+}
+
 func varOpts(regOpts *options, opts []Option) *options {
-	if regOpts != nil && len(opts) == 0 {
+	// Metadata is never inherited from the registry a variable is added to.
+	if regOpts != nil && len(opts) == 0 && regOpts.meta == (Metadata{}) {
 		return regOpts
 	}
 
@@ -62,6 +116,7 @@ func varOpts(regOpts *options, opts []Option) *options {
 	if regOpts != nil {
 		O = *regOpts
 	}
+	O.meta = Metadata{}
 
 	for _, opt := range opts {
 		O = opt(O)
@@ -69,6 +124,14 @@ func varOpts(regOpts *options, opts []Option) *options {
 	return &O
 }
 
+func (o *options) metadata() *Metadata {
+	if o.meta == (Metadata{}) {
+		return nil
+	}
+	meta := o.meta
+	return &meta
+}
+
 func applyOpts(in *options, opts []Option) *options {
 	if len(opts) == 0 {
 		return ensureOptions(in)
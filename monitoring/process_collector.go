@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-sysinfo"
+	"github.com/elastic/go-sysinfo/types"
+)
+
+// DefaultProcessCollectorPeriod is the poll interval used by
+// NewProcessCollector if no period is given.
+const DefaultProcessCollectorPeriod = 10 * time.Second
+
+// ProcessCollector periodically collects resource usage metrics of the
+// current process. The metrics are registered under `system.process`:
+//
+//   - cpu.user.ticks, cpu.system.ticks, cpu.total.ticks: CPU time in
+//     milliseconds since process start.
+//   - cpu.total.pct: CPU usage since the last poll, where 1.0 is a fully
+//     utilized core. cpu.total.norm.pct is normalized by the number of CPUs.
+//   - memory.rss.bytes, memory.virtual.bytes: resident and virtual memory.
+//   - fd.open: open file descriptors or handles, if supported by the
+//     platform.
+//   - threads: number of OS threads of the process, on Linux and Windows.
+type ProcessCollector struct {
+	proc types.Process
+
+	userTicks, systemTicks, totalTicks *Int
+	pct, normPct                       *Float
+	rss, virtual                       *Int
+	fds                                *Int
+	threads                            *Int
+
+	lastTotal time.Duration
+	lastPoll  time.Time
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// NewProcessCollector registers the process metrics under `system.process`
+// in the registry and starts polling them. If r is nil, the Default registry
+// is used. If period is <= 0, DefaultProcessCollectorPeriod is used. Stop
+// must be called to stop polling.
+func NewProcessCollector(r *Registry, period time.Duration) (*ProcessCollector, error) {
+	if r == nil {
+		r = Default
+	}
+	if period <= 0 {
+		period = DefaultProcessCollectorPeriod
+	}
+
+	proc, err := sysinfo.Self()
+	if err != nil {
+		return nil, fmt.Errorf("failed to access the current process: %w", err)
+	}
+
+	reg := r.GetOrCreateRegistry("system.process")
+	if reg == nil {
+		return nil, fmt.Errorf("system.process is already used by a variable")
+	}
+
+	c := &ProcessCollector{
+		proc:    proc,
+		rss:     NewInt(reg, "memory.rss.bytes", Unit("bytes")),
+		virtual: NewInt(reg, "memory.virtual.bytes", Unit("bytes")),
+		done:    make(chan struct{}),
+	}
+	if _, ok := proc.(types.CPUTimer); ok {
+		c.userTicks = NewInt(reg, "cpu.user.ticks", Unit("ms"), Type(TypeCounter))
+		c.systemTicks = NewInt(reg, "cpu.system.ticks", Unit("ms"), Type(TypeCounter))
+		c.totalTicks = NewInt(reg, "cpu.total.ticks", Unit("ms"), Type(TypeCounter))
+		c.pct = NewFloat(reg, "cpu.total.pct")
+		c.normPct = NewFloat(reg, "cpu.total.norm.pct")
+	}
+	if _, ok := proc.(types.OpenHandleCounter); ok {
+		c.fds = NewInt(reg, "fd.open")
+	}
+	if _, err := threadCount(); !errors.Is(err, errors.ErrUnsupported) {
+		c.threads = NewInt(reg, "threads")
+	}
+	c.collect(time.Now())
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case ts := <-ticker.C:
+				c.collect(ts)
+			}
+		}
+	}()
+	return c, nil
+}
+
+// Stop stops polling the process metrics. The metrics stay registered with
+// their last values.
+func (c *ProcessCollector) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+// collect updates all metrics. Metrics that fail to be collected keep their
+// last value.
+func (c *ProcessCollector) collect(now time.Time) {
+	if mem, err := c.proc.Memory(); err == nil {
+		c.rss.Set(int64(mem.Resident))
+		c.virtual.Set(int64(mem.Virtual))
+	}
+	if c.threads != nil {
+		if n, err := threadCount(); err == nil {
+			c.threads.Set(int64(n))
+		}
+	}
+
+	if timer, ok := c.proc.(types.CPUTimer); ok {
+		if times, err := timer.CPUTime(); err == nil {
+			total := times.User + times.System
+			c.userTicks.Set(times.User.Milliseconds())
+			c.systemTicks.Set(times.System.Milliseconds())
+			c.totalTicks.Set(total.Milliseconds())
+
+			if !c.lastPoll.IsZero() {
+				if elapsed := now.Sub(c.lastPoll); elapsed > 0 {
+					pct := float64(total-c.lastTotal) / float64(elapsed)
+					c.pct.Set(pct)
+					c.normPct.Set(pct / float64(runtime.NumCPU()))
+				}
+			}
+			c.lastTotal = total
+			c.lastPoll = now
+		}
+	}
+
+	if counter, ok := c.proc.(types.OpenHandleCounter); ok {
+		if n, err := counter.OpenHandleCount(); err == nil {
+			c.fds.Set(int64(n))
+		}
+	}
+}
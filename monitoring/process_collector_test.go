@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	reg := NewRegistry()
+	c, err := NewProcessCollector(reg, time.Hour)
+	require.NoError(t, err)
+	defer c.Stop()
+
+	// burn some CPU
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	c.collect(time.Now())
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Greater(t, snapshot.Ints["system.process.memory.rss.bytes"], int64(0))
+
+	if runtime.GOOS == "linux" || runtime.GOOS == "windows" {
+		assert.Greater(t, snapshot.Ints["system.process.threads"], int64(0))
+	}
+	if runtime.GOOS == "linux" {
+		assert.Greater(t, snapshot.Ints["system.process.cpu.total.ticks"], int64(0))
+		assert.Greater(t, snapshot.Floats["system.process.cpu.total.pct"], 0.0)
+		assert.Greater(t, snapshot.Ints["system.process.fd.open"], int64(0))
+	}
+}
+
+func TestProcessCollectorConflict(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "system.process")
+
+	_, err := NewProcessCollector(reg, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRateResolution is the interval the counter of a Rate is sampled at.
+// Samples are only recorded when the counter is visited.
+const DefaultRateResolution = 10 * time.Second
+
+// rateHorizons are the time frames the per-second rates are reported for.
+var rateHorizons = []struct {
+	name string
+	d    time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// Rate is a monotonic counter that additionally reports its moving average
+// per-second rate over the last 1, 5 and 15 minutes and over a custom
+// window. Rates are computed lazily when the counter is visited. No
+// background goroutine is required.
+//
+// A Rate is reported as namespace with the keys `total`, `1m`, `5m` and
+// `15m`, and `rate` if a window is configured. The counter value at the
+// start of a time frame is interpolated from the samples around it, so the
+// rates are correct even if the counter is visited less often than the time
+// frame. Until enough history has been recorded, a rate is computed over the
+// available history.
+type Rate struct {
+	counter atomic.Int64
+
+	mu         sync.Mutex
+	now        func() time.Time
+	window     time.Duration
+	resolution time.Duration
+	samples    []rateSample // ring buffer, oldest sample at head
+	head, size int
+}
+
+type rateSample struct {
+	ts    time.Time
+	value int64
+}
+
+// NewRate creates and registers a new rate counter. In addition to the 1m,
+// 5m and 15m rates, the per-second rate over window is reported as `rate`.
+// If window is <= 0, only the 1m, 5m and 15m rates are reported.
+func NewRate(r *Registry, name string, window time.Duration, opts ...Option) *Rate {
+	rr := r
+	if rr == nil {
+		rr = Default
+	}
+	rr.txMu.Lock()
+	defer rr.txMu.Unlock()
+
+	existingVar, r := setupMetric(r, name, opts)
+	if existingVar != nil {
+		cast, ok := existingVar.(*Rate)
+		if ok {
+			return cast
+		} else {
+			panicErr(fmt.Errorf("variable name %s was first registered as a %T, tried to register as Rate", name, existingVar))
+		}
+	}
+
+	v := newRate(window, time.Now)
+	addVar(r, name, opts, v, nil)
+	return v
+}
+
+func newRate(window time.Duration, now func() time.Time) *Rate {
+	if window < 0 {
+		window = 0
+	}
+
+	// sample short windows more often, so they cover a few samples.
+	resolution := DefaultRateResolution
+	if window > 0 && window/2 < resolution {
+		resolution = max(window/2, time.Second)
+	}
+
+	// keep enough samples to cover the longest time frame.
+	longest := max(window, rateHorizons[len(rateHorizons)-1].d)
+	return &Rate{
+		now:        now,
+		window:     window,
+		resolution: resolution,
+		samples:    make([]rateSample, int(longest/resolution)+2),
+	}
+}
+
+func (v *Rate) Get() int64      { return v.counter.Load() }
+func (v *Rate) Add(delta int64) { v.counter.Add(delta) }
+func (v *Rate) Inc()            { v.counter.Add(1) }
+
+// Rates returns the current per-second rates over the last 1, 5 and 15
+// minutes.
+func (v *Rate) Rates() (m1, m5, m15 float64) {
+	rates, _ := v.sample()
+	return rates[0], rates[1], rates[2]
+}
+
+// PerSecond returns the current per-second rate over the window passed to
+// NewRate. It returns 0 if no window is configured.
+func (v *Rate) PerSecond() float64 {
+	_, rate := v.sample()
+	return rate
+}
+
+func (v *Rate) Visit(_ Mode, vs Visitor) {
+	vs.OnRegistryStart()
+	defer vs.OnRegistryFinished()
+
+	total := v.Get()
+	rates, rate := v.sample()
+	ReportInt(vs, "total", total)
+	for i, h := range rateHorizons {
+		ReportFloat(vs, h.name, rates[i])
+	}
+	if v.window > 0 {
+		ReportFloat(vs, "rate", rate)
+	}
+}
+
+// sample records the current counter value if the resolution has passed
+// since the last sample and computes the rates for all horizons and the
+// window.
+func (v *Rate) sample() (rates []float64, rate float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	current := rateSample{ts: v.now(), value: v.Get()}
+	if v.size == 0 || current.ts.Sub(v.at(v.size-1).ts) >= v.resolution {
+		v.push(current)
+	}
+
+	rates = make([]float64, len(rateHorizons))
+	for i, h := range rateHorizons {
+		rates[i] = v.rateOver(current, h.d)
+	}
+	if v.window > 0 {
+		rate = v.rateOver(current, v.window)
+	}
+	return rates, rate
+}
+
+// rateOver computes the per-second rate over the time frame d ending at
+// current. The counter value at the start of the time frame is interpolated
+// between the last sample before and the first sample after it. If there is
+// no sample before the start, the oldest sample is used instead.
+func (v *Rate) rateOver(current rateSample, d time.Duration) float64 {
+	if v.size == 0 {
+		return 0
+	}
+
+	start := current.ts.Add(-d)
+	before := -1
+	for j := 0; j < v.size && !v.at(j).ts.After(start); j++ {
+		before = j
+	}
+
+	baseTS, baseValue := v.at(0).ts, float64(v.at(0).value)
+	if before >= 0 {
+		prev, next := v.at(before), current
+		if before+1 < v.size {
+			next = v.at(before + 1)
+		}
+		baseTS, baseValue = start, float64(prev.value)
+		if span := next.ts.Sub(prev.ts); span > 0 {
+			frac := start.Sub(prev.ts).Seconds() / span.Seconds()
+			baseValue += frac * float64(next.value-prev.value)
+		}
+	}
+
+	elapsed := current.ts.Sub(baseTS).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (float64(current.value) - baseValue) / elapsed
+}
+
+func (v *Rate) at(i int) rateSample {
+	return v.samples[(v.head+i)%len(v.samples)]
+}
+
+func (v *Rate) push(s rateSample) {
+	if v.size < len(v.samples) {
+		v.samples[(v.head+v.size)%len(v.samples)] = s
+		v.size++
+		return
+	}
+	v.samples[v.head] = s
+	v.head = (v.head + 1) % len(v.samples)
+}
@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rate := newRate(0, func() time.Time { return now })
+
+	m1, m5, m15 := rate.Rates()
+	assert.Zero(t, m1)
+	assert.Zero(t, m5)
+	assert.Zero(t, m15)
+
+	// 10 events per second for 10 minutes, sampled every 10s.
+	for i := 0; i < 60; i++ {
+		now = now.Add(10 * time.Second)
+		rate.Add(100)
+		rate.Rates()
+	}
+	m1, m5, m15 = rate.Rates()
+	assert.InDelta(t, 10, m1, 0.001)
+	assert.InDelta(t, 10, m5, 0.001)
+	assert.InDelta(t, 10, m15, 0.001)
+
+	// stop sending events for 2 minutes.
+	for i := 0; i < 12; i++ {
+		now = now.Add(10 * time.Second)
+		rate.Rates()
+	}
+	m1, m5, m15 = rate.Rates()
+	assert.Zero(t, m1)
+	assert.InDelta(t, 6, m5, 0.001)
+	assert.InDelta(t, 600.0*10/720, m15, 0.001)
+}
+
+func TestRateSparseVisits(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rate := newRate(30*time.Second, func() time.Time { return now })
+	rate.Rates()
+
+	// 10 events per second for 20 minutes, visited every 90s.
+	for i := 0; i < 14; i++ {
+		now = now.Add(90 * time.Second)
+		rate.Add(900)
+		m1, m5, m15 := rate.Rates()
+		assert.InDelta(t, 10, m1, 0.001)
+		assert.InDelta(t, 10, m5, 0.001)
+		assert.InDelta(t, 10, m15, 0.001)
+		assert.InDelta(t, 10, rate.PerSecond(), 0.001)
+	}
+
+	// no events in the last 90s.
+	now = now.Add(90 * time.Second)
+	m1, m5, m15 := rate.Rates()
+	assert.Zero(t, m1)
+	assert.InDelta(t, 10.0*210/300, m5, 0.001)
+	assert.InDelta(t, 10.0*810/900, m15, 0.001)
+	assert.Zero(t, rate.PerSecond())
+}
+
+func TestRateVisit(t *testing.T) {
+	reg := NewRegistry()
+	rate := NewRate(reg, "events", 0)
+	rate.Add(5)
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{"events.total": 5}, snapshot.Ints)
+	assert.Contains(t, snapshot.Floats, "events.1m")
+	assert.Contains(t, snapshot.Floats, "events.5m")
+	assert.Contains(t, snapshot.Floats, "events.15m")
+
+	assert.NotContains(t, snapshot.Floats, "events.rate")
+
+	assert.Same(t, rate, NewRate(reg, "events", 0))
+
+	NewRate(reg, "windowed", 30*time.Second)
+	snapshot = CollectFlatSnapshot(reg, Full, false)
+	assert.Contains(t, snapshot.Floats, "windowed.rate")
+}
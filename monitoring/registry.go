@@ -22,26 +22,42 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Registry to store variables and sub-registries.
 // When adding or retrieving variables, all names are split on the `.`-symbol and
 // intermediate registries will be generated.
+//
+// Visits iterate a read-only snapshot of the entries without holding any
+// lock, so collecting snapshots never blocks metric registration or updates.
+// The snapshot is copied at most once per visit after the entries have been
+// modified, keeping the registration of many metrics linear.
 type Registry struct {
 	// txMu is a transaction mutex for the New* functions which create new
 	// variables on a registry as they are not goroutine safe.
 	txMu sync.Mutex
-	mu   sync.RWMutex
+
+	// mu guards entries.
+	mu sync.RWMutex
 
 	name    string
 	entries map[string]entry
 
+	// snapshot is a copy of entries shared by visits, nil if outdated.
+	snapshot atomic.Pointer[map[string]entry]
+
 	opts *options
 }
 
 type entry struct {
 	Var
 	Mode
+	meta *Metadata
+
+	// caller is the location the entry was registered from. Only recorded by
+	// strict registries.
+	caller string
 }
 
 // Var interface required for every metric to implement.
@@ -51,12 +67,54 @@ type Var interface {
 
 // NewRegistry create a new empty unregistered registry
 func NewRegistry(opts ...Option) *Registry {
+	return newRegistry("", applyOpts(nil, opts))
+}
+
+func newRegistry(name string, opts *options) *Registry {
 	return &Registry{
-		opts:    applyOpts(nil, opts),
-		entries: map[string]entry{},
+		name: name,
+		opts: opts,
 	}
 }
 
+// load returns a snapshot of the current entries. The returned map must not
+// be modified. r.mu must not be held by the caller.
+func (r *Registry) load() map[string]entry {
+	if m := r.snapshot.Load(); m != nil {
+		return *m
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m := r.snapshot.Load(); m != nil {
+		return *m
+	}
+	m := make(map[string]entry, len(r.entries))
+	for k, v := range r.entries {
+		m[k] = v
+	}
+	r.snapshot.Store(&m)
+	return m
+}
+
+// lookup returns the entry with the given name.
+func (r *Registry) lookup(name string) (entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, found := r.entries[name]
+	return e, found
+}
+
+// update modifies the entries, invalidating the snapshot.
+// r.mu must be held by the caller.
+func (r *Registry) update(f func(map[string]entry)) {
+	if r.entries == nil {
+		r.entries = map[string]entry{}
+	}
+	f(r.entries)
+	r.snapshot.Store(nil)
+}
+
 func (r *Registry) Do(mode Mode, f func(string, interface{})) {
 	r.doVisit(mode, NewKeyValueVisitor(f))
 }
@@ -72,10 +130,7 @@ func (r *Registry) doVisit(mode Mode, vs Visitor) {
 	vs.OnRegistryStart()
 	defer vs.OnRegistryFinished()
 
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for key, v := range r.entries {
+	for key, v := range r.load() {
 		if _, isReg := v.Var.(*Registry); !isReg {
 			if v.Mode > mode {
 				continue
@@ -93,11 +148,7 @@ func (r *Registry) doVisit(mode Mode, vs Visitor) {
 // Deprecated: Use GetOrCreateRegistry instead, which does not panic if the
 // given name already exists.
 func (r *Registry) NewRegistry(name string, opts ...Option) *Registry {
-	v := &Registry{
-		name:    fullName(r, name),
-		opts:    applyOpts(r.opts, opts),
-		entries: map[string]entry{},
-	}
+	v := newRegistry(fullName(r, name), applyOpts(r.opts, opts))
 	r.Add(name, v, v.opts.mode)
 	return v
 }
@@ -127,12 +178,10 @@ func (r *Registry) GetRegistry(name string) *Registry {
 func (r *Registry) newRegistryChainWithLock(names []string, opts *options) *Registry {
 	cur := r
 	for _, name := range names {
-		sub := &Registry{
-			name:    fullName(cur, name),
-			opts:    opts,
-			entries: map[string]entry{},
-		}
-		cur.entries[name] = entry{sub, sub.opts.mode}
+		sub := newRegistry(fullName(cur, name), opts)
+		cur.update(func(m map[string]entry) {
+			m[name] = entry{Var: sub, Mode: sub.opts.mode}
+		})
 		cur = sub
 	}
 	return cur
@@ -167,9 +216,13 @@ func (r *Registry) getOrCreateRegistry(names []string, opts ...Option) *Registry
 	return r.newRegistryChainWithLock(names, applyOpts(r.opts, opts))
 }
 
-// Remove removes a variable or a sub-registry by name
-func (r *Registry) Remove(name string) {
-	r.removeNames(strings.Split(name, "."))
+// Remove removes a variable or a sub-registry by name. Returns an error
+// wrapping ErrNotFound if the name does not exist.
+func (r *Registry) Remove(name string) error {
+	if err := r.removeNames(strings.Split(name, "."), nil); err != nil {
+		return fmt.Errorf("failed to remove %v: %w", name, err)
+	}
+	return nil
 }
 
 // Clear removes all entries from the current registry
@@ -181,7 +234,8 @@ func (r *Registry) Clear() error {
 		return errors.New("cannot clear registry with metrics being exported via expvar")
 	}
 
-	r.entries = map[string]entry{}
+	r.entries = nil
+	r.snapshot.Store(nil)
 	return nil
 }
 
@@ -189,15 +243,26 @@ func (r *Registry) Clear() error {
 // name is already in use.
 func (r *Registry) Add(name string, v Var, m Mode) {
 	opts := r.opts
-	if m != opts.mode {
+	if m != opts.mode || opts.meta != (Metadata{}) {
 		tmp := *r.opts
 		tmp.mode = m
+		tmp.meta = Metadata{}
 		opts = &tmp
 	}
 
 	panicErr(r.addNames(strings.Split(name, "."), v, opts))
 }
 
+// AddWithMetadata adds a new variable with the given metadata to the
+// registry. The method panics if the variables name is already in use.
+func (r *Registry) AddWithMetadata(name string, v Var, m Mode, meta Metadata) {
+	tmp := *r.opts
+	tmp.mode = m
+	tmp.meta = meta
+
+	panicErr(r.addNames(strings.Split(name, "."), v, &tmp))
+}
+
 func (r *Registry) doAdd(name string, v Var, opts *options) {
 	panicErr(r.addNames(strings.Split(name, "."), v, opts))
 }
@@ -208,11 +273,20 @@ func (r *Registry) addNames(names []string, v Var, opts *options) error {
 
 	name := names[0]
 	if len(names) == 1 {
-		if _, found := r.entries[name]; found {
+		if existing, found := r.entries[name]; found {
+			if opts.strict {
+				return errDuplicate(fullName(r, name), existing)
+			}
 			return fmt.Errorf("name %v already used", name)
 		}
 
-		r.entries[name] = entry{v, opts.mode}
+		e := entry{Var: v, Mode: opts.mode, meta: opts.metadata()}
+		if opts.strict {
+			e.caller = registrationCaller()
+		}
+		r.update(func(m map[string]entry) {
+			m[name] = e
+		})
 		return nil
 	}
 
@@ -231,7 +305,9 @@ func (r *Registry) addNames(names []string, v Var, opts *options) error {
 		return err
 	}
 
-	r.entries[name] = entry{sub, sub.opts.mode}
+	r.update(func(m map[string]entry) {
+		m[name] = entry{Var: sub, Mode: sub.opts.mode}
+	})
 	return nil
 }
 
@@ -242,19 +318,16 @@ func (r *Registry) find(name string) (entry, error) {
 func (r *Registry) findNames(names []string) (entry, error) {
 	switch len(names) {
 	case 0:
-		return entry{r, r.opts.mode}, nil
+		return entry{Var: r, Mode: r.opts.mode}, nil
 	case 1:
-		r.mu.RLock()
-		defer r.mu.RUnlock()
-		return r.entries[names[0]], nil
+		e, _ := r.lookup(names[0])
+		return e, nil
 	}
 
-	r.mu.RLock()
-	next, exist := r.entries[names[0]]
-	r.mu.RUnlock()
+	next, exist := r.lookup(names[0])
 
 	if !exist {
-		return entry{}, errNotFound
+		return entry{}, ErrNotFound
 	}
 
 	if reg, ok := next.Var.(*Registry); ok {
@@ -263,15 +336,27 @@ func (r *Registry) findNames(names []string) (entry, error) {
 	return entry{}, errInvalidName
 }
 
-func (r *Registry) removeNames(names []string) {
+// removeNames removes the entry with the given path. If only is not nil, the
+// entry is only removed if it still holds the given registry. Registries left
+// empty are removed as well.
+func (r *Registry) removeNames(names []string, only *Registry) error {
 	switch len(names) {
 	case 0:
-		return
+		return ErrNotFound
 	case 1:
 		r.mu.Lock()
 		defer r.mu.Unlock()
-		delete(r.entries, names[0])
-		return
+		e, found := r.entries[names[0]]
+		if !found {
+			return ErrNotFound
+		}
+		if sub, ok := e.Var.(*Registry); only != nil && (!ok || sub != only) {
+			return ErrNotFound
+		}
+		r.update(func(m map[string]entry) {
+			delete(m, names[0])
+		})
+		return nil
 	}
 
 	r.mu.Lock()
@@ -280,19 +365,24 @@ func (r *Registry) removeNames(names []string) {
 
 	// if name does not exist => don't remove anything
 	if !exists {
-		return
+		return ErrNotFound
 	}
 
 	sub, ok := next.Var.(*Registry)
-	if ok {
-		sub.removeNames(names[1:])
-		sub.mu.RLock()
-		defer sub.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
 
-		if len(sub.entries) == 0 {
-			delete(r.entries, names[0])
-		}
+	err := sub.removeNames(names[1:], only)
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if len(sub.entries) == 0 {
+		r.update(func(m map[string]entry) {
+			delete(m, names[0])
+		})
 	}
+	return err
 }
 
 func panicErr(err error) {
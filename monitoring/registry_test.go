@@ -18,6 +18,8 @@
 package monitoring
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -157,11 +159,7 @@ func TestRegistryIter(t *testing.T) {
 }
 
 func TestGetOrCreateRegistry(t *testing.T) {
-	root := &Registry{
-		name:    "root",
-		entries: map[string]entry{},
-		opts:    &defaultOptions,
-	}
+	root := newRegistry("root", &defaultOptions)
 
 	require.Nil(t, root.GetRegistry("a.b.c"), "GetRegistry on empty registry always returns nil")
 
@@ -178,3 +176,68 @@ func TestGetOrCreateRegistry(t *testing.T) {
 	c.Add("scalar", &Int{}, Full)
 	assert.Nil(t, root.GetOrCreateRegistry("a.b.c.scalar.w.x"), "GetOrCreateRegistry should return nil if part of the path is a non-registry type")
 }
+
+func TestRegistryVisitDoesNotBlockAdd(t *testing.T) {
+	reg := NewRegistry()
+	visiting := make(chan struct{})
+	release := make(chan struct{})
+	NewFunc(reg, "slow", func(_ Mode, V Visitor) {
+		close(visiting)
+		<-release
+		V.OnInt(1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reg.Do(Full, func(string, interface{}) {})
+	}()
+
+	<-visiting
+	NewInt(reg, "added").Set(2)
+	require.NoError(t, reg.Remove("added"))
+	close(release)
+	<-done
+}
+
+func TestRegistryConcurrentAccess(t *testing.T) {
+	reg := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprintf("sub%d.value%d", i, j)
+				NewInt(reg, name).Inc()
+				assert.NoError(t, reg.Remove(name))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				CollectFlatSnapshot(reg, Full, false)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, CollectFlatSnapshot(reg, Full, false).Ints)
+}
+
+func BenchmarkRegistryNewInt(b *testing.B) {
+	names := make([]string, 10000)
+	for i := range names {
+		names[i] = fmt.Sprintf("value%d", i)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		reg := NewRegistry()
+		for _, name := range names {
+			NewInt(reg, name)
+		}
+		CollectFlatSnapshot(reg, Full, false)
+	}
+}
@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+type config struct {
+	Hosts    []string          `config:"hosts" validate:"required"`
+	Protocol string            `config:"protocol"`
+	Path     string            `config:"path"`
+	Params   map[string]string `config:"parameters"`
+	Headers  map[string]string `config:"headers"`
+	Username string            `config:"username"`
+	Password string            `config:"password"`
+	APIKey   string            `config:"api_key"`
+
+	// Index is the index or data stream the monitoring documents are
+	// written to.
+	Index string `config:"index" validate:"required"`
+
+	// ClusterUUID is the UUID of the monitored cluster the documents are
+	// associated with in Stack Monitoring.
+	ClusterUUID string `config:"cluster_uuid"`
+
+	Period  time.Duration `config:"period" validate:"positive,nonzero"`
+	Backoff backoff       `config:"backoff"`
+
+	// BufferSize is the maximum number of documents kept for re-sending
+	// while Elasticsearch is unavailable. The oldest documents are dropped
+	// first.
+	BufferSize int `config:"buffer_size" validate:"min=1"`
+
+	// Namespaces maps the monitoring namespaces to report to the document
+	// type used in Stack Monitoring.
+	Namespaces map[string]string `config:"namespaces"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration `config:"init" validate:"positive,nonzero"`
+	Max  time.Duration `config:"max" validate:"positive,nonzero"`
+}
+
+// defaultConfig reports the stats and state namespaces every 10s.
+func defaultConfig() config {
+	return config{
+		Protocol: "http",
+		Index:    ".monitoring-beats-8-mb",
+		Period:   10 * time.Second,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		BufferSize: 100,
+		Namespaces: map[string]string{
+			"stats": "beats_stats",
+			"state": "beats_state",
+		},
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *config) Validate() error {
+	if c.APIKey != "" && (c.Username != "" || c.Password != "") {
+		return errors.New("cannot set both api_key and username/password")
+	}
+	if c.Backoff.Init > c.Backoff.Max {
+		return errors.New("backoff.init must not be greater than backoff.max")
+	}
+	return nil
+}
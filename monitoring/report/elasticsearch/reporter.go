@@ -0,0 +1,337 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package elasticsearch periodically ships monitoring registry snapshots as
+// Stack Monitoring documents to an Elasticsearch cluster.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// Info describes the process whose metrics are reported.
+type Info struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Version  string `json:"version"`
+	UUID     string `json:"uuid"`
+	Hostname string `json:"host"`
+}
+
+// Reporter periodically collects snapshots of the configured namespaces and
+// bulk indexes them into Elasticsearch.
+type Reporter struct {
+	config
+	info   Info
+	logger *logp.Logger
+	client *http.Client
+	urls   []string
+
+	wg   sync.WaitGroup
+	done chan struct{}
+	stop sync.Once
+}
+
+// MakeReporter creates and starts a reporter with the given config.
+func MakeReporter(info Info, logger *logp.Logger, cfg *c.C) (*Reporter, error) {
+	config := defaultConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	logger = logger.Named("monitoring")
+	client, err := config.Transport.Client(
+		httpcommon.WithLogger(logger),
+		httpcommon.WithHeaderRoundTripper(config.Headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(config.Hosts))
+	for _, host := range config.Hosts {
+		u, err := bulkURL(config, host)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	r := &Reporter{
+		config: config,
+		info:   info,
+		logger: logger,
+		client: client,
+		urls:   urls,
+		done:   make(chan struct{}),
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.snapshotLoop()
+	}()
+	return r, nil
+}
+
+// Stop stops the reporter. Pending documents are discarded. Calling Stop more
+// than once has no effect.
+func (r *Reporter) Stop() {
+	r.stop.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+		r.client.CloseIdleConnections()
+	})
+}
+
+func (r *Reporter) snapshotLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-r.done
+		cancel()
+	}()
+
+	ticker := time.NewTicker(r.Period)
+	defer ticker.Stop()
+
+	var pending []map[string]interface{}
+	failures := 0
+	for {
+		select {
+		case <-r.done:
+			return
+		case ts := <-ticker.C:
+			pending = r.appendPending(pending, r.collect(ts))
+		}
+
+		// re-send the failed documents until they are accepted.
+		for len(pending) > 0 {
+			err := r.publish(ctx, pending)
+			if err == nil {
+				pending = nil
+				failures = 0
+				break
+			}
+
+			failures++
+			wait := r.backoff(failures)
+			r.logger.Errorf("Failed to publish %d monitoring documents, retrying in %v: %v", len(pending), wait, err)
+			select {
+			case <-r.done:
+				return
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+// appendPending adds docs to the documents pending publication. If more than
+// buffer_size documents are pending, the oldest ones are dropped.
+func (r *Reporter) appendPending(pending, docs []map[string]interface{}) []map[string]interface{} {
+	pending = append(pending, docs...)
+	if dropped := len(pending) - r.BufferSize; dropped > 0 {
+		r.logger.Warnf("Monitoring buffer is full, dropping %d monitoring documents", dropped)
+		pending = slices.Delete(pending, 0, dropped)
+	}
+	return pending
+}
+
+// backoff returns the time to wait after the given number of consecutive
+// failures: exponential, capped at backoff.max, with up to 25% of jitter.
+func (r *Reporter) backoff(failures int) time.Duration {
+	wait := r.Backoff.Init
+	for i := 1; i < failures && wait < r.Backoff.Max; i++ {
+		wait *= 2
+	}
+	wait = min(wait, r.Backoff.Max)
+	return wait - time.Duration(rand.Int64N(int64(wait)/4+1))
+}
+
+// collect builds the Stack Monitoring documents for all namespaces.
+func (r *Reporter) collect(ts time.Time) []map[string]interface{} {
+	namespaces := make([]string, 0, len(r.Namespaces))
+	for ns := range r.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	docs := make([]map[string]interface{}, 0, len(namespaces))
+	for _, ns := range namespaces {
+		snapshot := monitoring.CollectStructSnapshot(monitoring.GetNamespace(ns).GetRegistry(), monitoring.Full, false)
+		if len(snapshot) == 0 {
+			continue
+		}
+		docs = append(docs, r.makeDocument(ts, r.Namespaces[ns], ns, snapshot))
+	}
+	return docs
+}
+
+func (r *Reporter) makeDocument(ts time.Time, typ, ns string, snapshot map[string]interface{}) map[string]interface{} {
+	field := "metrics"
+	if ns == "state" {
+		field = "state"
+	}
+
+	doc := map[string]interface{}{
+		"@timestamp":  ts.UTC(),
+		"timestamp":   ts.UTC(),
+		"type":        typ,
+		"interval_ms": r.Period.Milliseconds(),
+		typ: map[string]interface{}{
+			"beat":      r.info,
+			"timestamp": ts.UTC(),
+			field:       snapshot,
+		},
+	}
+	if r.ClusterUUID != "" {
+		doc["cluster_uuid"] = r.ClusterUUID
+	}
+	return doc
+}
+
+// publish bulk indexes the documents, trying all hosts in order until one
+// accepts the request.
+func (r *Reporter) publish(ctx context.Context, docs []map[string]interface{}) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]interface{}{"create": map[string]interface{}{"_index": r.Index}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("failed to encode monitoring document: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, u := range r.urls {
+		err := r.send(ctx, u, body.Bytes())
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Reporter) send(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case r.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+base64.StdEncoding.EncodeToString([]byte(r.APIKey)))
+	case r.Username != "":
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read bulk response from %s: %w", redactURL(u), err)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("bulk request to %s failed with status %d: %s", redactURL(u), resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("failed to parse bulk response from %s: %w", redactURL(u), err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for _, status := range item {
+			if status.Status >= http.StatusMultipleChoices {
+				return fmt.Errorf("failed to index monitoring document, status %d: %s", status.Status, status.Error)
+			}
+		}
+	}
+	return errors.New("bulk request reported errors")
+}
+
+func bulkURL(config config, host string) (string, error) {
+	if !strings.Contains(host, "://") {
+		host = config.Protocol + "://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %w", host, err)
+	}
+
+	path := strings.TrimSuffix(config.Path, "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path + "/_bulk"
+
+	q := u.Query()
+	for k, v := range config.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestReporterPublishes(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.GetNamespace("test_es_reporter").SetRegistry(reg)
+	monitoring.NewInt(reg, "events.total").Set(42)
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	var lines [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer srv.Close()
+
+	info := Info{Name: "test", Type: "testbeat", Version: "1.0.0", UUID: "abc", Hostname: "host"}
+	// The dialer of the unreachable host may still log after the test
+	// finished, hence a test logger can not be used.
+	r, err := MakeReporter(info, logp.NewNopLogger(), c.MustNewConfigFrom(map[string]interface{}{
+		"hosts":        []string{"http://127.0.0.1:1", srv.URL},
+		"period":       "10ms",
+		"username":     "elastic",
+		"password":     "changeme",
+		"cluster_uuid": "cluster",
+		"parameters":   map[string]string{"pipeline": "monitoring"},
+		"namespaces":   map[string]string{"test_es_reporter": "beats_stats"},
+	}))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(lines) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	req := requests[0]
+	assert.Equal(t, "/_bulk", req.URL.Path)
+	assert.Equal(t, "monitoring", req.URL.Query().Get("pipeline"))
+	user, pass, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "elastic", user)
+	assert.Equal(t, "changeme", pass)
+
+	var action map[string]map[string]string
+	require.NoError(t, json.Unmarshal(lines[0], &action))
+	assert.Equal(t, ".monitoring-beats-8-mb", action["create"]["_index"])
+
+	var doc struct {
+		Type        string `json:"type"`
+		ClusterUUID string `json:"cluster_uuid"`
+		BeatsStats  struct {
+			Beat    Info `json:"beat"`
+			Metrics struct {
+				Events struct {
+					Total int64 `json:"total"`
+				} `json:"events"`
+			} `json:"metrics"`
+		} `json:"beats_stats"`
+	}
+	require.NoError(t, json.Unmarshal(lines[1], &doc))
+	assert.Equal(t, "beats_stats", doc.Type)
+	assert.Equal(t, "cluster", doc.ClusterUUID)
+	assert.Equal(t, info, doc.BeatsStats.Beat)
+	assert.Equal(t, int64(42), doc.BeatsStats.Metrics.Events.Total)
+}
+
+func TestReporterResendsFailedDocuments(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.GetNamespace("test_es_reporter_retry").SetRegistry(reg)
+	monitoring.NewInt(reg, "events.total").Set(1)
+
+	var mu sync.Mutex
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+	}))
+	defer srv.Close()
+
+	r, err := MakeReporter(Info{}, logptest.NewTestingLogger(t, ""), c.MustNewConfigFrom(map[string]interface{}{
+		"hosts":      []string{srv.URL},
+		"period":     "10ms",
+		"backoff":    map[string]interface{}{"init": "10ms", "max": "10ms"},
+		"namespaces": map[string]string{"test_es_reporter_retry": "beats_stats"},
+	}))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(bodies) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	r.Stop()
+	r.Stop() // stopping again must not panic
+
+	// the documents of the failed requests are sent again.
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+}
+
+func TestReporterBufferSize(t *testing.T) {
+	r := &Reporter{config: defaultConfig(), logger: logptest.NewTestingLogger(t, "")}
+	r.BufferSize = 3
+
+	doc := func(i int) map[string]interface{} { return map[string]interface{}{"i": i} }
+	pending := r.appendPending(nil, []map[string]interface{}{doc(1), doc(2)})
+	assert.Equal(t, []map[string]interface{}{doc(1), doc(2)}, pending)
+
+	pending = r.appendPending(pending, []map[string]interface{}{doc(3), doc(4)})
+	assert.Equal(t, []map[string]interface{}{doc(2), doc(3), doc(4)}, pending)
+}
+
+func TestReporterBackoff(t *testing.T) {
+	r := &Reporter{config: defaultConfig()}
+	r.Backoff.Init = time.Second
+	r.Backoff.Max = 10 * time.Second
+
+	for failures, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		wait := r.backoff(failures)
+		assert.LessOrEqual(t, wait, expected)
+		assert.GreaterOrEqual(t, wait, expected*3/4)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	_, err := MakeReporter(Info{}, logptest.NewTestingLogger(t, ""), c.MustNewConfigFrom(map[string]interface{}{
+		"hosts":    []string{"localhost:9200"},
+		"api_key":  "id:key",
+		"username": "elastic",
+	}))
+	assert.Error(t, err)
+}
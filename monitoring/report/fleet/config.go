@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fleet
+
+// Mapping copies the value or subtree at From in the collected snapshots to
+// To in the document. From starts with the name of the registry, e.g.
+// `stats.libbeat.output`.
+type Mapping struct {
+	From string `config:"from" validate:"required"`
+	To   string `config:"to" validate:"required"`
+}
+
+type dataStream struct {
+	Type      string `config:"type"`
+	Dataset   string `config:"dataset"`
+	Namespace string `config:"namespace"`
+}
+
+type config struct {
+	// Mappings are applied in order. Metrics not covered by any mapping are
+	// not included in the document.
+	Mappings []Mapping `config:"mappings"`
+
+	// DataStream configures the data_stream fields of the document. The
+	// dataset defaults to `elastic_agent.<process>`.
+	DataStream dataStream `config:"data_stream"`
+}
+
+// defaultConfig reports the stats registry as beat.stats.
+func defaultConfig() config {
+	return config{
+		Mappings: []Mapping{
+			{From: "stats", To: "beat.stats"},
+		},
+		DataStream: dataStream{
+			Type:      "metrics",
+			Namespace: "default",
+		},
+	}
+}
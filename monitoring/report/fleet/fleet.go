@@ -0,0 +1,114 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package fleet serializes monitoring registries into the metrics documents
+// expected by Fleet for Elastic Agent components.
+package fleet
+
+import (
+	"time"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Info describes the agent and component the metrics are reported for.
+type Info struct {
+	AgentID      string
+	AgentVersion string
+	Snapshot     bool
+
+	// Process is the name of the monitored process, e.g. `filebeat`.
+	Process string
+
+	ComponentID     string
+	ComponentBinary string
+}
+
+// Serializer creates Fleet metrics documents from registry snapshots.
+type Serializer struct {
+	config
+	info Info
+}
+
+// NewSerializer creates a Serializer with the given config. The config
+// settings `mappings` and `data_stream` override the defaults, which map
+// the `stats` registry to `beat.stats`.
+func NewSerializer(info Info, cfg *c.C) (*Serializer, error) {
+	config := defaultConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+	}
+	if config.DataStream.Dataset == "" {
+		config.DataStream.Dataset = "elastic_agent." + info.Process
+	}
+	return &Serializer{config: config, info: info}, nil
+}
+
+// Serialize collects snapshots of the registries, keyed by the names used
+// in the mappings, and creates the document.
+func (s *Serializer) Serialize(ts time.Time, registries map[string]*monitoring.Registry) mapstr.M {
+	snapshots := mapstr.M{}
+	for name, reg := range registries {
+		snapshots[name] = monitoring.CollectStructSnapshot(reg, monitoring.Full, false)
+	}
+
+	doc := mapstr.M{
+		"@timestamp": ts.UTC(),
+		"data_stream": mapstr.M{
+			"type":      s.DataStream.Type,
+			"dataset":   s.DataStream.Dataset,
+			"namespace": s.DataStream.Namespace,
+		},
+		"event": mapstr.M{
+			"dataset": s.DataStream.Dataset,
+		},
+		"metricset": mapstr.M{
+			"name": "stats",
+		},
+		"elastic_agent": mapstr.M{
+			"id":       s.info.AgentID,
+			"version":  s.info.AgentVersion,
+			"snapshot": s.info.Snapshot,
+			"process":  s.info.Process,
+		},
+	}
+	if s.info.ComponentID != "" {
+		doc["component"] = mapstr.M{
+			"id":     s.info.ComponentID,
+			"binary": s.info.ComponentBinary,
+		}
+	}
+
+	for _, m := range s.Mappings {
+		v, err := snapshots.GetValue(m.From)
+		if err != nil {
+			continue
+		}
+		if sub, ok := v.(map[string]interface{}); ok {
+			if len(sub) == 0 {
+				continue
+			}
+			v = mapstr.M(sub).Clone()
+		}
+		_, _ = doc.Put(m.To, v)
+	}
+	return doc
+}
@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestSerialize(t *testing.T) {
+	stats := monitoring.NewRegistry()
+	monitoring.NewInt(stats, "libbeat.output.events.acked").Set(10)
+	monitoring.NewInt(stats, "system.load.1").Set(2)
+	state := monitoring.NewRegistry()
+	monitoring.NewString(state, "service.name").Set("filebeat")
+
+	info := Info{
+		AgentID:         "agent-1",
+		AgentVersion:    "8.15.0",
+		Process:         "filebeat",
+		ComponentID:     "filestream-default",
+		ComponentBinary: "filebeat",
+	}
+	s, err := NewSerializer(info, c.MustNewConfigFrom(map[string]interface{}{
+		"mappings": []map[string]string{
+			{"from": "stats.libbeat", "to": "beat.stats.libbeat"},
+			{"from": "stats.system", "to": "system"},
+			{"from": "state.service", "to": "beat.info.service"},
+			{"from": "stats.missing", "to": "missing"},
+		},
+	}))
+	require.NoError(t, err)
+
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	doc := s.Serialize(ts, map[string]*monitoring.Registry{"stats": stats, "state": state})
+
+	assert.Equal(t, mapstr.M{
+		"@timestamp": ts,
+		"data_stream": mapstr.M{
+			"type":      "metrics",
+			"dataset":   "elastic_agent.filebeat",
+			"namespace": "default",
+		},
+		"event":     mapstr.M{"dataset": "elastic_agent.filebeat"},
+		"metricset": mapstr.M{"name": "stats"},
+		"elastic_agent": mapstr.M{
+			"id":       "agent-1",
+			"version":  "8.15.0",
+			"snapshot": false,
+			"process":  "filebeat",
+		},
+		"component": mapstr.M{
+			"id":     "filestream-default",
+			"binary": "filebeat",
+		},
+		"beat": mapstr.M{
+			"stats": mapstr.M{
+				"libbeat": mapstr.M{
+					"output": mapstr.M{
+						"events": mapstr.M{"acked": int64(10)},
+					},
+				},
+			},
+			"info": mapstr.M{
+				"service": mapstr.M{"name": "filebeat"},
+			},
+		},
+		"system": mapstr.M{
+			"load": mapstr.M{"1": int64(2)},
+		},
+	}, doc)
+}
+
+func TestSerializeDefaults(t *testing.T) {
+	stats := monitoring.NewRegistry()
+	monitoring.NewInt(stats, "events").Set(1)
+
+	s, err := NewSerializer(Info{Process: "metricbeat"}, nil)
+	require.NoError(t, err)
+	doc := s.Serialize(time.Now(), map[string]*monitoring.Registry{"stats": stats})
+
+	v, err := doc.GetValue("beat.stats.events")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+	v, err = doc.GetValue("data_stream.dataset")
+	require.NoError(t, err)
+	assert.Equal(t, "elastic_agent.metricbeat", v)
+	assert.NotContains(t, doc, "component")
+}
@@ -0,0 +1,40 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package log
+
+import (
+	"time"
+)
+
+type config struct {
+	Period     time.Duration `config:"period" validate:"positive,nonzero"`
+	Namespaces []string      `config:"namespaces"`
+
+	// Gauges lists the metrics reported with their current value instead of
+	// the delta since the last report. Names ending with `*` match all
+	// metrics with the given prefix. Names are relative to the namespace.
+	Gauges []string `config:"gauges"`
+}
+
+// defaultConfig logs the stats namespace every 30s.
+func defaultConfig() config {
+	return config{
+		Period:     30 * time.Second,
+		Namespaces: []string{"stats"},
+	}
+}
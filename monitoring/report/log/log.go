@@ -0,0 +1,200 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package log periodically logs the metrics that changed since the last
+// report.
+package log
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Reporter logs all metrics of the configured namespaces that changed during
+// the last period.
+type Reporter struct {
+	config
+	logger *logp.Logger
+	wg     sync.WaitGroup
+	done   chan struct{}
+	stop   sync.Once
+	start  time.Time
+
+	namespaces []string
+	registries map[string]*monitoring.Registry
+	gauges     monitoring.DiffOption
+}
+
+// MakeReporter creates and starts a reporter with the given config.
+func MakeReporter(logger *logp.Logger, cfg *c.C) (*Reporter, error) {
+	config := defaultConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Reporter{
+		config:     config,
+		logger:     logger.Named("monitoring"),
+		done:       make(chan struct{}),
+		start:      time.Now(),
+		registries: map[string]*monitoring.Registry{},
+		gauges:     monitoring.Gauges(config.Gauges...),
+	}
+
+	for _, ns := range config.Namespaces {
+		if _, exists := r.registries[ns]; exists {
+			continue
+		}
+		r.namespaces = append(r.namespaces, ns)
+		r.registries[ns] = monitoring.GetNamespace(ns).GetRegistry()
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.snapshotLoop()
+	}()
+	return r, nil
+}
+
+// Stop stops the reporter and logs the total values of all metrics.
+// Calling Stop more than once has no effect.
+func (r *Reporter) Stop() {
+	r.stop.Do(func() {
+		close(r.done)
+		r.wg.Wait()
+
+		r.logTotals()
+	})
+}
+
+func (r *Reporter) snapshotLoop() {
+	r.logger.Infof("Starting metrics logging every %v", r.Period)
+	defer r.logger.Infof("Stopping metrics logging.")
+
+	ticker := time.NewTicker(r.Period)
+	defer ticker.Stop()
+
+	prev := r.collect()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		curr := r.collect()
+		r.logDelta(prev, curr)
+		prev = curr
+	}
+}
+
+func (r *Reporter) collect() map[string]monitoring.FlatSnapshot {
+	snapshots := make(map[string]monitoring.FlatSnapshot, len(r.registries))
+	for ns, reg := range r.registries {
+		snapshots[ns] = monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	}
+	return snapshots
+}
+
+func (r *Reporter) logDelta(prev, curr map[string]monitoring.FlatSnapshot) {
+	metrics := mapstr.M{}
+	for _, ns := range r.namespaces {
+		delta := nonZero(prev[ns], monitoring.Diff(prev[ns], curr[ns], r.gauges))
+		addSnapshot(metrics, ns, delta)
+	}
+
+	if len(metrics) == 0 {
+		r.logger.Infof("No non-zero metrics in the last %v", r.Period)
+		return
+	}
+	r.logger.Infow("Non-zero metrics in the last "+r.Period.String(),
+		logp.Reflect("monitoring", mapstr.M{"metrics": metrics}))
+}
+
+func (r *Reporter) logTotals() {
+	metrics := mapstr.M{}
+	for ns, snapshot := range r.collect() {
+		addSnapshot(metrics, ns, snapshot)
+	}
+
+	r.logger.Infow("Total metrics",
+		logp.Reflect("monitoring", mapstr.M{
+			"metrics":     metrics,
+			"duration_ms": time.Since(r.start).Milliseconds(),
+		}))
+}
+
+// nonZero removes all zero numeric values and unchanged non-numeric values
+// from the delta.
+func nonZero(prev, delta monitoring.FlatSnapshot) monitoring.FlatSnapshot {
+	for name, v := range delta.Ints {
+		if v == 0 {
+			delete(delta.Ints, name)
+		}
+	}
+	for name, v := range delta.Floats {
+		if v == 0 {
+			delete(delta.Floats, name)
+		}
+	}
+	for name, v := range delta.Bools {
+		if p, ok := prev.Bools[name]; ok && p == v {
+			delete(delta.Bools, name)
+		}
+	}
+	for name, v := range delta.Strings {
+		if p, ok := prev.Strings[name]; ok && p == v {
+			delete(delta.Strings, name)
+		}
+	}
+	for name, v := range delta.StringSlices {
+		if p, ok := prev.StringSlices[name]; ok && slices.Equal(p, v) {
+			delete(delta.StringSlices, name)
+		}
+	}
+	return delta
+}
+
+func addSnapshot(to mapstr.M, ns string, snapshot monitoring.FlatSnapshot) {
+	put := func(name string, v interface{}) {
+		_, _ = to.Put(ns+"."+name, v)
+	}
+	for name, v := range snapshot.Ints {
+		put(name, v)
+	}
+	for name, v := range snapshot.Floats {
+		put(name, v)
+	}
+	for name, v := range snapshot.Bools {
+		put(name, v)
+	}
+	for name, v := range snapshot.Strings {
+		put(name, v)
+	}
+	for name, v := range snapshot.StringSlices {
+		put(name, v)
+	}
+}
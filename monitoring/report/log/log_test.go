@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestReporter(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.GetNamespace("test_log_reporter").SetRegistry(reg)
+	events := monitoring.NewInt(reg, "events.total")
+	filled := monitoring.NewInt(reg, "queue.filled")
+	idle := monitoring.NewInt(reg, "idle")
+	state := monitoring.NewString(reg, "state")
+
+	events.Set(10)
+	filled.Set(5)
+	idle.Set(3)
+	state.Set("starting")
+
+	logger, logs := logptest.NewTestingLoggerWithObserver(t, "")
+	r, err := MakeReporter(logger, c.MustNewConfigFrom(map[string]interface{}{
+		"period":     "1h",
+		"namespaces": []string{"test_log_reporter"},
+		"gauges":     []string{"queue.*"},
+	}))
+	require.NoError(t, err)
+
+	prev := r.collect()
+	events.Add(7)
+	state.Set("running")
+	curr := r.collect()
+	r.logDelta(prev, curr)
+
+	r.Stop()
+	r.Stop() // stopping again must not panic or log the totals again
+
+	entries := logs.FilterMessage("Non-zero metrics in the last 1h0m0s").All()
+	require.Len(t, entries, 1)
+	assert.Equal(t, mapstr.M{
+		"metrics": mapstr.M{
+			"test_log_reporter": mapstr.M{
+				"events": mapstr.M{"total": int64(7)},
+				"queue":  mapstr.M{"filled": int64(5)},
+				"state":  "running",
+			},
+		},
+	}, entries[0].ContextMap()["monitoring"])
+
+	totals := logs.FilterMessage("Total metrics").All()
+	require.Len(t, totals, 1)
+	fields, ok := totals[0].ContextMap()["monitoring"].(mapstr.M)
+	require.True(t, ok)
+	total, err := fields.GetValue("metrics.test_log_reporter.events.total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(17), total)
+}
+
+func TestReporterNoChanges(t *testing.T) {
+	monitoring.GetNamespace("test_log_reporter_empty").SetRegistry(monitoring.NewRegistry())
+
+	logger, logs := logptest.NewTestingLoggerWithObserver(t, "")
+	r, err := MakeReporter(logger, c.MustNewConfigFrom(map[string]interface{}{
+		"period":     10 * time.Millisecond,
+		"namespaces": []string{"test_log_reporter_empty"},
+	}))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return logs.FilterMessageSnippet("No non-zero metrics").Len() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	r.Stop()
+}
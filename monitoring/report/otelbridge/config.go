@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otelbridge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/match"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Kind selects the OpenTelemetry data type a registry metric is exported as.
+type Kind uint8
+
+const (
+	// Gauge exports the metric as a gauge. This is the default for metrics
+	// not matching any rule.
+	Gauge Kind = iota
+
+	// Counter exports the metric as a cumulative monotonic sum.
+	Counter
+
+	// Ignore drops the metric from the export.
+	Ignore
+)
+
+var kindNames = map[Kind]string{
+	Gauge:   "gauge",
+	Counter: "counter",
+	Ignore:  "ignore",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Unpack unmarshals a kind string to a Kind. This implements
+// ucfg.StringUnpacker.
+func (k *Kind) Unpack(str string) error {
+	str = strings.ToLower(str)
+	for kind, name := range kindNames {
+		if name == str {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid metric kind '%v'", str)
+}
+
+// Rule maps all metrics with a name matching the regular expression in
+// Match to the given Kind. The name matched is the dotted metric name
+// including the namespace, but without the configured prefix.
+type Rule struct {
+	Match match.Matcher `config:"match" validate:"required"`
+	Kind  Kind          `config:"kind"`
+}
+
+// Config configures the metrics exported by a Producer.
+type Config struct {
+	// Namespaces lists the monitoring namespaces to export. The namespace
+	// name is used as prefix for all metrics in the namespace.
+	Namespaces []string `config:"namespaces"`
+
+	// Prefix is prepended to all exported metric names.
+	Prefix string `config:"prefix"`
+
+	// Rules are evaluated in order, the first matching rule decides about the
+	// metric kind.
+	Rules []Rule `config:"rules"`
+
+	// ScopeName is the instrumentation scope name reported with the metrics.
+	ScopeName string `config:"scope_name"`
+}
+
+// DefaultConfig exports the stats namespace.
+func DefaultConfig() Config {
+	return Config{
+		Namespaces: []string{"stats"},
+		ScopeName:  "github.com/elastic/elastic-agent-libs/monitoring",
+	}
+}
+
+// kind returns the kind of the first rule matching the metric name. If no
+// rule matches, the metric type registered with the metric decides, falling
+// back to Gauge.
+func (c *Config) kind(name string, meta monitoring.Metadata) Kind {
+	for _, rule := range c.Rules {
+		if rule.Match.MatchString(name) {
+			return rule.Kind
+		}
+	}
+	if meta.Type == monitoring.TypeCounter {
+		return Counter
+	}
+	return Gauge
+}
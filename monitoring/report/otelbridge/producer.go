@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package otelbridge exports monitoring registries through the OpenTelemetry
+// metrics SDK.
+//
+// The Producer implements the SDK's metric.Producer interface. It collects a
+// snapshot of the configured registries every time the reader it is attached
+// to collects metrics. Combined with a periodic reader the registries are
+// pushed into an existing OpenTelemetry pipeline through any metric.Exporter,
+// like the OTLP exporters, which are not dependencies of this module and have
+// to be added by the application:
+//
+//	var exporter metric.Exporter // e.g. created by otlpmetricgrpc.New
+//	reader := metric.NewPeriodicReader(exporter,
+//		metric.WithProducer(otelbridge.NewProducer(otelbridge.DefaultConfig())))
+//	provider := metric.NewMeterProvider(metric.WithReader(reader))
+package otelbridge
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Producer converts monitoring registry snapshots into OpenTelemetry metrics.
+type Producer struct {
+	config     Config
+	registries []namedRegistry
+	start      time.Time
+}
+
+type namedRegistry struct {
+	name string
+	reg  *monitoring.Registry
+}
+
+var _ metric.Producer = (*Producer)(nil)
+
+// MakeProducer creates a Producer from the given configuration. Unset
+// settings default to DefaultConfig.
+func MakeProducer(cfg *c.C) (*Producer, error) {
+	config := DefaultConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+	}
+	return NewProducer(config), nil
+}
+
+// NewProducer creates a Producer exporting the namespaces of the given
+// configuration.
+func NewProducer(config Config) *Producer {
+	p := &Producer{config: config, start: time.Now()}
+	for _, ns := range config.Namespaces {
+		p.registries = append(p.registries, namedRegistry{
+			name: ns,
+			reg:  monitoring.GetNamespace(ns).GetRegistry(),
+		})
+	}
+	return p
+}
+
+// NewRegistryProducer creates a Producer exporting a single registry. The
+// Namespaces setting of the configuration is ignored.
+func NewRegistryProducer(reg *monitoring.Registry, config Config) *Producer {
+	return &Producer{
+		config:     config,
+		registries: []namedRegistry{{reg: reg}},
+		start:      time.Now(),
+	}
+}
+
+// Produce collects all metrics of the configured registries. Integer and
+// float metrics are exported as gauge or cumulative sum according to the
+// configured rules, booleans are exported as gauges with value 0 or 1. String
+// metrics are not exported. Description and unit registered with a metric are
+// exported as well.
+func (p *Producer) Produce(_ context.Context) ([]metricdata.ScopeMetrics, error) {
+	now := time.Now()
+
+	var metrics []metricdata.Metrics
+	for _, r := range p.registries {
+		snapshot := monitoring.CollectFlatSnapshot(r.reg, monitoring.Full, false)
+		meta := monitoring.CollectMetadata(r.reg)
+		for name, v := range snapshot.Ints {
+			metrics = appendMetric(p, metrics, r.name, name, meta[name], v, now)
+		}
+		for name, v := range snapshot.Floats {
+			metrics = appendMetric(p, metrics, r.name, name, meta[name], v, now)
+		}
+		for name, v := range snapshot.Bools {
+			var i int64
+			if v {
+				i = 1
+			}
+			metrics = appendMetric(p, metrics, r.name, name, meta[name], i, now)
+		}
+	}
+
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: p.config.ScopeName},
+		Metrics: metrics,
+	}}, nil
+}
+
+func appendMetric[N int64 | float64](p *Producer, metrics []metricdata.Metrics, ns, name string, meta monitoring.Metadata, value N, now time.Time) []metricdata.Metrics {
+	if ns != "" {
+		name = ns + "." + name
+	}
+
+	var data metricdata.Aggregation
+	switch p.config.kind(name, meta) {
+	case Ignore:
+		return metrics
+	case Counter:
+		data = metricdata.Sum[N]{
+			DataPoints:  []metricdata.DataPoint[N]{{StartTime: p.start, Time: now, Value: value}},
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+		}
+	default:
+		data = metricdata.Gauge[N]{
+			DataPoints: []metricdata.DataPoint[N]{{Time: now, Value: value}},
+		}
+	}
+
+	if p.config.Prefix != "" {
+		name = strings.TrimSuffix(p.config.Prefix, ".") + "." + name
+	}
+	return append(metrics, metricdata.Metrics{
+		Name:        name,
+		Description: meta.Description,
+		Unit:        meta.Unit,
+		Data:        data,
+	})
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otelbridge
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	c "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestProducer(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.NewInt(reg, "events.total").Set(42)
+	monitoring.NewInt(reg, "queue.filled").Set(3)
+	monitoring.NewFloat(reg, "load").Set(0.5)
+	monitoring.NewBool(reg, "healthy").Set(true)
+	monitoring.NewString(reg, "version").Set("1.0.0")
+	monitoring.NewInt(reg, "internal.debug").Set(1)
+
+	cfg := c.MustNewConfigFrom(map[string]interface{}{
+		"prefix": "agent",
+		"rules": []map[string]interface{}{
+			{"match": `^events\.`, "kind": "counter"},
+			{"match": `^internal\.`, "kind": "ignore"},
+		},
+	})
+	config := DefaultConfig()
+	require.NoError(t, cfg.Unpack(&config))
+
+	reader := metric.NewManualReader(metric.WithProducer(NewRegistryProducer(reg, config)))
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	got := map[string]metricdata.Aggregation{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		got[m.Name] = m.Data
+	}
+	assert.Len(t, got, 4)
+
+	sum, ok := got["agent.events.total"].(metricdata.Sum[int64])
+	require.True(t, ok, "events.total must be a counter")
+	assert.True(t, sum.IsMonotonic)
+	assert.Equal(t, metricdata.CumulativeTemporality, sum.Temporality)
+	assert.Equal(t, int64(42), sum.DataPoints[0].Value)
+
+	gauge, ok := got["agent.queue.filled"].(metricdata.Gauge[int64])
+	require.True(t, ok, "queue.filled must be a gauge")
+	assert.Equal(t, int64(3), gauge.DataPoints[0].Value)
+
+	fgauge, ok := got["agent.load"].(metricdata.Gauge[float64])
+	require.True(t, ok, "load must be a float gauge")
+	assert.Equal(t, 0.5, fgauge.DataPoints[0].Value)
+
+	bgauge, ok := got["agent.healthy"].(metricdata.Gauge[int64])
+	require.True(t, ok, "healthy must be a gauge")
+	assert.Equal(t, int64(1), bgauge.DataPoints[0].Value)
+}
+
+func TestProducerMetadata(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	monitoring.NewInt(reg, "output.bytes",
+		monitoring.Description("Bytes written"), monitoring.Unit("By"), monitoring.Type(monitoring.TypeCounter)).Set(10)
+	monitoring.NewInt(reg, "output.ignored", monitoring.Type(monitoring.TypeCounter)).Set(1)
+
+	cfg := c.MustNewConfigFrom(map[string]interface{}{
+		"rules": []map[string]interface{}{
+			{"match": `ignored$`, "kind": "gauge"},
+		},
+	})
+	config := DefaultConfig()
+	require.NoError(t, cfg.Unpack(&config))
+
+	scopes, err := NewRegistryProducer(reg, config).Produce(context.Background())
+	require.NoError(t, err)
+	require.Len(t, scopes, 1)
+	require.Len(t, scopes[0].Metrics, 2)
+
+	bytes := scopes[0].Metrics[0]
+	assert.Equal(t, "output.bytes", bytes.Name)
+	assert.Equal(t, "Bytes written", bytes.Description)
+	assert.Equal(t, "By", bytes.Unit)
+	assert.IsType(t, metricdata.Sum[int64]{}, bytes.Data)
+
+	ignored := scopes[0].Metrics[1]
+	assert.Equal(t, "output.ignored", ignored.Name)
+	assert.IsType(t, metricdata.Gauge[int64]{}, ignored.Data, "rules take precedence over the metric type")
+}
+
+func TestKindUnpack(t *testing.T) {
+	var k Kind
+	require.NoError(t, k.Unpack("Counter"))
+	assert.Equal(t, Counter, k)
+	assert.Error(t, k.Unpack("histogram"))
+}
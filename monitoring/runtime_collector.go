@@ -0,0 +1,195 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"math"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRuntimeCollectorPeriod is the poll interval used by
+// NewRuntimeCollector if no period is given.
+const DefaultRuntimeCollectorPeriod = 10 * time.Second
+
+// runtimeQuantiles are the quantiles reported for runtime histograms.
+var runtimeQuantiles = []struct {
+	name string
+	q    float64
+}{
+	{"p50", 0.5},
+	{"p90", 0.9},
+	{"p99", 0.99},
+}
+
+// RuntimeCollector periodically reads all metrics supported by the Go
+// runtime/metrics package into a registry.
+//
+// A metric name like `/gc/heap/allocs:bytes` is reported as
+// `gc.heap.allocs_bytes`. The unit is always appended, such that metrics like
+// `/sched/goroutines:goroutines` (`sched.goroutines_goroutines`) do not
+// collide with namespaces like `/sched/goroutines/running:goroutines`
+// (`sched.goroutines.running_goroutines`). Histograms, e.g. GC pauses or
+// scheduling latencies, are reported as namespace with the total count and the
+// p50, p90 and p99 quantiles since process start.
+type RuntimeCollector struct {
+	samples []metrics.Sample
+	vars    []runtimeVar
+
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+type runtimeVar struct {
+	i         *Int
+	f         *Float
+	count     *Int
+	quantiles []*Float
+}
+
+// NewRuntimeCollector registers all supported runtime metrics with the
+// registry and starts polling them. If r is nil, the registry of the
+// `runtime` namespace is used. If period is <= 0,
+// DefaultRuntimeCollectorPeriod is used. Stop must be called to stop
+// polling.
+func NewRuntimeCollector(r *Registry, period time.Duration) *RuntimeCollector {
+	if r == nil {
+		r = GetNamespace("runtime").GetRegistry()
+	}
+	if period <= 0 {
+		period = DefaultRuntimeCollectorPeriod
+	}
+
+	c := &RuntimeCollector{done: make(chan struct{})}
+	for _, d := range metrics.All() {
+		name := runtimeMetricName(d.Name)
+		if r.Get(name) != nil {
+			continue
+		}
+
+		opts := []Option{Description(d.Description)}
+		if d.Cumulative && d.Kind != metrics.KindFloat64Histogram {
+			opts = append(opts, Type(TypeCounter))
+		}
+
+		var v runtimeVar
+		switch d.Kind {
+		case metrics.KindUint64:
+			v.i = NewInt(r, name, opts...)
+		case metrics.KindFloat64:
+			v.f = NewFloat(r, name, opts...)
+		case metrics.KindFloat64Histogram:
+			v.count = NewInt(r, name+".count", Description(d.Description), Type(TypeCounter))
+			for _, q := range runtimeQuantiles {
+				v.quantiles = append(v.quantiles, NewFloat(r, name+"."+q.name))
+			}
+		default:
+			continue
+		}
+		c.samples = append(c.samples, metrics.Sample{Name: d.Name})
+		c.vars = append(c.vars, v)
+	}
+	c.collect()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.done:
+				return
+			case <-ticker.C:
+				c.collect()
+			}
+		}
+	}()
+	return c
+}
+
+// Stop stops polling the runtime metrics. The metrics stay registered with
+// their last values.
+func (c *RuntimeCollector) Stop() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+func (c *RuntimeCollector) collect() {
+	metrics.Read(c.samples)
+	for i, s := range c.samples {
+		v := c.vars[i]
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v.i.Set(int64(s.Value.Uint64() & (^uint64(1 << 63))))
+		case metrics.KindFloat64:
+			v.f.Set(s.Value.Float64())
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			var count uint64
+			for _, n := range h.Counts {
+				count += n
+			}
+			v.count.Set(int64(count & (^uint64(1 << 63))))
+			for j, q := range runtimeQuantiles {
+				v.quantiles[j].Set(histogramQuantile(h, count, q.q))
+			}
+		}
+	}
+}
+
+// histogramQuantile estimates the quantile as the upper bound of the bucket
+// the quantile falls into. Infinite bounds are replaced by the finite bound
+// of the bucket.
+func histogramQuantile(h *metrics.Float64Histogram, count uint64, q float64) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(count)))
+	var seen uint64
+	for i, n := range h.Counts {
+		seen += n
+		if seen < rank || n == 0 {
+			continue
+		}
+		bound := h.Buckets[i+1]
+		if math.IsInf(bound, 0) {
+			bound = h.Buckets[i]
+		}
+		return bound
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// runtimeMetricName converts a runtime/metrics name to a registry name.
+func runtimeMetricName(name string) string {
+	name, unit, _ := strings.Cut(strings.TrimPrefix(name, "/"), ":")
+	segments := strings.Split(name, "/")
+	unit = strings.ReplaceAll(unit, "-", "_")
+	for i, s := range segments {
+		segments[i] = strings.ReplaceAll(s, "-", "_")
+	}
+	if unit != "" {
+		segments[len(segments)-1] += "_" + unit
+	}
+	return strings.Join(segments, ".")
+}
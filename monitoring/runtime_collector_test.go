@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeCollector(t *testing.T) {
+	reg := NewRegistry()
+	c := NewRuntimeCollector(reg, 0)
+	defer c.Stop()
+
+	runtime.GC()
+	c.collect()
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Greater(t, snapshot.Ints["sched.goroutines_goroutines"], int64(0))
+	assert.Greater(t, snapshot.Ints["gc.heap.allocs_bytes"], int64(0))
+	assert.Greater(t, snapshot.Ints["sched.pauses.total.gc_seconds.count"], int64(0))
+	assert.Contains(t, snapshot.Floats, "sched.pauses.total.gc_seconds.p99")
+
+	meta, ok := reg.Metadata("gc.heap.allocs_bytes")
+	assert.True(t, ok)
+	assert.Equal(t, TypeCounter, meta.Type)
+	assert.NotEmpty(t, meta.Description)
+}
+
+func TestRuntimeMetricName(t *testing.T) {
+	tests := map[string]string{
+		"/gc/heap/allocs:bytes":             "gc.heap.allocs_bytes",
+		"/sched/goroutines:goroutines":      "sched.goroutines_goroutines",
+		"/cpu/classes/gc/total:cpu-seconds": "cpu.classes.gc.total_cpu_seconds",
+		"/gc/stack/starting-size:bytes":     "gc.stack.starting_size_bytes",
+	}
+	for in, expected := range tests {
+		assert.Equal(t, expected, runtimeMetricName(in))
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	h := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 4, 1},
+		Buckets: []float64{math.Inf(-1), 1, 2, math.Inf(1)},
+	}
+	assert.Equal(t, 1.0, histogramQuantile(h, 10, 0.5))
+	assert.Equal(t, 2.0, histogramQuantile(h, 10, 0.9))
+	assert.Equal(t, 2.0, histogramQuantile(h, 10, 0.99))
+	assert.Equal(t, 0.0, histogramQuantile(h, 0, 0.5))
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import "strings"
+
+// DiffOption configures how Diff computes deltas.
+type DiffOption func(*diffOptions)
+
+type diffOptions struct {
+	isGauge func(name string) bool
+}
+
+// Gauges marks the metrics with the given names as gauges. A name ending with
+// `*` marks all metrics starting with the given prefix as gauges.
+func Gauges(names ...string) DiffOption {
+	exact := map[string]struct{}{}
+	var prefixes []string
+	for _, name := range names {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+		exact[name] = struct{}{}
+	}
+
+	return GaugeFunc(func(name string) bool {
+		if _, ok := exact[name]; ok {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// GaugeFunc sets a function deciding if a metric is a gauge. Multiple gauge
+// options are combined, a metric is a gauge if any option selects it.
+func GaugeFunc(f func(name string) bool) DiffOption {
+	return func(o *diffOptions) {
+		if prev := o.isGauge; prev != nil {
+			o.isGauge = func(name string) bool { return prev(name) || f(name) }
+			return
+		}
+		o.isGauge = f
+	}
+}
+
+// Diff computes the change of all metrics between two snapshots.
+//
+// Integer and float metrics are treated as counters, unless marked as gauge
+// via the Gauges or GaugeFunc options. The difference curr - prev is reported
+// for counters. If a counter is not present in prev, or has decreased since
+// (e.g. because it was reset), its current value is reported instead. Gauges,
+// bools, strings and string slices are passed through with their current
+// values. Metrics not present in curr are not reported.
+func Diff(prev, curr FlatSnapshot, opts ...DiffOption) FlatSnapshot {
+	var o diffOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	isGauge := o.isGauge
+	if isGauge == nil {
+		isGauge = func(string) bool { return false }
+	}
+
+	delta := MakeFlatSnapshot()
+	for name, v := range curr.Ints {
+		if p, ok := prev.Ints[name]; ok && !isGauge(name) && v >= p {
+			v -= p
+		}
+		delta.Ints[name] = v
+	}
+	for name, v := range curr.Floats {
+		if p, ok := prev.Floats[name]; ok && !isGauge(name) && v >= p {
+			v -= p
+		}
+		delta.Floats[name] = v
+	}
+	for name, v := range curr.Bools {
+		delta.Bools[name] = v
+	}
+	for name, v := range curr.Strings {
+		delta.Strings[name] = v
+	}
+	for name, v := range curr.StringSlices {
+		delta.StringSlices[name] = v
+	}
+	return delta
+}
@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	prev := MakeFlatSnapshot()
+	prev.Ints["events.total"] = 10
+	prev.Ints["events.reset"] = 50
+	prev.Ints["queue.filled"] = 7
+	prev.Ints["removed"] = 3
+	prev.Floats["cpu.total"] = 1.5
+	prev.Floats["system.load"] = 2
+
+	curr := MakeFlatSnapshot()
+	curr.Ints["events.total"] = 25
+	curr.Ints["events.reset"] = 5
+	curr.Ints["events.new"] = 4
+	curr.Ints["queue.filled"] = 3
+	curr.Floats["cpu.total"] = 2
+	curr.Floats["system.load"] = 1.5
+	curr.Bools["healthy"] = true
+	curr.Strings["state"] = "running"
+	curr.StringSlices["names"] = []string{"a"}
+
+	delta := Diff(prev, curr, Gauges("queue.filled", "system.*"))
+
+	assert.Equal(t, map[string]int64{
+		"events.total": 15,
+		"events.reset": 5,
+		"events.new":   4,
+		"queue.filled": 3,
+	}, delta.Ints)
+	assert.Equal(t, map[string]float64{
+		"cpu.total":   0.5,
+		"system.load": 1.5,
+	}, delta.Floats)
+	assert.Equal(t, curr.Bools, delta.Bools)
+	assert.Equal(t, curr.Strings, delta.Strings)
+	assert.Equal(t, curr.StringSlices, delta.StringSlices)
+}
+
+func TestDiffGaugeFuncCombined(t *testing.T) {
+	prev := MakeFlatSnapshot()
+	prev.Ints["a"] = 1
+	prev.Ints["b"] = 1
+	prev.Ints["c"] = 1
+
+	curr := MakeFlatSnapshot()
+	curr.Ints["a"] = 2
+	curr.Ints["b"] = 2
+	curr.Ints["c"] = 2
+
+	delta := Diff(prev, curr, Gauges("a"), GaugeFunc(func(name string) bool { return name == "b" }))
+	assert.Equal(t, map[string]int64{"a": 2, "b": 2, "c": 1}, delta.Ints)
+}
@@ -0,0 +1,263 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// WriteJSON writes a structured snapshot of the metrics tree starting with
+// the registry to w. The document written is equivalent to the JSON encoding
+// of CollectStructSnapshot, but is streamed to the writer without building
+// intermediate maps. Empty namespaces are omitted and keys are sorted.
+// Floats that can not be represented in JSON (NaN, ±Inf) are written as null.
+func (r *Registry) WriteJSON(w io.Writer, mode Mode) error {
+	vs := newJSONVisitor(w)
+	vs.OnRegistryStart()
+	vs.open()
+	r.writeJSONEntries(mode, vs)
+	vs.OnRegistryFinished()
+	return vs.flush()
+}
+
+func (r *Registry) writeJSONEntries(mode Mode, vs *jsonVisitor) {
+	entries := r.load()
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if vs.err != nil {
+			return
+		}
+
+		e := entries[name]
+		if sub, ok := e.Var.(*Registry); ok {
+			vs.OnKey(name)
+			vs.OnRegistryStart()
+			sub.writeJSONEntries(mode, vs)
+			vs.OnRegistryFinished()
+			continue
+		}
+		if e.Mode > mode {
+			continue
+		}
+		vs.OnKey(name)
+		e.Visit(mode, vs)
+	}
+}
+
+// jsonVisitor writes the visited values as JSON document. Objects are only
+// opened once the first value is written into them, such that empty
+// namespaces are not written.
+type jsonVisitor struct {
+	w      *bufio.Writer
+	err    error
+	buf    []byte
+	key    string
+	frames []jsonFrame
+}
+
+type jsonFrame struct {
+	key    string
+	opened bool
+	fields int
+}
+
+func newJSONVisitor(w io.Writer) *jsonVisitor {
+	return &jsonVisitor{w: bufio.NewWriter(w)}
+}
+
+func (vs *jsonVisitor) OnRegistryStart() {
+	vs.frames = append(vs.frames, jsonFrame{key: vs.key})
+}
+
+func (vs *jsonVisitor) OnRegistryFinished() {
+	last := len(vs.frames) - 1
+	if vs.frames[last].opened {
+		vs.writeByte('}')
+	}
+	vs.frames = vs.frames[:last]
+}
+
+func (vs *jsonVisitor) OnKey(s string) {
+	vs.key = s
+}
+
+func (vs *jsonVisitor) OnString(s string) {
+	vs.field()
+	vs.buf = appendJSONString(vs.buf[:0], s)
+	vs.write(vs.buf)
+}
+
+func (vs *jsonVisitor) OnBool(b bool) {
+	vs.field()
+	vs.buf = strconv.AppendBool(vs.buf[:0], b)
+	vs.write(vs.buf)
+}
+
+func (vs *jsonVisitor) OnInt(i int64) {
+	vs.field()
+	vs.buf = strconv.AppendInt(vs.buf[:0], i, 10)
+	vs.write(vs.buf)
+}
+
+func (vs *jsonVisitor) OnFloat(f float64) {
+	vs.field()
+	vs.buf = appendJSONFloat(vs.buf[:0], f)
+	vs.write(vs.buf)
+}
+
+func (vs *jsonVisitor) OnStringSlice(strs []string) {
+	vs.field()
+	vs.buf = append(vs.buf[:0], '[')
+	for i, s := range strs {
+		if i > 0 {
+			vs.buf = append(vs.buf, ',')
+		}
+		vs.buf = appendJSONString(vs.buf, s)
+	}
+	vs.buf = append(vs.buf, ']')
+	vs.write(vs.buf)
+}
+
+// open writes the object start of all frames not yet opened.
+func (vs *jsonVisitor) open() {
+	for i := range vs.frames {
+		frame := &vs.frames[i]
+		if frame.opened {
+			continue
+		}
+		if i > 0 {
+			vs.writeKey(&vs.frames[i-1], frame.key)
+		}
+		vs.writeByte('{')
+		frame.opened = true
+	}
+}
+
+// field prepares writing a value for the current key.
+func (vs *jsonVisitor) field() {
+	vs.open()
+	vs.writeKey(&vs.frames[len(vs.frames)-1], vs.key)
+}
+
+func (vs *jsonVisitor) writeKey(frame *jsonFrame, key string) {
+	vs.buf = vs.buf[:0]
+	if frame.fields > 0 {
+		vs.buf = append(vs.buf, ',')
+	}
+	frame.fields++
+	vs.buf = appendJSONString(vs.buf, key)
+	vs.buf = append(vs.buf, ':')
+	vs.write(vs.buf)
+}
+
+func (vs *jsonVisitor) write(b []byte) {
+	if vs.err == nil {
+		_, vs.err = vs.w.Write(b)
+	}
+}
+
+func (vs *jsonVisitor) writeByte(b byte) {
+	if vs.err == nil {
+		vs.err = vs.w.WriteByte(b)
+	}
+}
+
+func (vs *jsonVisitor) flush() error {
+	if vs.err != nil {
+		return vs.err
+	}
+	return vs.w.Flush()
+}
+
+// appendJSONFloat formats floats the same way encoding/json does.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(b, "null"...)
+	}
+
+	abs := math.Abs(f)
+	fmt := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		fmt = 'e'
+	}
+	b = strconv.AppendFloat(b, f, fmt, -1, 64)
+	if fmt == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString appends the quoted and escaped string. Invalid UTF-8 is
+// replaced with the unicode replacement character.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `�`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
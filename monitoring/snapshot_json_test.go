@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWriteJSON(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "events.total").Set(42)
+	NewFloat(reg, "load.1").Set(0.25)
+	NewFloat(reg, "load.tiny").Set(1e-9)
+	NewBool(reg, "healthy").Set(true)
+	NewString(reg, "name").Set("quote\" backslash\\ newline\n\x01 ü")
+	NewFunc(reg, "tags", func(_ Mode, V Visitor) {
+		V.OnRegistryStart()
+		defer V.OnRegistryFinished()
+		ReportStringSlice(V, "names", []string{"a", "b"})
+	})
+	NewInt(reg, "reported", Report)
+	reg.NewRegistry("empty.nested")
+	vec := NewIntVec(reg, "requests", []string{"code"})
+	vec.WithLabelValues("200").Set(3)
+
+	for _, mode := range []Mode{Reported, Full} {
+		var buf bytes.Buffer
+		require.NoError(t, reg.WriteJSON(&buf, mode))
+		require.True(t, json.Valid(buf.Bytes()), buf.String())
+
+		expected, err := json.Marshal(CollectStructSnapshot(reg, mode, false))
+		require.NoError(t, err)
+		assert.JSONEq(t, string(expected), buf.String())
+	}
+}
+
+func TestRegistryWriteJSONEmpty(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewRegistry("a.b")
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteJSON(&buf, Full))
+	assert.Equal(t, "{}", buf.String())
+}
+
+func TestRegistryWriteJSONFloats(t *testing.T) {
+	reg := NewRegistry()
+	NewFloat(reg, "nan").Set(math.NaN())
+	NewFloat(reg, "big").Set(1e22)
+
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteJSON(&buf, Full))
+	assert.Equal(t, `{"big":1e+22,"nan":null}`, buf.String())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+func TestRegistryWriteJSONError(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "value")
+	assert.Error(t, reg.WriteJSON(failingWriter{}, Full))
+}
@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// intStats records the value range of an Int registered with TrackStats.
+type intStats struct {
+	max, min atomic.Int64
+	updated  atomic.Int64 // unix nanoseconds of the last update
+}
+
+func (s *intStats) observe(value int64) {
+	if s == nil {
+		return
+	}
+	for {
+		cur := s.max.Load()
+		if value <= cur || s.max.CompareAndSwap(cur, value) {
+			break
+		}
+	}
+	for {
+		cur := s.min.Load()
+		if value >= cur || s.min.CompareAndSwap(cur, value) {
+			break
+		}
+	}
+	s.updated.Store(time.Now().UnixNano())
+}
+
+// floatStats records the value range of a Float registered with TrackStats.
+type floatStats struct {
+	max, min Float
+	updated  atomic.Int64 // unix nanoseconds of the last update
+}
+
+func (s *floatStats) observe(value float64) {
+	if s == nil {
+		return
+	}
+	bits := math.Float64bits(value)
+	for {
+		cur := s.max.f.Load()
+		if value <= math.Float64frombits(cur) || s.max.f.CompareAndSwap(cur, bits) {
+			break
+		}
+	}
+	for {
+		cur := s.min.f.Load()
+		if value >= math.Float64frombits(cur) || s.min.f.CompareAndSwap(cur, bits) {
+			break
+		}
+	}
+	s.updated.Store(time.Now().UnixNano())
+}
+
+// formatUpdated formats the time of the last update like Timestamp. Returns
+// an empty string if the variable has never been updated.
+func formatUpdated(nanos int64) string {
+	if nanos == 0 {
+		return ""
+	}
+	return time.Unix(0, nanos).UTC().Format(TSLayout)
+}
@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntTrackStats(t *testing.T) {
+	reg := NewRegistry()
+	plain := NewInt(reg, "plain")
+	v := NewInt(reg, "queue.depth", TrackStats)
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, "", snapshot.Strings["queue.depth.last_updated"])
+
+	v.Add(10)
+	v.Sub(15)
+	v.Set(3)
+	plain.Inc()
+
+	snapshot = CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{
+		"plain":             1,
+		"queue.depth.value": 3,
+		"queue.depth.max":   10,
+		"queue.depth.min":   -5,
+	}, snapshot.Ints)
+
+	updated, err := time.Parse(TSLayout, snapshot.Strings["queue.depth.last_updated"])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), updated, time.Minute)
+}
+
+func TestFloatTrackStats(t *testing.T) {
+	reg := NewRegistry(TrackStats)
+	v := NewFloat(reg, "load")
+
+	v.Set(0.5)
+	v.Add(1)
+	v.Sub(1.25)
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]float64{
+		"load.value": 0.25,
+		"load.max":   1.5,
+		"load.min":   0,
+	}, snapshot.Floats)
+	assert.NotEmpty(t, snapshot.Strings["load.last_updated"])
+}
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictRegistry(t *testing.T) {
+	reg := NewRegistry(Strict)
+	NewInt(reg, "events.total")
+
+	err := catchPanic(func() { NewInt(reg, "events.total") })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "name events.total already used")
+	assert.Contains(t, err.Error(), "first registered at ")
+	assert.Contains(t, err.Error(), "strict_test.go:")
+	assert.NotContains(t, err.Error(), "unknown")
+
+	err = catchPanic(func() { reg.Add("events.total", &Int{}, Full) })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "strict_test.go:")
+
+	// sub-registries inherit the strict mode
+	sub := reg.GetOrCreateRegistry("sub")
+	NewString(sub, "name")
+	assert.Panics(t, func() { NewString(sub, "name") })
+}
+
+func TestNonStrictRegistry(t *testing.T) {
+	reg := NewRegistry()
+	v := NewInt(reg, "events.total")
+	assert.Same(t, v, NewInt(reg, "events.total"))
+}
+
+func TestRemoveMissing(t *testing.T) {
+	reg := NewRegistry()
+	NewInt(reg, "a.b")
+
+	assert.ErrorIs(t, reg.Remove("a.missing"), ErrNotFound)
+	assert.ErrorIs(t, reg.Remove("a.b.c"), ErrNotFound)
+	assert.ErrorIs(t, reg.Remove("missing"), ErrNotFound)
+	assert.NoError(t, reg.Remove("a.b"))
+	assert.ErrorIs(t, reg.Remove("a.b"), ErrNotFound)
+}
+
+func catchPanic(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+				return
+			}
+			err = errors.New(fmt.Sprint(r))
+		}
+	}()
+	f()
+	return nil
+}
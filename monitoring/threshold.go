@@ -0,0 +1,55 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import "sync/atomic"
+
+// threshold is a callback registered via OnThreshold.
+type threshold[T int64 | uint64] struct {
+	value T
+	f     func(T)
+}
+
+// addThreshold adds a threshold to the copy-on-write list of thresholds.
+func addThreshold[T int64 | uint64](list *atomic.Pointer[[]threshold[T]], value T, f func(T)) {
+	for {
+		old := list.Load()
+		var next []threshold[T]
+		if old != nil {
+			next = append(next, *old...)
+		}
+		next = append(next, threshold[T]{value: value, f: f})
+		if list.CompareAndSwap(old, &next) {
+			return
+		}
+	}
+}
+
+// checkThresholds calls the callbacks of all thresholds crossed by the
+// update from old to value.
+func checkThresholds[T int64 | uint64](list *atomic.Pointer[[]threshold[T]], old, value T) {
+	thresholds := list.Load()
+	if thresholds == nil {
+		return
+	}
+	for _, t := range *thresholds {
+		if old < t.value && value >= t.value {
+			t.f(value)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntOnThreshold(t *testing.T) {
+	v := NewInt(NewRegistry(), "dropped")
+
+	var crossed []int64
+	v.OnThreshold(1, func(value int64) { crossed = append(crossed, value) })
+	v.OnThreshold(10, func(value int64) { crossed = append(crossed, -value) })
+
+	v.Add(0)
+	v.Inc()
+	v.Inc()
+	assert.Equal(t, []int64{1}, crossed)
+
+	v.Add(10)
+	assert.Equal(t, []int64{1, -12}, crossed)
+
+	// re-armed once the value drops below the threshold
+	v.Set(0)
+	v.Set(5)
+	assert.Equal(t, []int64{1, -12, 5}, crossed)
+}
+
+func TestUintOnThreshold(t *testing.T) {
+	v := NewUint(NewRegistry(), "dropped")
+
+	var calls atomic.Int64
+	v.OnThreshold(100, func(uint64) { calls.Add(1) })
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				v.Inc()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(500), v.Get())
+	assert.Equal(t, int64(1), calls.Load(), "concurrent updates must cross the threshold exactly once")
+
+	v.Sub(450)
+	v.Add(50)
+	assert.Equal(t, int64(2), calls.Load())
+}
@@ -0,0 +1,230 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// timerAccuracy is the relative accuracy of the quantiles reported by Timer.
+const timerAccuracy = 0.01
+
+// Timer records durations and reports their count, mean, min, max and the
+// 50th, 95th and 99th percentile. Percentiles are estimated with a
+// logarithmically bucketed sketch guaranteeing a relative error of 1% using
+// bounded memory, independent of the number of observations.
+//
+// A Timer is reported as namespace with the keys `count`, `mean`, `min`,
+// `max`, `p50`, `p95` and `p99`. All durations are reported in milliseconds.
+type Timer struct {
+	mu     sync.Mutex
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+	sketch quantileSketch
+}
+
+// NewTimer creates and registers a new timer.
+func NewTimer(r *Registry, name string, opts ...Option) *Timer {
+	rr := r
+	if rr == nil {
+		rr = Default
+	}
+	rr.txMu.Lock()
+	defer rr.txMu.Unlock()
+
+	existingVar, r := setupMetric(r, name, opts)
+	if existingVar != nil {
+		cast, ok := existingVar.(*Timer)
+		if ok {
+			return cast
+		} else {
+			panicErr(fmt.Errorf("variable name %s was first registered as a %T, tried to register as Timer", name, existingVar))
+		}
+	}
+
+	v := &Timer{sketch: newQuantileSketch(timerAccuracy)}
+	addVar(r, name, opts, v, nil)
+	return v
+}
+
+// Observe records a duration. Negative durations are recorded as 0.
+func (t *Timer) Observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.count == 0 || d < t.min {
+		t.min = d
+	}
+	if d > t.max {
+		t.max = d
+	}
+	t.count++
+	t.sum += d
+	t.sketch.add(float64(d))
+}
+
+// Start returns a Stopwatch recording the time elapsed since Start into the
+// timer when stopped.
+func (t *Timer) Start() Stopwatch {
+	return Stopwatch{timer: t, start: time.Now()}
+}
+
+// Time runs f and records its duration.
+func (t *Timer) Time(f func()) {
+	sw := t.Start()
+	defer sw.Stop()
+	f()
+}
+
+// Count returns the number of recorded durations.
+func (t *Timer) Count() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
+
+// Mean returns the average of all recorded durations.
+func (t *Timer) Mean() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.mean()
+}
+
+// Percentile returns an estimate of the p-th percentile, with p in [0, 1].
+func (t *Timer) Percentile(p float64) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Duration(t.sketch.quantile(p))
+}
+
+// Reset removes all recorded durations.
+func (t *Timer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count, t.sum, t.min, t.max = 0, 0, 0, 0
+	t.sketch = newQuantileSketch(timerAccuracy)
+}
+
+func (t *Timer) Visit(_ Mode, vs Visitor) {
+	vs.OnRegistryStart()
+	defer vs.OnRegistryFinished()
+
+	t.mu.Lock()
+	count, mean, minD, maxD := t.count, t.mean(), t.min, t.max
+	p50, p95, p99 := t.sketch.quantile(0.5), t.sketch.quantile(0.95), t.sketch.quantile(0.99)
+	t.mu.Unlock()
+
+	ReportInt(vs, "count", count)
+	ReportFloat(vs, "mean", durationMillis(float64(mean)))
+	ReportFloat(vs, "min", durationMillis(float64(minD)))
+	ReportFloat(vs, "max", durationMillis(float64(maxD)))
+	ReportFloat(vs, "p50", durationMillis(p50))
+	ReportFloat(vs, "p95", durationMillis(p95))
+	ReportFloat(vs, "p99", durationMillis(p99))
+}
+
+func (t *Timer) mean() time.Duration {
+	if t.count == 0 {
+		return 0
+	}
+	return t.sum / time.Duration(t.count)
+}
+
+func durationMillis(ns float64) float64 {
+	return ns / float64(time.Millisecond)
+}
+
+// Stopwatch measures the time elapsed since it has been started by a Timer.
+type Stopwatch struct {
+	timer *Timer
+	start time.Time
+}
+
+// Stop records the elapsed time in the timer and returns it.
+func (s Stopwatch) Stop() time.Duration {
+	d := time.Since(s.start)
+	s.timer.Observe(d)
+	return d
+}
+
+// quantileSketch estimates quantiles of positive values by counting them in
+// exponentially sized buckets. Bucket i covers the range (gamma^(i-1),
+// gamma^i], such that every value in a bucket is within the relative
+// accuracy of the bucket's representative value.
+type quantileSketch struct {
+	gamma   float64
+	logBase float64
+	zeros   uint64
+	counts  map[int]uint64
+	total   uint64
+}
+
+func newQuantileSketch(accuracy float64) quantileSketch {
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return quantileSketch{
+		gamma:   gamma,
+		logBase: math.Log(gamma),
+		counts:  map[int]uint64{},
+	}
+}
+
+func (s *quantileSketch) add(v float64) {
+	s.total++
+	if v <= 0 {
+		s.zeros++
+		return
+	}
+	s.counts[int(math.Ceil(math.Log(v)/s.logBase))]++
+}
+
+func (s *quantileSketch) quantile(q float64) float64 {
+	if s.total == 0 {
+		return 0
+	}
+	q = math.Max(0, math.Min(1, q))
+
+	rank := uint64(q * float64(s.total-1))
+	if rank < s.zeros {
+		return 0
+	}
+
+	keys := make([]int, 0, len(s.counts))
+	for k := range s.counts {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	seen := s.zeros
+	for _, k := range keys {
+		seen += s.counts[k]
+		if seen > rank {
+			return 2 * math.Pow(s.gamma, float64(k)) / (s.gamma + 1)
+		}
+	}
+	return 2 * math.Pow(s.gamma, float64(keys[len(keys)-1])) / (s.gamma + 1)
+}
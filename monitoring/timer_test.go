@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimer(t *testing.T) {
+	reg := NewRegistry()
+	timer := NewTimer(reg, "latency")
+
+	for i := 1; i <= 1000; i++ {
+		timer.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	assert.Equal(t, int64(1000), timer.Count())
+	assert.Equal(t, 500500*time.Microsecond, timer.Mean())
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(timer.Percentile(0.5)), timerAccuracy)
+	assert.InEpsilon(t, float64(950*time.Millisecond), float64(timer.Percentile(0.95)), timerAccuracy)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(timer.Percentile(0.99)), timerAccuracy)
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, int64(1000), snapshot.Ints["latency.count"])
+	assert.Equal(t, 1.0, snapshot.Floats["latency.min"])
+	assert.Equal(t, 1000.0, snapshot.Floats["latency.max"])
+	assert.InDelta(t, 500.5, snapshot.Floats["latency.mean"], 0.001)
+	assert.InEpsilon(t, 990, snapshot.Floats["latency.p99"], timerAccuracy)
+
+	timer.Reset()
+	assert.Zero(t, timer.Count())
+	assert.Zero(t, timer.Percentile(0.5))
+}
+
+func TestTimerStopwatch(t *testing.T) {
+	reg := NewRegistry()
+	timer := NewTimer(reg, "latency")
+
+	timer.Time(func() { time.Sleep(time.Millisecond) })
+	d := timer.Start().Stop()
+
+	assert.Equal(t, int64(2), timer.Count())
+	assert.GreaterOrEqual(t, d, time.Duration(0))
+
+	// the maximum is exact, the quantiles are within the accuracy
+	maxMillis := CollectFlatSnapshot(reg, Full, false).Floats["latency.max"]
+	assert.GreaterOrEqual(t, maxMillis, 1.0)
+	assert.InEpsilon(t, maxMillis, float64(timer.Percentile(1))/float64(time.Millisecond), timerAccuracy)
+}
@@ -0,0 +1,267 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DefaultVecLimit is the maximum number of distinct label sets a Vec tracks
+// if no limit has been configured via the VecLimit option.
+const DefaultVecLimit = 1000
+
+// OverflowLabelValue is the label value used for the series collecting all
+// updates for label sets exceeding the cardinality limit of a Vec. It is
+// reserved and can not be used as a regular label value.
+const OverflowLabelValue = "_other"
+
+// labelSep separates label values in the internal lookup key. It is not valid
+// UTF-8 and therefore can not be part of a valid label value.
+const labelSep = "\xff"
+
+// Vec is a family of metrics of the same type partitioned by a fixed set of
+// labels. Each distinct combination of label values creates a child metric
+// on first use. The children are reported as nested namespaces, one level
+// per label, in the order the labels have been configured:
+//
+//	v := NewIntVec(reg, "events", []string{"output", "pipeline"})
+//	v.WithLabelValues("elasticsearch", "default").Inc()
+//
+// is reported as `events.elasticsearch.default`. Label values are escaped
+// with EscapeName, such that `example.com` is reported as `example%2Ecom`.
+//
+// The number of children is bounded by the configured limit. Once the limit
+// is reached, updates for new label sets are aggregated into a single child
+// with all label values set to OverflowLabelValue.
+type Vec[T Var] struct {
+	labels []string
+	limit  int
+	newVar func() T
+
+	mu       sync.RWMutex
+	children map[string]*vecChild[T]
+	overflow *vecChild[T]
+}
+
+type vecChild[T Var] struct {
+	values []string
+	v      T
+}
+
+// IntVec is a family of Int metrics partitioned by labels.
+type IntVec = Vec[*Int]
+
+// FloatVec is a family of Float metrics partitioned by labels.
+type FloatVec = Vec[*Float]
+
+// NewIntVec creates and registers a new IntVec with the given label names.
+func NewIntVec(r *Registry, name string, labels []string, opts ...Option) *IntVec {
+	return NewVec(r, name, labels, func() *Int { return &Int{} }, opts...)
+}
+
+// NewFloatVec creates and registers a new FloatVec with the given label names.
+func NewFloatVec(r *Registry, name string, labels []string, opts ...Option) *FloatVec {
+	return NewVec(r, name, labels, func() *Float { return &Float{} }, opts...)
+}
+
+// NewVec creates and registers a new metrics family. The newVar function is
+// used to create the child metric for every new combination of label values.
+// If a Vec of the same type has already been registered with the given name
+// the existing Vec is returned. Panics if the labels do not match the
+// existing Vec, or if the name is in use by another variable type.
+func NewVec[T Var](r *Registry, name string, labels []string, newVar func() T, opts ...Option) *Vec[T] {
+	if len(labels) == 0 {
+		panicErr(fmt.Errorf("metrics family %s requires at least one label", name))
+	}
+
+	rr := r
+	if rr == nil {
+		rr = Default
+	}
+	rr.txMu.Lock()
+	defer rr.txMu.Unlock()
+
+	existingVar, r := setupMetric(r, name, opts)
+	if existingVar != nil {
+		cast, ok := existingVar.(*Vec[T])
+		if !ok {
+			panicErr(fmt.Errorf("variable name %s was first registered as a %T, tried to register as %T", name, existingVar, cast))
+		}
+		if !slices.Equal(cast.labels, labels) {
+			panicErr(fmt.Errorf("metrics family %s was first registered with labels %v, tried to register with labels %v", name, cast.labels, labels))
+		}
+		return cast
+	}
+
+	O := varOpts(r.opts, opts)
+	limit := O.vecLimit
+	if limit <= 0 {
+		limit = DefaultVecLimit
+	}
+
+	v := &Vec[T]{
+		labels:   slices.Clone(labels),
+		limit:    limit,
+		newVar:   newVar,
+		children: map[string]*vecChild[T]{},
+	}
+	addVar(r, name, opts, v, nil)
+	return v
+}
+
+// Labels returns the label names of the metrics family.
+func (v *Vec[T]) Labels() []string {
+	return slices.Clone(v.labels)
+}
+
+// WithLabelValues returns the metric for the given label values, creating it
+// if needed. The number of values must match the number of labels, otherwise
+// WithLabelValues panics. Label values must be valid UTF-8, not empty and not
+// be OverflowLabelValue.
+func (v *Vec[T]) WithLabelValues(values ...string) T {
+	v.checkValues(values)
+	key := strings.Join(values, labelSep)
+
+	v.mu.RLock()
+	child, exists := v.children[key]
+	v.mu.RUnlock()
+	if exists {
+		return child.v
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if child, exists := v.children[key]; exists {
+		return child.v
+	}
+
+	if len(v.children) >= v.limit {
+		if v.overflow == nil {
+			overflow := make([]string, len(v.labels))
+			for i := range overflow {
+				overflow[i] = OverflowLabelValue
+			}
+			v.overflow = &vecChild[T]{values: overflow, v: v.newVar()}
+		}
+		return v.overflow.v
+	}
+
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = EscapeName(value)
+	}
+	child = &vecChild[T]{values: escaped, v: v.newVar()}
+	v.children[key] = child
+	return child.v
+}
+
+// Delete removes the metric for the given label values. Returns true if the
+// metric did exist.
+func (v *Vec[T]) Delete(values ...string) bool {
+	v.checkValues(values)
+	key := strings.Join(values, labelSep)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, exists := v.children[key]
+	delete(v.children, key)
+	return exists
+}
+
+// Reset removes all metrics from the family, including the overflow series.
+func (v *Vec[T]) Reset() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.children = map[string]*vecChild[T]{}
+	v.overflow = nil
+}
+
+// Len returns the number of label sets currently tracked, not including the
+// overflow series.
+func (v *Vec[T]) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.children)
+}
+
+// Visit reports all children of the family as nested namespaces.
+func (v *Vec[T]) Visit(m Mode, vs Visitor) {
+	v.mu.RLock()
+	children := make([]*vecChild[T], 0, len(v.children)+1)
+	for _, child := range v.children {
+		children = append(children, child)
+	}
+	if v.overflow != nil {
+		children = append(children, v.overflow)
+	}
+	v.mu.RUnlock()
+
+	// Sorting the children guarantees that all children sharing a prefix of
+	// label values are reported next to each other, such that every prefix
+	// is reported as one namespace only.
+	slices.SortFunc(children, func(a, b *vecChild[T]) int {
+		return slices.Compare(a.values, b.values)
+	})
+
+	vs.OnRegistryStart()
+	var open []string
+	for _, child := range children {
+		common := 0
+		for common < len(open) && open[common] == child.values[common] {
+			common++
+		}
+		for range open[common:] {
+			vs.OnRegistryFinished()
+		}
+		open = open[:common]
+
+		last := len(child.values) - 1
+		for _, value := range child.values[common:last] {
+			vs.OnKey(value)
+			vs.OnRegistryStart()
+			open = append(open, value)
+		}
+		vs.OnKey(child.values[last])
+		child.v.Visit(m, vs)
+	}
+	for range open {
+		vs.OnRegistryFinished()
+	}
+	vs.OnRegistryFinished()
+}
+
+func (v *Vec[T]) checkValues(values []string) {
+	if len(values) != len(v.labels) {
+		panicErr(fmt.Errorf("metrics family with labels %v requires %d label values, got %d", v.labels, len(v.labels), len(values)))
+	}
+	for i, value := range values {
+		switch {
+		case value == "":
+			panicErr(fmt.Errorf("metrics family with labels %v requires a value for label %s", v.labels, v.labels[i]))
+		case value == OverflowLabelValue:
+			panicErr(fmt.Errorf("label value %s of label %s is reserved for the overflow series", value, v.labels[i]))
+		case !utf8.ValidString(value):
+			panicErr(fmt.Errorf("label value %q of label %s is not valid UTF-8", value, v.labels[i]))
+		}
+	}
+}
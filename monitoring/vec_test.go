@@ -0,0 +1,123 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package monitoring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntVec(t *testing.T) {
+	reg := NewRegistry()
+	vec := NewIntVec(reg, "events", []string{"output", "pipeline"})
+
+	vec.WithLabelValues("es", "default").Add(3)
+	vec.WithLabelValues("es", "other").Inc()
+	vec.WithLabelValues("logstash", "default").Inc()
+	vec.WithLabelValues("es", "default").Inc()
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{
+		"events.es.default":       4,
+		"events.es.other":         1,
+		"events.logstash.default": 1,
+	}, snapshot.Ints)
+
+	structured := CollectStructSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]interface{}{
+		"events": map[string]interface{}{
+			"es": map[string]interface{}{
+				"default": int64(4),
+				"other":   int64(1),
+			},
+			"logstash": map[string]interface{}{
+				"default": int64(1),
+			},
+		},
+	}, structured)
+
+	assert.True(t, vec.Delete("es", "other"))
+	assert.False(t, vec.Delete("es", "other"))
+	assert.Equal(t, 2, vec.Len())
+
+	// Re-registering returns the existing family.
+	assert.Same(t, vec, NewIntVec(reg, "events", []string{"output", "pipeline"}))
+}
+
+func TestVecRegistrationConflicts(t *testing.T) {
+	reg := NewRegistry()
+	NewIntVec(reg, "events", []string{"output"})
+
+	assert.Panics(t, func() { NewIntVec(reg, "events", []string{"input"}) })
+	assert.Panics(t, func() { NewFloatVec(reg, "events", []string{"output"}) })
+	assert.Panics(t, func() { NewIntVec(reg, "empty", nil) })
+
+	vec := NewFloatVec(reg, "latency", []string{"output"})
+	assert.Panics(t, func() { vec.WithLabelValues("a", "b") })
+}
+
+func TestVecInvalidLabelValues(t *testing.T) {
+	vec := NewIntVec(NewRegistry(), "events", []string{"output", "pipeline"})
+
+	assert.Panics(t, func() { vec.WithLabelValues("", "default") })
+	assert.Panics(t, func() { vec.WithLabelValues("es", OverflowLabelValue) })
+	assert.Panics(t, func() { vec.WithLabelValues("es\xffdefault", "x") })
+	assert.Panics(t, func() { vec.Delete("es", "") })
+	assert.Zero(t, vec.Len())
+}
+
+func TestVecEscapesLabelValues(t *testing.T) {
+	reg := NewRegistry()
+	vec := NewIntVec(reg, "hosts", []string{"host"})
+
+	vec.WithLabelValues("a_b.com").Inc()
+	vec.WithLabelValues("a.b_com").Add(2)
+	vec.WithLabelValues("10.0.0.1:9200").Inc()
+	vec.WithLabelValues("10.0.0.1:9200").Inc()
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{
+		"hosts.a_b%2Ecom":           1,
+		"hosts.a%2Eb_com":           2,
+		"hosts.10%2E0%2E0%2E1:9200": 2,
+	}, snapshot.Ints)
+	assert.True(t, vec.Delete("10.0.0.1:9200"))
+}
+
+func TestVecLimit(t *testing.T) {
+	reg := NewRegistry()
+	vec := NewIntVec(reg, "events", []string{"host"}, VecLimit(2))
+
+	vec.WithLabelValues("a").Inc()
+	vec.WithLabelValues("b").Inc()
+	vec.WithLabelValues("c").Inc()
+	vec.WithLabelValues("d").Inc()
+	require.Equal(t, 2, vec.Len())
+
+	snapshot := CollectFlatSnapshot(reg, Full, false)
+	assert.Equal(t, map[string]int64{
+		"events.a":                     1,
+		"events.b":                     1,
+		"events." + OverflowLabelValue: 2,
+	}, snapshot.Ints)
+
+	vec.Reset()
+	assert.Empty(t, CollectFlatSnapshot(reg, Full, false).Ints)
+}
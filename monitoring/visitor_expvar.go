@@ -75,11 +75,11 @@ func makeExparVisitor(level int, vs Visitor) func(expvar.KeyValue) {
 	}
 }
 
-// ignore if `monitoring` variable or some other internals
+// ignore if `monitoring` variable, a published registry or some other internals
 // automatically registered by expvar against our wishes
 func ignoreExpvar(level int, kv expvar.KeyValue) bool {
 	switch kv.Value.(type) {
-	case makeExpvar, Var:
+	case makeExpvar, Var, registryExpvar:
 		return true
 	}
 
@@ -0,0 +1,263 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package safemapstr
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Concurrent is a map which can be shared between goroutines. Keys are
+// expressed in dot-notation like for mapstr.M. Every top-level key is
+// guarded by its own lock, such that operations on different subtrees don't
+// block each other. All operations on keys within the same subtree are
+// serialized, which makes Update and GetOrInsert atomic.
+//
+// Values are copied when stored and returned, such that the map can not be
+// modified without synchronization.
+type Concurrent struct {
+	mu     sync.RWMutex
+	shards map[string]*shard
+}
+
+// shard holds all keys of a subtree.
+type shard struct {
+	mu      sync.RWMutex
+	data    mapstr.M
+	removed bool
+}
+
+// NewConcurrent creates a new Concurrent map, initialized with a copy of the
+// given map.
+func NewConcurrent(init mapstr.M) *Concurrent {
+	c := &Concurrent{shards: map[string]*shard{}}
+	for k, v := range init {
+		name := shardName(k)
+		s := c.shards[name]
+		if s == nil {
+			s = &shard{data: mapstr.M{}}
+			c.shards[name] = s
+		}
+		s.data[k] = cloneValue(v)
+	}
+	return c
+}
+
+func shardName(key string) string {
+	if idx := strings.IndexRune(key, '.'); idx >= 0 {
+		return key[:idx]
+	}
+	return key
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch m := v.(type) {
+	case mapstr.M:
+		return m.Clone()
+	case map[string]interface{}:
+		return mapstr.M(m).Clone()
+	default:
+		return v
+	}
+}
+
+// Get returns a copy of the value stored under key. Returns
+// mapstr.ErrKeyNotFound if the key does not exist.
+func (c *Concurrent) Get(key string) (interface{}, error) {
+	var v interface{}
+	err := c.read(key, func(data mapstr.M) error {
+		val, err := data.GetValue(key)
+		v = cloneValue(val)
+		return err
+	})
+	return v, err
+}
+
+// Put stores a copy of value under key. Like Put, values already stored
+// under a prefix of key are kept using the `value` key.
+func (c *Concurrent) Put(key string, value interface{}) error {
+	return c.write(key, true, func(data mapstr.M) error {
+		return Put(data, key, cloneValue(value))
+	})
+}
+
+// Delete removes the key.
+func (c *Concurrent) Delete(key string) error {
+	return c.write(key, false, func(data mapstr.M) error {
+		return data.Delete(key)
+	})
+}
+
+// Update atomically replaces the value stored under key with the value
+// returned by fn. fn receives the current value and if the key exists. If
+// fn returns false as second value, the key is removed instead. fn must not
+// retain or modify the value passed to it, and must not access the
+// Concurrent map.
+func (c *Concurrent) Update(key string, fn func(v interface{}, exists bool) (interface{}, bool)) error {
+	return c.write(key, true, func(data mapstr.M) error {
+		old, exists, err := getValue(data, key)
+		if err != nil {
+			return err
+		}
+
+		v, keep := fn(old, exists)
+		if !keep {
+			if exists {
+				return data.Delete(key)
+			}
+			return nil
+		}
+		_, err = data.Put(key, cloneValue(v))
+		return err
+	})
+}
+
+// GetOrInsert returns a copy of the value stored under key. If the key does
+// not exist, a copy of value is stored and returned. The returned bool is
+// true if the value has been loaded.
+func (c *Concurrent) GetOrInsert(key string, value interface{}) (interface{}, bool, error) {
+	var actual interface{}
+	var loaded bool
+	err := c.write(key, true, func(data mapstr.M) error {
+		old, exists, err := getValue(data, key)
+		if err != nil {
+			return err
+		}
+		if exists {
+			actual, loaded = cloneValue(old), true
+			return nil
+		}
+
+		actual = cloneValue(value)
+		_, err = data.Put(key, cloneValue(value))
+		return err
+	})
+	return actual, loaded, err
+}
+
+// Snapshot returns a consistent copy of the complete map.
+func (c *Concurrent) Snapshot() mapstr.M {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Lock all shards in order, other operations hold only a single shard
+	// lock.
+	names := make([]string, 0, len(c.shards))
+	for name := range c.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := mapstr.M{}
+	for _, name := range names {
+		s := c.shards[name]
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for k, v := range s.data {
+			out[k] = cloneValue(v)
+		}
+	}
+	return out
+}
+
+// getValue returns the value stored under key and if the key exists.
+func getValue(data mapstr.M, key string) (interface{}, bool, error) {
+	v, err := data.GetValue(key)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	return v, err == nil, err
+}
+
+func (c *Concurrent) read(key string, fn func(mapstr.M) error) error {
+	c.mu.RLock()
+	s := c.shards[shardName(key)]
+	c.mu.RUnlock()
+	if s == nil {
+		return mapstr.ErrKeyNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.removed {
+		return mapstr.ErrKeyNotFound
+	}
+	return fn(s.data)
+}
+
+func (c *Concurrent) write(key string, create bool, fn func(mapstr.M) error) error {
+	name := shardName(key)
+	for {
+		s := c.getShard(name, create)
+		if s == nil {
+			return mapstr.ErrKeyNotFound
+		}
+
+		s.mu.Lock()
+		if s.removed {
+			// the shard has been removed concurrently, retry with a new one
+			s.mu.Unlock()
+			continue
+		}
+		err := fn(s.data)
+		empty := len(s.data) == 0
+		s.mu.Unlock()
+
+		if empty {
+			c.removeShard(name, s)
+		}
+		return err
+	}
+}
+
+func (c *Concurrent) getShard(name string, create bool) *shard {
+	c.mu.RLock()
+	s := c.shards[name]
+	c.mu.RUnlock()
+	if s != nil || !create {
+		return s
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s = c.shards[name]; s == nil {
+		s = &shard{data: mapstr.M{}}
+		c.shards[name] = s
+	}
+	return s
+}
+
+// removeShard removes an empty shard, if it is still empty.
+func (c *Concurrent) removeShard(name string, s *shard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.shards[name] != s {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.data) == 0 {
+		s.removed = true
+		delete(c.shards, name)
+	}
+}
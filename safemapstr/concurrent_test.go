@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package safemapstr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConcurrent(t *testing.T) {
+	init := mapstr.M{
+		"a":   mapstr.M{"b": 1},
+		"c.d": "dotted",
+	}
+	c := NewConcurrent(init)
+
+	// the initial map is copied
+	init["a"].(mapstr.M)["b"] = 2
+
+	v, err := c.Get("a.b")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	v, err = c.Get("c.d")
+	require.NoError(t, err)
+	assert.Equal(t, "dotted", v)
+
+	_, err = c.Get("missing")
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+
+	// returned maps are copies
+	v, err = c.Get("a")
+	require.NoError(t, err)
+	v.(mapstr.M)["b"] = 3
+	v, err = c.Get("a.b")
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+
+	// Put keeps values like Put
+	require.NoError(t, c.Put("a.b.c", "x"))
+	v, err = c.Get("a.b")
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"value": 1, "c": "x"}, v)
+
+	require.NoError(t, c.Delete("a"))
+	_, err = c.Get("a.b")
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+	assert.ErrorIs(t, c.Delete("a"), mapstr.ErrKeyNotFound)
+
+	assert.Equal(t, mapstr.M{"c.d": "dotted"}, c.Snapshot())
+}
+
+func TestConcurrentUpdate(t *testing.T) {
+	c := NewConcurrent(nil)
+
+	require.NoError(t, c.Update("x.count", func(v interface{}, exists bool) (interface{}, bool) {
+		assert.False(t, exists)
+		return 1, true
+	}))
+	require.NoError(t, c.Update("x.count", func(v interface{}, exists bool) (interface{}, bool) {
+		assert.True(t, exists)
+		return v.(int) + 1, true
+	}))
+	v, err := c.Get("x.count")
+	require.NoError(t, err)
+	assert.Equal(t, 2, v)
+
+	require.NoError(t, c.Update("x.count", func(interface{}, bool) (interface{}, bool) {
+		return nil, false
+	}))
+	assert.Equal(t, mapstr.M{"x": mapstr.M{}}, c.Snapshot())
+
+	v, loaded, err := c.GetOrInsert("y", mapstr.M{"z": 1})
+	require.NoError(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, mapstr.M{"z": 1}, v)
+
+	v, loaded, err = c.GetOrInsert("y", mapstr.M{"z": 2})
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, mapstr.M{"z": 1}, v)
+}
+
+func TestConcurrentParallel(t *testing.T) {
+	c := NewConcurrent(nil)
+
+	const goroutines, iterations = 8, 200
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own := fmt.Sprintf("g%d", i)
+			for j := 0; j < iterations; j++ {
+				_ = c.Update("shared.count", func(v interface{}, exists bool) (interface{}, bool) {
+					if !exists {
+						return 1, true
+					}
+					return v.(int) + 1, true
+				})
+				_ = c.Put(own+".value", j)
+				_ = c.Delete(own)
+				_, _, _ = c.GetOrInsert(own+".value", j)
+				_ = c.Snapshot()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	v, err := c.Get("shared.count")
+	require.NoError(t, err)
+	assert.Equal(t, goroutines*iterations, v)
+	assert.Len(t, c.Snapshot(), goroutines+1)
+}
@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package safemapstr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// CollisionPolicy defines how a value is stored if its dotted key collides
+// with a value already present in the map.
+type CollisionPolicy uint8
+
+const (
+	// CollisionMerge is the behavior of Put. Values that are no map and are
+	// in the way of the new key are moved under the `value` key of a new
+	// map. Existing leaf values under the same key are overwritten.
+	CollisionMerge CollisionPolicy = iota
+
+	// CollisionRename stores the colliding value under the first free key
+	// built by appending `_1`, `_2`, ... to the colliding segment of the key.
+	// No existing value is modified.
+	CollisionRename
+
+	// CollisionError makes the operation fail with an error wrapping
+	// mapstr.ErrKeyCollision. The map is not modified.
+	CollisionError
+)
+
+// Option configures PutWithOptions and AlterPath.
+type Option func(options) options
+
+type options struct {
+	policy CollisionPolicy
+}
+
+// OnCollision sets the policy to apply if a key collides with an existing
+// value. The default is CollisionMerge.
+func OnCollision(policy CollisionPolicy) Option {
+	return func(o options) options {
+		o.policy = policy
+		return o
+	}
+}
+
+// PutWithOptions puts a value under a dotted key like Put, handling
+// collisions with existing values according to the configured
+// CollisionPolicy.
+func PutWithOptions(data mapstr.M, key string, value interface{}, opts ...Option) error {
+	var o options
+	for _, opt := range opts {
+		o = opt(o)
+	}
+
+	switch o.policy {
+	case CollisionMerge:
+		return Put(data, key, value)
+	case CollisionRename:
+		putRenamed(data, key, value)
+		return nil
+	case CollisionError:
+		if err := checkCollision(data, key); err != nil {
+			return err
+		}
+		putRenamed(data, key, value)
+		return nil
+	default:
+		return fmt.Errorf("unknown collision policy %v", o.policy)
+	}
+}
+
+// AlterPath de-dots a key: the value stored under the literal dotted key is
+// removed and put under the nested path the key describes, handling
+// collisions according to the configured CollisionPolicy. For example
+// `{"a.b": 1}` becomes `{"a": {"b": 1}}`.
+//
+// Returns mapstr.ErrKeyNotFound if the key does not exist. The map is left
+// unchanged if an error is returned.
+func AlterPath(data mapstr.M, key string, opts ...Option) error {
+	value, exists := data[key]
+	if !exists {
+		return fmt.Errorf("failed to alter %v: %w", key, mapstr.ErrKeyNotFound)
+	}
+	if !strings.Contains(key, ".") {
+		return nil
+	}
+
+	delete(data, key)
+	if err := PutWithOptions(data, key, value, opts...); err != nil {
+		data[key] = value
+		return err
+	}
+	return nil
+}
+
+// putRenamed puts the value under the dotted key, descending into existing
+// maps. Segments colliding with values that are no map, and the final key if
+// it is already in use, are renamed by appending a numeric suffix.
+func putRenamed(data mapstr.M, key string, value interface{}) {
+	for {
+		k, rest, nested := strings.Cut(key, ".")
+		if !nested {
+			if _, exists := data[k]; exists {
+				k = freeKey(data, k, false)
+			}
+			data[k] = value
+			return
+		}
+
+		sub, exists := data[k]
+		if !exists {
+			sub = mapstr.M{}
+			data[k] = sub
+		}
+		m, ok := tryToM(sub)
+		if !ok {
+			k = freeKey(data, k, true)
+			if sub, exists = data[k]; !exists {
+				sub = mapstr.M{}
+				data[k] = sub
+			}
+			m, _ = tryToM(sub)
+		}
+
+		data, key = m, rest
+	}
+}
+
+// freeKey returns the first key with a numeric suffix that is not used, or
+// if allowMap is set, holds a map.
+func freeKey(data mapstr.M, key string, allowMap bool) string {
+	for i := 1; ; i++ {
+		k := key + "_" + strconv.Itoa(i)
+		v, exists := data[k]
+		if !exists {
+			return k
+		}
+		if _, ok := tryToM(v); ok && allowMap {
+			return k
+		}
+	}
+}
+
+// checkCollision reports an error if putting a value under the dotted key
+// would collide with an existing value.
+func checkCollision(data mapstr.M, key string) error {
+	end := 0
+	for {
+		k, _, nested := strings.Cut(key[end:], ".")
+		end += len(k)
+
+		v, exists := data[k]
+		if !exists {
+			return nil
+		}
+		m, ok := tryToM(v)
+		if !nested || !ok {
+			return fmt.Errorf("failed to put %v: %w with existing value at %v",
+				key, mapstr.ErrKeyCollision, key[:end])
+		}
+
+		data = m
+		end++ // skip the dot
+	}
+}
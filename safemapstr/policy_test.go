@@ -0,0 +1,165 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package safemapstr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestPutWithOptions(t *testing.T) {
+	cases := map[string]struct {
+		data     mapstr.M
+		key      string
+		policy   CollisionPolicy
+		expected mapstr.M
+		err      bool
+	}{
+		"merge moves leaf under value": {
+			data:     mapstr.M{"a": "x"},
+			key:      "a.b",
+			policy:   CollisionMerge,
+			expected: mapstr.M{"a": mapstr.M{"value": "x", "b": 1}},
+		},
+		"merge overwrites leaf": {
+			data:     mapstr.M{"a": mapstr.M{"b": "x"}},
+			key:      "a.b",
+			policy:   CollisionMerge,
+			expected: mapstr.M{"a": mapstr.M{"b": 1}},
+		},
+		"rename without collision": {
+			data:     mapstr.M{"a": mapstr.M{"c": 2}},
+			key:      "a.b",
+			policy:   CollisionRename,
+			expected: mapstr.M{"a": mapstr.M{"b": 1, "c": 2}},
+		},
+		"rename leaf": {
+			data:     mapstr.M{"a": mapstr.M{"b": "x", "b_1": "y"}},
+			key:      "a.b",
+			policy:   CollisionRename,
+			expected: mapstr.M{"a": mapstr.M{"b": "x", "b_1": "y", "b_2": 1}},
+		},
+		"rename map at leaf": {
+			data:     mapstr.M{"a": mapstr.M{"b": mapstr.M{"c": 2}}},
+			key:      "a.b",
+			policy:   CollisionRename,
+			expected: mapstr.M{"a": mapstr.M{"b": mapstr.M{"c": 2}, "b_1": 1}},
+		},
+		"rename intermediate": {
+			data:     mapstr.M{"a": "x"},
+			key:      "a.b",
+			policy:   CollisionRename,
+			expected: mapstr.M{"a": "x", "a_1": mapstr.M{"b": 1}},
+		},
+		"rename reuses renamed map": {
+			data:     mapstr.M{"a": "x", "a_1": mapstr.M{"c": 2}},
+			key:      "a.b",
+			policy:   CollisionRename,
+			expected: mapstr.M{"a": "x", "a_1": mapstr.M{"b": 1, "c": 2}},
+		},
+		"error without collision": {
+			data:     mapstr.M{"a": map[string]interface{}{"c": 2}},
+			key:      "a.b",
+			policy:   CollisionError,
+			expected: mapstr.M{"a": map[string]interface{}{"b": 1, "c": 2}},
+		},
+		"error on leaf": {
+			data:     mapstr.M{"a": mapstr.M{"b": "x"}},
+			key:      "a.b",
+			policy:   CollisionError,
+			expected: mapstr.M{"a": mapstr.M{"b": "x"}},
+			err:      true,
+		},
+		"error on intermediate": {
+			data:     mapstr.M{"a": "x"},
+			key:      "a.b.c",
+			policy:   CollisionError,
+			expected: mapstr.M{"a": "x"},
+			err:      true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := PutWithOptions(tc.data, tc.key, 1, OnCollision(tc.policy))
+			if tc.err {
+				assert.ErrorIs(t, err, mapstr.ErrKeyCollision)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, tc.data)
+		})
+	}
+}
+
+func TestPutWithOptionsErrorMessage(t *testing.T) {
+	err := PutWithOptions(mapstr.M{"a": mapstr.M{"b": 1}}, "a.b.c", 2, OnCollision(CollisionError))
+	assert.EqualError(t, err, "failed to put a.b.c: key collision with existing value at a.b")
+}
+
+func TestAlterPath(t *testing.T) {
+	// Windows event data can contain both a dotted key and its prefix.
+	newData := func() mapstr.M {
+		return mapstr.M{
+			"param":       "x",
+			"param.name":  "y",
+			"param.value": "z",
+		}
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		data := newData()
+		require.NoError(t, AlterPath(data, "param.name"))
+		require.NoError(t, AlterPath(data, "param.value"))
+		// the original `param` value is lost
+		assert.Equal(t, mapstr.M{"param": mapstr.M{"name": "y", "value": "z"}}, data)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		data := newData()
+		require.NoError(t, AlterPath(data, "param.name", OnCollision(CollisionRename)))
+		require.NoError(t, AlterPath(data, "param.value", OnCollision(CollisionRename)))
+		assert.Equal(t, mapstr.M{
+			"param":   "x",
+			"param_1": mapstr.M{"name": "y", "value": "z"},
+		}, data)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		data := newData()
+		err := AlterPath(data, "param.name", OnCollision(CollisionError))
+		assert.ErrorIs(t, err, mapstr.ErrKeyCollision)
+		assert.Equal(t, newData(), data)
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		data := newData()
+		assert.ErrorIs(t, AlterPath(data, "other.key"), mapstr.ErrKeyNotFound)
+		assert.Equal(t, newData(), data)
+	})
+
+	t.Run("key without dots", func(t *testing.T) {
+		data := newData()
+		assert.NoError(t, AlterPath(data, "param"))
+		assert.Equal(t, newData(), data)
+	})
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -37,6 +38,9 @@ type Client struct {
 	host    string
 	config  Config
 
+	// dialerCloser closes the dialer created by the client, if any.
+	dialerCloser io.Closer
+
 	conn  net.Conn
 	mutex sync.Mutex
 }
@@ -46,9 +50,49 @@ type Config struct {
 	TLS     *tlscommon.TLSConfig
 	Timeout time.Duration
 	Stats   IOStatser
+
+	// FallbackDelay enables dialing the IPv6 and IPv4 addresses of a host in
+	// parallel, starting a new connection attempt after the given delay. See
+	// HappyEyeballsDialer. Disabled if <= 0.
+	FallbackDelay time.Duration
+
+	// Resolver used to resolve host names, e.g. a CachingResolver. If nil,
+	// net.DefaultResolver is used.
+	Resolver Resolver
+
+	// Throttle limits the bandwidth of each connection. Disabled if nil.
+	Throttle *ThrottleConfig
+
+	// ConnStats records the statistics of all connections per address.
+	// Disabled if nil.
+	ConnStats *ConnStats
+
+	// KeepAlive configures TCP keepalive probes. If nil, the defaults of the
+	// net package are used.
+	KeepAlive *KeepAliveConfig
+
+	// SSH configures tunneling all connections through an SSH jump host. The
+	// SSH server is connected to via the proxy, if configured. Disabled if nil.
+	SSH *SSHConfig
+
+	// UserTimeout sets TCP_USER_TIMEOUT, the maximum time transmitted data
+	// may remain unacknowledged before the connection is closed. Only
+	// supported on Linux, ignored otherwise. Disabled if <= 0.
+	UserTimeout time.Duration
 }
 
+// NewClient creates a client connecting to the given host. Besides a host
+// name or address, the host can refer to a unix domain socket or a Windows
+// named pipe, see IsLocalAddress.
 func NewClient(c Config, network, host string, defaultPort int, logger *logp.Logger) (*Client, error) {
+	if IsLocalAddress(host) {
+		dialer, err := makeLocalDialer(c, host)
+		if err != nil {
+			return nil, err
+		}
+		return NewClientWithDialer(dialer, c, network, host, defaultPort, logger)
+	}
+
 	// do some sanity checks regarding network and Config matching +
 	// address being parseable
 	switch network {
@@ -67,15 +111,25 @@ func NewClient(c Config, network, host string, defaultPort int, logger *logp.Log
 		return nil, err
 	}
 
-	return NewClientWithDialer(dialer, c, network, host, defaultPort, logger)
+	client, err := NewClientWithDialer(dialer, c, network, host, defaultPort, logger)
+	if err != nil {
+		if closer, ok := dialer.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+	client.dialerCloser, _ = dialer.(io.Closer)
+	return client, nil
 }
 
 func NewClientWithDialer(d Dialer, c Config, network, host string, defaultPort int, logger *logp.Logger) (*Client, error) {
 	// check address being parseable
-	host = fullAddress(host, defaultPort)
-	_, _, err := net.SplitHostPort(host)
-	if err != nil {
-		return nil, err
+	if !IsLocalAddress(host) {
+		host = fullAddress(host, defaultPort)
+		_, _, err := net.SplitHostPort(host)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	client := &Client{
@@ -116,17 +170,23 @@ func (c *Client) IsConnected() bool {
 	return b
 }
 
+// Close closes the connection. If the dialer has been created by NewClient,
+// the resources it shares between connections, like an SSH connection, are
+// closed as well, and reestablished by the next Connect.
 func (c *Client) Close() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	var err error
 	if c.conn != nil {
 		c.log.Debug("closing")
-		err := c.conn.Close()
+		err = c.conn.Close()
 		c.conn = nil
-		return err
 	}
-	return nil
+	if c.dialerCloser != nil {
+		err = errors.Join(err, c.dialerCloser.Close())
+	}
+	return err
 }
 
 func (c *Client) getConn() net.Conn {
@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// ConnStats records network statistics per remote address into a monitoring
+// registry. The statistics of every address are reported in the namespace
+// `hosts.<address>`, with the address escaped by monitoring.EscapeName,
+// e.g. `hosts.127%2E0%2E0%2E1:9200`, with the keys:
+//   - read.bytes, read.errors: bytes read and read errors
+//   - write.bytes, write.errors: bytes written and write errors
+//   - dial.count, dial.errors: connection attempts and failed attempts
+//   - dial.latency: time to establish connections, see monitoring.Timer
+//   - connections.active: number of open connections
+//
+// The number of addresses tracked is limited like for monitoring.Vec.
+type ConnStats struct {
+	hosts *monitoring.Vec[*hostStats]
+}
+
+type hostStats struct {
+	reg *monitoring.Registry
+
+	readBytes, readErrors   *monitoring.Uint
+	writeBytes, writeErrors *monitoring.Uint
+	dials, dialErrors       *monitoring.Uint
+	dialLatency             *monitoring.Timer
+	active                  *monitoring.Int
+}
+
+// NewConnStats creates and registers the statistics in the given registry.
+// Options are passed to the monitoring.Vec tracking the addresses, e.g.
+// monitoring.VecLimit.
+func NewConnStats(reg *monitoring.Registry, opts ...monitoring.Option) *ConnStats {
+	return &ConnStats{
+		hosts: monitoring.NewVec(reg, "hosts", []string{"host"}, newHostStats, opts...),
+	}
+}
+
+func newHostStats() *hostStats {
+	reg := monitoring.NewRegistry()
+	return &hostStats{
+		reg:         reg,
+		readBytes:   monitoring.NewUint(reg, "read.bytes"),
+		readErrors:  monitoring.NewUint(reg, "read.errors"),
+		writeBytes:  monitoring.NewUint(reg, "write.bytes"),
+		writeErrors: monitoring.NewUint(reg, "write.errors"),
+		dials:       monitoring.NewUint(reg, "dial.count"),
+		dialErrors:  monitoring.NewUint(reg, "dial.errors"),
+		dialLatency: monitoring.NewTimer(reg, "dial.latency"),
+		active:      monitoring.NewInt(reg, "connections.active"),
+	}
+}
+
+// Visit reports the statistics of the host as namespace.
+func (s *hostStats) Visit(m monitoring.Mode, vs monitoring.Visitor) {
+	s.reg.Visit(m, vs)
+}
+
+func (s *hostStats) ReadBytes(n int)      { s.readBytes.Add(uint64(n)) }
+func (s *hostStats) ReadError(err error)  { s.readErrors.Inc() }
+func (s *hostStats) WriteBytes(n int)     { s.writeBytes.Add(uint64(n)) }
+func (s *hostStats) WriteError(err error) { s.writeErrors.Inc() }
+
+// Host returns the IOStatser recording the statistics of the given address.
+func (s *ConnStats) Host(address string) IOStatser {
+	return s.hosts.WithLabelValues(hostLabel(address))
+}
+
+// Dialer wraps d, recording the statistics of all connections it creates.
+func (s *ConnStats) Dialer(d Dialer) Dialer {
+	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		stats := s.hosts.WithLabelValues(hostLabel(address))
+
+		stats.dials.Inc()
+		start := time.Now()
+		conn, err := d.DialContext(ctx, network, address)
+		stats.dialLatency.Observe(time.Since(start))
+		if err != nil {
+			stats.dialErrors.Inc()
+			return nil, err
+		}
+
+		stats.active.Inc()
+		return &trackedConn{statsConn: &statsConn{conn, stats}, active: stats.active}, nil
+	})
+}
+
+// hostLabel returns the label value of the address. Label values must not be
+// empty.
+func hostLabel(address string) string {
+	if address == "" {
+		return "unknown"
+	}
+	return address
+}
+
+// trackedConn records statistics like statsConn and updates the number of
+// active connections when closed.
+type trackedConn struct {
+	*statsConn
+	active *monitoring.Int
+	once   sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.active.Dec)
+	return c.statsConn.Close()
+}
@@ -0,0 +1,146 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestConnStats(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	reg := monitoring.NewRegistry()
+	stats := NewConnStats(reg)
+	dialer, err := MakeDialer(Config{Timeout: 5 * time.Second, ConnStats: stats}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	address := ln.Addr().String()
+	conn, err := dialer.DialContext(context.Background(), "tcp", address)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, make([]byte, 5))
+	require.NoError(t, err)
+
+	host := func() map[string]interface{} {
+		snapshot := monitoring.CollectStructSnapshot(reg, monitoring.Full, false)
+		return snapshot["hosts"].(map[string]interface{})[monitoring.EscapeName(address)].(map[string]interface{})
+	}
+
+	s := host()
+	assert.Equal(t, int64(5), s["read"].(map[string]interface{})["bytes"])
+	assert.Equal(t, int64(5), s["write"].(map[string]interface{})["bytes"])
+	assert.Equal(t, int64(1), s["dial"].(map[string]interface{})["count"])
+	assert.Equal(t, int64(0), s["dial"].(map[string]interface{})["errors"])
+	assert.Equal(t, int64(1), s["dial"].(map[string]interface{})["latency"].(map[string]interface{})["count"])
+	assert.Equal(t, int64(1), s["connections"].(map[string]interface{})["active"])
+
+	require.NoError(t, conn.Close())
+	// closing twice must not decrement the active connections again
+	_ = conn.Close()
+	assert.Equal(t, int64(0), host()["connections"].(map[string]interface{})["active"])
+}
+
+func TestConnStatsDialError(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	stats := NewConnStats(reg)
+
+	failing := DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, &net.OpError{Op: "dial", Err: io.ErrUnexpectedEOF}
+	})
+	_, err := stats.Dialer(failing).DialContext(context.Background(), "tcp", "example.com:443")
+	assert.Error(t, err)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(1), snapshot.Ints["hosts.example%2Ecom:443.dial.count"])
+	assert.Equal(t, int64(1), snapshot.Ints["hosts.example%2Ecom:443.dial.errors"])
+	assert.Equal(t, int64(0), snapshot.Ints["hosts.example%2Ecom:443.connections.active"])
+}
+
+func TestConnStatsHost(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	stats := NewConnStats(reg)
+
+	host := stats.Host("localhost:9200")
+	host.ReadBytes(10)
+	host.ReadError(io.ErrUnexpectedEOF)
+	host.WriteBytes(20)
+	host.WriteError(io.ErrClosedPipe)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(10), snapshot.Ints["hosts.localhost:9200.read.bytes"])
+	assert.Equal(t, int64(1), snapshot.Ints["hosts.localhost:9200.read.errors"])
+	assert.Equal(t, int64(20), snapshot.Ints["hosts.localhost:9200.write.bytes"])
+	assert.Equal(t, int64(1), snapshot.Ints["hosts.localhost:9200.write.errors"])
+}
+
+func TestConnStatsDottedHosts(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	stats := NewConnStats(reg)
+
+	pipe := DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			_, _ = io.Copy(server, server)
+		}()
+		return client, nil
+	})
+	dialer := stats.Dialer(pipe)
+
+	for _, address := range []string{"a_b.com:443", "a.b_com:443", "a.b_com:443"} {
+		conn, err := dialer.DialContext(context.Background(), "tcp", address)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, make([]byte, 4))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	}
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, int64(1), snapshot.Ints["hosts.a_b%2Ecom:443.dial.count"])
+	assert.Equal(t, int64(4), snapshot.Ints["hosts.a_b%2Ecom:443.write.bytes"])
+	assert.Equal(t, int64(2), snapshot.Ints["hosts.a%2Eb_com:443.dial.count"])
+	assert.Equal(t, int64(8), snapshot.Ints["hosts.a%2Eb_com:443.write.bytes"])
+}
@@ -0,0 +1,279 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+
+// errNoRecords is returned when a server has no address records for a host.
+var errNoRecords = errors.New("no address records")
+
+// DNSResolver resolves host names by querying DNS servers directly, reporting
+// the TTL of the records, see TTLResolver.
+//
+// Only fully qualified names are queried. Hosts the servers have no address
+// records for, e.g. short names relying on search domains or names defined in
+// the hosts file, are resolved by Fallback with an unknown TTL. Names the
+// servers know are not looked up in the hosts file nor by other system
+// resolution mechanisms, like nsswitch or the scoped resolvers of macOS, so a
+// DNSResolver must be selected explicitly.
+type DNSResolver struct {
+	// Servers are the addresses of the DNS servers, as host:port. The
+	// nameservers of /etc/resolv.conf are used if empty. If no servers are
+	// known, all hosts are resolved by Fallback.
+	Servers []string
+
+	// Timeout of every query, 5s if <= 0.
+	Timeout time.Duration
+
+	// Fallback resolves the hosts the servers do not know, net.DefaultResolver
+	// if nil.
+	Fallback Resolver
+}
+
+// LookupHost returns the addresses of the host.
+func (r *DNSResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addresses, _, err := r.LookupHostTTL(ctx, host)
+	return addresses, err
+}
+
+// LookupHostTTL returns the addresses of the host and the lowest TTL of the
+// records of the answers. The TTL is negative if the host has been resolved
+// by Fallback.
+func (r *DNSResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, -1, nil
+	}
+
+	servers := r.Servers
+	if len(servers) == 0 {
+		servers = systemNameservers()
+	}
+	if len(servers) > 0 && host != "" {
+		addresses, ttl, err := r.query(ctx, servers, host)
+		if err == nil {
+			return addresses, ttl, nil
+		}
+		if !errors.Is(err, errNoRecords) {
+			return nil, 0, &net.DNSError{Err: err.Error(), Name: host}
+		}
+	}
+
+	fallback := r.Fallback
+	if fallback == nil {
+		fallback = net.DefaultResolver
+	}
+	addresses, err := fallback.LookupHost(ctx, host)
+	return addresses, -1, err
+}
+
+// query asks the servers in turn for the A and AAAA records of host, until
+// one of the servers answers.
+func (r *DNSResolver) query(ctx context.Context, servers []string, host string) ([]string, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		var addresses []string
+		ttl := time.Duration(-1)
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			found, recordTTL, err := r.exchange(ctx, server, name, qtype)
+			if err != nil && !errors.Is(err, errNoRecords) {
+				lastErr = err
+				addresses = nil
+				break
+			}
+			addresses = append(addresses, found...)
+			if len(found) > 0 && (ttl < 0 || recordTTL < ttl) {
+				ttl = recordTTL
+			}
+			lastErr = err
+		}
+		if len(addresses) > 0 {
+			return addresses, ttl, nil
+		}
+		if errors.Is(lastErr, errNoRecords) {
+			return nil, 0, errNoRecords
+		}
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// exchange sends a single question to the server over UDP, retrying over TCP
+// if the answer has been truncated.
+func (r *DNSResolver) exchange(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) ([]string, time.Duration, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	id := uint16(rand.Uint32()) //nolint:gosec // the ID only matches answers to queries
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	answer, err := dnsRoundTrip(ctx, "udp", server, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	msg, err := parseDNSAnswer(answer, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if msg.Truncated {
+		if answer, err = dnsRoundTrip(ctx, "tcp", server, query); err != nil {
+			return nil, 0, err
+		}
+		if msg, err = parseDNSAnswer(answer, id); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, errNoRecords
+	default:
+		return nil, 0, fmt.Errorf("server %s answered %v", server, msg.RCode)
+	}
+
+	var addresses []string
+	var ttl uint32
+	for i, rr := range msg.Answers {
+		if i == 0 || rr.Header.TTL < ttl {
+			ttl = rr.Header.TTL
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addresses = append(addresses, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			addresses = append(addresses, net.IP(body.AAAA[:]).String())
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, 0, errNoRecords
+	}
+	return addresses, time.Duration(ttl) * time.Second, nil
+}
+
+func parseDNSAnswer(answer []byte, id uint16) (*dnsmessage.Message, error) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(answer); err != nil {
+		return nil, fmt.Errorf("invalid DNS answer: %w", err)
+	}
+	if msg.ID != id || !msg.Response {
+		return nil, errors.New("invalid DNS answer: unexpected message")
+	}
+	return &msg, nil
+}
+
+// dnsRoundTrip sends the query and returns the answer. Messages sent over TCP
+// are prefixed with their length.
+func dnsRoundTrip(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		answer := make([]byte, 1232)
+		n, err := conn.Read(answer)
+		if err != nil {
+			return nil, err
+		}
+		return answer[:n], nil
+	}
+
+	if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(query)))); err != nil { //nolint:gosec // queries are small
+		return nil, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	answer := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return nil, err
+	}
+	return answer, nil
+}
+
+// systemNameservers returns the nameservers of /etc/resolv.conf.
+func systemNameservers() []string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseNameservers(f)
+}
+
+func parseNameservers(r io.Reader) []string {
+	var servers []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// Zones of link-local addresses are kept, e.g. fe80::1%eth0.
+		if ip, _, _ := strings.Cut(fields[1], "%"); net.ParseIP(ip) == nil {
+			continue
+		}
+		servers = append(servers, net.JoinHostPort(fields[1], "53"))
+	}
+	return servers
+}
@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startDNSServer answers A and AAAA queries for the records, with the TTL of
+// the record, and NXDOMAIN for unknown names.
+func startDNSServer(t *testing.T, records map[string][]dnsmessage.Resource) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			q := query.Questions[0]
+			answer := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+			rrs, found := records[q.Name.String()]
+			if !found {
+				answer.RCode = dnsmessage.RCodeNameError
+			}
+			for _, rr := range rrs {
+				if rr.Header.Type == q.Type || rr.Header.Type == dnsmessage.TypeCNAME {
+					rr.Header.Name = q.Name
+					rr.Header.Class = dnsmessage.ClassINET
+					answer.Answers = append(answer.Answers, rr)
+				}
+			}
+			packed, err := answer.Pack()
+			if err != nil {
+				continue
+			}
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func aRecord(ip string, ttl uint32) dnsmessage.Resource {
+	addr := net.ParseIP(ip)
+	if v4 := addr.To4(); v4 != nil {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Type: dnsmessage.TypeA, TTL: ttl},
+			Body:   &dnsmessage.AResource{A: [4]byte(v4)},
+		}
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Type: dnsmessage.TypeAAAA, TTL: ttl},
+		Body:   &dnsmessage.AAAAResource{AAAA: [16]byte(addr)},
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	server := startDNSServer(t, map[string][]dnsmessage.Resource{
+		"example.com.": {aRecord("10.0.0.1", 300), aRecord("10.0.0.2", 30), aRecord("fd00::1", 60)},
+		"empty.com.":   {},
+	})
+	fallback := &fakeResolver{addresses: map[string][]string{"myhost": {"192.168.0.1"}, "empty.com": {"192.168.0.2"}}}
+	r := &DNSResolver{Servers: []string{server}, Timeout: time.Second, Fallback: fallback}
+	ctx := context.Background()
+
+	addrs, ttl, err := r.LookupHostTTL(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "fd00::1"}, addrs)
+	assert.Equal(t, 30*time.Second, ttl)
+	assert.EqualValues(t, 0, fallback.lookups.Load())
+
+	// names unknown to the servers are resolved by the fallback
+	addrs, ttl, err = r.LookupHostTTL(ctx, "myhost")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.0.1"}, addrs)
+	assert.Negative(t, ttl)
+
+	addrs, _, err = r.LookupHostTTL(ctx, "empty.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.0.2"}, addrs)
+
+	addrs, _, err = r.LookupHostTTL(ctx, "10.1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.1.1.1"}, addrs)
+}
+
+func TestDNSResolverTTLIsCached(t *testing.T) {
+	server := startDNSServer(t, map[string][]dnsmessage.Resource{
+		"example.com.": {aRecord("10.0.0.1", 30)},
+	})
+	r, clock, _ := newTestCachingResolver(t, &DNSResolver{Servers: []string{server}}, DefaultCachingResolverConfig())
+
+	_, err := r.LookupHost(context.Background(), "example.com")
+	require.NoError(t, err)
+	e := r.entries["example.com"]
+	require.NotNil(t, e)
+	assert.Equal(t, clock.now().Add(30*time.Second), e.expires)
+}
+
+func TestDNSResolverServerFailure(t *testing.T) {
+	// nothing listens on the port of the closed connection
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := conn.LocalAddr().String()
+	conn.Close()
+
+	fallback := &fakeResolver{addresses: map[string][]string{}}
+	r := &DNSResolver{Servers: []string{server}, Timeout: 100 * time.Millisecond, Fallback: fallback}
+	_, _, err = r.LookupHostTTL(context.Background(), "example.com")
+	var dnsErr *net.DNSError
+	require.ErrorAs(t, err, &dnsErr)
+	assert.Equal(t, "example.com", dnsErr.Name)
+	assert.EqualValues(t, 0, fallback.lookups.Load(), "failing servers must not be replaced by the fallback")
+}
+
+func TestParseNameservers(t *testing.T) {
+	conf := `# generated
+search example.com
+nameserver 10.0.0.53
+nameserver fe80::1%eth0
+nameserver not-an-ip
+options ndots:2
+`
+	assert.Equal(t, []string{"10.0.0.53:53", "[fe80::1%eth0]:53"}, parseNameservers(strings.NewReader(conf)))
+}
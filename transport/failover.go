@@ -0,0 +1,186 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// FailoverPolicy configures how a Failover dialer chooses between its
+// endpoints.
+type FailoverPolicy struct {
+	// Dialer is used to connect to the endpoints. Defaults to a NetDialer
+	// with DefaultFailoverTimeout.
+	Dialer Dialer
+
+	// Sticky keeps using the endpoint connected to last, until dialing it
+	// fails. If false, every dial tries the endpoints in order of preference.
+	Sticky bool
+
+	// FailbackInterval is the time after which a sticky dialer connected to a
+	// fallback endpoint tries the preferred endpoint again. Zero disables
+	// failback. If the preferred endpoint is still not available, the next
+	// attempt is made after another FailbackInterval.
+	FailbackInterval time.Duration
+
+	// Registry receives the failover metrics if not nil:
+	//   - active: the endpoint connected to last
+	//   - failovers: number of switches to a less preferred endpoint
+	//   - failbacks: number of switches to a more preferred endpoint
+	//   - dial.errors: number of failed connection attempts
+	Registry *monitoring.Registry
+}
+
+// DefaultFailoverTimeout is the dial timeout used by Failover if no Dialer
+// is configured.
+const DefaultFailoverTimeout = 30 * time.Second
+
+// Failover is a dialer connecting to one of multiple endpoints. See DialAny.
+// The address passed to Dial and DialContext is ignored, so a Failover can
+// be used as the Dialer of clients configured with a single address.
+type Failover struct {
+	hosts  []string
+	policy FailoverPolicy
+
+	mu           sync.Mutex
+	active       int
+	failedOverAt time.Time
+	now          func() time.Time
+
+	activeHost           *monitoring.String
+	failovers, failbacks *monitoring.Uint
+	dialErrors           *monitoring.Uint
+}
+
+// DialAny creates a dialer that connects to the first available of the given
+// endpoints, which are listed in order of preference. If a connection attempt
+// fails the next endpoint is tried, until one succeeds or all have failed.
+// See FailoverPolicy for how the endpoints are chosen.
+func DialAny(hosts []string, policy FailoverPolicy) (*Failover, error) {
+	if len(hosts) == 0 {
+		return nil, errors.New("no hosts configured")
+	}
+	if policy.FailbackInterval < 0 {
+		return nil, fmt.Errorf("negative failback interval %v", policy.FailbackInterval)
+	}
+	if policy.Dialer == nil {
+		policy.Dialer = NetDialer(DefaultFailoverTimeout)
+	}
+
+	f := &Failover{
+		hosts:  append([]string(nil), hosts...),
+		policy: policy,
+		now:    time.Now,
+	}
+	if reg := policy.Registry; reg != nil {
+		f.activeHost = monitoring.NewString(reg, "active")
+		f.failovers = monitoring.NewUint(reg, "failovers")
+		f.failbacks = monitoring.NewUint(reg, "failbacks")
+		f.dialErrors = monitoring.NewUint(reg, "dial.errors")
+	}
+	return f, nil
+}
+
+// Active returns the endpoint connected to last, or the preferred endpoint if
+// no connection has been established yet.
+func (f *Failover) Active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hosts[f.active]
+}
+
+var _ Dialer = (*Failover)(nil)
+
+// Dial connects to one of the endpoints, the address is ignored.
+func (f *Failover) Dial(network, address string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to one of the endpoints using the provided context,
+// the address is ignored. If all endpoints fail, the errors of all attempts
+// are returned.
+func (f *Failover) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	start := f.first()
+
+	var errs []error
+	for i := range f.hosts {
+		idx := (start + i) % len(f.hosts)
+		conn, err := f.policy.Dialer.DialContext(ctx, network, f.hosts[idx])
+		if err == nil {
+			f.connected(start, idx)
+			return conn, nil
+		}
+
+		if f.dialErrors != nil {
+			f.dialErrors.Inc()
+		}
+		errs = append(errs, fmt.Errorf("dial %v: %w", f.hosts[idx], err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// first returns the index of the endpoint to try first.
+func (f *Failover) first() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.policy.Sticky || f.active == 0 {
+		return 0
+	}
+	if interval := f.policy.FailbackInterval; interval > 0 && f.now().Sub(f.failedOverAt) >= interval {
+		return 0
+	}
+	return f.active
+}
+
+// connected records a successful connection to the endpoint idx, after
+// starting with the endpoint start.
+func (f *Failover) connected(start, idx int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// restart the failback timer after falling back from the preferred
+	// endpoint, including failed failback attempts.
+	if idx != 0 && start == 0 {
+		f.failedOverAt = f.now()
+	}
+
+	if idx != f.active {
+		if idx < f.active {
+			if f.failbacks != nil {
+				f.failbacks.Inc()
+			}
+		} else if f.failovers != nil {
+			f.failovers.Inc()
+		}
+		f.active = idx
+	}
+	if f.activeHost != nil {
+		f.activeHost.Set(f.hosts[idx])
+	}
+}
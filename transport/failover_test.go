@@ -0,0 +1,188 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// testEndpoints is a dialer connecting to the hosts marked as up.
+type testEndpoints struct {
+	mu     sync.Mutex
+	up     map[string]bool
+	dialed []string
+}
+
+func newTestEndpoints(up ...string) *testEndpoints {
+	e := &testEndpoints{up: map[string]bool{}}
+	e.set(true, up...)
+	return e
+}
+
+func (e *testEndpoints) set(up bool, hosts ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, host := range hosts {
+		e.up[host] = up
+	}
+}
+
+func (e *testEndpoints) dial(_ context.Context, _, address string) (net.Conn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dialed = append(e.dialed, address)
+	if !e.up[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func (e *testEndpoints) takeDialed() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	dialed := e.dialed
+	e.dialed = nil
+	return dialed
+}
+
+func dialFailover(t *testing.T, f *Failover) {
+	t.Helper()
+	// the address is ignored in favor of the endpoints
+	var d Dialer = f
+	conn, err := d.DialContext(t.Context(), "tcp", "ignored:9200")
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestDialAnyNotSticky(t *testing.T) {
+	endpoints := newTestEndpoints("b", "c")
+	f, err := DialAny([]string{"a", "b", "c"}, FailoverPolicy{Dialer: DialerFunc(endpoints.dial)})
+	require.NoError(t, err)
+
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a", "b"}, endpoints.takeDialed())
+	assert.Equal(t, "b", f.Active())
+
+	// every dial starts with the preferred endpoint
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a", "b"}, endpoints.takeDialed())
+
+	endpoints.set(true, "a")
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a"}, endpoints.takeDialed())
+	assert.Equal(t, "a", f.Active())
+}
+
+func TestDialAnySticky(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	endpoints := newTestEndpoints("a", "b", "c")
+	f, err := DialAny([]string{"a", "b", "c"}, FailoverPolicy{
+		Dialer:           DialerFunc(endpoints.dial),
+		Sticky:           true,
+		FailbackInterval: time.Minute,
+		Registry:         reg,
+	})
+	require.NoError(t, err)
+	now := time.Now()
+	f.now = func() time.Time { return now }
+
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a"}, endpoints.takeDialed())
+
+	endpoints.set(false, "a")
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a", "b"}, endpoints.takeDialed())
+
+	// the preferred endpoint recovered, but the failback interval has not
+	// passed yet
+	endpoints.set(true, "a")
+	now = now.Add(30 * time.Second)
+	dialFailover(t, f)
+	assert.Equal(t, []string{"b"}, endpoints.takeDialed())
+
+	// the failover endpoint fails, the remaining endpoints are tried in
+	// order, wrapping around
+	endpoints.set(false, "a", "b")
+	dialFailover(t, f)
+	assert.Equal(t, []string{"b", "c"}, endpoints.takeDialed())
+	assert.Equal(t, "c", f.Active())
+
+	// failing back fails, wait for another interval
+	now = now.Add(time.Minute)
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a", "b", "c"}, endpoints.takeDialed())
+	now = now.Add(30 * time.Second)
+	dialFailover(t, f)
+	assert.Equal(t, []string{"c"}, endpoints.takeDialed())
+
+	endpoints.set(true, "a")
+	now = now.Add(30 * time.Second)
+	dialFailover(t, f)
+	assert.Equal(t, []string{"a"}, endpoints.takeDialed())
+	assert.Equal(t, "a", f.Active())
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.Equal(t, "a", snapshot.Strings["active"])
+	assert.EqualValues(t, 2, snapshot.Ints["failovers"])
+	assert.EqualValues(t, 1, snapshot.Ints["failbacks"])
+	assert.EqualValues(t, 4, snapshot.Ints["dial.errors"])
+}
+
+func TestDialAnyAllFailed(t *testing.T) {
+	endpoints := newTestEndpoints()
+	f, err := DialAny([]string{"a", "b"}, FailoverPolicy{Dialer: DialerFunc(endpoints.dial)})
+	require.NoError(t, err)
+
+	_, err = f.Dial("tcp", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dial a: connection refused")
+	assert.Contains(t, err.Error(), "dial b: connection refused")
+	assert.Equal(t, "a", f.Active())
+
+	_, err = DialAny(nil, FailoverPolicy{})
+	assert.Error(t, err)
+}
+
+func TestDialAnyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var dialed []string
+	f, err := DialAny([]string{"a", "b"}, FailoverPolicy{
+		Dialer: DialerFunc(func(ctx context.Context, _, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			cancel()
+			return nil, ctx.Err()
+		}),
+	})
+	require.NoError(t, err)
+
+	_, err = f.DialContext(ctx, "tcp", "")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"a"}, dialed)
+}
@@ -0,0 +1,201 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// DefaultFallbackDelay is the delay between connection attempts used by
+// HappyEyeballsDialer if no delay is configured. This is the connection
+// attempt delay recommended by RFC 8305.
+const DefaultFallbackDelay = 250 * time.Millisecond
+
+// HappyEyeballsDialer creates a dialer that resolves the host and dials its
+// IPv6 and IPv4 addresses in parallel, following RFC 8305. See
+// DialHappyEyeballs for details. If resolver is nil, net.DefaultResolver is
+// used.
+func HappyEyeballsDialer(timeout, fallbackDelay time.Duration, resolver Resolver) Dialer {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return happyEyeballsDialer(&net.Dialer{Timeout: timeout}, fallbackDelay, resolver)
+}
+
+func happyEyeballsDialer(dialer *net.Dialer, fallbackDelay time.Duration, resolver Resolver) Dialer {
+	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		switch network {
+		case "tcp", "tcp4", "tcp6":
+		default:
+			return nil, fmt.Errorf("unsupported network type %v", network)
+		}
+
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		addresses, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			logp.NewLogger(logSelector).Warnf(`DNS lookup failure "%s": %+v`, host, err)
+			return nil, err
+		}
+
+		return DialHappyEyeballs(ctx, dialer, network, host, addresses, port, fallbackDelay)
+	})
+}
+
+// DialHappyEyeballs dials the given addresses of a host, returning the first
+// connection established.
+//
+// The addresses are ordered by alternating between IPv6 and IPv4, starting
+// with IPv6. Addresses of the same family are shuffled to spread the load
+// between them. A new connection attempt is started every fallbackDelay, or
+// as soon as the previous attempt failed, without waiting for the pending
+// attempts. This way a host with broken IPv6 connectivity does not have to
+// wait for the full timeout before the IPv4 addresses are tried.
+//
+// Addresses not matching the network, e.g. IPv6 addresses for tcp4, are
+// ignored. If fallbackDelay is <= 0, DefaultFallbackDelay is used.
+func DialHappyEyeballs(
+	ctx context.Context,
+	dialer Dialer,
+	network, host string,
+	addresses []string,
+	port string,
+	fallbackDelay time.Duration,
+) (net.Conn, error) {
+	addresses = interleaveAddresses(network, addresses)
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no route to host %v", host)
+	}
+	if fallbackDelay <= 0 {
+		fallbackDelay = DefaultFallbackDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	// buffered, such that attempts finishing after we returned never block
+	results := make(chan result, len(addresses))
+
+	next, pending := 0, 0
+	startAttempt := func() {
+		address := net.JoinHostPort(addresses[next], port)
+		next++
+		pending++
+		go func() {
+			conn, err := dialer.DialContext(ctx, network, address)
+			results <- result{conn, err}
+		}()
+	}
+
+	// closePending closes connections established by attempts still
+	// pending once they finish.
+	closePending := func() {
+		go func(n int) {
+			for ; n > 0; n-- {
+				if r := <-results; r.conn != nil {
+					r.conn.Close()
+				}
+			}
+		}(pending)
+	}
+
+	startAttempt()
+	timer := time.NewTimer(fallbackDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				closePending()
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+
+			if next < len(addresses) {
+				startAttempt()
+				timer.Reset(fallbackDelay)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+
+		case <-timer.C:
+			if next < len(addresses) {
+				startAttempt()
+				timer.Reset(fallbackDelay)
+			}
+
+		case <-ctx.Done():
+			closePending()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// interleaveAddresses filters the addresses by the network's address family
+// and orders them by alternating between IPv6 and IPv4 addresses.
+func interleaveAddresses(network string, addresses []string) []string {
+	var v4, v6 []string
+	for _, addr := range addresses {
+		ip := net.ParseIP(addr)
+		if ip != nil && ip.To4() == nil {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(network, "4"):
+		v6 = nil
+	case strings.HasSuffix(network, "6"):
+		v4 = nil
+	}
+
+	rand.Shuffle(len(v4), func(i, j int) { v4[i], v4[j] = v4[j], v4[i] })
+	rand.Shuffle(len(v6), func(i, j int) { v6[i], v6[j] = v6[j], v6[i] })
+
+	ordered := make([]string, 0, len(v4)+len(v6))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			ordered = append(ordered, v6[i])
+		}
+		if i < len(v4) {
+			ordered = append(ordered, v4[i])
+		}
+	}
+	return ordered
+}
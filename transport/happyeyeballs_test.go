@@ -0,0 +1,175 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+// fakeDialer returns pipe connections. Addresses in hang block until the
+// context is cancelled, addresses in fail return an error immediately.
+type fakeDialer struct {
+	hang map[string]bool
+	fail map[string]bool
+
+	mu       sync.Mutex
+	attempts []string
+	conns    []net.Conn
+}
+
+func (d *fakeDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, _ := net.SplitHostPort(address)
+	d.mu.Lock()
+	d.attempts = append(d.attempts, host)
+	d.mu.Unlock()
+
+	switch {
+	case d.hang[host]:
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case d.fail[host]:
+		return nil, errors.New("connection refused")
+	}
+
+	client, server := net.Pipe()
+	d.mu.Lock()
+	d.conns = append(d.conns, server)
+	d.mu.Unlock()
+	return &addrConn{Conn: client, remote: host}, nil
+}
+
+func (d *fakeDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+func (d *fakeDialer) getAttempts() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.attempts...)
+}
+
+type addrConn struct {
+	net.Conn
+	remote string
+}
+
+func TestDialHappyEyeballs(t *testing.T) {
+	t.Run("falls back to IPv4 if IPv6 hangs", func(t *testing.T) {
+		d := &fakeDialer{hang: map[string]bool{"::1": true}}
+
+		start := time.Now()
+		conn, err := DialHappyEyeballs(context.Background(), d, "tcp", "host", []string{"127.0.0.1", "::1"}, "80", 50*time.Millisecond)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, "127.0.0.1", conn.(*addrConn).remote)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.Equal(t, []string{"::1", "127.0.0.1"}, d.getAttempts())
+	})
+
+	t.Run("next attempt starts when previous fails", func(t *testing.T) {
+		d := &fakeDialer{fail: map[string]bool{"::1": true}}
+
+		start := time.Now()
+		conn, err := DialHappyEyeballs(context.Background(), d, "tcp", "host", []string{"::1", "127.0.0.1"}, "80", time.Hour)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, "127.0.0.1", conn.(*addrConn).remote)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("all attempts fail", func(t *testing.T) {
+		d := &fakeDialer{fail: map[string]bool{"::1": true, "127.0.0.1": true}}
+
+		_, err := DialHappyEyeballs(context.Background(), d, "tcp", "host", []string{"::1", "127.0.0.1"}, "80", time.Hour)
+		assert.ErrorContains(t, err, "connection refused")
+		assert.Len(t, d.getAttempts(), 2)
+	})
+
+	t.Run("no addresses", func(t *testing.T) {
+		_, err := DialHappyEyeballs(context.Background(), &fakeDialer{}, "tcp", "host", nil, "80", 0)
+		assert.ErrorContains(t, err, "no route to host host")
+	})
+
+	t.Run("filters by network", func(t *testing.T) {
+		d := &fakeDialer{}
+		conn, err := DialHappyEyeballs(context.Background(), d, "tcp6", "host", []string{"127.0.0.1", "::1"}, "80", 0)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, "::1", conn.(*addrConn).remote)
+
+		_, err = DialHappyEyeballs(context.Background(), d, "tcp4", "host", []string{"::1"}, "80", 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		d := &fakeDialer{hang: map[string]bool{"::1": true, "127.0.0.1": true}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := DialHappyEyeballs(ctx, d, "tcp", "host", []string{"::1", "127.0.0.1"}, "80", 10*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestInterleaveAddresses(t *testing.T) {
+	addresses := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "fe80::1", "fe80::2"}
+
+	ordered := interleaveAddresses("tcp", addresses)
+	require.Len(t, ordered, 5)
+	for i, addr := range ordered {
+		isV6 := net.ParseIP(addr).To4() == nil
+		assert.Equal(t, i%2 == 0 && i < 4, isV6, "unexpected order %v", ordered)
+	}
+	assert.ElementsMatch(t, addresses, ordered)
+
+	assert.ElementsMatch(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, interleaveAddresses("tcp4", addresses))
+	assert.ElementsMatch(t, []string{"fe80::1", "fe80::2"}, interleaveAddresses("tcp6", addresses))
+}
+
+func TestHappyEyeballsDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	dialer, err := MakeDialer(Config{Timeout: 5 * time.Second, FallbackDelay: 10 * time.Millisecond}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	conn, err := dialer.DialContext(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	_, err = dialer.DialContext(context.Background(), "udp", ln.Addr().String())
+	assert.ErrorContains(t, err, "unsupported network type udp")
+}
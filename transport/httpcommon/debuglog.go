@@ -0,0 +1,254 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+const redacted = "<redacted>"
+
+// sensitiveHeaders are always redacted by the debug logging round tripper.
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// sensitiveQueryParams are query parameters commonly carrying credentials,
+// like OAuth tokens or the signatures of pre-signed URLs. They are always
+// redacted by the debug logging round tripper, compared case insensitively.
+var sensitiveQueryParams = map[string]struct{}{
+	"access_token":         {},
+	"api_key":              {},
+	"apikey":               {},
+	"client_secret":        {},
+	"id_token":             {},
+	"key":                  {},
+	"password":             {},
+	"refresh_token":        {},
+	"secret":               {},
+	"sig":                  {},
+	"signature":            {},
+	"token":                {},
+	"x-amz-credential":     {},
+	"x-amz-security-token": {},
+	"x-amz-signature":      {},
+	"x-goog-credential":    {},
+	"x-goog-signature":     {},
+}
+
+// WithDebugLogging logs every request and response at debug level using the
+// `http` selector: method, URL, headers, status code and latency. The values
+// of the Authorization, Proxy-Authorization, Cookie and Set-Cookie headers,
+// of API key headers like X-Api-Key, and of the given headers are redacted.
+// So are the password of the URL and the values of query parameters carrying
+// credentials, like access_token, api_key or sig, or with names containing
+// token, secret, password or signature.
+func WithDebugLogging(logger *logp.Logger, redactHeaders ...string) TransportOption {
+	return WithDebugBodyLogging(logger, 0, redactHeaders...)
+}
+
+// WithDebugBodyLogging is like WithDebugLogging, but logs the request and
+// response bodies as well, up to maxBodySize bytes each. Request bodies are
+// only logged if they can be recreated using http.Request.GetBody.
+func WithDebugBodyLogging(logger *logp.Logger, maxBodySize int, redactHeaders ...string) TransportOption {
+	if logger == nil {
+		logger = logp.NewLogger("")
+	}
+	redact := make(map[string]struct{}, len(sensitiveHeaders)+len(redactHeaders))
+	for _, headers := range [][]string{sensitiveHeaders, redactHeaders} {
+		for _, h := range headers {
+			redact[http.CanonicalHeaderKey(h)] = struct{}{}
+		}
+	}
+
+	return WithModRoundtripper(func(rt http.RoundTripper) http.RoundTripper {
+		return &debugRoundTripper{
+			rt:          rt,
+			logger:      logger.Named("http"),
+			redact:      redact,
+			maxBodySize: maxBodySize,
+		}
+	})
+}
+
+type debugRoundTripper struct {
+	rt          http.RoundTripper
+	logger      *logp.Logger
+	redact      map[string]struct{}
+	maxBodySize int
+}
+
+func (rt *debugRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.logger.IsDebug() {
+		return rt.rt.RoundTrip(req)
+	}
+
+	fields := []interface{}{
+		"http.request.method", req.Method,
+		"url.full", redactURL(req.URL),
+		"http.request.headers", rt.headers(req.Header),
+	}
+	if rt.maxBodySize > 0 && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := readCapped(body, rt.maxBodySize)
+			body.Close()
+			fields = append(fields, rt.bodyFields("http.request.body", content)...)
+		}
+	}
+
+	start := time.Now()
+	resp, err := rt.rt.RoundTrip(req)
+	fields = append(fields, "event.duration", time.Since(start))
+	if err != nil {
+		rt.logger.Debugw("HTTP request failed", append(fields, "error", err)...)
+		return resp, err
+	}
+
+	fields = append(fields,
+		"http.response.status_code", resp.StatusCode,
+		"http.response.headers", rt.headers(resp.Header),
+	)
+	if rt.maxBodySize > 0 && resp.Body != nil && resp.Body != http.NoBody {
+		content, err := readCapped(resp.Body, rt.maxBodySize)
+		fields = append(fields, rt.bodyFields("http.response.body", content)...)
+		if err != nil {
+			fields = append(fields, "error", err)
+		}
+
+		// the consumer reads the complete body, including the logged part
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(content), &errReader{resp.Body, err}), resp.Body}
+	}
+	rt.logger.Debugw("HTTP request completed", fields...)
+	return resp, nil
+}
+
+func (rt *debugRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// headers returns a copy of the headers with sensitive values redacted.
+func (rt *debugRoundTripper) headers(h http.Header) http.Header {
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if rt.isSensitive(k) {
+			out[k] = []string{redacted}
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func (rt *debugRoundTripper) isSensitive(header string) bool {
+	if _, ok := rt.redact[http.CanonicalHeaderKey(header)]; ok {
+		return true
+	}
+	lower := strings.ToLower(header)
+	return strings.Contains(lower, "api-key") || strings.Contains(lower, "apikey")
+}
+
+// redactURL returns the URL with the password and the values of sensitive
+// query parameters redacted. The other parameters are kept as they are.
+func redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+
+	params := strings.Split(u.RawQuery, "&")
+	changed := false
+	for i, param := range params {
+		rawName, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if hasValue && isSensitiveQueryParam(name) {
+			params[i] = rawName + "=" + redacted
+			changed = true
+		}
+	}
+	if !changed {
+		return u.Redacted()
+	}
+
+	cp := *u
+	cp.RawQuery = strings.Join(params, "&")
+	return cp.Redacted()
+}
+
+func isSensitiveQueryParam(name string) bool {
+	lower := strings.ToLower(name)
+	if _, ok := sensitiveQueryParams[lower]; ok {
+		return true
+	}
+	for _, s := range []string{"token", "secret", "password", "signature", "api_key", "apikey", "api-key"} {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *debugRoundTripper) bodyFields(prefix string, content []byte) []interface{} {
+	truncated := len(content) > rt.maxBodySize
+	if truncated {
+		content = content[:rt.maxBodySize]
+	}
+	return []interface{}{prefix + ".content", string(content), prefix + ".truncated", truncated}
+}
+
+// readCapped reads up to limit+1 bytes from r, such that it can be detected
+// if the content exceeds the limit.
+func readCapped(r io.Reader, limit int) ([]byte, error) {
+	buf := make([]byte, limit+1)
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// errReader returns err, if set, instead of reading from r. It passes a
+// read error encountered while logging the body on to the consumer.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	return e.r.Read(p)
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// HTTP2Settings configures HTTP/2 support of the transport.
+type HTTP2Settings struct {
+	// Enabled negotiates HTTP/2 for TLS connections, falling back to
+	// HTTP/1.1 if the server does not support HTTP/2.
+	Enabled bool `config:"enabled" yaml:"enabled,omitempty" json:"enabled,omitempty"`
+
+	// H2C forces HTTP/2 for all connections, using HTTP/2 over cleartext
+	// (h2c) with prior knowledge for http URLs. HTTP/1.1 is not used.
+	H2C bool `config:"h2c" yaml:"h2c,omitempty" json:"h2c,omitempty"`
+
+	// MaxConcurrentStreams limits the number of requests sent concurrently
+	// to a host, and with it the number of concurrent streams of every HTTP/2
+	// connection. Further requests wait for a request to complete. Requests
+	// falling back to HTTP/1.1 are limited as well. If 0, only the limit
+	// announced by the server applies.
+	MaxConcurrentStreams int `config:"max_concurrent_streams" yaml:"max_concurrent_streams,omitempty" json:"max_concurrent_streams,omitempty"`
+
+	// PingPeriod is the time after which a ping is sent to check the health
+	// of a connection no frames have been received on. Disabled if 0.
+	PingPeriod time.Duration `config:"ping_period" yaml:"ping_period,omitempty" json:"ping_period,omitempty"`
+
+	// PingTimeout is the time to wait for a ping response before the
+	// connection is closed. Uses the default of the net/http package if 0.
+	PingTimeout time.Duration `config:"ping_timeout" yaml:"ping_timeout,omitempty" json:"ping_timeout,omitempty"`
+}
+
+// Validate checks the settings are not negative.
+func (s *HTTP2Settings) Validate() error {
+	if s.MaxConcurrentStreams < 0 || s.PingPeriod < 0 || s.PingTimeout < 0 {
+		return errors.New("http2 settings must not be negative")
+	}
+	return nil
+}
+
+func (s *HTTP2Settings) enabled() bool {
+	return s.Enabled || s.H2C
+}
+
+// nextProtos returns the protocols offered via ALPN during TLS handshakes.
+func (s *HTTP2Settings) nextProtos() []string {
+	if s.H2C {
+		return []string{"h2"}
+	}
+	return []string{"h2", "http/1.1"}
+}
+
+// configure enables HTTP/2 on the transport.
+func (s *HTTP2Settings) configure(t *http.Transport) {
+	if !s.enabled() {
+		return
+	}
+
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP2(true)
+	if s.H2C {
+		t.Protocols.SetUnencryptedHTTP2(true)
+	} else {
+		t.Protocols.SetHTTP1(true)
+	}
+
+	t.HTTP2 = &http.HTTP2Config{
+		SendPingTimeout: s.PingPeriod,
+		PingTimeout:     s.PingTimeout,
+	}
+}
+
+// roundTripper limits the number of concurrent requests per host to
+// MaxConcurrentStreams.
+func (s *HTTP2Settings) roundTripper(rt http.RoundTripper) http.RoundTripper {
+	if !s.enabled() || s.MaxConcurrentStreams <= 0 {
+		return rt
+	}
+	return &streamLimitRoundTripper{rt: rt, limit: s.MaxConcurrentStreams, hosts: map[string]chan struct{}{}}
+}
+
+// streamLimitRoundTripper limits the number of concurrent requests per host.
+// A request counts until its response body has been read completely or
+// closed.
+type streamLimitRoundTripper struct {
+	rt    http.RoundTripper
+	limit int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (rt *streamLimitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	key := req.URL.Scheme + "://" + req.URL.Host
+	sem, ok := rt.hosts[key]
+	if !ok {
+		sem = make(chan struct{}, rt.limit)
+		rt.hosts[key] = sem
+	}
+	rt.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+	case <-req.Context().Done():
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, req.Context().Err()
+	}
+	release := sync.OnceFunc(func() { <-sem })
+
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		release()
+		return resp, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (rt *streamLimitRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// releasingBody calls release once the body has been read completely or
+// closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// tlsDialer creates a TLS dialer offering HTTP/2 via ALPN.
+func (s *HTTP2Settings) tlsDialer(dialer transport.Dialer, config *tlscommon.TLSConfig, timeout time.Duration) (transport.Dialer, error) {
+	h2, err := transport.TLSDialerH2(dialer, config, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	alpn := &tls.Config{NextProtos: s.nextProtos()} //nolint:gosec // only used to pass NextProtos
+	return transport.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return h2.DialContext(ctx, network, address, alpn)
+	}), nil
+}
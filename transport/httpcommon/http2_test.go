@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+}
+
+func getProto(t *testing.T, settings HTTPTransportSettings, url string) string {
+	t.Helper()
+
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	resp, err := client.Get(url) //nolint:noctx // It is a test
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ReadAll(resp)
+	require.NoError(t, err)
+	assert.Equal(t, resp.Proto, string(body))
+	return resp.Proto
+}
+
+func TestHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(protoHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+
+	assert.Equal(t, "HTTP/1.1", getProto(t, settings, server.URL))
+
+	settings.HTTP2 = HTTP2Settings{Enabled: true, PingPeriod: time.Second, MaxConcurrentStreams: 10}
+	assert.Equal(t, "HTTP/2.0", getProto(t, settings, server.URL))
+}
+
+func TestHTTP2FallbackToHTTP1(t *testing.T) {
+	server := httptest.NewTLSServer(protoHandler())
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+	settings.HTTP2.Enabled = true
+
+	assert.Equal(t, "HTTP/1.1", getProto(t, settings, server.URL))
+}
+
+func TestH2C(t *testing.T) {
+	server := httptest.NewUnstartedServer(protoHandler())
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetHTTP1(true)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	assert.Equal(t, "HTTP/1.1", getProto(t, settings, server.URL))
+
+	settings.HTTP2.H2C = true
+	assert.Equal(t, "HTTP/2.0", getProto(t, settings, server.URL))
+}
+
+func TestHTTP2MaxConcurrentStreams(t *testing.T) {
+	const limit = 2
+
+	var inflight, maxInflight atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			m := maxInflight.Load()
+			if n <= m || maxInflight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		fmt.Fprint(w, r.Proto)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+	settings.HTTP2 = HTTP2Settings{Enabled: true, MaxConcurrentStreams: limit}
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3*limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL) //nolint:noctx // It is a test
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, err := ReadAll(resp)
+			assert.NoError(t, err)
+			assert.Equal(t, "HTTP/2.0", string(body))
+		}()
+	}
+
+	require.Eventually(t, func() bool { return inflight.Load() == limit }, 5*time.Second, time.Millisecond)
+	// the other requests are held back by the client
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, limit, inflight.Load())
+
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, limit, maxInflight.Load())
+}
+
+func TestUnpackHTTP2(t *testing.T) {
+	cfg, err := config.NewConfigFrom(`
+http2:
+  enabled: true
+  max_concurrent_streams: 50
+  ping_period: 30s
+`)
+	require.NoError(t, err)
+
+	var settings HTTPTransportSettings
+	require.NoError(t, cfg.Unpack(&settings))
+	assert.Equal(t, HTTP2Settings{Enabled: true, MaxConcurrentStreams: 50, PingPeriod: 30 * time.Second}, settings.HTTP2)
+
+	cfg, err = config.NewConfigFrom(`http2.ping_timeout: -1s`)
+	require.NoError(t, err)
+	assert.Error(t, cfg.Unpack(&settings))
+}
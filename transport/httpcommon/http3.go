@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const defaultHTTP3FallbackPeriod = 5 * time.Minute
+
+// HTTP3Settings configures the experimental HTTP/3 support.
+//
+// If enabled, HTTPS requests are sent via HTTP/3 over QUIC first. If the QUIC
+// connection can not be established, e.g. because UDP is blocked, the
+// request is sent using HTTP/1.1 or HTTP/2 instead, and HTTP/3 is not
+// attempted again for the host during the fallback period. Requests failing
+// once the connection has been established are not sent again. Requests with
+// a body can only fall back if their body can be read again, see
+// http.Request.GetBody.
+//
+// Requests using a proxy always use HTTP/1.1 or HTTP/2. Custom dialers and
+// dialer options, like WithIOStats, do not apply to HTTP/3 connections.
+// HTTP/3 is not used with WithHTTP2Only.
+type HTTP3Settings struct {
+	Enabled bool `config:"enabled" yaml:"enabled,omitempty" json:"enabled,omitempty"`
+
+	// HandshakeTimeout is the idle timeout of the QUIC handshake, before
+	// falling back to HTTP/1.1 or HTTP/2. Defaults to 5s.
+	HandshakeTimeout time.Duration `config:"handshake_timeout" yaml:"handshake_timeout,omitempty" json:"handshake_timeout,omitempty"`
+
+	// KeepAlivePeriod configures sending of keep-alive packets on idle QUIC
+	// connections. Disabled if not set.
+	KeepAlivePeriod time.Duration `config:"keep_alive_period" yaml:"keep_alive_period,omitempty" json:"keep_alive_period,omitempty"`
+
+	// FallbackPeriod is the time HTTP/3 is not attempted for a host after
+	// establishing a connection failed. Defaults to 5m.
+	FallbackPeriod time.Duration `config:"fallback_period" yaml:"fallback_period,omitempty" json:"fallback_period,omitempty"`
+}
+
+// Validate checks the HTTP/3 settings.
+func (s *HTTP3Settings) Validate() error {
+	if s.HandshakeTimeout < 0 || s.KeepAlivePeriod < 0 || s.FallbackPeriod < 0 {
+		return errors.New("http3 settings must not be negative")
+	}
+	return nil
+}
+
+// roundTripper returns a round tripper sending HTTPS requests via HTTP/3,
+// falling back to the given round tripper.
+func (s *HTTP3Settings) roundTripper(
+	config *tlscommon.TLSConfig,
+	fallback http.RoundTripper,
+	proxy func(*http.Request) (*url.URL, error),
+) (http.RoundTripper, error) {
+	if config != nil && len(config.Versions) > 0 && !slices.Contains(config.Versions, tlscommon.TLSVersion13) {
+		return nil, errors.New("http3 requires TLS 1.3 to be enabled")
+	}
+
+	fallbackPeriod := s.FallbackPeriod
+	if fallbackPeriod == 0 {
+		fallbackPeriod = defaultHTTP3FallbackPeriod
+	}
+
+	return &http3RoundTripper{
+		h3: &http3.Transport{
+			QUICConfig: &quic.Config{
+				HandshakeIdleTimeout: s.HandshakeTimeout,
+				KeepAlivePeriod:      s.KeepAlivePeriod,
+			},
+			Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				moduleCfg := config.BuildModuleClientConfig(host)
+				moduleCfg.NextProtos = tlsCfg.NextProtos
+				// Wait for the handshake, so a connection failing to be
+				// established is always reported as dial error.
+				conn, err := quic.DialAddr(ctx, addr, moduleCfg, cfg)
+				if err != nil {
+					return nil, &http3DialError{err: err}
+				}
+				return conn, nil
+			},
+		},
+		fallback:       fallback,
+		proxy:          proxy,
+		fallbackPeriod: fallbackPeriod,
+		failed:         map[string]time.Time{},
+		now:            time.Now,
+	}, nil
+}
+
+type http3RoundTripper struct {
+	h3             *http3.Transport
+	fallback       http.RoundTripper
+	proxy          func(*http.Request) (*url.URL, error)
+	fallbackPeriod time.Duration
+
+	mu     sync.Mutex
+	failed map[string]time.Time
+	now    func() time.Time
+}
+
+func (rt *http3RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.useHTTP3(req) {
+		return rt.fallback.RoundTrip(req)
+	}
+
+	resp, err := rt.h3.RoundTrip(req)
+	var dialErr *http3DialError
+	if err == nil || req.Context().Err() != nil || !errors.As(err, &dialErr) {
+		// The request might have been sent already, it must not be sent again.
+		return resp, err
+	}
+
+	rt.mu.Lock()
+	rt.failed[req.URL.Host] = rt.now().Add(rt.fallbackPeriod)
+	rt.mu.Unlock()
+
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, err
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, errors.Join(err, bodyErr)
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return rt.fallback.RoundTrip(req)
+}
+
+// http3DialError reports the QUIC connection could not be established, so the
+// request has not been sent.
+type http3DialError struct {
+	err error
+}
+
+func (e *http3DialError) Error() string { return "http3: " + e.err.Error() }
+func (e *http3DialError) Unwrap() error { return e.err }
+
+func (rt *http3RoundTripper) useHTTP3(req *http.Request) bool {
+	if req.URL.Scheme != "https" {
+		return false
+	}
+	if rt.proxy != nil {
+		if proxy, err := rt.proxy(req); err != nil || proxy != nil {
+			return false
+		}
+	}
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if until, ok := rt.failed[req.URL.Host]; ok {
+		if rt.now().Before(until) {
+			return false
+		}
+		delete(rt.failed, req.URL.Host)
+	}
+	return true
+}
+
+func (rt *http3RoundTripper) CloseIdleConnections() {
+	rt.h3.CloseIdleConnections()
+	if c, ok := rt.fallback.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// newHTTP3TestServer starts a TLS server and, if withHTTP3 is set, a HTTP/3
+// server on the same port.
+func newHTTP3TestServer(t *testing.T, withHTTP3 bool) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewTLSServer(protoHandler())
+	t.Cleanup(server.Close)
+	if !withHTTP3 {
+		return server
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	conn, err := net.ListenUDP("udp", udpAddr)
+	require.NoError(t, err)
+
+	h3 := &http3.Server{
+		Handler:   protoHandler(),
+		TLSConfig: http3.ConfigureTLSConfig(server.TLS.Clone()),
+	}
+	go func() { _ = h3.Serve(conn) }()
+	t.Cleanup(func() {
+		h3.Close()
+		conn.Close()
+	})
+	return server
+}
+
+func http3TestSettings() HTTPTransportSettings {
+	settings := DefaultHTTPTransportSettings()
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+	settings.HTTP3 = HTTP3Settings{Enabled: true, HandshakeTimeout: 200 * time.Millisecond}
+	return settings
+}
+
+func TestHTTP3(t *testing.T) {
+	server := newHTTP3TestServer(t, true)
+
+	settings := http3TestSettings()
+	assert.Equal(t, "HTTP/3.0", getProto(t, settings, server.URL))
+
+	settings.HTTP3.Enabled = false
+	assert.Equal(t, "HTTP/1.1", getProto(t, settings, server.URL))
+}
+
+func TestHTTP3Fallback(t *testing.T) {
+	server := newHTTP3TestServer(t, false)
+
+	settings := http3TestSettings()
+	rt, err := settings.RoundTripper()
+	require.NoError(t, err)
+	h3, ok := rt.(*http3RoundTripper)
+	require.True(t, ok)
+	client := &http.Client{Transport: rt}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL, strings.NewReader("body"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+
+	// HTTP/3 is not attempted again during the fallback period
+	host := strings.TrimPrefix(server.URL, "https://")
+	require.Contains(t, h3.failed, host)
+	req, err = http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	assert.False(t, h3.useHTTP3(req))
+
+	h3.now = func() time.Time { return time.Now().Add(defaultHTTP3FallbackPeriod) }
+	assert.True(t, h3.useHTTP3(req))
+	assert.NotContains(t, h3.failed, host)
+}
+
+func TestHTTP3NoFallbackAfterSending(t *testing.T) {
+	var fallbackRequests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests.Add(1)
+	}))
+	t.Cleanup(server.Close)
+
+	udpAddr, err := net.ResolveUDPAddr("udp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	conn, err := net.ListenUDP("udp", udpAddr)
+	require.NoError(t, err)
+	var h3Requests atomic.Int32
+	h3 := &http3.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3Requests.Add(1)
+			_, _ = io.ReadAll(r.Body)
+			panic(http.ErrAbortHandler)
+		}),
+		TLSConfig: http3.ConfigureTLSConfig(server.TLS.Clone()),
+	}
+	go func() { _ = h3.Serve(conn) }()
+	t.Cleanup(func() {
+		h3.Close()
+		conn.Close()
+	})
+
+	settings := http3TestSettings()
+	rt, err := settings.RoundTripper()
+	require.NoError(t, err)
+	client := &http.Client{Transport: rt}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, server.URL, strings.NewReader("body"))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	require.Error(t, err)
+
+	// the request reached the server via HTTP/3 and is not sent again
+	assert.EqualValues(t, 1, h3Requests.Load())
+	assert.EqualValues(t, 0, fallbackRequests.Load())
+	assert.NotContains(t, rt.(*http3RoundTripper).failed, strings.TrimPrefix(server.URL, "https://"))
+}
+
+func TestHTTP3NotUsed(t *testing.T) {
+	server := newHTTP3TestServer(t, true)
+
+	t.Run("plain http", func(t *testing.T) {
+		plain := httptest.NewServer(protoHandler())
+		defer plain.Close()
+		assert.Equal(t, "HTTP/1.1", getProto(t, http3TestSettings(), plain.URL))
+	})
+
+	t.Run("proxy", func(t *testing.T) {
+		proxy := newTestProxy(t, func(int, string) (string, bool) { return "", true })
+		settings := http3TestSettings()
+		settings.Proxy.URL, _ = NewProxyURIFromString(proxy.URL())
+		assert.Equal(t, "HTTP/1.1", getProto(t, settings, server.URL))
+		assert.EqualValues(t, 1, proxy.connects.Load())
+	})
+}
+
+func TestHTTP3Config(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"http3.enabled":           true,
+		"http3.handshake_timeout": "2s",
+		"http3.fallback_period":   "1m",
+	})
+	settings := DefaultHTTPTransportSettings()
+	require.NoError(t, cfg.Unpack(&settings))
+	assert.Equal(t, HTTP3Settings{Enabled: true, HandshakeTimeout: 2 * time.Second, FallbackPeriod: time.Minute}, settings.HTTP3)
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{"http3.fallback_period": "-1m"})
+	require.Error(t, cfg.Unpack(&settings))
+
+	settings = http3TestSettings()
+	settings.TLS.Versions = []tlscommon.TLSVersion{tlscommon.TLSVersion12}
+	_, err := settings.RoundTripper()
+	require.Error(t, err)
+}
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"go.elastic.co/apm/module/apmhttp/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/net/http2"
 
 	"github.com/elastic/elastic-agent-libs/config"
@@ -43,18 +44,55 @@ type HTTPTransportSettings struct {
 	// TLS provides ssl/tls setup settings
 	TLS *tlscommon.Config `config:"ssl" yaml:"ssl,omitempty" json:"ssl,omitempty"`
 
-	// Timeout configures the `(http.Transport).Timeout`.
+	// Timeout configures the `(http.Client).Timeout`, limiting the total
+	// time of a request including reading the response body. It is also
+	// used as dial and TLS handshake timeout, if these are not set.
 	Timeout time.Duration `config:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"`
 
+	// DialTimeout limits the time to establish a TCP connection.
+	DialTimeout time.Duration `config:"dial_timeout" yaml:"dial_timeout,omitempty" json:"dial_timeout,omitempty"`
+
+	// TLSHandshakeTimeout limits the time of the TLS handshake.
+	TLSHandshakeTimeout time.Duration `config:"tls_handshake_timeout" yaml:"tls_handshake_timeout,omitempty" json:"tls_handshake_timeout,omitempty"`
+
+	// ResponseHeaderTimeout limits the time to wait for the response headers
+	// after the request has been written. Unlimited if not set.
+	ResponseHeaderTimeout time.Duration `config:"response_header_timeout" yaml:"response_header_timeout,omitempty" json:"response_header_timeout,omitempty"`
+
 	Proxy HTTPClientProxySettings `config:",inline" yaml:",inline"`
 
+	// IdleConnTimeout is the time an idle connection is kept open before it
+	// is closed. Defaults to 90s if not set.
 	IdleConnTimeout time.Duration `config:"idle_connection_timeout" yaml:"idle_connection_timeout,omitempty" json:"idle_connection_timeout,omitempty"`
 
+	// MaxIdleConns limits the number of idle connections across all hosts.
+	// Defaults to 100 if not set.
+	MaxIdleConns int `config:"max_idle_connections" yaml:"max_idle_connections,omitempty" json:"max_idle_connections,omitempty"`
+
+	// MaxIdleConnsPerHost limits the number of idle connections per host.
+	// Defaults to 2 if not set.
+	MaxIdleConnsPerHost int `config:"max_idle_connections_per_host" yaml:"max_idle_connections_per_host,omitempty" json:"max_idle_connections_per_host,omitempty"`
+
+	// MaxConnsPerHost limits the number of connections per host, including
+	// connections being dialed, active and idle. Requests wait for a
+	// connection once the limit is reached. Unlimited if not set.
+	MaxConnsPerHost int `config:"max_connections_per_host" yaml:"max_connections_per_host,omitempty" json:"max_connections_per_host,omitempty"`
+
+	// MaxResponseSize limits the size of response bodies in bytes. Reading a
+	// body exceeding the limit fails with a ResponseLimitError. Responses
+	// encoded with gzip or deflate are decoded, and the limit applies to the
+	// decoded body as well, unless the request sets Accept-Encoding to
+	// receive the encoded body. Unlimited if not set.
+	MaxResponseSize int64 `config:"max_response_size" yaml:"max_response_size,omitempty" json:"max_response_size,omitempty"`
+
+	// HTTP2 configures HTTP/2 support.
+	HTTP2 HTTP2Settings `config:"http2" yaml:"http2,omitempty" json:"http2,omitempty"`
+
+	// HTTP3 configures the experimental HTTP/3 support.
+	HTTP3 HTTP3Settings `config:"http3" yaml:"http3,omitempty" json:"http3,omitempty"`
+
 	// Add more settings:
 	//  - DisableKeepAlive
-	//  - MaxIdleConns
-	//  - ResponseHeaderTimeout
-	//  - ConnectionTimeout (currently 'Timeout' is used for both)
 }
 
 // WithKeepaliveSettings options can be used to modify the Keepalive
@@ -75,8 +113,9 @@ type (
 	TransportOption interface{ sealTransportOption() }
 
 	extraSettings struct {
-		logger *logp.Logger
-		http2  bool
+		logger             *logp.Logger
+		http2              bool
+		proxyAuthenticator ProxyAuthenticatorFactory
 	}
 
 	dialerOption interface {
@@ -168,12 +207,30 @@ func DefaultHTTPTransportSettings() HTTPTransportSettings {
 // Unpack reads a config object into the settings.
 func (settings *HTTPTransportSettings) Unpack(cfg *config.C) error {
 	tmp := struct {
-		TLS             *tlscommon.Config `config:"ssl"`
-		Timeout         time.Duration     `config:"timeout"`
-		IdleConnTimeout time.Duration     `config:"idle_connection_timeout"`
+		TLS                   *tlscommon.Config `config:"ssl"`
+		Timeout               time.Duration     `config:"timeout"`
+		DialTimeout           time.Duration     `config:"dial_timeout" validate:"min=0"`
+		TLSHandshakeTimeout   time.Duration     `config:"tls_handshake_timeout" validate:"min=0"`
+		ResponseHeaderTimeout time.Duration     `config:"response_header_timeout" validate:"min=0"`
+		IdleConnTimeout       time.Duration     `config:"idle_connection_timeout" validate:"min=0"`
+		MaxIdleConns          int               `config:"max_idle_connections" validate:"min=0"`
+		MaxIdleConnsPerHost   int               `config:"max_idle_connections_per_host" validate:"min=0"`
+		MaxConnsPerHost       int               `config:"max_connections_per_host" validate:"min=0"`
+		MaxResponseSize       int64             `config:"max_response_size" validate:"min=0"`
+		HTTP2                 HTTP2Settings     `config:"http2"`
+		HTTP3                 HTTP3Settings     `config:"http3"`
 	}{
-		Timeout:         settings.Timeout,
-		IdleConnTimeout: settings.IdleConnTimeout,
+		Timeout:               settings.Timeout,
+		DialTimeout:           settings.DialTimeout,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		MaxResponseSize:       settings.MaxResponseSize,
+		HTTP2:                 settings.HTTP2,
+		HTTP3:                 settings.HTTP3,
 	}
 
 	if err := cfg.Unpack(&tmp); err != nil {
@@ -193,14 +250,37 @@ func (settings *HTTPTransportSettings) Unpack(cfg *config.C) error {
 	}
 
 	*settings = HTTPTransportSettings{
-		TLS:             tmp.TLS,
-		Timeout:         tmp.Timeout,
-		Proxy:           proxy,
-		IdleConnTimeout: tmp.IdleConnTimeout,
+		TLS:                   tmp.TLS,
+		Timeout:               tmp.Timeout,
+		DialTimeout:           tmp.DialTimeout,
+		TLSHandshakeTimeout:   tmp.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tmp.ResponseHeaderTimeout,
+		Proxy:                 proxy,
+		IdleConnTimeout:       tmp.IdleConnTimeout,
+		MaxIdleConns:          tmp.MaxIdleConns,
+		MaxIdleConnsPerHost:   tmp.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       tmp.MaxConnsPerHost,
+		MaxResponseSize:       tmp.MaxResponseSize,
+		HTTP2:                 tmp.HTTP2,
+		HTTP3:                 tmp.HTTP3,
 	}
 	return nil
 }
 
+func (settings *HTTPTransportSettings) dialTimeout() time.Duration {
+	if settings.DialTimeout > 0 {
+		return settings.DialTimeout
+	}
+	return settings.Timeout
+}
+
+func (settings *HTTPTransportSettings) tlsHandshakeTimeout() time.Duration {
+	if settings.TLSHandshakeTimeout > 0 {
+		return settings.TLSHandshakeTimeout
+	}
+	return settings.Timeout
+}
+
 // RoundTripper creates a http.RoundTripper for use with http.Client.
 //
 // The dialers will registers with stats if given. Stats is used to collect metrics for io errors,
@@ -226,7 +306,7 @@ func (settings *HTTPTransportSettings) RoundTripper(opts ...TransportOption) (ht
 	}
 
 	if dialer == nil {
-		dialer = transport.NetDialer(settings.Timeout)
+		dialer = transport.NetDialer(settings.dialTimeout())
 	}
 
 	tls, err := tlscommon.LoadTLSConfig(settings.TLS, extra.logger)
@@ -234,28 +314,70 @@ func (settings *HTTPTransportSettings) RoundTripper(opts ...TransportOption) (ht
 		return nil, err
 	}
 
-	tlsDialer := transport.TLSDialer(dialer, tls, settings.Timeout, extra.logger)
-	for _, opt := range opts {
-		if dialOpt, ok := opt.(dialerModOption); ok {
-			dialer = dialOpt.applyDialer(settings, dialer)
-			tlsDialer = dialOpt.applyDialer(settings, tlsDialer)
+	// Proxies authenticating connections with a handshake are connected
+	// to by the dialers instead of the http.Transport.
+	var tunnel *proxyTunnel
+	tlsBaseDialer := dialer
+	if !settings.Proxy.Disable && settings.Proxy.Auth.handshake() {
+		tunnel, err = newProxyTunnel(&settings.Proxy, dialer, extra.proxyAuthenticator)
+		if err != nil {
+			return nil, err
 		}
+		dialer, tlsBaseDialer = tunnel.dialer("http"), tunnel.dialer("https")
 	}
 
-	if logger := extra.logger; logger != nil {
-		dialer = transport.LoggingDialer(dialer, logger)
-		tlsDialer = transport.LoggingDialer(tlsDialer, logger)
+	wrapDialer := func(d transport.Dialer) transport.Dialer {
+		for _, opt := range opts {
+			if dialOpt, ok := opt.(dialerModOption); ok {
+				d = dialOpt.applyDialer(settings, d)
+			}
+		}
+		if logger := extra.logger; logger != nil {
+			d = transport.LoggingDialer(d, logger)
+		}
+		return d
+	}
+
+	tlsDialer := wrapDialer(transport.TLSDialer(tlsBaseDialer, tls, settings.tlsHandshakeTimeout(), extra.logger))
+	dialer = wrapDialer(dialer)
+
+	// HTTP/2 requires the TLS connection not to be wrapped, such that the
+	// negotiated protocol can be read from it. TLS is applied on top of the
+	// wrapped dialer instead.
+	if settings.HTTP2.enabled() && !extra.http2 {
+		h2BaseDialer := dialer
+		if tunnel != nil {
+			h2BaseDialer = wrapDialer(tlsBaseDialer)
+		}
+		tlsDialer, err = settings.HTTP2.tlsDialer(h2BaseDialer, tls, settings.tlsHandshakeTimeout())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	var rt http.RoundTripper
 	if extra.http2 {
-		rt, err = settings.http2RoundTripper(tls, dialer, tlsDialer, opts...)
+		rt, err = settings.http2RoundTripper(tls, dialer, tlsDialer, tunnel, opts...)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		rt = settings.httpRoundTripper(tls, dialer, tlsDialer, opts...)
+		t := settings.httpRoundTripper(tls, dialer, tlsDialer, tunnel, opts...)
+		rt = settings.Proxy.roundTripper(t)
+
+		if settings.HTTP3.Enabled {
+			proxy := t.Proxy
+			if tunnel != nil {
+				proxy = tunnel.proxy
+			}
+			rt, err = settings.HTTP3.roundTripper(tls, rt, proxy)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
+	rt = settings.HTTP2.roundTripper(rt)
+	rt = settings.limitRoundTripper(rt)
 
 	for _, opt := range opts {
 		if rtOpt, ok := opt.(roundTripperOption); ok {
@@ -268,6 +390,7 @@ func (settings *HTTPTransportSettings) RoundTripper(opts ...TransportOption) (ht
 func (settings *HTTPTransportSettings) httpRoundTripper(
 	tls *tlscommon.TLSConfig,
 	dialer, tlsDialer transport.Dialer,
+	tunnel *proxyTunnel,
 	opts ...TransportOption,
 ) *http.Transport {
 	t := http.DefaultTransport.(*http.Transport).Clone()
@@ -276,11 +399,24 @@ func (settings *HTTPTransportSettings) httpRoundTripper(
 	t.TLSClientConfig = tls.ToConfig()
 	t.ForceAttemptHTTP2 = false
 	t.Proxy = settings.Proxy.ProxyFunc()
-	t.ProxyConnectHeader = settings.Proxy.Headers.Headers()
+	t.ProxyConnectHeader = settings.Proxy.connectHeaders()
 
 	//  reset some internal timeouts to not change old Beats defaults
-	t.TLSHandshakeTimeout = 0
+	t.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
 	t.ExpectContinueTimeout = 0
+	t.ResponseHeaderTimeout = settings.ResponseHeaderTimeout
+
+	// connection pool settings, keeping the http.DefaultTransport defaults if unset
+	if settings.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = settings.IdleConnTimeout
+	}
+	if settings.MaxIdleConns > 0 {
+		t.MaxIdleConns = settings.MaxIdleConns
+	}
+	t.MaxIdleConnsPerHost = settings.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = settings.MaxConnsPerHost
+
+	settings.HTTP2.configure(t)
 
 	for _, opt := range opts {
 		if transportOpt, ok := opt.(httpTransportOption); ok {
@@ -288,15 +424,20 @@ func (settings *HTTPTransportSettings) httpRoundTripper(
 		}
 	}
 
+	if tunnel != nil {
+		tunnel.proxy, t.Proxy = t.Proxy, nil
+	}
+
 	return t
 }
 
 func (settings *HTTPTransportSettings) http2RoundTripper(
 	tls *tlscommon.TLSConfig,
 	dialer, tlsDialer transport.Dialer,
+	tunnel *proxyTunnel,
 	opts ...TransportOption,
 ) (*http2.Transport, error) {
-	t1 := settings.httpRoundTripper(tls, dialer, tlsDialer, opts...)
+	t1 := settings.httpRoundTripper(tls, dialer, tlsDialer, tunnel, opts...)
 	t2, err := http2.ConfigureTransports(t1)
 	if err != nil {
 		return nil, err
@@ -404,6 +545,16 @@ func WithAPMHTTPInstrumentation() TransportOption {
 	return withAPMHTTPRountTripper
 }
 
+// WithOtelInstrumentation instruments the HTTP client via otelhttp.NewTransport.
+// A client span is created for every request and the trace context is
+// propagated via the request headers. The global TracerProvider and
+// TextMapPropagator are used, unless overridden by the given options.
+func WithOtelInstrumentation(opts ...otelhttp.Option) TransportOption {
+	return WithModRoundtripper(func(rt http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(rt, opts...)
+	})
+}
+
 // HeaderRoundTripper will return a RoundTripper that sets header KVs if the key is not present.
 func HeaderRoundTripper(rt http.RoundTripper, headers map[string]string) http.RoundTripper {
 	return &headerRoundTripper{headers, rt}
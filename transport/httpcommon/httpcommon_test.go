@@ -21,7 +21,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -56,6 +58,18 @@ timeout: 5s
 				Timeout:         5 * time.Second,
 			},
 		},
+		"phaseTimeouts": {
+			input: `
+dial_timeout: 2s
+tls_handshake_timeout: 3s
+response_header_timeout: 10s
+`,
+			expected: HTTPTransportSettings{
+				DialTimeout:           2 * time.Second,
+				TLSHandshakeTimeout:   3 * time.Second,
+				ResponseHeaderTimeout: 10 * time.Second,
+			},
+		},
 		"ssl": {
 			input: `
 ssl:
@@ -97,6 +111,86 @@ ssl:
 	}
 }
 
+func TestUnpackNegativeTimeout(t *testing.T) {
+	for _, name := range []string{"dial_timeout", "tls_handshake_timeout", "response_header_timeout", "idle_connection_timeout"} {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(map[string]interface{}{name: "-1s"})
+			settings := HTTPTransportSettings{}
+			require.Error(t, cfg.Unpack(&settings))
+		})
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	settings := DefaultHTTPTransportSettings()
+	settings.ResponseHeaderTimeout = 50 * time.Millisecond
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	_, err = client.Get(server.URL) //nolint:noctx,bodyclose // It is a test, no response on error
+	require.ErrorContains(t, err, "timeout awaiting response headers")
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	// The listener accepts connections but never completes the handshake.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	settings := DefaultHTTPTransportSettings()
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+	settings.TLSHandshakeTimeout = 50 * time.Millisecond
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.Get("https://" + l.Addr().String()) //nolint:noctx,bodyclose // It is a test, no response on error
+	require.Error(t, err)
+	require.Less(t, time.Since(start), settings.Timeout)
+}
+
+func TestPhaseTimeoutDefaults(t *testing.T) {
+	settings := DefaultHTTPTransportSettings()
+	require.Equal(t, settings.Timeout, settings.dialTimeout())
+	require.Equal(t, settings.Timeout, settings.tlsHandshakeTimeout())
+
+	settings.DialTimeout = time.Second
+	settings.TLSHandshakeTimeout = 2 * time.Second
+	require.Equal(t, time.Second, settings.dialTimeout())
+	require.Equal(t, 2*time.Second, settings.tlsHandshakeTimeout())
+
+	rt, err := settings.RoundTripper()
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Second, rt.(*http.Transport).IdleConnTimeout)
+
+	settings.IdleConnTimeout = 15 * time.Second
+	settings.ResponseHeaderTimeout = 10 * time.Second
+	rt, err = settings.RoundTripper()
+	require.NoError(t, err)
+	require.Equal(t, 15*time.Second, rt.(*http.Transport).IdleConnTimeout)
+	require.Equal(t, 10*time.Second, rt.(*http.Transport).ResponseHeaderTimeout)
+}
+
 func TestReadAllWithLimit(t *testing.T) {
 	size := 100
 	body := bytes.Repeat([]byte{'a'}, size)
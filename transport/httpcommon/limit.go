@@ -0,0 +1,180 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ResponseLimitError is returned when the size of a response body exceeds the
+// configured MaxResponseSize. It matches ErrResponseLimit via errors.Is.
+type ResponseLimitError struct {
+	Limit int64
+}
+
+func (e *ResponseLimitError) Error() string {
+	return fmt.Sprintf("response body exceeds the limit of %d bytes", e.Limit)
+}
+
+func (e *ResponseLimitError) Is(target error) bool {
+	return target == ErrResponseLimit
+}
+
+// limitRoundTripper enforces the maximum response body size. Responses
+// encoded with gzip or deflate are decoded, such that the limit applies to
+// the decoded body, unless the request set Accept-Encoding itself. Such
+// requests ask for the encoded body, which is returned as is, with the limit
+// applied to the encoded size.
+type limitRoundTripper struct {
+	rt    http.RoundTripper
+	limit int64
+}
+
+func (settings *HTTPTransportSettings) limitRoundTripper(rt http.RoundTripper) http.RoundTripper {
+	if settings.MaxResponseSize <= 0 {
+		return rt
+	}
+	return &limitRoundTripper{rt: rt, limit: settings.MaxResponseSize}
+}
+
+func (rt *limitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+
+	if resp.ContentLength > rt.limit {
+		resp.Body.Close()
+		return nil, &ResponseLimitError{Limit: rt.limit}
+	}
+
+	body := &limitedReader{r: resp.Body, remaining: rt.limit, limit: rt.limit}
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if req.Header.Get("Accept-Encoding") != "" {
+		encoding = ""
+	}
+	switch encoding {
+	case "gzip", "x-gzip", "deflate":
+		resp.Body = &decodedBody{
+			raw:      resp.Body,
+			encoding: encoding,
+			src:      body,
+			limit:    rt.limit,
+		}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	default:
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, resp.Body}
+	}
+	return resp, nil
+}
+
+func (rt *limitRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// limitedReader returns a ResponseLimitError once more than limit bytes
+// are read.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+	err       error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+
+	// read one byte more than allowed to detect if the limit is exceeded
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		l.err = &ResponseLimitError{Limit: l.limit}
+		return n, l.err
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// decodedBody decodes the limited body on the first read, limiting the
+// decoded size as well.
+type decodedBody struct {
+	raw      io.Closer
+	encoding string
+	src      io.Reader
+	limit    int64
+
+	decoder io.ReadCloser
+	r       io.Reader
+	err     error
+}
+
+func (b *decodedBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.decoder, b.err = newDecoder(b.encoding, b.src)
+		if b.err == nil {
+			b.r = &limitedReader{r: b.decoder, remaining: b.limit, limit: b.limit}
+		}
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.r.Read(p)
+}
+
+func (b *decodedBody) Close() error {
+	if b.decoder != nil {
+		b.decoder.Close()
+	}
+	return b.raw.Close()
+}
+
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	if encoding != "deflate" {
+		return gzip.NewReader(r)
+	}
+
+	// deflate is supposed to be zlib wrapped, but some servers send raw
+	// deflate data.
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
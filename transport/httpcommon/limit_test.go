@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		var err error
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+		require.NoError(t, err)
+	}
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	small := bytes.Repeat([]byte("a"), 100)
+	large := bytes.Repeat([]byte("a"), 10000)
+
+	tests := map[string]struct {
+		body     []byte
+		encoding string
+		chunked  bool
+		err      bool
+	}{
+		"small":               {body: small},
+		"large":               {body: large, err: true},
+		"large chunked":       {body: large, chunked: true, err: true},
+		"small gzip":          {body: small, encoding: "gzip"},
+		"gzip bomb":           {body: large, encoding: "gzip", err: true},
+		"small deflate":       {body: small, encoding: "deflate"},
+		"deflate bomb":        {body: large, encoding: "deflate", err: true},
+		"small raw deflate":   {body: small, encoding: "raw-deflate"},
+		"raw deflate bomb":    {body: large, encoding: "raw-deflate", err: true},
+		"exactly at limit":    {body: bytes.Repeat([]byte("a"), 1000), chunked: true},
+		"one more than limit": {body: bytes.Repeat([]byte("a"), 1001), chunked: true, err: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body := test.body
+				if test.encoding != "" {
+					body = compress(t, test.encoding, body)
+					encoding := test.encoding
+					if encoding == "raw-deflate" {
+						encoding = "deflate"
+					}
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				if !test.chunked {
+					w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				}
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+
+			settings := DefaultHTTPTransportSettings()
+			settings.MaxResponseSize = 1000
+			client, err := settings.Client()
+			require.NoError(t, err)
+
+			// gzip is decoded by http.Transport, deflate by the limit
+			req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL, nil)
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			if err == nil {
+				defer resp.Body.Close()
+				var body []byte
+				body, err = io.ReadAll(resp.Body)
+				if err == nil {
+					assert.Equal(t, test.body, body)
+				}
+			}
+
+			if !test.err {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrResponseLimit)
+			var limitErr *ResponseLimitError
+			require.ErrorAs(t, err, &limitErr)
+			assert.EqualValues(t, 1000, limitErr.Limit)
+		})
+	}
+}
+
+func TestMaxResponseSizeAcceptEncoding(t *testing.T) {
+	small := compress(t, "gzip", bytes.Repeat([]byte("a"), 10000))
+	large := compress(t, "gzip", bytes.Repeat([]byte("a"), 200000))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path == "/large" {
+			_, _ = w.Write(large)
+			return
+		}
+		_, _ = w.Write(small)
+	}))
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	settings.MaxResponseSize = int64(len(small)) + 1
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	get := func(path string) (*http.Response, []byte, error) {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		// the caller asks for the encoded body
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp, body, err
+	}
+
+	// the encoded body is returned, the limit applies to the encoded size
+	resp, body, err := get("/")
+	require.NoError(t, err)
+	assert.Equal(t, small, body)
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	_, _, err = get("/large")
+	require.ErrorIs(t, err, ErrResponseLimit)
+}
+
+func TestMaxResponseSizeUnset(t *testing.T) {
+	large := bytes.Repeat([]byte("a"), 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(large)
+	}))
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL) //nolint:noctx // It is a test
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, large, body)
+}
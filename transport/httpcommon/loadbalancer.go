@@ -0,0 +1,471 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoAvailableHost is returned by the LoadBalancer if the circuit breakers
+// of all hosts are open.
+var ErrNoAvailableHost = errors.New("no available host")
+
+// LoadBalanceStrategy selects the host for a request.
+type LoadBalanceStrategy string
+
+const (
+	// RoundRobin selects the available hosts in turn.
+	RoundRobin LoadBalanceStrategy = "round_robin"
+
+	// LeastFailed selects the available host with the fewest failed
+	// requests. Hosts with the same number of failures are selected in turn.
+	LeastFailed LoadBalanceStrategy = "least_failed"
+)
+
+// Unpack validates and sets the strategy.
+func (s *LoadBalanceStrategy) Unpack(str string) error {
+	switch strategy := LoadBalanceStrategy(strings.ToLower(str)); strategy {
+	case RoundRobin, LeastFailed:
+		*s = strategy
+		return nil
+	}
+	return fmt.Errorf("unsupported load balancing strategy '%v'", str)
+}
+
+// LoadBalancerConfig configures a LoadBalancer.
+type LoadBalancerConfig struct {
+	// Hosts are the URLs requests are balanced across. The scheme defaults
+	// to http. A path is used as prefix of the request paths.
+	Hosts []string `config:"hosts" yaml:"hosts" json:"hosts" validate:"required"`
+
+	// Strategy selects the host for each request. Defaults to round_robin.
+	Strategy LoadBalanceStrategy `config:"strategy" yaml:"strategy,omitempty" json:"strategy,omitempty"`
+
+	HealthCheck    HealthCheckConfig    `config:"health_check" yaml:"health_check,omitempty" json:"health_check,omitempty"`
+	CircuitBreaker CircuitBreakerConfig `config:"circuit_breaker" yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+}
+
+// HealthCheckConfig configures the active health checks of the hosts. Hosts
+// failing the health check are not selected until they pass it again. If all
+// hosts fail the health check, requests are balanced across all of them, as
+// the health check itself might be failing.
+type HealthCheckConfig struct {
+	// Path is requested with GET on every host. A response with a status
+	// code below 500 marks the host as healthy. Defaults to `/`.
+	Path string `config:"path" yaml:"path,omitempty" json:"path,omitempty"`
+
+	// Interval between health checks. Health checks are disabled if not set.
+	Interval time.Duration `config:"interval" yaml:"interval,omitempty" json:"interval,omitempty" validate:"min=0"`
+
+	// Timeout of a health check request. Defaults to 5s.
+	Timeout time.Duration `config:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty" validate:"min=0"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker of each host.
+//
+// The circuit of a host is opened after Threshold consecutive failures,
+// connection errors or responses with status 502, 503 and 504, and the host
+// is not selected during the Cooldown. After the cooldown a single request
+// is sent to the host, closing the circuit if it succeeds.
+type CircuitBreakerConfig struct {
+	Threshold int           `config:"threshold" yaml:"threshold,omitempty" json:"threshold,omitempty" validate:"min=0"`
+	Cooldown  time.Duration `config:"cooldown" yaml:"cooldown,omitempty" json:"cooldown,omitempty" validate:"min=0"`
+}
+
+// DefaultLoadBalancerConfig returns the default load balancer settings.
+func DefaultLoadBalancerConfig() LoadBalancerConfig {
+	return LoadBalancerConfig{
+		Strategy: RoundRobin,
+		HealthCheck: HealthCheckConfig{
+			Path:    "/",
+			Timeout: 5 * time.Second,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Threshold: 5,
+			Cooldown:  30 * time.Second,
+		},
+	}
+}
+
+// Validate checks the hosts are valid URLs.
+func (c *LoadBalancerConfig) Validate() error {
+	if len(c.Hosts) == 0 {
+		return errors.New("no hosts configured")
+	}
+	for _, host := range c.Hosts {
+		if _, err := parseLoadBalancerHost(host); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseLoadBalancerHost(host string) (*url.URL, error) {
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host '%v': %w", host, err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid host '%v': missing host name", host)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u, nil
+}
+
+// LoadBalancer is a http.RoundTripper balancing requests across multiple
+// hosts. The scheme and host of the request URL are replaced by the
+// selected host.
+//
+// If the connection to a host can not be established, the request is retried
+// on the next available host. Requests failing after the connection has been
+// established are only retried if their method is idempotent, as the host
+// might have processed them already. Requests with a body are only retried
+// if the body can be recreated using http.Request.GetBody.
+type LoadBalancer struct {
+	rt     http.RoundTripper
+	config LoadBalancerConfig
+	hosts  []*lbHost
+
+	mu   sync.Mutex
+	next int
+
+	now  func() time.Time
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type lbHost struct {
+	url *url.URL
+
+	// guarded by LoadBalancer.mu
+	healthy     bool
+	failures    int // consecutive failures
+	totalFailed uint64
+	openUntil   time.Time
+	probing     bool // a request is sent while the circuit is half-open
+}
+
+// NewLoadBalancer creates a LoadBalancer sending requests via rt. If health
+// checks are configured, they are run in the background until Close is
+// called.
+func NewLoadBalancer(rt http.RoundTripper, config LoadBalancerConfig) (*LoadBalancer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	defaults := DefaultLoadBalancerConfig()
+	if config.Strategy == "" {
+		config.Strategy = defaults.Strategy
+	}
+	if config.HealthCheck.Path == "" {
+		config.HealthCheck.Path = defaults.HealthCheck.Path
+	}
+	if config.HealthCheck.Timeout <= 0 {
+		config.HealthCheck.Timeout = defaults.HealthCheck.Timeout
+	}
+	if config.CircuitBreaker.Threshold <= 0 {
+		config.CircuitBreaker.Threshold = defaults.CircuitBreaker.Threshold
+	}
+	if config.CircuitBreaker.Cooldown <= 0 {
+		config.CircuitBreaker.Cooldown = defaults.CircuitBreaker.Cooldown
+	}
+
+	lb := &LoadBalancer{
+		rt:     rt,
+		config: config,
+		now:    time.Now,
+		done:   make(chan struct{}),
+	}
+	for _, host := range config.Hosts {
+		u, _ := parseLoadBalancerHost(host) // validated above
+		lb.hosts = append(lb.hosts, &lbHost{url: u, healthy: true})
+	}
+
+	if config.HealthCheck.Interval > 0 {
+		lb.wg.Add(1)
+		go lb.runHealthChecks()
+	}
+	return lb, nil
+}
+
+// Close stops the health checks.
+func (lb *LoadBalancer) Close() error {
+	select {
+	case <-lb.done:
+	default:
+		close(lb.done)
+	}
+	lb.wg.Wait()
+	return nil
+}
+
+// RoundTrip sends the request to the selected host.
+func (lb *LoadBalancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var tried []*lbHost
+	var lastErr error
+	for range lb.hosts {
+		host := lb.selectHost(tried)
+		if host == nil {
+			break
+		}
+		tried = append(tried, host)
+
+		hostReq, err := lb.rewrite(req, host, len(tried) > 1)
+		if err != nil {
+			lb.release(host)
+			return nil, err
+		}
+
+		resp, err := lb.rt.RoundTrip(hostReq)
+		if err == nil {
+			lb.record(host, !isUnavailable(resp.StatusCode))
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			lb.release(host)
+			return nil, err
+		}
+
+		lb.record(host, false)
+		lastErr = err
+		if !canRetry(req, err) {
+			break
+		}
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrNoAvailableHost
+}
+
+// CloseIdleConnections closes the idle connections of the round tripper.
+func (lb *LoadBalancer) CloseIdleConnections() {
+	if c, ok := lb.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// canRetry reports whether the request failed with err can be sent to
+// another host.
+func canRetry(req *http.Request, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect") {
+		// the request has not been sent
+		return true
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	// like net/http, requests with an idempotency key are idempotent
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+func isUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// rewrite returns a copy of the request sent to the given host.
+func (lb *LoadBalancer) rewrite(req *http.Request, host *lbHost, retry bool) (*http.Request, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = host.url.Scheme
+	out.URL.Host = host.url.Host
+	out.URL.User = host.url.User
+	if host.url.Path != "" {
+		out.URL.Path = host.url.Path + "/" + strings.TrimPrefix(req.URL.Path, "/")
+		out.URL.RawPath = ""
+	}
+	out.Host = ""
+
+	if retry && req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		out.Body = body
+	}
+	return out, nil
+}
+
+// selectHost returns the next available host, skipping the hosts already
+// tried for the request.
+func (lb *LoadBalancer) selectHost(skip []*lbHost) *lbHost {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.now()
+	ignoreHealth := true
+	for _, host := range lb.hosts {
+		if host.healthy {
+			ignoreHealth = false
+			break
+		}
+	}
+
+	var selected *lbHost
+	selectedIdx := 0
+	for i := range lb.hosts {
+		idx := (lb.next + i) % len(lb.hosts)
+		host := lb.hosts[idx]
+		if !lb.available(host, now, ignoreHealth) || containsHost(skip, host) {
+			continue
+		}
+		if selected == nil || (lb.config.Strategy == LeastFailed && host.totalFailed < selected.totalFailed) {
+			selected, selectedIdx = host, idx
+		}
+		if lb.config.Strategy != LeastFailed {
+			break
+		}
+	}
+	if selected == nil {
+		return nil
+	}
+
+	lb.next = (selectedIdx + 1) % len(lb.hosts)
+	if !selected.openUntil.IsZero() {
+		// the circuit is half-open, allow a single request
+		selected.probing = true
+	}
+	return selected
+}
+
+// available reports if the host can be selected. The health check result is
+// not taken into account if ignoreHealth is set. lb.mu must be held.
+func (lb *LoadBalancer) available(host *lbHost, now time.Time, ignoreHealth bool) bool {
+	if !host.healthy && !ignoreHealth {
+		return false
+	}
+	if host.openUntil.IsZero() {
+		return true
+	}
+	return !now.Before(host.openUntil) && !host.probing
+}
+
+func containsHost(hosts []*lbHost, host *lbHost) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// record updates the circuit breaker of the host with the request result.
+func (lb *LoadBalancer) record(host *lbHost, success bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	host.probing = false
+	if success {
+		host.failures = 0
+		host.openUntil = time.Time{}
+		return
+	}
+
+	host.failures++
+	host.totalFailed++
+	if !host.openUntil.IsZero() || host.failures >= lb.config.CircuitBreaker.Threshold {
+		host.openUntil = lb.now().Add(lb.config.CircuitBreaker.Cooldown)
+	}
+}
+
+// release allows probing a half-open circuit again after a request that
+// has not completed.
+func (lb *LoadBalancer) release(host *lbHost) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	host.probing = false
+}
+
+func (lb *LoadBalancer) runHealthChecks() {
+	defer lb.wg.Done()
+
+	ticker := time.NewTicker(lb.config.HealthCheck.Interval)
+	defer ticker.Stop()
+	for {
+		lb.checkHealth()
+		select {
+		case <-lb.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (lb *LoadBalancer) checkHealth() {
+	var wg sync.WaitGroup
+	for _, host := range lb.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			healthy := lb.probe(host)
+
+			lb.mu.Lock()
+			defer lb.mu.Unlock()
+			host.healthy = healthy
+			if healthy && !host.openUntil.IsZero() {
+				host.failures = 0
+				host.openUntil = time.Time{}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (lb *LoadBalancer) probe(host *lbHost) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), lb.config.HealthCheck.Timeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-lb.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	u := *host.url
+	u.Path += "/" + strings.TrimPrefix(lb.config.HealthCheck.Path, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := lb.rt.RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return resp.StatusCode < 500
+}
@@ -0,0 +1,327 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+type lbTestServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	status   atomic.Int32
+}
+
+func newLBTestServer(t *testing.T, name string) *lbTestServer {
+	s := &lbTestServer{}
+	s.status.Store(http.StatusOK)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			s.requests.Add(1)
+		}
+		w.WriteHeader(int(s.status.Load()))
+		_, _ = io.WriteString(w, name+" "+r.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func lbGet(t *testing.T, client *http.Client, path string) (string, int) {
+	t.Helper()
+
+	resp, err := get(t, client, "http://placeholder"+path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), resp.StatusCode
+}
+
+func newTestLoadBalancer(t *testing.T, config LoadBalancerConfig) (*LoadBalancer, *http.Client) {
+	t.Helper()
+
+	settings := DefaultHTTPTransportSettings()
+	rt, err := settings.RoundTripper()
+	require.NoError(t, err)
+	lb, err := NewLoadBalancer(rt, config)
+	require.NoError(t, err)
+	t.Cleanup(func() { lb.Close() })
+	return lb, &http.Client{Transport: lb}
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	s1, s2 := newLBTestServer(t, "s1"), newLBTestServer(t, "s2")
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{s1.URL, s2.URL + "/prefix/"}
+	_, client := newTestLoadBalancer(t, config)
+
+	var bodies []string
+	for range 4 {
+		body, _ := lbGet(t, client, "/path")
+		bodies = append(bodies, body)
+	}
+	assert.Equal(t, []string{"s1 /path", "s2 /prefix/path", "s1 /path", "s2 /prefix/path"}, bodies)
+}
+
+func TestLoadBalancerFailover(t *testing.T) {
+	s1 := newLBTestServer(t, "s1")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{down.URL, s1.URL}
+	config.CircuitBreaker = CircuitBreakerConfig{Threshold: 2, Cooldown: time.Minute}
+	lb, client := newTestLoadBalancer(t, config)
+	now := time.Now()
+	lb.now = func() time.Time { return now }
+
+	for range 4 {
+		body, _ := lbGet(t, client, "/")
+		assert.Equal(t, "s1 /", body)
+	}
+	assert.EqualValues(t, 4, s1.requests.Load())
+
+	// the circuit of the failed host is open after 2 failures
+	assert.EqualValues(t, 2, lb.hosts[0].totalFailed)
+	assert.False(t, lb.hosts[0].openUntil.IsZero())
+
+	// the request body is replayed on the next host
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://placeholder/", strings.NewReader("data"))
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.EqualValues(t, 3, lb.hosts[0].totalFailed, "half-open circuit probed")
+
+	// the circuit is open again after the failed probe, and opens for
+	// the second host after its failures
+	s1.Close()
+	for range 2 {
+		_, err = get(t, client, "http://placeholder/") //nolint:bodyclose // no response on error
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrNoAvailableHost))
+	}
+
+	_, err = get(t, client, "http://placeholder/") //nolint:bodyclose // no response on error
+	require.ErrorIs(t, err, ErrNoAvailableHost)
+}
+
+func TestLoadBalancerNoRetryAfterSending(t *testing.T) {
+	var requests atomic.Int32
+	reset := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = io.ReadAll(r.Body)
+		// close the connection without a response after reading the request
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(reset.Close)
+	s1 := newLBTestServer(t, "s1")
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{reset.URL, s1.URL}
+	lb, client := newTestLoadBalancer(t, config)
+
+	post := func(header http.Header) error {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, "http://placeholder/", strings.NewReader("data"))
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		lb.next = 0
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	// a POST might have been processed and is not sent again
+	require.Error(t, post(nil))
+	assert.EqualValues(t, 0, s1.requests.Load())
+	assert.Positive(t, requests.Load())
+
+	// requests with an idempotency key are retried
+	require.NoError(t, post(http.Header{"Idempotency-Key": {"1"}}))
+	assert.EqualValues(t, 1, s1.requests.Load())
+
+	// idempotent requests are retried
+	lb.next = 0
+	body, _ := lbGet(t, client, "/")
+	assert.Equal(t, "s1 /", body)
+}
+
+func TestLoadBalancerCircuitBreakerStatus(t *testing.T) {
+	s1, s2 := newLBTestServer(t, "s1"), newLBTestServer(t, "s2")
+	s1.status.Store(http.StatusServiceUnavailable)
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{s1.URL, s2.URL}
+	config.CircuitBreaker = CircuitBreakerConfig{Threshold: 1, Cooldown: time.Minute}
+	lb, client := newTestLoadBalancer(t, config)
+	now := time.Now()
+	lb.now = func() time.Time { return now }
+
+	// unavailable responses are returned, but open the circuit
+	_, status := lbGet(t, client, "/")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	for range 3 {
+		body, _ := lbGet(t, client, "/")
+		assert.Equal(t, "s2 /", body)
+	}
+
+	// the circuit is closed after a successful probe
+	s1.status.Store(http.StatusOK)
+	now = now.Add(time.Minute)
+	body, _ := lbGet(t, client, "/")
+	assert.Equal(t, "s1 /", body)
+	assert.True(t, lb.hosts[0].openUntil.IsZero())
+}
+
+func TestLoadBalancerLeastFailed(t *testing.T) {
+	s1, s2, s3 := newLBTestServer(t, "s1"), newLBTestServer(t, "s2"), newLBTestServer(t, "s3")
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{s1.URL, s2.URL, s3.URL}
+	config.Strategy = LeastFailed
+	lb, client := newTestLoadBalancer(t, config)
+	lb.hosts[0].totalFailed = 2
+	lb.hosts[1].totalFailed = 1
+
+	for range 3 {
+		body, _ := lbGet(t, client, "/")
+		assert.Equal(t, "s3 /", body)
+	}
+
+	lb.hosts[2].totalFailed = 1
+	var bodies []string
+	for range 4 {
+		body, _ := lbGet(t, client, "/")
+		bodies = append(bodies, body)
+	}
+	assert.ElementsMatch(t, []string{"s2 /", "s3 /", "s2 /", "s3 /"}, bodies)
+}
+
+func TestLoadBalancerHealthCheck(t *testing.T) {
+	s1, s2 := newLBTestServer(t, "s1"), newLBTestServer(t, "s2")
+	s1.status.Store(http.StatusInternalServerError)
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{s1.URL, s2.URL}
+	config.HealthCheck = HealthCheckConfig{Path: "/health", Interval: 10 * time.Millisecond}
+	lb, client := newTestLoadBalancer(t, config)
+
+	require.Eventually(t, func() bool {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		return !lb.hosts[0].healthy
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for range 2 {
+		body, _ := lbGet(t, client, "/")
+		assert.Equal(t, "s2 /", body)
+	}
+
+	s1.status.Store(http.StatusOK)
+	require.Eventually(t, func() bool {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		return lb.hosts[0].healthy
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, lb.Close())
+	require.NoError(t, lb.Close())
+}
+
+func TestLoadBalancerAllUnhealthy(t *testing.T) {
+	s1, s2 := newLBTestServer(t, "s1"), newLBTestServer(t, "s2")
+
+	config := DefaultLoadBalancerConfig()
+	config.Hosts = []string{s1.URL, s2.URL}
+	lb, client := newTestLoadBalancer(t, config)
+
+	lb.mu.Lock()
+	for _, host := range lb.hosts {
+		host.healthy = false
+	}
+	lb.mu.Unlock()
+
+	// all hosts failing the health check are used as if they were healthy
+	var bodies []string
+	for range 2 {
+		body, status := lbGet(t, client, "/")
+		assert.Equal(t, http.StatusOK, status)
+		bodies = append(bodies, body)
+	}
+	assert.ElementsMatch(t, []string{"s1 /", "s2 /"}, bodies)
+
+	// a single healthy host is preferred
+	lb.mu.Lock()
+	lb.hosts[1].healthy = true
+	lb.mu.Unlock()
+	for range 2 {
+		body, _ := lbGet(t, client, "/")
+		assert.Equal(t, "s2 /", body)
+	}
+}
+
+func TestLoadBalancerConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"hosts":                     []string{"es1:9200", "https://es2:9200"},
+		"strategy":                  "least_failed",
+		"health_check.interval":     "10s",
+		"circuit_breaker.threshold": 3,
+	})
+
+	lbConfig := DefaultLoadBalancerConfig()
+	require.NoError(t, cfg.Unpack(&lbConfig))
+	assert.Equal(t, LeastFailed, lbConfig.Strategy)
+	assert.Equal(t, 10*time.Second, lbConfig.HealthCheck.Interval)
+	assert.Equal(t, 3, lbConfig.CircuitBreaker.Threshold)
+	assert.Equal(t, 30*time.Second, lbConfig.CircuitBreaker.Cooldown)
+
+	lb, err := NewLoadBalancer(http.DefaultTransport, LoadBalancerConfig{Hosts: lbConfig.Hosts})
+	require.NoError(t, err)
+	defer lb.Close()
+	assert.Equal(t, "http://es1:9200", lb.hosts[0].url.String())
+	assert.Equal(t, "https://es2:9200", lb.hosts[1].url.String())
+
+	for name, c := range map[string]map[string]interface{}{
+		"no hosts":         {"hosts": []string{}},
+		"invalid host":     {"hosts": []string{"http://"}},
+		"invalid strategy": {"hosts": []string{"es1"}, "strategy": "random"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			lbConfig := DefaultLoadBalancerConfig()
+			require.Error(t, config.MustNewConfigFrom(c).Unpack(&lbConfig))
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5" //nolint:gosec // required by NTLM
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // required by NTLM
+)
+
+// NTLM message types and negotiate flags, see [MS-NLMP].
+const (
+	ntlmNegotiateMessage    = 1
+	ntlmChallengeMessage    = 2
+	ntlmAuthenticateMessage = 3
+
+	ntlmNegotiateUnicode          = 0x00000001
+	ntlmRequestTarget             = 0x00000004
+	ntlmNegotiateNTLM             = 0x00000200
+	ntlmNegotiateAlwaysSign       = 0x00008000
+	ntlmNegotiateExtendedSecurity = 0x00080000
+	ntlmNegotiateTargetInfo       = 0x00800000
+	ntlmNegotiate128              = 0x20000000
+	ntlmNegotiate56               = 0x80000000
+)
+
+const ntlmDefaultFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+	ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSecurity | ntlmNegotiateTargetInfo |
+	ntlmNegotiate128 | ntlmNegotiate56
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmAuthenticator implements the client side of the NTLMv2 handshake.
+type ntlmAuthenticator struct {
+	user, domain, password string
+
+	// now and clientChallenge are replaced in tests.
+	now             func() time.Time
+	clientChallenge func() ([]byte, error)
+
+	step int
+}
+
+// newNTLMAuthenticator creates an NTLM authenticator. The username can
+// include the domain as `DOMAIN\user`.
+func newNTLMAuthenticator(username, password string) *ntlmAuthenticator {
+	var domain string
+	if i := strings.IndexByte(username, '\\'); i >= 0 {
+		domain, username = username[:i], username[i+1:]
+	}
+	return &ntlmAuthenticator{
+		user:     username,
+		domain:   domain,
+		password: password,
+		now:      time.Now,
+		clientChallenge: func() ([]byte, error) {
+			b := make([]byte, 8)
+			_, err := rand.Read(b)
+			return b, err
+		},
+	}
+}
+
+func (a *ntlmAuthenticator) Scheme() string { return "NTLM" }
+
+func (a *ntlmAuthenticator) Next(challenge []byte) ([]byte, error) {
+	a.step++
+	switch a.step {
+	case 1:
+		return ntlmNegotiate(), nil
+	case 2:
+		if len(challenge) == 0 {
+			return nil, errors.New("NTLM authentication rejected by proxy")
+		}
+		return a.authenticate(challenge)
+	default:
+		return nil, errors.New("NTLM authentication rejected by proxy")
+	}
+}
+
+func ntlmNegotiate() []byte {
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmNegotiateMessage)
+	binary.LittleEndian.PutUint32(msg[12:], ntlmDefaultFlags)
+	// domain and workstation fields are left empty
+	return msg
+}
+
+type ntlmChallenge struct {
+	flags      uint32
+	challenge  []byte
+	targetInfo []byte
+}
+
+func parseNTLMChallenge(msg []byte) (ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) {
+		return ntlmChallenge{}, errors.New("invalid NTLM challenge message")
+	}
+	if typ := binary.LittleEndian.Uint32(msg[8:]); typ != ntlmChallengeMessage {
+		return ntlmChallenge{}, fmt.Errorf("unexpected NTLM message type %d", typ)
+	}
+
+	c := ntlmChallenge{
+		flags:     binary.LittleEndian.Uint32(msg[20:]),
+		challenge: msg[24:32],
+	}
+	if len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return ntlmChallenge{}, errors.New("invalid NTLM target info")
+		}
+		c.targetInfo = msg[offset : offset+length]
+	}
+	return c, nil
+}
+
+func (a *ntlmAuthenticator) authenticate(msg []byte) ([]byte, error) {
+	challenge, err := parseNTLMChallenge(msg)
+	if err != nil {
+		return nil, err
+	}
+	clientChallenge, err := a.clientChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	key := ntowfv2(a.user, a.password, a.domain)
+	ntResponse := ntlmv2Response(key, challenge.challenge, clientChallenge, a.now(), challenge.targetInfo)
+	lmResponse := append(hmacMD5(key, challenge.challenge, clientChallenge), clientChallenge...)
+
+	payload := [][]byte{
+		lmResponse,
+		ntResponse,
+		utf16le(a.domain),
+		utf16le(a.user),
+		nil, // workstation
+		nil, // encrypted random session key
+	}
+
+	const headerLen = 64
+	out := make([]byte, headerLen)
+	copy(out, ntlmSignature)
+	binary.LittleEndian.PutUint32(out[8:], ntlmAuthenticateMessage)
+	offset := headerLen
+	for i, field := range payload {
+		pos := 12 + 8*i
+		binary.LittleEndian.PutUint16(out[pos:], uint16(len(field)))   //nolint:gosec // fields are small
+		binary.LittleEndian.PutUint16(out[pos+2:], uint16(len(field))) //nolint:gosec // fields are small
+		binary.LittleEndian.PutUint32(out[pos+4:], uint32(offset))     //nolint:gosec // fields are small
+		offset += len(field)
+	}
+	binary.LittleEndian.PutUint32(out[60:], challenge.flags&ntlmDefaultFlags)
+	for _, field := range payload {
+		out = append(out, field...)
+	}
+	return out, nil
+}
+
+// ntowfv2 computes the NTLMv2 response key of the user.
+func ntowfv2(user, password, domain string) []byte {
+	h := md4.New()
+	h.Write(utf16le(password))
+	return hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Response computes the NTLMv2 challenge response: the NTProofStr
+// followed by the client blob.
+func ntlmv2Response(key, serverChallenge, clientChallenge []byte, now time.Time, targetInfo []byte) []byte {
+	blob := make([]byte, 28, 28+len(targetInfo)+4)
+	blob[0], blob[1] = 1, 1
+	binary.LittleEndian.PutUint64(blob[8:], filetime(now))
+	copy(blob[16:], clientChallenge)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+
+	return append(hmacMD5(key, serverChallenge, blob), blob...)
+}
+
+// filetime converts t into the number of 100ns intervals since January 1, 1601.
+func filetime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	const epochDelta = 116444736000000000
+	return uint64(t.UnixNano()/100) + epochDelta //nolint:gosec // t is after 1601
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	h := hmac.New(md5.New, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
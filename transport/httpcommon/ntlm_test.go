@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// ntlmTestTargetInfo returns the AV pairs used by the [MS-NLMP] examples.
+func ntlmTestTargetInfo() []byte {
+	var info []byte
+	for _, av := range []struct {
+		id    uint16
+		value string
+	}{{2, "Domain"}, {1, "Server"}} {
+		v := utf16le(av.value)
+		info = binary.LittleEndian.AppendUint16(info, av.id)
+		info = binary.LittleEndian.AppendUint16(info, uint16(len(v)))
+		info = append(info, v...)
+	}
+	return append(info, 0, 0, 0, 0)
+}
+
+// ntlmTestChallenge builds a challenge message as send by a server.
+func ntlmTestChallenge(serverChallenge, targetInfo []byte) []byte {
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], ntlmChallengeMessage)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmDefaultFlags)
+	copy(msg[24:], serverChallenge)
+	binary.LittleEndian.PutUint16(msg[40:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint16(msg[42:], uint16(len(targetInfo)))
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return append(msg, targetInfo...)
+}
+
+// ntlmField returns the payload field of an authenticate message.
+func ntlmField(msg []byte, i int) []byte {
+	pos := 12 + 8*i
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	return msg[offset : offset+length]
+}
+
+func TestNTLMv2(t *testing.T) {
+	// Test vectors from [MS-NLMP] 4.2.4.
+	key := ntowfv2("User", "Password", "Domain")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(key))
+
+	serverChallenge := unhex(t, "0123456789abcdef")
+	clientChallenge := unhex(t, "aaaaaaaaaaaaaaaa")
+	resp := ntlmv2Response(key, serverChallenge, clientChallenge, time.Time{}, ntlmTestTargetInfo())
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(resp[:16]))
+
+	a := newNTLMAuthenticator(`Domain\User`, "Password")
+	a.now = func() time.Time { return time.Time{} }
+	a.clientChallenge = func() ([]byte, error) { return clientChallenge, nil }
+	assert.Equal(t, "NTLM", a.Scheme())
+
+	negotiate, err := a.Next(nil)
+	require.NoError(t, err)
+	assert.Equal(t, ntlmSignature, negotiate[:8])
+	assert.EqualValues(t, ntlmNegotiateMessage, binary.LittleEndian.Uint32(negotiate[8:]))
+
+	msg, err := a.Next(ntlmTestChallenge(serverChallenge, ntlmTestTargetInfo()))
+	require.NoError(t, err)
+	assert.EqualValues(t, ntlmAuthenticateMessage, binary.LittleEndian.Uint32(msg[8:]))
+	assert.Equal(t, "86c35097ac9cec102554764a57cccc19aaaaaaaaaaaaaaaa", hex.EncodeToString(ntlmField(msg, 0)))
+	assert.Equal(t, resp, ntlmField(msg, 1))
+	assert.Equal(t, utf16le("Domain"), ntlmField(msg, 2))
+	assert.Equal(t, utf16le("User"), ntlmField(msg, 3))
+
+	_, err = a.Next(nil)
+	require.Error(t, err)
+}
+
+func TestNTLMInvalidChallenge(t *testing.T) {
+	for name, msg := range map[string][]byte{
+		"empty":        nil,
+		"short":        []byte("NTLMSSP\x00"),
+		"signature":    make([]byte, 48),
+		"type":         ntlmNegotiate(),
+		"out of range": append(ntlmTestChallenge(make([]byte, 8), make([]byte, 8))[:48], 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			a := newNTLMAuthenticator("user", "pass")
+			_, err := a.Next(nil)
+			require.NoError(t, err)
+			_, err = a.Next(msg)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNTLMWithoutTargetInfo(t *testing.T) {
+	a := newNTLMAuthenticator("user", "pass")
+	_, err := a.Next(nil)
+	require.NoError(t, err)
+	_, err = a.Next(ntlmTestChallenge(make([]byte, 8), nil)[:40])
+	require.NoError(t, err)
+}
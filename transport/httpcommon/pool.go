@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// poolStats records the connection pool usage of requests.
+type poolStats struct {
+	newConns    *monitoring.Uint
+	reused      *monitoring.Uint
+	wasIdle     *monitoring.Uint
+	idleTime    *monitoring.Timer
+	getConnWait *monitoring.Timer
+}
+
+// WithPoolStats records connection pool statistics of all requests in the
+// given registry, using httptrace:
+//
+//   - connections.new: requests sent on a newly established connection
+//   - connections.reused: requests sent on a connection reused from a previous request
+//   - connections.idle: reused connections taken from the idle pool
+//   - connections.idle_time: time reused connections have been idle
+//   - connections.wait: time spent to obtain a connection from the pool or to establish one
+func WithPoolStats(reg *monitoring.Registry) TransportOption {
+	stats := &poolStats{
+		newConns:    monitoring.NewUint(reg, "connections.new"),
+		reused:      monitoring.NewUint(reg, "connections.reused"),
+		wasIdle:     monitoring.NewUint(reg, "connections.idle"),
+		idleTime:    monitoring.NewTimer(reg, "connections.idle_time"),
+		getConnWait: monitoring.NewTimer(reg, "connections.wait"),
+	}
+	return WithModRoundtripper(func(rt http.RoundTripper) http.RoundTripper {
+		return &poolStatsRoundTripper{rt: rt, stats: stats}
+	})
+}
+
+type poolStatsRoundTripper struct {
+	rt    http.RoundTripper
+	stats *poolStats
+}
+
+func (rt *poolStatsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var start time.Time
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			start = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !start.IsZero() {
+				rt.stats.getConnWait.Observe(time.Since(start))
+			}
+			if !info.Reused {
+				rt.stats.newConns.Inc()
+				return
+			}
+			rt.stats.reused.Inc()
+			if info.WasIdle {
+				rt.stats.wasIdle.Inc()
+				rt.stats.idleTime.Observe(info.IdleTime)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return rt.rt.RoundTrip(req)
+}
+
+func (rt *poolStatsRoundTripper) CloseIdleConnections() {
+	if c, ok := rt.rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestPoolSettings(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"max_idle_connections":          50,
+		"max_idle_connections_per_host": 10,
+		"max_connections_per_host":      20,
+		"idle_connection_timeout":       "30s",
+	})
+
+	settings := DefaultHTTPTransportSettings()
+	require.NoError(t, cfg.Unpack(&settings))
+
+	rt, err := settings.RoundTripper()
+	require.NoError(t, err)
+	tr, ok := rt.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 50, tr.MaxIdleConns)
+	assert.Equal(t, 10, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 20, tr.MaxConnsPerHost)
+	assert.Equal(t, 30*time.Second, tr.IdleConnTimeout)
+
+	// options take precedence over the settings
+	rt, err = settings.RoundTripper(WithKeepaliveSettings{MaxIdleConnsPerHost: 5})
+	require.NoError(t, err)
+	tr, ok = rt.(*http.Transport)
+	require.True(t, ok)
+	assert.Equal(t, 5, tr.MaxIdleConnsPerHost)
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{"max_connections_per_host": -1})
+	require.Error(t, cfg.Unpack(&settings))
+}
+
+func TestPoolStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	reg := monitoring.NewRegistry()
+	settings := DefaultHTTPTransportSettings()
+	client, err := settings.Client(WithPoolStats(reg))
+	require.NoError(t, err)
+
+	for range 3 {
+		resp, err := client.Get(server.URL) //nolint:noctx // It is a test
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	client.CloseIdleConnections()
+	resp, err := client.Get(server.URL) //nolint:noctx // It is a test
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, false)
+	assert.EqualValues(t, 2, snapshot.Ints["connections.new"])
+	assert.EqualValues(t, 2, snapshot.Ints["connections.reused"])
+	assert.EqualValues(t, 2, snapshot.Ints["connections.idle"])
+	assert.EqualValues(t, 2, snapshot.Ints["connections.idle_time.count"])
+	assert.EqualValues(t, 4, snapshot.Ints["connections.wait.count"])
+}
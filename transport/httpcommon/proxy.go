@@ -42,6 +42,9 @@ type HTTPClientProxySettings struct {
 	// during CONNECT requests.
 	Headers ProxyHeaders `config:"proxy_headers" yaml:"proxy_headers,omitempty"`
 
+	// Auth configures the authentication with the proxy.
+	Auth ProxyAuth `config:"proxy_auth" yaml:"proxy_auth,omitempty"`
+
 	// Disable HTTP proxy support. Configured URLs and environment variables
 	// are ignored.
 	Disable bool `config:"proxy_disable" yaml:"proxy_disable,omitempty"`
@@ -76,6 +79,7 @@ func (settings *HTTPClientProxySettings) Unpack(cfg *config.C) error {
 		URL     string            `config:"proxy_url"`
 		Disable bool              `config:"proxy_disable"`
 		Headers map[string]string `config:"proxy_headers"`
+		Auth    ProxyAuth         `config:"proxy_auth"`
 	}{}
 
 	if err := cfg.Unpack(&tmp); err != nil {
@@ -87,6 +91,7 @@ func (settings *HTTPClientProxySettings) Unpack(cfg *config.C) error {
 		return err
 	}
 
+	s.Auth = tmp.Auth
 	*settings = *s
 	return nil
 }
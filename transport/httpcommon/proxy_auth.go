@@ -0,0 +1,357 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport"
+)
+
+// ProxyAuthType selects the authentication scheme used with the proxy.
+type ProxyAuthType string
+
+const (
+	// ProxyAuthNone disables proxy authentication, except for credentials
+	// included in the proxy URL.
+	ProxyAuthNone ProxyAuthType = ""
+
+	// ProxyAuthBasic sends the username and password using the Basic scheme.
+	ProxyAuthBasic ProxyAuthType = "basic"
+
+	// ProxyAuthBearer sends the token using the Bearer scheme.
+	ProxyAuthBearer ProxyAuthType = "bearer"
+
+	// ProxyAuthNTLM authenticates with the username and password using an
+	// NTLMv2 handshake.
+	ProxyAuthNTLM ProxyAuthType = "ntlm"
+
+	// ProxyAuthNegotiate authenticates using a SPNEGO (Negotiate) handshake.
+	// The tokens are provided by the ProxyAuthenticator configured via
+	// WithProxyAuthenticator.
+	ProxyAuthNegotiate ProxyAuthType = "negotiate"
+)
+
+// Unpack validates and sets the proxy authentication type.
+func (t *ProxyAuthType) Unpack(s string) error {
+	typ := ProxyAuthType(strings.ToLower(s))
+	switch typ {
+	case ProxyAuthNone, ProxyAuthBasic, ProxyAuthBearer, ProxyAuthNTLM, ProxyAuthNegotiate:
+		*t = typ
+		return nil
+	}
+	return fmt.Errorf("unsupported proxy authentication type '%v'", s)
+}
+
+// ProxyAuth configures the authentication with the proxy.
+//
+// Basic and Bearer credentials are sent with every request to the proxy.
+// NTLM and Negotiate authenticate each connection using a handshake on the
+// CONNECT request. With these, all requests, including plain HTTP ones, are
+// tunneled through the proxy using CONNECT.
+type ProxyAuth struct {
+	Type ProxyAuthType `config:"type" yaml:"type,omitempty" json:"type,omitempty"`
+
+	// Username and Password are used by the basic and ntlm types. For NTLM
+	// the username can include the domain as `DOMAIN\user`.
+	Username string `config:"username" yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `config:"password" yaml:"password,omitempty" json:"password,omitempty"`
+
+	// Token is used by the bearer type.
+	Token string `config:"token" yaml:"token,omitempty" json:"token,omitempty"`
+}
+
+// Validate checks the required credentials of the authentication type are set.
+func (a *ProxyAuth) Validate() error {
+	switch a.Type {
+	case ProxyAuthBasic:
+		if a.Username == "" {
+			return errors.New("basic proxy authentication requires a username")
+		}
+	case ProxyAuthBearer:
+		if a.Token == "" {
+			return errors.New("bearer proxy authentication requires a token")
+		}
+	case ProxyAuthNTLM:
+		if a.Username == "" || a.Password == "" {
+			return errors.New("ntlm proxy authentication requires a username and password")
+		}
+	}
+	return nil
+}
+
+// authorization returns the Proxy-Authorization header value for the basic
+// and bearer types.
+func (a *ProxyAuth) authorization() string {
+	switch a.Type {
+	case ProxyAuthBasic:
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+a.Password))
+	case ProxyAuthBearer:
+		return "Bearer " + a.Token
+	}
+	return ""
+}
+
+// handshake reports if the authentication type requires a handshake per
+// connection.
+func (a *ProxyAuth) handshake() bool {
+	return a.Type == ProxyAuthNTLM || a.Type == ProxyAuthNegotiate
+}
+
+// ProxyAuthenticator implements a connection based challenge-response
+// authentication scheme, like NTLM or Negotiate, with the proxy.
+type ProxyAuthenticator interface {
+	// Scheme returns the authentication scheme, e.g. `Negotiate`.
+	Scheme() string
+
+	// Next returns the token to send to the proxy. The challenge is nil for
+	// the initial token, followed by the decoded tokens received from the
+	// proxy. An error is returned if the handshake can not continue.
+	Next(challenge []byte) ([]byte, error)
+}
+
+// ProxyAuthenticatorFactory creates a ProxyAuthenticator for a new connection
+// to the given proxy.
+type ProxyAuthenticatorFactory func(proxy *url.URL) (ProxyAuthenticator, error)
+
+// WithProxyAuthenticator sets the authenticator used for the ntlm and
+// negotiate proxy authentication types. It is required for the negotiate
+// type, as Kerberos tokens are platform specific. For the ntlm type it
+// replaces the built-in NTLMv2 implementation.
+func WithProxyAuthenticator(factory ProxyAuthenticatorFactory) TransportOption {
+	return extraOptionFunc(func(settings *extraSettings) {
+		settings.proxyAuthenticator = factory
+	})
+}
+
+// connectHeaders returns the headers send with CONNECT requests.
+func (settings *HTTPClientProxySettings) connectHeaders() http.Header {
+	headers := settings.Headers.Headers()
+	if auth := settings.Auth.authorization(); auth != "" {
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set("Proxy-Authorization", auth)
+	}
+	return headers
+}
+
+// roundTripper adds the Proxy-Authorization header to plain HTTP requests
+// sent through the proxy. HTTPS requests are authenticated via the CONNECT
+// headers.
+func (settings *HTTPClientProxySettings) roundTripper(t *http.Transport) http.RoundTripper {
+	auth := settings.Auth.authorization()
+	if settings.Disable || auth == "" {
+		return t
+	}
+	return &proxyAuthRoundTripper{t: t, authorization: auth}
+}
+
+type proxyAuthRoundTripper struct {
+	t             *http.Transport
+	authorization string
+}
+
+func (rt *proxyAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" && rt.t.Proxy != nil && req.Header.Get("Proxy-Authorization") == "" {
+		if proxy, err := rt.t.Proxy(req); err == nil && proxy != nil {
+			req = req.Clone(req.Context())
+			req.Header.Set("Proxy-Authorization", rt.authorization)
+		}
+	}
+	return rt.t.RoundTrip(req)
+}
+
+func (rt *proxyAuthRoundTripper) CloseIdleConnections() {
+	rt.t.CloseIdleConnections()
+}
+
+// proxyTunnel dials connections through the proxy using CONNECT requests
+// authenticated with a handshake. It replaces the proxy support of
+// http.Transport, which only supports a single CONNECT request per
+// connection.
+type proxyTunnel struct {
+	forward          transport.Dialer
+	authType         ProxyAuthType
+	headers          http.Header
+	newAuthenticator ProxyAuthenticatorFactory
+
+	// proxy selects the proxy per target URL. It is taken from the
+	// http.Transport after all options have been applied.
+	proxy func(*http.Request) (*url.URL, error)
+}
+
+// maxProxyAuthLegs limits the number of CONNECT requests per connection.
+const maxProxyAuthLegs = 5
+
+func newProxyTunnel(settings *HTTPClientProxySettings, forward transport.Dialer, factory ProxyAuthenticatorFactory) (*proxyTunnel, error) {
+	if factory == nil {
+		switch settings.Auth.Type {
+		case ProxyAuthNTLM:
+			auth := settings.Auth
+			factory = func(*url.URL) (ProxyAuthenticator, error) {
+				return newNTLMAuthenticator(auth.Username, auth.Password), nil
+			}
+		default:
+			return nil, fmt.Errorf("%v proxy authentication requires a ProxyAuthenticator", settings.Auth.Type)
+		}
+	}
+
+	return &proxyTunnel{
+		forward:          forward,
+		authType:         settings.Auth.Type,
+		headers:          settings.Headers.Headers(),
+		newAuthenticator: factory,
+		proxy:            settings.ProxyFunc(),
+	}, nil
+}
+
+// dialer returns a dialer for connections to targets of the given URL scheme.
+func (p *proxyTunnel) dialer(scheme string) transport.Dialer {
+	return transport.DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		var proxy *url.URL
+		if p.proxy != nil {
+			var err error
+			proxy, err = p.proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: address}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if proxy == nil {
+			return p.forward.DialContext(ctx, network, address)
+		}
+		if proxy.Scheme != "http" {
+			return nil, fmt.Errorf("proxy scheme '%v' is not supported with %v proxy authentication", proxy.Scheme, p.authType)
+		}
+
+		proxyAddr := proxy.Host
+		if proxy.Port() == "" {
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+		}
+		conn, err := p.forward.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.connect(ctx, conn, proxy, address); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy CONNECT to %v via %v failed: %w", address, proxy.Redacted(), err)
+		}
+		return conn, nil
+	})
+}
+
+// connect establishes the tunnel to address, authenticating with the proxy.
+func (p *proxyTunnel) connect(ctx context.Context, conn net.Conn, proxy *url.URL, address string) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{}) //nolint:errcheck // best effort
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	authenticator, err := p.newAuthenticator(proxy)
+	if err != nil {
+		return err
+	}
+	scheme := authenticator.Scheme()
+
+	br := bufio.NewReader(conn)
+	var challenge []byte
+	for range maxProxyAuthLegs {
+		token, err := authenticator.Next(challenge)
+		if err != nil {
+			return err
+		}
+
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: address},
+			Host:   address,
+			Header: p.headers.Clone(),
+		}
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("Proxy-Authorization", scheme+" "+base64.StdEncoding.EncodeToString(token))
+		if err := req.Write(conn); err != nil {
+			return err
+		}
+
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if br.Buffered() > 0 {
+				return errors.New("unexpected data received from proxy")
+			}
+			return nil
+
+		case http.StatusProxyAuthRequired:
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			challenge, err = proxyChallenge(resp.Header, scheme)
+			if err != nil {
+				return err
+			}
+			if resp.Close {
+				return errors.New("proxy closed the connection during authentication")
+			}
+
+		default:
+			resp.Body.Close()
+			return fmt.Errorf("unexpected proxy response: %v", resp.Status)
+		}
+	}
+	return errors.New("too many proxy authentication attempts")
+}
+
+// proxyChallenge returns the decoded challenge of the given scheme from the
+// Proxy-Authenticate headers.
+func proxyChallenge(header http.Header, scheme string) ([]byte, error) {
+	for _, v := range header.Values("Proxy-Authenticate") {
+		s, token, _ := strings.Cut(v, " ")
+		if !strings.EqualFold(s, scheme) {
+			continue
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			break
+		}
+		return base64.StdEncoding.DecodeString(token)
+	}
+	return nil, fmt.Errorf("proxy authentication failed: no %v challenge received", scheme)
+}
@@ -0,0 +1,386 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+// testProxy is a HTTP proxy supporting CONNECT and plain HTTP requests. The
+// authorize function is called with the Proxy-Authorization header of every
+// request and returns the Proxy-Authenticate header to respond with, if the
+// request is not authorized.
+type testProxy struct {
+	listener  net.Listener
+	authorize func(conn int, auth string) (challenge string, ok bool)
+	conns     atomic.Int32
+	connects  atomic.Int32
+}
+
+func newTestProxy(t *testing.T, authorize func(conn int, auth string) (string, bool)) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	p := &testProxy{listener: l, authorize: authorize}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn, int(p.conns.Add(1)))
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+func (p *testProxy) serve(conn net.Conn, id int) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	for {
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+
+		if challenge, ok := p.authorize(id, req.Header.Get("Proxy-Authorization")); !ok {
+			resp := &http.Response{
+				StatusCode:    http.StatusProxyAuthRequired,
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{"Proxy-Authenticate": []string{challenge}},
+				Body:          io.NopCloser(strings.NewReader("denied")),
+				ContentLength: 6,
+			}
+			if err := resp.Write(conn); err != nil {
+				return
+			}
+			continue
+		}
+
+		if req.Method != http.MethodConnect {
+			req.RequestURI = ""
+			req.Header.Del("Proxy-Authorization")
+			resp, err := http.DefaultTransport.RoundTrip(req)
+			if err != nil {
+				return
+			}
+			resp.Header.Set("X-Proxied", "true")
+			_ = resp.Write(conn)
+			resp.Body.Close()
+			continue
+		}
+
+		p.connects.Add(1)
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			return
+		}
+		defer target.Close()
+		_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+		go func() { _, _ = io.Copy(target, br) }()
+		_, _ = io.Copy(conn, target)
+		return
+	}
+}
+
+func requireAuth(expected string) func(int, string) (string, bool) {
+	return func(_ int, auth string) (string, bool) {
+		return "Basic", auth == expected
+	}
+}
+
+func proxySettings(t *testing.T, proxyURL string, auth ProxyAuth) HTTPTransportSettings {
+	t.Helper()
+
+	settings := DefaultHTTPTransportSettings()
+	proxy, err := NewProxyURIFromString(proxyURL)
+	require.NoError(t, err)
+	settings.Proxy.URL = proxy
+	settings.Proxy.Auth = auth
+	settings.TLS = &tlscommon.Config{VerificationMode: tlscommon.VerifyNone}
+	return settings
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	return client.Do(req)
+}
+
+func requireOK(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+
+	resp, err := get(t, client, url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "ok", string(body))
+	return resp
+}
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+}
+
+func TestProxyAuthHeaders(t *testing.T) {
+	server := httptest.NewServer(okHandler())
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(okHandler())
+	defer tlsServer.Close()
+
+	tests := map[string]struct {
+		auth     ProxyAuth
+		expected string
+	}{
+		"basic": {
+			auth:     ProxyAuth{Type: ProxyAuthBasic, Username: "user", Password: "pass"},
+			expected: "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass")),
+		},
+		"bearer": {
+			auth:     ProxyAuth{Type: ProxyAuthBearer, Token: "secret"},
+			expected: "Bearer secret",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			proxy := newTestProxy(t, requireAuth(test.expected))
+			settings := proxySettings(t, proxy.URL(), test.auth)
+			client, err := settings.Client()
+			require.NoError(t, err)
+
+			resp := requireOK(t, client, server.URL)
+			assert.Equal(t, "true", resp.Header.Get("X-Proxied"))
+
+			requireOK(t, client, tlsServer.URL)
+			assert.EqualValues(t, 1, proxy.connects.Load())
+
+			settings.Proxy.Auth = ProxyAuth{}
+			client, err = settings.Client()
+			require.NoError(t, err)
+			resp, err = get(t, client, server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusProxyAuthRequired, resp.StatusCode)
+		})
+	}
+}
+
+// ntlmTestProxyAuthorizer verifies the NTLM handshake of each connection.
+func ntlmTestProxyAuthorizer(user, password, domain string) func(int, string) (string, bool) {
+	serverChallenge := []byte("12345678")
+	targetInfo := ntlmTestTargetInfo()
+	var mu sync.Mutex
+	step := map[int]int{}
+
+	return func(conn int, auth string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		token, ok := strings.CutPrefix(auth, "NTLM ")
+		if !ok {
+			return "NTLM", false
+		}
+		msg, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return "NTLM", false
+		}
+
+		step[conn]++
+		switch step[conn] {
+		case 1:
+			challenge := ntlmTestChallenge(serverChallenge, targetInfo)
+			return "NTLM " + base64.StdEncoding.EncodeToString(challenge), false
+		case 2:
+			ntResponse := ntlmField(msg, 1)
+			if !bytes.Equal(ntlmField(msg, 3), utf16le(user)) || !bytes.Equal(ntlmField(msg, 2), utf16le(domain)) {
+				return "NTLM", false
+			}
+			key := ntowfv2(user, password, domain)
+			expected := hmacMD5(key, serverChallenge, ntResponse[16:])
+			return "NTLM", bytes.Equal(expected, ntResponse[:16])
+		}
+		return "NTLM", true
+	}
+}
+
+func TestProxyAuthNTLM(t *testing.T) {
+	server := httptest.NewServer(okHandler())
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(okHandler())
+	defer tlsServer.Close()
+
+	proxy := newTestProxy(t, ntlmTestProxyAuthorizer("user", "secret", "CORP"))
+
+	settings := proxySettings(t, proxy.URL(), ProxyAuth{Type: ProxyAuthNTLM, Username: `CORP\user`, Password: "secret"})
+	client, err := settings.Client()
+	require.NoError(t, err)
+
+	requireOK(t, client, tlsServer.URL)
+	requireOK(t, client, server.URL)
+	requireOK(t, client, tlsServer.URL)
+	assert.EqualValues(t, 2, proxy.connects.Load())
+
+	settings.Proxy.Auth.Password = "wrong"
+	client, err = settings.Client()
+	require.NoError(t, err)
+	_, err = get(t, client, tlsServer.URL) //nolint:bodyclose // no response on error
+	require.ErrorContains(t, err, "proxy authentication failed")
+}
+
+func TestProxyAuthNTLMWithHTTP2(t *testing.T) {
+	server := httptest.NewUnstartedServer(protoHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	proxy := newTestProxy(t, ntlmTestProxyAuthorizer("user", "secret", ""))
+
+	settings := proxySettings(t, proxy.URL(), ProxyAuth{Type: ProxyAuthNTLM, Username: "user", Password: "secret"})
+	settings.HTTP2.Enabled = true
+	assert.Equal(t, "HTTP/2.0", getProto(t, settings, server.URL))
+	assert.EqualValues(t, 1, proxy.connects.Load())
+}
+
+type testAuthenticator struct {
+	tokens []string
+	step   int
+}
+
+func (a *testAuthenticator) Scheme() string { return "Negotiate" }
+
+func (a *testAuthenticator) Next(challenge []byte) ([]byte, error) {
+	if a.step > 0 && string(challenge) != fmt.Sprintf("challenge-%d", a.step) {
+		return nil, errors.New("unexpected challenge")
+	}
+	if a.step >= len(a.tokens) {
+		return nil, errors.New("no more tokens")
+	}
+	a.step++
+	return []byte(a.tokens[a.step-1]), nil
+}
+
+func TestProxyAuthNegotiate(t *testing.T) {
+	server := httptest.NewTLSServer(okHandler())
+	defer server.Close()
+
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+	proxy := newTestProxy(t, func(_ int, auth string) (string, bool) {
+		switch auth {
+		case "Negotiate " + encode("token-1"):
+			return "Negotiate " + encode("challenge-1"), false
+		case "Negotiate " + encode("token-2"):
+			return "", true
+		}
+		return "Negotiate", false
+	})
+
+	settings := proxySettings(t, proxy.URL(), ProxyAuth{Type: ProxyAuthNegotiate})
+	_, err := settings.Client()
+	require.Error(t, err, "negotiate requires an authenticator")
+
+	var proxyHost string
+	client, err := settings.Client(WithProxyAuthenticator(func(proxy *url.URL) (ProxyAuthenticator, error) {
+		proxyHost = proxy.Host
+		return &testAuthenticator{tokens: []string{"token-1", "token-2"}}, nil
+	}))
+	require.NoError(t, err)
+
+	requireOK(t, client, server.URL)
+	assert.Equal(t, strings.TrimPrefix(proxy.URL(), "http://"), proxyHost)
+}
+
+func TestProxyAuthHandshakeProxyDisabled(t *testing.T) {
+	server := httptest.NewServer(okHandler())
+	defer server.Close()
+
+	proxy := newTestProxy(t, requireAuth("never"))
+	settings := proxySettings(t, proxy.URL(), ProxyAuth{Type: ProxyAuthNTLM, Username: "user", Password: "secret"})
+
+	client, err := settings.Client(WithNOProxy())
+	require.NoError(t, err)
+	requireOK(t, client, server.URL)
+
+	settings.Proxy.Disable = true
+	client, err = settings.Client()
+	require.NoError(t, err)
+	requireOK(t, client, server.URL)
+	assert.Zero(t, proxy.conns.Load())
+}
+
+func TestProxyAuthConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"proxy_url": "http://proxy:3128",
+		"proxy_auth": map[string]interface{}{
+			"type":     "NTLM",
+			"username": `CORP\user`,
+			"password": "secret",
+		},
+	})
+
+	settings := DefaultHTTPTransportSettings()
+	require.NoError(t, cfg.Unpack(&settings))
+	assert.Equal(t, ProxyAuth{Type: ProxyAuthNTLM, Username: `CORP\user`, Password: "secret"}, settings.Proxy.Auth)
+
+	for name, auth := range map[string]map[string]interface{}{
+		"unknown type":        {"type": "digest"},
+		"basic without user":  {"type": "basic"},
+		"bearer without key":  {"type": "bearer"},
+		"ntlm without passwd": {"type": "ntlm", "username": "user"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(map[string]interface{}{"proxy_auth": auth})
+			settings := DefaultHTTPTransportSettings()
+			require.Error(t, cfg.Unpack(&settings))
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures the retries of failed requests. See WithRetry.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of retries of a request. Requests are
+	// not retried if <= 0.
+	MaxRetries int `config:"max_retries" yaml:"max_retries,omitempty" json:"max_retries,omitempty"`
+
+	// InitialBackoff is the wait time before the first retry. The wait time
+	// doubles with every retry, up to MaxBackoff. Up to 25% of jitter is
+	// subtracted from the wait time.
+	InitialBackoff time.Duration `config:"backoff.init" yaml:"backoff.init,omitempty" json:"backoff.init,omitempty"`
+	MaxBackoff     time.Duration `config:"backoff.max" yaml:"backoff.max,omitempty" json:"backoff.max,omitempty"`
+
+	// MaxElapsedTime limits the total time spent on a request including all
+	// retries. No more retries are attempted once it would be exceeded.
+	// Unlimited if <= 0.
+	MaxElapsedTime time.Duration `config:"max_elapsed_time" yaml:"max_elapsed_time,omitempty" json:"max_elapsed_time,omitempty"`
+
+	// RetryableStatusCodes are the response status codes retried.
+	RetryableStatusCodes []int `config:"status_codes" yaml:"status_codes,omitempty" json:"status_codes,omitempty"`
+
+	// RetryNonIdempotent enables retries of requests with non-idempotent
+	// methods, like POST, that have no Idempotency-Key header.
+	RetryNonIdempotent bool `config:"non_idempotent" yaml:"non_idempotent,omitempty" json:"non_idempotent,omitempty"`
+}
+
+// DefaultRetryPolicy returns the default retry policy, retrying up to 3
+// times on connection errors and the status codes 429, 502, 503 and 504.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		MaxElapsedTime: 2 * time.Minute,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// Validate checks the backoff settings are consistent.
+func (p *RetryPolicy) Validate() error {
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if p.MaxBackoff > 0 && p.InitialBackoff > p.MaxBackoff {
+		return errors.New("backoff.init must not be greater than backoff.max")
+	}
+	return nil
+}
+
+// WithRetry retries failed requests according to the policy. Requests are
+// retried on errors, except if the request context is done, and on the
+// retryable status codes. The Retry-After header of responses is honored if
+// present. If it asks to wait longer than MaxBackoff, the response is
+// returned without retrying.
+//
+// Only requests with idempotent methods or an Idempotency-Key header are
+// retried, unless RetryNonIdempotent is set. Requests with a body are only
+// retried if the body can be recreated using http.Request.GetBody.
+func WithRetry(policy RetryPolicy) TransportOption {
+	return WithModRoundtripper(func(rt http.RoundTripper) http.RoundTripper {
+		return &retryRoundTripper{
+			rt:     rt,
+			policy: policy,
+			now:    time.Now,
+			sleep:  sleepContext,
+		}
+	})
+}
+
+type retryRoundTripper struct {
+	rt     http.RoundTripper
+	policy RetryPolicy
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+}
+
+func (rt *retryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !rt.retryable(req) {
+		return rt.rt.RoundTrip(req)
+	}
+
+	start := rt.now()
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		resp, err := rt.rt.RoundTrip(req)
+		if attempt >= rt.policy.MaxRetries || !rt.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := rt.backoff(attempt + 1)
+		if resp != nil {
+			if after, ok := retryAfter(resp, rt.now()); ok {
+				if rt.policy.MaxBackoff > 0 && after > rt.policy.MaxBackoff {
+					return resp, err
+				}
+				wait = after
+			}
+		}
+		if rt.policy.MaxElapsedTime > 0 && rt.now().Add(wait).Sub(start) > rt.policy.MaxElapsedTime {
+			return resp, err
+		}
+
+		if resp != nil {
+			// drain the body, such that the connection can be reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		if err := rt.sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable checks if the request can be retried at all.
+func (rt *retryRoundTripper) retryable(req *http.Request) bool {
+	if rt.policy.MaxRetries <= 0 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return rt.policy.RetryNonIdempotent || isIdempotent(req)
+}
+
+func (rt *retryRoundTripper) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	return slices.Contains(rt.policy.RetryableStatusCodes, resp.StatusCode)
+}
+
+// backoff returns the time to wait before the given retry: exponential,
+// capped at MaxBackoff, with up to 25% of jitter.
+func (rt *retryRoundTripper) backoff(retry int) time.Duration {
+	wait := rt.policy.InitialBackoff
+	for i := 1; i < retry && (rt.policy.MaxBackoff <= 0 || wait < rt.policy.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if rt.policy.MaxBackoff > 0 {
+		wait = min(wait, rt.policy.MaxBackoff)
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait - time.Duration(rand.Int64N(int64(wait)/4+1))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or a HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs > int64(math.MaxInt64/time.Second) {
+			return math.MaxInt64, true
+		}
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,309 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpcommon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func newTestRetry(rt http.RoundTripper, policy RetryPolicy) (*retryRoundTripper, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return &retryRoundTripper{rt: rt, policy: policy, now: clock.Now, sleep: clock.Sleep}, clock
+}
+
+type statusSequence struct {
+	calls    int
+	statuses []int
+	headers  []http.Header
+	bodies   []string
+}
+
+func (s *statusSequence) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := min(s.calls, len(s.statuses)-1)
+	s.calls++
+	if req.Body != nil {
+		b, _ := io.ReadAll(req.Body)
+		s.bodies = append(s.bodies, string(b))
+	}
+	if s.statuses[i] == 0 {
+		return nil, errors.New("connection refused")
+	}
+	h := http.Header{}
+	if i < len(s.headers) && s.headers[i] != nil {
+		h = s.headers[i]
+	}
+	return &http.Response{StatusCode: s.statuses[i], Header: h, Body: io.NopCloser(strings.NewReader("body"))}, nil
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	seq := &statusSequence{statuses: []int{503, 0, 200}}
+	rt, clock := newTestRetry(seq, DefaultRetryPolicy())
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, seq.calls)
+	require.Len(t, clock.waits, 2)
+	assert.InDelta(t, 500*time.Millisecond, clock.waits[0], float64(125*time.Millisecond))
+	assert.InDelta(t, time.Second, clock.waits[1], float64(250*time.Millisecond))
+}
+
+func TestRetryMaxRetries(t *testing.T) {
+	seq := &statusSequence{statuses: []int{502}}
+	rt, _ := newTestRetry(seq, DefaultRetryPolicy())
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 502, resp.StatusCode)
+	assert.Equal(t, 4, seq.calls)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(body))
+}
+
+func TestRetryNotRetryableStatus(t *testing.T) {
+	seq := &statusSequence{statuses: []int{500}}
+	rt, _ := newTestRetry(seq, DefaultRetryPolicy())
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 1, seq.calls)
+}
+
+func TestRetryAfter(t *testing.T) {
+	policy := DefaultRetryPolicy()
+
+	t.Run("seconds", func(t *testing.T) {
+		seq := &statusSequence{
+			statuses: []int{429, 200},
+			headers:  []http.Header{{"Retry-After": []string{"7"}}},
+		}
+		rt, clock := newTestRetry(seq, policy)
+
+		resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, []time.Duration{7 * time.Second}, clock.waits)
+	})
+
+	t.Run("date", func(t *testing.T) {
+		seq := &statusSequence{statuses: []int{503, 200}}
+		rt, clock := newTestRetry(seq, policy)
+		date := clock.now.Add(10 * time.Second).Format(http.TimeFormat)
+		seq.headers = []http.Header{{"Retry-After": []string{date}}}
+
+		resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, []time.Duration{10 * time.Second}, clock.waits)
+	})
+
+	t.Run("exceeds max elapsed time", func(t *testing.T) {
+		seq := &statusSequence{
+			statuses: []int{503, 200},
+			headers:  []http.Header{{"Retry-After": []string{"3600"}}},
+		}
+		rt, clock := newTestRetry(seq, policy)
+
+		resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, 503, resp.StatusCode)
+		assert.Equal(t, 1, seq.calls)
+		assert.Empty(t, clock.waits)
+	})
+
+	t.Run("exceeds max backoff", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.MaxElapsedTime = 0
+
+		for _, after := range []string{"31", "99999999999999999"} {
+			seq := &statusSequence{
+				statuses: []int{429, 200},
+				headers:  []http.Header{{"Retry-After": []string{after}}},
+			}
+			rt, clock := newTestRetry(seq, policy)
+
+			resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, 429, resp.StatusCode)
+			assert.Equal(t, 1, seq.calls)
+			assert.Empty(t, clock.waits)
+		}
+	})
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	policy.MaxRetries = 100
+	policy.InitialBackoff = time.Second
+	policy.MaxBackoff = 4 * time.Second
+	policy.MaxElapsedTime = 10 * time.Second
+
+	seq := &statusSequence{statuses: []int{0}}
+	rt, clock := newTestRetry(seq, policy)
+
+	_, err := rt.RoundTrip(httptest.NewRequest(http.MethodGet, "http://localhost", nil)) //nolint:bodyclose // no response on error
+	require.Error(t, err)
+
+	var total time.Duration
+	for _, w := range clock.waits {
+		assert.LessOrEqual(t, w, 4*time.Second)
+		total += w
+	}
+	assert.LessOrEqual(t, total, 10*time.Second)
+	assert.Equal(t, len(clock.waits)+1, seq.calls)
+}
+
+func TestRetryIdempotency(t *testing.T) {
+	tests := map[string]struct {
+		method        string
+		header        string
+		nonIdempotent bool
+		calls         int
+	}{
+		"GET":                  {method: http.MethodGet, calls: 2},
+		"PUT":                  {method: http.MethodPut, calls: 2},
+		"POST":                 {method: http.MethodPost, calls: 1},
+		"POST with key":        {method: http.MethodPost, header: "Idempotency-Key", calls: 2},
+		"POST with X key":      {method: http.MethodPost, header: "X-Idempotency-Key", calls: 2},
+		"POST non idempotent":  {method: http.MethodPost, nonIdempotent: true, calls: 2},
+		"PATCH":                {method: http.MethodPatch, calls: 1},
+		"PATCH non idempotent": {method: http.MethodPatch, nonIdempotent: true, calls: 2},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			seq := &statusSequence{statuses: []int{503, 200}}
+			policy := DefaultRetryPolicy()
+			policy.RetryNonIdempotent = test.nonIdempotent
+			rt, _ := newTestRetry(seq, policy)
+
+			req, err := http.NewRequestWithContext(context.Background(), test.method, "http://localhost", strings.NewReader("payload"))
+			require.NoError(t, err)
+			if test.header != "" {
+				req.Header.Set(test.header, "abc")
+			}
+
+			resp, err := rt.RoundTrip(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, test.calls, seq.calls)
+			for _, body := range seq.bodies {
+				assert.Equal(t, "payload", body)
+			}
+		})
+	}
+}
+
+func TestRetryWithoutGetBody(t *testing.T) {
+	seq := &statusSequence{statuses: []int{503, 200}}
+	rt, _ := newTestRetry(seq, DefaultRetryPolicy())
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "http://localhost", io.NopCloser(strings.NewReader("payload")))
+	require.NoError(t, err)
+	require.Nil(t, req.GetBody)
+
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, 1, seq.calls)
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	seq := &statusSequence{statuses: []int{503}}
+	rt := &retryRoundTripper{rt: seq, policy: DefaultRetryPolicy(), now: time.Now, sleep: sleepContext}
+	rt.policy.InitialBackoff = time.Hour
+	rt.policy.MaxBackoff = time.Hour
+	rt.policy.MaxElapsedTime = 0
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+	require.NoError(t, err)
+
+	_, err = rt.RoundTrip(req) //nolint:bodyclose // no response on error
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, seq.calls)
+}
+
+func TestWithRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer server.Close()
+
+	settings := DefaultHTTPTransportSettings()
+	client, err := settings.Client(WithRetry(DefaultRetryPolicy()))
+	require.NoError(t, err)
+
+	resp, err := client.Get(server.URL) //nolint:noctx // It is a test
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ReadAll(resp)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	p := DefaultRetryPolicy()
+	require.NoError(t, p.Validate())
+
+	p.InitialBackoff = time.Minute
+	require.Error(t, p.Validate())
+}
@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"net"
+	"time"
+)
+
+// KeepAliveConfig configures TCP keepalive probes, allowing dead connections,
+// e.g. dropped by a NAT gateway, to be detected without waiting for the
+// operating system defaults.
+type KeepAliveConfig struct {
+	// Disable keepalive probes.
+	Disable bool `config:"disable"`
+
+	// Idle is the time a connection must be idle before the first probe is
+	// sent.
+	Idle time.Duration `config:"idle"`
+
+	// Interval is the time between probes.
+	Interval time.Duration `config:"interval"`
+
+	// Count is the number of unanswered probes after which the connection is
+	// closed.
+	Count int `config:"count"`
+}
+
+// apply configures the keepalive probes of the dialer. Settings equal to zero
+// use the defaults of the net package, negative settings use the defaults of
+// the operating system.
+func (c *KeepAliveConfig) apply(d *net.Dialer) {
+	if c == nil {
+		return
+	}
+
+	if c.Disable {
+		d.KeepAlive = -1
+		d.KeepAliveConfig = net.KeepAliveConfig{}
+		return
+	}
+
+	d.KeepAliveConfig = net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     c.Idle,
+		Interval: c.Interval,
+		Count:    c.Count,
+	}
+}
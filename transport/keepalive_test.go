@@ -0,0 +1,47 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAliveConfigApply(t *testing.T) {
+	d := &net.Dialer{}
+	var nilConfig *KeepAliveConfig
+	nilConfig.apply(d)
+	assert.Equal(t, &net.Dialer{}, d)
+
+	d = &net.Dialer{}
+	(&KeepAliveConfig{Idle: 10 * time.Second, Interval: 5 * time.Second, Count: 3}).apply(d)
+	assert.Equal(t, net.KeepAliveConfig{
+		Enable:   true,
+		Idle:     10 * time.Second,
+		Interval: 5 * time.Second,
+		Count:    3,
+	}, d.KeepAliveConfig)
+
+	d = &net.Dialer{}
+	(&KeepAliveConfig{Disable: true, Idle: time.Second}).apply(d)
+	assert.Equal(t, time.Duration(-1), d.KeepAlive)
+	assert.False(t, d.KeepAliveConfig.Enable)
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/api/npipe"
+)
+
+const unixScheme = "unix://"
+
+// IsLocalAddress returns true if the host refers to a unix domain socket,
+// like `unix:///var/run/es.sock`, or to a Windows named pipe, like
+// `npipe:///agent`, `npipe:////./pipe/agent` or `\\.\pipe\agent`.
+func IsLocalAddress(host string) bool {
+	return strings.HasPrefix(host, unixScheme) || npipe.IsNPipe(host)
+}
+
+// LocalDialer creates a dialer connecting to the unix domain socket or named
+// pipe the host refers to. The network and address passed to the dialer are
+// ignored. See IsLocalAddress.
+func LocalDialer(host string, timeout time.Duration) (Dialer, error) {
+	switch {
+	case strings.HasPrefix(host, unixScheme):
+		path := strings.TrimPrefix(host, unixScheme)
+		if path == "" {
+			return nil, fmt.Errorf("missing unix socket path in %v", host)
+		}
+		return UnixDialer(timeout, path), nil
+
+	case npipe.IsNPipe(host):
+		if runtime.GOOS != "windows" {
+			return nil, fmt.Errorf("cannot use %v as the host, named pipes are only supported on Windows", host)
+		}
+		dial := npipe.DialContext(npipe.TransformString(host))
+		return DialerFunc(func(ctx context.Context, _, _ string) (net.Conn, error) {
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			return dial(ctx, "", "")
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("%v is neither a unix socket nor a named pipe", host)
+	}
+}
+
+// makeLocalDialer creates the dialer stack for a local address. Proxy and
+// TCP specific settings of the configuration do not apply.
+func makeLocalDialer(c Config, host string) (Dialer, error) {
+	if c.TLS != nil {
+		return nil, fmt.Errorf("TLS is not supported when connecting to %v", host)
+	}
+
+	dialer, err := LocalDialer(host, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer = applyMiddlewares(LayerNetwork, dialer)
+	dialer = applyMiddlewares(LayerTransport, Chain(dialer, c.transportMiddlewares()...))
+	return applyMiddlewares(LayerTLS, dialer), nil
+}
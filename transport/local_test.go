@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func TestIsLocalAddress(t *testing.T) {
+	assert.True(t, IsLocalAddress("unix:///var/run/es.sock"))
+	assert.True(t, IsLocalAddress("npipe:///agent"))
+	assert.True(t, IsLocalAddress("npipe:////./pipe/agent"))
+	assert.True(t, IsLocalAddress(`\\.\pipe\agent`))
+
+	assert.False(t, IsLocalAddress("localhost:9200"))
+	assert.False(t, IsLocalAddress("/var/run/es.sock"))
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not tested on Windows")
+	}
+
+	// keep the path short, the length of unix socket paths is limited
+	dir, err := os.MkdirTemp("", "sock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.sock")
+
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}
+	}()
+
+	client, err := NewClient(Config{Timeout: 5 * time.Second}, "tcp", "unix://"+path, 9200, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	defer client.Close()
+
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(client, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestLocalDialerErrors(t *testing.T) {
+	_, err := LocalDialer("unix://", time.Second)
+	assert.ErrorContains(t, err, "missing unix socket path")
+
+	_, err = LocalDialer("localhost:9200", time.Second)
+	assert.Error(t, err)
+
+	if runtime.GOOS != "windows" {
+		_, err = LocalDialer("npipe:///agent", time.Second)
+		assert.ErrorContains(t, err, "named pipes are only supported on Windows")
+	}
+
+	_, err = NewClient(Config{TLS: &tlscommon.TLSConfig{}}, "tcp", "unix:///tmp/test.sock", 0, logptest.NewTestingLogger(t, ""))
+	assert.ErrorContains(t, err, "TLS is not supported")
+}
@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Middleware adds a layer to a dialer, e.g. to modify the sockets or wrap
+// the connections created by the dialer.
+type Middleware func(Dialer) Dialer
+
+// Layer defines the position in the dialer stack a registered Middleware is
+// inserted at.
+type Layer uint8
+
+const (
+	// LayerNetwork wraps the network dialer, before the proxy is applied.
+	// Connections are established to the resolved addresses of the host or
+	// the proxy.
+	LayerNetwork Layer = iota
+
+	// LayerTransport wraps the dialer after the proxy, throttling and
+	// statistics are applied, before TLS. Connections are established to the
+	// requested host.
+	LayerTransport
+
+	// LayerTLS wraps the complete dialer stack, including TLS.
+	LayerTLS
+)
+
+func (l Layer) String() string {
+	switch l {
+	case LayerNetwork:
+		return "network"
+	case LayerTransport:
+		return "transport"
+	case LayerTLS:
+		return "tls"
+	default:
+		return fmt.Sprintf("Layer(%d)", l)
+	}
+}
+
+type registeredMiddleware struct {
+	name  string
+	layer Layer
+	m     Middleware
+}
+
+var middlewares struct {
+	sync.RWMutex
+	list []registeredMiddleware
+}
+
+// RegisterMiddleware registers a middleware, which is inserted at the given
+// layer into all dialers created by MakeDialer and NewClient afterwards.
+// Middlewares of the same layer are applied in the order of registration,
+// the first middleware being the innermost. Returns an error if a middleware
+// with the same name has already been registered.
+func RegisterMiddleware(name string, layer Layer, m Middleware) error {
+	if layer > LayerTLS {
+		return fmt.Errorf("invalid dialer layer %v", layer)
+	}
+
+	middlewares.Lock()
+	defer middlewares.Unlock()
+
+	for _, r := range middlewares.list {
+		if r.name == name {
+			return fmt.Errorf("dialer middleware %v already registered", name)
+		}
+	}
+	middlewares.list = append(middlewares.list, registeredMiddleware{name: name, layer: layer, m: m})
+	return nil
+}
+
+// UnregisterMiddleware removes the middleware with the given name. Dialers
+// already created are not modified. Returns false if no middleware with the
+// name has been registered.
+func UnregisterMiddleware(name string) bool {
+	middlewares.Lock()
+	defer middlewares.Unlock()
+
+	i := slices.IndexFunc(middlewares.list, func(r registeredMiddleware) bool {
+		return r.name == name
+	})
+	if i < 0 {
+		return false
+	}
+	middlewares.list = slices.Delete(middlewares.list, i, i+1)
+	return true
+}
+
+// Chain wraps the dialer with the middlewares. The first middleware is the
+// innermost.
+func Chain(d Dialer, ms ...Middleware) Dialer {
+	for _, m := range ms {
+		if m != nil {
+			d = m(d)
+		}
+	}
+	return d
+}
+
+// applyMiddlewares wraps the dialer with the middlewares registered for the
+// layer.
+func applyMiddlewares(layer Layer, d Dialer) Dialer {
+	middlewares.RLock()
+	defer middlewares.RUnlock()
+
+	for _, r := range middlewares.list {
+		if r.layer == layer {
+			d = r.m(d)
+		}
+	}
+	return d
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+// recorder creates middlewares recording the order they are called in.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) middleware(name string) Middleware {
+	return func(d Dialer) Dialer {
+		return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			r.mu.Lock()
+			r.calls = append(r.calls, name)
+			r.mu.Unlock()
+			return d.DialContext(ctx, network, address)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	r := &recorder{}
+	base := DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, nil
+	})
+
+	d := Chain(base, r.middleware("inner"), nil, r.middleware("outer"))
+	_, err := d.DialContext(context.Background(), "tcp", "localhost:80")
+	require.NoError(t, err)
+
+	// the outermost middleware is called first
+	assert.Equal(t, []string{"outer", "inner"}, r.calls)
+}
+
+func TestRegisterMiddleware(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	r := &recorder{}
+	register := func(name string, layer Layer) {
+		require.NoError(t, RegisterMiddleware(name, layer, r.middleware(name)))
+		t.Cleanup(func() { UnregisterMiddleware(name) })
+	}
+	register("tls", LayerTLS)
+	register("network-1", LayerNetwork)
+	register("transport", LayerTransport)
+	register("network-2", LayerNetwork)
+
+	err = RegisterMiddleware("tls", LayerNetwork, r.middleware("duplicate"))
+	assert.ErrorContains(t, err, "already registered")
+	err = RegisterMiddleware("invalid", Layer(42), r.middleware("invalid"))
+	assert.ErrorContains(t, err, "invalid dialer layer Layer(42)")
+
+	dialer, err := MakeDialer(Config{Timeout: 5 * time.Second}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	conn, err := dialer.DialContext(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	assert.Equal(t, []string{"tls", "transport", "network-2", "network-1"}, r.calls)
+
+	assert.True(t, UnregisterMiddleware("transport"))
+	assert.False(t, UnregisterMiddleware("transport"))
+
+	r.calls = nil
+	dialer, err = MakeDialer(Config{Timeout: 5 * time.Second}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	conn, err = dialer.DialContext(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+
+	assert.Equal(t, []string{"tls", "network-2", "network-1"}, r.calls)
+}
@@ -19,6 +19,8 @@ package transport
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/url"
 
@@ -30,11 +32,12 @@ import (
 // ProxyConfig holds the configuration information required to proxy
 // connections through a SOCKS5 proxy server.
 type ProxyConfig struct {
-	// URL of the SOCKS proxy. Scheme must be socks5. Username and password can be
-	// embedded in the URL.
+	// URL of the SOCKS proxy. Scheme must be socks5 or socks5h. Username and
+	// password can be embedded in the URL.
 	URL string `config:"proxy_url"`
 
-	// Resolve names locally instead of on the SOCKS server.
+	// Resolve names locally instead of on the SOCKS server. Not supported with
+	// the socks5h scheme, which always resolves names on the SOCKS server.
 	LocalResolve bool `config:"proxy_use_local_resolver"`
 }
 
@@ -43,34 +46,67 @@ func (c *ProxyConfig) Validate() error {
 		return nil
 	}
 
+	_, err := c.parseURL()
+	return err
+}
+
+func (c *ProxyConfig) parseURL() (*url.URL, error) {
 	url, err := url.Parse(c.URL)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if _, err := proxy.FromURL(url, nil); err != nil {
-		return err
+
+	switch url.Scheme {
+	case "socks5":
+	case "socks5h":
+		if c.LocalResolve {
+			return nil, errors.New("proxy_use_local_resolver can not be used with the socks5h scheme")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%v', must be socks5 or socks5h", url.Scheme)
 	}
 
-	return nil
+	if _, err := proxy.FromURL(url, nil); err != nil {
+		return nil, err
+	}
+	return url, nil
 }
 
+// ProxyDialer wraps the forward dialer such that all connections are
+// established through the configured SOCKS5 proxy. If the proxy URL contains
+// a username, it is used with the password to authenticate with the proxy.
+// Names are resolved on the proxy, unless LocalResolve is set.
 func ProxyDialer(log *logp.Logger, config *ProxyConfig, forward Dialer) (Dialer, error) {
+	return proxyDialer(log, config, forward, net.DefaultResolver)
+}
+
+func proxyDialer(log *logp.Logger, config *ProxyConfig, forward Dialer, resolver Resolver) (Dialer, error) {
 	if config == nil || config.URL == "" {
 		return forward, nil
 	}
 
-	url, err := url.Parse(config.URL)
+	url, err := config.parseURL()
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := proxy.FromURL(url, nil); err != nil {
+	dialer, err := proxy.FromURL(url, forward)
+	if err != nil {
 		return nil, err
 	}
 
+	contextDialer, ok := dialer.(Dialer)
+	// This will never be executed because the proxy package always returns
+	// a ContextDialer but they didn't break the interface for backward compatibility.
+	// See golang/go#58376
+	if !ok {
+		contextDialer = DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialer.Dial(network, address)
+		})
+	}
+
 	log.Infof("proxy host: '%s'", url.Host)
 	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
-		var err error
 		var addresses []string
 
 		host, port, err := net.SplitHostPort(address)
@@ -79,7 +115,7 @@ func ProxyDialer(log *logp.Logger, config *ProxyConfig, forward Dialer) (Dialer,
 		}
 
 		if config.LocalResolve {
-			addresses, err = net.LookupHost(host)
+			addresses, err = resolver.LookupHost(ctx, host)
 			if err != nil {
 				log.Warnf(`DNS lookup failure "%s": %+v`, host, err)
 				return nil, err
@@ -91,21 +127,6 @@ func ProxyDialer(log *logp.Logger, config *ProxyConfig, forward Dialer) (Dialer,
 			addresses = []string{host}
 		}
 
-		dialer, err := proxy.FromURL(url, forward)
-		if err != nil {
-			return nil, err
-		}
-
-		contextDialer, ok := dialer.(Dialer)
-		// This will never be executed because the proxy package always returns
-		// a ContextDialer but they didn't break the interface for backward compatibility.
-		// See golang/go#58376
-		if !ok {
-			contextDialer = DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
-				return dialer.Dial(network, address)
-			})
-		}
-
 		return DialWith(ctx, contextDialer, network, host, addresses, port)
 	}), nil
 }
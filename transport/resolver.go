@@ -0,0 +1,298 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Resolver resolves host names to IP addresses. net.DefaultResolver
+// implements Resolver.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// TTLResolver is implemented by resolvers reporting the TTL of the resolved
+// records, like DNSResolver. CachingResolver uses the TTL to decide how long
+// to cache results. A negative TTL reports the TTL of the records is unknown.
+type TTLResolver interface {
+	LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error)
+}
+
+// CachingResolverConfig configures the CachingResolver.
+type CachingResolverConfig struct {
+	// TTL is used for resolvers not reporting the TTL of records.
+	TTL time.Duration `config:"ttl"`
+
+	// LookupTimeout bounds the lookups of the resolver, which are shared by
+	// all callers waiting for the same host. 10s if <= 0.
+	LookupTimeout time.Duration `config:"lookup_timeout"`
+
+	// MinTTL and MaxTTL clamp the TTL of cached records. MaxTTL is ignored if
+	// <= 0.
+	MinTTL time.Duration `config:"min_ttl"`
+	MaxTTL time.Duration `config:"max_ttl"`
+
+	// NegativeTTL is the time failed lookups are cached. Failures are not
+	// cached if <= 0.
+	NegativeTTL time.Duration `config:"negative_ttl"`
+
+	// StaleTTL is the time expired records are still returned if the lookup
+	// fails, such that brief resolver outages do not break connections.
+	// Expired records are never returned if <= 0.
+	StaleTTL time.Duration `config:"stale_ttl"`
+
+	// MaxEntries limits the number of cached hosts. Unlimited if <= 0.
+	MaxEntries int `config:"max_entries"`
+}
+
+// DefaultCachingResolverConfig returns the default configuration of the
+// CachingResolver.
+func DefaultCachingResolverConfig() CachingResolverConfig {
+	return CachingResolverConfig{
+		TTL:           time.Minute,
+		LookupTimeout: 10 * time.Second,
+		MinTTL:        time.Second,
+		MaxTTL:        time.Hour,
+		NegativeTTL:   5 * time.Second,
+		StaleTTL:      5 * time.Minute,
+		MaxEntries:    1024,
+	}
+}
+
+// Validate checks the TTLs are consistent.
+func (c *CachingResolverConfig) Validate() error {
+	if c.TTL < 0 || c.MinTTL < 0 || c.LookupTimeout < 0 {
+		return errors.New("ttl, min_ttl and lookup_timeout must not be negative")
+	}
+	if c.MaxTTL > 0 && c.MinTTL > c.MaxTTL {
+		return fmt.Errorf("min_ttl %v must not be greater than max_ttl %v", c.MinTTL, c.MaxTTL)
+	}
+	return nil
+}
+
+// CachingResolver caches the results of another resolver. Concurrent lookups
+// of the same host are combined into a single lookup, which is not cancelled
+// with the context of the callers but bounded by the configured timeout.
+//
+// The following metrics are reported:
+//   - hits: lookups answered from the cache
+//   - misses: lookups forwarded to the resolver
+//   - negative_hits: lookups answered with a cached failure
+//   - stale_hits: lookups answered with an expired record, because the
+//     resolver failed
+//   - errors: failed lookups of the resolver
+//   - entries: number of cached hosts
+type CachingResolver struct {
+	resolver Resolver
+	config   CachingResolverConfig
+	now      func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*resolverEntry
+	inflight map[string]*resolverCall
+
+	hits, misses, negativeHits, staleHits, lookupErrors *monitoring.Uint
+	size                                                *monitoring.Int
+}
+
+type resolverEntry struct {
+	addresses  []string
+	err        error
+	expires    time.Time
+	staleUntil time.Time
+}
+
+type resolverCall struct {
+	done      chan struct{}
+	addresses []string
+	err       error
+}
+
+// NewCachingResolver creates a CachingResolver for the given resolver. If
+// resolver is nil, net.DefaultResolver is used. Pass a DNSResolver to cache
+// the records according to their TTL. Metrics are registered with reg, if not
+// nil.
+func NewCachingResolver(resolver Resolver, config CachingResolverConfig, reg *monitoring.Registry) *CachingResolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if reg == nil {
+		reg = monitoring.NewRegistry()
+	}
+
+	return &CachingResolver{
+		resolver:     resolver,
+		config:       config,
+		now:          time.Now,
+		entries:      map[string]*resolverEntry{},
+		inflight:     map[string]*resolverCall{},
+		hits:         monitoring.NewUint(reg, "hits"),
+		misses:       monitoring.NewUint(reg, "misses"),
+		negativeHits: monitoring.NewUint(reg, "negative_hits"),
+		staleHits:    monitoring.NewUint(reg, "stale_hits"),
+		lookupErrors: monitoring.NewUint(reg, "errors"),
+		size:         monitoring.NewInt(reg, "entries"),
+	}
+}
+
+// LookupHost returns the addresses of the host, from the cache if possible.
+// If a lookup of the host is already in progress, LookupHost waits for its
+// result. If ctx is done first, LookupHost returns ctx.Err() while the lookup
+// continues for the other callers.
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	r.mu.Lock()
+	if e := r.entries[host]; e != nil && r.now().Before(e.expires) {
+		r.mu.Unlock()
+		if e.err != nil {
+			r.negativeHits.Inc()
+			return nil, e.err
+		}
+		r.hits.Inc()
+		return slices.Clone(e.addresses), nil
+	}
+
+	call, running := r.inflight[host]
+	if !running {
+		call = &resolverCall{done: make(chan struct{})}
+		r.inflight[host] = call
+		r.misses.Inc()
+		go r.resolve(context.WithoutCancel(ctx), host, call)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return slices.Clone(call.addresses), call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve runs the lookup shared by all callers waiting for call.
+func (r *CachingResolver) resolve(ctx context.Context, host string, call *resolverCall) {
+	timeout := r.config.LookupTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	call.addresses, call.err = r.lookup(ctx, host)
+
+	r.mu.Lock()
+	delete(r.inflight, host)
+	r.mu.Unlock()
+	close(call.done)
+}
+
+func (r *CachingResolver) lookup(ctx context.Context, host string) ([]string, error) {
+	var addresses []string
+	var ttl time.Duration
+	var err error
+	if tr, ok := r.resolver.(TTLResolver); ok {
+		addresses, ttl, err = tr.LookupHostTTL(ctx, host)
+	} else {
+		addresses, err = r.resolver.LookupHost(ctx, host)
+		ttl = -1
+	}
+	if ttl < 0 {
+		ttl = r.config.TTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if err != nil {
+		r.lookupErrors.Inc()
+
+		old := r.entries[host]
+		if old != nil && old.err == nil && now.Before(old.staleUntil) {
+			r.staleHits.Inc()
+			return old.addresses, nil
+		}
+
+		// do not cache timeouts of the lookup
+		if r.config.NegativeTTL > 0 && ctx.Err() == nil {
+			r.store(host, &resolverEntry{err: err, expires: now.Add(r.config.NegativeTTL)})
+		}
+		return nil, err
+	}
+
+	ttl = max(ttl, r.config.MinTTL)
+	if r.config.MaxTTL > 0 {
+		ttl = min(ttl, r.config.MaxTTL)
+	}
+	expires := now.Add(ttl)
+	r.store(host, &resolverEntry{
+		addresses:  addresses,
+		expires:    expires,
+		staleUntil: expires.Add(max(r.config.StaleTTL, 0)),
+	})
+	return addresses, nil
+}
+
+// store adds the entry to the cache, evicting entries if the cache is full.
+// r.mu must be held by the caller.
+func (r *CachingResolver) store(host string, e *resolverEntry) {
+	if _, exists := r.entries[host]; !exists && r.config.MaxEntries > 0 && len(r.entries) >= r.config.MaxEntries {
+		r.evict()
+	}
+	r.entries[host] = e
+	r.size.Set(int64(len(r.entries)))
+}
+
+// evict removes all entries that can not be used anymore. If there are none,
+// an arbitrary entry is removed.
+// r.mu must be held by the caller.
+func (r *CachingResolver) evict() {
+	now := r.now()
+	for host, e := range r.entries {
+		if !now.Before(e.expires) && !now.Before(e.staleUntil) {
+			delete(r.entries, host)
+		}
+	}
+	if len(r.entries) < r.config.MaxEntries {
+		return
+	}
+	for host := range r.entries {
+		delete(r.entries, host)
+		return
+	}
+}
+
+// Flush removes all entries from the cache.
+func (r *CachingResolver) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.entries)
+	r.size.Set(0)
+}
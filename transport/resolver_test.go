@@ -0,0 +1,319 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+type fakeResolver struct {
+	mu        sync.Mutex
+	addresses map[string][]string
+	ttl       time.Duration
+	err       error
+	lookups   atomic.Int32
+	block     chan struct{}
+}
+
+func (r *fakeResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	r.lookups.Add(1)
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	addrs, ok := r.addresses[host]
+	if !ok {
+		return nil, 0, errors.New("no such host")
+	}
+	return addrs, r.ttl, nil
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.LookupHostTTL(ctx, host)
+	return addrs, err
+}
+
+func (r *fakeResolver) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// plainResolver hides the TTLResolver implementation.
+type plainResolver struct{ r *fakeResolver }
+
+func (p plainResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return p.r.LookupHost(ctx, host)
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestCachingResolver(t *testing.T, r Resolver, config CachingResolverConfig) (*CachingResolver, *fakeClock, *monitoring.Registry) {
+	t.Helper()
+	require.NoError(t, config.Validate())
+
+	reg := monitoring.NewRegistry()
+	clock := &fakeClock{t: time.Now()}
+	cr := NewCachingResolver(r, config, reg)
+	cr.now = clock.now
+	return cr, clock, reg
+}
+
+func metricValue(reg *monitoring.Registry, name string) interface{} {
+	return monitoring.CollectFlatSnapshot(reg, monitoring.Full, false).Ints[name]
+}
+
+func TestCachingResolverTTL(t *testing.T) {
+	fake := &fakeResolver{addresses: map[string][]string{"example.com": {"10.0.0.1"}}, ttl: 10 * time.Second}
+	config := DefaultCachingResolverConfig()
+	r, clock, reg := newTestCachingResolver(t, fake, config)
+	ctx := context.Background()
+
+	addrs, err := r.LookupHost(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+
+	clock.advance(9 * time.Second)
+	_, err = r.LookupHost(ctx, "example.com")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, fake.lookups.Load())
+
+	clock.advance(2 * time.Second)
+	_, err = r.LookupHost(ctx, "example.com")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, fake.lookups.Load())
+
+	assert.EqualValues(t, 1, metricValue(reg, "hits"))
+	assert.EqualValues(t, 2, metricValue(reg, "misses"))
+	assert.EqualValues(t, 1, metricValue(reg, "entries"))
+
+	// IP addresses are never looked up
+	addrs, err = r.LookupHost(ctx, "::1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"::1"}, addrs)
+	assert.EqualValues(t, 2, fake.lookups.Load())
+}
+
+func TestCachingResolverClampsTTL(t *testing.T) {
+	cases := map[string]struct {
+		resolver Resolver
+		ttl      time.Duration
+		expected time.Duration
+	}{
+		"min":     {ttl: 0, expected: 5 * time.Second},
+		"max":     {ttl: time.Hour, expected: time.Minute},
+		"in":      {ttl: 30 * time.Second, expected: 30 * time.Second},
+		"default": {expected: 20 * time.Second},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeResolver{addresses: map[string][]string{"example.com": {"10.0.0.1"}}, ttl: tc.ttl}
+			var resolver Resolver = fake
+			if name == "default" {
+				resolver = plainResolver{fake}
+			}
+
+			config := CachingResolverConfig{TTL: 20 * time.Second, MinTTL: 5 * time.Second, MaxTTL: time.Minute}
+			r, clock, _ := newTestCachingResolver(t, resolver, config)
+
+			_, err := r.LookupHost(context.Background(), "example.com")
+			require.NoError(t, err)
+
+			clock.advance(tc.expected - time.Millisecond)
+			_, err = r.LookupHost(context.Background(), "example.com")
+			require.NoError(t, err)
+			assert.EqualValues(t, 1, fake.lookups.Load())
+
+			clock.advance(time.Millisecond)
+			_, err = r.LookupHost(context.Background(), "example.com")
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, fake.lookups.Load())
+		})
+	}
+}
+
+func TestCachingResolverNegativeCaching(t *testing.T) {
+	fake := &fakeResolver{addresses: map[string][]string{}}
+	config := DefaultCachingResolverConfig()
+	config.NegativeTTL = 5 * time.Second
+	r, clock, reg := newTestCachingResolver(t, fake, config)
+	ctx := context.Background()
+
+	_, err := r.LookupHost(ctx, "missing.com")
+	assert.ErrorContains(t, err, "no such host")
+	_, err = r.LookupHost(ctx, "missing.com")
+	assert.ErrorContains(t, err, "no such host")
+	assert.EqualValues(t, 1, fake.lookups.Load())
+
+	clock.advance(5 * time.Second)
+	_, err = r.LookupHost(ctx, "missing.com")
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, fake.lookups.Load())
+
+	assert.EqualValues(t, 1, metricValue(reg, "negative_hits"))
+	assert.EqualValues(t, 2, metricValue(reg, "errors"))
+
+	// timeouts of the lookup are not cached
+	config.LookupTimeout = 10 * time.Millisecond
+	r, _, _ = newTestCachingResolver(t, slowResolver{fake}, config)
+	_, err = r.LookupHost(ctx, "other.com")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	fake.addresses["other.com"] = []string{"10.0.0.2"}
+	r.resolver = fake
+	addrs, err := r.LookupHost(ctx, "other.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2"}, addrs)
+}
+
+// slowResolver fails with the context error.
+type slowResolver struct{ r *fakeResolver }
+
+func (s slowResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCachingResolverCancelledCaller(t *testing.T) {
+	fake := &fakeResolver{
+		addresses: map[string][]string{"example.com": {"10.0.0.1"}},
+		block:     make(chan struct{}),
+	}
+	r, _, _ := newTestCachingResolver(t, fake, DefaultCachingResolverConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := r.LookupHost(ctx, "example.com")
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return fake.lookups.Load() == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan []string, 1)
+	go func() {
+		addrs, err := r.LookupHost(context.Background(), "example.com")
+		assert.NoError(t, err)
+		second <- addrs
+	}()
+
+	// cancelling the caller starting the lookup does not fail the other callers
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(fake.block)
+	assert.Equal(t, []string{"10.0.0.1"}, <-second)
+	assert.EqualValues(t, 1, fake.lookups.Load())
+}
+
+func TestCachingResolverServesStale(t *testing.T) {
+	fake := &fakeResolver{addresses: map[string][]string{"example.com": {"10.0.0.1"}}, ttl: 10 * time.Second}
+	config := DefaultCachingResolverConfig()
+	config.StaleTTL = time.Minute
+	r, clock, reg := newTestCachingResolver(t, fake, config)
+	ctx := context.Background()
+
+	_, err := r.LookupHost(ctx, "example.com")
+	require.NoError(t, err)
+
+	fake.setErr(errors.New("resolver down"))
+	clock.advance(30 * time.Second)
+	addrs, err := r.LookupHost(ctx, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1"}, addrs)
+	assert.EqualValues(t, 1, metricValue(reg, "stale_hits"))
+
+	clock.advance(time.Minute)
+	_, err = r.LookupHost(ctx, "example.com")
+	assert.ErrorContains(t, err, "resolver down")
+}
+
+func TestCachingResolverCombinesLookups(t *testing.T) {
+	fake := &fakeResolver{
+		addresses: map[string][]string{"example.com": {"10.0.0.1"}},
+		block:     make(chan struct{}),
+	}
+	r, _, _ := newTestCachingResolver(t, fake, DefaultCachingResolverConfig())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addrs, err := r.LookupHost(context.Background(), "example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"10.0.0.1"}, addrs)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return fake.lookups.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	close(fake.block)
+	wg.Wait()
+	assert.EqualValues(t, 1, fake.lookups.Load())
+}
+
+func TestCachingResolverMaxEntries(t *testing.T) {
+	fake := &fakeResolver{addresses: map[string][]string{"a": {"10.0.0.1"}, "b": {"10.0.0.2"}, "c": {"10.0.0.3"}}}
+	config := DefaultCachingResolverConfig()
+	config.MaxEntries = 2
+	r, _, reg := newTestCachingResolver(t, fake, config)
+
+	for _, host := range []string{"a", "b", "c"} {
+		_, err := r.LookupHost(context.Background(), host)
+		require.NoError(t, err)
+	}
+	assert.EqualValues(t, 2, metricValue(reg, "entries"))
+
+	r.Flush()
+	assert.EqualValues(t, 0, metricValue(reg, "entries"))
+}
+
+func TestCachingResolverDefaultResolver(t *testing.T) {
+	// the system resolver honors the hosts file and nsswitch
+	r := NewCachingResolver(nil, DefaultCachingResolverConfig(), nil)
+	assert.Equal(t, net.DefaultResolver, r.resolver)
+}
+
+func TestCachingResolverConfigValidate(t *testing.T) {
+	config := DefaultCachingResolverConfig()
+	assert.NoError(t, config.Validate())
+
+	config.MinTTL = 2 * time.Hour
+	assert.ErrorContains(t, config.Validate(), "must not be greater than max_ttl")
+
+	config = CachingResolverConfig{TTL: -1}
+	assert.Error(t, config.Validate())
+}
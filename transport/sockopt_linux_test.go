@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package transport
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestUserTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			defer conn.Close()
+			_, _ = conn.Read(make([]byte, 1))
+		}
+	}()
+
+	config := Config{
+		Timeout:     5 * time.Second,
+		UserTimeout: 3 * time.Second,
+		KeepAlive:   &KeepAliveConfig{Idle: 7 * time.Second, Interval: 2 * time.Second, Count: 4},
+	}
+	dialer, err := MakeDialer(config, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+
+	conn, err := dialer.DialContext(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	require.NoError(t, err)
+
+	getsockopt := func(level, opt int) int {
+		var v int
+		var sockErr error
+		require.NoError(t, raw.Control(func(fd uintptr) {
+			v, sockErr = unix.GetsockoptInt(int(fd), level, opt)
+		}))
+		require.NoError(t, sockErr)
+		return v
+	}
+
+	assert.Equal(t, 3000, getsockopt(unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT))
+	assert.Equal(t, 1, getsockopt(unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+	assert.Equal(t, 7, getsockopt(unix.IPPROTO_TCP, unix.TCP_KEEPIDLE))
+	assert.Equal(t, 2, getsockopt(unix.IPPROTO_TCP, unix.TCP_KEEPINTVL))
+	assert.Equal(t, 4, getsockopt(unix.IPPROTO_TCP, unix.TCP_KEEPCNT))
+}
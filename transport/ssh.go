@@ -0,0 +1,368 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig configures tunneling connections through an SSH jump host. The
+// connections are forwarded by the SSH server, like with `ssh -J`.
+type SSHConfig struct {
+	// Host of the SSH server. The port defaults to 22.
+	Host string `config:"host" validate:"required"`
+
+	// User to authenticate as.
+	User string `config:"user" validate:"required"`
+
+	// KeyFile is the path of the private key used to authenticate. If the
+	// key is encrypted, KeyPassphrase is used to decrypt it.
+	KeyFile       string `config:"key_file"`
+	KeyPassphrase string `config:"key_passphrase"`
+
+	// UseAgent authenticates using the keys of the SSH agent listening on
+	// the SSH_AUTH_SOCK socket.
+	UseAgent bool `config:"use_agent"`
+
+	// HostKeys pins the accepted host keys of the SSH server. Entries are
+	// public keys in the authorized_keys format, like `ssh-ed25519 AAAA...`,
+	// or SHA256 fingerprints, like `SHA256:...`.
+	HostKeys []string `config:"host_keys"`
+
+	// KnownHostsFile is the path of a known_hosts file used to verify the
+	// host key of the SSH server.
+	KnownHostsFile string `config:"known_hosts_file"`
+
+	// KeepAlive is the interval of keepalive requests sent to the SSH
+	// server. The SSH connection is closed if a request fails, and is
+	// reestablished with the next dial. Disabled if <= 0.
+	KeepAlive time.Duration `config:"keepalive"`
+}
+
+// Validate checks that an authentication method and a host key
+// verification method are configured.
+func (c *SSHConfig) Validate() error {
+	if c.KeyFile == "" && !c.UseAgent {
+		return errors.New("ssh requires key_file or use_agent to be set")
+	}
+	if len(c.HostKeys) == 0 && c.KnownHostsFile == "" {
+		return errors.New("ssh requires host_keys or known_hosts_file to be set")
+	}
+	if _, err := c.hostKeyCallback(); err != nil {
+		return err
+	}
+	if c.KeyFile != "" {
+		if _, err := c.keySigner(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SSHConfig) address() string {
+	if _, _, err := net.SplitHostPort(c.Host); err == nil {
+		return c.Host
+	}
+	return net.JoinHostPort(strings.Trim(c.Host, "[]"), "22")
+}
+
+func (c *SSHConfig) keySigner() (ssh.Signer, error) {
+	pem, err := os.ReadFile(c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ssh key: %w", err)
+	}
+
+	var signer ssh.Signer
+	if c.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(c.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ssh key %v: %w", c.KeyFile, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback accepts host keys matching any of the pinned keys or the
+// known hosts file.
+func (c *SSHConfig) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	var keys []ssh.PublicKey
+	var fingerprints []string
+	for _, entry := range c.HostKeys {
+		if strings.HasPrefix(entry, "SHA256:") {
+			fingerprints = append(fingerprints, entry)
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(entry))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh host key '%v': %w", entry, err)
+		}
+		keys = append(keys, key)
+	}
+
+	var knownHosts ssh.HostKeyCallback
+	if c.KnownHostsFile != "" {
+		var err error
+		knownHosts, err = knownhosts.New(c.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		for _, k := range keys {
+			if bytes.Equal(k.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		for _, fp := range fingerprints {
+			if fp == fingerprint {
+				return nil
+			}
+		}
+		if knownHosts != nil {
+			return knownHosts(hostname, remote, key)
+		}
+		return fmt.Errorf("ssh host key %v of %v is not trusted", fingerprint, hostname)
+	}, nil
+}
+
+// SSHDialer creates a dialer establishing connections through the SSH
+// server. The SSH connection is established via the forward dialer with the
+// first dial, and is shared by all connections until the tunnel is closed.
+func SSHDialer(config *SSHConfig, forward Dialer, timeout time.Duration) (*SSHTunnel, error) {
+	if config == nil {
+		return nil, errors.New("ssh config is required")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := config.hostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	return &SSHTunnel{
+		config:          config,
+		forward:         forward,
+		timeout:         timeout,
+		hostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// SSHTunnel is a dialer establishing connections through an SSH server, see
+// SSHDialer.
+type SSHTunnel struct {
+	config          *SSHConfig
+	forward         Dialer
+	timeout         time.Duration
+	hostKeyCallback ssh.HostKeyCallback
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// Dial connects to the address through the SSH server.
+func (t *SSHTunnel) Dial(network, address string) (net.Conn, error) {
+	return t.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address through the SSH server, connecting to
+// the SSH server first if no SSH connection is established.
+func (t *SSHTunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network type %v", network)
+	}
+
+	client, err := t.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, network, address)
+}
+
+// Close closes the SSH connection, including all connections tunneled
+// through it, and stops its keepalive requests. The next dial establishes a
+// new SSH connection.
+func (t *SSHTunnel) Close() error {
+	t.mu.Lock()
+	client := t.client
+	t.client = nil
+	t.mu.Unlock()
+
+	if client == nil {
+		return nil
+	}
+	if err := client.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// getClient returns the SSH client, connecting to the SSH server if no
+// connection is established.
+func (t *SSHTunnel) getClient(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := t.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ssh connection to %v failed: %w", t.config.Host, err)
+	}
+	t.client = client
+
+	go func() {
+		_ = client.Wait()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.client == client {
+			t.client = nil
+		}
+	}()
+	if t.config.KeepAlive > 0 {
+		go sshKeepAlive(client, t.config.KeepAlive)
+	}
+	return client, nil
+}
+
+func (t *SSHTunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	var auth []ssh.Signer
+	if t.config.KeyFile != "" {
+		signer, err := t.config.keySigner()
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, signer)
+	}
+	if t.config.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, errors.New("ssh agent not available, SSH_AUTH_SOCK is not set")
+		}
+		var d net.Dialer
+		agentConn, err := d.DialContext(ctx, "unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh agent: %w", err)
+		}
+		// the agent is only required during the handshake
+		defer agentConn.Close()
+
+		signers, err := agent.NewClient(agentConn).Signers()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get keys from ssh agent: %w", err)
+		}
+		auth = append(auth, signers...)
+	}
+
+	address := t.config.address()
+	conn, err := t.forward.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if t.timeout > 0 {
+		if d := time.Now().Add(t.timeout); !ok || d.Before(deadline) {
+			deadline, ok = d, true
+		}
+	}
+	if ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, &ssh.ClientConfig{
+		User:            t.config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(auth...)},
+		HostKeyCallback: t.hostKeyCallback,
+	})
+	if err != nil {
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	if !stop() {
+		sshConn.Close()
+		return nil, ctx.Err()
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// sshKeepAlive sends keepalive requests until sending a request fails, in
+// which case the client is closed.
+func sshKeepAlive(client *ssh.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		errC := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errC <- err
+		}()
+
+		select {
+		case <-done:
+			return
+		case err := <-errC:
+			if err != nil {
+				client.Close()
+				return
+			}
+		case <-time.After(interval):
+			client.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+// testSSHServer is a SSH server supporting direct-tcpip channels, as used
+// for `ssh -J`. Only the given client key is authorized.
+type testSSHServer struct {
+	addr    string
+	hostKey ssh.Signer
+	conns   atomic.Int32
+}
+
+func newTestSSHServer(t *testing.T, clientKey ssh.PublicKey) *testSSHServer {
+	t.Helper()
+
+	_, hostKey := newTestKey(t)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "agent" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	s := &testSSHServer{addr: l.Addr().String(), hostKey: hostKey}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	s.conns.Add(1)
+
+	go func() {
+		for req := range reqs {
+			_ = req.Reply(req.Type == "keepalive@openssh.com", nil)
+		}
+	}()
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "direct-tcpip" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+
+		// host, port, origin host, origin port
+		data := newChan.ExtraData()
+		hostLen := binary.BigEndian.Uint32(data)
+		host := string(data[4 : 4+hostLen])
+		port := binary.BigEndian.Uint32(data[4+hostLen:])
+
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			_ = newChan.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+		go func() {
+			defer ch.Close()
+			defer target.Close()
+			go func() { _, _ = io.Copy(target, ch) }()
+			_, _ = io.Copy(ch, target)
+		}()
+	}
+}
+
+// newEchoServer returns the address of a server echoing everything back.
+func newEchoServer(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func newTestKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+	return priv, signer
+}
+
+func writeTestKey(t *testing.T, priv ed25519.PrivateKey, passphrase string) string {
+	t.Helper()
+
+	var block *pem.Block
+	var err error
+	if passphrase != "" {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, "")
+	}
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	return path
+}
+
+func requireEcho(t *testing.T, d Dialer, addr string) {
+	t.Helper()
+
+	conn, err := d.DialContext(t.Context(), "tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+}
+
+func TestSSHDialer(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	keyFile := writeTestKey(t, priv, "secret")
+	server := newTestSSHServer(t, signer.PublicKey())
+	hostKey := string(ssh.MarshalAuthorizedKey(server.hostKey.PublicKey()))
+
+	tests := map[string][]string{
+		"pinned key":         {hostKey},
+		"pinned fingerprint": {ssh.FingerprintSHA256(server.hostKey.PublicKey())},
+	}
+	for name, hostKeys := range tests {
+		t.Run(name, func(t *testing.T) {
+			config := &SSHConfig{
+				Host:          server.addr,
+				User:          "agent",
+				KeyFile:       keyFile,
+				KeyPassphrase: "secret",
+				HostKeys:      hostKeys,
+			}
+			d, err := SSHDialer(config, NetDialer(time.Second), time.Second)
+			require.NoError(t, err)
+
+			before := server.conns.Load()
+			requireEcho(t, d, echo)
+			requireEcho(t, d, echo)
+			assert.Equal(t, before+1, server.conns.Load(), "the SSH connection is shared")
+		})
+	}
+}
+
+func TestSSHDialerKnownHosts(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	keyFile := writeTestKey(t, priv, "")
+	server := newTestSSHServer(t, signer.PublicKey())
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhostsLine(server.addr, server.hostKey.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+
+	d, err := MakeDialer(Config{
+		Timeout: time.Second,
+		SSH: &SSHConfig{
+			Host:           server.addr,
+			User:           "agent",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHosts,
+		},
+	}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	requireEcho(t, d, echo)
+}
+
+func knownhostsLine(addr string, key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+}
+
+func TestSSHDialerAgent(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	server := newTestSSHServer(t, signer.PublicKey())
+
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: priv}))
+
+	// unix socket paths are limited in length, avoid the long test paths
+	dir, err := os.MkdirTemp("", "agent")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "agent.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	d, err := SSHDialer(&SSHConfig{
+		Host:      server.addr,
+		User:      "agent",
+		UseAgent:  true,
+		HostKeys:  []string{ssh.FingerprintSHA256(server.hostKey.PublicKey())},
+		KeepAlive: 10 * time.Millisecond,
+	}, NetDialer(time.Second), time.Second)
+	require.NoError(t, err)
+	requireEcho(t, d, echo)
+
+	// the connection is kept alive
+	time.Sleep(50 * time.Millisecond)
+	requireEcho(t, d, echo)
+	assert.EqualValues(t, 1, server.conns.Load())
+}
+
+func TestSSHDialerHostKeyMismatch(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	keyFile := writeTestKey(t, priv, "")
+	server := newTestSSHServer(t, signer.PublicKey())
+	_, other := newTestKey(t)
+
+	d, err := SSHDialer(&SSHConfig{
+		Host:     server.addr,
+		User:     "agent",
+		KeyFile:  keyFile,
+		HostKeys: []string{ssh.FingerprintSHA256(other.PublicKey())},
+	}, NetDialer(time.Second), time.Second)
+	require.NoError(t, err)
+
+	_, err = d.DialContext(t.Context(), "tcp", echo)
+	require.ErrorContains(t, err, "is not trusted")
+}
+
+func TestSSHDialerReconnect(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	server := newTestSSHServer(t, signer.PublicKey())
+
+	config := &SSHConfig{
+		Host:     server.addr,
+		User:     "agent",
+		KeyFile:  writeTestKey(t, priv, ""),
+		HostKeys: []string{ssh.FingerprintSHA256(server.hostKey.PublicKey())},
+	}
+	tunnel, err := SSHDialer(config, NetDialer(time.Second), time.Second)
+	require.NoError(t, err)
+	d := tunnel
+	requireEcho(t, d, echo)
+
+	tunnel.mu.Lock()
+	tunnel.client.Close()
+	tunnel.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		tunnel.mu.Lock()
+		defer tunnel.mu.Unlock()
+		return tunnel.client == nil
+	}, time.Second, time.Millisecond)
+	requireEcho(t, d, echo)
+	assert.EqualValues(t, 2, server.conns.Load())
+}
+
+func TestSSHTunnelClose(t *testing.T) {
+	echo := newEchoServer(t)
+	priv, signer := newTestKey(t)
+	server := newTestSSHServer(t, signer.PublicKey())
+
+	config := &SSHConfig{
+		Host:      server.addr,
+		User:      "agent",
+		KeyFile:   writeTestKey(t, priv, ""),
+		HostKeys:  []string{ssh.FingerprintSHA256(server.hostKey.PublicKey())},
+		KeepAlive: 10 * time.Millisecond,
+	}
+	d, err := MakeDialer(Config{Timeout: time.Second, SSH: config}, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	closer, ok := d.(io.Closer)
+	require.True(t, ok, "dialers tunneling through SSH must be closable")
+
+	conn, err := d.DialContext(t.Context(), "tcp", echo)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, closer.Close())
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err, "tunneled connections are closed with the tunnel")
+	require.NoError(t, closer.Close())
+
+	// dialing again reestablishes the SSH connection
+	requireEcho(t, d, echo)
+	assert.EqualValues(t, 2, server.conns.Load())
+	require.NoError(t, closer.Close())
+}
+
+func TestSSHConfigValidate(t *testing.T) {
+	priv, _ := newTestKey(t)
+	keyFile := writeTestKey(t, priv, "secret")
+
+	tests := map[string]SSHConfig{
+		"no auth":        {Host: "jump", User: "user", HostKeys: []string{"SHA256:abc"}},
+		"no host key":    {Host: "jump", User: "user", UseAgent: true},
+		"invalid key":    {Host: "jump", User: "user", UseAgent: true, HostKeys: []string{"ssh-ed25519 invalid"}},
+		"wrong password": {Host: "jump", User: "user", KeyFile: keyFile, KeyPassphrase: "wrong", HostKeys: []string{"SHA256:abc"}},
+		"missing key":    {Host: "jump", User: "user", KeyFile: keyFile + ".missing", HostKeys: []string{"SHA256:abc"}},
+		"no known hosts": {Host: "jump", User: "user", UseAgent: true, KnownHostsFile: keyFile + ".missing"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, config.Validate())
+		})
+	}
+
+	config := SSHConfig{Host: "jump", User: "user", KeyFile: keyFile, KeyPassphrase: "secret", HostKeys: []string{"SHA256:abc"}}
+	require.NoError(t, config.Validate())
+	assert.Equal(t, "jump:22", config.address())
+	config.Host = "::1"
+	assert.Equal(t, "[::1]:22", config.address())
+	config.Host = "jump:2222"
+	assert.Equal(t, "jump:2222", config.address())
+}
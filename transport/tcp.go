@@ -32,7 +32,17 @@ func NetDialer(timeout time.Duration) Dialer {
 	return TestNetDialer(testing.NullDriver, timeout)
 }
 
+// NetDialerWithResolver creates a dialer resolving host names with the given
+// resolver, e.g. a CachingResolver.
+func NetDialerWithResolver(timeout time.Duration, resolver Resolver) Dialer {
+	return testNetDialer(testing.NullDriver, &net.Dialer{Timeout: timeout}, resolver)
+}
+
 func TestNetDialer(d testing.Driver, timeout time.Duration) Dialer {
+	return testNetDialer(d, &net.Dialer{Timeout: timeout}, net.DefaultResolver)
+}
+
+func testNetDialer(d testing.Driver, dialer *net.Dialer, resolver Resolver) Dialer {
 	return DialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
 		switch network {
 		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
@@ -46,7 +56,7 @@ func TestNetDialer(d testing.Driver, timeout time.Duration) Dialer {
 		if err != nil {
 			return nil, err
 		}
-		addresses, err := net.LookupHost(host)
+		addresses, err := resolver.LookupHost(ctx, host)
 		d.Fatal("dns lookup", err)
 		d.Info("addresses", strings.Join(addresses, ", "))
 		if err != nil {
@@ -55,7 +65,6 @@ func TestNetDialer(d testing.Driver, timeout time.Duration) Dialer {
 		}
 
 		// dial via host IP by randomized iteration of known IPs
-		dialer := &net.Dialer{Timeout: timeout}
 		return DialWith(ctx, dialer, network, host, addresses, port)
 	})
 }
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig limits the bandwidth used by a connection. Limits are
+// applied to each connection individually.
+type ThrottleConfig struct {
+	// ReadBytesPerSec and WriteBytesPerSec limit the rate of reads and
+	// writes. A limit <= 0 disables throttling in that direction.
+	ReadBytesPerSec  int `config:"read_bytes_per_sec"`
+	WriteBytesPerSec int `config:"write_bytes_per_sec"`
+
+	// Burst is the number of bytes that can be read or written at once
+	// without being throttled. If <= 0, the burst equals the rate, allowing
+	// one second worth of data to be sent at once.
+	Burst int `config:"burst"`
+}
+
+// Validate checks the configured burst can be used.
+func (c *ThrottleConfig) Validate() error {
+	if c.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
+}
+
+func (c *ThrottleConfig) enabled() bool {
+	return c != nil && (c.ReadBytesPerSec > 0 || c.WriteBytesPerSec > 0)
+}
+
+// ThrottleDialer wraps the connections created by d, limiting their bandwidth
+// according to the configuration.
+func ThrottleDialer(d Dialer, config *ThrottleConfig) Dialer {
+	if !config.enabled() {
+		return d
+	}
+	return ConnWrapper(d, func(c net.Conn) net.Conn {
+		return ThrottleConn(c, config)
+	})
+}
+
+// ThrottleConn wraps the connection, limiting its bandwidth according to the
+// configuration. Reads and writes blocked by the limit honor the deadlines
+// of the connection and are interrupted when the connection is closed.
+func ThrottleConn(c net.Conn, config *ThrottleConfig) net.Conn {
+	if !config.enabled() {
+		return c
+	}
+	return &throttledConn{
+		Conn:   c,
+		read:   newTokenBucket(config.ReadBytesPerSec, config.Burst),
+		write:  newTokenBucket(config.WriteBytesPerSec, config.Burst),
+		closed: make(chan struct{}),
+	}
+}
+
+type throttledConn struct {
+	net.Conn
+	read, write *tokenBucket
+
+	mu                          sync.Mutex
+	readDeadline, writeDeadline time.Time
+	closeOnce                   sync.Once
+	closed                      chan struct{}
+}
+
+func (c *throttledConn) Read(b []byte) (int, error) {
+	if c.read == nil {
+		return c.Conn.Read(b)
+	}
+
+	// The number of bytes read is only known afterwards, so the read is
+	// limited to the burst and the throttling delays the next read.
+	if len(b) > c.read.burst {
+		b = b[:c.read.burst]
+	}
+	if err := c.wait(c.read, 0, c.deadline(&c.readDeadline)); err != nil {
+		return 0, err
+	}
+
+	n, err := c.Conn.Read(b)
+	c.read.reserve(n, time.Now())
+	return n, err
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	if c.write == nil {
+		return c.Conn.Write(b)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		chunk := b[:min(len(b), c.write.burst)]
+		if err := c.wait(c.write, len(chunk), c.deadline(&c.writeDeadline)); err != nil {
+			return written, err
+		}
+
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// wait blocks until n bytes can be transferred. If the deadline would be
+// exceeded, no bytes are reserved and os.ErrDeadlineExceeded is returned.
+func (c *throttledConn) wait(bucket *tokenBucket, n int, deadline time.Time) error {
+	now := time.Now()
+	delay := bucket.reserve(n, now)
+	if delay <= 0 {
+		return nil
+	}
+
+	if !deadline.IsZero() && now.Add(delay).After(deadline) {
+		bucket.reserve(-n, now)
+		return os.ErrDeadlineExceeded
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.closed:
+		return net.ErrClosed
+	}
+}
+
+func (c *throttledConn) deadline(d *time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return *d
+}
+
+func (c *throttledConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *throttledConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *throttledConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *throttledConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// tokenBucket implements a token bucket rate limiter. Tokens can be reserved
+// before they are available, making the caller wait for them.
+type tokenBucket struct {
+	rate  float64 // tokens per second
+	burst int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n tokens from the bucket and returns the time to wait until
+// they are available. A negative n returns tokens to the bucket.
+func (b *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*b.rate, float64(b.burst))
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
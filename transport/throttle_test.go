@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transport
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	assert.Nil(t, newTokenBucket(0, 100))
+
+	b := newTokenBucket(100, 50)
+	now := b.last
+
+	assert.Zero(t, b.reserve(50, now))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(10, now))
+	assert.Equal(t, 200*time.Millisecond, b.reserve(10, now))
+
+	// refill after the debt has been paid
+	now = now.Add(700 * time.Millisecond)
+	assert.Zero(t, b.reserve(50, now))
+
+	// tokens never exceed the burst
+	now = now.Add(time.Hour)
+	assert.Zero(t, b.reserve(50, now))
+	assert.NotZero(t, b.reserve(1, now))
+
+	// burst defaults to the rate
+	assert.Equal(t, 1000, newTokenBucket(1000, 0).burst)
+}
+
+func TestThrottleConnWrite(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ThrottleConn(client, &ThrottleConfig{WriteBytesPerSec: 1000, Burst: 100})
+	defer conn.Close()
+
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	start := time.Now()
+	n, err := conn.Write(make([]byte, 300))
+	require.NoError(t, err)
+	assert.Equal(t, 300, n)
+
+	// the first 100 bytes are covered by the burst
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 190*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestThrottleConnRead(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ThrottleConn(client, &ThrottleConfig{ReadBytesPerSec: 1000, Burst: 100})
+	defer conn.Close()
+
+	go func() { _, _ = server.Write(make([]byte, 400)) }()
+
+	// reads are throttled after the fact, delaying the next read
+	start := time.Now()
+	buf := make([]byte, 400)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n, "reads are limited to the burst")
+
+	_, err = io.ReadFull(conn, buf[n:])
+	require.NoError(t, err)
+
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 190*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestThrottleConnDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ThrottleConn(client, &ThrottleConfig{WriteBytesPerSec: 10, Burst: 10})
+	defer conn.Close()
+
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(100*time.Millisecond)))
+	n, err := conn.Write(make([]byte, 20))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, 10, n)
+}
+
+func TestThrottleConnClose(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := ThrottleConn(client, &ThrottleConfig{WriteBytesPerSec: 10, Burst: 10})
+
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	errs := make(chan error)
+	go func() {
+		_, err := conn.Write(make([]byte, 20))
+		errs <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, conn.Close())
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write was not interrupted by close")
+	}
+}
+
+func TestThrottleDisabled(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	assert.Same(t, client, ThrottleConn(client, nil))
+	assert.Same(t, client, ThrottleConn(client, &ThrottleConfig{}))
+}
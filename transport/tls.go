@@ -23,6 +23,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
@@ -129,11 +130,15 @@ func TestTLSDialerH2(
 			lastAddress = address
 			lastTLSConfig = tlsConfig
 		}
+		// NextProtos must be set from the passed h2 connection or it will fail.
+		// Configs in use by concurrent dials are not modified.
+		if !slices.Equal(tlsConfig.NextProtos, cfg.NextProtos) {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.NextProtos = cfg.NextProtos
+			lastTLSConfig = tlsConfig
+		}
 		m.Unlock()
 
-		// NextProtos must be set from the passed h2 connection or it will fail
-		tlsConfig.NextProtos = cfg.NextProtos
-
 		return tlsDialWith(ctx, d, forward, network, address, timeout, tlsConfig, config)
 	}), nil
 }
@@ -20,9 +20,12 @@ package transport
 import (
 	"context"
 	"errors"
+	"io"
 	"net"
+	"sync"
 
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/testing"
 )
 
 type Dialer interface {
@@ -49,22 +52,98 @@ func DialContext(ctx context.Context, c Config, network, address string) (net.Co
 	if err != nil {
 		return nil, err
 	}
-	return d.DialContext(ctx, network, address)
+	conn, err := d.DialContext(ctx, network, address)
+	closer, ok := d.(io.Closer)
+	if !ok {
+		return conn, err
+	}
+	if err != nil {
+		_ = closer.Close()
+		return nil, err
+	}
+	// the dialer is not reused, release it with the connection
+	return &closingConn{Conn: conn, closer: closer}, nil
 }
 
+// MakeDialer creates the dialer stack for the configuration. Middlewares
+// registered with RegisterMiddleware are inserted at their layers.
+//
+// If SSH is configured, the dialer implements io.Closer. Closing it closes
+// the shared SSH connection; dialing again reestablishes it.
 func MakeDialer(c Config, logger *logp.Logger) (Dialer, error) {
 	var err error
-	dialer := NetDialer(c.Timeout)
-	dialer, err = ProxyDialer(logger.Named(logSelector), c.Proxy, dialer)
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	netDialer := &net.Dialer{
+		Timeout: c.Timeout,
+		Control: userTimeoutControl(c.UserTimeout),
+	}
+	c.KeepAlive.apply(netDialer)
+
+	dialer := testNetDialer(testing.NullDriver, netDialer, resolver)
+	if c.FallbackDelay > 0 {
+		dialer = happyEyeballsDialer(netDialer, c.FallbackDelay, resolver)
+	}
+	dialer = applyMiddlewares(LayerNetwork, dialer)
+
+	dialer, err = proxyDialer(logger.Named(logSelector), c.Proxy, dialer, resolver)
 	if err != nil {
 		return nil, err
 	}
-	if c.Stats != nil {
-		dialer = StatsDialer(dialer, c.Stats)
+	var tunnel *SSHTunnel
+	if c.SSH != nil {
+		tunnel, err = SSHDialer(c.SSH, dialer, c.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		dialer = tunnel
 	}
+	dialer = applyMiddlewares(LayerTransport, Chain(dialer, c.transportMiddlewares()...))
 
 	if c.TLS != nil {
-		return TLSDialer(dialer, c.TLS, c.Timeout, logger), nil
+		dialer = TLSDialer(dialer, c.TLS, c.Timeout, logger)
+	}
+	dialer = applyMiddlewares(LayerTLS, dialer)
+	if tunnel != nil {
+		return closableDialer{Dialer: dialer, Closer: tunnel}, nil
 	}
 	return dialer, nil
 }
+
+// closableDialer closes the resources shared by the connections of the
+// dialer, like an SSH connection.
+type closableDialer struct {
+	Dialer
+	io.Closer
+}
+
+// closingConn closes the dialer that created it with the connection.
+type closingConn struct {
+	net.Conn
+	closer    io.Closer
+	closeOnce sync.Once
+}
+
+func (c *closingConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() { _ = c.closer.Close() })
+	return err
+}
+
+// transportMiddlewares returns the configured middlewares applied on top of
+// the proxy.
+func (c *Config) transportMiddlewares() []Middleware {
+	ms := []Middleware{
+		func(d Dialer) Dialer { return ThrottleDialer(d, c.Throttle) },
+	}
+	if c.ConnStats != nil {
+		ms = append(ms, c.ConnStats.Dialer)
+	}
+	if c.Stats != nil {
+		ms = append(ms, func(d Dialer) Dialer { return StatsDialer(d, c.Stats) })
+	}
+	return ms
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transporttest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Response scripts the response to a HTTP request.
+type Response struct {
+	// Status is the response status code. Defaults to 200.
+	Status int
+
+	// Header is added to the response headers. Content-Length is set to the
+	// length of Body.
+	Header http.Header
+
+	// Body is the response body.
+	Body []byte
+
+	// HeaderDelay delays writing the response headers after the request has
+	// been read.
+	HeaderDelay time.Duration
+
+	// BodyDelay delays writing the response body after the headers have been
+	// written.
+	BodyDelay time.Duration
+
+	// ResetAfter resets the connection after writing ResetAfter bytes of the
+	// body, if > 0. The client sees the connection reset while reading the
+	// body.
+	ResetAfter int
+
+	// Close closes the connection after the response has been written.
+	Close bool
+}
+
+// HTTPHandler returns a handler serving HTTP/1.1 requests with the scripted
+// responses. The responses are returned in order, with the last response
+// being repeated for all following requests. The sequence of responses is
+// shared by all connections. If requests is not nil, every request read is
+// sent to it, with the body read. The channel must be read from or be
+// buffered, as the handler blocks until the request has been sent.
+func HTTPHandler(requests chan<- *http.Request, responses ...Response) Handler {
+	if len(responses) == 0 {
+		responses = []Response{{}}
+	}
+	var mu sync.Mutex
+	next := func() Response {
+		mu.Lock()
+		defer mu.Unlock()
+		r := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		return r
+	}
+
+	return func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		for {
+			req, err := http.ReadRequest(reader)
+			if err != nil {
+				return
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			if requests != nil {
+				requests <- req
+			}
+
+			if !writeResponse(conn, next()) {
+				return
+			}
+		}
+	}
+}
+
+// writeResponse writes the response, returning false if the connection must
+// not be used anymore.
+func writeResponse(conn net.Conn, r Response) bool {
+	if r.HeaderDelay > 0 {
+		time.Sleep(r.HeaderDelay)
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Length", strconv.Itoa(len(r.Body)))
+	if r.Close {
+		header.Set("Connection", "close")
+	}
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "HTTP/1.1 %03d %s\r\n", status, http.StatusText(status))
+	if err := header.Write(w); err != nil {
+		return false
+	}
+	w.WriteString("\r\n")
+	if err := w.Flush(); err != nil {
+		return false
+	}
+
+	if r.BodyDelay > 0 {
+		time.Sleep(r.BodyDelay)
+	}
+	if r.ResetAfter > 0 && r.ResetAfter < len(r.Body) {
+		_, _ = conn.Write(r.Body[:r.ResetAfter])
+		Reset(conn)
+		return false
+	}
+	if _, err := conn.Write(r.Body); err != nil {
+		return false
+	}
+	return !r.Close
+}
+
+// Reset closes the connection, sending a TCP RST instead of a FIN if
+// possible, such that the peer sees `connection reset by peer` errors. For
+// TLS connections the underlying connection is closed, without sending a
+// close_notify alert.
+func Reset(conn net.Conn) {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// Echo is a handler writing back all data read.
+func Echo(conn net.Conn) {
+	_, _ = io.Copy(conn, conn)
+}
+
+// Hang is a handler reading and discarding all data without ever responding,
+// until the connection is closed.
+func Hang(conn net.Conn) {
+	_, _ = io.Copy(io.Discard, conn)
+}
@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transporttest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	requests := make(chan *http.Request, 3)
+	server := NewServer(t, HTTPHandler(requests,
+		Response{Status: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"1"}}},
+		Response{Body: []byte("ok")},
+	), WithTLS())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: server.ClientTLSConfig()}}
+
+	resp, err := client.Get(server.URL() + "/first")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	for range 2 {
+		resp, err = client.Post(server.URL()+"/next", "text/plain", strings.NewReader("body"))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+	}
+
+	// all requests use the same connection
+	assert.Equal(t, 1, server.Accepted())
+
+	req := <-requests
+	assert.Equal(t, "/first", req.URL.Path)
+	req = <-requests
+	assert.Equal(t, http.MethodPost, req.Method)
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(body))
+}
+
+func TestHTTPHandlerSlowHeaders(t *testing.T) {
+	server := NewServer(t, HTTPHandler(nil, Response{HeaderDelay: time.Second}))
+	client := &http.Client{Transport: &http.Transport{ResponseHeaderTimeout: 50 * time.Millisecond}}
+
+	_, err := client.Get(server.URL())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+}
+
+func TestHTTPHandlerResetMidBody(t *testing.T) {
+	server := NewServer(t, HTTPHandler(nil, Response{Body: []byte("0123456789"), ResetAfter: 4}))
+
+	resp, err := http.Get(server.URL())
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.EqualValues(t, 10, resp.ContentLength)
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Equal(t, "0123", string(body))
+	require.Error(t, err)
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+	} else {
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestHTTPHandlerClose(t *testing.T) {
+	server := NewServer(t, HTTPHandler(nil, Response{Close: true}))
+
+	for range 2 {
+		resp, err := http.Get(server.URL())
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.True(t, resp.Close)
+	}
+	assert.Equal(t, 2, server.Accepted())
+}
@@ -0,0 +1,288 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package transporttest provides TCP, TLS and HTTP test servers with
+// scripted behaviors, like slow responses, connections reset in the middle of
+// a response or invalid server certificates, to test clients against.
+//
+// TLS renegotiation cannot be scripted, as crypto/tls does not support
+// renegotiation on the server side.
+package transporttest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elastic/elastic-agent-libs/transport/tlscommontest"
+)
+
+// Handler handles a connection accepted by a Server. The connection is closed
+// once the handler returns.
+type Handler func(net.Conn)
+
+// CertKind selects the certificate presented by a TLS server.
+type CertKind uint8
+
+const (
+	// CertValid is a certificate for localhost and 127.0.0.1 signed by the
+	// server CA.
+	CertValid CertKind = iota
+
+	// CertWrongHost is a certificate signed by the server CA that is not
+	// valid for localhost.
+	CertWrongHost
+
+	// CertExpired is an expired certificate signed by the server CA.
+	CertExpired
+
+	// CertUntrusted is a certificate for localhost not signed by the server
+	// CA.
+	CertUntrusted
+)
+
+// Option configures a Server.
+type Option func(*options)
+
+type options struct {
+	tls        bool
+	certKind   CertKind
+	clientAuth tls.ClientAuthType
+}
+
+// WithTLS makes the server use TLS, presenting a valid certificate signed by
+// the server CA.
+func WithTLS() Option {
+	return func(o *options) { o.tls = true }
+}
+
+// WithCertificate makes the server use TLS, presenting a certificate of the
+// given kind.
+func WithCertificate(kind CertKind) Option {
+	return func(o *options) {
+		o.tls = true
+		o.certKind = kind
+	}
+}
+
+// WithClientAuth makes the server use TLS, requesting client certificates
+// according to the given type. Client certificates are verified against the
+// server CA.
+func WithClientAuth(auth tls.ClientAuthType) Option {
+	return func(o *options) {
+		o.tls = true
+		o.clientAuth = auth
+	}
+}
+
+// Server is a test server listening on a random port on 127.0.0.1. The
+// server is closed when the test finishes.
+type Server struct {
+	// Addr is the address the server listens on.
+	Addr string
+
+	// CA is the certificate authority of TLS servers. It is set for servers
+	// not using TLS too, to sign client certificates.
+	CA tls.Certificate
+
+	tls      bool
+	listener net.Listener
+	accepted atomic.Int64
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewServer starts a server calling handler for every accepted connection.
+func NewServer(t testing.TB, handler Handler, opts ...Option) *Server {
+	t.Helper()
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ca, err := tlscommontest.GenCA()
+	if err != nil {
+		t.Fatalf("failed to generate CA: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	if o.tls {
+		config, err := serverTLSConfig(ca, o)
+		if err != nil {
+			listener.Close()
+			t.Fatalf("failed to create TLS config: %v", err)
+		}
+		listener = tls.NewListener(listener, config)
+	}
+
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		CA:       ca,
+		tls:      o.tls,
+		listener: listener,
+		conns:    map[net.Conn]struct{}{},
+	}
+	s.wg.Add(1)
+	go s.serve(handler)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func serverTLSConfig(ca tls.Certificate, o options) (*tls.Config, error) {
+	issuer := ca
+	if o.certKind == CertUntrusted {
+		other, err := tlscommontest.GenCA()
+		if err != nil {
+			return nil, err
+		}
+		issuer = other
+	}
+
+	dnsNames, ips := []string{"localhost"}, []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if o.certKind == CertWrongHost {
+		dnsNames, ips = []string{"wrong.example.com"}, nil
+	}
+	cert, err := tlscommontest.GenSignedCert(
+		issuer,
+		x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment,
+		false,
+		dnsNames[0],
+		dnsNames,
+		ips,
+		o.certKind == CertExpired,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.Leaf)
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   o.clientAuth,
+		ClientCAs:    clientCAs,
+	}, nil
+}
+
+func (s *Server) serve(handler Handler) {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.accepted.Add(1)
+
+		s.mu.Lock()
+		if s.conns == nil {
+			// closed
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			handler(conn)
+		}()
+	}
+}
+
+// URL returns the base URL of the server, using the https scheme for TLS
+// servers.
+func (s *Server) URL() string {
+	if s.tls {
+		return "https://" + s.Addr
+	}
+	return "http://" + s.Addr
+}
+
+// Accepted returns the number of connections accepted so far.
+func (s *Server) Accepted() int {
+	return int(s.accepted.Load())
+}
+
+// CAPool returns a certificate pool containing the server CA.
+func (s *Server) CAPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.CA.Leaf)
+	return pool
+}
+
+// CAPEM returns the PEM encoded server CA, as accepted by
+// tlscommon.Config.CAs.
+func (s *Server) CAPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.CA.Leaf.Raw}))
+}
+
+// ClientTLSConfig returns a TLS configuration trusting the server CA.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.CAPool()}
+}
+
+// ClientCertificate returns a client certificate signed by the server CA.
+func (s *Server) ClientCertificate(t testing.TB) tls.Certificate {
+	t.Helper()
+
+	cert, err := tlscommontest.GenSignedCert(
+		s.CA,
+		x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment,
+		false,
+		"client",
+		nil,
+		nil,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate client certificate: %v", err)
+	}
+	return cert
+}
+
+// Close stops the server, closing all open connections, and waits for the
+// handlers to return. Close is called when the test finishes.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
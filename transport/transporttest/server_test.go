@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package transporttest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireEcho(t *testing.T, dial func() (io.ReadWriteCloser, error)) {
+	t.Helper()
+
+	conn, err := dial()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "ping", string(buf))
+}
+
+func TestServerTLS(t *testing.T) {
+	server := NewServer(t, Echo, WithTLS())
+	assert.Equal(t, "https://"+server.Addr, server.URL())
+
+	requireEcho(t, func() (io.ReadWriteCloser, error) {
+		return tls.Dial("tcp", server.Addr, server.ClientTLSConfig())
+	})
+	assert.Equal(t, 1, server.Accepted())
+
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM([]byte(server.CAPEM())))
+	requireEcho(t, func() (io.ReadWriteCloser, error) {
+		return tls.Dial("tcp", server.Addr, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	})
+}
+
+func TestServerInvalidCertificates(t *testing.T) {
+	tests := map[string]struct {
+		kind CertKind
+		err  any
+	}{
+		"wrong host": {kind: CertWrongHost, err: &x509.HostnameError{}},
+		"expired":    {kind: CertExpired, err: &x509.CertificateInvalidError{}},
+		"untrusted":  {kind: CertUntrusted, err: &x509.UnknownAuthorityError{}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := NewServer(t, Echo, WithCertificate(test.kind))
+			conn, err := tls.Dial("tcp", server.Addr, server.ClientTLSConfig())
+			if conn != nil {
+				conn.Close()
+			}
+			require.Error(t, err)
+			assert.ErrorAs(t, err, test.err)
+		})
+	}
+}
+
+func TestServerClientAuth(t *testing.T) {
+	server := NewServer(t, Echo, WithClientAuth(tls.RequireAndVerifyClientCert))
+
+	config := server.ClientTLSConfig()
+	config.Certificates = []tls.Certificate{server.ClientCertificate(t)}
+	requireEcho(t, func() (io.ReadWriteCloser, error) {
+		return tls.Dial("tcp", server.Addr, config)
+	})
+
+	// the server rejects the handshake after the client completed it, the
+	// error is reported on first read
+	conn, err := tls.Dial("tcp", server.Addr, server.ClientTLSConfig())
+	if err == nil {
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+	}
+	assert.Error(t, err)
+}
+
+func TestServerCloseClosesConnections(t *testing.T) {
+	server := NewServer(t, Hang)
+	assert.Equal(t, "http://"+server.Addr, server.URL())
+
+	conn, err := net.Dial("tcp", server.Addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ignored"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return server.Accepted() == 1 }, time.Second, time.Millisecond)
+
+	server.Close()
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}